@@ -47,6 +47,54 @@ var (
 		Usage: "Tests which databases would be deleted. Does not actually delete any data, nor prompt for confirmation",
 	}
 
+	// beaconProxyDryRunFlag scores proxy beacons without writing the results
+	beaconProxyDryRunFlag = cli.BoolFlag{
+		Name:  "beaconproxy-dry-run",
+		Usage: "Score proxy beacons without writing the results to the database. A summary of the scores is printed instead",
+	}
+
+	// beaconProxySrcFlag limits the proxy beacon analysis to a single source
+	beaconProxySrcFlag = cli.StringFlag{
+		Name:  "beaconproxy-src",
+		Usage: "Only score the proxy beacons from the source `IP`",
+	}
+
+	// beaconProxyFQDNFlag limits the proxy beacon analysis to a single destination
+	beaconProxyFQDNFlag = cli.StringFlag{
+		Name:  "beaconproxy-fqdn",
+		Usage: "Only score the proxy beacons to `FQDN`",
+	}
+
+	// sinceFlag drops the records logged before a timestamp during the import
+	sinceFlag = cli.Int64Flag{
+		Name:  "since",
+		Usage: "Only import the records logged at or after the Unix timestamp `TS`",
+	}
+
+	// untilFlag drops the records logged after a timestamp during the import
+	untilFlag = cli.Int64Flag{
+		Name:  "until",
+		Usage: "Only import the records logged at or before the Unix timestamp `TS`",
+	}
+
+	// maxFilesFlag caps the number of log files imported for smoke tests
+	maxFilesFlag = cli.IntFlag{
+		Name:  "max-files",
+		Usage: "Only import the first `N` log files found, for testing on a subset of the logs",
+	}
+
+	// maxLinesFlag caps the number of records parsed from each log file for smoke tests
+	maxLinesFlag = cli.Int64Flag{
+		Name:  "max-lines",
+		Usage: "Only parse the first `N` records of each log file, for testing on a subset of the logs",
+	}
+
+	// appendFlag adds the records logged after those already imported to the current chunk
+	appendFlag = cli.BoolFlag{
+		Name:  "append",
+		Usage: "Only import the records logged after those already imported and add them to the current chunk",
+	}
+
 	// deleteFlag indicates whether any matching, existing data should be deleted
 	// before importing the target data
 	deleteFlag = cli.BoolFlag{
@@ -0,0 +1,52 @@
+package commands
+
+import (
+	"os"
+
+	"github.com/activecm/rita/pkg/beaconproxy"
+	"github.com/activecm/rita/resources"
+	"github.com/urfave/cli"
+)
+
+func init() {
+	command := cli.Command{
+		Name:      "compare-beacons-proxy",
+		Usage:     "Print the proxy beacons found in only one of two databases and the score changes of the rest",
+		ArgsUsage: "<base database> <other database>",
+		Flags: []cli.Flag{
+			ConfigFlag,
+			cli.BoolFlag{
+				Name:  "json",
+				Usage: "Print the differences as newline delimited JSON rather than a table",
+			},
+		},
+		Action: compareBeaconsProxy,
+	}
+
+	bootstrapCommands(command)
+}
+
+func compareBeaconsProxy(c *cli.Context) error {
+	baseDB := c.Args().Get(0)
+	otherDB := c.Args().Get(1)
+	if baseDB == "" || otherDB == "" {
+		return cli.NewExitError("Specify two databases", -1)
+	}
+	res := resources.InitResources(c.String("config"))
+
+	diffs, err := beaconproxy.Compare(res, baseDB, otherDB)
+	if err != nil {
+		res.Log.Error(err)
+		return cli.NewExitError(err.Error(), -1)
+	}
+
+	if c.Bool("json") {
+		err = beaconproxy.WriteComparisonJSON(diffs, os.Stdout)
+	} else {
+		err = beaconproxy.WriteComparisonTable(diffs, os.Stdout)
+	}
+	if err != nil {
+		return cli.NewExitError(err.Error(), -1)
+	}
+	return nil
+}
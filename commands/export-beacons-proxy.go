@@ -0,0 +1,89 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/activecm/rita/pkg/beaconproxy"
+	"github.com/activecm/rita/resources"
+	"github.com/urfave/cli"
+)
+
+var (
+	// exportOutputFlag sets the file exports are written to
+	exportOutputFlag = cli.StringFlag{
+		Name:  "output, o",
+		Usage: "Write the export to `FILE` rather than stdout",
+	}
+
+	// exportMinScoreFlag sets the lowest score which is exported
+	exportMinScoreFlag = cli.Float64Flag{
+		Name:  "min-score",
+		Usage: "Only export results scoring at least `SCORE`",
+		Value: 0,
+	}
+
+	// exportChunkFlag limits exports to the results of a single chunk
+	exportChunkFlag = cli.IntFlag{
+		Name:  "chunk",
+		Usage: "Only export the results last updated in chunk `N` of a rolling database",
+		Value: -1,
+	}
+)
+
+//openExportOutput opens the file set by exportOutputFlag, or returns stdout if the path
+//is empty. The returned function closes the file. The exports print their summaries to
+//stderr to keep stdout clean for the export itself.
+func openExportOutput(path string) (io.Writer, func(), error) {
+	if path == "" {
+		return os.Stdout, func() {}, nil
+	}
+
+	outFile, err := os.Create(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return outFile, func() { outFile.Close() }, nil
+}
+
+func init() {
+	command := cli.Command{
+		Name:      "export-beacons-proxy",
+		Usage:     "Export proxy beacons as newline delimited JSON",
+		ArgsUsage: "<database>",
+		Flags: []cli.Flag{
+			ConfigFlag,
+			exportOutputFlag,
+			exportMinScoreFlag,
+			exportChunkFlag,
+		},
+		Action: exportBeaconsProxy,
+	}
+
+	bootstrapCommands(command)
+}
+
+func exportBeaconsProxy(c *cli.Context) error {
+	db := c.Args().Get(0)
+	if db == "" {
+		return cli.NewExitError("Specify a database", -1)
+	}
+	res := resources.InitResources(c.String("config"))
+	res.DB.SelectDB(db)
+
+	output, closeOutput, err := openExportOutput(c.String("output"))
+	if err != nil {
+		return cli.NewExitError(err.Error(), -1)
+	}
+	defer closeOutput()
+
+	count, err := beaconproxy.Export(res, c.Int("chunk"), c.Float64("min-score"), output)
+	if err != nil {
+		res.Log.Error(err)
+		return cli.NewExitError(err.Error(), -1)
+	}
+
+	fmt.Fprintf(os.Stderr, "Exported %d proxy beacons from %s\n", count, db)
+	return nil
+}
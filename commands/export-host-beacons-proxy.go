@@ -0,0 +1,54 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/activecm/rita/pkg/beaconproxy"
+	"github.com/activecm/rita/resources"
+	"github.com/urfave/cli"
+)
+
+func init() {
+	command := cli.Command{
+		Name:      "export-host-beacons-proxy",
+		Usage:     "Export the top proxy beacon of each source host as CSV",
+		ArgsUsage: "<database>",
+		Flags: []cli.Flag{
+			ConfigFlag,
+			exportOutputFlag,
+			exportMinScoreFlag,
+		},
+		Action: exportHostBeaconsProxy,
+	}
+
+	bootstrapCommands(command)
+}
+
+func exportHostBeaconsProxy(c *cli.Context) error {
+	db := c.Args().Get(0)
+	if db == "" {
+		return cli.NewExitError("Specify a database", -1)
+	}
+	res := resources.InitResources(c.String("config"))
+	res.DB.SelectDB(db)
+
+	summaries, err := beaconproxy.HostSummaries(res, c.Float64("min-score"))
+	if err != nil {
+		res.Log.Error(err)
+		return cli.NewExitError(err.Error(), -1)
+	}
+
+	output, closeOutput, err := openExportOutput(c.String("output"))
+	if err != nil {
+		return cli.NewExitError(err.Error(), -1)
+	}
+	defer closeOutput()
+
+	if err := beaconproxy.WriteHostSummariesCSV(summaries, output); err != nil {
+		return cli.NewExitError(err.Error(), -1)
+	}
+
+	fmt.Fprintf(os.Stderr, "Exported %d host proxy beacons from %s\n", len(summaries), db)
+	return nil
+}
@@ -0,0 +1,58 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/activecm/rita/pkg/beaconproxy"
+	"github.com/activecm/rita/resources"
+	"github.com/urfave/cli"
+)
+
+func init() {
+	command := cli.Command{
+		Name:      "export-misp-beacons-proxy",
+		Usage:     "Export high scoring proxy beacons as a MISP event",
+		ArgsUsage: "<database>",
+		Flags: []cli.Flag{
+			ConfigFlag,
+			exportOutputFlag,
+			cli.Float64Flag{
+				Name:  "min-score",
+				Usage: "Only export proxy beacons scoring above `SCORE`. Defaults to BeaconProxy.MISP.MinScore.",
+			},
+		},
+		Action: exportMISPBeaconsProxy,
+	}
+
+	bootstrapCommands(command)
+}
+
+func exportMISPBeaconsProxy(c *cli.Context) error {
+	db := c.Args().Get(0)
+	if db == "" {
+		return cli.NewExitError("Specify a database", -1)
+	}
+	res := resources.InitResources(c.String("config"))
+	res.DB.SelectDB(db)
+
+	minScore := res.Config.S.BeaconProxy.MISP.MinScore
+	if c.IsSet("min-score") {
+		minScore = c.Float64("min-score")
+	}
+
+	output, closeOutput, err := openExportOutput(c.String("output"))
+	if err != nil {
+		return cli.NewExitError(err.Error(), -1)
+	}
+	defer closeOutput()
+
+	count, err := beaconproxy.ExportMISP(res, minScore, output)
+	if err != nil {
+		res.Log.Error(err)
+		return cli.NewExitError(err.Error(), -1)
+	}
+
+	fmt.Fprintf(os.Stderr, "Exported %d proxy beacons from %s\n", count, db)
+	return nil
+}
@@ -0,0 +1,78 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/activecm/rita/pkg/beaconproxy"
+	"github.com/activecm/rita/resources"
+	"github.com/urfave/cli"
+)
+
+func init() {
+	command := cli.Command{
+		Name:      "export-openc2-beacons-proxy",
+		Usage:     "Export the destinations of high scoring proxy beacons as OpenC2 commands",
+		ArgsUsage: "<database>",
+		Flags: []cli.Flag{
+			ConfigFlag,
+			exportOutputFlag,
+			cli.Float64Flag{
+				Name:  "min-score",
+				Usage: "Only export proxy beacons scoring above `SCORE`. Defaults to BeaconProxy.OpenC2.MinScore.",
+			},
+			cli.StringFlag{
+				Name:  "action",
+				Usage: "Issue `ACTION` (deny or contain) against each destination. Defaults to BeaconProxy.OpenC2.Action.",
+			},
+			cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "Log the commands rather than emitting them",
+			},
+		},
+		Action: exportOpenC2BeaconsProxy,
+	}
+
+	bootstrapCommands(command)
+}
+
+func exportOpenC2BeaconsProxy(c *cli.Context) error {
+	db := c.Args().Get(0)
+	if db == "" {
+		return cli.NewExitError("Specify a database", -1)
+	}
+	res := resources.InitResources(c.String("config"))
+	res.DB.SelectDB(db)
+
+	conf := res.Config.S.BeaconProxy.OpenC2
+	if c.IsSet("min-score") {
+		conf.MinScore = c.Float64("min-score")
+	}
+	if c.IsSet("action") {
+		conf.Action = c.String("action")
+	}
+
+	// dry runs only log the commands, so nothing is written to the output file
+	outputPath := c.String("output")
+	if c.Bool("dry-run") {
+		outputPath = ""
+	}
+	output, closeOutput, err := openExportOutput(outputPath)
+	if err != nil {
+		return cli.NewExitError(err.Error(), -1)
+	}
+	defer closeOutput()
+
+	count, err := beaconproxy.ExportOpenC2(res, conf.MinScore, conf.Action, conf.Limit, c.Bool("dry-run"), output)
+	if err != nil {
+		res.Log.Error(err)
+		return cli.NewExitError(err.Error(), -1)
+	}
+
+	if c.Bool("dry-run") {
+		fmt.Fprintf(os.Stderr, "Logged %d OpenC2 commands for proxy beacons from %s\n", count, db)
+		return nil
+	}
+	fmt.Fprintf(os.Stderr, "Exported %d OpenC2 commands for proxy beacons from %s\n", count, db)
+	return nil
+}
@@ -0,0 +1,118 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/activecm/rita/pkg/beaconproxy"
+	"github.com/activecm/rita/resources"
+	"github.com/urfave/cli"
+)
+
+func init() {
+	command := cli.Command{
+		Name:      "import-beacons-proxy",
+		Usage:     "Analyze proxy connections aggregated outside of RITA",
+		ArgsUsage: "<newline delimited JSON file | -> <database>",
+		Flags: []cli.Flag{
+			ConfigFlag,
+			cli.IntFlag{
+				Name:  "chunk",
+				Usage: "Record the results as chunk `N` of the database. Analyzing the same chunk again replaces its results.",
+			},
+		},
+		Action: importBeaconsProxy,
+	}
+
+	bootstrapCommands(command)
+}
+
+func importBeaconsProxy(c *cli.Context) error {
+	path := c.Args().Get(0)
+	db := c.Args().Get(1)
+	if path == "" || db == "" {
+		return cli.NewExitError("Specify a file and a database", -1)
+	}
+	res := resources.InitResources(c.String("config"))
+
+	var input io.Reader = os.Stdin
+	if path != "-" {
+		inFile, err := os.Open(path)
+		if err != nil {
+			return cli.NewExitError(err.Error(), -1)
+		}
+		defer inFile.Close()
+		input = inFile
+	}
+
+	batch, err := beaconproxy.ReadAggregated(input, int64(res.Config.S.Strobe.ConnectionLimit))
+	if err != nil {
+		return cli.NewExitError(fmt.Sprintf("Could not read %s: %v", path, err), -1)
+	}
+	if batch.Skipped > 0 {
+		fmt.Printf("\t[-] Skipped %d records with 3 or fewer unique timestamps\n", batch.Skipped)
+	}
+
+	res.DB.SelectDB(db)
+
+	exists, isRolling, _, totalChunks, err := res.MetaDB.GetRollingSettings(db)
+	if err != nil {
+		return cli.NewExitError(err.Error(), -1)
+	}
+
+	chunk := c.Int("chunk")
+	if err := validateAnalysisChunk(chunk, isRolling, totalChunks); err != nil {
+		return cli.NewExitError(err.Error(), -1)
+	}
+	res.Config.S.Rolling.CurrentChunk = chunk
+
+	// register the database so it is listed along with the imported databases
+	if !exists {
+		err := res.MetaDB.AddNewDB(db, chunk, res.Config.S.Rolling.TotalChunks)
+		if err != nil {
+			return cli.NewExitError(err.Error(), -1)
+		}
+	}
+
+	// stop analyzing once the command is interrupted so the workers exit promptly
+	ctx, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+
+	repo := beaconproxy.NewMongoRepository(ctx, res.DB, res.Config, res.Log)
+	if err := repo.CreateIndexes(); err != nil {
+		res.Log.Error(err)
+		return cli.NewExitError(err.Error(), -1)
+	}
+
+	fmt.Printf("\t[+] Analyzing %d aggregated proxy connections\n", len(batch.Entries))
+	if err := repo.AnalyzeAggregated(batch.Entries, batch.MinTimestamp, batch.MaxTimestamp); err != nil {
+		res.Log.Error(err)
+		return cli.NewExitError(fmt.Sprintf("Could not write the proxy beacon results: %v", err), -1)
+	}
+	if err := ctx.Err(); err != nil {
+		return cli.NewExitError(fmt.Sprintf("The proxy beacon analysis was interrupted: %v", err), -1)
+	}
+
+	if err := res.MetaDB.MarkDBAnalyzed(db, true); err != nil {
+		return cli.NewExitError(err.Error(), -1)
+	}
+	return nil
+}
+
+//validateAnalysisChunk ensures the results may be recorded as the given chunk of a database
+func validateAnalysisChunk(chunk int, isRolling bool, totalChunks int) error {
+	if chunk < 0 {
+		return fmt.Errorf("\t[!] Chunk number [ %d ] must be 0 or greater", chunk)
+	}
+	if isRolling && chunk >= totalChunks {
+		return fmt.Errorf(
+			"\t[!] Chunk number [ %d ] must be less than the total number of chunks [ %d ] of the rolling database",
+			chunk, totalChunks,
+		)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/urfave/cli"
+)
+
+func init() {
+	importKafkaCommand := cli.Command{
+		Name:  "import-kafka",
+		Usage: "Import zeek logs from Kafka topics into a target database",
+		UsageText: "rita import-kafka [command options] <database name>\n\n" +
+			"Reads Zeek JSON logs from the Kafka topics set in the Kafka section of the config file" +
+			" and imports them into a database named <database name>. The records read are written" +
+			" to the database every Kafka.FlushInterval seconds and when RITA is interrupted, after" +
+			" which their offsets are committed to the consumer group.",
+		Flags: []cli.Flag{
+			ConfigFlag,
+			rollingFlag,
+			totalChunksFlag,
+			currentChunkFlag,
+			cli.StringFlag{
+				Name:  "brokers",
+				Usage: "Connect to the comma separated Kafka `BROKERS` instead of Kafka.Brokers",
+			},
+			cli.StringFlag{
+				Name:  "group",
+				Usage: "Join the consumer group `ID` instead of Kafka.GroupID",
+			},
+		},
+		Action: importKafka,
+	}
+
+	bootstrapCommands(importKafkaCommand)
+}
+
+func importKafka(c *cli.Context) error {
+	res, importer, err := initStreamImporter(c)
+	if err != nil {
+		return err
+	}
+	if c.String("brokers") != "" {
+		res.Config.S.Kafka.Brokers = strings.Split(c.String("brokers"), ",")
+	}
+	if c.String("group") != "" {
+		res.Config.S.Kafka.GroupID = c.String("group")
+	}
+
+	ctx, cancel := interruptContext()
+	defer cancel()
+
+	targetDatabase := res.DB.GetSelectedDB()
+	res.Log.Infof("Consuming Kafka logs to import into %v\n", targetDatabase)
+	err = importer.ConsumeKafka(ctx)
+	if err != nil {
+		return cli.NewExitError(fmt.Errorf("\n\t[!] %v", err), -1)
+	}
+
+	res.Log.Infof("Finished importing logs into %v\n", targetDatabase)
+	fmt.Println("\t[-] Done!")
+	return nil
+}
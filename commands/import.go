@@ -1,17 +1,26 @@
 package commands
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 
 	"github.com/activecm/rita/config"
+	"github.com/activecm/rita/metrics"
 	"github.com/activecm/rita/parser"
+	parserfiles "github.com/activecm/rita/parser/files"
 	"github.com/activecm/rita/pkg/remover"
 	"github.com/activecm/rita/resources"
+	"github.com/activecm/rita/tracing"
 	"github.com/activecm/rita/util"
 	log "github.com/sirupsen/logrus"
 	"github.com/urfave/cli"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 )
 
 func init() {
@@ -20,7 +29,10 @@ func init() {
 		Usage: "Import zeek logs into a target database",
 		UsageText: "rita import [command options] <import directory|file> [<import directory|file>...] <database name>\n\n" +
 			"Logs directly in <import directory> will be imported into a database" +
-			" named <database name>.",
+			" named <database name>. Logs stored in S3 may be imported with paths of" +
+			" the form s3://bucket/prefix using the standard AWS credentials." +
+			" Named pipes (FIFOs) given directly are read until the writer closes them," +
+			" while named pipes inside of an import directory are ignored.",
 		Flags: []cli.Flag{
 			ConfigFlag,
 			threadFlag,
@@ -28,6 +40,14 @@ func init() {
 			rollingFlag,
 			totalChunksFlag,
 			currentChunkFlag,
+			beaconProxyDryRunFlag,
+			beaconProxySrcFlag,
+			beaconProxyFQDNFlag,
+			sinceFlag,
+			untilFlag,
+			appendFlag,
+			maxFilesFlag,
+			maxLinesFlag,
 		},
 		Action: func(c *cli.Context) error {
 			importer := NewImporter(c)
@@ -53,6 +73,14 @@ type (
 		userTotalChunks int
 		userCurrChunk   int
 		threads         int
+		proxyDryRun     bool
+		proxySrc        string
+		proxyFQDN       string
+		since           int64
+		until           int64
+		appendData      bool
+		maxFiles        int
+		maxLines        int64
 	}
 )
 
@@ -66,6 +94,14 @@ func NewImporter(c *cli.Context) *Importer {
 		userTotalChunks: c.Int("numchunks"),
 		userCurrChunk:   c.Int("chunk"),
 		threads:         util.Max(c.Int("threads")/2, 1),
+		proxyDryRun:     c.Bool("beaconproxy-dry-run"),
+		proxySrc:        c.String("beaconproxy-src"),
+		proxyFQDN:       c.String("beaconproxy-fqdn"),
+		since:           c.Int64("since"),
+		until:           c.Int64("until"),
+		appendData:      c.Bool("append"),
+		maxFiles:        c.Int("max-files"),
+		maxLines:        c.Int64("max-lines"),
 	}
 }
 
@@ -99,6 +135,11 @@ func (i *Importer) parseArgs() error {
 
 func checkFilesExist(files []string) error {
 	for _, file := range files {
+		// S3 locations are checked when their objects are listed and
+		// glob patterns when they are expanded
+		if parserfiles.IsS3Path(file) || parserfiles.IsGlobPattern(file) {
+			continue
+		}
 		if !util.Exists(file) {
 			return cli.NewExitError(fmt.Errorf("\n\t[!] %v cannot be found", file), -1)
 		}
@@ -200,6 +241,33 @@ func parseFlags(dbExists bool, dbIsRolling bool, dbCurrChunk int, dbTotalChunks
 	return cfg, nil
 }
 
+// appendRollingCfg determines the rolling configuration of an import which appends to
+// the current chunk of an existing database. Appending can't be combined with the
+// options which choose or replace a chunk.
+func appendRollingCfg(dbIsRolling bool, dbCurrChunk int, dbTotalChunks int,
+	userIsRolling bool, userCurrChunk int, userTotalChunks int, cfgDefaultChunks int,
+	deleteOldData bool) (config.RollingStaticCfg, error) {
+
+	if deleteOldData || userIsRolling || userCurrChunk != -1 || userTotalChunks != -1 {
+		return config.RollingStaticCfg{}, errors.New(
+			"\t[!] --append adds to the current chunk and can't be combined with --delete, --rolling, --chunk, or --numchunks",
+		)
+	}
+
+	cfg := config.RollingStaticCfg{
+		DefaultChunks: cfgDefaultChunks,
+		Rolling:       dbIsRolling,
+		CurrentChunk:  dbCurrChunk,
+		TotalChunks:   dbTotalChunks,
+	}
+	// non-rolling databases hold a single chunk
+	if !dbIsRolling {
+		cfg.CurrentChunk = 0
+		cfg.TotalChunks = 1
+	}
+	return cfg, nil
+}
+
 // run runs the importer
 func (i *Importer) run() error {
 	// verify command line arguments
@@ -210,6 +278,51 @@ func (i *Importer) run() error {
 
 	i.res = resources.InitResources(i.configFile)
 
+	if i.proxyDryRun {
+		i.res.Config.S.BeaconProxy.DryRun = true
+	}
+	if i.proxySrc != "" {
+		i.res.Config.S.BeaconProxy.Target.Src = i.proxySrc
+	}
+	if i.proxyFQDN != "" {
+		i.res.Config.S.BeaconProxy.Target.FQDN = i.proxyFQDN
+	}
+	if i.since != 0 {
+		i.res.Config.S.Parsing.Since = i.since
+	}
+	if i.until != 0 {
+		i.res.Config.S.Parsing.Until = i.until
+	}
+	err = validateTimeWindow(i.res.Config.S.Parsing.Since, i.res.Config.S.Parsing.Until)
+	if err != nil {
+		return cli.NewExitError(err.Error(), -1)
+	}
+	if i.maxFiles != 0 {
+		i.res.Config.S.Parsing.MaxFiles = i.maxFiles
+	}
+	if i.maxLines != 0 {
+		i.res.Config.S.Parsing.MaxLines = i.maxLines
+	}
+	if i.res.Config.S.Parsing.MaxFiles < 0 || i.res.Config.S.Parsing.MaxLines < 0 {
+		return cli.NewExitError("\t[!] The --max-files and --max-lines caps must be 0 or greater", -1)
+	}
+
+	// expose the import's progress to Prometheus if requested
+	if i.res.Config.S.Metrics.Enabled {
+		metrics.Serve(i.res.Config.S.Metrics.ListenAddress, i.res.Log)
+	}
+
+	// stop analyzing once the import is interrupted so the workers exit promptly
+	ctx, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+
+	// trace the phases of the import if requested. The spans of the import are
+	// children of a single span covering the whole run.
+	stopTracing := tracing.Init(&i.res.Config.S.Tracing, config.Version, i.res.Log)
+	defer stopTracing()
+	ctx, span := tracing.Start(ctx, "import", attribute.String("rita.database", i.targetDatabase))
+	defer span.End()
+
 	// set up target database
 	i.res.DB.SelectDB(i.targetDatabase)
 
@@ -222,11 +335,19 @@ func (i *Importer) run() error {
 
 	// validate the user given flags against the rolling settings from the MetaDB
 	// and determine the rolling configuration
-	rollingCfg, err := parseFlags(
-		exists, isRolling, currChunk, totalChunks,
-		i.userRolling, i.userCurrChunk, i.userTotalChunks, i.res.Config.S.Rolling.DefaultChunks,
-		i.deleteOldData,
-	)
+	var rollingCfg config.RollingStaticCfg
+	if i.appendData && exists {
+		rollingCfg, err = appendRollingCfg(isRolling, currChunk, totalChunks,
+			i.userRolling, i.userCurrChunk, i.userTotalChunks, i.res.Config.S.Rolling.DefaultChunks,
+			i.deleteOldData,
+		)
+	} else {
+		rollingCfg, err = parseFlags(
+			exists, isRolling, currChunk, totalChunks,
+			i.userRolling, i.userCurrChunk, i.userTotalChunks, i.res.Config.S.Rolling.DefaultChunks,
+			i.deleteOldData,
+		)
+	}
 	if err != nil {
 		return cli.NewExitError(err.Error(), -1)
 	}
@@ -236,8 +357,13 @@ func (i *Importer) run() error {
 	if len(importer.GetInternalSubnets()) == 0 {
 		return cli.NewExitError("Internal subnets are not defined. Please set the InternalSubnets section of the config file.", -1)
 	}
+	importer.SetTraceContext(ctx)
+	if i.appendData {
+		importer.EnableAppend()
+	}
 
-	indexedFiles := importer.CollectFileDetails(i.importFiles, i.threads)
+	// the checkpoints of earlier imports don't apply if their data is being replaced
+	indexedFiles := importer.CollectFileDetails(i.importFiles, i.threads, !i.deleteOldData)
 	// if no compatible files for import were found, exit
 	if len(indexedFiles) == 0 {
 		return cli.NewExitError("No compatible log files found", -1)
@@ -272,7 +398,11 @@ func (i *Importer) run() error {
 		defer pprof.StopCPUProfile()
 	*/
 
-	importer.Run(indexedFiles, i.threads)
+	err = importer.Run(indexedFiles, i.threads)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return cli.NewExitError(fmt.Errorf("\n\t[!] %v", err), -1)
+	}
 
 	i.res.Log.Infof("Finished importing %v\n", i.importFiles)
 
@@ -327,3 +457,14 @@ func (i *Importer) checkForInvalidDBChars(db string) error {
 	}
 	return nil
 }
+
+//validateTimeWindow ensures the time window of the import is not empty. A bound of 0 is open.
+func validateTimeWindow(since int64, until int64) error {
+	if since < 0 || until < 0 {
+		return fmt.Errorf("\t[!] The --since and --until timestamps must be 0 or greater")
+	}
+	if since != 0 && until != 0 && since > until {
+		return fmt.Errorf("\t[!] The --since timestamp [ %d ] must not be after the --until timestamp [ %d ]", since, until)
+	}
+	return nil
+}
@@ -271,3 +271,42 @@ func TestParseFlags(t *testing.T) {
 	}
 
 }
+
+func TestValidateAnalysisChunk(t *testing.T) {
+	assert.NoError(t, validateAnalysisChunk(0, false, 0))
+	assert.NoError(t, validateAnalysisChunk(5, false, 0))
+	assert.NoError(t, validateAnalysisChunk(11, true, 12))
+	assert.Error(t, validateAnalysisChunk(-1, false, 0))
+	assert.Error(t, validateAnalysisChunk(12, true, 12))
+}
+
+func TestValidateTimeWindow(t *testing.T) {
+	assert.NoError(t, validateTimeWindow(0, 0))
+	assert.NoError(t, validateTimeWindow(100, 0))
+	assert.NoError(t, validateTimeWindow(0, 100))
+	assert.NoError(t, validateTimeWindow(100, 100))
+	assert.Error(t, validateTimeWindow(101, 100))
+	assert.Error(t, validateTimeWindow(-1, 0))
+}
+
+func TestAppendRollingCfg(t *testing.T) {
+	// appending to a rolling database keeps its current chunk
+	cfg, err := appendRollingCfg(true, 3, 12, false, -1, -1, 24, false)
+	assert.NoError(t, err)
+	assert.Equal(t, config.RollingStaticCfg{DefaultChunks: 24, Rolling: true, CurrentChunk: 3, TotalChunks: 12}, cfg)
+
+	// a non-rolling database is appended to without converting it
+	cfg, err = appendRollingCfg(false, 0, 0, false, -1, -1, 24, false)
+	assert.NoError(t, err)
+	assert.Equal(t, config.RollingStaticCfg{DefaultChunks: 24, Rolling: false, CurrentChunk: 0, TotalChunks: 1}, cfg)
+
+	// the options which choose or replace a chunk conflict with appending
+	_, err = appendRollingCfg(true, 3, 12, false, -1, -1, 24, true)
+	assert.Error(t, err)
+	_, err = appendRollingCfg(true, 3, 12, true, -1, -1, 24, false)
+	assert.Error(t, err)
+	_, err = appendRollingCfg(true, 3, 12, false, 4, -1, 24, false)
+	assert.Error(t, err)
+	_, err = appendRollingCfg(true, 3, 12, false, -1, 12, 24, false)
+	assert.Error(t, err)
+}
@@ -0,0 +1,129 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/activecm/rita/metrics"
+	"github.com/activecm/rita/parser"
+	"github.com/activecm/rita/resources"
+	"github.com/urfave/cli"
+)
+
+func init() {
+	listenCommand := cli.Command{
+		Name:  "listen",
+		Usage: "Import zeek logs pushed over the network into a target database",
+		UsageText: "rita listen [command options] <database name>\n\n" +
+			"Accepts newline-delimited Zeek JSON logs over TCP (or TLS) and imports them" +
+			" into a database named <database name>. The records received are written to" +
+			" the database every Listener.FlushInterval seconds and when RITA is interrupted.",
+		Flags: []cli.Flag{
+			ConfigFlag,
+			rollingFlag,
+			totalChunksFlag,
+			currentChunkFlag,
+			cli.StringFlag{
+				Name:  "listen, l",
+				Usage: "Listen for log streams on `ADDRESS` instead of Listener.ListenAddress",
+			},
+			cli.StringFlag{
+				Name:  "log-type",
+				Usage: "Expect logs of `TYPE` (e.g. conn, dns, http) instead of Listener.LogType",
+			},
+		},
+		Action: listen,
+	}
+
+	bootstrapCommands(listenCommand)
+}
+
+func listen(c *cli.Context) error {
+	res, importer, err := initStreamImporter(c)
+	if err != nil {
+		return err
+	}
+	if c.String("listen") != "" {
+		res.Config.S.Listener.ListenAddress = c.String("listen")
+	}
+	if c.String("log-type") != "" {
+		res.Config.S.Listener.LogType = c.String("log-type")
+	}
+
+	ctx, cancel := interruptContext()
+	defer cancel()
+
+	targetDatabase := res.DB.GetSelectedDB()
+	res.Log.Infof("Listening for logs to import into %v\n", targetDatabase)
+	err = importer.Listen(ctx)
+	if err != nil {
+		return cli.NewExitError(fmt.Errorf("\n\t[!] %v", err), -1)
+	}
+
+	res.Log.Infof("Finished importing logs into %v\n", targetDatabase)
+	fmt.Println("\t[-] Done!")
+	return nil
+}
+
+//initStreamImporter sets up an importer for the commands which import logs as they
+//are streamed to RITA. Streamed logs are imported into the current chunk of the
+//database named by the only argument like any other import.
+func initStreamImporter(c *cli.Context) (*resources.Resources, *parser.FSImporter, error) {
+	targetDatabase := c.Args().Get(0)
+	if targetDatabase == "" || len(c.Args()) > 1 {
+		return nil, nil, cli.NewExitError("\n\t[!] Exactly one <database name> is required.", -1)
+	}
+	err := (&Importer{}).checkForInvalidDBChars(targetDatabase)
+	if err != nil {
+		return nil, nil, cli.NewExitError(err.Error(), -1)
+	}
+
+	res := resources.InitResources(getConfigFilePath(c))
+
+	// expose the import's progress to Prometheus if requested
+	if res.Config.S.Metrics.Enabled {
+		metrics.Serve(res.Config.S.Metrics.ListenAddress, res.Log)
+	}
+
+	res.DB.SelectDB(targetDatabase)
+
+	exists, isRolling, currChunk, totalChunks, err := res.MetaDB.GetRollingSettings(targetDatabase)
+	if err != nil {
+		return nil, nil, cli.NewExitError(fmt.Errorf("\n\t[!] Error while reading existing database settings: %v", err.Error()), -1)
+	}
+	rollingCfg, err := parseFlags(
+		exists, isRolling, currChunk, totalChunks,
+		c.Bool("rolling"), c.Int("chunk"), c.Int("numchunks"), res.Config.S.Rolling.DefaultChunks,
+		false,
+	)
+	if err != nil {
+		return nil, nil, cli.NewExitError(err.Error(), -1)
+	}
+	res.Config.S.Rolling = rollingCfg
+
+	importer := parser.NewFSImporter(res)
+	if len(importer.GetInternalSubnets()) == 0 {
+		return nil, nil, cli.NewExitError("Internal subnets are not defined. Please set the InternalSubnets section of the config file.", -1)
+	}
+	return res, importer, nil
+}
+
+//interruptContext creates a context which is cancelled when RITA is interrupted so
+//that the logs received so far can be written before exiting
+func interruptContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-signals:
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(signals)
+	}()
+	return ctx, cancel
+}
@@ -0,0 +1,91 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/activecm/rita/pkg/beaconproxy"
+	"github.com/activecm/rita/pkg/remover"
+	"github.com/activecm/rita/resources"
+	"github.com/urfave/cli"
+)
+
+func init() {
+	command := cli.Command{
+		Name:      "prune-chunks",
+		Usage:     "Remove the oldest chunks from a rolling database",
+		ArgsUsage: "<database>",
+		Flags: []cli.Flag{
+			ConfigFlag,
+			cli.IntFlag{
+				Name:  "keep, k",
+				Usage: "Keep the `N` most recently imported chunks, including the current chunk",
+			},
+		},
+		Action: pruneChunks,
+	}
+
+	bootstrapCommands(command)
+}
+
+func pruneChunks(c *cli.Context) error {
+	db := c.Args().Get(0)
+	if db == "" {
+		return cli.NewExitError("Specify a database", -1)
+	}
+	keep := c.Int("keep")
+	if keep < 1 {
+		return cli.NewExitError("Specify how many chunks to keep with --keep", -1)
+	}
+
+	res := resources.InitResources(c.String("config"))
+
+	exists, isRolling, currentChunk, totalChunks, err := res.MetaDB.GetRollingSettings(db)
+	if err != nil {
+		return cli.NewExitError(err.Error(), -1)
+	}
+	if !exists {
+		return cli.NewExitError("Database "+db+" does not exist", -1)
+	}
+	if !isRolling {
+		return cli.NewExitError("Database "+db+" is not a rolling database", -1)
+	}
+
+	res.DB.SelectDB(db)
+	removerRepo := remover.NewMongoRemover(res.DB, res.Config, res.Log)
+
+	pruned := 0
+	for _, cid := range remover.ExpiredChunks(currentChunk, totalChunks, keep) {
+		// skip chunks which were never imported or were already pruned
+		chunkSet, err := res.MetaDB.IsChunkSet(cid, db)
+		if err != nil {
+			return cli.NewExitError(err.Error(), -1)
+		}
+		if !chunkSet {
+			continue
+		}
+
+		if err := removerRepo.Remove(cid); err != nil {
+			res.Log.Error(err)
+			return cli.NewExitError(err.Error(), -1)
+		}
+		if err := res.MetaDB.SetChunk(cid, db, false); err != nil {
+			return cli.NewExitError(err.Error(), -1)
+		}
+		pruned++
+	}
+
+	if pruned == 0 {
+		fmt.Printf("\t[-] No chunks of %s are older than the newest %d\n", db, keep)
+		return nil
+	}
+
+	// the removed chunks may have held the max proxy beacon of hosts
+	// which still have proxy beacons in the retained chunks
+	if _, err := beaconproxy.RecomputeHostMaxScores(res.DB, res.Config); err != nil {
+		res.Log.Error(err)
+		return cli.NewExitError(err.Error(), -1)
+	}
+
+	fmt.Printf("\t[+] Pruned %d chunks from %s\n", pruned, db)
+	return nil
+}
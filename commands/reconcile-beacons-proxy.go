@@ -0,0 +1,41 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/activecm/rita/pkg/beaconproxy"
+	"github.com/activecm/rita/resources"
+	"github.com/urfave/cli"
+)
+
+func init() {
+	command := cli.Command{
+		Name:      "reconcile-beacons-proxy",
+		Usage:     "Recompute the max proxy beacon of each host after proxy beacons are deleted by hand",
+		ArgsUsage: "<database>",
+		Flags: []cli.Flag{
+			ConfigFlag,
+		},
+		Action: reconcileBeaconsProxy,
+	}
+
+	bootstrapCommands(command)
+}
+
+func reconcileBeaconsProxy(c *cli.Context) error {
+	db := c.Args().Get(0)
+	if db == "" {
+		return cli.NewExitError("Specify a database", -1)
+	}
+	res := resources.InitResources(c.String("config"))
+	res.DB.SelectDB(db)
+
+	count, err := beaconproxy.RecomputeHostMaxScores(res.DB, res.Config)
+	if err != nil {
+		res.Log.Error(err)
+		return cli.NewExitError(err.Error(), -1)
+	}
+
+	fmt.Printf("\t[+] Recomputed the max proxy beacons of %d hosts in %s\n", count, db)
+	return nil
+}
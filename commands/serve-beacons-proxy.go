@@ -0,0 +1,62 @@
+// +build grpc
+
+package commands
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/activecm/rita/pkg/beaconproxy/rpc"
+	"github.com/activecm/rita/resources"
+	"github.com/urfave/cli"
+	"google.golang.org/grpc"
+)
+
+//The gRPC server is only built into RITA with `go build -tags=grpc`
+func init() {
+	command := cli.Command{
+		Name:  "serve-beacons-proxy",
+		Usage: "Serve proxy beacon results over gRPC",
+		Flags: []cli.Flag{
+			ConfigFlag,
+			cli.StringFlag{
+				Name:  "listen, l",
+				Usage: "Listen for gRPC connections on `ADDRESS`",
+				Value: "localhost:50051",
+			},
+		},
+		Action: serveBeaconsProxy,
+	}
+
+	bootstrapCommands(command)
+}
+
+func serveBeaconsProxy(c *cli.Context) error {
+	res := resources.InitResources(c.String("config"))
+
+	listener, err := net.Listen("tcp", c.String("listen"))
+	if err != nil {
+		return cli.NewExitError(err.Error(), -1)
+	}
+
+	server := grpc.NewServer()
+	rpc.RegisterBeaconProxyServiceServer(server, rpc.NewServer(res))
+
+	// finish the streams in progress when interrupted
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		server.GracefulStop()
+	}()
+
+	fmt.Printf("\t[+] Serving proxy beacons on %s\n", listener.Addr())
+	if err := server.Serve(listener); err != nil {
+		res.Log.Error(err)
+		return cli.NewExitError(err.Error(), -1)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/activecm/rita/config"
+	"github.com/activecm/rita/parser/files"
+	"github.com/olekukonko/tablewriter"
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+func init() {
+	command := cli.Command{
+		Name:      "validate",
+		Usage:     "Check the headers of log files before importing them",
+		ArgsUsage: "<files/directory>...",
+		Flags:     []cli.Flag{ConfigFlag},
+		Before:    SetConfigFilePath,
+		Action:    validateLogs,
+	}
+
+	allCommands = append(allCommands, command)
+}
+
+//validateLogs reports how the header of each log file which would be imported from the
+//given paths is read. The bodies of the files are not parsed, and MongoDB is not needed.
+func validateLogs(c *cli.Context) error {
+	paths := c.Args()
+	if len(paths) == 0 {
+		return cli.NewExitError("Specify the log files or directories to validate", -1)
+	}
+
+	conf, err := config.LoadConfig(getConfigFilePath(c))
+	if err != nil {
+		return cli.NewExitError(fmt.Sprintf("Failed to load config: %s", err.Error()), -1)
+	}
+
+	logger := log.New()
+	logger.Level = log.WarnLevel
+
+	results := files.ValidateLogFiles(paths, conf, logger)
+	if len(results) == 0 {
+		return cli.NewExitError("No log files were found", -1)
+	}
+
+	problems := showFileValidations(results)
+	if problems > 0 {
+		return cli.NewExitError(fmt.Sprintf("%d of %d log files have problems", problems, len(results)), -1)
+	}
+	return nil
+}
+
+//showFileValidations prints a table of the validated files and returns the number of
+//files which have problems
+func showFileValidations(results []files.FileValidation) int {
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"File", "Log Type", "Format", "Fields", "Problems"})
+
+	problems := 0
+	for _, result := range results {
+		var messages []string
+		if result.Err != nil {
+			messages = append(messages, result.Err.Error())
+		}
+		messages = append(messages, result.Warnings...)
+		if len(messages) > 0 {
+			problems++
+		}
+
+		table.Append([]string{
+			result.Path, result.LogType, result.Format,
+			strconv.Itoa(result.FieldCount), strings.Join(messages, "\n"),
+		})
+	}
+
+	table.Render()
+	return problems
+}
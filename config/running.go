@@ -1,31 +1,52 @@
 package config
 
 import (
+	"bytes"
 	"crypto/tls"
 	"crypto/x509"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"strings"
+	"time"
 
 	"github.com/activecm/mgosec"
+	"github.com/activecm/rita/util"
 	"github.com/blang/semver"
+	"github.com/google/uuid"
 )
 
 type (
 	//RunningCfg holds configuration options that are parsed at run time
 	RunningCfg struct {
 		MongoDB MongoDBRunningCfg
+		Parsing ParsingRunningCfg
 		Version semver.Version
 	}
 
+	//ParsingRunningCfg holds parsed information for reading log files
+	ParsingRunningCfg struct {
+		// FilenameLocation is the time zone the times in the names of log files are read in
+		FilenameLocation *time.Location
+	}
+
 	//MongoDBRunningCfg holds parsed information for connecting to MongoDB
 	MongoDBRunningCfg struct {
 		AuthMechanismParsed mgosec.AuthMechanism
-		TLS                 struct {
+		// X509Auth is set if RITA should authenticate with its TLS client certificate
+		X509Auth bool
+		TLS      struct {
 			TLSConfig *tls.Config
+			// ClientCertificate is the parsed TLS client certificate, if one is configured
+			ClientCertificate *x509.Certificate
 		}
 	}
 )
 
+// x509AuthMechanism is the MongoDB authentication mechanism which uses the TLS
+// client certificate. It is handled by RITA since mgosec does not support it.
+const x509AuthMechanism = "MONGODB-X509"
+
 // initRunningConfig uses data in the static config initialize
 // the passed in running config
 func initRunningConfig(static *StaticCfg, running *RunningCfg) error {
@@ -33,32 +54,72 @@ func initRunningConfig(static *StaticCfg, running *RunningCfg) error {
 
 	//parse the tls configuration
 	if static.MongoDB.TLS.Enabled {
-		tlsConf := &tls.Config{}
-		if !static.MongoDB.TLS.VerifyCertificate {
-			tlsConf.InsecureSkipVerify = true
+		tlsConf, err := buildTLSConfig(static.MongoDB.TLS)
+		if err != nil {
+			fmt.Println("[!] Could not configure TLS for MongoDB")
+			return err
 		}
-		if len(static.MongoDB.TLS.CAFile) > 0 {
-			pem, err2 := ioutil.ReadFile(static.MongoDB.TLS.CAFile)
-			err = err2
+		running.MongoDB.TLS.TLSConfig = tlsConf
+
+		if len(tlsConf.Certificates) > 0 {
+			running.MongoDB.TLS.ClientCertificate, err = x509.ParseCertificate(tlsConf.Certificates[0].Certificate[0])
 			if err != nil {
-				fmt.Println("[!] Could not read MongoDB CA file")
-			} else {
-				tlsConf.RootCAs = x509.NewCertPool()
-				tlsConf.RootCAs.AppendCertsFromPEM(pem)
+				fmt.Println("[!] Could not parse MongoDB client certificate")
+				return err
 			}
 		}
-		running.MongoDB.TLS.TLSConfig = tlsConf
 	}
 
-	//parse out the mongo authentication mechanism
-	authMechanism, err := mgosec.ParseAuthMechanism(
-		static.MongoDB.AuthMechanism,
-	)
+	// x509 authentication relies on the TLS client certificate
+	if strings.ToUpper(strings.TrimSpace(static.MongoDB.AuthMechanism)) == x509AuthMechanism {
+		if running.MongoDB.TLS.ClientCertificate == nil {
+			fmt.Println("[!] MongoDB x509 authentication requires TLS with a client certificate")
+			return errors.New("x509 authentication requires TLS to be enabled with a client certificate and key")
+		}
+		running.MongoDB.X509Auth = true
+		running.MongoDB.AuthMechanismParsed = mgosec.None
+	} else {
+		//parse out the mongo authentication mechanism
+		authMechanism, err := mgosec.ParseAuthMechanism(
+			static.MongoDB.AuthMechanism,
+		)
+		if err != nil {
+			authMechanism = mgosec.None
+			fmt.Println("[!] Could not parse MongoDB authentication mechanism")
+		}
+		running.MongoDB.AuthMechanismParsed = authMechanism
+	}
+
+	if err := validateSkewQuantiles(static.BeaconProxy.SkewQuantiles); err != nil {
+		fmt.Println("[!] Invalid BeaconProxy SkewQuantiles")
+		return err
+	}
+
+	if err := validateScoreRounding(static.BeaconProxy.ScoreRounding, static.BeaconProxy.ScorePrecision); err != nil {
+		fmt.Println("[!] Invalid BeaconProxy ScoreRounding")
+		return err
+	}
+
+	if err := validateScoreBands(static.ScoreBands); err != nil {
+		fmt.Println("[!] Invalid ScoreBands")
+		return err
+	}
+
+	if static.Parsing.AppendOverlap < 0 {
+		fmt.Println("[!] Invalid Parsing AppendOverlap")
+		return fmt.Errorf("the append overlap (%d) must be 0 or greater", static.Parsing.AppendOverlap)
+	}
+
+	if err := validateDefaultNetwork(static.Parsing.DefaultNetwork); err != nil {
+		fmt.Println("[!] Invalid Parsing DefaultNetwork")
+		return err
+	}
+
+	running.Parsing.FilenameLocation, err = parseFilenameTimeRange(static.Parsing.FilenameTimeRange)
 	if err != nil {
-		authMechanism = mgosec.None
-		fmt.Println("[!] Could not parse MongoDB authentication mechanism")
+		fmt.Println("[!] Invalid Parsing FilenameTimeRange")
+		return err
 	}
-	running.MongoDB.AuthMechanismParsed = authMechanism
 
 	running.Version, err = semver.ParseTolerant(static.Version)
 	if err != nil {
@@ -69,3 +130,108 @@ func initRunningConfig(static *StaticCfg, running *RunningCfg) error {
 	}
 	return err
 }
+
+// validateSkewQuantiles ensures the quantiles compared by the Bowley skew fall on either
+// side of the median. Leaving both unset compares the quartiles.
+func validateSkewQuantiles(cfg SkewQuantilesStaticCfg) error {
+	if cfg.Lower == 0 && cfg.Upper == 0 {
+		return nil
+	}
+	if !(0 < cfg.Lower && cfg.Lower < 0.5 && 0.5 < cfg.Upper && cfg.Upper < 1) {
+		return fmt.Errorf("skew quantiles must satisfy 0 < lower (%v) < 0.5 < upper (%v) < 1", cfg.Lower, cfg.Upper)
+	}
+	return nil
+}
+
+// validateScoreRounding ensures the scores are either rounded up or to the nearest value,
+// and to a number of decimal places a float64 can hold
+func validateScoreRounding(rounding string, precision int) error {
+	if rounding != "ceil" && rounding != "round" {
+		return fmt.Errorf("the score rounding (%q) must be either \"ceil\" or \"round\"", rounding)
+	}
+	if precision < 1 || precision > 15 {
+		return fmt.Errorf("the score precision (%d) must be between 1 and 15", precision)
+	}
+	return nil
+}
+
+// validateScoreBands ensures the score bands rise from low to critical
+func validateScoreBands(cfg ScoreBandsStaticCfg) error {
+	if !(0 < cfg.Medium && cfg.Medium < cfg.High && cfg.High < cfg.Critical && cfg.Critical <= 1) {
+		return fmt.Errorf("score bands must satisfy 0 < medium (%v) < high (%v) < critical (%v) <= 1",
+			cfg.Medium, cfg.High, cfg.Critical)
+	}
+	return nil
+}
+
+// validateDefaultNetwork ensures the default network has both a name and a UUID which
+// doesn't belong to one of the networks RITA reserves. Leaving both unset is allowed.
+func validateDefaultNetwork(cfg DefaultNetworkStaticCfg) error {
+	if cfg.Name == "" && cfg.UUID == "" {
+		return nil
+	}
+	if cfg.Name == "" || cfg.UUID == "" {
+		return errors.New("the default network requires both a name and a UUID")
+	}
+
+	id, err := uuid.Parse(cfg.UUID)
+	if err != nil {
+		return fmt.Errorf("the default network UUID %s is invalid: %v", cfg.UUID, err)
+	}
+	if bytes.Equal(id[:], util.PublicNetworkUUID.Data) || bytes.Equal(id[:], util.UnknownPrivateNetworkUUID.Data) {
+		return fmt.Errorf("the default network UUID %s is reserved", cfg.UUID)
+	}
+	if cfg.Name == util.PublicNetworkName || cfg.Name == util.UnknownPrivateNetworkName {
+		return fmt.Errorf("the default network name %s is reserved", cfg.Name)
+	}
+	return nil
+}
+
+// parseFilenameTimeRange loads the time zone the times in the names of log files are read
+// in and ensures the slack is not negative
+func parseFilenameTimeRange(cfg FilenameTimeRangeStaticCfg) (*time.Location, error) {
+	if cfg.Slack < 0 {
+		return nil, fmt.Errorf("the filename time range slack (%d) must be 0 or greater", cfg.Slack)
+	}
+	loc, err := time.LoadLocation(cfg.TimeZone)
+	if err != nil {
+		return nil, fmt.Errorf("the filename time zone %s is invalid: %v", cfg.TimeZone, err)
+	}
+	return loc, nil
+}
+
+// buildTLSConfig creates the TLS configuration used to connect to MongoDB. An error
+// is returned if any of the configured CA, client certificate, or key files can't
+// be read.
+func buildTLSConfig(cfg TLSStaticCfg) (*tls.Config, error) {
+	tlsConf := &tls.Config{}
+	if !cfg.VerifyCertificate {
+		tlsConf.InsecureSkipVerify = true
+	}
+
+	if len(cfg.CAFile) > 0 {
+		pem, err := ioutil.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read MongoDB CA file: %v", err)
+		}
+		tlsConf.RootCAs = x509.NewCertPool()
+		if !tlsConf.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in MongoDB CA file %s", cfg.CAFile)
+		}
+	}
+
+	// the client certificate and key must be given together
+	if len(cfg.ClientCertFile) > 0 || len(cfg.ClientKeyFile) > 0 {
+		if len(cfg.ClientCertFile) == 0 || len(cfg.ClientKeyFile) == 0 {
+			return nil, errors.New("both a MongoDB client certificate and key file must be set")
+		}
+
+		cert, err := tls.LoadX509KeyPair(cfg.ClientCertFile, cfg.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not load MongoDB client certificate: %v", err)
+		}
+		tlsConf.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConf, nil
+}
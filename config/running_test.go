@@ -0,0 +1,231 @@
+package config
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestCertificate writes a self signed certificate and its key to dir
+// and returns their paths
+func writeTestCertificate(t *testing.T, dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "rita", Organization: []string{"RITA"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.Nil(t, err)
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.Nil(t, err)
+
+	certPath := filepath.Join(dir, "client.crt")
+	keyPath := filepath.Join(dir, "client.key")
+	require.Nil(t, ioutil.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.Nil(t, ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+	return certPath, keyPath
+}
+
+func TestBuildTLSConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rita-tls")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	certPath, keyPath := writeTestCertificate(t, dir)
+
+	// the self signed certificate doubles as the CA
+	tlsConf, err := buildTLSConfig(TLSStaticCfg{
+		Enabled:           true,
+		VerifyCertificate: true,
+		CAFile:            certPath,
+		ClientCertFile:    certPath,
+		ClientKeyFile:     keyPath,
+	})
+	require.Nil(t, err)
+	require.False(t, tlsConf.InsecureSkipVerify)
+	require.NotNil(t, tlsConf.RootCAs)
+	require.Len(t, tlsConf.Certificates, 1)
+
+	// skip verification unless requested
+	tlsConf, err = buildTLSConfig(TLSStaticCfg{Enabled: true})
+	require.Nil(t, err)
+	require.True(t, tlsConf.InsecureSkipVerify)
+	require.Nil(t, tlsConf.RootCAs)
+	require.Empty(t, tlsConf.Certificates)
+
+	// unreadable files fail clearly
+	_, err = buildTLSConfig(TLSStaticCfg{CAFile: filepath.Join(dir, "missing.crt")})
+	require.Error(t, err)
+	_, err = buildTLSConfig(TLSStaticCfg{ClientCertFile: certPath, ClientKeyFile: filepath.Join(dir, "missing.key")})
+	require.Error(t, err)
+
+	// the certificate and key must be given together
+	_, err = buildTLSConfig(TLSStaticCfg{ClientCertFile: certPath})
+	require.Error(t, err)
+
+	// a CA file without certificates is rejected
+	_, err = buildTLSConfig(TLSStaticCfg{CAFile: keyPath})
+	require.Error(t, err)
+}
+
+func TestValidateSkewQuantiles(t *testing.T) {
+	require.Nil(t, validateSkewQuantiles(SkewQuantilesStaticCfg{Lower: .25, Upper: .75}))
+	require.Nil(t, validateSkewQuantiles(SkewQuantilesStaticCfg{Lower: .1, Upper: .9}))
+	// the quartiles are used if neither quantile is set
+	require.Nil(t, validateSkewQuantiles(SkewQuantilesStaticCfg{}))
+
+	for _, cfg := range []SkewQuantilesStaticCfg{
+		{Lower: .75, Upper: .25},
+		{Lower: .5, Upper: .9},
+		{Lower: .1, Upper: .5},
+		{Lower: 0, Upper: .9},
+		{Lower: .1, Upper: 1},
+		{Lower: -.1, Upper: .9},
+	} {
+		require.Error(t, validateSkewQuantiles(cfg), "%+v", cfg)
+	}
+
+	static := &StaticCfg{Version: "v0.0.0"}
+	static.BeaconProxy.SkewQuantiles = SkewQuantilesStaticCfg{Lower: .9, Upper: .1}
+	require.Error(t, initRunningConfig(static, &RunningCfg{}))
+}
+
+func TestValidateDefaultNetwork(t *testing.T) {
+	require.Nil(t, validateDefaultNetwork(DefaultNetworkStaticCfg{}))
+	require.Nil(t, validateDefaultNetwork(DefaultNetworkStaticCfg{
+		Name: "Office", UUID: "0b7f3f4c-2a3e-4c51-9a47-8d9e1c2b3a4d",
+	}))
+
+	for _, cfg := range []DefaultNetworkStaticCfg{
+		{Name: "Office"},
+		{UUID: "0b7f3f4c-2a3e-4c51-9a47-8d9e1c2b3a4d"},
+		{Name: "Office", UUID: "not a uuid"},
+		// the networks RITA binds addresses to on its own
+		{Name: "Office", UUID: "ffffffff-ffff-ffff-ffff-ffffffffffff"},
+		{Name: "Office", UUID: "ffffffff-ffff-ffff-ffff-fffffffffffe"},
+		{Name: "Public", UUID: "0b7f3f4c-2a3e-4c51-9a47-8d9e1c2b3a4d"},
+	} {
+		require.Error(t, validateDefaultNetwork(cfg), "%+v", cfg)
+	}
+
+	static := newTestStaticCfg()
+	static.Parsing.DefaultNetwork = DefaultNetworkStaticCfg{Name: "Office"}
+	require.Error(t, initRunningConfig(static, &RunningCfg{}))
+}
+
+//testScoreBands are the default score bands
+var testScoreBands = ScoreBandsStaticCfg{Medium: .5, High: .7, Critical: .9}
+
+//newTestStaticCfg creates a static config which passes validation
+func newTestStaticCfg() *StaticCfg {
+	static := &StaticCfg{Version: "v0.0.0", ScoreBands: testScoreBands}
+	static.BeaconProxy.ScoreRounding = "ceil"
+	static.BeaconProxy.ScorePrecision = 3
+	return static
+}
+
+func TestValidateScoreBands(t *testing.T) {
+	require.Nil(t, validateScoreBands(testScoreBands))
+	require.Nil(t, validateScoreBands(ScoreBandsStaticCfg{Medium: .1, High: .2, Critical: 1}))
+
+	for _, cfg := range []ScoreBandsStaticCfg{
+		{},
+		{Medium: .7, High: .5, Critical: .9},
+		{Medium: .5, High: .9, Critical: .9},
+		{Medium: 0, High: .7, Critical: .9},
+		{Medium: .5, High: .7, Critical: 1.1},
+	} {
+		require.Error(t, validateScoreBands(cfg), "%+v", cfg)
+	}
+
+	static := &StaticCfg{Version: "v0.0.0"}
+	static.ScoreBands = ScoreBandsStaticCfg{Medium: .9, High: .7, Critical: .5}
+	require.Error(t, initRunningConfig(static, &RunningCfg{}))
+}
+
+func TestValidateScoreRounding(t *testing.T) {
+	require.Nil(t, validateScoreRounding("ceil", 3))
+	require.Nil(t, validateScoreRounding("round", 1))
+	require.Nil(t, validateScoreRounding("round", 15))
+
+	for _, rounding := range []string{"", "Round", "nearest", "floor"} {
+		require.Error(t, validateScoreRounding(rounding, 3), rounding)
+	}
+	for _, precision := range []int{-1, 0, 16} {
+		require.Error(t, validateScoreRounding("ceil", precision), "%d", precision)
+	}
+
+	static := newTestStaticCfg()
+	static.BeaconProxy.ScoreRounding = "Round"
+	require.Error(t, initRunningConfig(static, &RunningCfg{}))
+}
+
+func TestInitRunningConfigAppendOverlap(t *testing.T) {
+	static := newTestStaticCfg()
+	require.Nil(t, initRunningConfig(static, &RunningCfg{}))
+
+	static.Parsing.AppendOverlap = -1
+	require.Error(t, initRunningConfig(static, &RunningCfg{}))
+}
+
+func TestInitRunningConfigFilenameTimeRange(t *testing.T) {
+	static := newTestStaticCfg()
+	static.Parsing.FilenameTimeRange = FilenameTimeRangeStaticCfg{TimeZone: "America/New_York", Slack: 60}
+	running := &RunningCfg{}
+	require.Nil(t, initRunningConfig(static, running))
+	require.Equal(t, "America/New_York", running.Parsing.FilenameLocation.String())
+
+	// an unset time zone is UTC
+	static.Parsing.FilenameTimeRange.TimeZone = ""
+	require.Nil(t, initRunningConfig(static, running))
+	require.Equal(t, time.UTC, running.Parsing.FilenameLocation)
+
+	static.Parsing.FilenameTimeRange.TimeZone = "Nowhere/Special"
+	require.Error(t, initRunningConfig(static, &RunningCfg{}))
+
+	static.Parsing.FilenameTimeRange = FilenameTimeRangeStaticCfg{TimeZone: "UTC", Slack: -1}
+	require.Error(t, initRunningConfig(static, &RunningCfg{}))
+}
+
+func TestInitRunningConfigX509(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rita-tls")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	certPath, keyPath := writeTestCertificate(t, dir)
+
+	static := newTestStaticCfg()
+	static.MongoDB.AuthMechanism = "MONGODB-X509"
+
+	// x509 authentication requires a client certificate
+	err = initRunningConfig(static, &RunningCfg{})
+	require.Error(t, err)
+
+	static.MongoDB.TLS = TLSStaticCfg{Enabled: true, ClientCertFile: certPath, ClientKeyFile: keyPath}
+	running := &RunningCfg{}
+	err = initRunningConfig(static, running)
+	require.Nil(t, err)
+	require.True(t, running.MongoDB.X509Auth)
+	require.NotNil(t, running.MongoDB.TLS.TLSConfig)
+	require.Equal(t, "rita", running.MongoDB.TLS.ClientCertificate.Subject.CommonName)
+}
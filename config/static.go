@@ -21,22 +21,37 @@ type (
 		Beacon       BeaconStaticCfg      `yaml:"Beacon"`
 		BeaconFQDN   BeaconFQDNStaticCfg  `yaml:"BeaconFQDN"`
 		BeaconProxy  BeaconProxyStaticCfg `yaml:"BeaconProxy"`
+		ScoreBands   ScoreBandsStaticCfg  `yaml:"ScoreBands"`
 		DNS          DNSStaticCfg         `yaml:"DNS"`
 		UserAgent    UserAgentStaticCfg   `yaml:"UserAgent"`
 		Bro          BroStaticCfg         `yaml:"Bro"` // kept in for MetaDB backwards compatibility
 		Filtering    FilteringStaticCfg   `yaml:"Filtering"`
+		Parsing      ParsingStaticCfg     `yaml:"Parsing"`
 		Strobe       StrobeStaticCfg      `yaml:"Strobe"`
+		Metrics      MetricsStaticCfg     `yaml:"Metrics"`
+		Listener     ListenerStaticCfg    `yaml:"Listener"`
+		Kafka        KafkaStaticCfg       `yaml:"Kafka"`
+		Tracing      TracingStaticCfg     `yaml:"Tracing"`
 		Version      string
 		ExactVersion string
 	}
 
 	//MongoDBStaticCfg contains the means for connecting to MongoDB
 	MongoDBStaticCfg struct {
-		ConnectionString string        `yaml:"ConnectionString" default:"mongodb://localhost:27017"`
-		AuthMechanism    string        `yaml:"AuthenticationMechanism" default:""`
-		SocketTimeout    time.Duration `yaml:"SocketTimeout" default:"2"`
-		TLS              TLSStaticCfg  `yaml:"TLS"`
-		MetaDB           string        `yaml:"MetaDB" default:"MetaDatabase"`
+		ConnectionString string                `yaml:"ConnectionString" default:"mongodb://localhost:27017"`
+		AuthMechanism    string                `yaml:"AuthenticationMechanism" default:""`
+		SocketTimeout    time.Duration         `yaml:"SocketTimeout" default:"2"`
+		TLS              TLSStaticCfg          `yaml:"TLS"`
+		MetaDB           string                `yaml:"MetaDB" default:"MetaDatabase"`
+		WriteConcern     WriteConcernStaticCfg `yaml:"WriteConcern"`
+		ReadPreference   string                `yaml:"ReadPreference" default:"primary"`
+	}
+
+	//WriteConcernStaticCfg controls the acknowledgement requested from MongoDB for writes
+	WriteConcernStaticCfg struct {
+		W        string `yaml:"W" default:""`
+		J        bool   `yaml:"J" default:"false"`
+		WTimeout int    `yaml:"WTimeout" default:"0"`
 	}
 
 	//TLSStaticCfg contains the means for connecting to MongoDB over TLS
@@ -44,6 +59,37 @@ type (
 		Enabled           bool   `yaml:"Enable" default:"false"`
 		VerifyCertificate bool   `yaml:"VerifyCertificate" default:"false"`
 		CAFile            string `yaml:"CAFile" default:""`
+		ClientCertFile    string `yaml:"ClientCertFile" default:""`
+		ClientKeyFile     string `yaml:"ClientKeyFile" default:""`
+	}
+
+	//MetricsStaticCfg controls the Prometheus metrics endpoint
+	MetricsStaticCfg struct {
+		Enabled       bool   `yaml:"Enabled" default:"false"`
+		ListenAddress string `yaml:"ListenAddress" default:"localhost:2112"`
+	}
+
+	//TracingStaticCfg controls exporting OpenTelemetry trace spans
+	TracingStaticCfg struct {
+		Enabled  bool   `yaml:"Enabled" default:"false"`
+		Endpoint string `yaml:"Endpoint" default:"http://localhost:4318/v1/traces"`
+	}
+
+	//ListenerStaticCfg controls the listener which accepts Zeek JSON logs pushed over TCP
+	ListenerStaticCfg struct {
+		ListenAddress string `yaml:"ListenAddress" default:"localhost:5140"`
+		LogType       string `yaml:"LogType" default:"conn"`
+		FlushInterval int    `yaml:"FlushInterval" default:"300"`
+		CertFile      string `yaml:"CertFile" default:""`
+		KeyFile       string `yaml:"KeyFile" default:""`
+	}
+
+	//KafkaStaticCfg controls the consumer which imports Zeek JSON logs from Kafka topics
+	KafkaStaticCfg struct {
+		Brokers       []string          `yaml:"Brokers" default:"[]"`
+		GroupID       string            `yaml:"GroupID" default:"rita"`
+		Topics        map[string]string `yaml:"Topics"`
+		FlushInterval int               `yaml:"FlushInterval" default:"300"`
 	}
 
 	//LogStaticCfg contains the configuration for logging
@@ -84,20 +130,130 @@ type (
 
 	//BeaconStaticCfg is used to control the beaconing analysis module
 	BeaconStaticCfg struct {
-		Enabled                 bool `yaml:"Enabled" default:"true"`
-		DefaultConnectionThresh int  `yaml:"DefaultConnectionThresh" default:"20"`
+		Enabled                 bool     `yaml:"Enabled" default:"true"`
+		DefaultConnectionThresh int      `yaml:"DefaultConnectionThresh" default:"20"`
+		HostQueryHint           []string `yaml:"HostQueryHint" default:"[]"`
+		ExplainHostQueries      bool     `yaml:"ExplainHostQueries" default:"false"`
+		HostQueryMaxAttempts    int      `yaml:"HostQueryMaxAttempts" default:"3"`
+		RequiredHistory         string   `yaml:"RequiredHistory" default:""`
+		ExcludedHistory         string   `yaml:"ExcludedHistory" default:""`
 	}
 
 	//BeaconFQDNStaticCfg is used to control the fqdn beaconing analysis module
 	BeaconFQDNStaticCfg struct {
 		Enabled                 bool `yaml:"Enabled" default:"true"`
 		DefaultConnectionThresh int  `yaml:"DefaultConnectionThresh" default:"20"`
+		HostQueryMaxAttempts    int  `yaml:"HostQueryMaxAttempts" default:"3"`
 	}
 
 	//BeaconProxyStaticCfg is used to control the proxy beaconing analysis module
 	BeaconProxyStaticCfg struct {
-		Enabled                 bool `yaml:"Enabled" default:"true"`
-		DefaultConnectionThresh int  `yaml:"DefaultConnectionThresh" default:"20"`
+		Enabled                 bool                        `yaml:"Enabled" default:"true"`
+		DefaultConnectionThresh int                         `yaml:"DefaultConnectionThresh" default:"20"`
+		AnalysisThreads         int                         `yaml:"AnalysisThreads" default:"0"`
+		AutocorrelationEnabled  bool                        `yaml:"AutocorrelationEnabled" default:"false"`
+		DriftEnabled            bool                        `yaml:"DriftEnabled" default:"false"`
+		TimestampPrecision      string                      `yaml:"TimestampPrecision" default:"s"`
+		DurationEnabled         bool                        `yaml:"DurationEnabled" default:"false"`
+		BytesEnabled            bool                        `yaml:"BytesEnabled" default:"false"`
+		WriteBatchSize          int                         `yaml:"WriteBatchSize" default:"1000"`
+		HostQueryMaxAttempts    int                         `yaml:"HostQueryMaxAttempts" default:"3"`
+		DryRun                  bool                        `yaml:"DryRun" default:"false"`
+		SubnetAggregation       SubnetAggregationStaticCfg  `yaml:"SubnetAggregation"`
+		STIXMinScore            float64                     `yaml:"STIXMinScore" default:"0.8"`
+		MISP                    BeaconProxyMISPStaticCfg    `yaml:"MISP"`
+		Webhook                 BeaconProxyWebhookStaticCfg `yaml:"Webhook"`
+		OpenC2                  BeaconProxyOpenC2StaticCfg  `yaml:"OpenC2"`
+		Elasticsearch           ElasticsearchStaticCfg      `yaml:"Elasticsearch"`
+		Summary                 BeaconProxySummaryStaticCfg `yaml:"Summary"`
+		Target                  BeaconProxyTargetStaticCfg  `yaml:"Target"`
+		FQDNAllowlist           []string                    `yaml:"FQDNAllowlist" default:"[]"`
+		SpillThreshold          int                         `yaml:"SpillThreshold" default:"0"`
+		SpillDir                string                      `yaml:"SpillDir" default:""`
+		StrobeRate              float64                     `yaml:"StrobeRate" default:"0"`
+		MinDistinctIntervals    int                         `yaml:"MinDistinctIntervals" default:"0"`
+		ScoreRounding           string                      `yaml:"ScoreRounding" default:"ceil"`
+		ScorePrecision          int                         `yaml:"ScorePrecision" default:"3"`
+		TsListLimit             int                         `yaml:"TsListLimit" default:"0"`
+		SkewQuantiles           SkewQuantilesStaticCfg      `yaml:"SkewQuantiles"`
+		ProxyDetection          ProxyDetectionStaticCfg     `yaml:"ProxyDetection"`
+	}
+
+	//ProxyDetectionStaticCfg controls which HTTP log fields identify proxied requests and
+	//the FQDNs they were proxied to
+	ProxyDetectionStaticCfg struct {
+		Indicator string `yaml:"Indicator" default:"method"`
+		FQDNField string `yaml:"FQDNField" default:"host"`
+	}
+
+	//SkewQuantilesStaticCfg sets the quantiles compared around the median by the Bowley skew
+	SkewQuantilesStaticCfg struct {
+		Lower float64 `yaml:"Lower" default:"0.25"`
+		Upper float64 `yaml:"Upper" default:"0.75"`
+	}
+
+	//SubnetAggregationStaticCfg controls the aggregation of hosts into subnets
+	SubnetAggregationStaticCfg struct {
+		Enabled          bool `yaml:"Enabled" default:"false"`
+		IPv4PrefixLength int  `yaml:"IPv4PrefixLength" default:"24"`
+		IPv6PrefixLength int  `yaml:"IPv6PrefixLength" default:"64"`
+	}
+
+	//BeaconProxySummaryStaticCfg controls the table of top proxy beacons printed after the analysis
+	BeaconProxySummaryStaticCfg struct {
+		TopN     int     `yaml:"TopN" default:"10"`
+		MinScore float64 `yaml:"MinScore" default:"0.5"`
+	}
+
+	//BeaconProxyTargetStaticCfg limits the analysis to the proxy beacons from a source and/or to an FQDN
+	BeaconProxyTargetStaticCfg struct {
+		Src  string `yaml:"Src" default:""`
+		FQDN string `yaml:"FQDN" default:""`
+	}
+
+	//BeaconProxyMISPStaticCfg controls the MISP events proxy beacons are exported as
+	BeaconProxyMISPStaticCfg struct {
+		MinScore     float64                   `yaml:"MinScore" default:"0.8"`
+		Info         string                    `yaml:"Info" default:"RITA proxy beacons"`
+		ThreatLevels MISPThreatLevelsStaticCfg `yaml:"ThreatLevels"`
+	}
+
+	//MISPThreatLevelsStaticCfg sets the lowest score of each MISP threat level
+	MISPThreatLevelsStaticCfg struct {
+		High   float64 `yaml:"High" default:"0.95"`
+		Medium float64 `yaml:"Medium" default:"0.85"`
+		Low    float64 `yaml:"Low" default:"0.7"`
+	}
+
+	//BeaconProxyWebhookStaticCfg controls the webhook notified of high scoring proxy beacons
+	BeaconProxyWebhookStaticCfg struct {
+		Enabled        bool    `yaml:"Enabled" default:"false"`
+		URL            string  `yaml:"URL" default:""`
+		MinScore       float64 `yaml:"MinScore" default:"0.9"`
+		DebounceWindow int     `yaml:"DebounceWindow" default:"86400"`
+		StateFile      string  `yaml:"StateFile" default:""`
+	}
+
+	//BeaconProxyOpenC2StaticCfg controls the OpenC2 commands proxy beacons are exported as
+	BeaconProxyOpenC2StaticCfg struct {
+		MinScore float64 `yaml:"MinScore" default:"0.9"`
+		Action   string  `yaml:"Action" default:"deny"`
+		Limit    int     `yaml:"Limit" default:"10"`
+	}
+
+	//ElasticsearchStaticCfg controls indexing results into Elasticsearch alongside MongoDB
+	ElasticsearchStaticCfg struct {
+		Enabled bool   `yaml:"Enabled" default:"false"`
+		URL     string `yaml:"URL" default:"http://localhost:9200"`
+		Index   string `yaml:"Index" default:"rita-beaconproxy-{date}"`
+	}
+
+	//ScoreBandsStaticCfg holds the lowest beacon scores which are labeled medium, high,
+	//and critical. Lower scores are labeled low.
+	ScoreBandsStaticCfg struct {
+		Medium   float64 `yaml:"Medium" default:"0.5"`
+		High     float64 `yaml:"High" default:"0.7"`
+		Critical float64 `yaml:"Critical" default:"0.9"`
 	}
 
 	//DNSStaticCfg is used to control the DNS analysis module
@@ -120,6 +276,40 @@ type (
 		FilterExternalToInternal bool     `yaml:"FilterExternalToInternal" default:"false"`
 	}
 
+	//ParsingStaticCfg controls how log files are read
+	ParsingStaticCfg struct {
+		MaxLineLength       int                          `yaml:"MaxLineLength" default:"1048576"`
+		StrictFieldCount    bool                         `yaml:"StrictFieldCount" default:"false"`
+		TypeOverrides       map[string]map[string]string `yaml:"TypeOverrides"`
+		TimestampFields     map[string]string            `yaml:"TimestampFields"`
+		Since               int64                        `yaml:"Since" default:"0"`
+		Until               int64                        `yaml:"Until" default:"0"`
+		AbortOnErrors       bool                         `yaml:"AbortOnErrors" default:"false"`
+		MaxErrorRate        float64                      `yaml:"MaxErrorRate" default:"0.1"`
+		ParallelGzipMinSize int64                        `yaml:"ParallelGzipMinSize" default:"0"`
+		ReuseRecords        bool                         `yaml:"ReuseRecords" default:"false"`
+		DefaultNetwork      DefaultNetworkStaticCfg      `yaml:"DefaultNetwork"`
+		AppendOverlap       int64                        `yaml:"AppendOverlap" default:"300"`
+		MaxFiles            int                          `yaml:"MaxFiles" default:"0"`
+		MaxLines            int64                        `yaml:"MaxLines" default:"0"`
+		FilenameTimeRange   FilenameTimeRangeStaticCfg   `yaml:"FilenameTimeRange"`
+	}
+
+	//FilenameTimeRangeStaticCfg controls whether the log files named for times outside of
+	//the time window of an import are skipped without being opened
+	FilenameTimeRangeStaticCfg struct {
+		Enabled  bool   `yaml:"Enabled" default:"false"`
+		TimeZone string `yaml:"TimeZone" default:"UTC"`
+		Slack    int64  `yaml:"Slack" default:"3600"`
+	}
+
+	//DefaultNetworkStaticCfg names the network bound to the private addresses of records
+	//which don't identify the sensor which logged them
+	DefaultNetworkStaticCfg struct {
+		Name string `yaml:"Name" default:""`
+		UUID string `yaml:"UUID" default:""`
+	}
+
 	//StrobeStaticCfg controls the maximum number of connections between any two given hosts
 	StrobeStaticCfg struct {
 		ConnectionLimit int `yaml:"ConnectionLimit" default:"86400"`
@@ -27,6 +27,8 @@ type (
 		HTTPTable            string `default:"http"`
 		OpenConnTable        string `default:"openconn"`
 		SSLTable             string `default:"ssl"`
+		X509Table            string `default:"x509"`
+		DHCPTable            string `default:"dhcp"`
 		UniqueConnTable      string `default:"uconn"`
 		UniqueConnProxyTable string `default:"uconnProxy"`
 	}
@@ -64,7 +66,9 @@ type (
 
 	//MetaTableCfg contains the meta db collection names
 	MetaTableCfg struct {
-		FilesTable     string `default:"files"`
-		DatabasesTable string `default:"databases"`
+		FilesTable       string `default:"files"`
+		DatabasesTable   string `default:"databases"`
+		CheckpointsTable string `default:"checkpoints"`
+		WatermarksTable  string `default:"watermarks"`
 	}
 )
@@ -2,6 +2,8 @@ package database
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/activecm/mgosec"
 	"github.com/activecm/rita/config"
@@ -45,6 +47,12 @@ func NewDB(conf *config.Config, log *log.Logger) (*DB, error) {
 	session.SetSyncTimeout(conf.S.MongoDB.SocketTimeout)
 	session.SetCursorTimeout(0)
 
+	err = configureSession(session, conf.S.MongoDB)
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+
 	return &DB{
 		Session:  session,
 		log:      log,
@@ -52,6 +60,53 @@ func NewDB(conf *config.Config, log *log.Logger) (*DB, error) {
 	}, nil
 }
 
+//configureSession applies the configured read preference and write concern.
+//Sessions copied from the configured session inherit both settings.
+func configureSession(session *mgo.Session, cfg config.MongoDBStaticCfg) error {
+	mode, err := readPreferenceMode(cfg.ReadPreference)
+	if err != nil {
+		return err
+	}
+	session.SetMode(mode, true)
+	session.SetSafe(writeConcern(cfg.WriteConcern))
+	return nil
+}
+
+//readPreferenceMode converts a MongoDB read preference into the matching session mode
+func readPreferenceMode(readPreference string) (mgo.Mode, error) {
+	switch strings.ToLower(readPreference) {
+	case "", "primary":
+		return mgo.Primary, nil
+	case "primarypreferred":
+		return mgo.PrimaryPreferred, nil
+	case "secondary":
+		return mgo.Secondary, nil
+	case "secondarypreferred":
+		return mgo.SecondaryPreferred, nil
+	case "nearest":
+		return mgo.Nearest, nil
+	}
+	return mgo.Primary, fmt.Errorf("unknown MongoDB read preference: %s", readPreference)
+}
+
+//writeConcern converts the configured write concern into the session's safety mode.
+//W may either be the number of nodes which must acknowledge a write or a tag set
+//name such as "majority". WTimeout is given in milliseconds.
+func writeConcern(cfg config.WriteConcernStaticCfg) *mgo.Safe {
+	safe := &mgo.Safe{
+		J:        cfg.J,
+		WTimeout: cfg.WTimeout,
+	}
+
+	if w, err := strconv.Atoi(cfg.W); err == nil {
+		safe.W = w
+	} else {
+		safe.WMode = cfg.W
+	}
+
+	return safe
+}
+
 //connectToMongoDB connects to MongoDB possibly with authentication and TLS
 func connectToMongoDB(conf *config.Config, logger *log.Logger) (*mgo.Session, error) {
 	connString := conf.S.MongoDB.ConnectionString
@@ -69,6 +124,15 @@ func connectToMongoDB(conf *config.Config, logger *log.Logger) (*mgo.Session, er
 		return sess, err
 	}
 
+	// authenticate as the subject of the TLS client certificate
+	if conf.R.MongoDB.X509Auth {
+		err = sess.Login(&mgo.Credential{Certificate: conf.R.MongoDB.TLS.ClientCertificate})
+		if err != nil {
+			sess.Close()
+			return nil, fmt.Errorf("x509 authentication failed: %v", err)
+		}
+	}
+
 	buildInfo, err := sess.BuildInfo()
 	if err != nil {
 		sess.Close()
@@ -0,0 +1,42 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/activecm/rita/config"
+	"github.com/globalsign/mgo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadPreferenceMode(t *testing.T) {
+	cases := map[string]mgo.Mode{
+		"":                   mgo.Primary,
+		"primary":            mgo.Primary,
+		"primaryPreferred":   mgo.PrimaryPreferred,
+		"secondary":          mgo.Secondary,
+		"SecondaryPreferred": mgo.SecondaryPreferred,
+		"nearest":            mgo.Nearest,
+	}
+	for pref, expected := range cases {
+		mode, err := readPreferenceMode(pref)
+		require.Nil(t, err, pref)
+		require.Equal(t, expected, mode, pref)
+	}
+
+	_, err := readPreferenceMode("anywhere")
+	require.NotNil(t, err)
+}
+
+func TestWriteConcern(t *testing.T) {
+	// a numeric w is the number of acknowledging nodes
+	safe := writeConcern(config.WriteConcernStaticCfg{W: "2", J: true, WTimeout: 500})
+	require.Equal(t, &mgo.Safe{W: 2, J: true, WTimeout: 500}, safe)
+
+	// anything else is passed through as a mode
+	safe = writeConcern(config.WriteConcernStaticCfg{W: "majority"})
+	require.Equal(t, &mgo.Safe{WMode: "majority"}, safe)
+
+	// an empty w leaves the acknowledgement up to the server
+	safe = writeConcern(config.WriteConcernStaticCfg{})
+	require.Equal(t, &mgo.Safe{}, safe)
+}
@@ -0,0 +1,56 @@
+package database
+
+import (
+	"github.com/globalsign/mgo"
+)
+
+//The index definitions below are shared by the code which creates the collections
+//and the code which queries them. When a query changes shape, update the matching
+//index here.
+
+//HostIndexes are the indexes created with the host collection
+var HostIndexes = []mgo.Index{
+	{Key: []string{"ip", "network_uuid"}, Unique: true},
+	{Key: []string{"local"}},
+	{Key: []string{"ipv4_binary"}},
+	{Key: []string{"dat.mdip.ip", "dat.mdip.network_uuid"}},
+	{Key: []string{"dat.mbdst.ip", "dat.mbdst.network_uuid"}},
+	{Key: []string{"dat.max_dns.query"}},
+	{Key: []string{"dat.mbfqdn"}},
+	{Key: []string{"dat.mbproxy"}},
+}
+
+//HostProxyBeaconIndexes support the lookups and updates the proxy beacon analysis
+//makes against the host collection. The entries are matched by the host's
+//ip/network_uuid along with either the proxied fqdn or the chunk and score.
+var HostProxyBeaconIndexes = []mgo.Index{
+	{Key: []string{"ip", "network_uuid", "dat.mbproxy"}},
+	{Key: []string{"ip", "network_uuid", "dat.cid", "dat.max_beacon_proxy_score"}},
+}
+
+//BeaconProxyIndexes are the indexes created with the proxy beacon collection
+var BeaconProxyIndexes = []mgo.Index{
+	{Key: []string{"-score"}},
+	{Key: []string{"src", "fqdn", "src_network_uuid"}, Unique: true},
+	{Key: []string{"src", "src_network_uuid"}},
+	{Key: []string{"fqdn"}},
+	{Key: []string{"-connection_count"}},
+	{Key: []string{"proxy.ip", "proxy.network_uuid"}},
+}
+
+//EnsureIndexes creates the given indexes on a collection in the currently selected
+//database if they do not already exist
+func (d *DB) EnsureIndexes(name string, indexes []mgo.Index) error {
+	session := d.Session.Copy()
+	defer session.Close()
+
+	collection := session.DB(d.selected).C(name)
+	for _, index := range indexes {
+		err := collection.EnsureIndex(index)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -236,6 +236,18 @@ func (m *MetaDB) DeleteDB(name string) error {
 		return err
 	}
 
+	//delete any parsing checkpoints associated
+	_, err = ssn.DB(m.config.S.MongoDB.MetaDB).C(m.config.T.Meta.CheckpointsTable).RemoveAll(bson.M{"database": name})
+	if err != nil {
+		return err
+	}
+
+	//delete any ingestion watermarks associated
+	_, err = ssn.DB(m.config.S.MongoDB.MetaDB).C(m.config.T.Meta.WatermarksTable).RemoveAll(bson.M{"database": name})
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -626,5 +638,120 @@ func (m *MetaDB) RemoveFilesByChunk(database string, cid int) error {
 		}).Error("could not remove files from the meta database")
 		return nil
 	}
+
+	// the data the checkpoints refer to is removed along with the chunk
+	_, err = ssn.DB(m.config.S.MongoDB.MetaDB).C(m.config.T.Meta.CheckpointsTable).
+		RemoveAll(bson.M{"database": database, "cid": cid})
+	if err != nil {
+		m.log.WithFields(log.Fields{
+			"database": database,
+			"cid":      cid,
+			"error":    err.Error(),
+		}).Error("could not remove parsing checkpoints from the meta database")
+	}
+	return nil
+}
+
+//GetCheckpoints gets the parsing checkpoints recorded for the given database keyed by file path
+func (m *MetaDB) GetCheckpoints(database string) (map[string]files.Checkpoint, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	ssn := m.dbHandle.Copy()
+	defer ssn.Close()
+
+	var checkpoints []files.Checkpoint
+	err := ssn.DB(m.config.S.MongoDB.MetaDB).C(m.config.T.Meta.CheckpointsTable).
+		Find(bson.M{"database": database}).All(&checkpoints)
+	if err != nil {
+		m.log.WithFields(log.Fields{
+			"error": err.Error(),
+		}).Error("could not fetch parsing checkpoints from meta database")
+		return nil, err
+	}
+
+	toReturn := make(map[string]files.Checkpoint, len(checkpoints))
+	for _, checkpoint := range checkpoints {
+		toReturn[checkpoint.Path] = checkpoint
+	}
+	return toReturn, nil
+}
+
+//SetCheckpoints records how much of each file has been ingested, replacing any
+//previous checkpoints for the same files
+func (m *MetaDB) SetCheckpoints(checkpoints []files.Checkpoint) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if len(checkpoints) == 0 {
+		return nil
+	}
+	ssn := m.dbHandle.Copy()
+	defer ssn.Close()
+
+	bulk := ssn.DB(m.config.S.MongoDB.MetaDB).C(m.config.T.Meta.CheckpointsTable).Bulk()
+	bulk.Unordered()
+	for _, checkpoint := range checkpoints {
+		bulk.Upsert(bson.M{"database": checkpoint.Database, "filepath": checkpoint.Path}, checkpoint)
+	}
+
+	_, err := bulk.Run()
+	if err != nil {
+		m.log.WithFields(log.Fields{
+			"error": err.Error(),
+		}).Error("could not record parsing checkpoints in meta database")
+		return err
+	}
+	return nil
+}
+
+//GetWatermarks gets the newest records ingested into the given database keyed by log type
+func (m *MetaDB) GetWatermarks(database string) (map[string]files.Watermark, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	ssn := m.dbHandle.Copy()
+	defer ssn.Close()
+
+	var watermarks []files.Watermark
+	err := ssn.DB(m.config.S.MongoDB.MetaDB).C(m.config.T.Meta.WatermarksTable).
+		Find(bson.M{"database": database}).All(&watermarks)
+	if err != nil {
+		m.log.WithFields(log.Fields{
+			"error": err.Error(),
+		}).Error("could not fetch ingestion watermarks from meta database")
+		return nil, err
+	}
+
+	toReturn := make(map[string]files.Watermark, len(watermarks))
+	for _, watermark := range watermarks {
+		toReturn[watermark.LogType] = watermark
+	}
+	return toReturn, nil
+}
+
+//SetWatermarks records the newest records ingested into a database, replacing any
+//previous watermarks for the same log types
+func (m *MetaDB) SetWatermarks(watermarks []files.Watermark) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if len(watermarks) == 0 {
+		return nil
+	}
+	ssn := m.dbHandle.Copy()
+	defer ssn.Close()
+
+	bulk := ssn.DB(m.config.S.MongoDB.MetaDB).C(m.config.T.Meta.WatermarksTable).Bulk()
+	bulk.Unordered()
+	for _, watermark := range watermarks {
+		bulk.Upsert(bson.M{"database": watermark.Database, "log_type": watermark.LogType}, watermark)
+	}
+
+	_, err := bulk.Run()
+	if err != nil {
+		m.log.WithFields(log.Fields{
+			"error": err.Error(),
+		}).Error("could not record ingestion watermarks in meta database")
+		return err
+	}
 	return nil
 }
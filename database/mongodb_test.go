@@ -0,0 +1,59 @@
+// +build integration
+
+package database
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/activecm/rita/config"
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/dbtest"
+	"github.com/stretchr/testify/require"
+)
+
+// Server holds the dbtest DBServer
+var Server dbtest.DBServer
+
+func TestConfigureSession(t *testing.T) {
+	session := Server.Session()
+	defer session.Close()
+
+	cfg := config.MongoDBStaticCfg{
+		ReadPreference: "nearest",
+		WriteConcern:   config.WriteConcernStaticCfg{W: "majority", J: true, WTimeout: 1000},
+	}
+	require.Nil(t, configureSession(session, cfg))
+
+	// worker threads, such as the proxy beacon analyzer, read through session copies
+	ssn := session.Copy()
+	defer ssn.Close()
+
+	require.Equal(t, mgo.Nearest, ssn.Mode())
+	require.Equal(t, &mgo.Safe{WMode: "majority", J: true, WTimeout: 1000}, ssn.Safe())
+
+	// writes still succeed against a standalone server
+	err := ssn.DB("tmp_test_db").C("test").Insert(map[string]int{"a": 1})
+	require.Nil(t, err)
+
+	cfg.ReadPreference = "anywhere"
+	require.NotNil(t, configureSession(session, cfg))
+}
+
+// TestMain wraps all tests with the needed initialized mock DB and fixtures
+func TestMain(m *testing.M) {
+	// Store temporary databases files in a temporary directory
+	tempDir, _ := ioutil.TempDir("", "testing")
+	Server.SetPath(tempDir)
+
+	// Run the test suite
+	retCode := m.Run()
+
+	// Shut down the temporary server and removes data on disk.
+	Server.Wipe()
+	Server.Stop()
+
+	// call with result of m.Run()
+	os.Exit(retCode)
+}
@@ -0,0 +1,112 @@
+package database
+
+import (
+	"context"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/globalsign/mgo"
+)
+
+//transientErrorCodes holds the MongoDB error codes returned while a replica set
+//member steps down, shuts down, or is otherwise unable to serve as the primary
+var transientErrorCodes = map[int]bool{
+	91:    true, // ShutdownInProgress
+	189:   true, // PrimarySteppedDown
+	10107: true, // NotMaster
+	11600: true, // InterruptedAtShutdown
+	11602: true, // InterruptedDueToReplStateChange
+	13435: true, // NotMasterNoSlaveOk
+	13436: true, // NotMasterOrSecondary
+}
+
+//transientErrorMessages holds the messages of transient errors which aren't
+//reported with an error code
+var transientErrorMessages = []string{
+	"not master",
+	"node is recovering",
+	"no reachable servers",
+}
+
+//Retrier retries MongoDB operations which fail with transient errors, such as those
+//returned while a replica set elects a new primary. The wait between attempts
+//doubles after every failed attempt.
+type Retrier struct {
+	maxAttempts int                                  // total number of attempts, including the first
+	backoff     time.Duration                        // wait before the second attempt
+	wait        func(time.Duration) <-chan time.Time // waits between attempts, replaced in tests
+}
+
+//NewRetrier creates a Retrier which makes up to maxAttempts attempts and waits
+//backoff before the second attempt. At least one attempt is always made.
+func NewRetrier(maxAttempts int, backoff time.Duration) *Retrier {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	return &Retrier{
+		maxAttempts: maxAttempts,
+		backoff:     backoff,
+		wait:        time.After,
+	}
+}
+
+//Do runs op until it succeeds, fails with a permanent error, runs out of attempts,
+//or ctx is done. The session used by op is refreshed before each retry so that the
+//retry isn't made over the socket which failed. Returns the last error from op.
+func (r *Retrier) Do(ctx context.Context, ssn *mgo.Session, op func() error) error {
+	backoff := r.backoff
+	for attempt := 1; ; attempt++ {
+		err := op()
+		if err == nil || attempt >= r.maxAttempts || !IsTransientError(err) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-r.wait(backoff):
+		}
+		backoff *= 2
+
+		if ssn != nil {
+			ssn.Refresh()
+		}
+	}
+}
+
+//IsTransientError reports whether an error returned by MongoDB is likely to go
+//away if the operation is retried, such as a network error or an error returned
+//by a primary which is stepping down
+func IsTransientError(err error) bool {
+	if err == nil || err == mgo.ErrNotFound || err == mgo.ErrCursor {
+		return false
+	}
+
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return true
+	}
+	if _, ok := err.(net.Error); ok {
+		return true
+	}
+
+	switch e := err.(type) {
+	case *mgo.QueryError:
+		if transientErrorCodes[e.Code] {
+			return true
+		}
+	case *mgo.LastError:
+		if transientErrorCodes[e.Code] {
+			return true
+		}
+	}
+
+	msg := strings.ToLower(err.Error())
+	for _, transientMsg := range transientErrorMessages {
+		if strings.Contains(msg, transientMsg) {
+			return true
+		}
+	}
+	return false
+}
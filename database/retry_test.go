@@ -0,0 +1,95 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/globalsign/mgo"
+	"github.com/stretchr/testify/require"
+)
+
+//flakyOp fails with err the given number of times before succeeding
+type flakyOp struct {
+	failures int
+	err      error
+	calls    int
+}
+
+func (f *flakyOp) run() error {
+	f.calls++
+	if f.calls <= f.failures {
+		return f.err
+	}
+	return nil
+}
+
+//testRetrier creates a Retrier which records its waits rather than sleeping
+func testRetrier(maxAttempts int, waits *[]time.Duration) *Retrier {
+	r := NewRetrier(maxAttempts, 10*time.Millisecond)
+	r.wait = func(d time.Duration) <-chan time.Time {
+		*waits = append(*waits, d)
+		ready := make(chan time.Time, 1)
+		ready <- time.Time{}
+		return ready
+	}
+	return r
+}
+
+func TestRetrierTransient(t *testing.T) {
+	var waits []time.Duration
+	op := &flakyOp{failures: 2, err: &mgo.QueryError{Code: 10107, Message: "not master"}}
+
+	err := testRetrier(3, &waits).Do(context.Background(), nil, op.run)
+	require.Nil(t, err)
+	require.Equal(t, 3, op.calls)
+
+	// the wait doubles after each failed attempt
+	require.Equal(t, []time.Duration{10 * time.Millisecond, 20 * time.Millisecond}, waits)
+}
+
+func TestRetrierOutOfAttempts(t *testing.T) {
+	var waits []time.Duration
+	op := &flakyOp{failures: 5, err: io.EOF}
+
+	err := testRetrier(3, &waits).Do(context.Background(), nil, op.run)
+	require.Equal(t, io.EOF, err)
+	require.Equal(t, 3, op.calls)
+	require.Len(t, waits, 2)
+}
+
+func TestRetrierPermanent(t *testing.T) {
+	var waits []time.Duration
+	permanent := &mgo.QueryError{Code: 2, Message: "bad value"}
+	op := &flakyOp{failures: 2, err: permanent}
+
+	err := testRetrier(3, &waits).Do(context.Background(), nil, op.run)
+	require.Equal(t, permanent, err)
+	require.Equal(t, 1, op.calls)
+	require.Empty(t, waits)
+}
+
+func TestRetrierCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// the retries are abandoned once the context is done
+	r := NewRetrier(3, time.Hour)
+	op := &flakyOp{failures: 2, err: io.EOF}
+	require.Equal(t, io.EOF, r.Do(ctx, nil, op.run))
+	require.Equal(t, 1, op.calls)
+}
+
+func TestIsTransientError(t *testing.T) {
+	require.True(t, IsTransientError(io.EOF))
+	require.True(t, IsTransientError(&mgo.QueryError{Code: 189, Message: "primary stepped down"}))
+	require.True(t, IsTransientError(&mgo.LastError{Code: 11602}))
+	require.True(t, IsTransientError(errors.New("no reachable servers")))
+	require.True(t, IsTransientError(errors.New("not master and slaveOk=false")))
+
+	require.False(t, IsTransientError(nil))
+	require.False(t, IsTransientError(mgo.ErrNotFound))
+	require.False(t, IsTransientError(&mgo.QueryError{Code: 11000, Message: "duplicate key"}))
+}
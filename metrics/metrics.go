@@ -0,0 +1,99 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	log "github.com/sirupsen/logrus"
+)
+
+//Registry holds RITA's metrics. A dedicated registry is used so that only RITA's
+//metrics are exposed by the endpoint. The collectors are always updated, but they
+//are only served if the metrics endpoint is enabled.
+var Registry = prometheus.NewRegistry()
+
+var (
+	//LinesParsed counts the log lines parsed by log type (conn, dns, http, etc.)
+	LinesParsed = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "rita",
+			Name:      "lines_parsed_total",
+			Help:      "Number of log lines parsed by log type.",
+		},
+		[]string{"log_type"},
+	)
+
+	//ParseErrors counts the errors encountered while reading and parsing logs
+	ParseErrors = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: "rita",
+			Name:      "parse_errors_total",
+			Help:      "Number of errors encountered while reading and parsing logs.",
+		},
+	)
+
+	//TimestampsDropped counts the timestamps which failed to parse and were left out
+	//of the beacon analysis by log type
+	TimestampsDropped = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "rita",
+			Name:      "timestamps_dropped_total",
+			Help:      "Number of invalid timestamps left out of the beacon analysis by log type.",
+		},
+		[]string{"log_type"},
+	)
+
+	//BeaconProxyAnalyzed counts the proxy beacon records analyzed
+	BeaconProxyAnalyzed = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: "rita",
+			Name:      "beaconproxy_analyzed_total",
+			Help:      "Number of proxy beacon records analyzed.",
+		},
+	)
+
+	//DBLatency records the latency of database operations by collection and operation
+	DBLatency = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "rita",
+			Name:      "db_operation_duration_seconds",
+			Help:      "Latency of database operations by collection and operation.",
+			Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 14),
+		},
+		[]string{"collection", "op"},
+	)
+)
+
+func init() {
+	Registry.MustRegister(LinesParsed, ParseErrors, TimestampsDropped, BeaconProxyAnalyzed, DBLatency)
+}
+
+//ObserveDBLatency records the time elapsed since start for a database operation
+func ObserveDBLatency(collection string, op string, start time.Time) {
+	DBLatency.WithLabelValues(collection, op).Observe(time.Since(start).Seconds())
+}
+
+//Handler serves the metrics in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+//Serve exposes the metrics on the given address at /metrics in the background.
+//Failures to listen are logged rather than stopping RITA since the metrics are
+//read-only instrumentation.
+func Serve(address string, logger *log.Logger) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+
+	go func() {
+		err := http.ListenAndServe(address, mux)
+		if err != nil {
+			logger.WithFields(log.Fields{
+				"address": address,
+				"error":   err.Error(),
+			}).Error("Could not serve metrics")
+		}
+	}()
+}
@@ -0,0 +1,29 @@
+package metrics
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandler(t *testing.T) {
+	LinesParsed.WithLabelValues("conn").Inc()
+	ParseErrors.Inc()
+	TimestampsDropped.WithLabelValues("http").Inc()
+	BeaconProxyAnalyzed.Inc()
+	ObserveDBLatency("host", "find", time.Now())
+
+	recorder := httptest.NewRecorder()
+	Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	body, err := ioutil.ReadAll(recorder.Body)
+	require.Nil(t, err)
+	require.Contains(t, string(body), `rita_lines_parsed_total{log_type="conn"} 1`)
+	require.Contains(t, string(body), "rita_parse_errors_total 1")
+	require.Contains(t, string(body), `rita_timestamps_dropped_total{log_type="http"} 1`)
+	require.Contains(t, string(body), "rita_beaconproxy_analyzed_total 1")
+	require.Contains(t, string(body), `rita_db_operation_duration_seconds_count{collection="host",op="find"} 1`)
+}
@@ -5,6 +5,7 @@ import (
 	"net"
 	"strconv"
 
+	"github.com/activecm/rita/metrics"
 	"github.com/activecm/rita/parser/parsetypes"
 	"github.com/activecm/rita/pkg/data"
 	"github.com/activecm/rita/pkg/host"
@@ -59,6 +60,38 @@ func parseConnEntry(parseConn *parsetypes.Conn, filter filter, retVals ParseResu
 	)
 
 	updateCertificatesByConn(dstKey, tuple, retVals)
+
+	updateConnDurationsByConn(roundedDuration, parseConn, retVals)
+
+	updateConnBytesByConn(parseConn, retVals)
+}
+
+//updateConnDurationsByConn records the duration of the connection so that it can
+//be matched up with proxied HTTP requests sharing the connection's UID
+func updateConnDurationsByConn(roundedDuration float64, parseConn *parsetypes.Conn, retVals ParseResults) {
+	// durations are only tracked if proxy beacon duration analysis is enabled
+	if retVals.ConnDurationMap == nil {
+		return
+	}
+
+	retVals.ConnDurationLock.Lock()
+	defer retVals.ConnDurationLock.Unlock()
+
+	retVals.ConnDurationMap[parseConn.UID] = roundedDuration
+}
+
+//updateConnBytesByConn records the byte counts of the connection so that they can
+//be matched up with proxied HTTP requests sharing the connection's UID
+func updateConnBytesByConn(parseConn *parsetypes.Conn, retVals ParseResults) {
+	// byte counts are only tracked if proxy beacon byte counts are enabled
+	if retVals.ConnBytesMap == nil {
+		return
+	}
+
+	retVals.ConnBytesLock.Lock()
+	defer retVals.ConnBytesLock.Unlock()
+
+	retVals.ConnBytesMap[parseConn.UID] = ConnBytes{Orig: parseConn.OrigBytes, Resp: parseConn.RespBytes}
 }
 
 func updateUniqueConnectionsByConn(srcIP, dstIP net.IP, srcDstPair data.UniqueIPPair, srcDstKey string,
@@ -122,18 +155,26 @@ func updateUniqueConnectionsByConn(srcIP, dstIP net.IP, srcDstPair data.UniqueIP
 	// ///// INCREMENT THE CONNECTION COUNT FOR THE UNIQUE CONNECTION /////
 	retVals.UniqueConnMap[srcDstKey].ConnectionCount++
 
-	// ///// UNION TIMESTAMP WITH UNIQUE CONNECTION TIMESTAMP SET /////
-	if !util.Int64InSlice(parseConn.TimeStamp, retVals.UniqueConnMap[srcDstKey].TsList) {
-		retVals.UniqueConnMap[srcDstKey].TsList = append(
-			retVals.UniqueConnMap[srcDstKey].TsList, parseConn.TimeStamp,
+	// connections left out of the beacon analysis by their history are still counted,
+	// but their timestamps and bytes are not recorded
+	if !filter.filterConnHistory(parseConn.History) {
+		// ///// UNION TIMESTAMP WITH UNIQUE CONNECTION TIMESTAMP SET /////
+		// timestamps which failed to parse are set to -1 and would throw off the beacon
+		// analysis, so they are dropped while the connection itself is still counted
+		if parseConn.TimeStamp < 0 {
+			metrics.TimestampsDropped.WithLabelValues("conn").Inc()
+		} else if !util.Int64InSlice(parseConn.TimeStamp, retVals.UniqueConnMap[srcDstKey].TsList) {
+			retVals.UniqueConnMap[srcDstKey].TsList = append(
+				retVals.UniqueConnMap[srcDstKey].TsList, parseConn.TimeStamp,
+			)
+		}
+
+		// ///// APPEND IP BYTES TO UNIQUE CONNECTION BYTES LIST /////
+		retVals.UniqueConnMap[srcDstKey].OrigBytesList = append(
+			retVals.UniqueConnMap[srcDstKey].OrigBytesList, parseConn.OrigIPBytes,
 		)
 	}
 
-	// ///// APPEND IP BYTES TO UNIQUE CONNECTION BYTES LIST /////
-	retVals.UniqueConnMap[srcDstKey].OrigBytesList = append(
-		retVals.UniqueConnMap[srcDstKey].OrigBytesList, parseConn.OrigIPBytes,
-	)
-
 	// ///// ADD ORIG BYTES AND RESP BYTES TO UNIQUE CONNECTION TOTAL BYTES COUNTER /////
 	// Calculate and store the total number of bytes exchanged by the uconn pair
 	retVals.UniqueConnMap[srcDstKey].TotalBytes += twoWayIPBytes
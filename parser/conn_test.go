@@ -0,0 +1,68 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/activecm/rita/config"
+	"github.com/activecm/rita/parser/parsetypes"
+	"github.com/stretchr/testify/require"
+)
+
+//testNetFlow creates a flow from the source to example.com's address
+func testNetFlow(ts int64, bytes int64) *parsetypes.NetFlow {
+	return &parsetypes.NetFlow{
+		TimeStamp:       ts,
+		Source:          "10.0.0.1",
+		SourcePort:      53542,
+		Destination:     "93.184.216.34",
+		DestinationPort: 443,
+		Proto:           "TCP",
+		InPkts:          4,
+		InBytes:         bytes,
+	}
+}
+
+func TestParseConnEntryNetFlow(t *testing.T) {
+	conf, err := config.LoadTestingConfig("")
+	require.Nil(t, err)
+	testFilter := newFilter(conf)
+
+	// flows are aggregated like the connections in Zeek's conn log
+	retVals := newParseResults()
+	for i, bytes := range []int64{120, 120, 180} {
+		flow := testNetFlow(int64(1517336042+i*60), bytes)
+		parseConnEntry(flow.Record().(*parsetypes.Conn), testFilter, retVals)
+	}
+
+	require.Len(t, retVals.UniqueConnMap, 1)
+	for _, entry := range retVals.UniqueConnMap {
+		require.Equal(t, int64(3), entry.ConnectionCount)
+		require.Equal(t, []int64{1517336042, 1517336102, 1517336162}, entry.TsList)
+		require.Equal(t, []int64{120, 120, 180}, entry.OrigBytesList)
+		require.Equal(t, int64(420), entry.TotalBytes)
+	}
+}
+
+func TestParseConnEntryHistory(t *testing.T) {
+	conf, err := config.LoadTestingConfig("")
+	require.Nil(t, err)
+	conf.S.Beacon.RequiredHistory = "h"
+	testFilter := newFilter(conf)
+
+	retVals := newParseResults()
+	for i, history := range []string{"ShADadFf", "S", "ShADadFf", "S", ""} {
+		flow := testNetFlow(int64(1517336042+i*60), int64(100+i))
+		conn := flow.Record().(*parsetypes.Conn)
+		conn.History = history
+		parseConnEntry(conn, testFilter, retVals)
+	}
+
+	// the SYN only connections are counted, but only the established connections and
+	// the connection without a history are used for beacons
+	require.Len(t, retVals.UniqueConnMap, 1)
+	for _, entry := range retVals.UniqueConnMap {
+		require.Equal(t, int64(5), entry.ConnectionCount)
+		require.Equal(t, []int64{1517336042, 1517336162, 1517336282}, entry.TsList)
+		require.Equal(t, []int64{100, 102, 104}, entry.OrigBytesList)
+	}
+}
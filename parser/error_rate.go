@@ -0,0 +1,33 @@
+package parser
+
+import "fmt"
+
+//minErrorRateLines is the number of lines which must be read from a file before its
+//error rate may abort the parsing. Shorter files are checked once they are read in full.
+const minErrorRateLines = 100
+
+//errorRate tracks the share of the lines in a file which failed to parse
+type errorRate struct {
+	maxRate float64
+	lines   int64
+	errored int64
+}
+
+//record counts a line which was parsed, and whether it failed
+func (r *errorRate) record(failed bool) {
+	r.lines++
+	if failed {
+		r.errored++
+	}
+}
+
+//exceeded returns true if more than maxRate of the lines failed to parse
+func (r *errorRate) exceeded() bool {
+	return r.lines > 0 && float64(r.errored)/float64(r.lines) > r.maxRate
+}
+
+//err describes the error rate which aborted the parsing of a file
+func (r *errorRate) err() error {
+	return fmt.Errorf("%d of %d lines failed to parse, exceeding the maximum error rate of %g",
+		r.errored, r.lines, r.maxRate)
+}
@@ -0,0 +1,190 @@
+package parser
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/activecm/rita/config"
+	"github.com/activecm/rita/database"
+	"github.com/activecm/rita/parser/files"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+//writeTestConnLog writes a TSV conn log where every nth line has an unparsable port.
+//A value of 0 for n writes a log without errors.
+func writeTestConnLog(t *testing.T, dir string, name string, lines int, n int) string {
+	var contents strings.Builder
+	contents.WriteString("#separator \\x09\n#set_separator\t,\n#empty_field\t(empty)\n#unset_field\t-\n#path\tconn\n")
+	contents.WriteString("#fields\tts\tuid\tid.orig_h\tid.orig_p\tid.resp_h\tid.resp_p\n")
+	contents.WriteString("#types\ttime\tstring\taddr\tport\taddr\tport\n")
+	for i := 0; i < lines; i++ {
+		port := "443"
+		if n != 0 && i%n == 0 {
+			port = "garbage"
+		}
+		fmt.Fprintf(&contents, "%d.000000\tC%d\t10.0.0.1\t%d\t93.184.216.34\t%s\n", 1517336042+i, i, 50000+i, port)
+	}
+
+	path := filepath.Join(dir, name)
+	require.Nil(t, ioutil.WriteFile(path, []byte(contents.String()), 0644))
+	return path
+}
+
+//testParseFiles parses the log files with the given parsing settings
+func testParseFiles(t *testing.T, parsing config.ParsingStaticCfg, paths ...string) []*files.IndexedFile {
+	indexedFiles, _ := testParseFilesResults(t, parsing, paths...)
+	return indexedFiles
+}
+
+//testParseFilesResults parses the log files with the given parsing settings and returns
+//the records aggregated from them as well
+func testParseFilesResults(t *testing.T, parsing config.ParsingStaticCfg, paths ...string) ([]*files.IndexedFile, ParseResults) {
+	conf, err := config.LoadTestingConfig("")
+	require.Nil(t, err)
+	conf.S.Parsing = parsing
+
+	logger := log.New()
+	logger.SetLevel(log.FatalLevel)
+
+	fs := &FSImporter{
+		filter:   newFilter(conf),
+		log:      logger,
+		config:   conf,
+		database: &database.DB{},
+	}
+
+	indexedFiles := files.IndexFiles(paths, 1, "test", 0, logger, conf)
+	require.Len(t, indexedFiles, len(paths))
+	results := fs.parseFiles(context.Background(), indexedFiles, 1, logger)
+	return indexedFiles, results
+}
+
+func TestParseFilesAbortOnErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "errors")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	// every other line of the corrupt log fails to parse, every twentieth line of the noisy log does
+	corrupt := writeTestConnLog(t, dir, "conn.corrupt.log", 1000, 2)
+	noisy := writeTestConnLog(t, dir, "conn.noisy.log", 1000, 20)
+	clean := writeTestConnLog(t, dir, "conn.clean.log", 1000, 0)
+	short := writeTestConnLog(t, dir, "conn.short.log", 10, 2)
+
+	strict := config.ParsingStaticCfg{MaxLineLength: 1 << 20, AbortOnErrors: true, MaxErrorRate: 0.1}
+	indexedFiles := testParseFiles(t, strict, corrupt, noisy, clean, short)
+
+	// the corrupt log is aborted once enough records have been read to judge it.
+	// The header lines aren't counted as records.
+	require.NotNil(t, indexedFiles[0].GetParseError())
+	require.False(t, indexedFiles[0].IsComplete())
+	require.Equal(t, int64(7+minErrorRateLines), indexedFiles[0].Checkpoint().Lines)
+
+	// an error rate below the threshold is tolerated
+	require.Nil(t, indexedFiles[1].GetParseError())
+	require.True(t, indexedFiles[1].IsComplete())
+
+	require.Nil(t, indexedFiles[2].GetParseError())
+	require.True(t, indexedFiles[2].IsComplete())
+
+	// logs too short to abort midway are checked once they are read
+	require.NotNil(t, indexedFiles[3].GetParseError())
+	require.False(t, indexedFiles[3].IsComplete())
+
+	// errors are only logged by default
+	lenient := config.ParsingStaticCfg{MaxLineLength: 1 << 20, MaxErrorRate: 0.1}
+	indexedFiles = testParseFiles(t, lenient, corrupt)
+	require.Nil(t, indexedFiles[0].GetParseError())
+	require.True(t, indexedFiles[0].IsComplete())
+}
+
+func TestParseFilesMalformedJSON(t *testing.T) {
+	dir, err := ioutil.TempDir("", "errors")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	// the fields decoded before the truncation must not be aggregated
+	contents := strings.Join([]string{
+		`{"_path":"conn","ts":1517336042.090,"uid":"C1","id.orig_h":"10.0.0.1","id.orig_p":53542,"id.resp_h":"93.184.216.34","id.resp_p":443,"proto":"tcp"}`,
+		`{"_path":"conn","ts":1517336102.090,"uid":"C2","id.orig_h":"10.0.0.9","id.orig_p":53543,"id.resp_h":"93.184.216.99","id.resp_p":`,
+		`{"_path":"conn","ts":1517336162.090,"uid":"C3","id.orig_h":"10.0.0.1","id.orig_p":53544,"id.resp_h":"93.184.216.34","id.resp_p":443,"proto":"tcp"}`,
+	}, "\n") + "\n"
+	path := filepath.Join(dir, "conn.log")
+	require.Nil(t, ioutil.WriteFile(path, []byte(contents), 0644))
+
+	strict := config.ParsingStaticCfg{MaxLineLength: 1 << 20, AbortOnErrors: true, MaxErrorRate: 0.5}
+	indexedFiles, results := testParseFilesResults(t, strict, path)
+
+	// the malformed record is counted as an error rather than aggregated
+	require.Nil(t, indexedFiles[0].GetParseError())
+	require.Equal(t, int64(3), indexedFiles[0].Checkpoint().Lines)
+	require.Len(t, results.UniqueConnMap, 1)
+	for _, uconn := range results.UniqueConnMap {
+		require.Equal(t, "10.0.0.1", uconn.Hosts.SrcIP)
+		require.Equal(t, int64(2), uconn.ConnectionCount)
+	}
+	for _, host := range results.HostMap {
+		require.NotEqual(t, "10.0.0.9", host.Host.IP)
+		require.NotEqual(t, "93.184.216.99", host.Host.IP)
+	}
+}
+
+func TestParseFilesOpenError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "errors")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	clean := writeTestConnLog(t, dir, "conn.clean.log", 10, 0)
+	removed := writeTestConnLog(t, dir, "conn.removed.log", 10, 0)
+
+	conf, err := config.LoadTestingConfig("")
+	require.Nil(t, err)
+	conf.S.Parsing = config.ParsingStaticCfg{MaxLineLength: 1 << 20}
+
+	logger := log.New()
+	logger.SetLevel(log.FatalLevel)
+
+	fs := &FSImporter{
+		filter:   newFilter(conf),
+		log:      logger,
+		config:   conf,
+		database: &database.DB{},
+	}
+
+	// the file disappears between being indexed and being parsed
+	indexedFiles := files.IndexFiles([]string{clean, removed}, 1, "test", 0, logger, conf)
+	require.Len(t, indexedFiles, 2)
+	require.Nil(t, os.Remove(removed))
+	fs.parseFiles(context.Background(), indexedFiles, 1, logger)
+
+	// the file which couldn't be opened is reported rather than parsed
+	for _, file := range indexedFiles {
+		if file.Path == removed {
+			require.NotNil(t, file.GetParseError())
+			require.False(t, file.IsComplete())
+		} else {
+			require.Nil(t, file.GetParseError())
+			require.True(t, file.IsComplete())
+		}
+	}
+}
+
+func TestErrorRate(t *testing.T) {
+	rate := &errorRate{maxRate: 0.1}
+	require.False(t, rate.exceeded())
+
+	for i := 0; i < 9; i++ {
+		rate.record(false)
+	}
+	rate.record(true)
+	require.False(t, rate.exceeded())
+
+	rate.record(true)
+	require.True(t, rate.exceeded())
+	require.EqualError(t, rate.err(), "2 of 11 lines failed to parse, exceeding the maximum error rate of 0.1")
+}
@@ -0,0 +1,102 @@
+package files
+
+import (
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+//Checkpoint records how many lines of a file have been ingested into a database.
+//Checkpoints are only valid while the file keeps the same size and modification time.
+type Checkpoint struct {
+	Path     string    `bson:"filepath"`
+	Database string    `bson:"database"`
+	CID      int       `bson:"cid"`
+	Length   int64     `bson:"length"`
+	ModTime  time.Time `bson:"modified"`
+	Lines    int64     `bson:"lines"`
+	Complete bool      `bson:"complete"`
+}
+
+//Matches returns whether the checkpoint was recorded for a file with the given size
+//and modification time
+func (c Checkpoint) Matches(length int64, modTime time.Time) bool {
+	return c.Length == length && c.ModTime.Equal(modTime)
+}
+
+//skipCompletedFiles removes the files which have been completely ingested according to
+//their checkpoints. Files which changed since their checkpoint was recorded are kept.
+func skipCompletedFiles(paths []string, checkpoints map[string]Checkpoint, logger *log.Logger) []string {
+	if len(checkpoints) == 0 {
+		return paths
+	}
+
+	var toReturn []string
+	for _, path := range paths {
+		checkpoint, ok := checkpoints[path]
+		// a named pipe streams new data each time it is read
+		if ok && checkpoint.Complete && !isNamedPipePath(path) {
+			fInfo, err := sourceFor(path).Stat(path)
+			if err == nil && checkpoint.Matches(fInfo.Size(), fInfo.ModTime()) {
+				logger.WithFields(log.Fields{
+					"path":  path,
+					"lines": checkpoint.Lines,
+				}).Info("Skipping file which has already been ingested")
+				continue
+			}
+		}
+		toReturn = append(toReturn, path)
+	}
+	return toReturn
+}
+
+//ApplyCheckpoints sets the line to resume parsing from for each file which was partially
+//ingested. Files which changed since their checkpoint was recorded are parsed from the start.
+func ApplyCheckpoints(indexedFiles []*IndexedFile, checkpoints map[string]Checkpoint, logger *log.Logger) {
+	for _, file := range indexedFiles {
+		checkpoint, ok := checkpoints[file.Path]
+		if !ok || checkpoint.Complete || file.pipe != nil {
+			continue
+		}
+
+		if !checkpoint.Matches(file.Length, file.ModTime) {
+			logger.WithFields(log.Fields{
+				"path": file.Path,
+			}).Info("File changed since it was partially ingested, parsing from the start")
+			continue
+		}
+
+		file.resumeLine = checkpoint.Lines
+	}
+}
+
+//GetResumeLine returns the number of lines at the start of the file which were
+//ingested by a previous import
+func (i *IndexedFile) GetResumeLine() int64 {
+	return i.resumeLine
+}
+
+//SetLinesRead records how many lines of the file were read and whether the whole
+//file was read without error
+func (i *IndexedFile) SetLinesRead(lines int64, complete bool) {
+	i.linesRead = lines
+	i.complete = complete
+}
+
+//IsComplete returns whether the whole file was read without error
+func (i *IndexedFile) IsComplete() bool {
+	return i.complete
+}
+
+//Checkpoint returns the checkpoint which records how much of the file was read
+func (i *IndexedFile) Checkpoint() Checkpoint {
+	return Checkpoint{
+		Path:     i.Path,
+		Database: i.TargetDatabase,
+		CID:      i.CID,
+		Length:   i.Length,
+		ModTime:  i.ModTime,
+		Lines:    i.linesRead,
+		Complete: i.complete,
+	}
+}
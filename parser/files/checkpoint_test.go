@@ -0,0 +1,97 @@
+package files
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+//writeTestLog writes a log file to the directory and returns its path and checkpoint
+func writeTestLog(t *testing.T, dir string, name string, contents string) (string, Checkpoint) {
+	path := filepath.Join(dir, name)
+	require.Nil(t, ioutil.WriteFile(path, []byte(contents), 0644))
+
+	fInfo, err := os.Stat(path)
+	require.Nil(t, err)
+
+	return path, Checkpoint{
+		Path:     path,
+		Database: "test",
+		Length:   fInfo.Size(),
+		ModTime:  fInfo.ModTime(),
+	}
+}
+
+func TestCheckpointResume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoints")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	donePath, done := writeTestLog(t, dir, "conn.log", "a\nb\nc\n")
+	done.Lines = 3
+	done.Complete = true
+
+	partialPath, partial := writeTestLog(t, dir, "dns.log", "a\nb\nc\n")
+	partial.Lines = 2
+
+	newPath, _ := writeTestLog(t, dir, "http.log", "a\n")
+
+	checkpoints := map[string]Checkpoint{donePath: done, partialPath: partial}
+
+	// the completed file is skipped when gathering the files
+	gathered := GatherLogFiles([]string{dir}, checkpoints, log.New())
+	require.ElementsMatch(t, []string{partialPath, newPath}, gathered)
+
+	// the partial file resumes after the lines which were ingested
+	indexed := []*IndexedFile{
+		{Path: partialPath, Length: partial.Length, ModTime: partial.ModTime},
+		{Path: newPath},
+	}
+	ApplyCheckpoints(indexed, checkpoints, log.New())
+	require.Equal(t, int64(2), indexed[0].GetResumeLine())
+	require.Equal(t, int64(0), indexed[1].GetResumeLine())
+
+	// the lines read in total are recorded for the next import
+	indexed[0].TargetDatabase = "test"
+	indexed[0].SetLinesRead(3, true)
+	checkpoint := indexed[0].Checkpoint()
+	require.Equal(t, int64(3), checkpoint.Lines)
+	require.True(t, checkpoint.Complete)
+	require.True(t, checkpoint.Matches(partial.Length, partial.ModTime))
+}
+
+func TestCheckpointChangedFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoints")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	donePath, done := writeTestLog(t, dir, "conn.log", "a\nb\n")
+	done.Lines = 2
+	done.Complete = true
+
+	partialPath, partial := writeTestLog(t, dir, "dns.log", "a\nb\n")
+	partial.Lines = 1
+
+	// the files grow after their checkpoints are recorded
+	_, grownDone := writeTestLog(t, dir, "conn.log", "a\nb\nc\nd\n")
+	_, grownPartial := writeTestLog(t, dir, "dns.log", "a\nb\nc\nd\n")
+
+	checkpoints := map[string]Checkpoint{donePath: done, partialPath: partial}
+
+	// a completed file which changed is gathered again
+	gathered := GatherLogFiles([]string{dir}, checkpoints, log.New())
+	require.ElementsMatch(t, []string{donePath, partialPath}, gathered)
+
+	// and neither file resumes from its stale checkpoint
+	indexed := []*IndexedFile{
+		{Path: donePath, Length: grownDone.Length, ModTime: grownDone.ModTime},
+		{Path: partialPath, Length: grownPartial.Length, ModTime: grownPartial.ModTime},
+	}
+	ApplyCheckpoints(indexed, checkpoints, log.New())
+	require.Equal(t, int64(0), indexed[0].GetResumeLine())
+	require.Equal(t, int64(0), indexed[1].GetResumeLine())
+}
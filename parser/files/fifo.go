@@ -0,0 +1,59 @@
+package files
+
+import (
+	"bytes"
+	"io"
+	"os"
+)
+
+//pipeFile is a named pipe (FIFO) being read as a log file. A pipe can't be rewound or
+//reopened without losing data, so the data read while the pipe is indexed is recorded
+//and replayed before the rest of the stream when the pipe is parsed.
+type pipeFile struct {
+	LogFile
+	recorded bytes.Buffer
+	reader   io.Reader
+}
+
+//newPipeFile starts recording the data read from a named pipe
+func newPipeFile(file LogFile) *pipeFile {
+	pipe := &pipeFile{LogFile: file}
+	pipe.reader = io.TeeReader(file, &pipe.recorded)
+	return pipe
+}
+
+//Read reads from the pipe, replaying the recorded data first once the pipe is rewound
+func (p *pipeFile) Read(b []byte) (int, error) {
+	return p.reader.Read(b)
+}
+
+//rewind stops recording and replays the data read so far before continuing with the
+//rest of the stream
+func (p *pipeFile) rewind() {
+	p.reader = io.MultiReader(bytes.NewReader(p.recorded.Bytes()), p.LogFile)
+}
+
+//uncloseablePipe keeps a pipe open while it is indexed so it may be parsed afterwards
+type uncloseablePipe struct {
+	*pipeFile
+}
+
+//Close leaves the pipe open
+func (uncloseablePipe) Close() error {
+	return nil
+}
+
+//isNamedPipe returns whether the file info describes a named pipe (FIFO)
+func isNamedPipe(fInfo os.FileInfo) bool {
+	return fInfo.Mode()&os.ModeNamedPipe != 0
+}
+
+//isNamedPipePath returns whether the path refers to a named pipe (FIFO) on the
+//local file system
+func isNamedPipePath(path string) bool {
+	if IsS3Path(path) {
+		return false
+	}
+	fInfo, err := os.Stat(path)
+	return err == nil && isNamedPipe(fInfo)
+}
@@ -0,0 +1,116 @@
+// +build !windows
+
+package files
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/activecm/rita/config"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+//scanAll returns the lines read from a log file until the stream ends
+func scanAll(t *testing.T, file LogFile) []string {
+	scanner, closer, err := GetFileScanner(file, 0, 0)
+	require.Nil(t, err)
+	defer closer()
+
+	var lines []string
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	require.Nil(t, scanner.Err())
+	return lines
+}
+
+func TestGetFileScannerPipe(t *testing.T) {
+	reader, writer, err := os.Pipe()
+	require.Nil(t, err)
+
+	// the pipe's name doesn't end in .log, yet it is scanned until the writer closes it
+	require.False(t, isLogFile(reader.Name()))
+	go func() {
+		for _, line := range strings.SplitAfter(testConnLog, "\n") {
+			writer.WriteString(line)
+		}
+		writer.Close()
+	}()
+
+	lines := scanAll(t, reader)
+	require.Equal(t, strings.Split(strings.TrimSuffix(testConnLog, "\n"), "\n"), lines)
+}
+
+func TestPipeFileReplay(t *testing.T) {
+	reader, writer, err := os.Pipe()
+	require.Nil(t, err)
+
+	pipe := newPipeFile(reader)
+	writer.WriteString(testConnLog)
+
+	// the header is read while indexing without closing the pipe
+	scanner, closer, err := GetFileScanner(uncloseablePipe{pipe}, 0, 0)
+	require.Nil(t, err)
+	header, err := scanTSVHeader(scanner)
+	require.Nil(t, err)
+	require.Equal(t, "conn", header.ObjType)
+	require.Nil(t, closer())
+
+	// the data written after indexing follows the replayed data
+	pipe.rewind()
+	writer.WriteString("1517336044.090842\tCW32gzposF\t10.0.0.1\t53544\t8.8.8.8\t53\n")
+	writer.Close()
+
+	lines := scanAll(t, pipe)
+	require.Len(t, lines, 10)
+	require.Equal(t, "#separator \\x09", lines[0])
+	require.True(t, strings.HasPrefix(lines[9], "1517336044.090842\tCW32gzposF"))
+}
+
+func TestNamedPipe(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fifo")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	fifoPath := filepath.Join(dir, "zeek-conn")
+	require.Nil(t, syscall.Mkfifo(fifoPath, 0600))
+	dirFifoPath := filepath.Join(dir, "conn.log")
+	require.Nil(t, syscall.Mkfifo(dirFifoPath, 0600))
+
+	// named pipes are only gathered when they are listed explicitly
+	require.Empty(t, GatherLogFiles([]string{dir}, nil, log.New()))
+	require.Equal(t, []string{fifoPath}, GatherLogFiles([]string{fifoPath}, nil, log.New()))
+
+	// the writer sends the first record before the pipe is indexed and the rest afterwards
+	indexed := make(chan struct{})
+	go func() {
+		writer, err := os.OpenFile(fifoPath, os.O_WRONLY, 0)
+		if err != nil {
+			return
+		}
+		lines := strings.SplitAfter(testConnLog, "\n")
+		writer.WriteString(strings.Join(lines[:8], ""))
+		<-indexed
+		writer.WriteString(strings.Join(lines[8:], ""))
+		writer.Close()
+	}()
+
+	conf, err := config.LoadTestingConfig("")
+	require.Nil(t, err)
+	indexedFiles := IndexFiles([]string{fifoPath}, 1, "test", 0, log.New(), conf)
+	close(indexed)
+	require.Len(t, indexedFiles, 1)
+	require.Equal(t, conf.T.Structure.ConnTable, indexedFiles[0].TargetCollection)
+	require.NotEmpty(t, indexedFiles[0].Hash)
+
+	file, err := indexedFiles[0].Open()
+	require.Nil(t, err)
+	lines := scanAll(t, file)
+	require.Len(t, lines, 9)
+	require.True(t, strings.HasPrefix(lines[8], "1517336043.090842\tCW32gzposE"))
+}
@@ -0,0 +1,133 @@
+package files
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+//doubleStar is the path segment which matches any number of directories
+const doubleStar = "**"
+
+// IsGlobPattern returns true if the path holds wildcards which are expanded
+// into the matching files and directories
+func IsGlobPattern(path string) bool {
+	return !IsS3Path(path) && strings.ContainsAny(path, "*?[")
+}
+
+// expandGlobs replaces the glob patterns among the paths with the files and
+// directories they match. Patterns are matched with filepath.Match semantics,
+// except that a "**" segment matches any number of nested directories.
+// Patterns without matches are reported rather than silently dropped.
+func expandGlobs(paths []string, logger *log.Logger) []string {
+	var toReturn []string
+
+	for _, path := range paths {
+		if !IsGlobPattern(path) {
+			toReturn = append(toReturn, path)
+			continue
+		}
+
+		matches, err := globPath(path)
+		if err != nil {
+			logger.WithFields(log.Fields{
+				"pattern": path,
+				"error":   err.Error(),
+			}).Warn("Ignoring invalid glob pattern")
+			continue
+		}
+		if len(matches) == 0 {
+			logger.WithFields(log.Fields{
+				"pattern": path,
+			}).Warn("No files matched the glob pattern")
+			continue
+		}
+		toReturn = append(toReturn, matches...)
+	}
+
+	return toReturn
+}
+
+// globPath returns the paths matching a glob pattern in sorted order
+func globPath(pattern string) ([]string, error) {
+	if !strings.Contains(pattern, doubleStar) {
+		return filepath.Glob(pattern)
+	}
+
+	// walk the directories below the portion of the pattern preceding the first "**"
+	// and match the remainder of the pattern against each path
+	segments := strings.Split(filepath.ToSlash(filepath.Clean(pattern)), "/")
+	rootEnd := 0
+	for rootEnd < len(segments) && segments[rootEnd] != doubleStar {
+		if strings.ContainsAny(segments[rootEnd], "*?[") {
+			break
+		}
+		rootEnd++
+	}
+
+	root := strings.Join(segments[:rootEnd], "/")
+	if root == "" && strings.HasPrefix(pattern, "/") {
+		root = "/"
+	} else if root == "" {
+		root = "."
+	}
+	root = filepath.FromSlash(root)
+
+	// validate the segments up front since a walk hides the errors from filepath.Match
+	for _, segment := range segments[rootEnd:] {
+		if _, err := filepath.Match(segment, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	var matches []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			// unreadable directories are skipped like filepath.Glob does
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil || rel == "." {
+			return nil
+		}
+		if matchSegments(segments[rootEnd:], strings.Split(filepath.ToSlash(rel), "/")) {
+			matches = append(matches, path)
+		}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	sort.Strings(matches)
+	return matches, err
+}
+
+// matchSegments matches the segments of a path against the segments of a pattern.
+// A "**" pattern segment matches zero or more path segments.
+func matchSegments(pattern []string, path []string) bool {
+	if len(pattern) == 0 {
+		return len(path) == 0
+	}
+
+	if pattern[0] == doubleStar {
+		for skip := 0; skip <= len(path); skip++ {
+			if matchSegments(pattern[1:], path[skip:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(path) == 0 {
+		return false
+	}
+	matched, err := filepath.Match(pattern[0], path[0])
+	if err != nil || !matched {
+		return false
+	}
+	return matchSegments(pattern[1:], path[1:])
+}
@@ -0,0 +1,81 @@
+package files
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGatherLogFilesGlob(t *testing.T) {
+	dir, err := ioutil.TempDir("", "glob")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	require.Nil(t, os.MkdirAll(filepath.Join(dir, "2018-01-30", "sensor"), 0755))
+	conn1, _ := writeTestLog(t, dir, "conn.00:00:00-01:00:00.log.gz", testConnLog)
+	conn2, _ := writeTestLog(t, dir, "conn.01:00:00-02:00:00.log.gz", testConnLog)
+	writeTestLog(t, dir, "dns.00:00:00-01:00:00.log.gz", testConnLog)
+	writeTestLog(t, dir, "conn-summary.00:00:00-01:00:00.log.gz", testConnLog)
+	nested1, _ := writeTestLog(t, filepath.Join(dir, "2018-01-30"), "conn.02:00:00-03:00:00.log.gz", testConnLog)
+	nested2, _ := writeTestLog(t, filepath.Join(dir, "2018-01-30", "sensor"), "conn.03:00:00-04:00:00.log.gz", testConnLog)
+	writeTestLog(t, filepath.Join(dir, "2018-01-30", "sensor"), "dns.03:00:00-04:00:00.log.gz", testConnLog)
+
+	// only the conn logs directly in the directory match
+	paths := GatherLogFiles([]string{filepath.Join(dir, "conn.*.log.gz")}, nil, log.New())
+	require.ElementsMatch(t, []string{conn1, conn2}, paths)
+
+	// ** matches the conn logs at any depth
+	paths = GatherLogFiles([]string{filepath.Join(dir, "**", "conn.*.log.gz")}, nil, log.New())
+	require.ElementsMatch(t, []string{conn1, conn2, nested1, nested2}, paths)
+
+	// ** in the middle of a pattern matches zero or more directories
+	paths = GatherLogFiles([]string{filepath.Join(dir, "2018-*", "**", "conn.*.log.gz")}, nil, log.New())
+	require.ElementsMatch(t, []string{nested1, nested2}, paths)
+
+	// patterns are mixed with literal paths, and files matched twice are gathered once
+	paths = GatherLogFiles([]string{filepath.Join(dir, "conn.0*.log.gz"), conn1}, nil, log.New())
+	require.ElementsMatch(t, []string{conn1, conn2}, paths)
+}
+
+func TestGatherLogFilesGlobNoMatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "glob")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	writeTestLog(t, dir, "conn.log", testConnLog)
+	logger, hook := test.NewNullLogger()
+
+	patterns := []string{
+		filepath.Join(dir, "http.*.log"),
+		filepath.Join(dir, "**", "http.*.log"),
+		filepath.Join(dir, "missing", "**", "*.log"),
+	}
+	for _, pattern := range patterns {
+		hook.Reset()
+		paths := GatherLogFiles([]string{pattern}, nil, logger)
+		require.Empty(t, paths, pattern)
+
+		require.NotNil(t, hook.LastEntry(), pattern)
+		require.Equal(t, log.WarnLevel, hook.LastEntry().Level)
+		require.Equal(t, pattern, hook.LastEntry().Data["pattern"])
+	}
+
+	// an invalid pattern is reported as well
+	hook.Reset()
+	paths := GatherLogFiles([]string{filepath.Join(dir, "**", "[.log")}, nil, logger)
+	require.Empty(t, paths)
+	require.Equal(t, log.WarnLevel, hook.LastEntry().Level)
+}
+
+func TestIsGlobPattern(t *testing.T) {
+	require.True(t, IsGlobPattern("/var/log/zeek/conn.*.log.gz"))
+	require.True(t, IsGlobPattern("/var/log/zeek/**/conn.log"))
+	require.True(t, IsGlobPattern("conn.0?.log"))
+	require.False(t, IsGlobPattern("/var/log/zeek/conn.log"))
+	require.False(t, IsGlobPattern("s3://bucket/logs/*"))
+}
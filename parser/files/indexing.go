@@ -1,6 +1,7 @@
 package files
 
 import (
+	"bytes"
 	"crypto/md5"
 	"encoding/json"
 	"errors"
@@ -25,7 +26,7 @@ func newIndexedFile(filePath string, targetDB string, targetCID int,
 	toReturn := new(IndexedFile)
 	toReturn.Path = filePath
 
-	fileHandle, err := os.Open(filePath)
+	fileHandle, err := OpenLogFile(filePath)
 	if err != nil {
 		return toReturn, err
 	}
@@ -38,14 +39,39 @@ func newIndexedFile(filePath string, targetDB string, targetCID int,
 	toReturn.Length = fInfo.Size()
 	toReturn.ModTime = fInfo.ModTime()
 
-	fHash, err := getFileHash(fileHandle, fInfo)
-	if err != nil {
-		fileHandle.Close()
-		return toReturn, err
+	// named pipes are read once, so the data read while indexing is recorded and the
+	// pipe is left open to be parsed. The pipe is hashed once the header is read.
+	var pipe *pipeFile
+	if isNamedPipe(fInfo) {
+		pipe = newPipeFile(fileHandle)
+		fileHandle = uncloseablePipe{pipe}
+		defer func() {
+			if toReturn.pipe == nil {
+				pipe.Close()
+			}
+		}()
+	} else {
+		fHash, err := getFileHash(fileHandle)
+		if err != nil {
+			fileHandle.Close()
+			return toReturn, err
+		}
+		toReturn.Hash = fHash
+
+		// rewind the file to read the header. Files which can't seek, such as
+		// those streamed from S3, are opened again.
+		if seeker, ok := fileHandle.(io.Seeker); ok {
+			_, err = seeker.Seek(0, io.SeekStart)
+		} else {
+			fileHandle.Close()
+			fileHandle, err = OpenLogFile(filePath)
+		}
+		if err != nil {
+			return toReturn, err
+		}
 	}
-	toReturn.Hash = fHash
 
-	scanner, closeScanner, err := GetFileScanner(fileHandle)
+	scanner, closeScanner, err := GetFileScanner(fileHandle, conf.S.Parsing.MaxLineLength, 0)
 	defer closeScanner() // handles closing the underlying fileHandle (and any associate subprocesses)
 	if err != nil {
 		return toReturn, err
@@ -61,17 +87,27 @@ func newIndexedFile(filePath string, targetDB string, targetCID int,
 	if header.ObjType != "" {
 		// TSV log files have the type in a header
 		broDataFactory = pt.NewBroDataFactory(header.ObjType)
+	} else if scanner.Err() == nil && isNfdumpHeader(scanner.Text()) {
+		// nfdump's CSV output starts with a line naming its columns
+		toReturn.SetNfdumpHeader(newNfdumpHeader(scanner.Text()))
+		broDataFactory = pt.NewBroDataFactory("netflow")
 	} else if scanner.Err() == nil && len(scanner.Bytes()) > 0 && // no error and there is text
 		json.Valid(scanner.Bytes()) {
 		toReturn.SetJSON()
 		// check if "_path" is provided in the JSON data
 		// https://github.com/corelight/json-streaming-logs
 		t := struct {
-			Path string `json:"_path"`
+			Path      string `json:"_path"`
+			EventType string `json:"event_type"`
 		}{}
 		json.Unmarshal(scanner.Bytes(), &t)
 		broDataFactory = pt.NewBroDataFactory(t.Path)
 
+		// Suricata's EVE logs hold every type of event in a single log
+		if broDataFactory == nil && t.EventType != "" {
+			broDataFactory = pt.NewBroDataFactory("eve")
+		}
+
 		// otherwise JSON log files only have the type in the filename
 		if broDataFactory == nil {
 			broDataFactory = pt.NewBroDataFactory(filepath.Base(toReturn.Path))
@@ -83,21 +119,35 @@ func newIndexedFile(filePath string, targetDB string, targetCID int,
 	toReturn.SetBroDataFactory(broDataFactory)
 
 	var fieldMap ZeekHeaderIndexMap
-	// there is no need for the fieldMap with JSON
-	if !toReturn.IsJSON() {
-		fieldMap, err = mapZeekHeaderToParseType(header, broDataFactory, logger)
+	// there is no need for the fieldMap with JSON or nfdump's CSV output
+	if !toReturn.IsJSON() && !toReturn.IsNfdumpCSV() {
+		typeOverrides := conf.S.Parsing.TypeOverrides[header.ObjType]
+		mappedHeader, err := selectTimestampField(header, conf.S.Parsing.TimestampFields[header.ObjType], logger)
+		if err != nil {
+			return toReturn, err
+		}
+		fieldMap, err = mapZeekHeaderToParseType(mappedHeader, broDataFactory, typeOverrides, logger)
 		if err != nil {
 			return toReturn, err
 		}
 		toReturn.SetFieldMap(fieldMap)
+		logIgnoredFields(filePath, mappedHeader, fieldMap, logger)
 	}
 
-	//parse first line
+	//parse first line. Errors in its fields are counted when the file is parsed.
 	var line parsetypes.BroData
 	if toReturn.IsJSON() {
-		line = ParseJSONLine(scanner.Bytes(), broDataFactory, logger)
+		line, _ = ParseJSONLine(scanner.Bytes(), broDataFactory, logger)
+		// the target collection doesn't depend on the contents of the line, so a
+		// malformed first line doesn't keep the rest of the file from being imported
+		if line == nil {
+			line = broDataFactory()
+		}
+	} else if toReturn.IsNfdumpCSV() {
+		// the first line only holds the column names
+		line = broDataFactory()
 	} else {
-		line = ParseTSVLine(scanner.Text(), header, fieldMap, broDataFactory, logger)
+		line, _ = ParseTSVLine(scanner.Text(), header, fieldMap, broDataFactory, logger)
 	}
 
 	if line == nil {
@@ -112,24 +162,25 @@ func newIndexedFile(filePath string, targetDB string, targetCID int,
 	toReturn.TargetDatabase = targetDB
 	toReturn.CID = targetCID
 
+	if pipe != nil {
+		toReturn.Hash, err = getFileHash(bytes.NewReader(pipe.recorded.Bytes()))
+		if err != nil {
+			return toReturn, err
+		}
+		pipe.rewind()
+		toReturn.pipe = pipe
+	}
+
 	return toReturn, nil
 }
 
 //getFileHash md5's the first 15000 bytes of a file
-func getFileHash(fileHandle *os.File, fInfo os.FileInfo) (string, error) {
+func getFileHash(fileHandle io.Reader) (string, error) {
 	hash := md5.New()
 
-	if fInfo.Size() >= 15000 {
-		if _, err := io.CopyN(hash, fileHandle, 15000); err != nil {
-			return "", err
-		}
-	} else {
-		if _, err := io.Copy(hash, fileHandle); err != nil {
-			return "", err
-		}
+	if _, err := io.Copy(hash, io.LimitReader(fileHandle, 15000)); err != nil {
+		return "", err
 	}
-	//be nice and reset the file handle
-	fileHandle.Seek(0, 0)
 	var byteset []byte
 	return fmt.Sprintf("%x", hash.Sum(byteset)), nil
 }
@@ -182,5 +233,30 @@ func IndexFiles(files []string, indexingThreads int, targetDB string, targetCID
 		fmt.Println("\t[-] Exiting...")
 		os.Exit(0)
 	}
+
+	warnDuplicateContents(indexedFiles, logger)
 	return indexedFiles
 }
+
+//warnDuplicateContents warns about files with different names which have the same
+//size and hash since their connections would be counted twice
+func warnDuplicateContents(indexedFiles []*IndexedFile, logger *log.Logger) {
+	type contentKey struct {
+		length int64
+		hash   string
+	}
+	seen := make(map[contentKey]string)
+
+	for _, file := range indexedFiles {
+		key := contentKey{length: file.Length, hash: file.Hash}
+		if original, ok := seen[key]; ok {
+			logger.WithFields(log.Fields{
+				"path":      file.Path,
+				"duplicate": original,
+			}).Warn("File appears to be a copy of another file being imported")
+			fmt.Printf("\t[!] %s appears to be a copy of %s\n", file.Path, original)
+			continue
+		}
+		seen[key] = file.Path
+	}
+}
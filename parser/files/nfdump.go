@@ -0,0 +1,193 @@
+package files
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/activecm/rita/metrics"
+	pt "github.com/activecm/rita/parser/parsetypes"
+	log "github.com/sirupsen/logrus"
+)
+
+//nfdumpHeaderPrefix starts the header line of nfdump's CSV output (nfdump -o csv)
+const nfdumpHeaderPrefix = "ts,te,td,sa,da,sp,dp,pr,"
+
+//nfdumpTimeLayout is the layout of the timestamps in nfdump's CSV output. nfdump
+//writes the timestamps in the local time zone, with or without milliseconds.
+const nfdumpTimeLayout = "2006-01-02 15:04:05.999"
+
+//NfdumpHeader maps the columns of nfdump's CSV output to their indexes. The start
+//time is always held in the first column.
+type NfdumpHeader struct {
+	fields int // number of columns
+	te     int // end time
+	td     int // duration in seconds
+	sa     int // source address
+	da     int // destination address
+	sp     int // source port
+	dp     int // destination port, ICMP flows hold the type and code instead
+	pr     int // protocol
+	ipkt   int // packets from the source
+	ibyt   int // bytes from the source
+	opkt   int // packets from the destination of bidirectional flows
+	obyt   int // bytes from the destination of bidirectional flows
+}
+
+//isNfdumpHeader checks whether a line is the header line of nfdump's CSV output
+func isNfdumpHeader(line string) bool {
+	return strings.HasPrefix(line, nfdumpHeaderPrefix)
+}
+
+//newNfdumpHeader maps the columns in the header line of nfdump's CSV output.
+//Columns which are missing are mapped to -1.
+func newNfdumpHeader(line string) *NfdumpHeader {
+	names := strings.Split(line, ",")
+	index := func(name string) int {
+		for i := range names {
+			if names[i] == name {
+				return i
+			}
+		}
+		return -1
+	}
+
+	return &NfdumpHeader{
+		fields: len(names),
+		te:     index("te"),
+		td:     index("td"),
+		sa:     index("sa"),
+		da:     index("da"),
+		sp:     index("sp"),
+		dp:     index("dp"),
+		pr:     index("pr"),
+		ipkt:   index("ipkt"),
+		ibyt:   index("ibyt"),
+		opkt:   index("opkt"),
+		obyt:   index("obyt"),
+	}
+}
+
+//ParseNfdumpCSVLine creates a new NetFlow from a line of nfdump's CSV output. The
+//header line and the summary nfdump writes after the flows are skipped by returning
+//a nil BroData and error. An error is returned alongside the BroData if any of the
+//flow's fields could not be parsed.
+func ParseNfdumpCSVLine(lineString string, header *NfdumpHeader, broDataFactory func() pt.BroData,
+	logger *log.Logger) (pt.BroData, error) {
+
+	if lineString == "" || isNfdumpHeader(lineString) {
+		return nil, nil
+	}
+
+	fields := strings.Split(lineString, ",")
+	for i := range fields {
+		fields[i] = strings.TrimSpace(fields[i])
+	}
+
+	start, startErr := parseNfdumpTime(fields[0])
+	if len(fields) != header.fields {
+		// the summary is the only text which doesn't start with a timestamp
+		if startErr != nil {
+			return nil, nil
+		}
+		err := fmt.Errorf("line has %d fields but the header has %d", len(fields), header.fields)
+		logNfdumpError(logger, err, lineString)
+		return nil, err
+	}
+
+	dat := broDataFactory()
+	flow, ok := dat.(*pt.NetFlow)
+	if !ok {
+		return nil, fmt.Errorf("cannot parse nfdump flows into %T", dat)
+	}
+
+	var lineErr error
+	check := func(err error, value string) {
+		if err != nil {
+			logNfdumpError(logger, err, value)
+			if lineErr == nil {
+				lineErr = err
+			}
+		}
+	}
+
+	check(startErr, fields[0])
+	flow.TimeStamp = start.Unix()
+
+	// flows lacking an end time or a duration are left with zero values
+	if header.te >= 0 {
+		if end, err := parseNfdumpTime(fields[header.te]); err == nil && end.After(start) {
+			flow.EndTimeStamp = end.Unix()
+		}
+	}
+	if header.td >= 0 {
+		if duration, err := strconv.ParseFloat(fields[header.td], 64); err == nil && duration > 0 {
+			flow.Duration = duration
+		}
+	}
+
+	flow.Source = nfdumpField(fields, header.sa)
+	flow.Destination = nfdumpField(fields, header.da)
+	flow.Proto = nfdumpField(fields, header.pr)
+
+	var err error
+	flow.SourcePort, err = parseNfdumpPort(nfdumpField(fields, header.sp))
+	check(err, nfdumpField(fields, header.sp))
+	flow.DestinationPort, err = parseNfdumpPort(nfdumpField(fields, header.dp))
+	check(err, nfdumpField(fields, header.dp))
+
+	flow.InPkts, err = parseNfdumpCount(nfdumpField(fields, header.ipkt))
+	check(err, nfdumpField(fields, header.ipkt))
+	flow.InBytes, err = parseNfdumpCount(nfdumpField(fields, header.ibyt))
+	check(err, nfdumpField(fields, header.ibyt))
+	flow.OutPkts, err = parseNfdumpCount(nfdumpField(fields, header.opkt))
+	check(err, nfdumpField(fields, header.opkt))
+	flow.OutBytes, err = parseNfdumpCount(nfdumpField(fields, header.obyt))
+	check(err, nfdumpField(fields, header.obyt))
+
+	return dat, lineErr
+}
+
+//nfdumpField returns the value of a column, or an empty string if the column is missing
+func nfdumpField(fields []string, index int) string {
+	if index < 0 {
+		return ""
+	}
+	return fields[index]
+}
+
+//parseNfdumpTime parses a timestamp from nfdump's CSV output
+func parseNfdumpTime(value string) (time.Time, error) {
+	return time.ParseInLocation(nfdumpTimeLayout, value, time.Local)
+}
+
+//parseNfdumpPort parses a port from nfdump's CSV output. ICMP flows hold the type
+//and code in the destination port as type.code, only the type is kept.
+func parseNfdumpPort(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	if dot := strings.Index(value, "."); dot != -1 {
+		value = value[:dot]
+	}
+	return strconv.Atoi(value)
+}
+
+//parseNfdumpCount parses a packet or byte count from nfdump's CSV output.
+//Missing counts are 0.
+func parseNfdumpCount(value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
+
+//logNfdumpError logs a value of nfdump's CSV output which could not be parsed
+func logNfdumpError(logger *log.Logger, err error, value string) {
+	logger.WithFields(log.Fields{
+		"error": err.Error(),
+		"value": value,
+	}).Error("Couldn't parse nfdump flow")
+	metrics.ParseErrors.Inc()
+}
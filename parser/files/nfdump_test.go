@@ -0,0 +1,121 @@
+package files
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/activecm/rita/config"
+	pt "github.com/activecm/rita/parser/parsetypes"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+//testNfdumpHeader is the header of nfdump's CSV output
+const testNfdumpHeader = "ts,te,td,sa,da,sp,dp,pr,flg,fwd,stos,ipkt,ibyt,opkt,obyt,in,out,sas,das,smk,dmk," +
+	"dtos,dir,nh,nhb,svln,dvln,ismc,odmc,idmc,osmc,mpls1,mpls2,mpls3,mpls4,mpls5,mpls6,mpls7,mpls8,mpls9," +
+	"mpls10,cl,sl,al,ra,eng,exid,tr"
+
+//testNfdumpFlow formats a flow like nfdump's CSV output
+func testNfdumpFlow(ts, te, td, sa, da, sp, dp, pr, ipkt, ibyt string) string {
+	return strings.Join([]string{ts, te, td, sa, da, sp, dp, pr, ".AP.SF", "0", "0", ipkt, ibyt, "0", "0",
+		"1", "2", "0", "0", "0", "0", "0", "0", "0.0.0.0", "0.0.0.0", "0", "0",
+		"00:00:00:00:00:00", "00:00:00:00:00:00", "00:00:00:00:00:00", "00:00:00:00:00:00",
+		"0-0-0", "0-0-0", "0-0-0", "0-0-0", "0-0-0", "0-0-0", "0-0-0", "0-0-0", "0-0-0", "0-0-0",
+		"0.000", "0.000", "0.000", "127.0.0.1", "0/0", "1", "2018-01-30 18:14:05.000"}, ",")
+}
+
+//testNfdumpCSV holds the output of nfdump -o csv for an nfcapd file holding a TCP flow,
+//a flow lacking an end time, and an ICMP flow, followed by nfdump's summary
+var testNfdumpCSV = strings.Join([]string{
+	testNfdumpHeader,
+	testNfdumpFlow("2018-01-30 18:14:02.090", "2018-01-30 18:14:04.590", "2.500",
+		"10.0.0.1", "93.184.216.34", "53542", "80", "TCP", "6", "520"),
+	testNfdumpFlow("2018-01-30 18:15:02", "1970-01-01 00:00:00", "0.000",
+		"10.0.0.1", "93.184.216.34", "53543", "80", "TCP", "1", "60"),
+	testNfdumpFlow("2018-01-30 18:16:02.000", "2018-01-30 18:16:03.000", "1.000",
+		"10.0.0.1", "8.8.8.8", "0", "8.0", "ICMP", "1", "84"),
+	"Summary",
+	"flows,bytes,packets,avg_bps,avg_pps,avg_bpp",
+	"3,664,8,0,0,83",
+}, "\n") + "\n"
+
+//testNfdumpTime converts a time printed by nfdump to a Unix timestamp
+func testNfdumpTime(t *testing.T, value string) int64 {
+	ts, err := time.ParseInLocation("2006-01-02 15:04:05", value, time.Local)
+	require.Nil(t, err)
+	return ts.Unix()
+}
+
+func TestParseNfdumpCSV(t *testing.T) {
+	header := newNfdumpHeader(testNfdumpHeader)
+	factory := pt.NewBroDataFactory("netflow")
+
+	var conns []*pt.Conn
+	for _, line := range strings.Split(strings.TrimSpace(testNfdumpCSV), "\n") {
+		entry, err := ParseNfdumpCSVLine(line, header, factory, log.New())
+		require.Nil(t, err, line)
+		// the header and the summary don't produce records
+		if entry != nil {
+			conns = append(conns, entry.(pt.RecordConverter).Record().(*pt.Conn))
+		}
+	}
+	require.Len(t, conns, 3)
+
+	// the start of the flow is kept as the connection's timestamp
+	require.Equal(t, testNfdumpTime(t, "2018-01-30 18:14:02"), conns[0].TimeStamp)
+	require.Equal(t, 2.5, conns[0].Duration)
+	require.Equal(t, "10.0.0.1", conns[0].Source)
+	require.Equal(t, 53542, conns[0].SourcePort)
+	require.Equal(t, "93.184.216.34", conns[0].Destination)
+	require.Equal(t, 80, conns[0].DestinationPort)
+	require.Equal(t, "tcp", conns[0].Proto)
+	require.Equal(t, int64(6), conns[0].OrigPkts)
+	require.Equal(t, int64(520), conns[0].OrigIPBytes)
+	require.Equal(t, int64(520), conns[0].OrigBytes)
+	require.Equal(t, int64(0), conns[0].RespIPBytes)
+	require.NotEmpty(t, conns[0].UID)
+
+	// flows lacking an end time are given a duration of 0
+	require.Equal(t, testNfdumpTime(t, "2018-01-30 18:15:02"), conns[1].TimeStamp)
+	require.Equal(t, 0.0, conns[1].Duration)
+	require.NotEqual(t, conns[0].UID, conns[1].UID)
+
+	// only the ICMP type is kept from the destination port
+	require.Equal(t, "icmp", conns[2].Proto)
+	require.Equal(t, 8, conns[2].DestinationPort)
+}
+
+func TestParseNfdumpCSVErrors(t *testing.T) {
+	header := newNfdumpHeader(testNfdumpHeader)
+	factory := pt.NewBroDataFactory("netflow")
+
+	// a flow with the wrong number of fields is an error rather than part of the summary
+	_, err := ParseNfdumpCSVLine("2018-01-30 18:14:02,2018-01-30 18:14:04,2.500", header, factory, log.New())
+	require.NotNil(t, err)
+
+	// a flow with an unparsable count is returned along with the error
+	line := testNfdumpFlow("2018-01-30 18:14:02", "2018-01-30 18:14:04", "2.000",
+		"10.0.0.1", "93.184.216.34", "53542", "80", "TCP", "6", "1.2 M")
+	entry, err := ParseNfdumpCSVLine(line, header, factory, log.New())
+	require.NotNil(t, err)
+	require.Equal(t, "10.0.0.1", entry.(*pt.NetFlow).Source)
+}
+
+func TestIndexFilesNfdump(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nfdump")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	nfdumpPath, _ := writeTestLog(t, dir, "nfcapd.201801301800.csv", testNfdumpCSV)
+
+	conf, err := config.LoadTestingConfig("")
+	require.Nil(t, err)
+	indexed := IndexFiles([]string{nfdumpPath}, 1, "test", 0, log.New(), conf)
+	require.Len(t, indexed, 1)
+	require.True(t, indexed[0].IsNfdumpCSV())
+	require.Equal(t, conf.T.Structure.ConnTable, indexed[0].TargetCollection)
+	require.IsType(t, &pt.NetFlow{}, indexed[0].GetBroDataFactory()())
+}
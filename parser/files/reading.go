@@ -9,42 +9,106 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"os"
 	"os/exec"
 	"path"
+	"path/filepath"
 	"reflect"
 	"strconv"
 	"strings"
-	"time"
+	"sync"
+	"sync/atomic"
 
+	"github.com/activecm/rita/metrics"
 	pt "github.com/activecm/rita/parser/parsetypes"
 	"github.com/activecm/rita/util"
 
 	jsoniter "github.com/json-iterator/go"
+	"github.com/klauspost/pgzip"
 	log "github.com/sirupsen/logrus"
 )
 
-// GatherLogFiles reads the files and directories looking for log and gz files
-func GatherLogFiles(paths []string, logger *log.Logger) []string {
+const (
+	//initialLineBufferSize is the size of the buffer each scanner starts with
+	initialLineBufferSize = 64 * 1024
+	//defaultMaxLineLength is the longest line a scanner reads if none is configured
+	defaultMaxLineLength = 1024 * 1024
+)
+
+// GatherLogFiles reads the files and directories looking for log and gz files.
+// Named pipes (FIFOs) are gathered when they are listed explicitly, regardless of
+// their name. Named pipes inside of directories are ignored.
+// Paths of the form s3://bucket/prefix gather the log files in the bucket under the prefix.
+// Glob patterns such as conn.*.log.gz or logs/**/conn.*.log are expanded first.
+// Files which have been completely ingested according to their checkpoints are skipped.
+func GatherLogFiles(paths []string, checkpoints map[string]Checkpoint, logger *log.Logger) []string {
 	var toReturn []string
 
-	for _, path := range paths {
-		if util.IsDir(path) {
-			toReturn = append(toReturn, gatherDir(path, logger)...)
-		} else if strings.HasSuffix(path, ".gz") ||
-			strings.HasSuffix(path, ".log") {
+	for _, path := range expandGlobs(paths, logger) {
+		if IsS3Path(path) || util.IsDir(path) {
+			toReturn = append(toReturn, sourceFor(path).List(path, logger)...)
+		} else if isLogFile(path) || isNamedPipePath(path) {
+			// named pipes are only read when they are listed explicitly
 			toReturn = append(toReturn, path)
 		} else {
 			logger.WithFields(log.Fields{
 				"path": path,
-			}).Warn("Ignoring non .log or .gz file")
+			}).Warn("Ignoring non .log, .json, .csv, or .gz file")
 		}
 	}
 
+	toReturn = dedupePaths(toReturn, logger)
+	return skipCompletedFiles(toReturn, checkpoints, logger)
+}
+
+// LimitLogFiles returns the first maxFiles of the gathered log files. A warning is logged
+// if any files are left out. A maxFiles of 0 returns every file.
+func LimitLogFiles(paths []string, maxFiles int, logger *log.Logger) []string {
+	if maxFiles <= 0 || len(paths) <= maxFiles {
+		return paths
+	}
+
+	logger.WithFields(log.Fields{
+		"gathered":  len(paths),
+		"max_files": maxFiles,
+		"skipped":   paths[maxFiles:],
+	}).Warn("Truncated the list of log files to the file limit")
+	return paths[:maxFiles]
+}
+
+// dedupePaths removes paths which refer to the same file as an earlier path
+// once they are made absolute and any symlinks are resolved
+func dedupePaths(paths []string, logger *log.Logger) []string {
+	var toReturn []string
+	seen := make(map[string]string)
+
+	for _, path := range paths {
+		canonical := path
+		if !IsS3Path(path) {
+			if abs, err := filepath.Abs(path); err == nil {
+				canonical = abs
+			}
+			if resolved, err := filepath.EvalSymlinks(canonical); err == nil {
+				canonical = resolved
+			}
+		}
+
+		if original, ok := seen[canonical]; ok {
+			logger.WithFields(log.Fields{
+				"path":      path,
+				"duplicate": original,
+			}).Info("Ignoring file which was already gathered from another path")
+			continue
+		}
+		seen[canonical] = path
+		toReturn = append(toReturn, path)
+	}
 	return toReturn
 }
 
-// gatherDir reads the directory looking for log and .gz files
+// gatherDir reads the directory looking for .log, .json, .csv, and .gz files. Named pipes are
+// skipped since reading from them would block until a writer opens them.
 func gatherDir(cpath string, logger *log.Logger) []string {
 	var toReturn []string
 	files, err := ioutil.ReadDir(cpath)
@@ -62,8 +126,10 @@ func gatherDir(cpath string, logger *log.Logger) []string {
 		// if file.IsDir() && file.Mode() != os.ModeSymlink {
 		// 	toReturn = append(toReturn, readDir(path.Join(cpath, file.Name()), logger)...)
 		// }
-		if !file.IsDir() && strings.HasSuffix(file.Name(), ".gz") ||
-			strings.HasSuffix(file.Name(), ".log") {
+		if file.Mode()&os.ModeNamedPipe != 0 {
+			continue
+		}
+		if !file.IsDir() && isLogFile(file.Name()) {
 			toReturn = append(toReturn, path.Join(cpath, file.Name()))
 		}
 	}
@@ -72,19 +138,31 @@ func gatherDir(cpath string, logger *log.Logger) []string {
 
 // GetFileScanner returns a buffered file scanner for a bro log file, a function to close the
 // underlying stream and any associated processors, as well as any error that may occur while
-// creating the scanner
-func GetFileScanner(fileHandle *os.File) (scanner *bufio.Scanner, closer func() error, err error) {
+// creating the scanner. The scanner fails on lines longer than maxLineLength bytes. Gzipped
+// files of at least parallelGzipMinSize bytes are decompressed in parallel. A value of 0
+// disables parallel decompression.
+func GetFileScanner(fileHandle LogFile, maxLineLength int, parallelGzipMinSize int64) (scanner *bufio.Scanner, closer func() error, err error) {
 	// by default just close out the underlying file handle
 	closer = fileHandle.Close
 
-	ftype := fileHandle.Name()[len(fileHandle.Name())-3:]
-	if ftype != ".gz" && ftype != "log" {
-		return nil, closer, errors.New("filetype not recognized")
+	// named pipes are read as uncompressed logs regardless of their name. Otherwise the
+	// file must have one of the extensions GatherLogFiles looks for. The extensions are
+	// case sensitive, so foo.LOG is rejected here just as it is skipped when gathered.
+	compressed := false
+	if fInfo, err := fileHandle.Stat(); err != nil || !isNamedPipe(fInfo) {
+		if !isLogFile(fileHandle.Name()) {
+			return nil, closer, errors.New("filetype not recognized")
+		}
+		compressed = strings.HasSuffix(fileHandle.Name(), ".gz")
 	}
 
-	if ftype == ".gz" {
+	if compressed {
 		var gzipReader io.Reader
-		gzipReader, closer, err = newGzipReader(fileHandle)
+		if useParallelGzip(fileHandle, parallelGzipMinSize) {
+			gzipReader, closer, err = newParallelGzipReader(fileHandle)
+		} else {
+			gzipReader, closer, err = newGzipReader(fileHandle)
+		}
 		if err != nil {
 			return nil, closer, err
 		}
@@ -93,7 +171,14 @@ func GetFileScanner(fileHandle *os.File) (scanner *bufio.Scanner, closer func()
 		scanner = bufio.NewScanner(fileHandle)
 	}
 
-	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	if maxLineLength <= 0 {
+		maxLineLength = defaultMaxLineLength
+	}
+	initialSize := initialLineBufferSize
+	if maxLineLength < initialSize {
+		initialSize = maxLineLength
+	}
+	scanner.Buffer(make([]byte, 0, initialSize), maxLineLength)
 	return scanner, closer, nil
 }
 
@@ -170,6 +255,37 @@ func newGzipReader(fileHandle io.ReadCloser) (reader io.Reader, closer func() er
 	return pipeR, closer, nil
 }
 
+//useParallelGzip returns whether a gzipped file is large enough to be decompressed in parallel
+func useParallelGzip(fileHandle LogFile, parallelGzipMinSize int64) bool {
+	if parallelGzipMinSize <= 0 {
+		return false
+	}
+	fInfo, err := fileHandle.Stat()
+	return err == nil && fInfo.Size() >= parallelGzipMinSize
+}
+
+//newParallelGzipReader returns an un-gzipped byte stream given a gzip compressed byte stream.
+//The stream is split into blocks which are decompressed ahead of the reader on separate
+//goroutines, which keeps more than one core busy on large files. Returns stream to read
+//from, a function to close the stream and the underlying file, and any err that may
+//occur when opening the stream.
+func newParallelGzipReader(fileHandle io.ReadCloser) (reader io.Reader, closer func() error, err error) {
+	gzipReader, err := pgzip.NewReader(fileHandle)
+	if err != nil {
+		return nil, fileHandle.Close, err
+	}
+
+	closer = func() error {
+		errGzip := gzipReader.Close()
+		errFile := fileHandle.Close()
+		if errGzip != nil {
+			return errGzip
+		}
+		return errFile
+	}
+	return gzipReader, closer, nil
+}
+
 // scanHeader scans the comment lines out of a bro file and returns a
 // BroHeader object containing the information. NOTE: This has the side
 // effect of advancing the fileScanner so that fileScanner.Text() will
@@ -186,6 +302,10 @@ func scanTSVHeader(fileScanner *bufio.Scanner) (*BroHeader, error) {
 		//On the comment lines
 		if fileScanner.Bytes()[0] == '#' {
 			line := strings.Fields(fileScanner.Text())
+			// skip header lines which are missing their values
+			if len(line) < 2 {
+				continue
+			}
 			switch line[0][1:] {
 			case "separator":
 				var err error
@@ -194,7 +314,12 @@ func scanTSVHeader(fileScanner *bufio.Scanner) (*BroHeader, error) {
 					return toReturn, err
 				}
 			case "set_separator":
-				toReturn.SetSep = line[1]
+				// the set separator may be escaped like the field separator
+				setSep, err := strconv.Unquote("\"" + line[1] + "\"")
+				if err != nil {
+					setSep = line[1]
+				}
+				toReturn.SetSep = setSep
 			case "empty_field":
 				toReturn.Empty = line[1]
 			case "unset_field":
@@ -218,25 +343,54 @@ func scanTSVHeader(fileScanner *bufio.Scanner) (*BroHeader, error) {
 	return toReturn, nil
 }
 
-func mapZeekHeaderToParseType(header *BroHeader, broDataFactory func() pt.BroData, logger *log.Logger) (ZeekHeaderIndexMap, error) {
-	broData := broDataFactory()
-	structType := reflect.TypeOf(broData).Elem()
+type (
+	//parseTypeFieldInfo records the Zeek type and struct offset of a parse type field
+	parseTypeFieldInfo struct {
+		zeekType             string
+		parseTypeFieldOffset int
+	}
 
-	indexMap := ZeekHeaderIndexMap{
-		NthLogFieldExistsInParseType: make([]bool, len(header.Names)),
-		NthLogFieldParseTypeOffset:   make([]int, len(header.Names)),
+	//parseTypeInfo records the Zeek fields a parse type is populated with
+	parseTypeInfo struct {
+		// fields maps from Zeek field names to the associated info as defined by the
+		// broData struct tags. Recording this info in a map allows us to match the
+		// Zeek header to the parse type fields without nested loops.
+		fields map[string]parseTypeFieldInfo
+		// nanosFields maps from Zeek time field names to the offsets of the broData fields which
+		// hold the same timestamps in nanoseconds (tagged with brounit:"ns")
+		nanosFields map[string]int
 	}
 
-	// parseTypeFieldInfo and the parseTypeFields map record the names, types, and offsets of the
-	// Zeek fields we want to populate the broData with. Recording this info in a map allows
-	// us to match the Zeek header to the parse type fields without nested loops.
-	type parseTypeFieldInfo struct {
-		zeekType             string
-		parseTypeFieldOffset int
+	//headerIndexMapKey identifies the headers which map to a parse type the same way
+	headerIndexMapKey struct {
+		structType reflect.Type
+		names      string
+		types      string
+		overrides  string
+	}
+)
+
+var (
+	//parseTypeCache holds the *parseTypeInfo of each parse type keyed by its reflect.Type
+	parseTypeCache sync.Map
+	//headerIndexMapCache holds the ZeekHeaderIndexMap of each header keyed by headerIndexMapKey
+	headerIndexMapCache sync.Map
+	//parseTypeReflections counts how many times a parse type's struct tags were read
+	parseTypeReflections uint64
+)
+
+//getParseTypeInfo reads the Zeek fields from the struct tags of a parse type. The result is
+//cached since the struct tags never change.
+func getParseTypeInfo(structType reflect.Type) (*parseTypeInfo, error) {
+	if cached, ok := parseTypeCache.Load(structType); ok {
+		return cached.(*parseTypeInfo), nil
+	}
+	atomic.AddUint64(&parseTypeReflections, 1)
+
+	info := &parseTypeInfo{
+		fields:      make(map[string]parseTypeFieldInfo),
+		nanosFields: make(map[string]int),
 	}
-	// parseTypeFields maps from Zeek field names to the associated info as defined by the
-	// broData struct tags
-	parseTypeFields := make(map[string]parseTypeFieldInfo)
 
 	// walk the fields of the broData, making sure the broData struct has
 	// an equal number of named bro fields and bro types
@@ -251,95 +405,286 @@ func mapZeekHeaderToParseType(header *BroHeader, broDataFactory func() pt.BroDat
 		}
 
 		if len(zeekName) == 0 || len(zeekType) == 0 {
-			return indexMap, errors.New("incomplete bro variable")
+			return nil, errors.New("incomplete bro variable")
 		}
 
-		parseTypeFields[zeekName] = parseTypeFieldInfo{
+		if structField.Tag.Get("brounit") == "ns" {
+			if zeekType != pt.Time {
+				return nil, errors.New("nanosecond unit on non-time bro variable")
+			}
+			info.nanosFields[zeekName] = i
+			continue
+		}
+
+		info.fields[zeekName] = parseTypeFieldInfo{
 			zeekType:             zeekType,
 			parseTypeFieldOffset: i,
 		}
 	}
 
+	parseTypeCache.Store(structType, info)
+	return info, nil
+}
+
+//mapZeekHeaderToParseType maps the fields of a Zeek header to the fields of the parse type
+//created by broDataFactory. Many log files share the same header, so the mapping is cached
+//for each distinct header and parse type. Ignored fields are summarized once per file by
+//logIgnoredFields. A field whose type differs from its parse type field is rejected unless
+//typeOverrides maps the field's name to the type found in the log, in which case the field
+//is coerced into the parse type field's type. The type names logged by older versions of Bro
+//are treated as their current equivalents.
+func mapZeekHeaderToParseType(header *BroHeader, broDataFactory func() pt.BroData,
+	typeOverrides map[string]string, logger *log.Logger) (ZeekHeaderIndexMap, error) {
+	broData := broDataFactory()
+	structType := reflect.TypeOf(broData).Elem()
+
+	cacheKey := headerIndexMapKey{
+		structType: structType,
+		names:      strings.Join(header.Names, "\x00"),
+		types:      strings.Join(header.Types, "\x00"),
+		overrides:  fmt.Sprint(typeOverrides),
+	}
+	if cached, ok := headerIndexMapCache.Load(cacheKey); ok {
+		return cached.(ZeekHeaderIndexMap), nil
+	}
+
+	indexMap := ZeekHeaderIndexMap{
+		NthLogFieldExistsInParseType: make([]bool, len(header.Names)),
+		NthLogFieldParseTypeOffset:   make([]int, len(header.Names)),
+		NthLogFieldNanosOffset:       make([]int, len(header.Names)),
+		NthLogFieldType:              make([]string, len(header.Names)),
+	}
+
+	typeInfo, err := getParseTypeInfo(structType)
+	if err != nil {
+		return indexMap, err
+	}
+
 	for index, name := range header.Names {
-		fieldInfo, ok := parseTypeFields[name]
+		fieldInfo, ok := typeInfo.fields[name]
 		if !ok {
 			//an unmatched field which exists in the log but not the struct
-			//is not a fatal error, so we report it and move on
-			logger.WithFields(log.Fields{
-				"error":         "unmatched field in log",
-				"missing_field": name,
-			}).Info("the log contains a field with no candidate in the data structure")
+			//is not a fatal error, it is reported along with the others by
+			//logIgnoredFields
 			continue
 		}
 
-		if header.Types[index] != fieldInfo.zeekType {
-			err := errors.New("type mismatch found in log")
+		// archives spanning upgrades of Zeek may contain logs from older versions of Bro
+		logType := pt.CanonicalType(header.Types[index])
+		override := pt.CanonicalType(typeOverrides[name])
+
+		indexMap.NthLogFieldType[index] = logType
+		if logType != fieldInfo.zeekType && override == logType {
+			// custom Zeek deployments may log a field with a compatible type
+			indexMap.NthLogFieldType[index] = fieldInfo.zeekType
+			// addresses are still validated when they are coerced into a list of strings
+			if logType == pt.AddrSet && isStringList(fieldInfo.zeekType) {
+				indexMap.NthLogFieldType[index] = pt.AddrSet
+			}
+		} else if logType != fieldInfo.zeekType {
+			err := fmt.Errorf("type mismatch found in log: field %s is logged as %s but %s is expected",
+				name, header.Types[index], fieldInfo.zeekType)
 			logger.WithFields(log.Fields{
 				"error":         err,
+				"field":         name,
 				"type_in_log":   header.Types[index],
 				"expected_type": fieldInfo.zeekType,
-			})
+			}).Error("the log contains a field with a type which doesn't match the data structure")
 			return indexMap, err
 		}
 
 		indexMap.NthLogFieldExistsInParseType[index] = true
 		indexMap.NthLogFieldParseTypeOffset[index] = fieldInfo.parseTypeFieldOffset
+
+		if offset, ok := typeInfo.nanosFields[name]; ok {
+			indexMap.NthLogFieldNanosOffset[index] = offset + 1
+		}
 	}
 
+	headerIndexMapCache.Store(cacheKey, indexMap)
 	return indexMap, nil
 }
 
-//ParseJSONLine creates a new BroData from a line of a Zeek JSON log.
+//ignoredFields returns the fields of the header which have no candidate in the parse type
+func ignoredFields(header *BroHeader, fieldMap ZeekHeaderIndexMap) []string {
+	var ignored []string
+	for index, name := range header.Names {
+		if !fieldMap.NthLogFieldExistsInParseType[index] {
+			ignored = append(ignored, name)
+		}
+	}
+	return ignored
+}
+
+//logIgnoredFields reports the fields of a log file which are ignored since they have no
+//candidate in the parse type. The fields are summarized in a single entry per file,
+//which makes it easy to spot the fields added by new versions of Zeek.
+func logIgnoredFields(path string, header *BroHeader, fieldMap ZeekHeaderIndexMap, logger *log.Logger) {
+	ignored := ignoredFields(header, fieldMap)
+	if len(ignored) == 0 {
+		return
+	}
+	logger.WithFields(log.Fields{
+		"path":           path,
+		"log_type":       header.ObjType,
+		"ignored_fields": ignored,
+		"ignored_count":  len(ignored),
+	}).Info("the log contains fields with no candidate in the data structure")
+}
+
+//isStringList returns true if fields of the given Zeek type are parsed into a list of strings
+func isStringList(zeekType string) bool {
+	return zeekType == pt.StringSet || zeekType == pt.EnumSet ||
+		zeekType == pt.StringVector || zeekType == pt.AddrSet
+}
+
+//selectTimestampField returns a copy of the header in which the given time field and the
+//ts field trade names, so the given field populates the timestamp of each record. The
+//header is returned as is if the field is empty or ts, or if the log doesn't contain the
+//field. Fields which aren't logged as times are rejected.
+func selectTimestampField(header *BroHeader, field string, logger *log.Logger) (*BroHeader, error) {
+	if field == "" || field == "ts" {
+		return header, nil
+	}
+
+	index := -1
+	for i, name := range header.Names {
+		if name == field {
+			index = i
+			break
+		}
+	}
+	if index == -1 {
+		logger.WithFields(log.Fields{
+			"field": field,
+			"path":  header.ObjType,
+		}).Warn("the log doesn't contain the configured timestamp field, so ts is used instead")
+		return header, nil
+	}
+
+	if header.Types[index] != "time" {
+		return header, fmt.Errorf("timestamp field %s is logged as %s but time is expected",
+			field, header.Types[index])
+	}
+
+	selected := *header
+	selected.Names = make([]string, len(header.Names))
+	for i, name := range header.Names {
+		switch {
+		case i == index:
+			selected.Names[i] = "ts"
+		case name == "ts":
+			selected.Names[i] = field
+		default:
+			selected.Names[i] = name
+		}
+	}
+	return &selected, nil
+}
+
+//jsonConfig decodes Zeek JSON logs the same way as the standard library, except numbers held
+//by interface{} fields, such as timestamps, keep their text. Timestamps are then parsed from
+//their text exactly as they are in TSV logs rather than through a lossy float64.
+var jsonConfig = jsoniter.Config{
+	EscapeHTML:             true,
+	SortMapKeys:            true,
+	ValidateJsonRawMessage: true,
+	UseNumber:              true,
+}.Froze()
+
+//ParseJSONLine creates a new BroData from a line of a Zeek JSON log. Lines which can't
+//be unmarshalled result in a nil BroData alongside the error, since the fields decoded
+//before the failure can't be trusted.
 func ParseJSONLine(lineBuffer []byte, broDataFactory func() pt.BroData,
-	logger *log.Logger) pt.BroData {
+	logger *log.Logger) (pt.BroData, error) {
 
 	dat := broDataFactory()
-	err := jsoniter.ConfigCompatibleWithStandardLibrary.Unmarshal(lineBuffer, dat)
+	err := jsonConfig.Unmarshal(lineBuffer, dat)
 	if err != nil {
 		logger.WithFields(log.Fields{
 			"error": err.Error(),
 		}).Error("Encountered unparsable JSON in log")
+		metrics.ParseErrors.Inc()
+		return nil, err
 	}
 	dat.ConvertFromJSON()
-	return dat
+	return dat, nil
+}
+
+//parseTSVTimeNanos parses a Zeek timestamp into nanoseconds since the epoch
+func parseTSVTimeNanos(fieldText string, targetField reflect.Value, logger *log.Logger) error {
+	nanos, err := pt.ParseTimestampNanos(fieldText)
+	if err != nil {
+		logger.WithFields(log.Fields{
+			"error": err.Error(),
+			"value": fieldText,
+		}).Error("Couldn't convert unix ts")
+		metrics.ParseErrors.Inc()
+		targetField.SetInt(-1)
+		return err
+	}
+
+	targetField.SetInt(nanos)
+	return nil
+}
+
+//splitSetField splits a Zeek set or vector field into its elements. Zeek writes the set
+//separator as a hex escape when it appears inside of an element, e.g. a DNS answer holding
+//a comma is logged as "a\x2cb" with the default separator, so splitting on the separator
+//never breaks an element apart. The escaped separators are restored once the field is split.
+//Other escape sequences are left as they are, the same as they are for string fields.
+func splitSetField(fieldText string, setSep string) []string {
+	tokens := strings.Split(fieldText, setSep)
+	if !strings.Contains(fieldText, `\x`) {
+		return tokens
+	}
+
+	// Zeek writes lowercase hex digits, but either case is accepted
+	var lower, upper strings.Builder
+	for i := 0; i < len(setSep); i++ {
+		fmt.Fprintf(&lower, `\x%02x`, setSep[i])
+		fmt.Fprintf(&upper, `\x%02X`, setSep[i])
+	}
+	unescaper := strings.NewReplacer(lower.String(), setSep, upper.String(), setSep)
+
+	for i, token := range tokens {
+		tokens[i] = unescaper.Replace(token)
+	}
+	return tokens
 }
 
-func parseTSVField(fieldText string, fieldType string, targetField reflect.Value, logger *log.Logger) {
+func parseTSVField(fieldText string, fieldType string, setSep string, targetField reflect.Value, logger *log.Logger) error {
+	// Zeek separates the elements of sets and vectors with a comma by default
+	if setSep == "" {
+		setSep = ","
+	}
+
 	switch fieldType {
 	case pt.Time:
 		decimalPointIdx := strings.Index(fieldText, ".")
 		if decimalPointIdx == -1 {
-			logger.WithFields(log.Fields{
-				"error": "no decimal point found in timestamp",
-				"value": fieldText,
-			}).Error("Couldn't convert unix ts")
-			targetField.SetInt(-1)
-			return
-		}
-
-		s, err := strconv.Atoi(fieldText[:decimalPointIdx])
-		if err != nil {
+			err := errors.New("no decimal point found in timestamp")
 			logger.WithFields(log.Fields{
 				"error": err.Error(),
 				"value": fieldText,
 			}).Error("Couldn't convert unix ts")
+			metrics.ParseErrors.Inc()
 			targetField.SetInt(-1)
-			return
+			return err
 		}
 
-		nanos, err := strconv.Atoi(fieldText[decimalPointIdx+1:])
+		// the seconds are kept consistent with the nanosecond timestamps and JSON logs
+		nanos, err := pt.ParseTimestampNanos(fieldText)
 		if err != nil {
 			logger.WithFields(log.Fields{
 				"error": err.Error(),
 				"value": fieldText,
 			}).Error("Couldn't convert unix ts")
+			metrics.ParseErrors.Inc()
 			targetField.SetInt(-1)
-			return
+			return err
 		}
-
-		ttim := time.Unix(int64(s), int64(nanos))
-		tval := ttim.Unix()
-		targetField.SetInt(tval)
+		targetField.SetInt(pt.TimestampSeconds(nanos))
 	case pt.String:
 		fallthrough
 	case pt.Enum:
@@ -348,6 +693,8 @@ func parseTSVField(fieldText string, fieldType string, targetField reflect.Value
 		targetField.SetString(fieldText)
 	case pt.Port:
 		fallthrough
+	case pt.Int:
+		fallthrough
 	case pt.Count:
 		intValue, err := strconv.Atoi(fieldText)
 		if err != nil {
@@ -355,8 +702,9 @@ func parseTSVField(fieldText string, fieldType string, targetField reflect.Value
 				"error": err.Error(),
 				"value": fieldText,
 			}).Error("Couldn't convert port number/ count")
+			metrics.ParseErrors.Inc()
 			targetField.SetInt(-1)
-			return
+			return err
 		}
 		targetField.SetInt(int64(intValue))
 	case pt.Interval:
@@ -367,7 +715,7 @@ func parseTSVField(fieldText string, fieldType string, targetField reflect.Value
 				"value": fieldText,
 			}).Error("Couldn't convert float")
 			targetField.SetFloat(-1.0)
-			return
+			return err
 		}
 		targetField.SetFloat(flt)
 	case pt.Bool:
@@ -381,11 +729,29 @@ func parseTSVField(fieldText string, fieldType string, targetField reflect.Value
 	case pt.EnumSet:
 		fallthrough
 	case pt.StringVector:
-		tokens := strings.Split(fieldText, ",")
+		tokens := splitSetField(fieldText, setSep)
 		tVal := reflect.ValueOf(tokens)
 		targetField.Set(tVal)
+	case pt.AddrSet:
+		tokens := splitSetField(fieldText, setSep)
+		addrs := make([]string, 0, len(tokens))
+		for _, val := range tokens {
+			ip := net.ParseIP(val)
+			if ip == nil {
+				// a malformed address doesn't spoil the rest of the set
+				logger.WithFields(log.Fields{
+					"error": "invalid IP address",
+					"value": val,
+				}).Warn("Dropping malformed address from set")
+				metrics.ParseErrors.Inc()
+				continue
+			}
+			addrs = append(addrs, ip.String())
+		}
+		aVal := reflect.ValueOf(addrs)
+		targetField.Set(aVal)
 	case pt.IntervalVector:
-		tokens := strings.Split(fieldText, ",")
+		tokens := splitSetField(fieldText, setSep)
 		floats := make([]float64, len(tokens))
 		for i, val := range tokens {
 			var err error
@@ -395,7 +761,7 @@ func parseTSVField(fieldText string, fieldType string, targetField reflect.Value
 					"error": err.Error(),
 					"value": val,
 				}).Error("Couldn't convert float")
-				return
+				return err
 			}
 		}
 		fVal := reflect.ValueOf(floats)
@@ -405,22 +771,41 @@ func parseTSVField(fieldText string, fieldType string, targetField reflect.Value
 			"error": "Unhandled type",
 			"value": fieldType,
 		}).Error("Encountered unhandled type in log")
+		return fmt.Errorf("unhandled type %s", fieldType)
+	}
+	return nil
+}
+
+//CheckTSVFieldCount returns an error if a line of a Zeek TSV log does not have
+//the same number of fields as the log's header. Comment lines are not checked.
+func CheckTSVFieldCount(lineString string, header *BroHeader) error {
+	if strings.HasPrefix(lineString, "#") {
+		return nil
+	}
+
+	fieldCount := strings.Count(lineString, header.Separator) + 1
+	if fieldCount != len(header.Names) {
+		return fmt.Errorf("line has %d fields but the header has %d", fieldCount, len(header.Names))
 	}
+	return nil
 }
 
-//ParseTSVLine creates a new BroData from a line of a Zeek TSV log.
+//ParseTSVLine creates a new BroData from a line of a Zeek TSV log. The fields which could be
+//parsed are set even if others fail, in which case the first failure is returned alongside
+//the BroData. Comment lines result in a nil BroData.
 //String matching is generally faster than byte matching in Golang for some reason, so we take use a string
 //rather than bytes here.
 func ParseTSVLine(lineString string, header *BroHeader,
 	fieldMap ZeekHeaderIndexMap, broDataFactory func() pt.BroData,
-	logger *log.Logger) pt.BroData {
+	logger *log.Logger) (pt.BroData, error) {
 
 	if strings.HasPrefix(lineString, "#") {
-		return nil
+		return nil, nil
 	}
 
 	dat := broDataFactory()
 	data := reflect.ValueOf(dat).Elem()
+	var lineErr error
 
 	tokenEndIdx := strings.Index(lineString, header.Separator)
 	tokenCounter := 0
@@ -432,12 +817,26 @@ func ParseTSVLine(lineString string, header *BroHeader,
 			// fieldMap struct seen below. Now, we map from the field's index in the file header
 			// to the offsets in the broData using the NthLogFieldParseTypeOffset array.
 			if fieldMap.NthLogFieldExistsInParseType[tokenCounter] {
-				parseTSVField(
+				err := parseTSVField(
 					lineString[:tokenEndIdx],
-					header.Types[tokenCounter],
+					fieldMap.NthLogFieldType[tokenCounter],
+					header.SetSep,
 					data.Field(fieldMap.NthLogFieldParseTypeOffset[tokenCounter]),
 					logger,
 				)
+				if err != nil && lineErr == nil {
+					lineErr = err
+				}
+				if tokenCounter < len(fieldMap.NthLogFieldNanosOffset) && fieldMap.NthLogFieldNanosOffset[tokenCounter] != 0 {
+					err := parseTSVTimeNanos(
+						lineString[:tokenEndIdx],
+						data.Field(fieldMap.NthLogFieldNanosOffset[tokenCounter]-1),
+						logger,
+					)
+					if err != nil && lineErr == nil {
+						lineErr = err
+					}
+				}
 			}
 		}
 
@@ -451,13 +850,27 @@ func ParseTSVLine(lineString string, header *BroHeader,
 	if tokenCounter < len(header.Names) && /* skip field if there is no matching entry in the names header*/
 		lineString != header.Empty && lineString != header.Unset && /* skip field if it is not set */
 		fieldMap.NthLogFieldExistsInParseType[tokenCounter] { /* skip the field if it is not in the parse struct */
-		parseTSVField(
+		err := parseTSVField(
 			lineString,
-			header.Types[tokenCounter],
+			fieldMap.NthLogFieldType[tokenCounter],
+			header.SetSep,
 			data.Field(fieldMap.NthLogFieldParseTypeOffset[tokenCounter]),
 			logger,
 		)
+		if err != nil && lineErr == nil {
+			lineErr = err
+		}
+		if tokenCounter < len(fieldMap.NthLogFieldNanosOffset) && fieldMap.NthLogFieldNanosOffset[tokenCounter] != 0 {
+			err := parseTSVTimeNanos(
+				lineString,
+				data.Field(fieldMap.NthLogFieldNanosOffset[tokenCounter]-1),
+				logger,
+			)
+			if err != nil && lineErr == nil {
+				lineErr = err
+			}
+		}
 	}
 
-	return dat
+	return dat, lineErr
 }
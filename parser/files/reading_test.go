@@ -0,0 +1,1190 @@
+package files
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/activecm/rita/config"
+	pt "github.com/activecm/rita/parser/parsetypes"
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGatherLogFilesOverlapping(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gather")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	connPath, _ := writeTestLog(t, dir, "conn.log", testConnLog)
+	dnsPath, _ := writeTestLog(t, dir, "dns.log", testConnLog)
+
+	linkDir := filepath.Join(dir, "link")
+	require.Nil(t, os.Symlink(dir, linkDir))
+
+	// the directory, a file inside it, the same file through "..", and through a symlink
+	paths := GatherLogFiles([]string{
+		dir,
+		connPath,
+		filepath.Join(dir, "sub", "..", "conn.log"),
+		filepath.Join(linkDir, "dns.log"),
+	}, nil, log.New())
+
+	require.ElementsMatch(t, []string{connPath, dnsPath}, paths)
+}
+
+func TestGatherDirSkipsDirectories(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gather")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	connPath, _ := writeTestLog(t, dir, "conn.log", testConnLog)
+
+	// directories are left out no matter which log suffix they end in
+	for _, name := range []string{"archive.log", "rotated.gz", "eve.json"} {
+		require.Nil(t, os.Mkdir(filepath.Join(dir, name), 0755))
+	}
+
+	require.Equal(t, []string{connPath}, gatherDir(dir, log.New()))
+}
+
+func TestLimitLogFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gather")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"conn.00.log", "conn.01.log", "conn.02.log", "dns.00.log", "http.00.log"} {
+		writeTestLog(t, dir, name, testConnLog)
+	}
+	paths := GatherLogFiles([]string{dir}, nil, log.New())
+	require.Len(t, paths, 5)
+
+	logger, hook := test.NewNullLogger()
+	limited := LimitLogFiles(paths, 3, logger)
+	require.Equal(t, paths[:3], limited)
+	require.Len(t, hook.Entries, 1)
+	require.Equal(t, log.WarnLevel, hook.LastEntry().Level)
+	require.Equal(t, 5, hook.LastEntry().Data["gathered"])
+
+	// no files are left out without a cap or if there are fewer files than the cap
+	hook.Reset()
+	require.Equal(t, paths, LimitLogFiles(paths, 0, logger))
+	require.Equal(t, paths, LimitLogFiles(paths, 5, logger))
+	require.Empty(t, hook.Entries)
+}
+
+func TestIndexFilesHardlinkedDuplicate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gather")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	connPath, _ := writeTestLog(t, dir, "conn.log", testConnLog)
+	linkPath := filepath.Join(dir, "conn-copy.log")
+	require.Nil(t, os.Link(connPath, linkPath))
+
+	logger, hook := test.NewNullLogger()
+
+	// a hardlink is a separate path so both files are gathered
+	paths := GatherLogFiles([]string{dir}, nil, logger)
+	require.ElementsMatch(t, []string{connPath, linkPath}, paths)
+
+	// but the matching contents are reported once the files are hashed
+	conf, err := config.LoadTestingConfig("")
+	require.Nil(t, err)
+	indexed := IndexFiles(paths, 1, "test", 0, logger, conf)
+	require.Len(t, indexed, 2)
+
+	var warnings []*log.Entry
+	for _, entry := range hook.AllEntries() {
+		if entry.Level == log.WarnLevel {
+			warnings = append(warnings, entry)
+		}
+	}
+	require.Len(t, warnings, 1)
+	require.ElementsMatch(t, []interface{}{connPath, linkPath},
+		[]interface{}{warnings[0].Data["path"], warnings[0].Data["duplicate"]})
+}
+
+//testSSLLog builds a TSV ssl log. The header declares the set separator as
+//headerSetSep which is written in the log as setSep.
+func testSSLLog(headerSetSep string, setSep string) string {
+	return "#separator \\x09\n" +
+		"#set_separator\t" + headerSetSep + "\n" +
+		"#empty_field\t(empty)\n" +
+		"#unset_field\t-\n" +
+		"#path\tssl\n" +
+		"#fields\tts\tuid\tid.orig_h\tid.orig_p\tid.resp_h\tid.resp_p\tversion\tcipher\tserver_name\t" +
+		"cert_chain_fuids\tvalidation_status\tvalidation_code\tja3\tja3s\n" +
+		"#types\ttime\tstring\taddr\tport\taddr\tport\tstring\tstring\tstring\t" +
+		"vector[string]\tstring\tint\tstring\tstring\n" +
+		"1517336042.090842\tCW32gzposD\t10.0.0.1\t53542\t93.184.216.34\t443\tTLSv12\t" +
+		"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256\texample.com\tFa1" + setSep + "Fa2\tok\t0\t" +
+		"e7d705a3286e19ea42f587b344ee6865\t\"ae4edc6faf64d08308082ad26be60767\"\n"
+}
+
+//parseTestTSV parses the first entry of a TSV log
+func parseTestTSV(t *testing.T, contents string) pt.BroData {
+	scanner := bufio.NewScanner(strings.NewReader(contents))
+	header, err := scanTSVHeader(scanner)
+	require.Nil(t, err)
+
+	factory := pt.NewBroDataFactory(header.ObjType)
+	require.NotNil(t, factory)
+
+	fieldMap, err := mapZeekHeaderToParseType(header, factory, nil, log.New())
+	require.Nil(t, err)
+
+	entry, err := ParseTSVLine(scanner.Text(), header, fieldMap, factory, log.New())
+	require.Nil(t, err)
+	return entry
+}
+
+//parseTestJSON parses a line of a JSON log which is expected to be valid
+func parseTestJSON(t *testing.T, line string, logType string) pt.BroData {
+	entry, err := ParseJSONLine([]byte(line), pt.NewBroDataFactory(logType), log.New())
+	require.Nil(t, err)
+	return entry
+}
+
+func TestParseTimestampTSVAndJSON(t *testing.T) {
+	testCases := []struct {
+		ts      string
+		seconds int64
+		nanos   int64
+	}{
+		{"1517336042.090842", 1517336042, 1517336042090842000},
+		{"1517336042.000001", 1517336042, 1517336042000001000},
+		// a float64 can't tell this apart from the next second
+		{"1517336042.999999999", 1517336042, 1517336042999999999},
+		{"1517336042.0", 1517336042, 1517336042000000000},
+	}
+
+	for _, testCase := range testCases {
+		tsv := "#separator \\x09\n" +
+			"#set_separator\t,\n" +
+			"#empty_field\t(empty)\n" +
+			"#unset_field\t-\n" +
+			"#path\thttp\n" +
+			"#fields\tts\tuid\tid.orig_h\tid.orig_p\tid.resp_h\tid.resp_p\tmethod\thost\n" +
+			"#types\ttime\tstring\taddr\tport\taddr\tport\tstring\tstring\n" +
+			testCase.ts + "\tCW32gzposD\t10.0.0.1\t53542\t10.0.1.1\t3128\tCONNECT\texample.com\n"
+		json := `{"ts":` + testCase.ts + `,"uid":"CW32gzposD","id.orig_h":"10.0.0.1","id.orig_p":53542,` +
+			`"id.resp_h":"10.0.1.1","id.resp_p":3128,"method":"CONNECT","host":"example.com"}`
+
+		tsvEntry := parseTestTSV(t, tsv).(*pt.HTTP)
+		jsonEntry := parseTestJSON(t, json, "http").(*pt.HTTP)
+
+		require.Equal(t, testCase.seconds, tsvEntry.TimeStamp, testCase.ts)
+		require.Equal(t, testCase.nanos, tsvEntry.TimeStampNanos, testCase.ts)
+		require.Equal(t, tsvEntry.TimeStamp, jsonEntry.TimeStamp, testCase.ts)
+		require.Equal(t, tsvEntry.TimeStampNanos, jsonEntry.TimeStampNanos, testCase.ts)
+	}
+}
+
+func TestSelectTimestampField(t *testing.T) {
+	// a custom http log recording when the response arrived alongside the request time
+	contents := "#separator \\x09\n" +
+		"#set_separator\t,\n" +
+		"#empty_field\t(empty)\n" +
+		"#unset_field\t-\n" +
+		"#path\thttp\n" +
+		"#fields\tts\tuid\tmethod\thost\tresponse_ts\tcomment\n" +
+		"#types\ttime\tstring\tstring\tstring\ttime\tstring\n" +
+		"1553522400.123456\tCHhAvVGS1DHFjwGM9\tCONNECT\texample.com\t1553522402.5\tslow\n"
+	scanner := bufio.NewScanner(strings.NewReader(contents))
+	header, err := scanTSVHeader(scanner)
+	require.Nil(t, err)
+	factory := pt.NewBroDataFactory(header.ObjType)
+
+	parse := func(field string) *pt.HTTP {
+		selected, err := selectTimestampField(header, field, log.New())
+		require.Nil(t, err)
+		fieldMap, err := mapZeekHeaderToParseType(selected, factory, nil, log.New())
+		require.Nil(t, err)
+		entry, err := ParseTSVLine(scanner.Text(), selected, fieldMap, factory, log.New())
+		require.Nil(t, err)
+		return entry.(*pt.HTTP)
+	}
+
+	// ts is used by default
+	for _, field := range []string{"", "ts"} {
+		entry := parse(field)
+		require.Equal(t, int64(1553522400), entry.TimeStamp)
+		require.Equal(t, int64(1553522400123456000), entry.TimeStampNanos)
+	}
+
+	// the selected field populates the timestamp, and the other fields are unaffected
+	entry := parse("response_ts")
+	require.Equal(t, int64(1553522402), entry.TimeStamp)
+	require.Equal(t, int64(1553522402500000000), entry.TimeStampNanos)
+	require.Equal(t, "CHhAvVGS1DHFjwGM9", entry.UID)
+	require.Equal(t, "example.com", entry.Host)
+	require.Equal(t, []string{"ts", "uid", "method", "host", "response_ts", "comment"}, header.Names)
+
+	// logs without the field fall back to ts
+	logger, hook := test.NewNullLogger()
+	selected, err := selectTimestampField(header, "request_ts", logger)
+	require.Nil(t, err)
+	require.Equal(t, header, selected)
+	require.Equal(t, log.WarnLevel, hook.LastEntry().Level)
+
+	// the field must hold times
+	_, err = selectTimestampField(header, "comment", log.New())
+	require.EqualError(t, err, "timestamp field comment is logged as string but time is expected")
+}
+
+func TestLogIgnoredFields(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ignored")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	conf, err := config.LoadTestingConfig("")
+	require.Nil(t, err)
+
+	contents := "#separator \\x09\n#set_separator\t,\n#empty_field\t(empty)\n#unset_field\t-\n#path\tconn\n" +
+		"#fields\tts\tuid\tnew_field\tid.orig_h\tid.orig_p\tid.resp_h\tid.resp_p\tnewer_field\n" +
+		"#types\ttime\tstring\tstring\taddr\tport\taddr\tport\tcount\n" +
+		"1517336042.000000\tC1\tx\t10.0.0.1\t50000\t93.184.216.34\t443\t1\n"
+
+	// files sharing a header are each summarized once
+	for _, name := range []string{"conn.log", "conn.2.log"} {
+		path, _ := writeTestLog(t, dir, name, contents)
+
+		logger, hook := test.NewNullLogger()
+		_, err = newIndexedFile(path, "test", 0, logger, conf)
+		require.Nil(t, err)
+
+		require.Len(t, hook.Entries, 1)
+		entry := hook.LastEntry()
+		require.Equal(t, log.InfoLevel, entry.Level)
+		require.Equal(t, path, entry.Data["path"])
+		require.Equal(t, "conn", entry.Data["log_type"])
+		require.Equal(t, []string{"new_field", "newer_field"}, entry.Data["ignored_fields"])
+		require.Equal(t, 2, entry.Data["ignored_count"])
+	}
+
+	// nothing is reported if every field is parsed
+	path, _ := writeTestLog(t, dir, "conn.3.log", testConnLog)
+	logger, hook := test.NewNullLogger()
+	_, err = newIndexedFile(path, "test", 0, logger, conf)
+	require.Nil(t, err)
+	require.Empty(t, hook.Entries)
+}
+
+func TestParseSSL(t *testing.T) {
+	expected := &pt.SSL{
+		TimeStamp:        1517336042,
+		UID:              "CW32gzposD",
+		Source:           "10.0.0.1",
+		SourcePort:       53542,
+		Destination:      "93.184.216.34",
+		DestinationPort:  443,
+		Version:          "TLSv12",
+		Cipher:           "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256",
+		ServerName:       "example.com",
+		CertChainFuids:   []string{"Fa1", "Fa2"},
+		ValidationStatus: "ok",
+		JA3:              "e7d705a3286e19ea42f587b344ee6865",
+		// the fingerprints are passed through as they appear in the log
+		JA3S: "\"ae4edc6faf64d08308082ad26be60767\"",
+	}
+
+	// the cert chain is split on the set separator declared in the header,
+	// which may be escaped
+	testCases := []struct {
+		headerSetSep string
+		setSep       string
+	}{
+		{",", ","},
+		{"|", "|"},
+		{"\\x7c", "|"},
+	}
+	for _, testCase := range testCases {
+		entry := parseTestTSV(t, testSSLLog(testCase.headerSetSep, testCase.setSep))
+		require.Equal(t, expected, entry, "set separator: %s", testCase.headerSetSep)
+	}
+
+	jsonLine := `{"ts":1517336042.090842,"uid":"CW32gzposD","id.orig_h":"10.0.0.1","id.orig_p":53542,` +
+		`"id.resp_h":"93.184.216.34","id.resp_p":443,"version":"TLSv12",` +
+		`"cipher":"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256","server_name":"example.com",` +
+		`"cert_chain_fuids":["Fa1","Fa2"],"validation_status":"ok","validation_code":0,` +
+		`"ja3":"e7d705a3286e19ea42f587b344ee6865","ja3s":"\"ae4edc6faf64d08308082ad26be60767\""}`
+	entry := parseTestJSON(t, jsonLine, "ssl").(*pt.SSL)
+	entry.TimeStampGeneric = nil
+	require.Equal(t, expected, entry)
+}
+
+func TestSplitSetField(t *testing.T) {
+	testCases := []struct {
+		fieldText string
+		setSep    string
+		expected  []string
+	}{
+		{"a,b,c", ",", []string{"a", "b", "c"}},
+		// the separator is escaped inside of the elements
+		{`v=spf1 a\x2cmx,example.com`, ",", []string{"v=spf1 a,mx", "example.com"}},
+		{`/search?q=a\x2Cb`, ",", []string{"/search?q=a,b"}},
+		{`a\x7cb|c`, "|", []string{"a|b", "c"}},
+		// escapes of other characters are left alone
+		{`a\x7cb,c\x00`, ",", []string{`a\x7cb`, `c\x00`}},
+		// an escaped backslash followed by x2c is not an escaped separator
+		{`a\x5cx2c,b`, ",", []string{`a\x5cx2c`, "b"}},
+	}
+	for _, testCase := range testCases {
+		require.Equal(t, testCase.expected, splitSetField(testCase.fieldText, testCase.setSep), testCase.fieldText)
+	}
+}
+
+func TestParseDNSAnswersEscapedSeparator(t *testing.T) {
+	contents := "#separator \\x09\n" +
+		"#set_separator\t,\n" +
+		"#empty_field\t(empty)\n" +
+		"#unset_field\t-\n" +
+		"#path\tdns\n" +
+		"#fields\tts\tuid\tid.orig_h\tid.orig_p\tid.resp_h\tid.resp_p\tquery\tanswers\n" +
+		"#types\ttime\tstring\taddr\tport\taddr\tport\tstring\tvector[string]\n" +
+		"1517336042.090842\tCW32gzposD\t10.0.0.1\t53542\t8.8.8.8\t53\texample.com\t" +
+		`v=spf1 include:_spf.example.com ~all\x2c v=DMARC1,93.184.216.34` + "\n"
+
+	entry := parseTestTSV(t, contents).(*pt.DNS)
+	require.Equal(t, []string{"v=spf1 include:_spf.example.com ~all, v=DMARC1", "93.184.216.34"}, entry.Answers)
+}
+
+func TestParseDNSAnswersAddrSet(t *testing.T) {
+	// some deployments log the answers of address lookups as a set of addresses
+	contents := "#separator \\x09\n" +
+		"#set_separator\t,\n" +
+		"#empty_field\t(empty)\n" +
+		"#unset_field\t-\n" +
+		"#path\tdns\n" +
+		"#fields\tts\tuid\tid.orig_h\tid.orig_p\tid.resp_h\tid.resp_p\tquery\tanswers\n" +
+		"#types\ttime\tstring\taddr\tport\taddr\tport\tstring\tset[addr]\n" +
+		"1517336042.090842\tCW32gzposD\t10.0.0.1\t53542\t8.8.8.8\t53\texample.com\t" +
+		"93.184.216.34,2606:2800:0220:0001:0248:1893:25C8:1946,not-an-ip,::ffff:10.0.0.5\n"
+
+	scanner := bufio.NewScanner(strings.NewReader(contents))
+	header, err := scanTSVHeader(scanner)
+	require.Nil(t, err)
+	factory := pt.NewBroDataFactory(header.ObjType)
+
+	fieldMap, err := mapZeekHeaderToParseType(header, factory, map[string]string{"answers": pt.AddrSet}, log.New())
+	require.Nil(t, err)
+	require.Equal(t, pt.AddrSet, fieldMap.NthLogFieldType[7])
+
+	logger, hook := test.NewNullLogger()
+	entry, err := ParseTSVLine(scanner.Text(), header, fieldMap, factory, logger)
+	require.Nil(t, err)
+
+	// the addresses are canonicalized and the malformed one is dropped
+	require.Equal(t, []string{"93.184.216.34", "2606:2800:220:1:248:1893:25c8:1946", "10.0.0.5"}, entry.(*pt.DNS).Answers)
+	require.Len(t, hook.AllEntries(), 1)
+	require.Equal(t, log.WarnLevel, hook.LastEntry().Level)
+	require.Equal(t, "not-an-ip", hook.LastEntry().Data["value"])
+}
+
+const testX509Log = "#separator \\x09\n" +
+	"#set_separator\t,\n" +
+	"#empty_field\t(empty)\n" +
+	"#unset_field\t-\n" +
+	"#path\tx509\n" +
+	"#fields\tts\tid\tfingerprint\tcertificate.version\tcertificate.serial\tcertificate.subject\t" +
+	"certificate.issuer\tcertificate.not_valid_before\tcertificate.not_valid_after\tsan.dns\tbasic_constraints.ca\n" +
+	"#types\ttime\tstring\tstring\tcount\tstring\tstring\tstring\ttime\ttime\tvector[string]\tbool\n" +
+	"1517336042.090842\tFa1\t7e7a5ad4d9c3d5f3e2a0f1d6c1a4b8e0\t3\t0FA0F5C4\tCN=example.com\t" +
+	"CN=Example CA\t1514764800.000000\t1546300799.000000\texample.com,www.example.com\tF\n"
+
+func TestParseX509(t *testing.T) {
+	expected := &pt.X509{
+		TimeStamp:      1517336042,
+		ID:             "Fa1",
+		Fingerprint:    "7e7a5ad4d9c3d5f3e2a0f1d6c1a4b8e0",
+		Version:        3,
+		Serial:         "0FA0F5C4",
+		Subject:        "CN=example.com",
+		Issuer:         "CN=Example CA",
+		NotValidBefore: 1514764800,
+		NotValidAfter:  1546300799,
+		SANDNS:         []string{"example.com", "www.example.com"},
+	}
+
+	entry := parseTestTSV(t, testX509Log)
+	require.Equal(t, expected, entry)
+
+	jsonLine := `{"ts":1517336042.090842,"id":"Fa1","fingerprint":"7e7a5ad4d9c3d5f3e2a0f1d6c1a4b8e0",` +
+		`"certificate.version":3,"certificate.serial":"0FA0F5C4","certificate.subject":"CN=example.com",` +
+		`"certificate.issuer":"CN=Example CA","certificate.not_valid_before":1514764800.0,` +
+		`"certificate.not_valid_after":1546300799.0,"san.dns":["example.com","www.example.com"],` +
+		`"basic_constraints.ca":false}`
+	jsonEntry := parseTestJSON(t, jsonLine, "x509").(*pt.X509)
+	jsonEntry.TimeStampGeneric = nil
+	jsonEntry.NotValidBeforeGeneric = nil
+	jsonEntry.NotValidAfterGeneric = nil
+	require.Equal(t, expected, jsonEntry)
+
+	// the certificate is keyed by its fingerprint when zeek logs one
+	require.Equal(t, expected.Fingerprint, jsonEntry.FingerprintKey())
+	jsonEntry.Fingerprint = ""
+	require.Equal(t, "Fa1", jsonEntry.FingerprintKey())
+}
+
+//testHTTPLog builds a TSV http log with a request for each uri and user agent
+func testHTTPLog(requests [][2]string) string {
+	log := "#separator \\x09\n" +
+		"#set_separator\t,\n" +
+		"#empty_field\t(empty)\n" +
+		"#unset_field\t-\n" +
+		"#path\thttp\n" +
+		"#open\t2019-03-25-14-00-00\n" +
+		"#fields\tts\tuid\tid.orig_h\tid.orig_p\tid.resp_h\tid.resp_p\ttrans_depth\tmethod\thost\turi\t" +
+		"referrer\tversion\tuser_agent\torigin\trequest_body_len\tresponse_body_len\tstatus_code\tstatus_msg\t" +
+		"info_code\tinfo_msg\ttags\tusername\tpassword\tproxied\torig_fuids\torig_filenames\torig_mime_types\t" +
+		"resp_fuids\tresp_filenames\tresp_mime_types\n" +
+		"#types\ttime\tstring\taddr\tport\taddr\tport\tcount\tstring\tstring\tstring\tstring\tstring\tstring\t" +
+		"string\tcount\tcount\tcount\tstring\tcount\tstring\tset[enum]\tstring\tstring\tset[string]\t" +
+		"vector[string]\tvector[string]\tvector[string]\tvector[string]\tvector[string]\tvector[string]\n"
+	for _, request := range requests {
+		log += "1553522400.123456\tCHhAvVGS1DHFjwGM9\t10.0.0.1\t49285\t93.184.216.34\t80\t1\tGET\texample.com\t" +
+			request[0] + "\t-\t1.1\t" + request[1] + "\t-\t0\t1256\t200\tOK\t-\t-\t-\t-\t-\t-\t-\t-\t-\t" +
+			"FakNcS1Jfe01uljb3\t-\ttext/html\n"
+	}
+	return log
+}
+
+func TestParseHTTP(t *testing.T) {
+	expected := &pt.HTTP{
+		TimeStamp:       1553522400,
+		TimeStampNanos:  1553522400123456000,
+		UID:             "CHhAvVGS1DHFjwGM9",
+		Source:          "10.0.0.1",
+		SourcePort:      49285,
+		Destination:     "93.184.216.34",
+		DestinationPort: 80,
+		TransDepth:      1,
+		Method:          "GET",
+		Host:            "example.com",
+		URI:             "/index.html",
+		Version:         "1.1",
+		UserAgent:       "Mozilla/5.0 (X11; Linux x86_64; rv:66.0) Gecko/20100101 Firefox/66.0",
+		RespLen:         1256,
+		StatusCode:      200,
+		StatusMsg:       "OK",
+		RespFuids:       []string{"FakNcS1Jfe01uljb3"},
+		RespMimeTypes:   []string{"text/html"},
+	}
+
+	entry := parseTestTSV(t, testHTTPLog([][2]string{{expected.URI, expected.UserAgent}}))
+	require.Equal(t, expected, entry)
+
+	// an unset user agent is left empty
+	noAgent := *expected
+	noAgent.UserAgent = ""
+	entry = parseTestTSV(t, testHTTPLog([][2]string{{expected.URI, "-"}}))
+	require.Equal(t, &noAgent, entry)
+
+	jsonLine := `{"ts":1553522400.123456,"uid":"CHhAvVGS1DHFjwGM9","id.orig_h":"10.0.0.1","id.orig_p":49285,` +
+		`"id.resp_h":"93.184.216.34","id.resp_p":80,"trans_depth":1,"method":"GET","host":"example.com",` +
+		`"uri":"/index.html","version":"1.1","user_agent":"","request_body_len":0,"response_body_len":1256,` +
+		`"status_code":200,"status_msg":"OK","resp_fuids":["FakNcS1Jfe01uljb3"],` +
+		`"resp_mime_types":["text/html"]}`
+	jsonEntry := parseTestJSON(t, jsonLine, "http").(*pt.HTTP)
+	jsonEntry.TimeStampGeneric = nil
+	require.Equal(t, &noAgent, jsonEntry)
+}
+
+//renamedLogFile reports a different name than the file it reads
+type renamedLogFile struct {
+	*os.File
+	name string
+}
+
+func (f renamedLogFile) Name() string {
+	return f.name
+}
+
+func TestGetFileScannerFileType(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scanner")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path, _ := writeTestLog(t, dir, "http.log", testHTTPLog(nil))
+
+	testCases := []struct {
+		name string
+		ok   bool
+	}{
+		{"http.log", true},
+		{"eve.json", true},
+		{"nfdump.csv", true},
+		// names too short to hold an extension are rejected rather than panicking
+		{"ab", false},
+		{"", false},
+		// the extensions are case sensitive, the same as when the files are gathered
+		{"foo.LOG", false},
+		// the extension must be separated by a dot
+		{"catalog", false},
+		{"http.log.bak", false},
+	}
+	for _, testCase := range testCases {
+		file, err := os.Open(path)
+		require.Nil(t, err)
+
+		scanner, closer, err := GetFileScanner(renamedLogFile{file, testCase.name}, 0, 0)
+		if testCase.ok {
+			require.Nil(t, err, testCase.name)
+			require.True(t, scanner.Scan(), testCase.name)
+		} else {
+			require.EqualError(t, err, "filetype not recognized", testCase.name)
+		}
+		require.Equal(t, testCase.ok, isLogFile(testCase.name), testCase.name)
+		closer()
+	}
+}
+
+func TestGetFileScannerLongLine(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scanner")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	longURI := "/" + strings.Repeat("a", 128*1024)
+	path, _ := writeTestLog(t, dir, "http.log", testHTTPLog([][2]string{{longURI, "-"}}))
+
+	scanLines := func(maxLineLength int) (int, error) {
+		fileHandle, err := OpenLogFile(path)
+		require.Nil(t, err)
+		scanner, closer, err := GetFileScanner(fileHandle, maxLineLength, 0)
+		require.Nil(t, err)
+		defer closer()
+
+		lines := 0
+		for scanner.Scan() {
+			lines++
+		}
+		return lines, scanner.Err()
+	}
+
+	// the default buffer fits the long request
+	lines, err := scanLines(0)
+	require.Nil(t, err)
+	require.Equal(t, 9, lines)
+
+	// a smaller limit stops at the long request
+	_, err = scanLines(64 * 1024)
+	require.Equal(t, bufio.ErrTooLong, err)
+}
+
+//writeTestGzipConnLog writes a gzipped TSV conn log with the given number of records and
+//returns its path along with the size of the uncompressed log
+func writeTestGzipConnLog(tb testing.TB, dir string, records int) (string, int64) {
+	path := filepath.Join(dir, "conn.log.gz")
+	file, err := os.Create(path)
+	require.Nil(tb, err)
+	defer file.Close()
+
+	writer := gzip.NewWriter(file)
+	size, err := io.WriteString(writer, testConnLog)
+	require.Nil(tb, err)
+	for i := 0; i < records; i++ {
+		n, err := fmt.Fprintf(writer, "%d.090842\tC%d\t10.0.0.%d\t%d\t93.184.216.34\t443\n", 1517336043+i, i, i%256, 50000+i%10000)
+		require.Nil(tb, err)
+		size += n
+	}
+	require.Nil(tb, writer.Close())
+	return path, int64(size)
+}
+
+func TestGetFileScannerParallelGzip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scanner")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path, _ := writeTestGzipConnLog(t, dir, 10000)
+	fInfo, err := os.Stat(path)
+	require.Nil(t, err)
+
+	scanLines := func(parallelGzipMinSize int64) []string {
+		fileHandle, err := OpenLogFile(path)
+		require.Nil(t, err)
+		scanner, closer, err := GetFileScanner(fileHandle, 0, parallelGzipMinSize)
+		require.Nil(t, err)
+		defer closer()
+
+		var lines []string
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+		require.Nil(t, scanner.Err())
+		return lines
+	}
+
+	// the parallel reader yields the same lines as the default reader
+	lines := scanLines(0)
+	require.Len(t, lines, 10009)
+	require.Equal(t, lines, scanLines(fInfo.Size()))
+
+	require.False(t, useParallelGzip(&os.File{}, 0))
+	fileHandle, err := OpenLogFile(path)
+	require.Nil(t, err)
+	defer fileHandle.Close()
+	require.True(t, useParallelGzip(fileHandle, fInfo.Size()))
+	require.False(t, useParallelGzip(fileHandle, fInfo.Size()+1))
+}
+
+//BenchmarkGzipReader compares the decompression throughput of the gzip readers on a large
+//conn log. The system reader falls back to the standard library if pigz and gzip are missing.
+func BenchmarkGzipReader(b *testing.B) {
+	dir, err := ioutil.TempDir("", "gzip")
+	require.Nil(b, err)
+	defer os.RemoveAll(dir)
+
+	path, size := writeTestGzipConnLog(b, dir, 1000000)
+
+	readers := []struct {
+		name   string
+		reader func(io.ReadCloser) (io.Reader, func() error, error)
+	}{
+		{"stdlib", func(fileHandle io.ReadCloser) (io.Reader, func() error, error) {
+			reader, err := gzip.NewReader(fileHandle)
+			return reader, fileHandle.Close, err
+		}},
+		{"parallel", newParallelGzipReader},
+		{"system", newGzipReader},
+	}
+
+	for _, r := range readers {
+		b.Run(r.name, func(b *testing.B) {
+			b.SetBytes(size)
+			for i := 0; i < b.N; i++ {
+				fileHandle, err := OpenLogFile(path)
+				if err != nil {
+					b.Fatal(err)
+				}
+				reader, closer, err := r.reader(fileHandle)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, err := io.Copy(ioutil.Discard, reader); err != nil {
+					b.Fatal(err)
+				}
+				closer()
+			}
+		})
+	}
+}
+
+func TestParseTSVLinePooled(t *testing.T) {
+	scanner := bufio.NewScanner(strings.NewReader(testConnLog))
+	header, err := scanTSVHeader(scanner)
+	require.Nil(t, err)
+	pool := pt.NewBroDataPool(pt.NewBroDataFactory(header.ObjType))
+	fieldMap, err := mapZeekHeaderToParseType(header, pool.Get, nil, log.New())
+	require.Nil(t, err)
+
+	entry, err := ParseTSVLine("1517336042.090842\tCW32gzposD\t10.0.0.1\t53542\t8.8.8.8\t53", header, fieldMap, pool.Get, log.New())
+	require.Nil(t, err)
+	require.Equal(t, "CW32gzposD", entry.(*pt.Conn).UID)
+	pool.Put(entry)
+
+	// the fields left unset by the next line don't carry over from the recycled record
+	entry, err = ParseTSVLine("1517336043.090842\t-\t10.0.0.2\t53543\t8.8.8.8\t53", header, fieldMap, pool.Get, log.New())
+	require.Nil(t, err)
+	require.Equal(t, "", entry.(*pt.Conn).UID)
+	require.Equal(t, "10.0.0.2", entry.(*pt.Conn).Source)
+}
+
+//BenchmarkParseTSVLine compares parsing conn records into newly allocated structs against
+//recycling the structs through a pool. Run with -benchmem to compare the allocs/op.
+func BenchmarkParseTSVLine(b *testing.B) {
+	scanner := bufio.NewScanner(strings.NewReader(testConnLog))
+	header, err := scanTSVHeader(scanner)
+	require.Nil(b, err)
+	factory := pt.NewBroDataFactory(header.ObjType)
+	logger := log.New()
+	fieldMap, err := mapZeekHeaderToParseType(header, factory, nil, logger)
+	require.Nil(b, err)
+	line := "1517336042.090842\tCW32gzposD\t10.0.0.1\t53542\t8.8.8.8\t53"
+
+	b.Run("alloc", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := ParseTSVLine(line, header, fieldMap, factory, logger); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("pooled", func(b *testing.B) {
+		pool := pt.NewBroDataPool(factory)
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			entry, err := ParseTSVLine(line, header, fieldMap, pool.Get, logger)
+			if err != nil {
+				b.Fatal(err)
+			}
+			pool.Put(entry)
+		}
+	})
+}
+
+func TestParseUIDAcrossLogs(t *testing.T) {
+	var uids []string
+	addUID := func(entry pt.BroData) {
+		uid, ok := pt.GetUID(entry)
+		require.True(t, ok, "entry: %T", entry)
+		uids = append(uids, uid)
+	}
+
+	// the first connection in the conn log is the connection in the ssl log
+	addUID(parseTestTSV(t, testConnLog))
+	addUID(parseTestTSV(t, testSSLLog(",", ",")))
+
+	jsonLines := map[string]string{
+		"conn": `{"ts":1517336042.090842,"uid":"CW32gzposD","id.orig_h":"10.0.0.1","id.orig_p":53542}`,
+		"ssl":  `{"ts":1517336042.090842,"uid":"CW32gzposD","id.orig_h":"10.0.0.1","server_name":"example.com"}`,
+		"http": `{"ts":1517336042.090842,"uid":"CW32gzposD","id.orig_h":"10.0.0.1","host":"example.com"}`,
+	}
+	for logType, jsonLine := range jsonLines {
+		addUID(parseTestJSON(t, jsonLine, logType))
+	}
+
+	require.Len(t, uids, 5)
+	for _, uid := range uids {
+		require.Equal(t, "CW32gzposD", uid)
+	}
+}
+
+//testDHCPLog builds a TSV dhcp log with a lease for each host name
+func testDHCPLog(setSep string, hostNames ...string) string {
+	log := "#separator \\x09\n" +
+		"#set_separator\t" + setSep + "\n" +
+		"#empty_field\t(empty)\n" +
+		"#unset_field\t-\n" +
+		"#path\tdhcp\n" +
+		"#fields\tts\tuids\tclient_addr\tserver_addr\tmac\thost_name\tclient_fqdn\tdomain\t" +
+		"requested_addr\tassigned_addr\tlease_time\tclient_message\tserver_message\tmsg_types\tduration\n" +
+		"#types\ttime\tset[string]\taddr\taddr\tstring\tstring\tstring\tstring\taddr\taddr\tinterval\t" +
+		"string\tstring\tvector[string]\tinterval\n"
+	for _, hostName := range hostNames {
+		log += "1553522400.123456\tCmWOt6VWaNGqXYcH6" + setSep + "CLMwcr2WVnFqXBRrC9\t192.168.1.50\t" +
+			"192.168.1.1\t00:0c:29:7a:6e:2c\t" + hostName + "\t-\tlocaldomain\t-\t192.168.1.50\t86400.000000\t" +
+			"-\t-\tREQUEST" + setSep + "ACK\t0.004182\n"
+	}
+	return log
+}
+
+func TestParseDHCP(t *testing.T) {
+	expected := &pt.DHCP{
+		TimeStamp:    1553522400,
+		UIDs:         []string{"CmWOt6VWaNGqXYcH6", "CLMwcr2WVnFqXBRrC9"},
+		ClientAddr:   "192.168.1.50",
+		ServerAddr:   "192.168.1.1",
+		MAC:          "00:0c:29:7a:6e:2c",
+		HostName:     "workstation-1",
+		Domain:       "localdomain",
+		AssignedAddr: "192.168.1.50",
+		LeaseTime:    86400,
+		MsgTypes:     []string{"REQUEST", "ACK"},
+		Duration:     0.004182,
+	}
+	noHostName := *expected
+	noHostName.HostName = ""
+
+	// the uids and message types are split on the set separator from the header
+	for _, setSep := range []string{",", "|"} {
+		scanner := bufio.NewScanner(strings.NewReader(testDHCPLog(setSep, expected.HostName, "-")))
+		header, err := scanTSVHeader(scanner)
+		require.Nil(t, err)
+		factory := pt.NewBroDataFactory(header.ObjType)
+		fieldMap, err := mapZeekHeaderToParseType(header, factory, nil, log.New())
+		require.Nil(t, err)
+
+		entry, err := ParseTSVLine(scanner.Text(), header, fieldMap, factory, log.New())
+		require.Nil(t, err)
+		require.Equal(t, expected, entry)
+		require.True(t, scanner.Scan())
+		entry, err = ParseTSVLine(scanner.Text(), header, fieldMap, factory, log.New())
+		require.Nil(t, err)
+		require.Equal(t, &noHostName, entry)
+	}
+
+	jsonLines := []struct {
+		line     string
+		expected *pt.DHCP
+	}{
+		{
+			`{"ts":1553522400.123456,"uids":["CmWOt6VWaNGqXYcH6","CLMwcr2WVnFqXBRrC9"],"client_addr":"192.168.1.50",` +
+				`"server_addr":"192.168.1.1","mac":"00:0c:29:7a:6e:2c","host_name":"workstation-1",` +
+				`"domain":"localdomain","assigned_addr":"192.168.1.50","lease_time":86400.0,` +
+				`"msg_types":["REQUEST","ACK"],"duration":0.004182}`,
+			expected,
+		},
+		{
+			`{"ts":1553522400.123456,"uids":["CmWOt6VWaNGqXYcH6","CLMwcr2WVnFqXBRrC9"],"client_addr":"192.168.1.50",` +
+				`"server_addr":"192.168.1.1","mac":"00:0c:29:7a:6e:2c","domain":"localdomain",` +
+				`"assigned_addr":"192.168.1.50","lease_time":86400.0,"msg_types":["REQUEST","ACK"],"duration":0.004182}`,
+			&noHostName,
+		},
+	}
+	for _, testCase := range jsonLines {
+		entry := parseTestJSON(t, testCase.line, "dhcp").(*pt.DHCP)
+		entry.TimeStampGeneric = nil
+		require.Equal(t, testCase.expected, entry)
+	}
+}
+
+func TestCheckTSVFieldCount(t *testing.T) {
+	scanner := bufio.NewScanner(strings.NewReader(testConnLog))
+	header, err := scanTSVHeader(scanner)
+	require.Nil(t, err)
+
+	testCases := []struct {
+		line  string
+		valid bool
+	}{
+		{"1517336042.090842\tCW32gzposD\t10.0.0.1\t53542\t8.8.8.8", false},
+		{"1517336042.090842\tCW32gzposD\t10.0.0.1\t53542\t8.8.8.8\t53", true},
+		{"1517336042.090842\tCW32gzposD\t10.0.0.1\t53542\t8.8.8.8\t53\textra", false},
+		{"#close\t2018-01-30-18-14-02", true},
+	}
+
+	for _, testCase := range testCases {
+		err := CheckTSVFieldCount(testCase.line, header)
+		require.Equal(t, testCase.valid, err == nil, "line: %s", testCase.line)
+	}
+}
+
+func TestMapZeekHeaderToParseTypeCache(t *testing.T) {
+	scanner := bufio.NewScanner(strings.NewReader(testConnLog))
+	header, err := scanTSVHeader(scanner)
+	require.Nil(t, err)
+	factory := pt.NewBroDataFactory(header.ObjType)
+
+	first, err := mapZeekHeaderToParseType(header, factory, nil, log.New())
+	require.Nil(t, err)
+
+	// an identical header from another file reuses the mapping
+	sameHeader := *header
+	sameHeader.Names = append([]string{}, header.Names...)
+	sameHeader.Types = append([]string{}, header.Types...)
+	reflections := atomic.LoadUint64(&parseTypeReflections)
+	second, err := mapZeekHeaderToParseType(&sameHeader, factory, nil, log.New())
+	require.Nil(t, err)
+	require.Equal(t, first, second)
+	require.Equal(t, reflections, atomic.LoadUint64(&parseTypeReflections))
+
+	// a header with reordered fields is mapped again
+	reordered := sameHeader
+	reordered.Names = []string{"uid", "ts", "id.orig_h", "id.orig_p", "id.resp_h", "id.resp_p"}
+	reordered.Types = []string{"string", "time", "addr", "port", "addr", "port"}
+	third, err := mapZeekHeaderToParseType(&reordered, factory, nil, log.New())
+	require.Nil(t, err)
+	require.Equal(t, first.NthLogFieldParseTypeOffset[0], third.NthLogFieldParseTypeOffset[1])
+	require.Equal(t, first.NthLogFieldParseTypeOffset[1], third.NthLogFieldParseTypeOffset[0])
+
+	// a header with a mismatched type is still rejected
+	mismatched := sameHeader
+	mismatched.Types = []string{"time", "count", "addr", "port", "addr", "port"}
+	_, err = mapZeekHeaderToParseType(&mismatched, factory, nil, log.New())
+	require.NotNil(t, err)
+}
+
+func TestMapZeekHeaderToParseTypeOverride(t *testing.T) {
+	contents := "#separator \\x09\n" +
+		"#set_separator\t,\n" +
+		"#empty_field\t(empty)\n" +
+		"#unset_field\t-\n" +
+		"#path\tconn\n" +
+		"#fields\tts\tuid\tid.orig_h\tid.orig_p\tid.resp_h\tid.resp_p\tduration\n" +
+		"#types\ttime\tstring\taddr\tport\taddr\tport\tcount\n" +
+		"1517336042.090842\tCW32gzposD\t10.0.0.1\t53542\t8.8.8.8\t53\t12\n"
+
+	scanner := bufio.NewScanner(strings.NewReader(contents))
+	header, err := scanTSVHeader(scanner)
+	require.Nil(t, err)
+	factory := pt.NewBroDataFactory(header.ObjType)
+
+	// the mismatched type is rejected by default
+	_, err = mapZeekHeaderToParseType(header, factory, nil, log.New())
+	require.NotNil(t, err)
+
+	// an override for a different type doesn't accept the field
+	_, err = mapZeekHeaderToParseType(header, factory, map[string]string{"duration": "int"}, log.New())
+	require.NotNil(t, err)
+
+	// the override accepts the count and coerces it into the interval field
+	fieldMap, err := mapZeekHeaderToParseType(header, factory, map[string]string{"duration": "count"}, log.New())
+	require.Nil(t, err)
+	require.Equal(t, pt.Interval, fieldMap.NthLogFieldType[6])
+	require.Equal(t, pt.Port, fieldMap.NthLogFieldType[5])
+
+	entry, err := ParseTSVLine(scanner.Text(), header, fieldMap, factory, log.New())
+	require.Nil(t, err)
+	conn := entry.(*pt.Conn)
+	require.Equal(t, 12.0, conn.Duration)
+	require.Equal(t, 53, conn.DestinationPort)
+}
+
+func TestMapZeekHeaderToParseTypeLegacyTypes(t *testing.T) {
+	// older versions of Bro logged sets as tables
+	contents := "#separator \\x09\n" +
+		"#set_separator\t,\n" +
+		"#empty_field\t(empty)\n" +
+		"#unset_field\t-\n" +
+		"#path\tconn\n" +
+		"#fields\tts\tuid\tid.orig_h\tid.orig_p\tid.resp_h\tid.resp_p\torig_pkts\ttunnel_parents\n" +
+		"#types\ttime\tstring\taddr\tport\taddr\tport\tcounter\ttable[string]\n" +
+		"1517336042.090842\tCW32gzposD\t10.0.0.1\t53542\t8.8.8.8\t53\t7\tCk6kgS,CjhGID\n"
+
+	scanner := bufio.NewScanner(strings.NewReader(contents))
+	header, err := scanTSVHeader(scanner)
+	require.Nil(t, err)
+	factory := pt.NewBroDataFactory(header.ObjType)
+
+	// the legacy types are mapped to the types used today
+	fieldMap, err := mapZeekHeaderToParseType(header, factory, nil, log.New())
+	require.Nil(t, err)
+	require.Equal(t, pt.Count, fieldMap.NthLogFieldType[6])
+	require.Equal(t, pt.StringSet, fieldMap.NthLogFieldType[7])
+
+	entry, err := ParseTSVLine(scanner.Text(), header, fieldMap, factory, log.New())
+	require.Nil(t, err)
+	conn := entry.(*pt.Conn)
+	require.Equal(t, int64(7), conn.OrigPkts)
+	require.Equal(t, []string{"Ck6kgS", "CjhGID"}, conn.TunnelParents)
+
+	// a legacy set of addresses may be coerced into a list of strings like its current equivalent
+	_, err = mapZeekHeaderToParseType(
+		&BroHeader{Names: []string{"tunnel_parents"}, Types: []string{"table[addr]"}}, factory, nil, log.New(),
+	)
+	require.NotNil(t, err)
+	fieldMap, err = mapZeekHeaderToParseType(
+		&BroHeader{Names: []string{"tunnel_parents"}, Types: []string{"table[addr]"}}, factory,
+		map[string]string{"tunnel_parents": pt.AddrSet}, log.New(),
+	)
+	require.Nil(t, err)
+	require.Equal(t, pt.AddrSet, fieldMap.NthLogFieldType[0])
+}
+
+func TestMapZeekHeaderToParseTypeMismatch(t *testing.T) {
+	scanner := bufio.NewScanner(strings.NewReader(testConnLog))
+	header, err := scanTSVHeader(scanner)
+	require.Nil(t, err)
+	factory := pt.NewBroDataFactory(header.ObjType)
+
+	mismatched := *header
+	mismatched.Names = []string{"ts", "uid", "id.orig_h"}
+	mismatched.Types = []string{"time", "count", "addr"}
+
+	logger, hook := test.NewNullLogger()
+	_, err = mapZeekHeaderToParseType(&mismatched, factory, nil, logger)
+	require.EqualError(t, err, "type mismatch found in log: field uid is logged as count but string is expected")
+
+	// the mismatch is logged rather than silently dropped
+	entry := hook.LastEntry()
+	require.NotNil(t, entry)
+	require.Equal(t, log.ErrorLevel, entry.Level)
+	require.Equal(t, "uid", entry.Data["field"])
+	require.Equal(t, "count", entry.Data["type_in_log"])
+	require.Equal(t, "string", entry.Data["expected_type"])
+	require.Equal(t, err, entry.Data["error"])
+}
+
+//BenchmarkMapZeekHeaderToParseType maps the header of many files which share the same header.
+//The reflections/op metric reports how often the parse type's struct tags are read.
+func BenchmarkMapZeekHeaderToParseType(b *testing.B) {
+	scanner := bufio.NewScanner(strings.NewReader(testConnLog))
+	header, err := scanTSVHeader(scanner)
+	require.Nil(b, err)
+	factory := pt.NewBroDataFactory(header.ObjType)
+	logger := log.New()
+	logger.SetLevel(log.WarnLevel)
+
+	reflections := atomic.LoadUint64(&parseTypeReflections)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// each file is scanned into a new header
+		fileHeader := *header
+		fileHeader.Names = append([]string{}, header.Names...)
+		fileHeader.Types = append([]string{}, header.Types...)
+		_, err := mapZeekHeaderToParseType(&fileHeader, factory, nil, logger)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(atomic.LoadUint64(&parseTypeReflections)-reflections)/float64(b.N), "reflections/op")
+}
+
+func TestParseJSONMissingFields(t *testing.T) {
+	// an ssl entry without ja3 is parsed with the remaining fields
+	jsonLine := `{"ts":1517336042.090842,"uid":"CW32gzposD","id.orig_h":"10.0.0.1","id.orig_p":53542,` +
+		`"id.resp_h":"93.184.216.34","id.resp_p":443,"server_name":"example.com"}`
+	entry := parseTestJSON(t, jsonLine, "ssl").(*pt.SSL)
+	require.Equal(t, int64(1517336042), entry.TimeStamp)
+	require.Equal(t, "example.com", entry.ServerName)
+	require.Equal(t, "", entry.JA3)
+
+	// entries without any fields are left with zero values
+	for _, logType := range []string{"conn", "dhcp", "dns", "http", "open_conn", "ssl", "x509"} {
+		factory := pt.NewBroDataFactory(logType)
+		entry := parseTestJSON(t, `{}`, logType)
+		require.Equal(t, factory(), entry, "log type: %s", logType)
+	}
+}
+
+func TestParseJSONLineMalformed(t *testing.T) {
+	factory := pt.NewBroDataFactory("conn")
+	logger, hook := test.NewNullLogger()
+
+	for _, line := range []string{
+		// truncated after some of the fields were decoded
+		`{"ts":1517336042.090842,"uid":"CW32gzposD","id.orig_h":"10.0.0.1","id.orig_p":`,
+		// a field with the wrong type
+		`{"ts":1517336042.090842,"id.orig_p":"https"}`,
+		`not json`,
+	} {
+		hook.Reset()
+		entry, err := ParseJSONLine([]byte(line), factory, logger)
+		require.NotNil(t, err, line)
+		require.Nil(t, entry, line)
+		require.Len(t, hook.AllEntries(), 1)
+		require.Equal(t, log.ErrorLevel, hook.LastEntry().Level)
+	}
+}
+
+func TestParseTSVReorderedColumns(t *testing.T) {
+	// the columns are listed in a different order than the struct fields
+	// and only a subset of the struct fields are present
+	reordered := "#separator \\x09\n" +
+		"#set_separator\t,\n" +
+		"#empty_field\t(empty)\n" +
+		"#unset_field\t-\n" +
+		"#path\tssl\n" +
+		"#fields\tserver_name\tid.resp_p\tja3\tuid\tid.resp_h\tts\tid.orig_h\n" +
+		"#types\tstring\tport\tstring\tstring\taddr\ttime\taddr\n" +
+		"example.com\t443\te7d705a3286e19ea42f587b344ee6865\tCW32gzposD\t93.184.216.34\t1517336042.090842\t10.0.0.1\n"
+
+	expected := &pt.SSL{
+		TimeStamp:       1517336042,
+		UID:             "CW32gzposD",
+		Source:          "10.0.0.1",
+		Destination:     "93.184.216.34",
+		DestinationPort: 443,
+		ServerName:      "example.com",
+		JA3:             "e7d705a3286e19ea42f587b344ee6865",
+	}
+	require.Equal(t, expected, parseTestTSV(t, reordered))
+}
+
+func TestScanTSVHeaderMissingValues(t *testing.T) {
+	// header lines without values are ignored rather than causing a panic
+	contents := "#separator \\x09\n" +
+		"#set_separator\n" +
+		"#empty_field\t(empty)\n" +
+		"#unset_field\t-\n" +
+		"#path\tconn\n" +
+		"#open\n" +
+		"#fields\tts\tuid\n" +
+		"#types\ttime\tstring\n" +
+		"1517336042.090842\tCW32gzposD\n"
+
+	scanner := bufio.NewScanner(strings.NewReader(contents))
+	header, err := scanTSVHeader(scanner)
+	require.Nil(t, err)
+	require.Equal(t, []string{"ts", "uid"}, header.Names)
+	require.Equal(t, "", header.SetSep)
+}
+
+//testEVELog holds an EVE log with one event of each type RITA reads along with
+//events of other types which must be skipped
+var testEVELog = []string{
+	`{"timestamp":"2018-01-30T18:14:07.000000+0000","flow_id":1234567890,"in_iface":"eth0","event_type":"alert",` +
+		`"src_ip":"10.0.0.1","src_port":53542,"dest_ip":"93.184.216.34","dest_port":80,"proto":"TCP",` +
+		`"alert":{"action":"allowed","gid":1,"signature_id":2013028,"rev":7,"signature":"ET POLICY curl User-Agent Outbound",` +
+		`"category":"Attempted Information Leak","severity":2}}`,
+	`{"timestamp":"2018-01-30T18:14:03.500000+0000","flow_id":1234567890,"in_iface":"eth0","event_type":"http",` +
+		`"src_ip":"10.0.0.1","src_port":53542,"dest_ip":"93.184.216.34","dest_port":80,"proto":"TCP","tx_id":0,` +
+		`"http":{"hostname":"example.com","url":"/index.html","http_user_agent":"curl/7.58.0",` +
+		`"http_content_type":"text/html","http_method":"GET","protocol":"HTTP/1.1","status":200,"length":1256}}`,
+	`{"timestamp":"2018-01-30T18:15:10.000000+0000","flow_id":1234567890,"in_iface":"eth0","event_type":"flow",` +
+		`"src_ip":"10.0.0.1","src_port":53542,"dest_ip":"93.184.216.34","dest_port":80,"proto":"TCP","app_proto":"http",` +
+		`"flow":{"pkts_toserver":6,"pkts_toclient":5,"bytes_toserver":520,"bytes_toclient":1898,` +
+		`"start":"2018-01-30T18:14:02.090842+0000","end":"2018-01-30T18:14:04.590842+0000","age":2,` +
+		`"state":"closed","reason":"timeout","alerted":true}}`,
+	`{"timestamp":"2018-01-30T18:14:01.000000+0000","flow_id":987,"event_type":"dns","src_ip":"10.0.0.1",` +
+		`"src_port":5353,"dest_ip":"10.0.0.53","dest_port":53,"proto":"UDP",` +
+		`"dns":{"type":"query","id":1,"rrname":"example.com","rrtype":"A"}}`,
+	`{"timestamp":"2018-01-30T18:14:08.000000+0000","event_type":"stats","stats":{"uptime":8}}`,
+}
+
+func TestParseEVE(t *testing.T) {
+	var records []pt.BroData
+	for _, line := range testEVELog {
+		entry := parseTestJSON(t, line, "eve").(*pt.EVE)
+		if record := entry.Record(); record != nil {
+			records = append(records, record)
+		}
+	}
+
+	// only the http and flow events produce records, and only the flow event
+	// produces a connection record
+	require.Len(t, records, 2)
+
+	http := records[0].(*pt.HTTP)
+	require.Equal(t, "1234567890", http.UID)
+	require.Equal(t, int64(1517336043), http.TimeStamp)
+	require.Equal(t, int64(1517336043500000000), http.TimeStampNanos)
+	require.Equal(t, "10.0.0.1", http.Source)
+	require.Equal(t, "93.184.216.34", http.Destination)
+	require.Equal(t, "GET", http.Method)
+	require.Equal(t, "example.com", http.Host)
+	require.Equal(t, "/index.html", http.URI)
+	require.Equal(t, "curl/7.58.0", http.UserAgent)
+	require.Equal(t, "1.1", http.Version)
+	require.Equal(t, int64(200), http.StatusCode)
+
+	conn := records[1].(*pt.Conn)
+	require.Equal(t, "1234567890", conn.UID)
+	// the connection starts with the flow rather than when the flow was logged
+	require.Equal(t, int64(1517336042), conn.TimeStamp)
+	require.Equal(t, 2.5, conn.Duration)
+	require.Equal(t, "10.0.0.1", conn.Source)
+	require.Equal(t, 53542, conn.SourcePort)
+	require.Equal(t, "93.184.216.34", conn.Destination)
+	require.Equal(t, 80, conn.DestinationPort)
+	require.Equal(t, "tcp", conn.Proto)
+	require.Equal(t, "http", conn.Service)
+	require.Equal(t, int64(520), conn.OrigIPBytes)
+	require.Equal(t, int64(1898), conn.RespIPBytes)
+	require.Equal(t, int64(6), conn.OrigPkts)
+	require.Equal(t, int64(5), conn.RespPkts)
+
+	// the events share the flow's uid
+	uid, ok := pt.GetUID(parseTestJSON(t, testEVELog[0], "eve"))
+	require.True(t, ok)
+	require.Equal(t, conn.UID, uid)
+}
+
+func TestIndexFilesEVE(t *testing.T) {
+	dir, err := ioutil.TempDir("", "eve")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	// EVE logs are recognized by their events even if they aren't named eve.json,
+	// and even if the first event doesn't produce a record
+	evePath, _ := writeTestLog(t, dir, "suricata-sensor1.json", strings.Join(testEVELog, "\n")+"\n")
+
+	conf, err := config.LoadTestingConfig("")
+	require.Nil(t, err)
+	indexed := IndexFiles([]string{evePath}, 1, "test", 0, log.New(), conf)
+	require.Len(t, indexed, 1)
+	require.True(t, indexed[0].IsJSON())
+	require.Equal(t, conf.T.Structure.ConnTable, indexed[0].TargetCollection)
+	require.IsType(t, &pt.EVE{}, indexed[0].GetBroDataFactory()())
+}
@@ -24,6 +24,13 @@ type BroHeader struct {
 type ZeekHeaderIndexMap struct {
 	NthLogFieldExistsInParseType []bool
 	NthLogFieldParseTypeOffset   []int
+	// NthLogFieldNanosOffset holds the offset + 1 of the parse type field which receives
+	// the nth log field as a timestamp in nanoseconds, or 0 if there is no such field
+	NthLogFieldNanosOffset []int
+	// NthLogFieldType holds the Zeek type the nth log field is parsed as. This is the type
+	// declared in the header unless Parsing.TypeOverrides coerces the field into the type
+	// of its parse type field.
+	NthLogFieldType []string
 }
 
 //IndexedFile ties a file to a target collection and database
@@ -41,6 +48,12 @@ type IndexedFile struct {
 	broDataFactory   func() pt.BroData
 	fieldMap         ZeekHeaderIndexMap
 	json             bool
+	nfdumpHeader     *NfdumpHeader // set if the file holds nfdump's CSV output
+	resumeLine       int64         // lines ingested by a previous import
+	linesRead        int64         // lines read during this import, including resumed lines
+	complete         bool          // the whole file was read without error
+	parseErr         error         // set if parsing the file was aborted
+	pipe             *pipeFile     // set if the file is a named pipe which was left open by indexing
 }
 
 //The following functions are for interacting with the private data in
@@ -57,6 +70,21 @@ func (i *IndexedFile) SetJSON() {
 	i.json = true
 }
 
+//IsNfdumpCSV returns whether the file holds nfdump's CSV output
+func (i *IndexedFile) IsNfdumpCSV() bool {
+	return i.nfdumpHeader != nil
+}
+
+//SetNfdumpHeader sets the header of the nfdump CSV output held by the file
+func (i *IndexedFile) SetNfdumpHeader(header *NfdumpHeader) {
+	i.nfdumpHeader = header
+}
+
+//GetNfdumpHeader retrieves the header of the nfdump CSV output held by the file
+func (i *IndexedFile) GetNfdumpHeader() *NfdumpHeader {
+	return i.nfdumpHeader
+}
+
 //SetHeader sets the broHeader on the indexed file
 func (i *IndexedFile) SetHeader(header *BroHeader) {
 	i.header = header
@@ -90,3 +118,22 @@ func (i *IndexedFile) SetFieldMap(fieldMap ZeekHeaderIndexMap) {
 func (i *IndexedFile) GetFieldMap() ZeekHeaderIndexMap {
 	return i.fieldMap
 }
+
+//SetParseError records why parsing the file was aborted
+func (i *IndexedFile) SetParseError(err error) {
+	i.parseErr = err
+}
+
+//GetParseError retrieves why parsing the file was aborted, or nil if it wasn't
+func (i *IndexedFile) GetParseError() error {
+	return i.parseErr
+}
+
+//Open opens the file for parsing. Named pipes are parsed from the start of the
+//data read while indexing rather than opened again.
+func (i *IndexedFile) Open() (LogFile, error) {
+	if i.pipe != nil {
+		return i.pipe, nil
+	}
+	return OpenLogFile(i.Path)
+}
@@ -0,0 +1,229 @@
+package files
+
+import (
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	log "github.com/sirupsen/logrus"
+)
+
+//s3Scheme prefixes the paths of log files stored in S3, e.g. s3://bucket/prefix
+const s3Scheme = "s3://"
+
+type (
+	//LogFile is an open log file. *os.File satisfies this interface.
+	LogFile interface {
+		io.ReadCloser
+		Name() string
+		Stat() (os.FileInfo, error)
+	}
+
+	//FileSource finds and opens the log files stored in a location such
+	//as the local file system or an S3 bucket
+	FileSource interface {
+		//List returns the log files found at the given path
+		List(path string, logger *log.Logger) []string
+		//Open opens a log file for reading
+		Open(path string) (LogFile, error)
+		//Stat returns the size and modification time of a log file
+		Stat(path string) (os.FileInfo, error)
+	}
+
+	//localSource reads log files from the local file system
+	localSource struct{}
+
+	//s3Source reads log files from S3
+	s3Source struct {
+		once   sync.Once
+		client s3iface.S3API
+		err    error
+	}
+
+	//s3Object is the body of an S3 object being read
+	s3Object struct {
+		io.ReadCloser
+		info s3ObjectInfo
+	}
+
+	//s3ObjectInfo describes an S3 object as an os.FileInfo
+	s3ObjectInfo struct {
+		name    string
+		size    int64
+		modTime time.Time
+	}
+)
+
+//s3Files is shared by all of the S3 paths so the AWS session is only created once
+var s3Files = &s3Source{}
+
+//IsS3Path returns whether the path refers to a location in S3
+func IsS3Path(path string) bool {
+	return strings.HasPrefix(path, s3Scheme)
+}
+
+//sourceFor returns the FileSource which handles the given path
+func sourceFor(path string) FileSource {
+	if IsS3Path(path) {
+		return s3Files
+	}
+	return localSource{}
+}
+
+//OpenLogFile opens a log file from the local file system or S3
+func OpenLogFile(path string) (LogFile, error) {
+	return sourceFor(path).Open(path)
+}
+
+//isLogFile returns whether the name has the extension of a log file RITA can read
+func isLogFile(name string) bool {
+	return strings.HasSuffix(name, ".gz") || strings.HasSuffix(name, ".log") ||
+		strings.HasSuffix(name, ".json") || strings.HasSuffix(name, ".csv")
+}
+
+//List gathers the log files directly in a directory
+func (localSource) List(path string, logger *log.Logger) []string {
+	return gatherDir(path, logger)
+}
+
+//Open opens a local log file
+func (localSource) Open(path string) (LogFile, error) {
+	return os.Open(path)
+}
+
+//Stat returns the size and modification time of a local log file
+func (localSource) Stat(path string) (os.FileInfo, error) {
+	return os.Stat(path)
+}
+
+//init creates the S3 client using the standard AWS credential chain
+//(environment variables, shared config files, and instance roles)
+func (s *s3Source) init() error {
+	s.once.Do(func() {
+		if s.client != nil {
+			return
+		}
+		var sess *session.Session
+		sess, s.err = session.NewSessionWithOptions(session.Options{
+			SharedConfigState: session.SharedConfigEnable,
+		})
+		if s.err == nil {
+			s.client = s3.New(sess)
+		}
+	})
+	return s.err
+}
+
+//splitS3Path splits an s3://bucket/key path into the bucket and key
+func splitS3Path(path string) (bucket string, key string) {
+	trimmed := strings.TrimPrefix(path, s3Scheme)
+	if idx := strings.Index(trimmed, "/"); idx != -1 {
+		return trimmed[:idx], trimmed[idx+1:]
+	}
+	return trimmed, ""
+}
+
+//List gathers the log files in the bucket whose keys begin with the path's prefix
+func (s *s3Source) List(path string, logger *log.Logger) []string {
+	var toReturn []string
+
+	if err := s.init(); err != nil {
+		logger.WithFields(log.Fields{
+			"error": err.Error(),
+			"path":  path,
+		}).Error("Could not connect to S3")
+		return toReturn
+	}
+
+	bucket, prefix := splitS3Path(path)
+	err := s.client.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, object := range page.Contents {
+			key := aws.StringValue(object.Key)
+			if isLogFile(key) {
+				toReturn = append(toReturn, s3Scheme+bucket+"/"+key)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		logger.WithFields(log.Fields{
+			"error": err.Error(),
+			"path":  path,
+		}).Error("Error when listing S3 objects")
+	}
+	return toReturn
+}
+
+//Open streams the body of an S3 object
+func (s *s3Source) Open(path string) (LogFile, error) {
+	if err := s.init(); err != nil {
+		return nil, err
+	}
+
+	bucket, key := splitS3Path(path)
+	output, err := s.client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &s3Object{
+		ReadCloser: output.Body,
+		info: s3ObjectInfo{
+			name:    path,
+			size:    aws.Int64Value(output.ContentLength),
+			modTime: aws.TimeValue(output.LastModified),
+		},
+	}, nil
+}
+
+//Stat returns the size and modification time of an S3 object
+func (s *s3Source) Stat(path string) (os.FileInfo, error) {
+	if err := s.init(); err != nil {
+		return nil, err
+	}
+
+	bucket, key := splitS3Path(path)
+	output, err := s.client.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s3ObjectInfo{
+		name:    path,
+		size:    aws.Int64Value(output.ContentLength),
+		modTime: aws.TimeValue(output.LastModified),
+	}, nil
+}
+
+//Name returns the s3:// path of the object
+func (o *s3Object) Name() string {
+	return o.info.name
+}
+
+//Stat returns the size and modification time of the object
+func (o *s3Object) Stat() (os.FileInfo, error) {
+	return o.info, nil
+}
+
+func (i s3ObjectInfo) Name() string       { return path.Base(i.name) }
+func (i s3ObjectInfo) Size() int64        { return i.size }
+func (i s3ObjectInfo) Mode() os.FileMode  { return 0444 }
+func (i s3ObjectInfo) ModTime() time.Time { return i.modTime }
+func (i s3ObjectInfo) IsDir() bool        { return false }
+func (i s3ObjectInfo) Sys() interface{}   { return nil }
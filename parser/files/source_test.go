@@ -0,0 +1,163 @@
+package files
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/activecm/rita/config"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+const testConnLog = "#separator \\x09\n" +
+	"#set_separator\t,\n" +
+	"#empty_field\t(empty)\n" +
+	"#unset_field\t-\n" +
+	"#path\tconn\n" +
+	"#fields\tts\tuid\tid.orig_h\tid.orig_p\tid.resp_h\tid.resp_p\n" +
+	"#types\ttime\tstring\taddr\tport\taddr\tport\n" +
+	"1517336042.090842\tCW32gzposD\t10.0.0.1\t53542\t8.8.8.8\t53\n" +
+	"1517336043.090842\tCW32gzposE\t10.0.0.1\t53543\t8.8.8.8\t53\n"
+
+//mockS3 serves the objects of a single bucket over the S3 REST API
+func mockS3(t *testing.T, bucket string, objects map[string][]byte) *httptest.Server {
+	modified := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/")
+
+		// list the bucket's objects
+		if path == bucket && r.URL.Query().Get("list-type") == "2" {
+			prefix := r.URL.Query().Get("prefix")
+			var keys []string
+			for key := range objects {
+				if strings.HasPrefix(key, prefix) {
+					keys = append(keys, key)
+				}
+			}
+			sort.Strings(keys)
+
+			var contents strings.Builder
+			for _, key := range keys {
+				fmt.Fprintf(&contents, "<Contents><Key>%s</Key><Size>%d</Size></Contents>", key, len(objects[key]))
+			}
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>`+
+				`<ListBucketResult><Name>%s</Name><Prefix>%s</Prefix><KeyCount>%d</KeyCount>`+
+				`<IsTruncated>false</IsTruncated>%s</ListBucketResult>`,
+				bucket, prefix, len(keys), contents.String(),
+			)
+			return
+		}
+
+		// get or head an object
+		body, ok := objects[strings.TrimPrefix(path, bucket+"/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.Header().Set("Last-Modified", modified.Format(http.TimeFormat))
+		if r.Method == http.MethodGet {
+			w.Write(body)
+		}
+	}))
+}
+
+//useMockS3 points the S3 source at the mock server and returns a function to restore it
+func useMockS3(t *testing.T, server *httptest.Server) func() {
+	sess, err := session.NewSession(&aws.Config{
+		Endpoint:         aws.String(server.URL),
+		Region:           aws.String("us-east-1"),
+		S3ForcePathStyle: aws.Bool(true),
+		Credentials:      credentials.NewStaticCredentials("id", "secret", ""),
+	})
+	require.Nil(t, err)
+
+	original := s3Files
+	s3Files = &s3Source{client: s3.New(sess)}
+	return func() { s3Files = original }
+}
+
+func TestS3Source(t *testing.T) {
+	var gzipped bytes.Buffer
+	gzipWriter := gzip.NewWriter(&gzipped)
+	gzipWriter.Write([]byte(testConnLog))
+	gzipWriter.Close()
+
+	server := mockS3(t, "sensor", map[string][]byte{
+		"zeek/conn.log":       []byte(testConnLog),
+		"zeek/conn.01.log.gz": gzipped.Bytes(),
+		"zeek/notes.txt":      []byte("not a log"),
+		"other/dns.log":       []byte(testConnLog),
+	})
+	defer server.Close()
+	defer useMockS3(t, server)()
+
+	// only the log files under the prefix are gathered
+	paths := GatherLogFiles([]string{"s3://sensor/zeek/"}, nil, log.New())
+	require.Equal(t, []string{"s3://sensor/zeek/conn.01.log.gz", "s3://sensor/zeek/conn.log"}, paths)
+
+	// the objects are streamed through the same scanner as local files
+	for _, path := range paths {
+		fileHandle, err := OpenLogFile(path)
+		require.Nil(t, err)
+
+		scanner, closer, err := GetFileScanner(fileHandle, 0, 0)
+		require.Nil(t, err)
+
+		var lines []string
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+		// closing kills the gzip subprocess if it hasn't exited yet, which is reported
+		if err := closer(); err != nil {
+			require.EqualError(t, err, "signal: killed", path)
+		}
+		require.Equal(t, strings.Split(strings.TrimSuffix(testConnLog, "\n"), "\n"), lines, path)
+	}
+
+	// the objects are indexed like local files
+	conf, err := config.LoadTestingConfig("")
+	require.Nil(t, err)
+	indexed, err := newIndexedFile("s3://sensor/zeek/conn.log", "test", 0, log.New(), conf)
+	require.Nil(t, err)
+	require.Equal(t, int64(len(testConnLog)), indexed.Length)
+	require.Equal(t, conf.T.Structure.ConnTable, indexed.TargetCollection)
+
+	fInfo, err := sourceFor("s3://sensor/zeek/conn.log").Stat("s3://sensor/zeek/conn.log")
+	require.Nil(t, err)
+	require.Equal(t, indexed.ModTime, fInfo.ModTime())
+
+	// missing objects can't be opened
+	_, err = OpenLogFile("s3://sensor/zeek/missing.log")
+	require.NotNil(t, err)
+}
+
+func TestLocalSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "source")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path, _ := writeTestLog(t, dir, "conn.log", testConnLog)
+
+	fileHandle, err := OpenLogFile(path)
+	require.Nil(t, err)
+	defer fileHandle.Close()
+
+	fInfo, err := fileHandle.Stat()
+	require.Nil(t, err)
+	require.Equal(t, int64(len(testConnLog)), fInfo.Size())
+}
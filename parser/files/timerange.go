@@ -0,0 +1,143 @@
+package files
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+//FileTimeRange holds the time range named by a rotated log file as Unix timestamps.
+//Known is false if the time range couldn't be read from the name of the file, and End
+//is 0 if the name only gives the time the file was started.
+type FileTimeRange struct {
+	Path  string
+	Start int64
+	End   int64
+	Known bool
+}
+
+var (
+	//rotatedRangeRegex matches the dates and times of files rotated by zeekctl or sensors
+	//which name the whole time range, such as conn.2024-01-01-00:00:00-01:00:00.log.gz
+	//or conn_20240101_00:00:00-01:00:00+0000.log.gz. The UTC offset is optional.
+	rotatedRangeRegex = regexp.MustCompile(
+		`(?:^|[._])(\d{4}-\d{2}-\d{2}|\d{8})[-_T](\d{2}:\d{2}:\d{2})-(\d{2}:\d{2}:\d{2})([+-]\d{4})?(?:[._]|$)`)
+
+	//archivedRangeRegex matches the times of files archived by zeekctl into a directory
+	//named for their date, such as 2024-01-01/conn.00:00:00-01:00:00.log.gz
+	archivedRangeRegex = regexp.MustCompile(`(?:^|[._])(\d{2}:\d{2}:\d{2})-(\d{2}:\d{2}:\d{2})([+-]\d{4})?(?:[._]|$)`)
+	archiveDirRegex    = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+
+	//rotatedStartRegex matches the start time of files rotated by Zeek without zeekctl,
+	//such as conn.2024-01-01-00-00-00.log
+	rotatedStartRegex = regexp.MustCompile(`(?:^|[._])(\d{4}-\d{2}-\d{2})-(\d{2}-\d{2}-\d{2})(?:[._]|$)`)
+)
+
+//ParseFileTimeRange reads the time range from the name of a rotated log file. Times
+//without a UTC offset are read in the given location, or UTC if it is nil.
+func ParseFileTimeRange(path string, loc *time.Location) FileTimeRange {
+	if loc == nil {
+		loc = time.UTC
+	}
+	toReturn := FileTimeRange{Path: path}
+	name := filepath.Base(path)
+
+	if match := rotatedRangeRegex.FindStringSubmatch(name); match != nil {
+		date := strings.ReplaceAll(match[1], "-", "")
+		start, startErr := parseFileTime(date, match[2], match[4], loc)
+		end, endErr := parseFileTime(date, match[3], match[4], loc)
+		if startErr == nil && endErr == nil {
+			return newFileTimeRange(path, start, end)
+		}
+	}
+
+	if match := archivedRangeRegex.FindStringSubmatch(name); match != nil {
+		dir := filepath.Base(filepath.Dir(path))
+		if archiveDirRegex.MatchString(dir) {
+			date := strings.ReplaceAll(dir, "-", "")
+			start, startErr := parseFileTime(date, match[1], match[3], loc)
+			end, endErr := parseFileTime(date, match[2], match[3], loc)
+			if startErr == nil && endErr == nil {
+				return newFileTimeRange(path, start, end)
+			}
+		}
+	}
+
+	if match := rotatedStartRegex.FindStringSubmatch(name); match != nil {
+		start, err := time.ParseInLocation("2006-01-02 15-04-05", match[1]+" "+match[2], loc)
+		if err == nil {
+			toReturn.Start = start.Unix()
+			toReturn.Known = true
+		}
+	}
+
+	return toReturn
+}
+
+//parseFileTime parses a date (YYYYMMDD) and time (HH:MM:SS) read from the name of a file.
+//The time is read in the given location unless a UTC offset (+HHMM) is named.
+func parseFileTime(date string, clock string, offset string, loc *time.Location) (time.Time, error) {
+	if offset != "" {
+		return time.Parse("20060102 15:04:05 -0700", date+" "+clock+" "+offset)
+	}
+	return time.ParseInLocation("20060102 15:04:05", date+" "+clock, loc)
+}
+
+//newFileTimeRange creates the time range of a file from its start and end times. Files
+//which end at or before the time they started are rotated after midnight.
+func newFileTimeRange(path string, start time.Time, end time.Time) FileTimeRange {
+	if !end.After(start) {
+		end = end.AddDate(0, 0, 1)
+	}
+	return FileTimeRange{Path: path, Start: start.Unix(), End: end.Unix(), Known: true}
+}
+
+//InTimeWindow returns false if the file only holds records logged outside of the
+//window between since and until. Both bounds are inclusive and 0 leaves a bound open.
+//The window is widened by slack seconds on either side since records, such as those of
+//long lived connections, may be logged well after their timestamp. Files whose time range
+//isn't known are always in the window.
+func (r FileTimeRange) InTimeWindow(since int64, until int64, slack int64) bool {
+	if !r.Known {
+		return true
+	}
+	if until != 0 && r.Start > until+slack {
+		return false
+	}
+	if since != 0 && r.End != 0 && r.End < since-slack {
+		return false
+	}
+	return true
+}
+
+//SkipFilesOutsideTimeWindow drops the log files whose names show they only hold records
+//logged outside of the window between since and until. The names are read as described
+//by ParseFileTimeRange and the window is widened by slack seconds as described by
+//InTimeWindow. The files are not opened.
+func SkipFilesOutsideTimeWindow(paths []string, since int64, until int64, slack int64,
+	loc *time.Location, logger *log.Logger) []string {
+	if since == 0 && until == 0 {
+		return paths
+	}
+
+	var toReturn, skipped []string
+	for _, path := range paths {
+		if ParseFileTimeRange(path, loc).InTimeWindow(since, until, slack) {
+			toReturn = append(toReturn, path)
+		} else {
+			skipped = append(skipped, path)
+		}
+	}
+
+	if len(skipped) > 0 {
+		logger.WithFields(log.Fields{
+			"since":   since,
+			"until":   until,
+			"skipped": skipped,
+		}).Info("Skipped log files named for times outside of the time window")
+	}
+	return toReturn
+}
@@ -0,0 +1,104 @@
+package files
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFileTimeRange(t *testing.T) {
+	// 2024-01-01 00:00:00 UTC
+	const midnight = int64(1704067200)
+
+	newYork, err := time.LoadLocation("America/New_York")
+	require.Nil(t, err)
+
+	testCases := []struct {
+		path  string
+		loc   *time.Location
+		start int64
+		end   int64
+		known bool
+	}{
+		// rotated by zeekctl into a single directory
+		{"/logs/conn.2024-01-01-00:00:00-01:00:00.log.gz", nil, midnight, midnight + 3600, true},
+		{"/logs/dns.2024-01-01-13:00:00-14:00:00.log", time.UTC, midnight + 13*3600, midnight + 14*3600, true},
+		// archived by zeekctl into a directory for each day
+		{"/logs/2024-01-01/conn.00:00:00-01:00:00.log.gz", nil, midnight, midnight + 3600, true},
+		{"s3://sensor/zeek/2024-01-01/http.12:00:00-12:15:00.log.gz", nil, midnight + 12*3600, midnight + 12*3600 + 900, true},
+		// the last file of the day is rotated after midnight
+		{"/logs/2024-01-01/conn.23:00:00-00:00:00.log.gz", nil, midnight + 23*3600, midnight + 24*3600, true},
+		// named with a compact date and a UTC offset, which overrides the location
+		{"/logs/conn_20240101_00:00:00-01:00:00+0000.log.gz", newYork, midnight, midnight + 3600, true},
+		{"/logs/conn_20240101_00:00:00-01:00:00-0500.log.gz", nil, midnight + 5*3600, midnight + 6*3600, true},
+		// rotated by Zeek without zeekctl, which only names the start
+		{"/logs/conn.2024-01-01-00-00-00.log", nil, midnight, 0, true},
+		// the times are read in the configured location
+		{"/logs/conn.2024-01-01-00:00:00-01:00:00.log.gz", newYork, midnight + 5*3600, midnight + 6*3600, true},
+		// names without a time range
+		{"/logs/conn.log", nil, 0, 0, false},
+		{"/logs/conn.00:00:00-01:00:00.log.gz", nil, 0, 0, false},
+		{"/logs/current/conn.00:00:00-01:00:00.log.gz", nil, 0, 0, false},
+		{"/logs/conn.2024-13-45-00:00:00-01:00:00.log.gz", nil, 0, 0, false},
+		{"/logs/conn.2024-01-01.log", nil, 0, 0, false},
+	}
+
+	for _, testCase := range testCases {
+		timeRange := ParseFileTimeRange(testCase.path, testCase.loc)
+		require.Equal(t, FileTimeRange{
+			Path: testCase.path, Start: testCase.start, End: testCase.end, Known: testCase.known,
+		}, timeRange, testCase.path)
+	}
+}
+
+func TestFileTimeRangeInTimeWindow(t *testing.T) {
+	hour := FileTimeRange{Start: 1000, End: 4600, Known: true}
+
+	require.True(t, hour.InTimeWindow(0, 0, 0))
+	require.True(t, hour.InTimeWindow(4600, 0, 0))
+	require.True(t, hour.InTimeWindow(0, 1000, 0))
+	require.True(t, hour.InTimeWindow(2000, 3000, 0))
+	require.False(t, hour.InTimeWindow(4601, 0, 0))
+	require.False(t, hour.InTimeWindow(0, 999, 0))
+
+	// the window is widened by the slack
+	require.True(t, hour.InTimeWindow(4700, 0, 100))
+	require.True(t, hour.InTimeWindow(0, 900, 100))
+	require.False(t, hour.InTimeWindow(4701, 900, 100))
+
+	// files which only name their start may hold records logged at any later time
+	started := FileTimeRange{Start: 1000, Known: true}
+	require.True(t, started.InTimeWindow(100000, 0, 0))
+	require.False(t, started.InTimeWindow(0, 999, 0))
+
+	// files without a time range are always in the window
+	require.True(t, FileTimeRange{}.InTimeWindow(100000, 200000, 0))
+}
+
+func TestSkipFilesOutsideTimeWindow(t *testing.T) {
+	paths := []string{
+		"/logs/2024-01-01/conn.00:00:00-01:00:00.log.gz",
+		"/logs/2024-01-01/conn.01:00:00-02:00:00.log.gz",
+		"/logs/2024-01-01/conn.02:00:00-03:00:00.log.gz",
+		"/logs/conn.log",
+	}
+
+	// 2024-01-01 01:30:00 UTC to 01:45:00 UTC
+	since, until := int64(1704072600), int64(1704073500)
+
+	logger, hook := test.NewNullLogger()
+	kept := SkipFilesOutsideTimeWindow(paths, since, until, 0, nil, logger)
+	require.Equal(t, []string{paths[1], paths[3]}, kept)
+	require.Len(t, hook.Entries, 1)
+	require.Equal(t, []string{paths[0], paths[2]}, hook.LastEntry().Data["skipped"])
+
+	// the slack keeps the neighboring files
+	require.Equal(t, paths, SkipFilesOutsideTimeWindow(paths, since, until, 3600, nil, logger))
+
+	// nothing is skipped without a window
+	hook.Reset()
+	require.Equal(t, paths, SkipFilesOutsideTimeWindow(paths, 0, 0, 0, nil, logger))
+	require.Empty(t, hook.Entries)
+}
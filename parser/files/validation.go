@@ -0,0 +1,150 @@
+package files
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+
+	"github.com/activecm/rita/config"
+	pt "github.com/activecm/rita/parser/parsetypes"
+	log "github.com/sirupsen/logrus"
+)
+
+//the formats of the log files RITA reads
+const (
+	FormatTSV       = "TSV"
+	FormatJSON      = "JSON"
+	FormatNfdumpCSV = "nfdump CSV"
+)
+
+//FileValidation describes how the header of a log file would be read by an import.
+//Warnings hold the problems which would keep some or all of the file from being
+//imported. Err is set if the file couldn't be read at all.
+type FileValidation struct {
+	Path       string
+	LogType    string
+	Format     string
+	FieldCount int
+	Warnings   []string
+	Err        error
+}
+
+//ValidateLogFiles checks the headers of the log files which would be gathered from the
+//paths by an import, without parsing the rest of the files. Named pipes are skipped since
+//reading their headers would consume them.
+func ValidateLogFiles(paths []string, conf *config.Config, logger *log.Logger) []FileValidation {
+	var results []FileValidation
+	for _, path := range GatherLogFiles(paths, nil, logger) {
+		if isNamedPipePath(path) {
+			logger.WithFields(log.Fields{
+				"path": path,
+			}).Warn("Skipping validation of named pipe")
+			continue
+		}
+		results = append(results, validateLogFile(path, conf, logger))
+	}
+	return results
+}
+
+//validateLogFile reads the header of a log file the same way newIndexedFile does and
+//checks that it maps onto a parse type
+func validateLogFile(path string, conf *config.Config, logger *log.Logger) FileValidation {
+	result := FileValidation{Path: path}
+
+	fileHandle, err := OpenLogFile(path)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	scanner, closeScanner, err := GetFileScanner(fileHandle, conf.S.Parsing.MaxLineLength, 0)
+	defer closeScanner()
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	header, err := scanTSVHeader(scanner)
+	if err != nil {
+		// the header was found, but it can't be used
+		result.Format = FormatTSV
+		result.LogType = header.ObjType
+		result.FieldCount = len(header.Names)
+		result.Warnings = append(result.Warnings, fmt.Sprintf("malformed header: %v", err))
+		return result
+	}
+
+	var broDataFactory func() pt.BroData
+	if header.ObjType != "" {
+		result.Format = FormatTSV
+		result.LogType = header.ObjType
+		result.FieldCount = len(header.Names)
+		broDataFactory = pt.NewBroDataFactory(header.ObjType)
+	} else if scanner.Err() == nil && isNfdumpHeader(scanner.Text()) {
+		result.Format = FormatNfdumpCSV
+		result.LogType = "netflow"
+		result.FieldCount = newNfdumpHeader(scanner.Text()).fields
+		broDataFactory = pt.NewBroDataFactory("netflow")
+	} else if scanner.Err() == nil && len(scanner.Bytes()) > 0 && json.Valid(scanner.Bytes()) {
+		result.Format = FormatJSON
+		var fields map[string]interface{}
+		json.Unmarshal(scanner.Bytes(), &fields)
+		result.FieldCount = len(fields)
+
+		// the log type is found the same way it is when the file is indexed
+		logPath, _ := fields["_path"].(string)
+		eventType, _ := fields["event_type"].(string)
+		result.LogType = logPath
+		broDataFactory = pt.NewBroDataFactory(logPath)
+		if broDataFactory == nil && eventType != "" {
+			result.LogType = "eve"
+			broDataFactory = pt.NewBroDataFactory("eve")
+		}
+		if broDataFactory == nil {
+			result.LogType = filepath.Base(path)
+			broDataFactory = pt.NewBroDataFactory(result.LogType)
+		}
+	} else {
+		if scanner.Err() != nil {
+			result.Err = scanner.Err()
+		} else {
+			result.Err = errors.New("could not find a TSV header, nfdump CSV header, or JSON record")
+		}
+		return result
+	}
+
+	if broDataFactory == nil {
+		result.Warnings = append(result.Warnings,
+			fmt.Sprintf("log type %q does not map to a known parse type", result.LogType))
+		return result
+	}
+
+	// the fields of JSON logs and nfdump's CSV output are matched by name when they are parsed
+	if result.Format != FormatTSV {
+		return result
+	}
+
+	mappedHeader, err := selectTimestampField(header, conf.S.Parsing.TimestampFields[header.ObjType], logger)
+	if err != nil {
+		result.Warnings = append(result.Warnings, err.Error())
+		return result
+	}
+	_, err = mapZeekHeaderToParseType(mappedHeader, broDataFactory, conf.S.Parsing.TypeOverrides[header.ObjType], logger)
+	if err != nil {
+		result.Warnings = append(result.Warnings, err.Error())
+	}
+
+	typeInfo, err := getParseTypeInfo(reflect.TypeOf(broDataFactory()).Elem())
+	if err != nil {
+		result.Warnings = append(result.Warnings, err.Error())
+		return result
+	}
+	for _, name := range mappedHeader.Names {
+		if _, ok := typeInfo.fields[name]; !ok {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("field %s is not imported", name))
+		}
+	}
+	return result
+}
@@ -0,0 +1,36 @@
+package files
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/activecm/rita/config"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateLogFiles(t *testing.T) {
+	conf, err := config.LoadTestingConfig("")
+	require.Nil(t, err)
+	logger, _ := test.NewNullLogger()
+
+	results := ValidateLogFiles([]string{filepath.Join("testdata", "validate")}, conf, logger)
+	require.Len(t, results, 2)
+
+	byType := make(map[string]FileValidation)
+	for _, result := range results {
+		require.Nil(t, result.Err)
+		require.Equal(t, FormatTSV, result.Format)
+		byType[result.LogType] = result
+	}
+
+	conn := byType["conn"]
+	require.Equal(t, 12, conn.FieldCount)
+	require.Empty(t, conn.Warnings)
+
+	// the query is logged as a count rather than a string
+	dns := byType["dns"]
+	require.Equal(t, 7, dns.FieldCount)
+	require.Len(t, dns.Warnings, 1)
+	require.Contains(t, dns.Warnings[0], "type mismatch found in log: field query")
+}
@@ -0,0 +1,18 @@
+package files
+
+//Watermark records the newest record of a log type ingested into a database. The
+//records logged within the overlap window before the watermark are listed by the hashes
+//of their lines so appending imports can tell which of them were already ingested.
+type Watermark struct {
+	Database string         `bson:"database"`
+	LogType  string         `bson:"log_type"`
+	Ts       int64          `bson:"ts"`
+	Keys     []WatermarkKey `bson:"keys"`
+}
+
+//WatermarkKey holds the hash of a line ingested within the overlap window of a
+//watermark along with the timestamp of its record
+type WatermarkKey struct {
+	Hash int64 `bson:"hash"`
+	Ts   int64 `bson:"ts"`
+}
@@ -2,15 +2,19 @@ package parser
 
 import (
 	"net"
+	"strings"
 
 	"github.com/activecm/rita/config"
+	"github.com/activecm/rita/parser/parsetypes"
+	"github.com/activecm/rita/pkg/data"
 	"github.com/activecm/rita/util"
 )
 
 // filter provides methods for excluding IP addresses, domains, and determining proxy servers during the import step
 // based on the user configuration
 type filter struct {
-	internal       []*net.IPNet
+	// the internal subnets are compiled once since every connection's direction is tagged with them
+	internal       data.InternalSubnets
 	alwaysIncluded []*net.IPNet
 	neverIncluded  []*net.IPNet
 
@@ -18,26 +22,54 @@ type filter struct {
 	neverIncludedDomain  []string
 
 	filterExternalToInternal bool
+
+	// records logged before since or after until are dropped. 0 leaves the bound open.
+	since int64
+	until int64
+
+	// Zeek conn history flags a connection must hold all of, or none of, to count toward beacons
+	requiredHistory string
+	excludedHistory string
 }
 
 func newFilter(conf *config.Config) filter {
 	return filter{
-		internal:                 util.ParseSubnets(conf.S.Filtering.InternalSubnets),
+		internal:                 data.NewInternalSubnetsFromNets(util.ParseSubnets(conf.S.Filtering.InternalSubnets)),
 		alwaysIncluded:           util.ParseSubnets(conf.S.Filtering.AlwaysInclude),
 		neverIncluded:            util.ParseSubnets(conf.S.Filtering.NeverInclude),
 		alwaysIncludedDomain:     conf.S.Filtering.AlwaysIncludeDomain,
 		neverIncludedDomain:      conf.S.Filtering.NeverIncludeDomain,
 		filterExternalToInternal: conf.S.Filtering.FilterExternalToInternal,
+		since:                    conf.S.Parsing.Since,
+		until:                    conf.S.Parsing.Until,
+		requiredHistory:          conf.S.Beacon.RequiredHistory,
+		excludedHistory:          conf.S.Beacon.ExcludedHistory,
+	}
+}
+
+// filterConnHistory returns true if a connection is left out of the beacon analysis based on
+// the flags of its Zeek history. The connection must hold every required flag and none of the
+// excluded flags. Connections without a history are never left out since their state is unknown.
+func (fs *filter) filterConnHistory(history string) bool {
+	if history == "" || history == "-" {
+		return false
+	}
+
+	for _, flag := range fs.requiredHistory {
+		if !strings.ContainsRune(history, flag) {
+			return true
+		}
 	}
+	return strings.ContainsAny(history, fs.excludedHistory)
 }
 
 // filterConnPair returns true if a connection pair is filtered/excluded.
 // This is determined by the following rules, in order:
-//   1. Not filtered if either IP is on the AlwaysInclude list
-//   2. Filtered if either IP is on the NeverInclude list
-//   3. Not filtered if InternalSubnets is empty
-//   4. Filtered if both IPs are internal or both are external
-//   5. Not filtered in all other cases
+//  1. Not filtered if either IP is on the AlwaysInclude list
+//  2. Filtered if either IP is on the NeverInclude list
+//  3. Not filtered if InternalSubnets is empty
+//  4. Filtered if both IPs are internal or both are external
+//  5. Not filtered in all other cases
 func (fs *filter) filterConnPair(srcIP net.IP, dstIP net.IP) bool {
 	// check if on always included list
 	isSrcIncluded := util.ContainsIP(fs.alwaysIncluded, srcIP)
@@ -59,13 +91,13 @@ func (fs *filter) filterConnPair(srcIP net.IP, dstIP net.IP) bool {
 
 	// if no internal subnets are defined, filter does not apply
 	// this is was the default behavior before InternalSubnets was added
-	if len(fs.internal) == 0 {
+	if len(fs.internal.Subnets()) == 0 {
 		return false
 	}
 
 	// check if src and dst are internal
-	isSrcInternal := util.ContainsIP(fs.internal, srcIP)
-	isDstInternal := util.ContainsIP(fs.internal, dstIP)
+	isSrcInternal := fs.internal.Contains(srcIP)
+	isDstInternal := fs.internal.Contains(dstIP)
 
 	// if both addresses are internal, filter applies
 	if isSrcInternal && isDstInternal {
@@ -88,9 +120,9 @@ func (fs *filter) filterConnPair(srcIP net.IP, dstIP net.IP) bool {
 
 // filterSingleIP returns true if an IP is filtered/excluded.
 // This is determined by the following rules, in order:
-//   1. Not filtered IP is on the AlwaysInclude list
-//   2. Filtered IP is on the NeverInclude list
-//   3. Not filtered in all other cases
+//  1. Not filtered IP is on the AlwaysInclude list
+//  2. Filtered IP is on the NeverInclude list
+//  3. Not filtered in all other cases
 func (fs *filter) filterSingleIP(IP net.IP) bool {
 	// check if on always included list
 	if util.ContainsIP(fs.alwaysIncluded, IP) {
@@ -108,9 +140,9 @@ func (fs *filter) filterSingleIP(IP net.IP) bool {
 
 // filterDomain returns true if a domain is filtered/excluded.
 // This is determined by the following rules, in order:
-//   1. Not filtered if domain is on the AlwaysInclude list
-//   2. Filtered if domain is on the NeverInclude list
-//   5. Not filtered in all other cases
+//  1. Not filtered if domain is on the AlwaysInclude list
+//  2. Filtered if domain is on the NeverInclude list
+//  5. Not filtered in all other cases
 func (fs *filter) filterDomain(domain string) bool {
 	// check if on always included list
 	isDomainIncluded := util.ContainsDomain(fs.alwaysIncludedDomain, domain)
@@ -132,6 +164,59 @@ func (fs *filter) filterDomain(domain string) bool {
 	return false
 }
 
+// hasTimeWindow returns true if records are limited to a time window
+func (fs *filter) hasTimeWindow() bool {
+	return fs.since != 0 || fs.until != 0
+}
+
+// filterTimestamp returns true if a record's timestamp is filtered/excluded.
+// Both bounds of the time window are inclusive. This is determined by the following rules, in order:
+//  1. Not filtered if no time window is set
+//  2. Filtered if the timestamp could not be parsed (negative)
+//  3. Filtered if the timestamp is before since or after until
+//  4. Not filtered in all other cases
+func (fs *filter) filterTimestamp(ts int64) bool {
+	if !fs.hasTimeWindow() {
+		return false
+	}
+
+	if ts < 0 {
+		return true
+	}
+
+	if fs.since != 0 && ts < fs.since {
+		return true
+	}
+
+	if fs.until != 0 && ts > fs.until {
+		return true
+	}
+
+	return false
+}
+
+// entryTimestamp returns the timestamp of a parsed record. The second return
+// value is false if the record does not have a timestamp.
+func entryTimestamp(entry parsetypes.BroData) (int64, bool) {
+	switch typedEntry := entry.(type) {
+	case *parsetypes.Conn:
+		return typedEntry.TimeStamp, true
+	case *parsetypes.DHCP:
+		return typedEntry.TimeStamp, true
+	case *parsetypes.DNS:
+		return typedEntry.TimeStamp, true
+	case *parsetypes.HTTP:
+		return typedEntry.TimeStamp, true
+	case *parsetypes.OpenConn:
+		return typedEntry.TimeStamp, true
+	case *parsetypes.SSL:
+		return typedEntry.TimeStamp, true
+	case *parsetypes.X509:
+		return typedEntry.TimeStamp, true
+	}
+	return 0, false
+}
+
 func (fs *filter) checkIfInternal(host net.IP) bool {
-	return util.ContainsIP(fs.internal, host)
+	return fs.internal.Contains(host)
 }
@@ -4,6 +4,8 @@ import (
 	"net"
 	"testing"
 
+	"github.com/activecm/rita/parser/parsetypes"
+	"github.com/activecm/rita/pkg/data"
 	"github.com/activecm/rita/util"
 	"github.com/stretchr/testify/assert"
 )
@@ -30,7 +32,7 @@ type testCaseSingleIP struct {
 func TestFilterConnPairWithInternalSubnets(t *testing.T) {
 
 	fsTest := &filter{
-		internal:                 util.ParseSubnets([]string{"10.0.0.0/8"}),
+		internal:                 data.NewInternalSubnetsFromNets(util.ParseSubnets([]string{"10.0.0.0/8"})),
 		alwaysIncluded:           util.ParseSubnets([]string{"10.0.0.1/32", "10.0.0.3/32", "1.1.1.1/32", "1.1.1.3/32"}),
 		neverIncluded:            util.ParseSubnets([]string{"10.0.0.2/32", "10.0.0.3/32", "1.1.1.2/32", "1.1.1.3/32"}),
 		filterExternalToInternal: false,
@@ -118,7 +120,7 @@ func TestFilterConnPairWithoutInternalSubnets(t *testing.T) {
 func TestFilterConnPairExternalToInternal(t *testing.T) {
 
 	fsTest := &filter{
-		internal:                 util.ParseSubnets([]string{"10.0.0.0/8"}),
+		internal:                 data.NewInternalSubnetsFromNets(util.ParseSubnets([]string{"10.0.0.0/8"})),
 		alwaysIncluded:           util.ParseSubnets([]string{"10.0.0.1/32", "10.0.0.3/32", "1.1.1.1/32", "1.1.1.3/32"}),
 		filterExternalToInternal: true,
 	}
@@ -154,7 +156,7 @@ func TestFilterConnPairExternalToInternal(t *testing.T) {
 func TestFilterDomain(t *testing.T) {
 
 	fsTest := &filter{
-		internal:             util.ParseSubnets([]string{"10.0.0.0/8"}),
+		internal:             data.NewInternalSubnetsFromNets(util.ParseSubnets([]string{"10.0.0.0/8"})),
 		alwaysIncluded:       util.ParseSubnets([]string{"10.0.0.1/32", "10.0.0.3/32", "1.1.1.1/32", "1.1.1.3/32"}),
 		neverIncluded:        util.ParseSubnets([]string{"10.0.0.2/32", "10.0.0.3/32", "1.1.1.2/32", "1.1.1.3/32"}),
 		alwaysIncludedDomain: []string{"bad.com", "google.com", "*.myotherdomain.com"},
@@ -207,3 +209,79 @@ func TestFilterSingleIP(t *testing.T) {
 		assert.Equal(t, test.out, output, test.msg)
 	}
 }
+
+func TestFilterTimestamp(t *testing.T) {
+	type testCaseTimestamp struct {
+		fs  filter
+		ts  int64
+		out bool
+		msg string
+	}
+
+	window := filter{since: 1517336000, until: 1517339600}
+	sinceOnly := filter{since: 1517336000}
+	untilOnly := filter{until: 1517339600}
+
+	testCases := []testCaseTimestamp{
+		{filter{}, 0, false, "No window should not filter"},
+		{filter{}, -1, false, "No window should not filter unparsable timestamps"},
+		{window, 1517336000, false, "Since should be inclusive"},
+		{window, 1517339600, false, "Until should be inclusive"},
+		{window, 1517337000, false, "Timestamp within the window should not be filtered"},
+		{window, 1517335999, true, "Timestamp before since should be filtered"},
+		{window, 1517339601, true, "Timestamp after until should be filtered"},
+		{window, -1, true, "Unparsable timestamp should be filtered"},
+		{sinceOnly, 1517335999, true, "Timestamp before since should be filtered"},
+		{sinceOnly, 1617336000, false, "Open until should not filter"},
+		{untilOnly, 1517339601, true, "Timestamp after until should be filtered"},
+		{untilOnly, 0, false, "Open since should not filter"},
+		{untilOnly, -1, true, "Unparsable timestamp should be filtered"},
+	}
+
+	for _, test := range testCases {
+		output := test.fs.filterTimestamp(test.ts)
+		assert.Equal(t, test.out, output, test.msg)
+	}
+}
+
+func TestFilterConnHistory(t *testing.T) {
+	type testCaseHistory struct {
+		fs      filter
+		history string
+		out     bool
+		msg     string
+	}
+
+	handshake := filter{requiredHistory: "Sh"}
+	noResets := filter{excludedHistory: "Rr"}
+
+	testCases := []testCaseHistory{
+		{filter{}, "S", false, "No flags should not filter"},
+		{handshake, "ShADadFf", false, "Established connection should not be filtered"},
+		{handshake, "S", true, "SYN only connection should be filtered"},
+		{handshake, "SH", true, "Flags should be matched case sensitively"},
+		{handshake, "", false, "Empty history should not be filtered"},
+		{handshake, "-", false, "Unset history should not be filtered"},
+		{noResets, "ShADadr", true, "Excluded flag should be filtered"},
+		{noResets, "ShADadFf", false, "Connection without excluded flags should not be filtered"},
+		{noResets, "", false, "Empty history should not be filtered"},
+	}
+
+	for _, test := range testCases {
+		output := test.fs.filterConnHistory(test.history)
+		assert.Equal(t, test.out, output, test.msg)
+	}
+}
+
+func TestEntryTimestamp(t *testing.T) {
+	ts, ok := entryTimestamp(&parsetypes.Conn{TimeStamp: 1517336042})
+	assert.True(t, ok)
+	assert.Equal(t, int64(1517336042), ts)
+
+	// JSON records hold the timestamp once they are converted
+	http := &parsetypes.HTTP{TimeStampGeneric: 1517336042.090842}
+	http.ConvertFromJSON()
+	ts, ok = entryTimestamp(http)
+	assert.True(t, ok)
+	assert.Equal(t, int64(1517336042), ts)
+}
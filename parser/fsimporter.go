@@ -1,15 +1,16 @@
 package parser
 
 import (
+	"context"
 	"fmt"
 	"net"
-	"os"
 	"sort"
 	"sync"
 	"time"
 
 	"github.com/activecm/rita/config"
 	"github.com/activecm/rita/database"
+	"github.com/activecm/rita/metrics"
 	"github.com/activecm/rita/parser/files"
 	"github.com/activecm/rita/parser/parsetypes"
 	"github.com/activecm/rita/pkg/beacon"
@@ -17,6 +18,7 @@ import (
 	"github.com/activecm/rita/pkg/beaconproxy"
 	"github.com/activecm/rita/pkg/blacklist"
 	"github.com/activecm/rita/pkg/certificate"
+	"github.com/activecm/rita/pkg/data"
 	"github.com/activecm/rita/pkg/explodeddns"
 	"github.com/activecm/rita/pkg/host"
 	"github.com/activecm/rita/pkg/hostname"
@@ -25,17 +27,22 @@ import (
 	"github.com/activecm/rita/pkg/uconnproxy"
 	"github.com/activecm/rita/pkg/useragent"
 	"github.com/activecm/rita/resources"
+	"github.com/activecm/rita/tracing"
 	"github.com/activecm/rita/util"
 
 	"github.com/globalsign/mgo/bson"
 	"github.com/pbnjay/memory"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 )
 
 type (
 	//FSImporter provides the ability to import bro files from the file system
 	FSImporter struct {
 		filter
+		proxyFields    proxyFields
+		defaultNetwork defaultNetwork
 
 		log      *log.Logger
 		config   *config.Config
@@ -43,6 +50,15 @@ type (
 		metaDB   *database.MetaDB
 
 		batchSizeBytes int64
+
+		// when appending, the records ingested by earlier imports are dropped and the
+		// rest are added to the current chunk
+		appending  bool
+		watermarks *watermarkFilter
+
+		// the spans of the import are created as children of the span held by traceCtx,
+		// and the analyses stop once it is cancelled
+		traceCtx context.Context
 	}
 
 	trustedAppTiplet struct {
@@ -58,14 +74,40 @@ func NewFSImporter(res *resources.Resources) *FSImporter {
 	batchSize := int64(util.MaxUint64(4*(1<<30), (memory.TotalMemory() / 2)))
 	return &FSImporter{
 		filter:         newFilter(res.Config),
+		proxyFields:    newProxyFields(res.Config),
+		defaultNetwork: newDefaultNetwork(res.Config),
 		log:            res.Log,
 		config:         res.Config,
 		database:       res.DB,
 		metaDB:         res.MetaDB,
 		batchSizeBytes: batchSize,
+		traceCtx:       context.Background(),
 	}
 }
 
+//EnableAppend makes the import add the records logged after those ingested by earlier
+//imports of each log type to the current chunk rather than replacing the chunk. The
+//records logged up to Parsing.AppendOverlap seconds before the newest ingested record
+//are only dropped if their lines were ingested before.
+func (fs *FSImporter) EnableAppend() {
+	fs.appending = true
+}
+
+//SetTraceContext sets the context holding the span of the run the import is part of.
+//The spans created while importing are recorded as its children. Once ctx is cancelled,
+//the analyses stop and the import returns after the current batch.
+func (fs *FSImporter) SetTraceContext(ctx context.Context) {
+	fs.traceCtx = ctx
+}
+
+//traceContext returns the context holding the span of the run the import is part of
+func (fs *FSImporter) traceContext() context.Context {
+	if fs.traceCtx == nil {
+		return context.Background()
+	}
+	return fs.traceCtx
+}
+
 var trustedAppReferenceList = [...]trustedAppTiplet{
 	{"tcp", 80, "http"},
 	{"tcp", 443, "ssl"},
@@ -73,22 +115,57 @@ var trustedAppReferenceList = [...]trustedAppTiplet{
 
 //GetInternalSubnets returns the internal subnets from the config file
 func (fs *FSImporter) GetInternalSubnets() []*net.IPNet {
-	return fs.internal
+	return fs.internal.Subnets()
 }
 
-//CollectFileDetails reads and hashes the files
-func (fs *FSImporter) CollectFileDetails(importFiles []string, threads int) []*files.IndexedFile {
+//CollectFileDetails reads and hashes the files. If resume is set, files which were
+//ingested by earlier imports are skipped or resumed according to their checkpoints.
+func (fs *FSImporter) CollectFileDetails(importFiles []string, threads int, resume bool) []*files.IndexedFile {
+	// look up how much of each file has been ingested by earlier imports
+	var checkpoints map[string]files.Checkpoint
+	if resume {
+		var err error
+		checkpoints, err = fs.metaDB.GetCheckpoints(fs.database.GetSelectedDB())
+		if err != nil {
+			fmt.Println("\t[!] Could not read parsing checkpoints, all files will be parsed from the start")
+		}
+	}
+
 	// find all of the potential bro log paths
-	logFiles := files.GatherLogFiles(importFiles, fs.log)
+	_, span := tracing.Start(fs.traceContext(), "GatherLogFiles", attribute.Int("rita.paths", len(importFiles)))
+	logFiles := files.GatherLogFiles(importFiles, checkpoints, fs.log)
+	if timeRange := fs.config.S.Parsing.FilenameTimeRange; timeRange.Enabled {
+		gathered := len(logFiles)
+		logFiles = files.SkipFilesOutsideTimeWindow(logFiles, fs.config.S.Parsing.Since, fs.config.S.Parsing.Until,
+			timeRange.Slack, fs.config.R.Parsing.FilenameLocation, fs.log)
+		if skipped := gathered - len(logFiles); skipped > 0 {
+			fmt.Printf("\t[-] Skipping %d log files named for times outside of the time window\n", skipped)
+		}
+	}
+	if maxFiles := fs.config.S.Parsing.MaxFiles; maxFiles > 0 && len(logFiles) > maxFiles {
+		fmt.Printf("\t[!] Only importing the first %d of %d log files\n", maxFiles, len(logFiles))
+		logFiles = files.LimitLogFiles(logFiles, maxFiles, fs.log)
+	}
+	span.SetAttributes(attribute.Int("rita.files", len(logFiles)))
+	span.End()
+	if len(logFiles) == 0 {
+		fmt.Println("\t[!] All log files have already been ingested into: ", fs.database.GetSelectedDB())
+		return nil
+	}
 
 	// hash the files and get their stats
-	return files.IndexFiles(
+	indexedFiles := files.IndexFiles(
 		logFiles, threads, fs.database.GetSelectedDB(), fs.config.S.Rolling.CurrentChunk, fs.log, fs.config,
 	)
+
+	// resume the files which were partially ingested
+	files.ApplyCheckpoints(indexedFiles, checkpoints, fs.log)
+	return indexedFiles
 }
 
-//Run starts the importing
-func (fs *FSImporter) Run(indexedFiles []*files.IndexedFile, threads int) {
+//Run starts the importing. An error is returned if the parsing of any file was aborted
+//because too many of its lines failed to parse. The other files are still imported.
+func (fs *FSImporter) Run(indexedFiles []*files.IndexedFile, threads int) error {
 	start := time.Now()
 
 	fmt.Println("\t[-] Verifying log files have not been previously parsed into the target dataset ... ")
@@ -103,9 +180,117 @@ func (fs *FSImporter) Run(indexedFiles []*files.IndexedFile, threads int) {
 		} else {
 			fmt.Println("\t[!] All files in this directory have already been parsed into database: ", fs.database.GetSelectedDB())
 		}
-		return
+		return nil
+	}
+
+	if !fs.prepareDatabase() {
+		return nil
+	}
+
+	// the newest records ingested by earlier imports are tracked so later imports may append
+	previousWatermarks, err := fs.metaDB.GetWatermarks(fs.database.GetSelectedDB())
+	if err != nil && fs.appending {
+		return fmt.Errorf("could not read the records ingested by earlier imports: %v", err)
+	}
+	fs.watermarks = newWatermarkFilter(
+		fs.database.GetSelectedDB(), previousWatermarks, fs.config.S.Parsing.AppendOverlap, fs.appending,
+	)
+
+	// batch up the indexed files so as not to read too much in at one time
+	batchedIndexedFiles := batchFilesBySize(indexedFiles, fs.batchSizeBytes)
+
+	// files whose parsing was aborted because too many lines failed to parse
+	var abortedFiles []*files.IndexedFile
+
+	for i, indexedFileBatch := range batchedIndexedFiles {
+		fmt.Printf("\t[-] Processing batch %d of %d\n", i+1, len(batchedIndexedFiles))
+		batchCtx, batchSpan := tracing.Start(fs.traceContext(), "batch",
+			attribute.Int("rita.batch", i+1),
+			attribute.Int("rita.files", len(indexedFileBatch)),
+		)
+
+		// parse in those files!
+		retVals := fs.parseFiles(batchCtx, indexedFileBatch, threads, fs.log)
+		// Set chunk before we continue so if process dies, we still verify with a delete if
+		// any data was written out.
+		fs.metaDB.SetChunk(fs.config.S.Rolling.CurrentChunk, fs.database.GetSelectedDB(), true)
+
+		fs.buildAnalysis(batchCtx, retVals)
+
+		// the analyses stop early once the import is interrupted, so the batch isn't
+		// recorded as imported and the database isn't marked as analyzed
+		if err := fs.traceContext().Err(); err != nil {
+			batchSpan.End()
+			return fmt.Errorf("the import was interrupted: %v", err)
+		}
+
+		// record file+database name hash in metadabase to prevent duplicate content.
+		// Files which could not be read in full are left out so they may be resumed.
+		fmt.Println("\t[-] Indexing log entries ... ")
+		var completeFiles []*files.IndexedFile
+		var checkpoints []files.Checkpoint
+		for _, file := range indexedFileBatch {
+			if file.IsComplete() {
+				completeFiles = append(completeFiles, file)
+			}
+			if file.GetParseError() != nil {
+				abortedFiles = append(abortedFiles, file)
+			}
+			checkpoints = append(checkpoints, file.Checkpoint())
+		}
+		err = fs.metaDB.AddNewFilesToIndex(completeFiles)
+		if err != nil {
+			fs.log.Error("Could not update the list of parsed files")
+		}
+
+		// record the newest records ingested now that the batch has been written
+		err = fs.metaDB.SetWatermarks(fs.watermarks.watermarks())
+		if err != nil {
+			fs.log.Error("Could not update the ingestion watermarks")
+		}
+
+		// record how far each file was read now that the batch has been written
+		err = fs.metaDB.SetCheckpoints(checkpoints)
+		if err != nil {
+			fs.log.Error("Could not update the parsing checkpoints")
+		}
+		batchSpan.End()
 	}
 
+	// mark results as imported and analyzed
+	fmt.Println("\t[-] Updating metadatabase ... ")
+	fs.metaDB.MarkDBAnalyzed(fs.database.GetSelectedDB(), true)
+
+	progTime := time.Now()
+	fs.log.WithFields(
+		log.Fields{
+			"current_time": progTime.Format(util.TimeFormat),
+			"total_time":   progTime.Sub(start).String(),
+		},
+	).Info("Finished upload. Starting indexing")
+
+	progTime = time.Now()
+	fs.log.WithFields(
+		log.Fields{
+			"current_time": progTime.Format(util.TimeFormat),
+			"total_time":   progTime.Sub(start).String(),
+		},
+	).Info("Finished importing log files")
+
+	fmt.Println("\t[-] Done!")
+	if len(abortedFiles) > 0 {
+		for _, file := range abortedFiles {
+			fmt.Printf("\t[!] Aborted parsing %s: %v\n", file.Path, file.GetParseError())
+		}
+		return fmt.Errorf("parsing was aborted for %d file(s)", len(abortedFiles))
+	}
+	return nil
+}
+
+//prepareDatabase records the target database in the metadatabase and removes the
+//outdated data of the current chunk from rolling databases. Returns false if the
+//import can't continue.
+func (fs *FSImporter) prepareDatabase() bool {
 	// Add new metadatabase record for db if doesn't already exist
 	dbExists, err := fs.metaDB.DBExists(fs.database.GetSelectedDB())
 	if err != nil {
@@ -140,15 +325,16 @@ func (fs *FSImporter) Run(indexedFiles []*files.IndexedFile, threads int) {
 		chunkSet, err := fs.metaDB.IsChunkSet(fs.config.S.Rolling.CurrentChunk, fs.database.GetSelectedDB())
 		if err != nil {
 			fmt.Println("\t[!] Could not find CID List entry in metadatabase")
-			return
+			return false
 		}
 
-		if chunkSet {
+		// appending imports add to the data of the current chunk
+		if chunkSet && !fs.appending {
 			fmt.Println("\t[-] Removing outdated data from rolling dataset ... ")
 			err := fs.removeAnalysisChunk(fs.config.S.Rolling.CurrentChunk)
 			if err != nil {
 				fmt.Println("\t[!] Failed to remove outdata data from rolling dataset")
-				return
+				return false
 			}
 		}
 	}
@@ -158,84 +344,50 @@ func (fs *FSImporter) Run(indexedFiles []*files.IndexedFile, threads int) {
 		blacklist.BuildBlacklistedCollections(fs.database, fs.config, fs.log)
 	}
 
-	// batch up the indexed files so as not to read too much in at one time
-	batchedIndexedFiles := batchFilesBySize(indexedFiles, fs.batchSizeBytes)
-
-	for i, indexedFileBatch := range batchedIndexedFiles {
-		fmt.Printf("\t[-] Processing batch %d of %d\n", i+1, len(batchedIndexedFiles))
-
-		// parse in those files!
-		retVals := fs.parseFiles(indexedFileBatch, threads, fs.log)
-		// Set chunk before we continue so if process dies, we still verify with a delete if
-		// any data was written out.
-		fs.metaDB.SetChunk(fs.config.S.Rolling.CurrentChunk, fs.database.GetSelectedDB(), true)
-
-		// build Hosts table.
-		fs.buildHosts(retVals.HostMap)
-
-		// build Uconns table. Must go before beacons.
-		fs.buildUconns(retVals.UniqueConnMap)
-
-		// build uconnsProxy table. Must go before proxy beacons
-		fs.buildUconnsProxy(retVals.ProxyUniqueConnMap)
-
-		// update ts range for dataset (needs to be run before beacons)
-		minTimestamp, maxTimestamp := fs.updateTimestampRange()
-
-		// build or update the exploded DNS table. Must go before hostnames
-		fs.buildExplodedDNS(retVals.ExplodedDNSMap)
+	return true
+}
 
-		// build or update the exploded DNS table
-		fs.buildHostnames(retVals.HostnameMap)
+//buildAnalysis writes the aggregated results of a batch of records to the database
+//and updates the analysis modules
+func (fs *FSImporter) buildAnalysis(ctx context.Context, retVals ParseResults) {
+	ctx, span := tracing.Start(ctx, "buildAnalysis")
+	defer span.End()
 
-		// build or update Beacons table
-		fs.buildBeacons(retVals.UniqueConnMap, minTimestamp, maxTimestamp)
+	// build Hosts table.
+	fs.buildHosts(ctx, retVals.HostMap)
 
-		// build or update the FQDN Beacons Table
-		fs.buildFQDNBeacons(retVals.HostMap, minTimestamp, maxTimestamp)
+	// build Uconns table. Must go before beacons.
+	fs.buildUconns(ctx, retVals.UniqueConnMap)
 
-		// build or update the Proxy Beacons Table
-		fs.buildProxyBeacons(retVals.ProxyUniqueConnMap, minTimestamp, maxTimestamp)
+	// build uconnsProxy table. Must go before proxy beacons
+	fs.buildUconnsProxy(ctx, retVals.ProxyUniqueConnMap)
 
-		// build or update UserAgent table
-		fs.buildUserAgent(retVals.UseragentMap)
+	// update ts range for dataset (needs to be run before beacons)
+	minTimestamp, maxTimestamp := fs.updateTimestampRange(ctx)
 
-		// build or update Certificate table
-		fs.buildCertificates(retVals.CertificateMap)
+	// build or update the exploded DNS table. Must go before hostnames
+	fs.buildExplodedDNS(ctx, retVals.ExplodedDNSMap)
 
-		// update blacklisted peers in hosts collection
-		fs.markBlacklistedPeers(retVals.HostMap)
+	// build or update the exploded DNS table
+	fs.buildHostnames(ctx, retVals.HostnameMap)
 
-		// record file+database name hash in metadabase to prevent duplicate content
-		fmt.Println("\t[-] Indexing log entries ... ")
-		err := fs.metaDB.AddNewFilesToIndex(indexedFileBatch)
-		if err != nil {
-			fs.log.Error("Could not update the list of parsed files")
-		}
+	// build or update Beacons table
+	fs.buildBeacons(ctx, retVals.UniqueConnMap, minTimestamp, maxTimestamp)
 
-	}
+	// build or update the FQDN Beacons Table
+	fs.buildFQDNBeacons(ctx, retVals.HostMap, minTimestamp, maxTimestamp)
 
-	// mark results as imported and analyzed
-	fmt.Println("\t[-] Updating metadatabase ... ")
-	fs.metaDB.MarkDBAnalyzed(fs.database.GetSelectedDB(), true)
+	// build or update the Proxy Beacons Table
+	fs.buildProxyBeacons(ctx, retVals.ProxyUniqueConnMap, minTimestamp, maxTimestamp)
 
-	progTime := time.Now()
-	fs.log.WithFields(
-		log.Fields{
-			"current_time": progTime.Format(util.TimeFormat),
-			"total_time":   progTime.Sub(start).String(),
-		},
-	).Info("Finished upload. Starting indexing")
+	// build or update UserAgent table
+	fs.buildUserAgent(ctx, retVals.UseragentMap)
 
-	progTime = time.Now()
-	fs.log.WithFields(
-		log.Fields{
-			"current_time": progTime.Format(util.TimeFormat),
-			"total_time":   progTime.Sub(start).String(),
-		},
-	).Info("Finished importing log files")
+	// build or update Certificate table
+	fs.buildCertificates(ctx, retVals.CertificateMap)
 
-	fmt.Println("\t[-] Done!")
+	// update blacklisted peers in hosts collection
+	fs.markBlacklistedPeers(ctx, retVals.HostMap)
 }
 
 // batchFilesBySize takes in an slice of indexedFiles and splits the array into
@@ -302,13 +454,38 @@ func batchFilesBySize(indexedFiles []*files.IndexedFile, size int64) [][]*files.
 //threads to use to parse the files, whether or not to sort data by date,
 //a MongoDB datastore object to store the bro data in, and a logger to report
 //errors and parses the bro files line by line into the database.
-func (fs *FSImporter) parseFiles(indexedFiles []*files.IndexedFile, parsingThreads int, logger *log.Logger) ParseResults {
+func (fs *FSImporter) parseFiles(ctx context.Context, indexedFiles []*files.IndexedFile, parsingThreads int, logger *log.Logger) ParseResults {
+	ctx, span := tracing.Start(ctx, "parseFiles", attribute.Int("rita.files", len(indexedFiles)))
+	defer span.End()
 
 	fmt.Println("\t[-] Parsing logs to: " + fs.database.GetSelectedDB() + " ... ")
 
 	parseStartTime := time.Now()
 	retVals := newParseResults()
 
+	// proxied connection timestamps are recorded with the configured precision
+	proxyTsUnits := util.TimestampUnitsPerSecond(fs.config.S.BeaconProxy.TimestampPrecision)
+
+	// aggregate the sources of proxied connections into subnets if enabled
+	var proxySubnets *data.SubnetPrefixLengths
+	if fs.config.S.BeaconProxy.SubnetAggregation.Enabled {
+		proxySubnets = &data.SubnetPrefixLengths{
+			IPv4: fs.config.S.BeaconProxy.SubnetAggregation.IPv4PrefixLength,
+			IPv6: fs.config.S.BeaconProxy.SubnetAggregation.IPv6PrefixLength,
+		}
+	}
+
+	// track the connection durations and byte counts of proxied requests if they are used
+	if fs.config.S.BeaconProxy.DurationEnabled || fs.config.S.BeaconProxy.BytesEnabled {
+		retVals.ProxyUIDMap = make(map[string]string)
+	}
+	if fs.config.S.BeaconProxy.DurationEnabled {
+		retVals.ConnDurationMap = make(map[string]float64)
+	}
+	if fs.config.S.BeaconProxy.BytesEnabled {
+		retVals.ConnBytesMap = make(map[string]ConnBytes)
+	}
+
 	//set up parallel parsing
 	n := len(indexedFiles)
 	parsingWG := new(sync.WaitGroup)
@@ -320,65 +497,249 @@ func (fs *FSImporter) parseFiles(indexedFiles []*files.IndexedFile, parsingThrea
 			wg *sync.WaitGroup, start int, jump int, length int) {
 			//comb over array
 			for j := start; j < length; j += jump {
+				_, fileSpan := tracing.Start(ctx, "parseFile",
+					attribute.String("file.path", indexedFiles[j].Path),
+					attribute.String("rita.log_type", indexedFiles[j].TargetCollection),
+				)
 
 				// open the file
-				fileHandle, err := os.Open(indexedFiles[j].Path)
+				fileHandle, err := indexedFiles[j].Open()
 				if err != nil {
 					logger.WithFields(log.Fields{
 						"file":  indexedFiles[j].Path,
 						"error": err.Error(),
 					}).Error("Could not open file for parsing")
+					metrics.ParseErrors.Inc()
+					indexedFiles[j].SetParseError(err)
+					fileSpan.SetStatus(codes.Error, err.Error())
+					fileSpan.End()
+					continue
 				}
 
 				// read the file
-				fileScanner, closeScanner, err := files.GetFileScanner(fileHandle)
+				fileScanner, closeScanner, err := files.GetFileScanner(
+					fileHandle, fs.config.S.Parsing.MaxLineLength, fs.config.S.Parsing.ParallelGzipMinSize,
+				)
 				if err != nil {
 					logger.WithFields(log.Fields{
 						"file":  indexedFiles[j].Path,
 						"error": err.Error(),
 					}).Error("Could not read from the file")
+					metrics.ParseErrors.Inc()
+					closeScanner()
+					indexedFiles[j].SetParseError(err)
+					fileSpan.SetStatus(codes.Error, err.Error())
+					fileSpan.End()
+					continue
 				}
 				fmt.Println("\t[-] Parsing " + indexedFiles[j].Path + " -> " + indexedFiles[j].TargetDatabase)
 
+				// look up the counter once per file since this loop is very hot
+				linesParsed := metrics.LinesParsed.WithLabelValues(indexedFiles[j].TargetCollection)
+
+				// skip the lines ingested by a previous import
+				resumeLine := indexedFiles[j].GetResumeLine()
+				if resumeLine > 0 {
+					logger.WithFields(log.Fields{
+						"path": indexedFiles[j].Path,
+						"line": resumeLine,
+					}).Info("Resuming file from checkpoint")
+				}
+				var lineNum int64
+
+				// stop parsing files at the record limit, if one is set
+				maxLines := fs.config.S.Parsing.MaxLines
+				var recordsParsed int64
+				truncated := false
+
+				// files with too many lines which fail to parse are likely in the wrong format
+				errRate := &errorRate{maxRate: fs.config.S.Parsing.MaxErrorRate}
+				var parseErr error
+
+				// track the newest records of the file and drop those ingested before when appending
+				logType := indexedFiles[j].TargetCollection
+				var watermarkTracker *watermarkTracker
+				var ingestedBefore int64
+				if fs.watermarks != nil {
+					watermarkTracker = fs.watermarks.newTracker()
+				}
+
+				// recycle the parsed records once they are aggregated if enabled
+				broDataFactory := indexedFiles[j].GetBroDataFactory()
+				var recordPool *parsetypes.BroDataPool
+				if fs.config.S.Parsing.ReuseRecords {
+					recordPool = parsetypes.NewBroDataPool(broDataFactory)
+					broDataFactory = recordPool.Get
+				}
+
 				// This loops through every line of the file
 				for fileScanner.Scan() {
 					// go to next line if there was an issue
 					if fileScanner.Err() != nil {
+						metrics.ParseErrors.Inc()
+						break
+					}
+
+					lineNum++
+					if lineNum <= resumeLine {
+						continue
+					}
+
+					// the comments trailing the last record allowed don't count as truncation
+					if maxLines > 0 && recordsParsed >= maxLines && !isCommentLine(fileScanner.Bytes()) {
+						truncated = true
+						lineNum--
 						break
 					}
 
 					//parse the line
 					var entry parsetypes.BroData
+					var lineErr error
 					if indexedFiles[j].IsJSON() {
-						entry = files.ParseJSONLine(fileScanner.Bytes(), indexedFiles[j].GetBroDataFactory(), logger)
+						entry, lineErr = files.ParseJSONLine(fileScanner.Bytes(), broDataFactory, logger)
+					} else if indexedFiles[j].IsNfdumpCSV() {
+						entry, lineErr = files.ParseNfdumpCSVLine(fileScanner.Text(),
+							indexedFiles[j].GetNfdumpHeader(), broDataFactory, logger,
+						)
 					} else {
+						if fs.config.S.Parsing.StrictFieldCount {
+							lineErr = files.CheckTSVFieldCount(fileScanner.Text(), indexedFiles[j].GetHeader())
+							if lineErr != nil {
+								logger.WithFields(log.Fields{
+									"file":  indexedFiles[j].Path,
+									"line":  lineNum,
+									"error": lineErr.Error(),
+								}).Error("Skipping line with the wrong number of fields")
+								metrics.ParseErrors.Inc()
+							}
+						}
 						// I've tried to increase performance by avoiding the allocations that result from
 						// scanner.Text() by using .Bytes() with an unsafe cast, but that seemed to hurt performance -LL
-						entry = files.ParseTSVLine(fileScanner.Text(),
-							indexedFiles[j].GetHeader(), indexedFiles[j].GetFieldMap(),
-							indexedFiles[j].GetBroDataFactory(), logger,
-						)
+						if lineErr == nil {
+							entry, lineErr = files.ParseTSVLine(fileScanner.Text(),
+								indexedFiles[j].GetHeader(), indexedFiles[j].GetFieldMap(),
+								broDataFactory, logger,
+							)
+						}
+					}
+
+					// comment lines are neither records nor errors
+					if entry == nil && lineErr == nil {
+						continue
+					}
+
+					if fs.config.S.Parsing.AbortOnErrors {
+						errRate.record(lineErr != nil)
+						if errRate.lines >= minErrorRateLines && errRate.exceeded() {
+							parseErr = errRate.err()
+							break
+						}
 					}
 
 					if entry == nil {
 						continue
 					}
+					linesParsed.Inc()
+					recordsParsed++
+
+					// the entries of Suricata's and nfdump's logs are aggregated as the records
+					// they convert into. The entry itself is recycled since it holds the record.
+					record := entry
+					if converter, ok := entry.(parsetypes.RecordConverter); ok {
+						entry = converter.Record()
+						if entry == nil {
+							if recordPool != nil {
+								recordPool.Put(record)
+							}
+							continue
+						}
+					}
 
-					switch typedEntry := entry.(type) {
-					case *parsetypes.Conn:
-						parseConnEntry(typedEntry, fs.filter, retVals)
-					case *parsetypes.DNS:
-						parseDNSEntry(typedEntry, fs.filter, retVals)
-					case *parsetypes.HTTP:
-						parseHTTPEntry(typedEntry, fs.filter, retVals)
-					case *parsetypes.OpenConn:
-						parseOpenConnEntry(typedEntry, fs.filter, retVals)
-					case *parsetypes.SSL:
-						parseSSLEntry(typedEntry, fs.filter, retVals)
+					// drop the records outside of the time window before they are aggregated
+					if fs.hasTimeWindow() {
+						if ts, ok := entryTimestamp(entry); ok && fs.filterTimestamp(ts) {
+							if ts < 0 {
+								logger.WithFields(log.Fields{
+									"file": indexedFiles[j].Path,
+									"line": lineNum,
+								}).Warn("Dropping record with an unparsable timestamp")
+							}
+							if recordPool != nil {
+								recordPool.Put(record)
+							}
+							continue
+						}
 					}
+
+					if watermarkTracker != nil {
+						if ts, ok := entryTimestamp(entry); ok {
+							key := lineKey(fileScanner.Bytes())
+							if !fs.watermarks.accept(logType, ts, key) {
+								ingestedBefore++
+								if recordPool != nil {
+									recordPool.Put(record)
+								}
+								continue
+							}
+							watermarkTracker.add(ts, key)
+						}
+					}
+
+					fs.aggregateEntry(entry, proxyTsUnits, proxySubnets, retVals)
+
+					// the aggregates only hold copies of the record's fields, except for
+					// the x509 records which are kept to be matched with the ssl records
+					if _, isX509 := entry.(*parsetypes.X509); recordPool != nil && !isX509 {
+						recordPool.Put(record)
+					}
+				}
+				if fileScanner.Err() != nil {
+					logger.WithFields(log.Fields{
+						"file":  indexedFiles[j].Path,
+						"line":  lineNum,
+						"error": fileScanner.Err().Error(),
+					}).Error("Stopped reading file early")
+					metrics.ParseErrors.Inc()
+				}
+				// files too short to abort midway are checked once they are read
+				if parseErr == nil && fs.config.S.Parsing.AbortOnErrors && errRate.exceeded() {
+					parseErr = errRate.err()
+				}
+				if parseErr != nil {
+					logger.WithFields(log.Fields{
+						"file":  indexedFiles[j].Path,
+						"line":  lineNum,
+						"error": parseErr.Error(),
+					}).Error("Aborted parsing file with too many errors")
+					indexedFiles[j].SetParseError(parseErr)
+				}
+				if watermarkTracker != nil {
+					fs.watermarks.record(logType, watermarkTracker)
 				}
+				if ingestedBefore > 0 {
+					logger.WithFields(log.Fields{
+						"path":    indexedFiles[j].Path,
+						"records": ingestedBefore,
+					}).Info("Skipped records ingested by an earlier import")
+				}
+				if truncated {
+					fmt.Printf("\t[!] Stopped parsing %s after %d records\n", indexedFiles[j].Path, maxLines)
+					logger.WithFields(log.Fields{
+						"path":      indexedFiles[j].Path,
+						"line":      lineNum,
+						"max_lines": maxLines,
+					}).Warn("Truncated file at the record limit")
+				}
+				// truncated files are resumed from where they were cut short by later imports
+				indexedFiles[j].SetLinesRead(lineNum, fileScanner.Err() == nil && parseErr == nil && !truncated)
 				indexedFiles[j].ParseTime = time.Now()
 				closeScanner() // handles closing the underlying fileHandle
+
+				fileSpan.SetAttributes(attribute.Int64("rita.lines", lineNum))
+				if parseErr != nil {
+					fileSpan.SetStatus(codes.Error, parseErr.Error())
+				}
+				fileSpan.End()
 				logger.WithFields(log.Fields{
 					"path": indexedFiles[j].Path,
 				}).Info("Finished parsing file")
@@ -390,6 +751,11 @@ func (fs *FSImporter) parseFiles(indexedFiles []*files.IndexedFile, parsingThrea
 	fmt.Println("\t[-] Finished parsing logs in " + util.FormatDuration(
 		time.Since(parseStartTime).Truncate(time.Millisecond)),
 	)
+
+	// the conn and http logs are parsed in parallel, so the connection durations
+	// and byte counts of proxied requests can only be matched up once parsing is done
+	matchProxyDurations(retVals)
+	matchProxyBytes(retVals)
 	/*
 		f, err := os.Create("./ram.pprof")
 		if err != nil {
@@ -404,8 +770,75 @@ func (fs *FSImporter) parseFiles(indexedFiles []*files.IndexedFile, parsingThrea
 	return retVals
 }
 
+//aggregateEntry aggregates a parsed record into the results for the analysis modules
+func (fs *FSImporter) aggregateEntry(entry parsetypes.BroData, proxyTsUnits int64,
+	proxySubnets *data.SubnetPrefixLengths, retVals ParseResults) {
+
+	fs.defaultNetwork.apply(entry)
+
+	switch typedEntry := entry.(type) {
+	case *parsetypes.Conn:
+		parseConnEntry(typedEntry, fs.filter, retVals)
+	case *parsetypes.DNS:
+		parseDNSEntry(typedEntry, fs.filter, retVals)
+	case *parsetypes.HTTP:
+		parseHTTPEntry(typedEntry, fs.filter, fs.proxyFields, proxyTsUnits, proxySubnets, retVals)
+	case *parsetypes.OpenConn:
+		parseOpenConnEntry(typedEntry, fs.filter, retVals)
+	case *parsetypes.SSL:
+		parseSSLEntry(typedEntry, fs.filter, retVals)
+	case *parsetypes.X509:
+		parseX509Entry(typedEntry, retVals)
+	}
+}
+
+//isCommentLine returns whether a line holds no record, such as the comments Zeek writes
+//around the records of TSV logs
+func isCommentLine(line []byte) bool {
+	return len(line) == 0 || line[0] == '#'
+}
+
+//matchProxyDurations attaches the durations of the connections carrying proxied HTTP
+//requests to the proxied unique connections. Missing and zero durations are skipped.
+func matchProxyDurations(retVals ParseResults) {
+	for uid, srcFQDNKey := range retVals.ProxyUIDMap {
+		duration, ok := retVals.ConnDurationMap[uid]
+		if !ok || duration <= 0 {
+			continue
+		}
+
+		if entry, ok := retVals.ProxyUniqueConnMap[srcFQDNKey]; ok {
+			entry.DurList = append(entry.DurList, duration)
+		}
+	}
+}
+
+//matchProxyBytes attaches the byte counts of the connections carrying proxied HTTP
+//requests to the proxied unique connections. The byte counts of proxied unique connections
+//which aren't carried by any connection in the conn logs are left nil.
+func matchProxyBytes(retVals ParseResults) {
+	for uid, srcFQDNKey := range retVals.ProxyUIDMap {
+		connBytes, ok := retVals.ConnBytesMap[uid]
+		if !ok {
+			continue
+		}
+
+		if entry, ok := retVals.ProxyUniqueConnMap[srcFQDNKey]; ok {
+			if entry.OrigBytes == nil {
+				entry.OrigBytes = new(int64)
+				entry.RespBytes = new(int64)
+			}
+			*entry.OrigBytes += connBytes.Orig
+			*entry.RespBytes += connBytes.Resp
+			entry.BytesList = append(entry.BytesList, connBytes.Orig+connBytes.Resp)
+		}
+	}
+}
+
 //buildExplodedDNS .....
-func (fs *FSImporter) buildExplodedDNS(domainMap map[string]int) {
+func (fs *FSImporter) buildExplodedDNS(ctx context.Context, domainMap map[string]int) {
+	_, span := tracing.Start(ctx, "buildExplodedDNS", attribute.Int("rita.records", len(domainMap)))
+	defer span.End()
 
 	if fs.config.S.DNS.Enabled {
 		if len(domainMap) > 0 {
@@ -423,7 +856,9 @@ func (fs *FSImporter) buildExplodedDNS(domainMap map[string]int) {
 }
 
 //buildCertificates .....
-func (fs *FSImporter) buildCertificates(certMap map[string]*certificate.Input) {
+func (fs *FSImporter) buildCertificates(ctx context.Context, certMap map[string]*certificate.Input) {
+	_, span := tracing.Start(ctx, "buildCertificates", attribute.Int("rita.records", len(certMap)))
+	defer span.End()
 
 	if len(certMap) > 0 {
 		// Set up the database
@@ -457,7 +892,10 @@ func (fs *FSImporter) removeAnalysisChunk(cid int) error {
 }
 
 //buildHostnames .....
-func (fs *FSImporter) buildHostnames(hostnameMap map[string]*hostname.Input) {
+func (fs *FSImporter) buildHostnames(ctx context.Context, hostnameMap map[string]*hostname.Input) {
+	_, span := tracing.Start(ctx, "buildHostnames", attribute.Int("rita.records", len(hostnameMap)))
+	defer span.End()
+
 	// non-optional module
 	if len(hostnameMap) > 0 {
 		// Set up the database
@@ -473,7 +911,10 @@ func (fs *FSImporter) buildHostnames(hostnameMap map[string]*hostname.Input) {
 
 }
 
-func (fs *FSImporter) buildUconnsProxy(uconnProxyMap map[string]*uconnproxy.Input) {
+func (fs *FSImporter) buildUconnsProxy(ctx context.Context, uconnProxyMap map[string]*uconnproxy.Input) {
+	_, span := tracing.Start(ctx, "buildUconnsProxy", attribute.Int("rita.records", len(uconnProxyMap)))
+	defer span.End()
+
 	// non-optional module
 	if len(uconnProxyMap) > 0 {
 		// Set up the database
@@ -491,7 +932,10 @@ func (fs *FSImporter) buildUconnsProxy(uconnProxyMap map[string]*uconnproxy.Inpu
 	}
 }
 
-func (fs *FSImporter) buildUconns(uconnMap map[string]*uconn.Input) {
+func (fs *FSImporter) buildUconns(ctx context.Context, uconnMap map[string]*uconn.Input) {
+	_, span := tracing.Start(ctx, "buildUconns", attribute.Int("rita.records", len(uconnMap)))
+	defer span.End()
+
 	// non-optional module
 	if len(uconnMap) > 0 {
 		// Set up the database
@@ -511,7 +955,10 @@ func (fs *FSImporter) buildUconns(uconnMap map[string]*uconn.Input) {
 	}
 }
 
-func (fs *FSImporter) buildHosts(hostMap map[string]*host.Input) {
+func (fs *FSImporter) buildHosts(ctx context.Context, hostMap map[string]*host.Input) {
+	_, span := tracing.Start(ctx, "buildHosts", attribute.Int("rita.records", len(hostMap)))
+	defer span.End()
+
 	// non-optional module
 	if len(hostMap) > 0 {
 		hostRepo := host.NewMongoRepository(fs.database, fs.config, fs.log)
@@ -530,7 +977,10 @@ func (fs *FSImporter) buildHosts(hostMap map[string]*host.Input) {
 	}
 }
 
-func (fs *FSImporter) markBlacklistedPeers(hostMap map[string]*host.Input) {
+func (fs *FSImporter) markBlacklistedPeers(ctx context.Context, hostMap map[string]*host.Input) {
+	_, span := tracing.Start(ctx, "markBlacklistedPeers", attribute.Int("rita.records", len(hostMap)))
+	defer span.End()
+
 	// non-optional module
 	if len(hostMap) > 0 {
 		blacklistRepo := blacklist.NewMongoRepository(fs.database, fs.config, fs.log)
@@ -545,10 +995,13 @@ func (fs *FSImporter) markBlacklistedPeers(hostMap map[string]*host.Input) {
 	}
 }
 
-func (fs *FSImporter) buildBeacons(uconnMap map[string]*uconn.Input, minTimestamp, maxTimestamp int64) {
+func (fs *FSImporter) buildBeacons(ctx context.Context, uconnMap map[string]*uconn.Input, minTimestamp, maxTimestamp int64) {
+	ctx, span := tracing.Start(ctx, "buildBeacons", attribute.Int("rita.records", len(uconnMap)))
+	defer span.End()
+
 	if fs.config.S.Beacon.Enabled {
 		if len(uconnMap) > 0 {
-			beaconRepo := beacon.NewMongoRepository(fs.database, fs.config, fs.log)
+			beaconRepo := beacon.NewMongoRepository(ctx, fs.database, fs.config, fs.log)
 
 			err := beaconRepo.CreateIndexes()
 			if err != nil {
@@ -564,10 +1017,13 @@ func (fs *FSImporter) buildBeacons(uconnMap map[string]*uconn.Input, minTimestam
 
 }
 
-func (fs *FSImporter) buildFQDNBeacons(hostMap map[string]*host.Input, minTimestamp, maxTimestamp int64) {
+func (fs *FSImporter) buildFQDNBeacons(ctx context.Context, hostMap map[string]*host.Input, minTimestamp, maxTimestamp int64) {
+	ctx, span := tracing.Start(ctx, "buildFQDNBeacons", attribute.Int("rita.records", len(hostMap)))
+	defer span.End()
+
 	if fs.config.S.BeaconFQDN.Enabled {
 		if len(hostMap) > 0 {
-			beaconFQDNRepo := beaconfqdn.NewMongoRepository(fs.database, fs.config, fs.log)
+			beaconFQDNRepo := beaconfqdn.NewMongoRepository(ctx, fs.database, fs.config, fs.log)
 
 			err := beaconFQDNRepo.CreateIndexes()
 			if err != nil {
@@ -585,10 +1041,13 @@ func (fs *FSImporter) buildFQDNBeacons(hostMap map[string]*host.Input, minTimest
 
 }
 
-func (fs *FSImporter) buildProxyBeacons(uconnProxyMap map[string]*uconnproxy.Input, minTimestamp, maxTimestamp int64) {
+func (fs *FSImporter) buildProxyBeacons(ctx context.Context, uconnProxyMap map[string]*uconnproxy.Input, minTimestamp, maxTimestamp int64) {
+	ctx, span := tracing.Start(ctx, "buildProxyBeacons", attribute.Int("rita.records", len(uconnProxyMap)))
+	defer span.End()
+
 	if fs.config.S.BeaconProxy.Enabled {
 		if len(uconnProxyMap) > 0 {
-			beaconProxyRepo := beaconproxy.NewMongoRepository(fs.database, fs.config, fs.log)
+			beaconProxyRepo := beaconproxy.NewMongoRepository(ctx, fs.database, fs.config, fs.log)
 
 			err := beaconProxyRepo.CreateIndexes()
 			if err != nil {
@@ -596,7 +1055,10 @@ func (fs *FSImporter) buildProxyBeacons(uconnProxyMap map[string]*uconnproxy.Inp
 			}
 
 			// send proxy uconns to beacon analysis
-			beaconProxyRepo.Upsert(uconnProxyMap, minTimestamp, maxTimestamp)
+			err = beaconProxyRepo.Upsert(uconnProxyMap, minTimestamp, maxTimestamp)
+			if err != nil {
+				fs.log.WithError(err).Error("Could not write the proxy beacon results")
+			}
 		} else {
 			fmt.Println("\t[!] No Proxy Beacon data to analyze")
 		}
@@ -605,7 +1067,9 @@ func (fs *FSImporter) buildProxyBeacons(uconnProxyMap map[string]*uconnproxy.Inp
 }
 
 //buildUserAgent .....
-func (fs *FSImporter) buildUserAgent(useragentMap map[string]*useragent.Input) {
+func (fs *FSImporter) buildUserAgent(ctx context.Context, useragentMap map[string]*useragent.Input) {
+	_, span := tracing.Start(ctx, "buildUserAgent", attribute.Int("rita.records", len(useragentMap)))
+	defer span.End()
 
 	if fs.config.S.UserAgent.Enabled {
 		if len(useragentMap) > 0 {
@@ -623,7 +1087,10 @@ func (fs *FSImporter) buildUserAgent(useragentMap map[string]*useragent.Input) {
 	}
 }
 
-func (fs *FSImporter) updateTimestampRange() (int64, int64) {
+func (fs *FSImporter) updateTimestampRange(ctx context.Context) (int64, int64) {
+	_, span := tracing.Start(ctx, "updateTimestampRange")
+	defer span.End()
+
 	session := fs.database.Session.Copy()
 	defer session.Close()
 
@@ -0,0 +1,94 @@
+package parser
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/activecm/rita/config"
+	"github.com/activecm/rita/parser/parsetypes"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFilesMaxLines(t *testing.T) {
+	dir, err := ioutil.TempDir("", "limits")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	long := writeTestConnLog(t, dir, "conn.long.log", 100, 0)
+	exact := writeTestConnLog(t, dir, "conn.exact.log", 25, 0)
+
+	capped := config.ParsingStaticCfg{MaxLineLength: 1 << 20, MaxLines: 25}
+	indexedFiles, results := testParseFilesResults(t, capped, long)
+
+	// only the first records are aggregated and the file is left to be resumed
+	require.Len(t, results.UniqueConnMap, 1)
+	for _, uconn := range results.UniqueConnMap {
+		require.Equal(t, int64(25), uconn.ConnectionCount)
+		require.Equal(t, int64(1517336042+24), uconn.TsList[len(uconn.TsList)-1])
+	}
+	require.False(t, indexedFiles[0].IsComplete())
+	// the header lines aren't counted as records
+	require.Equal(t, int64(7+25), indexedFiles[0].Checkpoint().Lines)
+
+	// a file holding no more records than the cap isn't truncated
+	indexedFiles, results = testParseFilesResults(t, capped, exact)
+	for _, uconn := range results.UniqueConnMap {
+		require.Equal(t, int64(25), uconn.ConnectionCount)
+	}
+	require.True(t, indexedFiles[0].IsComplete())
+
+	// every record is parsed without a cap
+	uncapped := config.ParsingStaticCfg{MaxLineLength: 1 << 20}
+	indexedFiles, results = testParseFilesResults(t, uncapped, long)
+	for _, uconn := range results.UniqueConnMap {
+		require.Equal(t, int64(100), uconn.ConnectionCount)
+	}
+	require.True(t, indexedFiles[0].IsComplete())
+}
+
+//testSensorLog is the BroData of a custom Zeek log which records connections
+type testSensorLog struct {
+	TimeStamp int64  `bro:"ts" brotype:"time"`
+	Source    string `bro:"src" brotype:"addr"`
+	Dest      string `bro:"dst" brotype:"addr"`
+	conn      parsetypes.Conn
+}
+
+func (line *testSensorLog) TargetCollection(conf *config.StructureTableCfg) string {
+	return conf.ConnTable
+}
+
+func (line *testSensorLog) ConvertFromJSON() {}
+
+func (line *testSensorLog) Record() parsetypes.BroData {
+	line.conn = parsetypes.Conn{TimeStamp: line.TimeStamp, Source: line.Source, Destination: line.Dest, Proto: "tcp"}
+	return &line.conn
+}
+
+func TestParseFilesRegisteredLog(t *testing.T) {
+	require.Nil(t, parsetypes.RegisterBroDataFactory("sensor", func() parsetypes.BroData { return &testSensorLog{} }))
+	defer parsetypes.UnregisterBroDataFactory("sensor")
+
+	dir, err := ioutil.TempDir("", "registered")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "sensor.log")
+	require.Nil(t, ioutil.WriteFile(path, []byte(
+		"#separator \\x09\n#set_separator\t,\n#empty_field\t(empty)\n#unset_field\t-\n#path\tsensor\n"+
+			"#fields\tts\tsrc\tdst\n#types\ttime\taddr\taddr\n"+
+			"1517336042.000000\t10.0.0.1\t93.184.216.34\n"+
+			"1517336043.000000\t10.0.0.1\t93.184.216.34\n",
+	), 0644))
+
+	// the records of the custom log are aggregated as the connections they convert into
+	_, results := testParseFilesResults(t, config.ParsingStaticCfg{MaxLineLength: 1 << 20}, path)
+	require.Len(t, results.UniqueConnMap, 1)
+	for _, uconn := range results.UniqueConnMap {
+		require.Equal(t, "10.0.0.1", uconn.Hosts.SrcIP)
+		require.Equal(t, "93.184.216.34", uconn.Hosts.DstIP)
+		require.Equal(t, int64(2), uconn.ConnectionCount)
+	}
+}
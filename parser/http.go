@@ -3,7 +3,10 @@ package parser
 import (
 	"net"
 	"strings"
+	"time"
 
+	"github.com/activecm/rita/config"
+	"github.com/activecm/rita/metrics"
 	"github.com/activecm/rita/parser/parsetypes"
 	"github.com/activecm/rita/pkg/data"
 	"github.com/activecm/rita/pkg/uconnproxy"
@@ -11,57 +14,94 @@ import (
 	"github.com/activecm/rita/util"
 )
 
-func parseHTTPEntry(parseHTTP *parsetypes.HTTP, filter filter, retVals ParseResults) {
-	// get source destination pair for connection record
-	src := parseHTTP.Source
-	dst := parseHTTP.Destination
+//proxyFields identifies the proxied requests in HTTP logs and the field holding the FQDN they
+//were proxied to, since the layout of proxy logs differs between deployments. The zero value
+//treats CONNECT requests as proxied and reads the FQDN from the Host header.
+type proxyFields struct {
+	// the requests with proxy headers rather than CONNECT requests are proxied
+	proxiedHeaders bool
+	// the FQDN is read from the request URI before the Host header
+	fqdnFromURI bool
+}
 
-	// parse addresses into binary format
-	srcIP := net.ParseIP(src)
-	dstIP := net.ParseIP(dst)
+//newProxyFields reads the proxy detection settings from the config
+func newProxyFields(conf *config.Config) proxyFields {
+	return proxyFields{
+		proxiedHeaders: conf.S.BeaconProxy.ProxyDetection.Indicator == "proxied",
+		fqdnFromURI:    conf.S.BeaconProxy.ProxyDetection.FQDNField == "uri",
+	}
+}
 
-	// parse host
-	fqdn := parseHTTP.Host
+//isProxied returns true if the request passed through a proxy
+func (p proxyFields) isProxied(parseHTTP *parsetypes.HTTP) bool {
+	if p.proxiedHeaders {
+		return len(parseHTTP.Proxied) > 0
+	}
+	return parseHTTP.Method == "CONNECT"
+}
+
+//fqdn returns the FQDN a request was made to. The configured field is tried first, then the other.
+func (p proxyFields) fqdn(parseHTTP *parsetypes.HTTP) string {
+	if p.fqdnFromURI {
+		if fqdn := parseURIHost(parseHTTP.URI); fqdn != "" {
+			return fqdn
+		}
+		return parseHTTP.Host
+	}
 
 	// host field isn't always populated.
 	// as a second option, parse out the host from the URI.
 	// This isn't the first choice as it will take longer than
 	// just grabbing the fqdn from the host field
-	if fqdn == "" {
-		uri := parseHTTP.URI
-
-		minIndex := 0
+	if parseHTTP.Host != "" {
+		return parseHTTP.Host
+	}
+	return parseURIHost(parseHTTP.URI)
+}
 
-		// handle if the URI has :// present (e.g., http://, https://, etc.)
-		if protoIndex := strings.Index(uri, "://"); protoIndex != -1 {
-			minIndex = protoIndex + len("://")
-		}
-		uri = uri[minIndex:]
-
-		maxIndex := len(uri)
-		if portIdx := strings.Index(uri, ":"); portIdx > -1 {
-			// Case for if URI has the port number included (e.g., example.com:443).
-			// This will also handle if the URI has a path appended as the path
-			// appears after the port, so this will just lop off the path too.
-			maxIndex = portIdx
-		} else if pathIdx := strings.Index(uri, "/"); pathIdx > -1 {
-			// Case for if the URI did not have a port but had a path
-			// suffixed to it (e.g., example.com/somecoolpath
-			maxIndex = pathIdx
-		}
-		uri = uri[:maxIndex]
+//parseURIHost parses the FQDN out of a request URI
+func parseURIHost(uri string) string {
+	minIndex := 0
 
-		// at this point, the URI should be parsed down to just an FQDN
-		fqdn = uri
+	// handle if the URI has :// present (e.g., http://, https://, etc.)
+	if protoIndex := strings.Index(uri, "://"); protoIndex != -1 {
+		minIndex = protoIndex + len("://")
+	}
+	uri = uri[minIndex:]
+
+	maxIndex := len(uri)
+	if portIdx := strings.Index(uri, ":"); portIdx > -1 {
+		// Case for if URI has the port number included (e.g., example.com:443).
+		// This will also handle if the URI has a path appended as the path
+		// appears after the port, so this will just lop off the path too.
+		maxIndex = portIdx
+	} else if pathIdx := strings.Index(uri, "/"); pathIdx > -1 {
+		// Case for if the URI did not have a port but had a path
+		// suffixed to it (e.g., example.com/somecoolpath
+		maxIndex = pathIdx
 	}
 
-	// parse method type
-	method := parseHTTP.Method
+	// at this point, the URI should be parsed down to just an FQDN
+	return uri[:maxIndex]
+}
+
+func parseHTTPEntry(parseHTTP *parsetypes.HTTP, filter filter, proxy proxyFields, proxyTsUnits int64,
+	proxySubnets *data.SubnetPrefixLengths, retVals ParseResults) {
+	// get source destination pair for connection record
+	src := parseHTTP.Source
+	dst := parseHTTP.Destination
+
+	// parse addresses into binary format
+	srcIP := net.ParseIP(src)
+	dstIP := net.ParseIP(dst)
+
+	// parse host
+	fqdn := proxy.fqdn(parseHTTP)
 
-	// check if destination is a proxy server based on HTTP method
-	dstIsProxy := (method == "CONNECT")
+	// check if destination is a proxy server based on the configured proxy indicator
+	dstIsProxy := proxy.isProxied(parseHTTP)
 
-	// if the HTTP method is CONNECT, then the srcIP is communicating
+	// if the request is proxied, then the srcIP is communicating
 	// to an FQDN through the dstIP proxy. We need to handle that
 	// as a special case here so that we don't filter internal->internal
 	// connections if the dstIP is an internal IP because the dstIP
@@ -85,13 +125,21 @@ func parseHTTPEntry(parseHTTP *parsetypes.HTTP, filter filter, retVals ParseResu
 	// disambiguate addresses which are not publicly routable
 	srcUniqIP := data.NewUniqueIP(srcIP, parseHTTP.AgentUUID, parseHTTP.AgentHostname)
 	dstUniqIP := data.NewUniqueIP(dstIP, parseHTTP.AgentUUID, parseHTTP.AgentHostname)
-	srcFQDNPair := data.NewUniqueSrcFQDNPair(srcUniqIP, fqdn)
 
 	updateUseragentsByHTTP(srcUniqIP, parseHTTP, retVals)
 
 	// check if internal IP is requesting a connection through a proxy
 	if dstIsProxy {
-		updateProxiedUniqueConnectionsByHTTP(srcFQDNPair, dstUniqIP, parseHTTP, retVals)
+		// the proxied connections of a subnet may be aggregated together, in which
+		// case the subnet stands in for the source
+		var srcSubnet *data.Subnet
+		srcFQDNPair := data.NewUniqueSrcFQDNPair(srcUniqIP, fqdn)
+		if proxySubnets != nil {
+			subnet := data.NewSubnet(srcUniqIP, *proxySubnets)
+			srcSubnet = &subnet
+			srcFQDNPair = data.NewUniqueSrcFQDNPair(subnet.AsUniqueIP(), fqdn)
+		}
+		updateProxiedUniqueConnectionsByHTTP(srcFQDNPair, srcSubnet, dstUniqIP, parseHTTP, proxyTsUnits, retVals)
 	}
 }
 
@@ -123,8 +171,8 @@ func updateUseragentsByHTTP(srcUniqIP data.UniqueIP, parseHTTP *parsetypes.HTTP,
 	retVals.UseragentMap[parseHTTP.UserAgent].Requests.Insert(parseHTTP.Host)
 }
 
-func updateProxiedUniqueConnectionsByHTTP(srcFQDNPair data.UniqueSrcFQDNPair, dstUniqIP data.UniqueIP,
-	parseHTTP *parsetypes.HTTP, retVals ParseResults) {
+func updateProxiedUniqueConnectionsByHTTP(srcFQDNPair data.UniqueSrcFQDNPair, srcSubnet *data.Subnet,
+	dstUniqIP data.UniqueIP, parseHTTP *parsetypes.HTTP, proxyTsUnits int64, retVals ParseResults) {
 
 	retVals.ProxyUniqueConnLock.Lock()
 	defer retVals.ProxyUniqueConnLock.Unlock()
@@ -135,17 +183,31 @@ func updateProxiedUniqueConnectionsByHTTP(srcFQDNPair data.UniqueSrcFQDNPair, ds
 	if _, ok := retVals.ProxyUniqueConnMap[srcFQDNKey]; !ok {
 		// create new host record with src and dst
 		retVals.ProxyUniqueConnMap[srcFQDNKey] = &uconnproxy.Input{
-			Hosts: srcFQDNPair,
-			Proxy: dstUniqIP,
+			Hosts:     srcFQDNPair,
+			SrcSubnet: srcSubnet,
+			Proxy:     dstUniqIP,
 		}
 	}
 
 	// ///// INCREMENT THE CONNECTION COUNT FOR THE PROXIED UNIQUE CONNECTION /////
 	retVals.ProxyUniqueConnMap[srcFQDNKey].ConnectionCount++
 
+	// ///// RECORD THE UID TO LOOK UP THE CONNECTION DURATION AFTER PARSING /////
+	if retVals.ProxyUIDMap != nil && parseHTTP.UID != "" {
+		retVals.ProxyUIDMap[parseHTTP.UID] = srcFQDNKey
+	}
+
 	// ///// UNION TIMESTAMP WITH PROXIED UNIQUE CONNECTION TIMESTAMP SET /////
+	// proxyTsUnits is the number of timestamp units per second
 	ts := parseHTTP.TimeStamp
-	if !util.Int64InSlice(ts, retVals.ProxyUniqueConnMap[srcFQDNKey].TsList) {
+	if proxyTsUnits > 1 {
+		ts = parseHTTP.TimeStampNanos / (int64(time.Second) / proxyTsUnits)
+	}
+	// timestamps which failed to parse are set to -1 and would throw off the beacon
+	// analysis, so they are dropped while the connection itself is still counted
+	if parseHTTP.TimeStamp < 0 || parseHTTP.TimeStampNanos < 0 {
+		metrics.TimestampsDropped.WithLabelValues("http").Inc()
+	} else if !util.Int64InSlice(ts, retVals.ProxyUniqueConnMap[srcFQDNKey].TsList) {
 		retVals.ProxyUniqueConnMap[srcFQDNKey].TsList = append(
 			retVals.ProxyUniqueConnMap[srcFQDNKey].TsList, ts,
 		)
@@ -0,0 +1,204 @@
+package parser
+
+import (
+	"net"
+	"testing"
+
+	"github.com/activecm/rita/config"
+	"github.com/activecm/rita/parser/parsetypes"
+	"github.com/activecm/rita/pkg/beaconproxy"
+	"github.com/activecm/rita/pkg/data"
+	"github.com/stretchr/testify/require"
+)
+
+//testProxyRequest creates a proxied HTTP request from the source to example.com
+func testProxyRequest(src string, ts int64) *parsetypes.HTTP {
+	return &parsetypes.HTTP{
+		TimeStamp:   ts,
+		Source:      src,
+		Destination: "10.0.1.1",
+		Method:      "CONNECT",
+		Host:        "example.com",
+	}
+}
+
+func TestParseHTTPEntrySubnetAggregation(t *testing.T) {
+	conf, err := config.LoadTestingConfig("")
+	require.Nil(t, err)
+	testFilter := newFilter(conf)
+
+	sources := []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}
+
+	// each source is tracked separately by default
+	retVals := newParseResults()
+	for i, src := range sources {
+		parseHTTPEntry(testProxyRequest(src, int64(1234560+i*60)), testFilter, proxyFields{}, 1, nil, retVals)
+	}
+	require.Len(t, retVals.ProxyUniqueConnMap, 3)
+	for _, entry := range retVals.ProxyUniqueConnMap {
+		require.Nil(t, entry.SrcSubnet)
+	}
+
+	// sources in the same subnet are aggregated together
+	retVals = newParseResults()
+	prefixLengths := &data.SubnetPrefixLengths{IPv4: 24, IPv6: 64}
+	for i, src := range sources {
+		parseHTTPEntry(testProxyRequest(src, int64(1234560+i*60)), testFilter, proxyFields{}, 1, prefixLengths, retVals)
+	}
+	// a source in another subnet is kept apart
+	parseHTTPEntry(testProxyRequest("10.0.2.1", 1234560), testFilter, proxyFields{}, 1, prefixLengths, retVals)
+	require.Len(t, retVals.ProxyUniqueConnMap, 2)
+
+	var aggregated []string
+	for _, entry := range retVals.ProxyUniqueConnMap {
+		require.NotNil(t, entry.SrcSubnet)
+		require.Equal(t, entry.SrcSubnet.CIDR, entry.Hosts.SrcIP)
+		if entry.Hosts.SrcIP == "10.0.0.0/24" {
+			require.Equal(t, int64(3), entry.ConnectionCount)
+			require.Equal(t, []int64{1234560, 1234620, 1234680}, entry.TsList)
+		}
+		aggregated = append(aggregated, entry.Hosts.SrcIP)
+	}
+	require.ElementsMatch(t, []string{"10.0.0.0/24", "10.0.2.0/24"}, aggregated)
+}
+
+func TestParseHTTPEntryInvalidTimestamp(t *testing.T) {
+	conf, err := config.LoadTestingConfig("")
+	require.Nil(t, err)
+	testFilter := newFilter(conf)
+
+	valid := []int64{1234560, 1234618, 1234678, 1234740}
+	retVals := newParseResults()
+	for _, ts := range valid {
+		parseHTTPEntry(testProxyRequest("10.0.0.1", ts), testFilter, proxyFields{}, 1, nil, retVals)
+	}
+	// a timestamp which failed to parse is set to -1
+	invalid := testProxyRequest("10.0.0.1", -1)
+	invalid.TimeStampNanos = -1
+	parseHTTPEntry(invalid, testFilter, proxyFields{}, 1, nil, retVals)
+
+	// the request is still counted, but its timestamp is dropped
+	require.Len(t, retVals.ProxyUniqueConnMap, 1)
+	entry := retVals.ProxyUniqueConnMap[data.NewUniqueSrcFQDNPair(
+		data.NewUniqueIP(net.ParseIP("10.0.0.1"), "", ""), "example.com",
+	).MapKey()]
+	require.Equal(t, int64(5), entry.ConnectionCount)
+	require.Equal(t, valid, entry.TsList)
+
+	scorer := beaconproxy.NewDefaultProxyScorer(conf)
+	score := func(tsList []int64) float64 {
+		diff := make([]int64, len(tsList)-1)
+		for i := range diff {
+			diff[i] = tsList[i+1] - tsList[i]
+		}
+		return scorer.Score(diff, int(entry.ConnectionCount), valid[0], valid[len(valid)-1]).Score
+	}
+
+	// the -1 would have turned into a huge delta time and dragged the score down
+	contaminated := append([]int64{-1}, valid...)
+	require.Less(t, score(contaminated), score(valid))
+	require.Equal(t, score(valid), score(entry.TsList))
+}
+
+func TestParseHTTPEntryProxyFields(t *testing.T) {
+	conf, err := config.LoadTestingConfig("")
+	require.Nil(t, err)
+	testFilter := newFilter(conf)
+
+	proxyKey := func(src string, fqdn string) string {
+		return data.NewUniqueSrcFQDNPair(data.NewUniqueIP(net.ParseIP(src), "", ""), fqdn).MapKey()
+	}
+
+	// a sensor in front of the proxy logs the CONNECT requests made to it
+	connect := testProxyRequest("10.0.0.1", 1234560)
+	connect.URI = "example.com:443"
+	connect.Host = ""
+	// a plain request made directly to a server isn't proxied
+	direct := &parsetypes.HTTP{
+		TimeStamp: 1234560, Source: "10.0.0.2", Destination: "93.184.216.34",
+		Method: "GET", Host: "example.org", URI: "/",
+	}
+	// a forward proxy logs the absolute URI of the requests it relays along with the proxy headers
+	relayed := &parsetypes.HTTP{
+		TimeStamp: 1234560, Source: "10.0.0.3", Destination: "10.0.1.1",
+		Method: "GET", Host: "10.0.1.1:3128", URI: "http://example.net/check-in",
+		Proxied: []string{"VIA -> 1.1 squid"},
+	}
+
+	// CONNECT requests are proxied by default
+	retVals := newParseResults()
+	for _, request := range []*parsetypes.HTTP{connect, direct, relayed} {
+		parseHTTPEntry(request, testFilter, newProxyFields(conf), 1, nil, retVals)
+	}
+	require.Len(t, retVals.ProxyUniqueConnMap, 1)
+	entry := retVals.ProxyUniqueConnMap[proxyKey("10.0.0.1", "example.com")]
+	require.NotNil(t, entry)
+	require.Equal(t, "10.0.1.1", entry.Proxy.IP)
+
+	// the proxy headers mark the proxied requests, and the FQDN is read from the URI
+	conf.S.BeaconProxy.ProxyDetection.Indicator = "proxied"
+	conf.S.BeaconProxy.ProxyDetection.FQDNField = "uri"
+	retVals = newParseResults()
+	for _, request := range []*parsetypes.HTTP{connect, direct, relayed} {
+		parseHTTPEntry(request, testFilter, newProxyFields(conf), 1, nil, retVals)
+	}
+	require.Len(t, retVals.ProxyUniqueConnMap, 1)
+	entry = retVals.ProxyUniqueConnMap[proxyKey("10.0.0.3", "example.net")]
+	require.NotNil(t, entry)
+	require.Equal(t, "10.0.1.1", entry.Proxy.IP)
+	require.Equal(t, []int64{1234560}, entry.TsList)
+
+	// the host header is used when the URI doesn't hold an FQDN
+	require.Equal(t, "example.org", newProxyFields(conf).fqdn(&parsetypes.HTTP{Host: "example.org"}))
+}
+
+func TestMatchProxyBytes(t *testing.T) {
+	conf, err := config.LoadTestingConfig("")
+	require.Nil(t, err)
+	testFilter := newFilter(conf)
+
+	retVals := newParseResults()
+	retVals.ProxyUIDMap = make(map[string]string)
+	retVals.ConnBytesMap = make(map[string]ConnBytes)
+
+	for i, uid := range []string{"C1", "C2"} {
+		request := testProxyRequest("10.0.0.1", int64(1234560+i*60))
+		request.UID = uid
+		parseHTTPEntry(request, testFilter, proxyFields{}, 1, nil, retVals)
+	}
+	// the connection carrying this request is missing from the conn logs
+	request := testProxyRequest("10.0.0.2", 1234560)
+	request.UID = "C3"
+	parseHTTPEntry(request, testFilter, proxyFields{}, 1, nil, retVals)
+
+	for i, uid := range []string{"C1", "C2"} {
+		conn := testNetFlow(int64(1234560+i*60), 0).Record().(*parsetypes.Conn)
+		conn.UID = uid
+		conn.OrigBytes = int64(100 * (i + 1))
+		conn.RespBytes = int64(1000 * (i + 1))
+		parseConnEntry(conn, testFilter, retVals)
+	}
+
+	matchProxyBytes(retVals)
+
+	require.Len(t, retVals.ProxyUniqueConnMap, 2)
+	for _, entry := range retVals.ProxyUniqueConnMap {
+		if entry.Hosts.SrcIP == "10.0.0.1" {
+			require.Equal(t, int64(300), *entry.OrigBytes)
+			require.Equal(t, int64(3000), *entry.RespBytes)
+			require.ElementsMatch(t, []int64{1100, 2200}, entry.BytesList)
+		} else {
+			require.Nil(t, entry.OrigBytes)
+			require.Nil(t, entry.RespBytes)
+			require.Nil(t, entry.BytesList)
+		}
+	}
+
+	// byte counts aren't tracked unless they are enabled
+	retVals = newParseResults()
+	conn := testNetFlow(1234560, 0).Record().(*parsetypes.Conn)
+	conn.UID = "C1"
+	parseConnEntry(conn, testFilter, retVals)
+	matchProxyBytes(retVals)
+	require.Nil(t, retVals.ConnBytesMap)
+}
@@ -0,0 +1,301 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/activecm/rita/config"
+	"github.com/activecm/rita/metrics"
+	"github.com/activecm/rita/parser/files"
+	"github.com/activecm/rita/parser/parsetypes"
+	jsoniter "github.com/json-iterator/go"
+	kafka "github.com/segmentio/kafka-go"
+	log "github.com/sirupsen/logrus"
+)
+
+//kafkaCommitTimeout bounds how long committing offsets may hold up shutting down
+const kafkaCommitTimeout = 30 * time.Second
+
+//kafkaReader reads the messages of a Kafka topic as part of a consumer group.
+//*kafka.Reader satisfies this interface.
+type kafkaReader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+//KafkaConsumer reads Zeek JSON logs from Kafka topics. The value of each message is
+//parsed as a single Zeek JSON log line and handed to the aggregate callback. The
+//offsets of the messages read are only committed when Commit is called, so that
+//messages which haven't been written to the database are read again after a restart.
+type KafkaConsumer struct {
+	readers   map[string]kafkaReader
+	logTypes  map[string]string
+	factories map[string]func() parsetypes.BroData
+	log       *log.Logger
+	aggregate func(parsetypes.BroData)
+
+	mu sync.Mutex
+	// pending holds the last message read from each partition of each topic
+	// which has yet to be committed
+	pending map[string]map[int]kafka.Message
+}
+
+//NewKafkaConsumer joins the configured consumer group for each of the configured topics
+func NewKafkaConsumer(conf *config.KafkaStaticCfg, logger *log.Logger,
+	aggregate func(parsetypes.BroData)) (*KafkaConsumer, error) {
+
+	if len(conf.Brokers) == 0 {
+		return nil, errors.New("no Kafka brokers are configured")
+	}
+	if len(conf.Topics) == 0 {
+		return nil, errors.New("no Kafka topics are configured")
+	}
+	if conf.GroupID == "" {
+		return nil, errors.New("a Kafka consumer group is required to track offsets")
+	}
+
+	readers := make(map[string]kafkaReader)
+	for topic := range conf.Topics {
+		readers[topic] = kafka.NewReader(kafka.ReaderConfig{
+			Brokers: conf.Brokers,
+			GroupID: conf.GroupID,
+			Topic:   topic,
+		})
+	}
+
+	consumer, err := newKafkaConsumer(readers, conf.Topics, logger, aggregate)
+	if err != nil {
+		for _, reader := range readers {
+			reader.Close()
+		}
+		return nil, err
+	}
+	return consumer, nil
+}
+
+//newKafkaConsumer creates a KafkaConsumer reading from the given readers. logTypes
+//maps each topic to the type of Zeek log it holds. Topics without a log type hold
+//logs of several types, which are told apart by their _path fields.
+func newKafkaConsumer(readers map[string]kafkaReader, logTypes map[string]string, logger *log.Logger,
+	aggregate func(parsetypes.BroData)) (*KafkaConsumer, error) {
+
+	k := &KafkaConsumer{
+		readers:   readers,
+		logTypes:  logTypes,
+		factories: make(map[string]func() parsetypes.BroData),
+		log:       logger,
+		aggregate: aggregate,
+		pending:   make(map[string]map[int]kafka.Message),
+	}
+
+	for topic, logType := range logTypes {
+		if logType == "" {
+			continue
+		}
+		factory := parsetypes.NewBroDataFactory(logType)
+		if factory == nil {
+			return nil, fmt.Errorf("log type %q of topic %s is not supported", logType, topic)
+		}
+		k.factories[topic] = factory
+	}
+	return k, nil
+}
+
+//Run reads messages from every topic until ctx is done or a topic can no longer be
+//read. Returns nil if it was stopped by ctx.
+func (k *KafkaConsumer) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errs := make(chan error, len(k.readers))
+	wg := new(sync.WaitGroup)
+	for topic, reader := range k.readers {
+		wg.Add(1)
+		go func(topic string, reader kafkaReader) {
+			defer wg.Done()
+			if err := k.consume(ctx, topic, reader); err != nil {
+				errs <- err
+				cancel()
+			}
+		}(topic, reader)
+	}
+	wg.Wait()
+
+	select {
+	case err := <-errs:
+		return err
+	default:
+		return nil
+	}
+}
+
+//consume reads the messages of a topic until ctx is done
+func (k *KafkaConsumer) consume(ctx context.Context, topic string, reader kafkaReader) error {
+	for {
+		msg, err := reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("could not read from topic %s: %v", topic, err)
+		}
+
+		entry, err := k.parseMessage(msg)
+		if err == nil {
+			k.aggregate(entry)
+		}
+
+		// messages which failed to parse are committed as well since reading
+		// them again wouldn't fix them
+		k.mu.Lock()
+		if k.pending[msg.Topic] == nil {
+			k.pending[msg.Topic] = make(map[int]kafka.Message)
+		}
+		k.pending[msg.Topic][msg.Partition] = msg
+		k.mu.Unlock()
+	}
+}
+
+//parseMessage parses the value of a message as a Zeek JSON log line. The type of
+//log is given by the message's topic, or by its _path field if the topic holds logs
+//of several types.
+func (k *KafkaConsumer) parseMessage(msg kafka.Message) (parsetypes.BroData, error) {
+	factory, ok := k.factories[msg.Topic]
+	if !ok {
+		path := jsoniter.Get(msg.Value, "_path").ToString()
+		if path != "" {
+			factory = parsetypes.NewBroDataFactory(path)
+		}
+		if factory == nil {
+			k.log.WithFields(log.Fields{
+				"topic":     msg.Topic,
+				"partition": msg.Partition,
+				"offset":    msg.Offset,
+				"path":      path,
+			}).Error("Could not determine the log type of Kafka message")
+			metrics.ParseErrors.Inc()
+			return nil, fmt.Errorf("unknown log type %q", path)
+		}
+	}
+
+	return files.ParseJSONLine(msg.Value, factory, k.log)
+}
+
+//TakePending returns the last message read from each partition since the last call.
+//Committing them marks every message read before them as consumed.
+func (k *KafkaConsumer) TakePending() []kafka.Message {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	var msgs []kafka.Message
+	for _, partitions := range k.pending {
+		for _, msg := range partitions {
+			msgs = append(msgs, msg)
+		}
+	}
+	k.pending = make(map[string]map[int]kafka.Message)
+
+	sort.Slice(msgs, func(i, j int) bool {
+		if msgs[i].Topic != msgs[j].Topic {
+			return msgs[i].Topic < msgs[j].Topic
+		}
+		return msgs[i].Partition < msgs[j].Partition
+	})
+	return msgs
+}
+
+//Commit commits the offsets of the given messages to the consumer group
+func (k *KafkaConsumer) Commit(ctx context.Context, msgs []kafka.Message) error {
+	byTopic := make(map[string][]kafka.Message)
+	for _, msg := range msgs {
+		byTopic[msg.Topic] = append(byTopic[msg.Topic], msg)
+	}
+
+	for topic, topicMsgs := range byTopic {
+		reader, ok := k.readers[topic]
+		if !ok {
+			return fmt.Errorf("not consuming topic %s", topic)
+		}
+		if err := reader.CommitMessages(ctx, topicMsgs...); err != nil {
+			return fmt.Errorf("could not commit offsets for topic %s: %v", topic, err)
+		}
+	}
+	return nil
+}
+
+//Close leaves the consumer group
+func (k *KafkaConsumer) Close() error {
+	var firstErr error
+	for _, reader := range k.readers {
+		if err := reader.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+//ConsumeKafka imports the logs read from the configured Kafka topics until ctx is
+//done. The records read are aggregated in memory and written to the database every
+//flush interval, after which the offsets of the messages holding them are committed.
+func (fs *FSImporter) ConsumeKafka(ctx context.Context) error {
+	if !fs.prepareDatabase() {
+		return fmt.Errorf("could not prepare database %s", fs.database.GetSelectedDB())
+	}
+
+	stream := fs.newStreamImporter()
+	consumer, err := NewKafkaConsumer(&fs.config.S.Kafka, fs.log, stream.aggregate)
+	if err != nil {
+		return err
+	}
+	defer consumer.Close()
+
+	// the offsets are captured along with the records written in the same flush
+	flush := func() error {
+		var msgs []kafka.Message
+		stream.flush(func() {
+			msgs = consumer.TakePending()
+		})
+
+		commitCtx, cancel := context.WithTimeout(context.Background(), kafkaCommitTimeout)
+		defer cancel()
+		return consumer.Commit(commitCtx, msgs)
+	}
+
+	runCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- consumer.Run(runCtx)
+	}()
+	fmt.Printf("\t[+] Consuming logs from Kafka as consumer group %s\n", fs.config.S.Kafka.GroupID)
+
+	ticker := time.NewTicker(flushInterval(fs.config.S.Kafka.FlushInterval))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			fmt.Println("\t[-] Writing consumed logs to: " + fs.database.GetSelectedDB() + " ... ")
+			if err := flush(); err != nil {
+				fs.log.WithField("error", err.Error()).Error("Could not commit Kafka offsets")
+			}
+		case err = <-runErr:
+			if flushErr := flush(); err == nil {
+				err = flushErr
+			}
+			return err
+		case <-ctx.Done():
+			fmt.Println("\t[-] Writing remaining logs to: " + fs.database.GetSelectedDB() + " ... ")
+			err = <-runErr
+			if flushErr := flush(); err == nil {
+				err = flushErr
+			}
+			return err
+		}
+	}
+}
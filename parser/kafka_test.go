@@ -0,0 +1,175 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/activecm/rita/parser/parsetypes"
+	kafka "github.com/segmentio/kafka-go"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+//mockKafkaReader serves a fixed list of messages like a topic of a Kafka broker
+type mockKafkaReader struct {
+	mu        sync.Mutex
+	msgs      []kafka.Message
+	next      int
+	err       error
+	committed []kafka.Message
+	closed    bool
+}
+
+//newMockKafkaReader creates a topic holding the given message values in a single partition
+func newMockKafkaReader(topic string, values ...string) *mockKafkaReader {
+	reader := &mockKafkaReader{}
+	for i, value := range values {
+		reader.msgs = append(reader.msgs, kafka.Message{
+			Topic:  topic,
+			Offset: int64(i),
+			Value:  []byte(value),
+		})
+	}
+	return reader
+}
+
+//FetchMessage returns the next message, blocking until ctx is done once the topic is exhausted
+func (r *mockKafkaReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	r.mu.Lock()
+	if r.next < len(r.msgs) {
+		msg := r.msgs[r.next]
+		r.next++
+		r.mu.Unlock()
+		return msg, nil
+	}
+	err := r.err
+	r.mu.Unlock()
+
+	if err != nil {
+		return kafka.Message{}, err
+	}
+	<-ctx.Done()
+	return kafka.Message{}, ctx.Err()
+}
+
+func (r *mockKafkaReader) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.committed = append(r.committed, msgs...)
+	return nil
+}
+
+func (r *mockKafkaReader) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+	return nil
+}
+
+//kafkaCollector collects the records aggregated by a KafkaConsumer
+type kafkaCollector struct {
+	mu      sync.Mutex
+	records []parsetypes.BroData
+}
+
+func (c *kafkaCollector) aggregate(entry parsetypes.BroData) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.records = append(c.records, entry)
+}
+
+func (c *kafkaCollector) count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.records)
+}
+
+func TestKafkaConsumer(t *testing.T) {
+	connTopic := newMockKafkaReader("zeek-conn",
+		`{"ts":1517336042.090,"uid":"CW7Bl13YdrhYbvlV3","id.orig_h":"10.0.0.1","id.orig_p":53542,"id.resp_h":"93.184.216.34","id.resp_p":443,"proto":"tcp","orig_ip_bytes":120}`,
+		`{"ts":1517336102.090,"uid":"CnmUhu3Nxy6U4uzEi5","id.orig_h":"10.0.0.1","id.orig_p":53543,"id.resp_h":"93.184.216.34","id.resp_p":443,"proto":"tcp","orig_ip_bytes":180}`,
+	)
+	// the other topic holds several log types which are told apart by their _path fields
+	mixedTopic := newMockKafkaReader("zeek",
+		`{"_path":"dns","ts":1517336042.279,"uid":"C3Dn1E2vRLbcASwGS3","id.orig_h":"10.0.0.1","id.orig_p":49437,"id.resp_h":"10.0.0.53","id.resp_p":53,"proto":"udp","query":"example.com","qtype_name":"A"}`,
+		`{"_path":"weird","ts":1517336042.279,"name":"bad_TCP_checksum"}`,
+		`{"_path":"conn","ts":1517336162.090,"uid":"CmVKaB2ZOuqLyvJEYl","id.orig_h":"10.0.0.2","id.orig_p":53544,"id.resp_h":"93.184.216.34","id.resp_p":443,"proto":"tcp"}`,
+	)
+
+	collector := &kafkaCollector{}
+	consumer, err := newKafkaConsumer(
+		map[string]kafkaReader{"zeek-conn": connTopic, "zeek": mixedTopic},
+		map[string]string{"zeek-conn": "conn", "zeek": ""},
+		log.New(), collector.aggregate,
+	)
+	require.Nil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- consumer.Run(ctx)
+	}()
+
+	require.Eventually(t, func() bool {
+		return collector.count() == 4
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// shutting down stops reading without an error
+	cancel()
+	require.Nil(t, <-done)
+
+	byUID := make(map[string]parsetypes.BroData)
+	for _, record := range collector.records {
+		switch typed := record.(type) {
+		case *parsetypes.Conn:
+			byUID[typed.UID] = typed
+		case *parsetypes.DNS:
+			byUID[typed.UID] = typed
+		}
+	}
+	require.Len(t, byUID, 4)
+	require.Equal(t, int64(120), byUID["CW7Bl13YdrhYbvlV3"].(*parsetypes.Conn).OrigIPBytes)
+	require.Equal(t, "10.0.0.2", byUID["CmVKaB2ZOuqLyvJEYl"].(*parsetypes.Conn).Source)
+	require.Equal(t, "example.com", byUID["C3Dn1E2vRLbcASwGS3"].(*parsetypes.DNS).Query)
+
+	// the last message of each partition is committed, including the unparsable one
+	pending := consumer.TakePending()
+	require.Len(t, pending, 2)
+	require.Nil(t, consumer.Commit(context.Background(), pending))
+	require.Len(t, connTopic.committed, 1)
+	require.Equal(t, int64(1), connTopic.committed[0].Offset)
+	require.Len(t, mixedTopic.committed, 1)
+	require.Equal(t, int64(2), mixedTopic.committed[0].Offset)
+
+	// nothing is left to commit
+	require.Empty(t, consumer.TakePending())
+
+	require.Nil(t, consumer.Close())
+	require.True(t, connTopic.closed)
+	require.True(t, mixedTopic.closed)
+}
+
+func TestKafkaConsumerReadError(t *testing.T) {
+	topic := newMockKafkaReader("zeek-conn")
+	topic.err = errors.New("broker unavailable")
+
+	consumer, err := newKafkaConsumer(
+		map[string]kafkaReader{"zeek-conn": topic},
+		map[string]string{"zeek-conn": "conn"},
+		log.New(), func(parsetypes.BroData) {},
+	)
+	require.Nil(t, err)
+	require.NotNil(t, consumer.Run(context.Background()))
+}
+
+func TestKafkaConsumerUnsupportedLogType(t *testing.T) {
+	_, err := newKafkaConsumer(
+		map[string]kafkaReader{"zeek-weird": newMockKafkaReader("zeek-weird")},
+		map[string]string{"zeek-weird": "weird"},
+		log.New(), func(parsetypes.BroData) {},
+	)
+	require.NotNil(t, err)
+}
@@ -0,0 +1,50 @@
+package parser
+
+import (
+	"github.com/activecm/rita/config"
+	"github.com/activecm/rita/parser/parsetypes"
+)
+
+//defaultNetwork is the network bound to the records which don't identify the sensor
+//which logged them. The private addresses of these records are otherwise bound to the
+//unknown private network.
+type defaultNetwork struct {
+	uuid string
+	name string
+}
+
+func newDefaultNetwork(conf *config.Config) defaultNetwork {
+	return defaultNetwork{
+		uuid: conf.S.Parsing.DefaultNetwork.UUID,
+		name: conf.S.Parsing.DefaultNetwork.Name,
+	}
+}
+
+//apply binds a record to the default network if the record is missing its sensor's UUID
+//or name. Records which identify their sensor are left alone so they are never merged
+//with the default network.
+func (n defaultNetwork) apply(entry parsetypes.BroData) {
+	if n.uuid == "" || n.name == "" {
+		return
+	}
+
+	bind := func(agentUUID *string, agentHostname *string) {
+		if *agentUUID == "" || *agentHostname == "" {
+			*agentUUID = n.uuid
+			*agentHostname = n.name
+		}
+	}
+
+	switch typedEntry := entry.(type) {
+	case *parsetypes.Conn:
+		bind(&typedEntry.AgentUUID, &typedEntry.AgentHostname)
+	case *parsetypes.DNS:
+		bind(&typedEntry.AgentUUID, &typedEntry.AgentHostname)
+	case *parsetypes.HTTP:
+		bind(&typedEntry.AgentUUID, &typedEntry.AgentHostname)
+	case *parsetypes.OpenConn:
+		bind(&typedEntry.AgentUUID, &typedEntry.AgentHostname)
+	case *parsetypes.SSL:
+		bind(&typedEntry.AgentUUID, &typedEntry.AgentHostname)
+	}
+}
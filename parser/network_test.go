@@ -0,0 +1,58 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/activecm/rita/config"
+	"github.com/activecm/rita/parser/parsetypes"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultNetwork(t *testing.T) {
+	conf, err := config.LoadTestingConfig("")
+	require.Nil(t, err)
+	conf.S.Parsing.DefaultNetwork = config.DefaultNetworkStaticCfg{
+		Name: "Office", UUID: "0b7f3f4c-2a3e-4c51-9a47-8d9e1c2b3a4d",
+	}
+	fs := &FSImporter{filter: newFilter(conf), defaultNetwork: newDefaultNetwork(conf)}
+
+	newConn := func(ts int64, agentUUID, agentHostname string) *parsetypes.Conn {
+		return &parsetypes.Conn{
+			TimeStamp:       ts,
+			Source:          "10.0.0.1",
+			SourcePort:      53542,
+			Destination:     "93.184.216.34",
+			DestinationPort: 443,
+			Proto:           "tcp",
+			AgentUUID:       agentUUID,
+			AgentHostname:   agentHostname,
+		}
+	}
+
+	retVals := newParseResults()
+	// records missing either agent field are bound to the default network
+	fs.aggregateEntry(newConn(1517336042, "", ""), 0, nil, retVals)
+	fs.aggregateEntry(newConn(1517336102, "", "sensor"), 0, nil, retVals)
+	// the network of a record naming its sensor is kept
+	fs.aggregateEntry(newConn(1517336162, "4a8f1d0e-6c7b-4f3a-8e2d-1b9c0a7f6e5d", "sensor"), 0, nil, retVals)
+
+	require.Len(t, retVals.UniqueConnMap, 2)
+	connCounts := make(map[string]int64)
+	for _, entry := range retVals.UniqueConnMap {
+		require.Equal(t, "Public", entry.Hosts.DstNetworkName)
+		connCounts[entry.Hosts.SrcNetworkName] = entry.ConnectionCount
+	}
+	require.Equal(t, map[string]int64{"Office": 2, "sensor": 1}, connCounts)
+
+	// the source is seen on both networks while the public destination is shared
+	require.Len(t, retVals.HostMap, 3)
+	for _, entry := range retVals.HostMap {
+		require.Contains(t, []string{"Office", "sensor", "Public"}, entry.Host.NetworkName)
+	}
+
+	// records aren't changed if no default network is configured
+	conn := newConn(1517336042, "", "")
+	newDefaultNetwork(&config.Config{}).apply(conn)
+	require.Empty(t, conn.AgentUUID)
+	require.Empty(t, conn.AgentHostname)
+}
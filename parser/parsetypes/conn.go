@@ -68,3 +68,8 @@ func (line *Conn) TargetCollection(config *config.StructureTableCfg) string {
 func (line *Conn) ConvertFromJSON() {
 	line.TimeStamp = convertTimestamp(line.TimeStampGeneric)
 }
+
+//ConnUID returns the uid of the connection this entry was logged for
+func (line *Conn) ConnUID() string {
+	return line.UID
+}
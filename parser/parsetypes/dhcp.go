@@ -0,0 +1,51 @@
+package parsetypes
+
+import (
+	"github.com/activecm/rita/config"
+)
+
+// DHCP provides a data structure for zeek's dhcp lease data
+type DHCP struct {
+	// TimeStamp is the time of the earliest message in the DHCP exchange
+	TimeStamp int64 `bson:"ts" bro:"ts" brotype:"time" json:"-"`
+	// TimeStampGeneric is used when reading from json files
+	TimeStampGeneric interface{} `bson:"-" json:"ts"`
+	// UIDs holds the uids of the connections which carried the DHCP exchange
+	UIDs []string `bson:"uids" bro:"uids" brotype:"set[string]" json:"uids"`
+	// ClientAddr is the address of the client as seen in the IP header
+	ClientAddr string `bson:"client_addr" bro:"client_addr" brotype:"addr" json:"client_addr"`
+	// ServerAddr is the address of the server handing out the lease
+	ServerAddr string `bson:"server_addr" bro:"server_addr" brotype:"addr" json:"server_addr"`
+	// MAC is the client's hardware address
+	MAC string `bson:"mac" bro:"mac" brotype:"string" json:"mac"`
+	// HostName is the name given by the client in the Host Name option
+	HostName string `bson:"host_name" bro:"host_name" brotype:"string" json:"host_name"`
+	// ClientFQDN is the name given by the client in the Client FQDN option
+	ClientFQDN string `bson:"client_fqdn" bro:"client_fqdn" brotype:"string" json:"client_fqdn"`
+	// Domain is the domain given by the server in the Domain Name option
+	Domain string `bson:"domain" bro:"domain" brotype:"string" json:"domain"`
+	// RequestedAddr is the address requested by the client
+	RequestedAddr string `bson:"requested_addr" bro:"requested_addr" brotype:"addr" json:"requested_addr"`
+	// AssignedAddr is the address the server assigned to the client
+	AssignedAddr string `bson:"assigned_addr" bro:"assigned_addr" brotype:"addr" json:"assigned_addr"`
+	// LeaseTime is the duration of the lease in seconds
+	LeaseTime float64 `bson:"lease_time" bro:"lease_time" brotype:"interval" json:"lease_time"`
+	// MsgTypes holds the types of the messages in the DHCP exchange
+	MsgTypes []string `bson:"msg_types" bro:"msg_types" brotype:"vector[string]" json:"msg_types"`
+	// Duration is the time between the first and last messages of the DHCP exchange
+	Duration float64 `bson:"duration" bro:"duration" brotype:"interval" json:"duration"`
+	// AgentHostname names which sensor recorded this event. Only set when combining logs from multiple sensors.
+	AgentHostname string `bson:"agent_hostname" bro:"agent_hostname" brotype:"string" json:"agent_hostname"`
+	// AgentUUID identifies which sensor recorded this event. Only set when combining logs from multiple sensors.
+	AgentUUID string `bson:"agent_uuid" bro:"agent_uuid" brotype:"string" json:"agent_uuid"`
+}
+
+//TargetCollection returns the mongo collection this entry should be inserted
+func (line *DHCP) TargetCollection(config *config.StructureTableCfg) string {
+	return config.DHCPTable
+}
+
+//ConvertFromJSON performs any extra conversions necessary when reading from JSON
+func (line *DHCP) ConvertFromJSON() {
+	line.TimeStamp = convertTimestamp(line.TimeStampGeneric)
+}
@@ -75,3 +75,8 @@ func (line *DNS) TargetCollection(config *config.StructureTableCfg) string {
 func (line *DNS) ConvertFromJSON() {
 	line.TimeStamp = convertTimestamp(line.TimeStampGeneric)
 }
+
+//ConnUID returns the uid of the connection this entry was logged for
+func (line *DNS) ConnUID() string {
+	return line.UID
+}
@@ -0,0 +1,229 @@
+package parsetypes
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/activecm/rita/config"
+)
+
+//eveTimeLayout is the layout of the timestamps in Suricata's EVE logs,
+//ex: 2019-11-13T09:00:01.932360+0000
+const eveTimeLayout = "2006-01-02T15:04:05.999999999Z0700"
+
+// EVE provides a data structure for the events in Suricata's EVE JSON log. A single
+// EVE log holds events of every type. Flow events are converted into Conn records and
+// http events into HTTP records, the other event types don't produce any records.
+type EVE struct {
+	// TimeStampString is the time the event was logged
+	TimeStampString string `json:"timestamp"`
+	// FlowID is the id of the flow shared by every event logged for it
+	FlowID uint64 `json:"flow_id"`
+	// EventType names the type of the event, such as flow, http, or alert
+	EventType string `json:"event_type"`
+	// Source is the source address of the flow
+	Source string `json:"src_ip"`
+	// SourcePort is the source port of the flow
+	SourcePort int `json:"src_port"`
+	// Destination is the destination address of the flow
+	Destination string `json:"dest_ip"`
+	// DestinationPort is the destination port of the flow
+	DestinationPort int `json:"dest_port"`
+	// Proto is the transport protocol of the flow, such as TCP
+	Proto string `json:"proto"`
+	// AppProto is the application protocol detected in the flow
+	AppProto string `json:"app_proto"`
+	// Flow holds the details of flow events
+	Flow *EVEFlow `json:"flow"`
+	// HTTP holds the details of http events
+	HTTP *EVEHTTP `json:"http"`
+	// Alert holds the details of alert events
+	Alert *EVEAlert `json:"alert"`
+
+	// conn holds the record converted from a flow event
+	conn Conn
+	// http holds the record converted from an http event
+	http HTTP
+	// record points to the converted record, nil if the event doesn't produce one
+	record BroData
+}
+
+// EVEFlow holds the details of an EVE flow event
+type EVEFlow struct {
+	// PktsToServer counts the packets sent by the source
+	PktsToServer int64 `json:"pkts_toserver"`
+	// PktsToClient counts the packets sent by the destination
+	PktsToClient int64 `json:"pkts_toclient"`
+	// BytesToServer counts the bytes sent by the source, including the headers
+	BytesToServer int64 `json:"bytes_toserver"`
+	// BytesToClient counts the bytes sent by the destination, including the headers
+	BytesToClient int64 `json:"bytes_toclient"`
+	// Start is the time of the first packet of the flow
+	Start string `json:"start"`
+	// End is the time of the last packet of the flow
+	End string `json:"end"`
+	// State is the state of the flow when it was logged, such as new, established, or closed
+	State string `json:"state"`
+}
+
+// EVEHTTP holds the details of an EVE http event
+type EVEHTTP struct {
+	// Hostname is the value of the Host header
+	Hostname string `json:"hostname"`
+	// URL is the url used in the request
+	URL string `json:"url"`
+	// UserAgent is the value of the User-Agent header
+	UserAgent string `json:"http_user_agent"`
+	// Method is the request method used
+	Method string `json:"http_method"`
+	// Protocol is the version of HTTP used, such as HTTP/1.1
+	Protocol string `json:"protocol"`
+	// Status holds the status code of the response
+	Status int64 `json:"status"`
+	// Length is the length of the response body
+	Length int64 `json:"length"`
+}
+
+// EVEAlert holds the details of an EVE alert event
+type EVEAlert struct {
+	// Action is the action taken for the packet which raised the alert
+	Action string `json:"action"`
+	// SignatureID is the id of the rule which raised the alert
+	SignatureID int64 `json:"signature_id"`
+	// Signature is the name of the rule which raised the alert
+	Signature string `json:"signature"`
+	// Category is the category of the rule which raised the alert
+	Category string `json:"category"`
+	// Severity is the severity of the rule which raised the alert
+	Severity int `json:"severity"`
+}
+
+//TargetCollection returns the mongo collection this entry should be inserted.
+//EVE logs are imported as connection logs since their flow events are the
+//only events which every EVE log is guaranteed to hold.
+func (line *EVE) TargetCollection(config *config.StructureTableCfg) string {
+	return config.ConnTable
+}
+
+//ConvertFromJSON converts flow and http events into the records they produce
+func (line *EVE) ConvertFromJSON() {
+	line.record = nil
+	switch line.EventType {
+	case "flow":
+		if line.Flow != nil {
+			line.convertFlow()
+			line.record = &line.conn
+		}
+	case "http":
+		if line.HTTP != nil {
+			line.convertHTTP()
+			line.record = &line.http
+		}
+	}
+}
+
+//ConnUID returns the flow id of the event as the uid of its connection
+func (line *EVE) ConnUID() string {
+	return strconv.FormatUint(line.FlowID, 10)
+}
+
+//Record returns the record converted from the event, or nil if the event doesn't
+//produce one. The record is only valid for as long as the event.
+func (line *EVE) Record() BroData {
+	return line.record
+}
+
+//convertFlow converts a flow event into a Conn record
+func (line *EVE) convertFlow() {
+	start, startErr := parseEVETime(line.Flow.Start)
+	end, endErr := parseEVETime(line.Flow.End)
+
+	line.conn = Conn{
+		UID:             line.ConnUID(),
+		Source:          line.Source,
+		SourcePort:      line.SourcePort,
+		Destination:     line.Destination,
+		DestinationPort: line.DestinationPort,
+		Proto:           eveProto(line.Proto),
+		Service:         eveService(line.AppProto),
+		// EVE only counts the bytes including their headers
+		OrigBytes:   line.Flow.BytesToServer,
+		RespBytes:   line.Flow.BytesToClient,
+		OrigPkts:    line.Flow.PktsToServer,
+		RespPkts:    line.Flow.PktsToClient,
+		OrigIPBytes: line.Flow.BytesToServer,
+		RespIPBytes: line.Flow.BytesToClient,
+	}
+
+	// the connection starts with its first packet rather than when the flow was logged
+	if startErr == nil {
+		line.conn.TimeStamp = start.Unix()
+		if endErr == nil && end.After(start) {
+			line.conn.Duration = end.Sub(start).Seconds()
+		}
+	} else {
+		line.conn.TimeStamp = eveTimestamp(line.TimeStampString)
+	}
+}
+
+//convertHTTP converts an http event into an HTTP record
+func (line *EVE) convertHTTP() {
+	line.http = HTTP{
+		UID:             line.ConnUID(),
+		Source:          line.Source,
+		SourcePort:      line.SourcePort,
+		Destination:     line.Destination,
+		DestinationPort: line.DestinationPort,
+		Version:         strings.TrimPrefix(line.HTTP.Protocol, "HTTP/"),
+		Method:          line.HTTP.Method,
+		Host:            line.HTTP.Hostname,
+		URI:             line.HTTP.URL,
+		UserAgent:       line.HTTP.UserAgent,
+		RespLen:         line.HTTP.Length,
+		StatusCode:      line.HTTP.Status,
+	}
+
+	if t, err := parseEVETime(line.TimeStampString); err == nil {
+		line.http.TimeStamp = t.Unix()
+		line.http.TimeStampNanos = t.UnixNano()
+	}
+}
+
+//parseEVETime parses a timestamp from an EVE log. RFC3339 timestamps are accepted
+//as well since EVE logs are often reformatted by log shippers.
+func parseEVETime(timestamp string) (time.Time, error) {
+	t, err := time.Parse(eveTimeLayout, timestamp)
+	if err != nil {
+		t, err = time.Parse(time.RFC3339, timestamp)
+	}
+	return t.UTC(), err
+}
+
+//eveTimestamp converts a timestamp from an EVE log into a Unix timestamp,
+//0 if it can't be parsed
+func eveTimestamp(timestamp string) int64 {
+	t, err := parseEVETime(timestamp)
+	if err != nil {
+		return 0
+	}
+	return t.Unix()
+}
+
+//eveProto converts an EVE transport protocol into the name Zeek uses for it
+func eveProto(proto string) string {
+	proto = strings.ToLower(proto)
+	if proto == "ipv6-icmp" {
+		return "icmp"
+	}
+	return proto
+}
+
+//eveService converts an EVE application protocol into the service Zeek would log.
+//Suricata logs "failed" if it couldn't detect the application protocol.
+func eveService(appProto string) string {
+	if appProto == "failed" {
+		return ""
+	}
+	return appProto
+}
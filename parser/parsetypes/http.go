@@ -11,6 +11,8 @@ type HTTP struct {
 	ID bson.ObjectId `bson:"_id,omitempty"`
 	// TimeStamp of this connection
 	TimeStamp int64 `bson:"ts" bro:"ts" brotype:"time" json:"-"`
+	// TimeStampNanos holds the timestamp of this connection in nanoseconds
+	TimeStampNanos int64 `bson:"-" bro:"ts" brotype:"time" brounit:"ns" json:"-"`
 	// TimeStampGeneric is used when reading from json files
 	TimeStampGeneric interface{} `bson:"-" json:"ts"`
 	// UID is the Unique Id for this connection (generated by Bro)
@@ -84,4 +86,10 @@ func (line *HTTP) TargetCollection(config *config.StructureTableCfg) string {
 //ConvertFromJSON performs any extra conversions necessary when reading from JSON
 func (line *HTTP) ConvertFromJSON() {
 	line.TimeStamp = convertTimestamp(line.TimeStampGeneric)
+	line.TimeStampNanos = convertTimestampNanos(line.TimeStampGeneric)
+}
+
+//ConnUID returns the uid of the connection this entry was logged for
+func (line *HTTP) ConnUID() string {
+	return line.UID
 }
@@ -0,0 +1,97 @@
+package parsetypes
+
+import (
+	"hash/fnv"
+	"strconv"
+	"strings"
+
+	"github.com/activecm/rita/config"
+)
+
+// NetFlow provides a data structure for the flows exported from nfcapd files by
+// nfdump's CSV output. Each flow is converted into a Conn record.
+type NetFlow struct {
+	// TimeStamp is the time of the first packet of the flow
+	TimeStamp int64
+	// EndTimeStamp is the time of the last packet of the flow, 0 if it wasn't recorded
+	EndTimeStamp int64
+	// Duration is the length of the flow in seconds, 0 if it wasn't recorded
+	Duration float64
+	// Source is the source address of the flow
+	Source string
+	// SourcePort is the source port of the flow
+	SourcePort int
+	// Destination is the destination address of the flow
+	Destination string
+	// DestinationPort is the destination port of the flow
+	DestinationPort int
+	// Proto is the transport protocol of the flow, such as TCP
+	Proto string
+	// InPkts counts the packets sent by the source
+	InPkts int64
+	// InBytes counts the bytes sent by the source, including the headers
+	InBytes int64
+	// OutPkts counts the packets sent by the destination of a bidirectional flow
+	OutPkts int64
+	// OutBytes counts the bytes sent by the destination of a bidirectional flow
+	OutBytes int64
+
+	// conn holds the record converted from the flow
+	conn Conn
+}
+
+//TargetCollection returns the mongo collection this entry should be inserted
+func (line *NetFlow) TargetCollection(config *config.StructureTableCfg) string {
+	return config.ConnTable
+}
+
+//ConvertFromJSON performs any extra conversions necessary when reading from JSON.
+//NetFlow records are only read from nfdump's CSV output.
+func (line *NetFlow) ConvertFromJSON() {}
+
+//Record converts the flow into a Conn record
+func (line *NetFlow) Record() BroData {
+	line.conn = Conn{
+		TimeStamp:       line.TimeStamp,
+		UID:             line.uid(),
+		Source:          line.Source,
+		SourcePort:      line.SourcePort,
+		Destination:     line.Destination,
+		DestinationPort: line.DestinationPort,
+		Proto:           strings.ToLower(line.Proto),
+		Duration:        line.duration(),
+		// NetFlow only counts the bytes including their headers
+		OrigBytes:   line.InBytes,
+		RespBytes:   line.OutBytes,
+		OrigPkts:    line.InPkts,
+		RespPkts:    line.OutPkts,
+		OrigIPBytes: line.InBytes,
+		RespIPBytes: line.OutBytes,
+	}
+	return &line.conn
+}
+
+//duration returns the length of the flow. Flows lacking an end time are given
+//a duration of 0.
+func (line *NetFlow) duration() float64 {
+	if line.Duration > 0 {
+		return line.Duration
+	}
+	if line.EndTimeStamp > line.TimeStamp {
+		return float64(line.EndTimeStamp - line.TimeStamp)
+	}
+	return 0
+}
+
+//uid creates a uid for the flow since NetFlow doesn't assign one. Flows sharing
+//a start time and five tuple are given the same uid.
+func (line *NetFlow) uid() string {
+	hash := fnv.New64a()
+	hash.Write([]byte(strings.Join([]string{
+		strconv.FormatInt(line.TimeStamp, 10),
+		line.Source, strconv.Itoa(line.SourcePort),
+		line.Destination, strconv.Itoa(line.DestinationPort),
+		line.Proto,
+	}, "|")))
+	return "N" + strconv.FormatUint(hash.Sum64(), 36)
+}
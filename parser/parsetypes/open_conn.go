@@ -68,3 +68,8 @@ func (line *OpenConn) TargetCollection(config *config.StructureTableCfg) string
 func (line *OpenConn) ConvertFromJSON() {
 	line.TimeStamp = convertTimestamp(line.TimeStampGeneric)
 }
+
+//ConnUID returns the uid of the connection this entry was logged for
+func (line *OpenConn) ConnUID() string {
+	return line.UID
+}
@@ -1,7 +1,12 @@
 package parsetypes
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/activecm/rita/config"
@@ -14,9 +19,94 @@ type BroData interface {
 	ConvertFromJSON()
 }
 
+//ConnData is implemented by the BroData logged for a connection. Zeek assigns
+//each connection a uid which is shared by every log entry the connection produces,
+//so entries from different logs such as conn, http, and ssl may be joined on it.
+type ConnData interface {
+	BroData
+	ConnUID() string
+}
+
+//RecordConverter is implemented by the BroData parsed from the logs of other tools
+//which are converted into the records of the equivalent Zeek logs
+type RecordConverter interface {
+	BroData
+	// Record returns the converted record, or nil if the entry doesn't produce one.
+	// The record is only valid for as long as the entry.
+	Record() BroData
+}
+
+//GetUID returns the connection uid of a log entry. The second return value
+//is false if the entry was not logged for a connection.
+func GetUID(line BroData) (string, bool) {
+	connData, ok := line.(ConnData)
+	if !ok {
+		return "", false
+	}
+	return connData.ConnUID(), true
+}
+
+//registeredFactories holds the factories of the BroData parsed from custom logs keyed
+//by the paths of the logs
+var (
+	registeredFactoriesLock sync.RWMutex
+	registeredFactories     = make(map[string]func() BroData)
+)
+
+//RegisterBroDataFactory registers the factory of the BroData parsed from the logs
+//whose path (the #path of TSV logs or the _path of JSON logs) starts with the given
+//path. Registered factories take precedence over the built in log types, and the
+//factory registered under the longest matching path is used. The records of custom
+//logs are only analyzed if their BroData implements RecordConverter.
+func RegisterBroDataFactory(path string, factory func() BroData) error {
+	if path == "" {
+		return errors.New("log path is required")
+	}
+	if factory == nil {
+		return fmt.Errorf("factory for log path %s is nil", path)
+	}
+
+	registeredFactoriesLock.Lock()
+	defer registeredFactoriesLock.Unlock()
+
+	if _, ok := registeredFactories[path]; ok {
+		return fmt.Errorf("log path %s is already registered", path)
+	}
+	registeredFactories[path] = factory
+	return nil
+}
+
+//UnregisterBroDataFactory removes the factory registered under the given path
+func UnregisterBroDataFactory(path string) {
+	registeredFactoriesLock.Lock()
+	defer registeredFactoriesLock.Unlock()
+	delete(registeredFactories, path)
+}
+
+//registeredBroDataFactory returns the registered factory with the longest path
+//the file type starts with, or nil if there is none
+func registeredBroDataFactory(fileType string) func() BroData {
+	registeredFactoriesLock.RLock()
+	defer registeredFactoriesLock.RUnlock()
+
+	var factory func() BroData
+	longest := 0
+	for path, registered := range registeredFactories {
+		if len(path) > longest && strings.HasPrefix(fileType, path) {
+			factory = registered
+			longest = len(path)
+		}
+	}
+	return factory
+}
+
 //NewBroDataFactory creates a new BroData based on the string
 //which appears in that log's objType field
 func NewBroDataFactory(fileType string) func() BroData {
+	if factory := registeredBroDataFactory(fileType); factory != nil {
+		return factory
+	}
+
 	//Note: we use HasPrefix rather than equality for the checks
 	//in order to support configurations which tag the log types.
 	//For instance, Security Onion splits the http log out by
@@ -25,14 +115,26 @@ func NewBroDataFactory(fileType string) func() BroData {
 		return func() BroData {
 			return &Conn{}
 		}
+	} else if strings.HasPrefix(fileType, "dhcp") {
+		return func() BroData {
+			return &DHCP{}
+		}
 	} else if strings.HasPrefix(fileType, "dns") {
 		return func() BroData {
 			return &DNS{}
 		}
+	} else if strings.HasPrefix(fileType, "eve") {
+		return func() BroData {
+			return &EVE{}
+		}
 	} else if strings.HasPrefix(fileType, "http") {
 		return func() BroData {
 			return &HTTP{}
 		}
+	} else if strings.HasPrefix(fileType, "netflow") {
+		return func() BroData {
+			return &NetFlow{}
+		}
 	} else if strings.HasPrefix(fileType, "open_conn") {
 		return func() BroData {
 			return &OpenConn{}
@@ -41,25 +143,48 @@ func NewBroDataFactory(fileType string) func() BroData {
 		return func() BroData {
 			return &SSL{}
 		}
+	} else if strings.HasPrefix(fileType, "x509") {
+		return func() BroData {
+			return &X509{}
+		}
 	}
 	return nil
 }
 
 // convertTimestamp handles a timestamp in multiple formats and converts
-// it to a Unix timestamp
+// it to a Unix timestamp. Fractional seconds are dropped the same way they
+// are for timestamps read from TSV logs.
 func convertTimestamp(timestamp interface{}) int64 {
+	return TimestampSeconds(convertTimestampNanos(timestamp))
+}
+
+// convertTimestampNanos handles a timestamp in multiple formats and converts
+// it to a Unix timestamp in nanoseconds
+func convertTimestampNanos(timestamp interface{}) int64 {
 	switch input := timestamp.(type) {
 	// all number types are assumed to be in unix format, possibly with fractional seconds
 	case int:
-		return int64(input)
+		return int64(input) * int64(time.Second)
 	case int32:
-		return int64(input)
+		return int64(input) * int64(time.Second)
 	case int64:
-		return input
+		return input * int64(time.Second)
+	case json.Number:
+		// the number is parsed from its text, exactly as the timestamps of TSV logs are
+		nanos, err := ParseTimestampNanos(input.String())
+		if err == nil {
+			return nanos
+		}
 	case float32:
-		return int64(input)
+		return convertTimestampNanos(float64(input))
 	case float64:
-		return int64(input)
+		// the shortest text which reads back as the same float matches the text Zeek
+		// wrote for timestamps with up to microsecond precision, which avoids the
+		// rounding errors of scaling the float
+		nanos, err := ParseTimestampNanos(strconv.FormatFloat(input, 'f', -1, 64))
+		if err == nil {
+			return nanos
+		}
 	case string:
 		// assumed to be in RFC8601 format, though other formats can be added as necessary
 		// ex: 2019-11-13T09:00:01.932360Z
@@ -68,12 +193,63 @@ func convertTimestamp(timestamp interface{}) int64 {
 		t, err := time.Parse(time.RFC3339, input)
 		if err == nil {
 			// since the layout includes the timezone, first convert to UTC
-			return t.UTC().Unix()
+			return t.UTC().UnixNano()
 		}
 	}
 	return 0
 }
 
+// ParseTimestampNanos parses a Zeek timestamp written as decimal seconds since
+// the epoch, such as 1517336042.090842, into nanoseconds since the epoch. The
+// fractional digits are read as text, so no precision is lost to floating point,
+// and any digits past nanoseconds are dropped.
+func ParseTimestampNanos(text string) (int64, error) {
+	decimalPointIdx := strings.Index(text, ".")
+	if decimalPointIdx == -1 {
+		decimalPointIdx = len(text)
+	}
+
+	s, err := strconv.ParseInt(text[:decimalPointIdx], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	// the fractional digits are right padded to nanoseconds
+	// e.g. Zeek's default of 6 digits holds microseconds
+	var nanos int64
+	if decimalPointIdx < len(text) {
+		frac := text[decimalPointIdx+1:]
+		if len(frac) > 9 {
+			frac = frac[:9]
+		}
+		frac += strings.Repeat("0", 9-len(frac))
+
+		nanos, err = strconv.ParseInt(frac, 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		if nanos < 0 {
+			return 0, fmt.Errorf("invalid fractional seconds in timestamp %s", text)
+		}
+	}
+
+	// the fraction moves timestamps before the epoch further from it
+	if strings.HasPrefix(text, "-") {
+		return s*int64(time.Second) - nanos, nil
+	}
+	return s*int64(time.Second) + nanos, nil
+}
+
+// TimestampSeconds converts a Unix timestamp in nanoseconds into whole seconds,
+// dropping the fraction of a second the same way Zeek's logs are read
+func TimestampSeconds(nanos int64) int64 {
+	seconds := nanos / int64(time.Second)
+	if nanos%int64(time.Second) < 0 {
+		seconds--
+	}
+	return seconds
+}
+
 // Further documentation on bros datatypes can be found on the bro website at:
 // https://www.bro.org/sphinx/script-reference/types.html
 // It is of value to note that many of these types have applications specific
@@ -163,6 +339,9 @@ const (
 	// ENUM_SET is a SET which contains ENUMs
 	EnumSet = "set[enum]"
 
+	// ADDR_SET is a SET which contains ADDRs
+	AddrSet = "set[addr]"
+
 	// STRING_VECTOR is a VECTOR which contains STRINGs
 	StringVector = "vector[string]"
 
@@ -190,3 +369,22 @@ const (
 	// ANY is used to bypass strong typing in bro script.
 	Any = "any"
 )
+
+// LegacyTypes maps the type names logged by older versions of Bro to the names
+// logged by Zeek today. Bro logged sets as tables, and counters were merged
+// into counts.
+var LegacyTypes = map[string]string{
+	"table[string]": StringSet,
+	"table[enum]":   EnumSet,
+	"table[addr]":   AddrSet,
+	"counter":       Count,
+}
+
+// CanonicalType returns the name Zeek logs a type under today, given a type
+// name found in the header of a log written by any version of Bro or Zeek
+func CanonicalType(zeekType string) string {
+	if canonical, ok := LegacyTypes[zeekType]; ok {
+		return canonical
+	}
+	return zeekType
+}
@@ -1,15 +1,17 @@
 package parsetypes
 
 import (
+	"encoding/json"
 	"testing"
 
+	"github.com/activecm/rita/config"
 	"github.com/stretchr/testify/require"
 )
 
 func TestNewBroDataFactory(t *testing.T) {
 
-	testCasesIn := []string{"conn", "http", "dns", "httpa", "http_a", "http_eth0", "httpasdf12345=-ASDF?", "open_conn", "ASDF"}
-	testCasesOut := []BroData{&Conn{}, &HTTP{}, &DNS{}, &HTTP{}, &HTTP{}, &HTTP{}, &HTTP{}, &OpenConn{}, nil}
+	testCasesIn := []string{"conn", "http", "dns", "httpa", "http_a", "http_eth0", "httpasdf12345=-ASDF?", "open_conn", "eve.json", "ASDF"}
+	testCasesOut := []BroData{&Conn{}, &HTTP{}, &DNS{}, &HTTP{}, &HTTP{}, &HTTP{}, &HTTP{}, &OpenConn{}, &EVE{}, nil}
 	for i := range testCasesIn {
 		factory := NewBroDataFactory(testCasesIn[i])
 		if factory == nil {
@@ -20,12 +22,46 @@ func TestNewBroDataFactory(t *testing.T) {
 	}
 }
 
+//customLog is a BroData registered for a custom log type
+type customLog struct {
+	TimeStamp int64 `bro:"ts" brotype:"time"`
+}
+
+func (line *customLog) TargetCollection(*config.StructureTableCfg) string { return "custom" }
+
+func (line *customLog) ConvertFromJSON() {}
+
+func TestRegisterBroDataFactory(t *testing.T) {
+	factory := func() BroData { return &customLog{} }
+	require.Nil(t, RegisterBroDataFactory("custom", factory))
+	defer UnregisterBroDataFactory("custom")
+
+	require.Equal(t, &customLog{}, NewBroDataFactory("custom")())
+	require.Equal(t, &customLog{}, NewBroDataFactory("custom_eth0")())
+	require.Equal(t, &Conn{}, NewBroDataFactory("conn")())
+
+	// paths may only be registered once
+	require.NotNil(t, RegisterBroDataFactory("custom", factory))
+	require.NotNil(t, RegisterBroDataFactory("", factory))
+	require.NotNil(t, RegisterBroDataFactory("other", nil))
+
+	// registered factories take precedence over the built in log types
+	require.Nil(t, RegisterBroDataFactory("conn_custom", factory))
+	defer UnregisterBroDataFactory("conn_custom")
+	require.Equal(t, &customLog{}, NewBroDataFactory("conn_custom")())
+	require.Equal(t, &Conn{}, NewBroDataFactory("conn_long")())
+
+	UnregisterBroDataFactory("custom")
+	require.Nil(t, NewBroDataFactory("custom"))
+}
+
 func TestConvertTimestamp(t *testing.T) {
 	testCases := []struct {
 		input    interface{}
 		expected int64
 	}{
 		{1517336042.090842, 1517336042},
+		{json.Number("1517336042.999999999"), 1517336042},
 		{1517336042, 1517336042},
 		{"2018-01-30T18:14:02Z", 1517336042},
 		{0, 0},
@@ -38,3 +74,90 @@ func TestConvertTimestamp(t *testing.T) {
 		require.Equal(t, testCase.expected, actual, "input: %v", testCase.input)
 	}
 }
+
+func TestConvertTimestampNanos(t *testing.T) {
+	testCases := []struct {
+		input    interface{}
+		expected int64
+	}{
+		{1517336042.090842, 1517336042090842000},
+		{json.Number("1517336042.090842"), 1517336042090842000},
+		{1517336042, 1517336042000000000},
+		{"2018-01-30T18:14:02.25Z", 1517336042250000000},
+		{0, 0},
+		{"", 0},
+		{nil, 0},
+	}
+
+	for _, testCase := range testCases {
+		actual := convertTimestampNanos(testCase.input)
+		require.Equal(t, testCase.expected, actual, "input: %v", testCase.input)
+	}
+}
+
+func TestParseTimestampNanos(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected int64
+	}{
+		{"1517336042.090842", 1517336042090842000},
+		{"1517336042.123456789", 1517336042123456789},
+		// digits past nanoseconds are dropped
+		{"1517336042.1234567891", 1517336042123456789},
+		{"1517336042", 1517336042000000000},
+		{"-0.5", -500000000},
+	}
+	for _, testCase := range testCases {
+		actual, err := ParseTimestampNanos(testCase.input)
+		require.Nil(t, err, testCase.input)
+		require.Equal(t, testCase.expected, actual, testCase.input)
+	}
+
+	for _, input := range []string{"", "abc", "1517336042.09a", "1517336042.-5"} {
+		_, err := ParseTimestampNanos(input)
+		require.Error(t, err, input)
+	}
+
+	// the seconds are rounded down like the seconds logged by Zeek
+	require.Equal(t, int64(1517336042), TimestampSeconds(1517336042999999999))
+	require.Equal(t, int64(-1), TimestampSeconds(-500000000))
+	require.Equal(t, int64(0), TimestampSeconds(0))
+}
+
+func TestGetUID(t *testing.T) {
+	testCases := []struct {
+		input    BroData
+		expected string
+		ok       bool
+	}{
+		{&Conn{UID: "CW32gzposD"}, "CW32gzposD", true},
+		{&DNS{UID: "CW32gzposD"}, "CW32gzposD", true},
+		{&HTTP{UID: "CW32gzposD"}, "CW32gzposD", true},
+		{&OpenConn{UID: "CW32gzposD"}, "CW32gzposD", true},
+		{&SSL{UID: "CW32gzposD"}, "CW32gzposD", true},
+		// certificates are logged per file rather than per connection
+		{&X509{ID: "Fa1"}, "", false},
+	}
+
+	for _, testCase := range testCases {
+		uid, ok := GetUID(testCase.input)
+		require.Equal(t, testCase.ok, ok, "input: %T", testCase.input)
+		require.Equal(t, testCase.expected, uid, "input: %T", testCase.input)
+	}
+}
+
+func TestBroDataPool(t *testing.T) {
+	pool := NewBroDataPool(NewBroDataFactory("conn"))
+
+	conn := pool.Get().(*Conn)
+	require.Equal(t, &Conn{}, conn)
+	conn.UID = "CW32gzposD"
+	conn.Source = "10.0.0.1"
+	conn.Proto = "udp"
+
+	// recycled records are cleared before they are handed out again
+	pool.Put(conn)
+	for i := 0; i < 10; i++ {
+		require.Equal(t, &Conn{}, pool.Get())
+	}
+}
@@ -0,0 +1,60 @@
+package parsetypes
+
+import "sync"
+
+//BroDataPool recycles the BroData parsed from a log in order to cut down on the
+//allocations made while parsing billions of records.
+//
+//The lifecycle of a pooled BroData is as follows: Get hands out a zeroed BroData
+//which the parser fills in. Once the consumer of the record is done with it, the
+//consumer calls Put. Put must only be called when no references to the BroData
+//remain, since the BroData is cleared and handed out again by a later Get. Values
+//copied out of the BroData, such as strings and slices, remain valid.
+type BroDataPool struct {
+	pool sync.Pool
+}
+
+//NewBroDataPool creates a pool which allocates new BroData with the given factory
+//when no recycled BroData is available
+func NewBroDataPool(broDataFactory func() BroData) *BroDataPool {
+	return &BroDataPool{
+		pool: sync.Pool{
+			New: func() interface{} {
+				return broDataFactory()
+			},
+		},
+	}
+}
+
+//Get returns a zeroed BroData. Get may be used as the factory passed to the parser.
+func (p *BroDataPool) Get() BroData {
+	return p.pool.Get().(BroData)
+}
+
+//Put clears the BroData and returns it to the pool. The BroData must not be used
+//after it has been put back. BroData of unknown types are left to the garbage collector.
+func (p *BroDataPool) Put(dat BroData) {
+	switch typedDat := dat.(type) {
+	case *Conn:
+		*typedDat = Conn{}
+	case *DHCP:
+		*typedDat = DHCP{}
+	case *DNS:
+		*typedDat = DNS{}
+	case *EVE:
+		*typedDat = EVE{}
+	case *HTTP:
+		*typedDat = HTTP{}
+	case *NetFlow:
+		*typedDat = NetFlow{}
+	case *OpenConn:
+		*typedDat = OpenConn{}
+	case *SSL:
+		*typedDat = SSL{}
+	case *X509:
+		*typedDat = X509{}
+	default:
+		return
+	}
+	p.pool.Put(dat)
+}
@@ -72,6 +72,9 @@ type SSL struct {
 	Logged bool `bson:"logged" bro:"logged" brotype:"bool" json:"logged"`
 	// CertChainFuids
 	CertChainFuids []string `bson:"cert_chain_fuids" bro:"cert_chain_fuids" brotype:"vector[string]" json:"cert_chain_fuids"`
+	// CertChainFps holds the fingerprints of the server's certificate chain.
+	// Note: only present in Zeek 4.2 and newer.
+	CertChainFps []string `bson:"cert_chain_fps" bro:"cert_chain_fps" brotype:"vector[string]" json:"cert_chain_fps"`
 	// ClientCertChainFuids
 	ClientCertChainFuids []string `bson:"client_cert_chain_fuids"  bro:"client_cert_chain_fuids" brotype:"vector[string]" json:"client_cert_chain_fuids"`
 	// Subject
@@ -86,8 +89,10 @@ type SSL struct {
 	ValidationStatus string `bson:"validation_status"  bro:"validation_status" brotype:"string" json:"validation_status"`
 	// ValidationCode  : Numeric SSL/TLS version that the server chose
 	ValidationCode int `bson:"validation_code" bro:"validation_code" brotype:"int" json:"validation_code"`
-	// JA3 hash
+	// JA3 hash of the client's TLS fingerprint
 	JA3 string `bson:"ja3" bro:"ja3" brotype:"string" json:"ja3"`
+	// JA3S hash of the server's TLS fingerprint
+	JA3S string `bson:"ja3s" bro:"ja3s" brotype:"string" json:"ja3s"`
 	// AgentHostname names which sensor recorded this event. Only set when combining logs from multiple sensors.
 	AgentHostname string `bson:"agent_hostname" bro:"agent_hostname" brotype:"string" json:"agent_hostname"`
 	// AgentUUID identifies which sensor recorded this event. Only set when combining logs from multiple sensors.
@@ -103,3 +108,8 @@ func (line *SSL) TargetCollection(config *config.StructureTableCfg) string {
 func (line *SSL) ConvertFromJSON() {
 	line.TimeStamp = convertTimestamp(line.TimeStampGeneric)
 }
+
+//ConnUID returns the uid of the connection this entry was logged for
+func (line *SSL) ConnUID() string {
+	return line.UID
+}
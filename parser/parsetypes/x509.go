@@ -0,0 +1,84 @@
+package parsetypes
+
+import (
+	"github.com/activecm/rita/config"
+)
+
+// X509 provides a data structure for zeek's x509 certificate data
+type X509 struct {
+	// TimeStamp is when the certificate was seen
+	TimeStamp int64 `bson:"ts" bro:"ts" brotype:"time" json:"-"`
+	// TimeStampGeneric is used when reading from json files
+	TimeStampGeneric interface{} `bson:"-" json:"ts"`
+	// ID is the file id of the certificate (generated by Zeek). It matches the
+	// entries of cert_chain_fuids in the ssl log.
+	ID string `bson:"id" bro:"id" brotype:"string" json:"id"`
+	// Fingerprint is the hash of the DER encoded certificate. It is only logged by
+	// Zeek 4.2 and newer and matches the entries of cert_chain_fps in the ssl log.
+	Fingerprint string `bson:"fingerprint" bro:"fingerprint" brotype:"string" json:"fingerprint"`
+	// Version is the version number of the certificate
+	Version int `bson:"certificate_version" bro:"certificate.version" brotype:"count" json:"certificate.version"`
+	// Serial is the serial number of the certificate
+	Serial string `bson:"certificate_serial" bro:"certificate.serial" brotype:"string" json:"certificate.serial"`
+	// Subject is the subject of the certificate
+	Subject string `bson:"certificate_subject" bro:"certificate.subject" brotype:"string" json:"certificate.subject"`
+	// Issuer is the issuer of the certificate
+	Issuer string `bson:"certificate_issuer" bro:"certificate.issuer" brotype:"string" json:"certificate.issuer"`
+	// NotValidBefore is the time the certificate becomes valid
+	NotValidBefore int64 `bson:"certificate_not_valid_before" bro:"certificate.not_valid_before" brotype:"time" json:"-"`
+	// NotValidBeforeGeneric is used when reading from json files
+	NotValidBeforeGeneric interface{} `bson:"-" json:"certificate.not_valid_before"`
+	// NotValidAfter is the time the certificate expires
+	NotValidAfter int64 `bson:"certificate_not_valid_after" bro:"certificate.not_valid_after" brotype:"time" json:"-"`
+	// NotValidAfterGeneric is used when reading from json files
+	NotValidAfterGeneric interface{} `bson:"-" json:"certificate.not_valid_after"`
+	// KeyAlgorithm is the name of the key algorithm
+	KeyAlgorithm string `bson:"certificate_key_alg" bro:"certificate.key_alg" brotype:"string" json:"certificate.key_alg"`
+	// SignatureAlgorithm is the name of the signature algorithm
+	SignatureAlgorithm string `bson:"certificate_sig_alg" bro:"certificate.sig_alg" brotype:"string" json:"certificate.sig_alg"`
+	// KeyType is the type of key used in the certificate
+	KeyType string `bson:"certificate_key_type" bro:"certificate.key_type" brotype:"string" json:"certificate.key_type"`
+	// KeyLength is the length of the key in bits
+	KeyLength int `bson:"certificate_key_length" bro:"certificate.key_length" brotype:"count" json:"certificate.key_length"`
+	// SANDNS holds the DNS entries of the subject alternative name extension.
+	// Zeek logs the subject alternative names as vectors, which are split on the
+	// set separator the same as sets.
+	SANDNS []string `bson:"san_dns" bro:"san.dns" brotype:"vector[string]" json:"san.dns"`
+	// SANURI holds the URI entries of the subject alternative name extension
+	SANURI []string `bson:"san_uri" bro:"san.uri" brotype:"vector[string]" json:"san.uri"`
+	// SANEmail holds the email entries of the subject alternative name extension
+	SANEmail []string `bson:"san_email" bro:"san.email" brotype:"vector[string]" json:"san.email"`
+	// BasicConstraintsCA is set if the certificate is a CA certificate
+	BasicConstraintsCA bool `bson:"basic_constraints_ca" bro:"basic_constraints.ca" brotype:"bool" json:"basic_constraints.ca"`
+	// AgentHostname names which sensor recorded this event. Only set when combining logs from multiple sensors.
+	AgentHostname string `bson:"agent_hostname" bro:"agent_hostname" brotype:"string" json:"agent_hostname"`
+	// AgentUUID identifies which sensor recorded this event. Only set when combining logs from multiple sensors.
+	AgentUUID string `bson:"agent_uuid" bro:"agent_uuid" brotype:"string" json:"agent_uuid"`
+}
+
+//TargetCollection returns the mongo collection this entry should be inserted
+func (line *X509) TargetCollection(config *config.StructureTableCfg) string {
+	return config.X509Table
+}
+
+//ConvertFromJSON performs any extra conversions necessary when reading from JSON
+func (line *X509) ConvertFromJSON() {
+	line.TimeStamp = convertTimestamp(line.TimeStampGeneric)
+	line.NotValidBefore = convertTimestamp(line.NotValidBeforeGeneric)
+	line.NotValidAfter = convertTimestamp(line.NotValidAfterGeneric)
+}
+
+//FingerprintKey returns the key which joins the certificate to the ssl log entries
+//which presented it. Zeek 4.2 and newer log the certificate's hash in the x509
+//log's fingerprint field and in the ssl log's cert_chain_fps field. The hash
+//algorithm is set by X509::hash_function, which defaults to SHA256. Older versions
+//only relate the logs through the certificate's file id, which is logged as the
+//x509 log's id field and in the ssl log's cert_chain_fuids field. Since file ids
+//are unique to each transfer, the file id only joins the certificate to the
+//connection it was seen on.
+func (line *X509) FingerprintKey() string {
+	if line.Fingerprint != "" {
+		return line.Fingerprint
+	}
+	return line.ID
+}
@@ -3,6 +3,7 @@ package parser
 import (
 	"sync"
 
+	"github.com/activecm/rita/parser/parsetypes"
 	"github.com/activecm/rita/pkg/certificate"
 	"github.com/activecm/rita/pkg/host"
 	"github.com/activecm/rita/pkg/hostname"
@@ -29,6 +30,27 @@ type ParseResults struct {
 	CertificateLock     *sync.Mutex
 	ExplodedDNSMap      map[string]int
 	ExplodedDNSLock     *sync.Mutex
+	// X509Map holds the certificates seen in the x509 logs keyed by
+	// their fingerprints. See parsetypes.X509.FingerprintKey.
+	X509Map  map[string]*parsetypes.X509
+	X509Lock *sync.Mutex
+	// ProxyUIDMap and ConnDurationMap are only created when proxy beacon duration
+	// analysis is enabled. ProxyUIDMap maps the UIDs of proxied HTTP requests to their
+	// ProxyUniqueConnMap keys and is guarded by ProxyUniqueConnLock. ConnDurationMap
+	// maps connection UIDs to their durations.
+	ProxyUIDMap      map[string]string
+	ConnDurationMap  map[string]float64
+	ConnDurationLock *sync.Mutex
+	// ConnBytesMap maps connection UIDs to their byte counts. It is only created,
+	// along with ProxyUIDMap, when proxy beacon byte counts are enabled.
+	ConnBytesMap  map[string]ConnBytes
+	ConnBytesLock *sync.Mutex
+}
+
+// ConnBytes holds the bytes sent by each side of a connection
+type ConnBytes struct {
+	Orig int64
+	Resp int64
 }
 
 // newParseResults instantiates a ParseResults struct
@@ -48,5 +70,9 @@ func newParseResults() ParseResults {
 		CertificateLock:     new(sync.Mutex),
 		ExplodedDNSMap:      make(map[string]int),
 		ExplodedDNSLock:     new(sync.Mutex),
+		X509Map:             make(map[string]*parsetypes.X509),
+		X509Lock:            new(sync.Mutex),
+		ConnDurationLock:    new(sync.Mutex),
+		ConnBytesLock:       new(sync.Mutex),
 	}
 }
@@ -0,0 +1,327 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/activecm/rita/config"
+	"github.com/activecm/rita/metrics"
+	"github.com/activecm/rita/parser/files"
+	"github.com/activecm/rita/parser/parsetypes"
+	"github.com/activecm/rita/pkg/data"
+	"github.com/activecm/rita/util"
+	log "github.com/sirupsen/logrus"
+)
+
+//StreamListener accepts newline-delimited Zeek JSON logs pushed over TCP or TLS.
+//Each line is parsed into a record and handed to the aggregate callback as soon
+//as it is received.
+type StreamListener struct {
+	listener      net.Listener
+	factory       func() parsetypes.BroData
+	maxLineLength int
+	log           *log.Logger
+	aggregate     func(parsetypes.BroData)
+
+	mu     sync.Mutex
+	conns  map[net.Conn]struct{}
+	closed bool
+	wg     sync.WaitGroup
+}
+
+//NewStreamListener listens on the configured address for logs of the configured
+//type. TLS is used if a certificate or private key is configured, in which case
+//both must be set.
+func NewStreamListener(conf *config.ListenerStaticCfg, maxLineLength int, logger *log.Logger,
+	aggregate func(parsetypes.BroData)) (*StreamListener, error) {
+
+	factory := parsetypes.NewBroDataFactory(conf.LogType)
+	if factory == nil {
+		return nil, fmt.Errorf("log type %q is not supported", conf.LogType)
+	}
+
+	var listener net.Listener
+	var err error
+	if conf.CertFile != "" || conf.KeyFile != "" {
+		var cert tls.Certificate
+		cert, err = tls.LoadX509KeyPair(conf.CertFile, conf.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		listener, err = tls.Listen("tcp", conf.ListenAddress, &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		})
+	} else {
+		listener, err = net.Listen("tcp", conf.ListenAddress)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &StreamListener{
+		listener:      listener,
+		factory:       factory,
+		maxLineLength: maxLineLength,
+		log:           logger,
+		aggregate:     aggregate,
+		conns:         make(map[net.Conn]struct{}),
+	}, nil
+}
+
+//Addr returns the address the listener accepts connections on
+func (s *StreamListener) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+//Serve accepts connections until the listener is closed. Each connection is read
+//in its own goroutine.
+func (s *StreamListener) Serve() error {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return nil
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+
+		if !s.track(conn) {
+			conn.Close()
+			return nil
+		}
+		go s.handle(conn)
+	}
+}
+
+//Close stops accepting connections, disconnects the clients, and waits for the
+//lines already received to be aggregated
+func (s *StreamListener) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	err := s.listener.Close()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return err
+}
+
+//track records an open connection so it can be closed along with the listener.
+//Returns false if the listener is already closed.
+func (s *StreamListener) track(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	s.conns[conn] = struct{}{}
+	s.wg.Add(1)
+	return true
+}
+
+//handle reads the lines sent by a client until it disconnects. Lines may be split
+//across any number of TCP segments. A partial line left when the client disconnects
+//is dropped since the rest of the record will never arrive.
+func (s *StreamListener) handle(conn net.Conn) {
+	defer func() {
+		conn.Close()
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		s.wg.Done()
+	}()
+
+	logger := s.log.WithField("client", conn.RemoteAddr().String())
+	logger.Info("Accepted log stream")
+
+	var partial []byte
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 0, 64*1024), s.maxLineLength)
+	scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			return i + 1, bytes.TrimSuffix(data[:i], []byte{'\r'}), nil
+		}
+		if atEOF {
+			partial = data
+		}
+		return 0, nil, nil
+	})
+
+	var lines int64
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		lines++
+
+		entry, err := files.ParseJSONLine(line, s.factory, s.log)
+		if err != nil {
+			continue
+		}
+		s.aggregate(entry)
+	}
+
+	if err := scanner.Err(); err != nil {
+		logger.WithField("error", err.Error()).Error("Stopped reading log stream early")
+		metrics.ParseErrors.Inc()
+	} else if len(partial) > 0 {
+		logger.WithField("bytes", len(partial)).Warn("Dropping partial line left by disconnected client")
+		metrics.ParseErrors.Inc()
+	}
+	logger.WithField("lines", lines).Info("Log stream closed")
+}
+
+//Listen imports the logs pushed to the configured listener until ctx is done. The
+//records received are aggregated in memory and written to the database every flush
+//interval, as well as once more after the listener is closed.
+func (fs *FSImporter) Listen(ctx context.Context) error {
+	if !fs.prepareDatabase() {
+		return fmt.Errorf("could not prepare database %s", fs.database.GetSelectedDB())
+	}
+
+	stream := fs.newStreamImporter()
+	listener, err := NewStreamListener(&fs.config.S.Listener, fs.config.S.Parsing.MaxLineLength, fs.log,
+		stream.aggregate,
+	)
+	if err != nil {
+		return err
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- listener.Serve()
+	}()
+	fmt.Printf("\t[+] Listening for %s logs on %s\n", fs.config.S.Listener.LogType, listener.Addr())
+
+	ticker := time.NewTicker(flushInterval(fs.config.S.Listener.FlushInterval))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			fmt.Println("\t[-] Writing received logs to: " + fs.database.GetSelectedDB() + " ... ")
+			stream.flush(nil)
+		case err = <-serveErr:
+			listener.Close()
+			stream.flush(nil)
+			return err
+		case <-ctx.Done():
+			listener.Close()
+			fmt.Println("\t[-] Writing remaining logs to: " + fs.database.GetSelectedDB() + " ... ")
+			stream.flush(nil)
+			return <-serveErr
+		}
+	}
+}
+
+//streamImporter aggregates the records received from a stream of logs and
+//periodically writes them to the database. The results are swapped out while they
+//are written so that new records can be aggregated in the meantime.
+type streamImporter struct {
+	fs           *FSImporter
+	proxyTsUnits int64
+	proxySubnets *data.SubnetPrefixLengths
+
+	lock    sync.RWMutex
+	retVals ParseResults
+}
+
+//newStreamImporter creates a streamImporter for the importer's target database
+func (fs *FSImporter) newStreamImporter() *streamImporter {
+	s := &streamImporter{
+		fs: fs,
+		// proxied connection timestamps are recorded with the configured precision
+		proxyTsUnits: util.TimestampUnitsPerSecond(fs.config.S.BeaconProxy.TimestampPrecision),
+		retVals:      fs.newStreamResults(),
+	}
+
+	// aggregate the sources of proxied connections into subnets if enabled
+	if fs.config.S.BeaconProxy.SubnetAggregation.Enabled {
+		s.proxySubnets = &data.SubnetPrefixLengths{
+			IPv4: fs.config.S.BeaconProxy.SubnetAggregation.IPv4PrefixLength,
+			IPv6: fs.config.S.BeaconProxy.SubnetAggregation.IPv6PrefixLength,
+		}
+	}
+	return s
+}
+
+//aggregate aggregates a parsed record into the results awaiting the next flush.
+//Records outside of the time window are dropped. Safe for concurrent use.
+func (s *streamImporter) aggregate(entry parsetypes.BroData) {
+	fs := s.fs
+	metrics.LinesParsed.WithLabelValues(entry.TargetCollection(&fs.config.T.Structure)).Inc()
+	if converter, ok := entry.(parsetypes.RecordConverter); ok {
+		entry = converter.Record()
+		if entry == nil {
+			return
+		}
+	}
+	if fs.hasTimeWindow() {
+		if ts, ok := entryTimestamp(entry); ok && fs.filterTimestamp(ts) {
+			return
+		}
+	}
+
+	s.lock.RLock()
+	fs.aggregateEntry(entry, s.proxyTsUnits, s.proxySubnets, s.retVals)
+	s.lock.RUnlock()
+}
+
+//flush writes the records aggregated so far to the database. If swapped is set, it
+//is called as the results are swapped out, while no records are being aggregated.
+func (s *streamImporter) flush(swapped func()) {
+	fs := s.fs
+
+	s.lock.Lock()
+	flushed := s.retVals
+	s.retVals = fs.newStreamResults()
+	if swapped != nil {
+		swapped()
+	}
+	s.lock.Unlock()
+
+	matchProxyDurations(flushed)
+	matchProxyBytes(flushed)
+	fs.metaDB.SetChunk(fs.config.S.Rolling.CurrentChunk, fs.database.GetSelectedDB(), true)
+	fs.buildAnalysis(fs.traceContext(), flushed)
+	fs.metaDB.MarkDBAnalyzed(fs.database.GetSelectedDB(), true)
+}
+
+//flushInterval converts a configured flush interval in seconds into a duration of
+//at least a second
+func flushInterval(seconds int) time.Duration {
+	return time.Duration(util.Max(seconds, 1)) * time.Second
+}
+
+//newStreamResults creates the results the records received from a stream are aggregated into
+func (fs *FSImporter) newStreamResults() ParseResults {
+	retVals := newParseResults()
+	// track the connection durations and byte counts of proxied requests if they are used
+	if fs.config.S.BeaconProxy.DurationEnabled || fs.config.S.BeaconProxy.BytesEnabled {
+		retVals.ProxyUIDMap = make(map[string]string)
+	}
+	if fs.config.S.BeaconProxy.DurationEnabled {
+		retVals.ConnDurationMap = make(map[string]float64)
+	}
+	if fs.config.S.BeaconProxy.BytesEnabled {
+		retVals.ConnBytesMap = make(map[string]ConnBytes)
+	}
+	return retVals
+}
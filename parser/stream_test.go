@@ -0,0 +1,120 @@
+package parser
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/activecm/rita/config"
+	"github.com/activecm/rita/parser/parsetypes"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+//testStreamConns holds Zeek JSON conn log records sent over the stream
+var testStreamConns = []string{
+	`{"ts":1517336042.090,"uid":"CW7Bl13YdrhYbvlV3","id.orig_h":"10.0.0.1","id.orig_p":53542,"id.resp_h":"93.184.216.34","id.resp_p":443,"proto":"tcp","orig_ip_bytes":120}`,
+	`{"ts":1517336102.090,"uid":"CnmUhu3Nxy6U4uzEi5","id.orig_h":"10.0.0.1","id.orig_p":53543,"id.resp_h":"93.184.216.34","id.resp_p":443,"proto":"tcp","orig_ip_bytes":180}`,
+	`{"ts":1517336162.090,"uid":"CmVKaB2ZOuqLyvJEYl","id.orig_h":"10.0.0.2","id.orig_p":53544,"id.resp_h":"93.184.216.34","id.resp_p":443,"proto":"tcp","orig_ip_bytes":240}`,
+}
+
+//streamCollector collects the records aggregated by a StreamListener
+type streamCollector struct {
+	mu    sync.Mutex
+	conns []*parsetypes.Conn
+}
+
+func (c *streamCollector) aggregate(entry parsetypes.BroData) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.conns = append(c.conns, entry.(*parsetypes.Conn))
+}
+
+//wait waits for n records to be aggregated
+func (c *streamCollector) wait(t *testing.T, n int) []*parsetypes.Conn {
+	require.Eventually(t, func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return len(c.conns) >= n
+	}, 5*time.Second, 10*time.Millisecond)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conns
+}
+
+func newTestStreamListener(t *testing.T, collector *streamCollector) *StreamListener {
+	listener, err := NewStreamListener(&config.ListenerStaticCfg{
+		ListenAddress: "127.0.0.1:0",
+		LogType:       "conn",
+	}, 1024*1024, log.New(), collector.aggregate)
+	require.Nil(t, err)
+
+	go listener.Serve()
+	return listener
+}
+
+func TestStreamListener(t *testing.T) {
+	collector := &streamCollector{}
+	listener := newTestStreamListener(t, collector)
+	defer listener.Close()
+
+	client, err := net.Dial("tcp", listener.Addr().String())
+	require.Nil(t, err)
+
+	// the first record is split across writes and the records are sent in between
+	first := testStreamConns[0]
+	_, err = client.Write([]byte(first[:40]))
+	require.Nil(t, err)
+	time.Sleep(10 * time.Millisecond)
+	_, err = client.Write([]byte(first[40:] + "\n" + testStreamConns[1] + "\r\n\n"))
+	require.Nil(t, err)
+	require.Nil(t, client.Close())
+
+	conns := collector.wait(t, 2)
+	require.Len(t, conns, 2)
+	require.Equal(t, "CW7Bl13YdrhYbvlV3", conns[0].UID)
+	require.Equal(t, int64(1517336042), conns[0].TimeStamp)
+	require.Equal(t, "93.184.216.34", conns[0].Destination)
+	require.Equal(t, int64(120), conns[0].OrigIPBytes)
+	require.Equal(t, "CnmUhu3Nxy6U4uzEi5", conns[1].UID)
+
+	// clients may reconnect after disconnecting
+	client, err = net.Dial("tcp", listener.Addr().String())
+	require.Nil(t, err)
+	_, err = client.Write([]byte(testStreamConns[2] + "\n"))
+	require.Nil(t, err)
+	require.Nil(t, client.Close())
+
+	conns = collector.wait(t, 3)
+	require.Equal(t, "10.0.0.2", conns[2].Source)
+}
+
+func TestStreamListenerPartialLine(t *testing.T) {
+	collector := &streamCollector{}
+	listener := newTestStreamListener(t, collector)
+
+	client, err := net.Dial("tcp", listener.Addr().String())
+	require.Nil(t, err)
+
+	// the client disconnects partway through the second record
+	second := testStreamConns[1]
+	_, err = client.Write([]byte(testStreamConns[0] + "\n" + second[:len(second)/2]))
+	require.Nil(t, err)
+	require.Nil(t, client.Close())
+
+	collector.wait(t, 1)
+
+	// closing the listener waits for the stream to be read
+	require.Nil(t, listener.Close())
+	require.Len(t, collector.conns, 1)
+}
+
+func TestStreamListenerUnsupportedLogType(t *testing.T) {
+	_, err := NewStreamListener(&config.ListenerStaticCfg{
+		ListenAddress: "127.0.0.1:0",
+		LogType:       "weird",
+	}, 1024*1024, log.New(), func(parsetypes.BroData) {})
+	require.NotNil(t, err)
+}
@@ -0,0 +1,120 @@
+package parser
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/activecm/rita/config"
+	"github.com/activecm/rita/database"
+	"github.com/activecm/rita/tracing"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+//recordSpans records the spans created by the test in memory instead of exporting them
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(trace.NewNoopTracerProvider()) })
+	return recorder
+}
+
+//spanAttributes maps the attributes of a span by their keys
+func spanAttributes(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, attr := range span.Attributes() {
+		attrs[attr.Key] = attr.Value
+	}
+	return attrs
+}
+
+func TestImportSpans(t *testing.T) {
+	recorder := recordSpans(t)
+
+	dir, err := ioutil.TempDir("", "tracing")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	clean := writeTestConnLog(t, dir, "conn.clean.log", 100, 0)
+	corrupt := writeTestConnLog(t, dir, "conn.corrupt.log", 1000, 2)
+
+	conf, err := config.LoadTestingConfig("")
+	require.Nil(t, err)
+	conf.S.Parsing = config.ParsingStaticCfg{MaxLineLength: 1 << 20, AbortOnErrors: true, MaxErrorRate: 0.1}
+
+	logger := log.New()
+	logger.SetLevel(log.FatalLevel)
+	fs := &FSImporter{
+		filter:   newFilter(conf),
+		log:      logger,
+		config:   conf,
+		database: &database.DB{},
+	}
+
+	// the spans of the import are children of the run's span
+	runCtx, runSpan := tracing.Start(context.Background(), "import")
+	fs.SetTraceContext(runCtx)
+
+	indexedFiles := fs.CollectFileDetails([]string{dir}, 1, false)
+	require.Len(t, indexedFiles, 2)
+	fs.parseFiles(fs.traceContext(), indexedFiles, 1, logger)
+	runSpan.End()
+
+	spans := make(map[string][]sdktrace.ReadOnlySpan)
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = append(spans[span.Name()], span)
+		require.Equal(t, runSpan.SpanContext().TraceID(), span.SpanContext().TraceID(), span.Name())
+	}
+
+	require.Len(t, spans["GatherLogFiles"], 1)
+	gather := spans["GatherLogFiles"][0]
+	require.Equal(t, runSpan.SpanContext().SpanID(), gather.Parent().SpanID())
+	require.Equal(t, int64(1), spanAttributes(gather)["rita.paths"].AsInt64())
+	require.Equal(t, int64(2), spanAttributes(gather)["rita.files"].AsInt64())
+
+	require.Len(t, spans["parseFiles"], 1)
+	parse := spans["parseFiles"][0]
+	require.Equal(t, runSpan.SpanContext().SpanID(), parse.Parent().SpanID())
+
+	// each file is parsed under its own span
+	require.Len(t, spans["parseFile"], 2)
+	files := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range spans["parseFile"] {
+		require.Equal(t, parse.SpanContext().SpanID(), span.Parent().SpanID())
+		files[spanAttributes(span)["file.path"].AsString()] = span
+	}
+
+	// the header lines are counted along with the records
+	require.Contains(t, files, clean)
+	require.Equal(t, int64(107), spanAttributes(files[clean])["rita.lines"].AsInt64())
+	require.Equal(t, "conn", spanAttributes(files[clean])["rita.log_type"].AsString())
+	require.Equal(t, codes.Unset, files[clean].Status().Code)
+
+	// aborted files are marked as failed
+	require.Contains(t, files, corrupt)
+	require.Equal(t, codes.Error, files[corrupt].Status().Code)
+}
+
+func TestImportSpansDisabled(t *testing.T) {
+	// the spans aren't recorded unless tracing is enabled
+	otel.SetTracerProvider(trace.NewNoopTracerProvider())
+
+	ctx, span := tracing.Start(context.Background(), "import")
+	defer span.End()
+	require.False(t, span.IsRecording())
+	require.False(t, span.SpanContext().IsValid())
+
+	fs := &FSImporter{}
+	fs.SetTraceContext(ctx)
+	_, child := tracing.Start(fs.traceContext(), "parseFiles")
+	require.False(t, child.IsRecording())
+	child.End()
+}
@@ -0,0 +1,172 @@
+package parser
+
+import (
+	"hash/fnv"
+	"sort"
+	"sync"
+
+	"github.com/activecm/rita/parser/files"
+)
+
+//watermarkFilter tracks the newest record ingested from each log type. When appending,
+//it also drops the records ingested by earlier imports. Records logged within the overlap
+//window before a watermark are only dropped if the same line was ingested before, which
+//allows for sensors whose clocks lag behind the others.
+type watermarkFilter struct {
+	database  string
+	overlap   int64
+	appending bool
+
+	// the watermarks recorded by earlier imports, which are left as is while parsing
+	previous     map[string]files.Watermark
+	previousKeys map[string]map[int64]struct{}
+
+	lock    *sync.Mutex
+	current map[string]*watermarkTracker
+}
+
+//newWatermarkFilter creates a watermarkFilter which advances the watermarks recorded by
+//earlier imports. If appending is set, the records behind these watermarks are dropped.
+func newWatermarkFilter(database string, previous map[string]files.Watermark, overlap int64, appending bool) *watermarkFilter {
+	previousKeys := make(map[string]map[int64]struct{}, len(previous))
+	for logType, watermark := range previous {
+		keys := make(map[int64]struct{}, len(watermark.Keys))
+		for _, key := range watermark.Keys {
+			keys[key.Hash] = struct{}{}
+		}
+		previousKeys[logType] = keys
+	}
+
+	return &watermarkFilter{
+		database:     database,
+		overlap:      overlap,
+		appending:    appending,
+		previous:     previous,
+		previousKeys: previousKeys,
+		lock:         new(sync.Mutex),
+		current:      make(map[string]*watermarkTracker),
+	}
+}
+
+//lineKey hashes a line so it can be recognized by later imports
+func lineKey(line []byte) int64 {
+	hash := fnv.New64a()
+	hash.Write(line)
+	return int64(hash.Sum64())
+}
+
+//accept returns false if the record of the log type logged at ts, with the line hashed
+//into key, was ingested by an earlier import. Every record is accepted unless appending.
+func (w *watermarkFilter) accept(logType string, ts int64, key int64) bool {
+	if !w.appending {
+		return true
+	}
+	previous, ok := w.previous[logType]
+	if !ok || ts > previous.Ts {
+		return true
+	}
+	if ts < previous.Ts-w.overlap {
+		return false
+	}
+	_, ingested := w.previousKeys[logType][key]
+	return !ingested
+}
+
+//newTracker creates a tracker for the records of a single file so the files may be
+//parsed in parallel without contention
+func (w *watermarkFilter) newTracker() *watermarkTracker {
+	return &watermarkTracker{overlap: w.overlap, ts: minTimestamp, keys: make(map[int64]int64)}
+}
+
+//record merges the records tracked while parsing a file of the log type
+func (w *watermarkFilter) record(logType string, tracker *watermarkTracker) {
+	if len(tracker.keys) == 0 {
+		return
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	current, ok := w.current[logType]
+	if !ok {
+		w.current[logType] = tracker
+		return
+	}
+	for key, ts := range tracker.keys {
+		current.add(ts, key)
+	}
+}
+
+//watermarks returns the watermarks advanced past the records tracked so far. Only the
+//keys of the records within the overlap window of each watermark are kept.
+func (w *watermarkFilter) watermarks() []files.Watermark {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	var toReturn []files.Watermark
+	for logType, tracker := range w.current {
+		merged := w.newTracker()
+		if previous, ok := w.previous[logType]; ok {
+			for _, key := range previous.Keys {
+				merged.add(key.Ts, key.Hash)
+			}
+		}
+		for key, ts := range tracker.keys {
+			merged.add(ts, key)
+		}
+		merged.prune()
+
+		watermark := files.Watermark{Database: w.database, LogType: logType, Ts: merged.ts}
+		for key, ts := range merged.keys {
+			watermark.Keys = append(watermark.Keys, files.WatermarkKey{Hash: key, Ts: ts})
+		}
+		sort.Slice(watermark.Keys, func(i, j int) bool {
+			if watermark.Keys[i].Ts != watermark.Keys[j].Ts {
+				return watermark.Keys[i].Ts < watermark.Keys[j].Ts
+			}
+			return watermark.Keys[i].Hash < watermark.Keys[j].Hash
+		})
+		toReturn = append(toReturn, watermark)
+	}
+
+	sort.Slice(toReturn, func(i, j int) bool { return toReturn[i].LogType < toReturn[j].LogType })
+	return toReturn
+}
+
+//minTimestamp is below the timestamp of any record
+const minTimestamp = -1 << 63
+
+//watermarkTracker tracks the newest record of a log type along with the hashes of the
+//lines of the records within the overlap window before it
+type watermarkTracker struct {
+	overlap int64
+	ts      int64
+	keys    map[int64]int64 // the timestamps of the records keyed by the hashes of their lines
+	pruned  int             // the number of keys left by the last prune
+}
+
+//add tracks a record logged at ts whose line hashed into key
+func (t *watermarkTracker) add(ts int64, key int64) {
+	if ts > t.ts {
+		t.ts = ts
+	}
+	if ts < t.ts-t.overlap {
+		return
+	}
+	t.keys[key] = ts
+
+	// the keys which fell out of the overlap window are dropped once in a while
+	if len(t.keys) > 2*t.pruned+1024 {
+		t.prune()
+	}
+}
+
+//prune drops the keys of the records which are no longer within the overlap window
+func (t *watermarkTracker) prune() {
+	for key, ts := range t.keys {
+		if ts < t.ts-t.overlap {
+			delete(t.keys, key)
+		}
+	}
+	t.pruned = len(t.keys)
+}
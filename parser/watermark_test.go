@@ -0,0 +1,108 @@
+package parser
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/activecm/rita/parser/files"
+	"github.com/stretchr/testify/require"
+)
+
+//testWatermarkLine creates a conn log line for a record logged at ts
+func testWatermarkLine(ts int64, uid string) []byte {
+	return []byte(strconv.FormatInt(ts, 10) + ".000000\t" + uid + "\t10.0.0.1\t53542\t93.184.216.34\t443")
+}
+
+//ingestWatermarkLines tracks the lines accepted by the filter as if they were parsed from
+//a single file and returns the timestamps of the accepted lines
+func ingestWatermarkLines(filter *watermarkFilter, logType string, timestamps []int64, uids []string) []int64 {
+	var accepted []int64
+	tracker := filter.newTracker()
+	for i, ts := range timestamps {
+		key := lineKey(testWatermarkLine(ts, uids[i]))
+		if !filter.accept(logType, ts, key) {
+			continue
+		}
+		tracker.add(ts, key)
+		accepted = append(accepted, ts)
+	}
+	filter.record(logType, tracker)
+	return accepted
+}
+
+func TestWatermarkAdvance(t *testing.T) {
+	filter := newWatermarkFilter("test", nil, 60, false)
+
+	// the records of a log type may be split over several files parsed in any order
+	ingestWatermarkLines(filter, "conn", []int64{1000, 1100, 1150}, []string{"C1", "C2", "C3"})
+	ingestWatermarkLines(filter, "conn", []int64{900, 1200, 1050}, []string{"C4", "C5", "C6"})
+	ingestWatermarkLines(filter, "dns", []int64{500}, []string{"D1"})
+
+	watermarks := filter.watermarks()
+	require.Len(t, watermarks, 2)
+
+	// only the records within the overlap window of the newest record are kept
+	conn := watermarks[0]
+	require.Equal(t, "conn", conn.LogType)
+	require.Equal(t, "test", conn.Database)
+	require.Equal(t, int64(1200), conn.Ts)
+	require.ElementsMatch(t, []files.WatermarkKey{
+		{Hash: lineKey(testWatermarkLine(1150, "C3")), Ts: 1150},
+		{Hash: lineKey(testWatermarkLine(1200, "C5")), Ts: 1200},
+	}, conn.Keys)
+
+	require.Equal(t, "dns", watermarks[1].LogType)
+	require.Equal(t, int64(500), watermarks[1].Ts)
+
+	// a later import advances the watermarks it was given
+	previous := map[string]files.Watermark{"conn": conn, "dns": watermarks[1]}
+	filter = newWatermarkFilter("test", previous, 60, false)
+	ingestWatermarkLines(filter, "conn", []int64{1230}, []string{"C7"})
+	watermarks = filter.watermarks()
+	require.Len(t, watermarks, 1)
+	require.Equal(t, int64(1230), watermarks[0].Ts)
+	// the key at 1150 fell out of the overlap window
+	require.Len(t, watermarks[0].Keys, 2)
+
+	// the watermark doesn't move back if older records are imported without appending
+	filter = newWatermarkFilter("test", previous, 60, false)
+	require.Equal(t, []int64{100}, ingestWatermarkLines(filter, "conn", []int64{100}, []string{"C0"}))
+	require.Equal(t, int64(1200), filter.watermarks()[0].Ts)
+}
+
+func TestWatermarkOverlapDedup(t *testing.T) {
+	filter := newWatermarkFilter("test", nil, 60, false)
+	ingestWatermarkLines(filter, "conn", []int64{1000, 1150, 1200}, []string{"C1", "C2", "C3"})
+	previous := map[string]files.Watermark{"conn": filter.watermarks()[0]}
+
+	filter = newWatermarkFilter("test", previous, 60, true)
+	accepted := ingestWatermarkLines(filter, "conn",
+		[]int64{1000, 1100, 1150, 1150, 1200, 1210},
+		[]string{"C1", "C8", "C2", "C9", "C3", "C10"},
+	)
+	// the records older than the overlap window are dropped, while those within it are
+	// only dropped if they were ingested before
+	require.Equal(t, []int64{1150, 1210}, accepted)
+
+	watermarks := filter.watermarks()
+	require.Equal(t, int64(1210), watermarks[0].Ts)
+	require.ElementsMatch(t, []files.WatermarkKey{
+		{Hash: lineKey(testWatermarkLine(1150, "C2")), Ts: 1150},
+		{Hash: lineKey(testWatermarkLine(1150, "C9")), Ts: 1150},
+		{Hash: lineKey(testWatermarkLine(1200, "C3")), Ts: 1200},
+		{Hash: lineKey(testWatermarkLine(1210, "C10")), Ts: 1210},
+	}, watermarks[0].Keys)
+
+	// the records of other log types are unaffected
+	require.Equal(t, []int64{1000}, ingestWatermarkLines(filter, "dns", []int64{1000}, []string{"D1"}))
+}
+
+func TestWatermarkTrackerPrune(t *testing.T) {
+	tracker := newWatermarkFilter("test", nil, 10, false).newTracker()
+	for ts := int64(0); ts < 5000; ts++ {
+		tracker.add(ts, ts)
+	}
+	tracker.prune()
+	require.Equal(t, int64(4999), tracker.ts)
+	require.Len(t, tracker.keys, 11)
+}
@@ -0,0 +1,22 @@
+package parser
+
+import (
+	"github.com/activecm/rita/parser/parsetypes"
+)
+
+//parseX509Entry records a certificate so it may be correlated with the ssl
+//connections which presented it. Certificates are usually logged once per
+//connection, so only the first record of each certificate is kept.
+func parseX509Entry(parseX509 *parsetypes.X509, retVals ParseResults) {
+	key := parseX509.FingerprintKey()
+	if key == "" {
+		return
+	}
+
+	retVals.X509Lock.Lock()
+	defer retVals.X509Lock.Unlock()
+
+	if _, ok := retVals.X509Map[key]; !ok {
+		retVals.X509Map[key] = parseX509
+	}
+}
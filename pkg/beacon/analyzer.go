@@ -1,28 +1,39 @@
 package beacon
 
 import (
+	"context"
 	"math"
 	"sort"
 	"strconv"
 	"sync"
+	"time"
 
 	"github.com/activecm/rita/config"
 	"github.com/activecm/rita/database"
 	"github.com/activecm/rita/pkg/data"
 	"github.com/activecm/rita/pkg/uconn"
+	"github.com/activecm/rita/tracing"
 	"github.com/activecm/rita/util"
 
+	"github.com/globalsign/mgo"
 	"github.com/globalsign/mgo/bson"
 	log "github.com/sirupsen/logrus"
 )
 
+//hostQueryBackoff is the wait before retrying a hosts table lookup which failed with a
+//transient error. The wait doubles after every further failed attempt.
+const hostQueryBackoff = 100 * time.Millisecond
+
 type (
 	analyzer struct {
+		ctx              context.Context   // stops the analysis once cancelled, holds the span the analysis is traced under
 		tsMin            int64             // min timestamp for the whole dataset
 		tsMax            int64             // max timestamp for the whole dataset
+		tsConnDiv        float64           // the connection count which earns the max connection count score
 		chunk            int               //current chunk (0 if not on rolling analysis)
 		chunkStr         string            //current chunk (0 if not on rolling analysis)
 		db               *database.DB      // provides access to MongoDB
+		retrier          *database.Retrier // retries the hosts table lookups which fail with transient errors
 		conf             *config.Config    // contains details needed to access MongoDB
 		log              *log.Logger       // main logger for RITA
 		analyzedCallback func(*update)     // called on each analyzed result
@@ -32,15 +43,19 @@ type (
 	}
 )
 
-//newAnalyzer creates a new collector for gathering data
-func newAnalyzer(min int64, max int64, chunk int, db *database.DB, conf *config.Config, log *log.Logger,
+//newAnalyzer creates a new collector for gathering data. Once ctx is cancelled, the
+//analysis threads exit without analyzing the remaining data.
+func newAnalyzer(ctx context.Context, min int64, max int64, chunk int, db *database.DB, conf *config.Config, log *log.Logger,
 	analyzedCallback func(*update), closedCallback func()) *analyzer {
 	return &analyzer{
+		ctx:              ctx,
 		tsMin:            min,
 		tsMax:            max,
+		tsConnDiv:        (float64(max) - float64(min)) / 10.0,
 		chunk:            chunk,
 		chunkStr:         strconv.Itoa(chunk),
 		db:               db,
+		retrier:          database.NewRetrier(conf.S.Beacon.HostQueryMaxAttempts, hostQueryBackoff),
 		conf:             conf,
 		log:              log,
 		analyzedCallback: analyzedCallback,
@@ -49,24 +64,46 @@ func newAnalyzer(min int64, max int64, chunk int, db *database.DB, conf *config.
 	}
 }
 
-//collect sends a chunk of data to be analyzed
+//collect sends a chunk of data to be analyzed. The data is dropped if the analysis
+//has been cancelled.
 func (a *analyzer) collect(data *uconn.Input) {
-	a.analysisChannel <- data
+	select {
+	case a.analysisChannel <- data:
+	case <-a.ctx.Done():
+	}
+}
+
+//next waits for the next chunk of data to analyze. Returns false once the
+//collector is closed or the analysis has been cancelled.
+func (a *analyzer) next() (*uconn.Input, bool) {
+	if a.ctx.Err() != nil {
+		return nil, false
+	}
+
+	select {
+	case data, ok := <-a.analysisChannel:
+		return data, ok
+	case <-a.ctx.Done():
+		return nil, false
+	}
 }
 
-//close waits for the collector to finish
+//close waits for the collector to finish. If the analysis has been cancelled, the
+//analysis threads only finish the chunk they are working on.
 func (a *analyzer) close() {
 	close(a.analysisChannel)
 	a.analysisWg.Wait()
 	a.closedCallback()
 }
 
-//start kicks off a new analysis thread
+//start kicks off a new analysis thread. The thread reads the hosts table through
+//its own copy of the database session, which is closed once the thread exits.
 func (a *analyzer) start() {
 	a.analysisWg.Add(1)
 	go func() {
+		ssn := a.db.Session.Copy()
 
-		for res := range a.analysisChannel {
+		for res, ok := a.next(); ok; res, ok = a.next() {
 
 			output := &update{}
 
@@ -88,6 +125,16 @@ func (a *analyzer) start() {
 				// set to writer channel
 				a.analyzedCallback(output)
 
+			} else if len(res.TsList) < minUniqueTimestamps {
+
+				// the dissector only passes along beacons with enough unique timestamps
+				// to score, but the delta time statistics can't be computed without them
+				a.log.WithFields(log.Fields{
+					"src":        res.Hosts.SrcIP,
+					"dst":        res.Hosts.DstIP,
+					"timestamps": len(res.TsList),
+				}).Debug("Skipping beacon with too few unique timestamps to score")
+
 			} else {
 
 				//store the diff slice length since we use it a lot
@@ -96,7 +143,8 @@ func (a *analyzer) start() {
 				tsLength := len(res.TsList) - 1
 				dsLength := len(res.OrigBytesList)
 
-				//find the delta times between the timestamps
+				//find the delta times between the timestamps. The timestamps are
+				//sorted and unique, and the parser drops the ones which failed to parse.
 				diff := make([]int64, tsLength)
 				for i := 0; i < tsLength; i++ {
 					diff[i] = res.TsList[i+1] - res.TsList[i]
@@ -186,11 +234,7 @@ func (a *analyzer) start() {
 				}
 
 				// connection count scoring
-				tsConnDiv := (float64(a.tsMax) - float64(a.tsMin)) / 10.0
-				tsConnCountScore := float64(res.ConnectionCount) / tsConnDiv
-				if tsConnCountScore > 1.0 {
-					tsConnCountScore = 1.0
-				}
+				tsConnCountScore := a.connCountScore(res.ConnectionCount)
 
 				//score numerators
 				tsSum := tsSkewScore + tsMadmScore + tsConnCountScore
@@ -200,6 +244,7 @@ func (a *analyzer) start() {
 				tsScore := math.Ceil((tsSum/3.0)*1000) / 1000
 				dsScore := math.Ceil((dsSum/3.0)*1000) / 1000
 				score := math.Ceil(((tsSum+dsSum)/6.0)*1000) / 1000
+				bands := a.conf.S.ScoreBands
 
 				// update beacon query
 				output.beacon = updateInfo{
@@ -226,6 +271,7 @@ func (a *analyzer) start() {
 							"ds.skew":            dsSkew,
 							"ds.score":           dsScore,
 							"score":              score,
+							"score_band":         util.ScoreBand(score, bands.Medium, bands.High, bands.Critical),
 							"cid":                a.chunk,
 							"src_network_name":   res.Hosts.SrcNetworkName,
 							"dst_network_name":   res.Hosts.DstNetworkName,
@@ -235,8 +281,18 @@ func (a *analyzer) start() {
 					selector: res.Hosts.BSONKey(),
 				}
 
-				output.hostIcert = a.hostIcertQuery(res.InvalidCertFlag, res.Hosts.UniqueSrcIP.Unpair(), res.Hosts.UniqueDstIP.Unpair())
-				output.hostBeacon = a.hostBeaconQuery(score, res.Hosts.UniqueSrcIP.Unpair(), res.Hosts.UniqueDstIP.Unpair())
+				// the hosts table lookups are skipped once the analysis is cancelled
+				if a.ctx.Err() != nil {
+					break
+				}
+				output.hostIcert = a.hostIcertQuery(ssn, res.InvalidCertFlag, res.Hosts.UniqueSrcIP.Unpair(), res.Hosts.UniqueDstIP.Unpair())
+				output.hostBeacon = a.hostBeaconQuery(ssn, score, res.Hosts.UniqueSrcIP.Unpair(), res.Hosts.UniqueDstIP.Unpair())
+
+				// the beacon and its hosts table updates are written together or not at all,
+				// so a result whose lookups were cut short by a cancellation is dropped
+				if a.ctx.Err() != nil {
+					break
+				}
 
 				// set to writer channel
 				a.analyzedCallback(output)
@@ -244,24 +300,48 @@ func (a *analyzer) start() {
 			}
 
 		}
+		ssn.Close()
 		a.analysisWg.Done()
 	}()
 }
 
+//connCountScore scores how many connections were made relative to the span of the dataset.
+//A dataset spanning a single instant leaves no room to compare against, so any connections
+//made in it receive the max score.
+func (a *analyzer) connCountScore(connCount int64) float64 {
+	if a.tsConnDiv <= 0 {
+		return 1.0
+	}
+
+	score := float64(connCount) / a.tsConnDiv
+	if score > 1.0 {
+		score = 1.0
+	}
+	return score
+}
+
+//minUniqueTimestamps is the fewest unique timestamps a beacon needs in order to be scored
+const minUniqueTimestamps = 4
+
+//distinctRatio is the expected number of delta times per distinct delta time, which
+//is used to presize the results of countAndRemoveConsecutiveDuplicates
+const distinctRatio = 16
+
 // createCountMap returns a distinct data array, data count array, the mode,
 // and the number of times the mode occurred
 func createCountMap(sortedIn []int64) ([]int64, []int64, int64, int64) {
 	//Since the data is already sorted, we can call this without fear
-	distinct, countsMap := countAndRemoveConsecutiveDuplicates(sortedIn)
-	countsArr := make([]int64, len(distinct))
+	distinct, countsArr := countAndRemoveConsecutiveDuplicates(sortedIn)
+	//there is no mode without any data
+	if len(distinct) == 0 {
+		return nil, nil, 0, 0
+	}
 	mode := distinct[0]
-	max := countsMap[mode]
-	for i, datum := range distinct {
-		count := countsMap[datum]
-		countsArr[i] = count
+	max := countsArr[0]
+	for i, count := range countsArr {
 		if count > max {
 			max = count
-			mode = datum
+			mode = distinct[i]
 		}
 	}
 	return distinct, countsArr, mode, max
@@ -269,32 +349,117 @@ func createCountMap(sortedIn []int64) ([]int64, []int64, int64, int64) {
 
 //countAndRemoveConsecutiveDuplicates removes consecutive
 //duplicates in an array of integers and counts how many
-//instances of each number exist in the array.
+//instances of each number exist in the array. The counts
+//are aligned with the returned numbers.
 //Similar to `uniq -c`, but counts all duplicates, not just
-//consecutive duplicates.
-func countAndRemoveConsecutiveDuplicates(numberList []int64) ([]int64, map[int64]int64) {
-	//Avoid some reallocations
-	result := make([]int64, 0, len(numberList)/2)
-	counts := make(map[int64]int64)
+//consecutive duplicates. Returns nil slices if numberList is empty.
+func countAndRemoveConsecutiveDuplicates(numberList []int64) ([]int64, []int64) {
+	if len(numberList) == 0 {
+		return nil, nil
+	}
+
+	//Avoid some reallocations. Beacons tend to repeat a small
+	//number of intervals, so far fewer numbers than the input
+	//are expected to remain.
+	distinctEstimate := len(numberList)/distinctRatio + 1
+	result := make([]int64, 0, distinctEstimate)
+	counts := make([]int64, 0, distinctEstimate)
 
 	last := numberList[0]
 	result = append(result, last)
-	counts[last]++
+	counts = append(counts, 1)
 
+	//the length of each run is the total count of its number
+	//as long as the numbers are sorted
+	sorted := true
 	for idx := 1; idx < len(numberList); idx++ {
 		if last != numberList[idx] {
+			if numberList[idx] < last {
+				sorted = false
+			}
 			result = append(result, numberList[idx])
+			counts = append(counts, 0)
 		}
 		last = numberList[idx]
-		counts[last]++
+		counts[len(counts)-1]++
+	}
+
+	if !sorted {
+		totalRunCounts(result, counts)
 	}
 	return result, counts
 }
 
-func (a *analyzer) hostIcertQuery(icert bool, src data.UniqueIP, dst data.UniqueIP) updateInfo {
-	ssn := a.db.Session.Copy()
-	defer ssn.Close()
+//totalRunCounts replaces the length of each run with the total
+//count of its number across all of the runs
+func totalRunCounts(numbers []int64, counts []int64) {
+	//there are at most as many distinct numbers as runs
+	totals := make(map[int64]int64, len(numbers))
+	for i, number := range numbers {
+		totals[number] += counts[i]
+	}
+	for i, number := range numbers {
+		counts[i] = totals[number]
+	}
+}
 
+//findHosts looks up the hosts table entries which match the selector while tracking the
+//max beacons of a source. The configured index hint is applied, and the plan MongoDB
+//chooses for the query is logged if requested.
+func (a *analyzer) findHosts(ssn *mgo.Session, selector bson.M) *mgo.Query {
+	query := ssn.DB(a.db.GetSelectedDB()).C(a.conf.T.Structure.HostTable).Find(selector)
+	if len(a.conf.S.Beacon.HostQueryHint) > 0 {
+		query = query.Hint(a.conf.S.Beacon.HostQueryHint...)
+	}
+
+	if a.conf.S.Beacon.ExplainHostQueries {
+		a.explainHostQuery(query, selector)
+	}
+	return query
+}
+
+//countHosts counts the hosts table entries which match the selector while tracking the
+//max beacons of a source. Lookups failing with transient errors are retried.
+func (a *analyzer) countHosts(ssn *mgo.Session, selector bson.M) (int, error) {
+	var count int
+	err := a.retrier.Do(a.ctx, ssn, func() error {
+		var err error
+		count, err = a.findHosts(ssn, selector).Count()
+		return err
+	})
+	return count, err
+}
+
+//explainHostQuery logs the plan MongoDB chooses for a hosts table query
+func (a *analyzer) explainHostQuery(query *mgo.Query, selector bson.M) {
+	var explain bson.M
+	if err := query.Explain(&explain); err != nil {
+		a.log.WithError(err).WithFields(log.Fields{
+			"selector": selector,
+		}).Warn("Could not explain the hosts collection query")
+		return
+	}
+
+	a.log.WithFields(log.Fields{
+		"selector": selector,
+		"plan":     winningPlan(explain),
+	}).Info("Explained the hosts collection query")
+}
+
+//winningPlan returns the plan chosen by the query planner from the output of explain,
+//or the whole output if it doesn't hold a query planner section
+func winningPlan(explain bson.M) interface{} {
+	if planner, ok := explain["queryPlanner"].(bson.M); ok {
+		if plan, ok := planner["winningPlan"]; ok {
+			return plan
+		}
+	}
+	return explain
+}
+
+//hostIcertQuery builds the update which records the invalid certificates of the source in
+//the hosts table. The given session is owned by the calling analysis thread.
+func (a *analyzer) hostIcertQuery(ssn *mgo.Session, icert bool, src data.UniqueIP, dst data.UniqueIP) updateInfo {
 	var output updateInfo
 
 	// create query
@@ -357,24 +522,29 @@ func (a *analyzer) hostIcertQuery(icert bool, src data.UniqueIP, dst data.Unique
 	return output
 }
 
-func (a *analyzer) hostBeaconQuery(score float64, src data.UniqueIP, dst data.UniqueIP) updateInfo {
-	ssn := a.db.Session.Copy()
-	defer ssn.Close()
-
-	var output updateInfo
-
-	// create query
-	query := bson.M{}
-
-	// check if we need to update
-	// we do this before the other queries because otherwise if a beacon
-	// starts out with a high score which reduces over time, it will keep
-	// the incorrect high max for that specific destination.
-	maxBeaconMatchExactQuery := src.BSONKey()
-	maxBeaconMatchExactQuery["dat"] = bson.M{"$elemMatch": dst.PrefixedBSONKey("mbdst")}
+//hostBeaconQuery builds the updates which track the max beacon score for the source in
+//the hosts table. The given session is owned by the calling analysis thread. The hosts
+//table is only read to skip the updates when the source already holds a higher max
+//beacon for the chunk. The updates themselves don't depend on what was read, so updates
+//for the same source from concurrent analysis threads still converge on a single entry
+//per chunk holding the highest score.
+func (a *analyzer) hostBeaconQuery(ssn *mgo.Session, score float64, src data.UniqueIP, dst data.UniqueIP) maxBeaconUpdate {
+	_, span := tracing.Start(a.ctx, "hostBeaconQuery")
+	defer span.End()
+
+	// the entry of the same destination is replaced even if the score went down, since
+	// otherwise a beacon which starts out with a high score that reduces over time would
+	// keep the incorrect high max. Any other higher scoring entry is left alone.
+	maxBeaconMatchUpperQuery := src.BSONKey()
+	maxBeaconMatchUpperQuery["dat"] = bson.M{
+		"$elemMatch": bson.M{
+			"cid":              a.chunk,
+			"max_beacon_score": bson.M{"$gte": score},
+			"$nor":             []bson.M{dst.PrefixedBSONKey("mbdst")},
+		},
+	}
 
-	nExactMatches, err := ssn.DB(a.db.GetSelectedDB()).C(a.conf.T.Structure.HostTable).
-		Find(maxBeaconMatchExactQuery).Count()
+	nUpperMatches, err := a.countHosts(ssn, maxBeaconMatchUpperQuery)
 
 	if err != nil {
 		a.log.WithError(err).WithFields(log.Fields{
@@ -383,130 +553,70 @@ func (a *analyzer) hostBeaconQuery(score float64, src data.UniqueIP, dst data.Un
 			"dst":              dst.IP,
 			"dst_network_name": dst.NetworkName,
 		}).Error(
-			"Could not check for existing max ip beacon in hosts collection. " +
+			"Could not check for higher scoring max ip beacon in hosts collection. " +
 				"Refusing to update source's max ip beacon.",
 		)
-		return updateInfo{}
+		return maxBeaconUpdate{}
 	}
 
-	// if we have exact matches, update to new score and return
-	if nExactMatches > 0 {
-		query["$set"] = bson.M{
-			"dat.$.max_beacon_score": score,
-			"dat.$.mbdst":            dst,
-			"dat.$.cid":              a.chunk,
-		}
-
-		// create selector for output
-		output.query = query
-
-		// using the same find query we created above will allow us to match and
-		// update the exact chunk we need to update
-		output.selector = maxBeaconMatchExactQuery
-
-		return output
+	if nUpperMatches > 0 {
+		return maxBeaconUpdate{}
 	}
 
-	// The below is only for cases where the ip is not currently listed as a max beacon
-	// for a source
-	// update max beacon score
-	newFlag := false
-	updateFlag := false
+	return a.maxBeaconUpdate(score, src, dst)
+}
 
-	// this query will find any matching chunk that is reporting a lower
-	// max beacon score than the current one we are working with
-	maxBeaconMatchLowerQuery := src.BSONKey()
-	maxBeaconMatchLowerQuery["dat"] = bson.M{
-		"$elemMatch": bson.M{
-			"cid":              a.chunk,
-			"max_beacon_score": bson.M{"$lte": score},
-		},
-	}
-	// find matching lower chunks
-	nLowerMatches, err := ssn.DB(a.db.GetSelectedDB()).C(a.conf.T.Structure.HostTable).
-		Find(maxBeaconMatchLowerQuery).Count()
+//maxBeaconUpdate builds the conditional updates which record the destination as the max
+//beacon of the source for the current chunk
+func (a *analyzer) maxBeaconUpdate(score float64, src data.UniqueIP, dst data.UniqueIP) maxBeaconUpdate {
+	var output maxBeaconUpdate
 
-	if err != nil {
-		a.log.WithError(err).WithFields(log.Fields{
-			"src":              src.IP,
-			"src_network_name": src.NetworkName,
-			"dst":              dst.IP,
-			"dst_network_name": dst.NetworkName,
-		}).Error(
-			"Could not check for lower scoring max ip beacon in hosts collection. " +
-				"Refusing to update source's max ip beacon.",
-		)
-		return updateInfo{}
+	// create the host record if it doesn't exist yet so the entry may be pushed onto it
+	output.host = updateInfo{
+		selector: src.BSONKey(),
+		query:    bson.M{"$setOnInsert": bson.M{"dat": []bson.M{}}},
 	}
 
-	// if no matching chunks are found, we will set the new flag
-	if nLowerMatches == 0 {
-
-		maxBeaconMatchUpperQuery := src.BSONKey()
-		maxBeaconMatchUpperQuery["dat"] = bson.M{
+	// push an entry only if the chunk doesn't have one yet. The condition is checked
+	// when the update is applied, so two updates can't both push an entry.
+	output.insert = updateInfo{
+		selector: src.BSONKey(),
+		query: bson.M{
+			"$push": bson.M{
+				"dat": bson.M{
+					"max_beacon_score": score,
+					"mbdst":            dst,
+					"cid":              a.chunk,
+				}}},
+	}
+	output.insert.selector["dat"] = bson.M{
+		"$not": bson.M{
 			"$elemMatch": bson.M{
 				"cid":              a.chunk,
-				"max_beacon_score": bson.M{"$gte": score},
+				"max_beacon_score": bson.M{"$exists": true},
 			},
-		}
-
-		// find matching upper chunks
-		nUpperMatches, err := ssn.DB(a.db.GetSelectedDB()).C(a.conf.T.Structure.HostTable).
-			Find(maxBeaconMatchUpperQuery).Count()
-
-		if err != nil {
-			a.log.WithError(err).WithFields(log.Fields{
-				"src":              src.IP,
-				"src_network_name": src.NetworkName,
-				"dst":              dst.IP,
-				"dst_network_name": dst.NetworkName,
-			}).Error(
-				"Could not check for higher scoring max ip beacon in hosts collection. " +
-					"Refusing to update source's max ip beacon.",
-			)
-			return updateInfo{}
-		}
-
-		// update if no upper chunks are found
-		if nUpperMatches == 0 {
-			newFlag = true
-		}
-	} else {
-		updateFlag = true
+		},
 	}
 
-	// since we didn't find any changeable lower max beacon scores, we will
-	// set the condition to push a new entry with the current score listed as the
-	// max beacon ONLY if no matching chunks reporting higher max beacon scores
-	// are found.
-
-	if newFlag {
-
-		query["$push"] = bson.M{
-			"dat": bson.M{
-				"max_beacon_score": score,
-				"mbdst":            dst,
-				"cid":              a.chunk,
-			}}
-
-		// create selector for output
-		output.query = query
-		output.selector = src.BSONKey()
-
-	} else if updateFlag {
-
-		query["$set"] = bson.M{
-			"dat.$.max_beacon_score": score,
-			"dat.$.mbdst":            dst,
-			"dat.$.cid":              a.chunk,
-		}
-
-		// create selector for output
-		output.query = query
-
-		// using the same find query we created above will allow us to match and
-		// update the exact chunk we need to update
-		output.selector = maxBeaconMatchLowerQuery
+	// replace the chunk's entry if it holds a lower score or the same destination
+	output.replace = updateInfo{
+		selector: src.BSONKey(),
+		query: bson.M{
+			"$set": bson.M{
+				"dat.$.max_beacon_score": score,
+				"dat.$.mbdst":            dst,
+				"dat.$.cid":              a.chunk,
+			},
+		},
+	}
+	output.replace.selector["dat"] = bson.M{
+		"$elemMatch": bson.M{
+			"cid": a.chunk,
+			"$or": []bson.M{
+				{"max_beacon_score": bson.M{"$lt": score}},
+				dst.PrefixedBSONKey("mbdst"),
+			},
+		},
 	}
 
 	return output
@@ -0,0 +1,142 @@
+package beacon
+
+import (
+	"context"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/activecm/rita/config"
+	"github.com/activecm/rita/pkg/uconn"
+	"github.com/activecm/rita/util"
+	"github.com/globalsign/mgo/bson"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnCountScore(t *testing.T) {
+	a := newAnalyzer(context.Background(), 0, 1000, 0, nil, &config.Config{}, nil, nil, nil)
+	require.Equal(t, 0.5, a.connCountScore(50))
+	require.Equal(t, 1.0, a.connCountScore(100))
+	require.Equal(t, 1.0, a.connCountScore(5000))
+
+	// a dataset spanning a single instant doesn't divide by zero
+	a = newAnalyzer(context.Background(), 1517336042, 1517336042, 0, nil, &config.Config{}, nil, nil, nil)
+	require.Equal(t, 1.0, a.connCountScore(3))
+	require.Equal(t, 1.0, a.connCountScore(0))
+}
+
+func TestWinningPlan(t *testing.T) {
+	plan := bson.M{"stage": "FETCH", "inputStage": bson.M{"stage": "IXSCAN", "indexName": "ip_1"}}
+	explain := bson.M{"queryPlanner": bson.M{"winningPlan": plan, "rejectedPlans": []interface{}{}}}
+	require.Equal(t, plan, winningPlan(explain))
+
+	// the output of older servers is logged as is
+	legacy := bson.M{"cursor": "BtreeCursor ip_1"}
+	require.Equal(t, legacy, winningPlan(legacy))
+}
+
+//mapCountMap is the reference implementation of createCountMap which counts
+//the numbers in a map and looks up the count of each distinct number
+func mapCountMap(numberList []int64) ([]int64, []int64, int64, int64) {
+	var distinct []int64
+	counts := make(map[int64]int64)
+	for idx, number := range numberList {
+		if idx == 0 || number != numberList[idx-1] {
+			distinct = append(distinct, number)
+		}
+		counts[number]++
+	}
+
+	countsArr := make([]int64, len(distinct))
+	mode := distinct[0]
+	max := counts[mode]
+	for i, number := range distinct {
+		countsArr[i] = counts[number]
+		if countsArr[i] > max {
+			max = countsArr[i]
+			mode = number
+		}
+	}
+	return distinct, countsArr, mode, max
+}
+
+//testDiffs creates sorted delta times which repeat a handful of intervals
+func testDiffs(length int) []int64 {
+	rng := rand.New(rand.NewSource(1))
+	diffs := make([]int64, length)
+	for i := range diffs {
+		diffs[i] = 55 + rng.Int63n(10)
+	}
+	sort.Sort(util.SortableInt64(diffs))
+	return diffs
+}
+
+func TestCreateCountMap(t *testing.T) {
+	for _, numberList := range [][]int64{
+		{5},
+		{5, 5, 5},
+		{1, 2, 2, 3, 3, 3},
+		{1, 1, 2, 2},
+		testDiffs(1000),
+		// unsorted numbers are still counted across runs
+		{3, 3, 1, 3, 2, 1, 1},
+	} {
+		distinct, counts, mode, modeCount := createCountMap(numberList)
+		expectedDistinct, expectedCounts, expectedMode, expectedModeCount := mapCountMap(numberList)
+		require.Equal(t, expectedDistinct, distinct)
+		require.Equal(t, expectedCounts, counts)
+		require.Equal(t, expectedMode, mode)
+		require.Equal(t, expectedModeCount, modeCount)
+	}
+}
+
+func TestCreateCountMapEmpty(t *testing.T) {
+	distinct, counts := countAndRemoveConsecutiveDuplicates([]int64{})
+	require.Nil(t, distinct)
+	require.Nil(t, counts)
+
+	distinct, counts, mode, modeCount := createCountMap(nil)
+	require.Nil(t, distinct)
+	require.Nil(t, counts)
+	require.Zero(t, mode)
+	require.Zero(t, modeCount)
+
+	// a single delta time is its own mode
+	distinct, counts, mode, modeCount = createCountMap([]int64{60})
+	require.Equal(t, []int64{60}, distinct)
+	require.Equal(t, []int64{1}, counts)
+	require.Equal(t, int64(60), mode)
+	require.Equal(t, int64(1), modeCount)
+}
+
+//BenchmarkCreateCountMap compares counting the delta times in a map against counting
+//the runs of the sorted delta times
+func BenchmarkCreateCountMap(b *testing.B) {
+	diffs := testDiffs(100000)
+
+	b.Run("map", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			mapCountMap(diffs)
+		}
+	})
+
+	b.Run("runs", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			createCountMap(diffs)
+		}
+	})
+}
+
+func TestAnalyzerCollectCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	a := newAnalyzer(ctx, 0, 1000, 0, nil, &config.Config{}, nil, nil, nil)
+	cancel()
+
+	// nothing reads the analysis channel, yet collect doesn't block once cancelled
+	a.collect(&uconn.Input{})
+
+	_, ok := a.next()
+	require.False(t, ok)
+}
@@ -1,7 +1,9 @@
 package beacon
 
 import (
+	"context"
 	"runtime"
+	"sync/atomic"
 
 	"github.com/activecm/rita/config"
 	"github.com/activecm/rita/database"
@@ -11,19 +13,24 @@ import (
 	"github.com/globalsign/mgo"
 	"github.com/vbauerster/mpb"
 	"github.com/vbauerster/mpb/decor"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 
 	log "github.com/sirupsen/logrus"
 )
 
 type repo struct {
+	ctx      context.Context
 	database *database.DB
 	config   *config.Config
 	log      *log.Logger
 }
 
-//NewMongoRepository create new repository
-func NewMongoRepository(db *database.DB, conf *config.Config, logger *log.Logger) Repository {
+//NewMongoRepository create new repository. The analysis is stopped once ctx is
+//cancelled and its spans are recorded as children of the span held by ctx.
+func NewMongoRepository(ctx context.Context, db *database.DB, conf *config.Config, logger *log.Logger) Repository {
 	return &repo{
+		ctx:      ctx,
 		database: db,
 		config:   conf,
 		log:      logger,
@@ -76,14 +83,24 @@ func (r *repo) Upsert(uconnMap map[string]*uconn.Input, minTimestamp, maxTimesta
 		r.log,
 	)
 
+	// count the beacons written so they can be recorded by the trace
+	var beacons int64
+	writerCollect := func(data *update) {
+		if data.beacon.query != nil {
+			atomic.AddInt64(&beacons, 1)
+		}
+		writerWorker.collect(data)
+	}
+
 	analyzerWorker := newAnalyzer(
+		r.ctx,
 		minTimestamp,
 		maxTimestamp,
 		r.config.S.Rolling.CurrentChunk,
 		r.database,
 		r.config,
 		r.log,
-		writerWorker.collect,
+		writerCollect,
 		writerWorker.close,
 	)
 
@@ -129,4 +146,6 @@ func (r *repo) Upsert(uconnMap map[string]*uconn.Input, minTimestamp, maxTimesta
 
 	// start the closing cascade (this will also close the other channels)
 	dissectorWorker.close()
+
+	trace.SpanFromContext(r.ctx).SetAttributes(attribute.Int64("rita.beacons", atomic.LoadInt64(&beacons)))
 }
@@ -3,15 +3,25 @@
 package beacon
 
 import (
+	"context"
+	"fmt"
 	"io/ioutil"
 	"os"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/activecm/rita/pkg/data"
 	"github.com/activecm/rita/pkg/uconn"
 	"github.com/activecm/rita/resources"
 	"github.com/activecm/rita/util"
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
 	"github.com/globalsign/mgo/dbtest"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // Server holds the dbtest DBServer
@@ -22,6 +32,8 @@ var testTargetDB = "tmp_test_db"
 
 var testRepo Repository
 
+var testRes *resources.Resources
+
 var testHost = map[string]*uconn.Input{
 	"test": {
 		Hosts: data.UniqueIPPair{
@@ -51,16 +63,216 @@ func TestUpsert(t *testing.T) {
 	testRepo.Upsert(testHost, 1234560, 1234570)
 }
 
+//seedMaxBeacon records a max beacon for the source in the hosts table
+func seedMaxBeacon(t testing.TB, ssn *mgo.Session, src data.UniqueIP, dst data.UniqueIP, score float64) {
+	dat := dst.PrefixedBSONKey("mbdst")
+	dat["max_beacon_score"] = score
+	dat["cid"] = 0
+	_, err := ssn.DB(testTargetDB).C(testRes.Config.T.Structure.HostTable).
+		Upsert(src.BSONKey(), bson.M{"$set": bson.M{"dat": []bson.M{dat}}})
+	require.Nil(t, err)
+}
+
+func TestHostBeaconQuerySharedSession(t *testing.T) {
+	testRes.DB.SelectDB(testTargetDB)
+	ssn := testRes.DB.Session.Copy()
+	defer ssn.Close()
+
+	src := data.UniqueIP{IP: "10.0.0.5", NetworkUUID: util.UnknownPrivateNetworkUUID, NetworkName: util.UnknownPrivateNetworkName}
+	dst := data.UniqueIP{IP: "10.0.0.6", NetworkUUID: util.UnknownPrivateNetworkUUID, NetworkName: util.UnknownPrivateNetworkName}
+	seedMaxBeacon(t, ssn, src, dst, 0.5)
+
+	a := newAnalyzer(context.Background(), 0, 86400, 0, testRes.DB, testRes.Config, testRes.Log, func(*update) {}, func() {})
+
+	// a session shared across queries builds the same updates as a session per query
+	for _, score := range []float64{0.3, 0.5, 0.9} {
+		perQuery := testRes.DB.Session.Copy()
+		expected := a.hostBeaconQuery(perQuery, score, src, dst)
+		perQuery.Close()
+
+		require.Equal(t, expected, a.hostBeaconQuery(ssn, score, src, dst))
+	}
+}
+
+func TestFindHostsHint(t *testing.T) {
+	testRes.DB.SelectDB(testTargetDB)
+	ssn := testRes.DB.Session.Copy()
+	defer ssn.Close()
+
+	src := data.UniqueIP{IP: "10.0.0.9", NetworkUUID: util.UnknownPrivateNetworkUUID, NetworkName: util.UnknownPrivateNetworkName}
+	dst := data.UniqueIP{IP: "10.0.0.10", NetworkUUID: util.UnknownPrivateNetworkUUID, NetworkName: util.UnknownPrivateNetworkName}
+	seedMaxBeacon(t, ssn, src, dst, 0.5)
+
+	conf := *testRes.Config
+	logger, hook := test.NewNullLogger()
+	a := newAnalyzer(context.Background(), 0, 86400, 0, testRes.DB, &conf, logger, func(*update) {}, func() {})
+
+	// the hint is sent along with the query, so hinting an index which doesn't exist fails
+	conf.S.Beacon.HostQueryHint = []string{"no_such_field"}
+	_, err := a.findHosts(ssn, src.BSONKey()).Count()
+	require.NotNil(t, err)
+	require.Equal(t, maxBeaconUpdate{}, a.hostBeaconQuery(ssn, 0.7, src, dst))
+
+	conf.S.Beacon.HostQueryHint = []string{"_id"}
+	n, err := a.findHosts(ssn, src.BSONKey()).Count()
+	require.Nil(t, err)
+	require.Equal(t, 1, n)
+
+	// the chosen plan is logged when requested
+	conf.S.Beacon.ExplainHostQueries = true
+	hook.Reset()
+	a.hostBeaconQuery(ssn, 0.7, src, dst)
+	require.NotEmpty(t, hook.AllEntries())
+	require.Equal(t, "Explained the hosts collection query", hook.LastEntry().Message)
+	require.NotNil(t, hook.LastEntry().Data["plan"])
+}
+
+func TestHostBeaconQueryConcurrent(t *testing.T) {
+	testRes.DB.SelectDB(testTargetDB)
+	src := data.UniqueIP{IP: "10.0.0.11", NetworkUUID: util.UnknownPrivateNetworkUUID, NetworkName: util.UnknownPrivateNetworkName}
+	w := newWriter(testRes.Config.T.Beacon.BeaconTable, testRes.DB, testRes.Config, testRes.Log)
+
+	// many beacons from the same source are analyzed and written at once across two chunks
+	const beacons = 200
+	maxScores := make(map[int]float64)
+	var wg sync.WaitGroup
+	for i := 0; i < beacons; i++ {
+		chunk := i % 2
+		score := float64((i*37)%beacons) / beacons
+		if score > maxScores[chunk] {
+			maxScores[chunk] = score
+		}
+		dst := data.UniqueIP{IP: fmt.Sprintf("10.2.%d.%d", i/256, i%256), NetworkUUID: util.UnknownPrivateNetworkUUID, NetworkName: util.UnknownPrivateNetworkName}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ssn := testRes.DB.Session.Copy()
+			defer ssn.Close()
+
+			a := newAnalyzer(context.Background(), 0, 86400, chunk, testRes.DB, testRes.Config, testRes.Log, func(*update) {}, func() {})
+			updates := a.hostBeaconQuery(ssn, score, src, dst)
+			if updates.insert.query != nil {
+				assert.Nil(t, w.updateMaxBeacon(ssn.DB(testTargetDB).C(testRes.Config.T.Structure.HostTable), updates))
+			}
+		}()
+	}
+	wg.Wait()
+
+	var host struct {
+		Dat []struct {
+			MaxBeaconScore *float64 `bson:"max_beacon_score"`
+			CID            int      `bson:"cid"`
+		} `bson:"dat"`
+	}
+	ssn := testRes.DB.Session.Copy()
+	defer ssn.Close()
+	require.Nil(t, ssn.DB(testTargetDB).C(testRes.Config.T.Structure.HostTable).Find(src.BSONKey()).One(&host))
+
+	// every chunk holds exactly one entry with the highest score
+	found := make(map[int]float64)
+	for _, entry := range host.Dat {
+		if entry.MaxBeaconScore == nil {
+			continue
+		}
+		_, ok := found[entry.CID]
+		require.False(t, ok, "chunk %d holds more than one max beacon", entry.CID)
+		found[entry.CID] = *entry.MaxBeaconScore
+	}
+	require.Equal(t, maxScores, found)
+}
+
+//BenchmarkHostBeaconQuery compares copying a session for every query against sharing
+//the session of the analysis thread. The session copies are reported per query.
+func BenchmarkHostBeaconQuery(b *testing.B) {
+	testRes.DB.SelectDB(testTargetDB)
+	ssn := testRes.DB.Session.Copy()
+	defer ssn.Close()
+
+	src := data.UniqueIP{IP: "10.0.0.7", NetworkUUID: util.UnknownPrivateNetworkUUID, NetworkName: util.UnknownPrivateNetworkName}
+	dst := data.UniqueIP{IP: "10.0.0.8", NetworkUUID: util.UnknownPrivateNetworkUUID, NetworkName: util.UnknownPrivateNetworkName}
+	seedMaxBeacon(b, ssn, src, dst, 0.5)
+
+	a := newAnalyzer(context.Background(), 0, 86400, 0, testRes.DB, testRes.Config, testRes.Log, func(*update) {}, func() {})
+
+	b.Run("copy", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			perQuery := testRes.DB.Session.Copy()
+			a.hostBeaconQuery(perQuery, 0.7, src, dst)
+			perQuery.Close()
+		}
+		b.ReportMetric(1, "copies/op")
+	})
+
+	b.Run("shared", func(b *testing.B) {
+		shared := testRes.DB.Session.Copy()
+		for i := 0; i < b.N; i++ {
+			a.hostBeaconQuery(shared, 0.7, src, dst)
+		}
+		shared.Close()
+		b.ReportMetric(1/float64(b.N), "copies/op")
+	})
+}
+
 // TestMain wraps all tests with the needed initialized mock DB and fixtures
+func TestAnalyzerCancel(t *testing.T) {
+	testRes.DB.SelectDB(testTargetDB)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// cancel the analysis part way through the entries
+	var analyzed int32
+	var closed int32
+	a := newAnalyzer(ctx, 0, 86400, 0, testRes.DB, testRes.Config, testRes.Log,
+		func(*update) {
+			if atomic.AddInt32(&analyzed, 1) == 5 {
+				cancel()
+			}
+		},
+		func() { atomic.AddInt32(&closed, 1) },
+	)
+	for i := 0; i < 2; i++ {
+		a.start()
+	}
+
+	const entries = 10000
+	src := data.UniqueIP{IP: "10.0.1.1", NetworkUUID: util.UnknownPrivateNetworkUUID, NetworkName: util.UnknownPrivateNetworkName}
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < entries; i++ {
+			dst := data.UniqueIP{IP: fmt.Sprintf("10.1.%d.%d", i/256, i%256), NetworkUUID: util.UnknownPrivateNetworkUUID, NetworkName: util.UnknownPrivateNetworkName}
+			a.collect(&uconn.Input{
+				Hosts:           data.NewUniqueIPPair(src, dst),
+				ConnectionCount: 4,
+				TotalBytes:      400,
+				TsList:          []int64{0, 60, 120, 180},
+				OrigBytesList:   []int64{100, 100, 100, 100},
+			})
+		}
+		a.close()
+		close(done)
+	}()
+
+	// the remaining entries are dropped rather than analyzed
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("the analyzer did not shut down after it was cancelled")
+	}
+	require.Less(t, atomic.LoadInt32(&analyzed), int32(entries))
+	require.Equal(t, int32(1), atomic.LoadInt32(&closed))
+}
+
 func TestMain(m *testing.M) {
 	// Store temporary databases files in a temporary directory
 	tempDir, _ := ioutil.TempDir("", "testing")
 	Server.SetPath(tempDir)
 
 	// Set the main session variable to the temporary MongoDB instance
-	res := resources.InitTestResources()
+	testRes = resources.InitTestResources()
 
-	testRepo = NewMongoRepository(res.DB, res.Config, res.Log)
+	testRepo = NewMongoRepository(context.Background(), testRes.DB, testRes.Config, testRes.Log)
 
 	// Run the test suite
 	retCode := m.Run()
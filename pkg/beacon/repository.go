@@ -17,11 +17,20 @@ type updateInfo struct {
 	query    bson.M
 }
 
+//maxBeaconUpdate holds the updates which record a beacon as the max beacon of its
+//source. They are applied in order, and each one is conditioned on the state of the
+//host record when it is applied rather than when the beacon was analyzed.
+type maxBeaconUpdate struct {
+	host    updateInfo // creates the host record if it doesn't exist
+	insert  updateInfo // adds an entry for the chunk if it doesn't have one
+	replace updateInfo // replaces the chunk's entry if it has a lower score or the same destination
+}
+
 //update ....
 type update struct {
 	beacon     updateInfo
 	hostIcert  updateInfo
-	hostBeacon updateInfo
+	hostBeacon maxBeaconUpdate
 	uconn      updateInfo
 }
 
@@ -54,6 +63,7 @@ type Result struct {
 	Ts                TSData  `bson:"ts"`
 	Ds                DSData  `bson:"ds"`
 	Score             float64 `bson:"score"`
+	ScoreBand         string  `bson:"score_band"`
 }
 
 //StrobeResult represents a unique connection with a large amount
@@ -5,6 +5,7 @@ import (
 
 	"github.com/activecm/rita/config"
 	"github.com/activecm/rita/database"
+	"github.com/globalsign/mgo"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -79,16 +80,12 @@ func (w *writer) start() {
 				}
 
 				// update hosts table with max beacon updates
-				if data.hostBeacon.query != nil {
+				if data.hostBeacon.insert.query != nil {
+					err = w.updateMaxBeacon(ssn.DB(w.db.GetSelectedDB()).C(w.conf.T.Structure.HostTable), data.hostBeacon)
 
-					// update hosts table
-					info, err = ssn.DB(w.db.GetSelectedDB()).C(w.conf.T.Structure.HostTable).Upsert(data.hostBeacon.selector, data.hostBeacon.query)
-
-					if err != nil ||
-						((info.Updated == 0) && (info.UpsertedId == nil) && (info.Matched == 0)) {
+					if err != nil {
 						w.log.WithFields(log.Fields{
 							"Module": "beacons",
-							"Info":   info,
 							"Data":   data,
 						}).Error(err)
 					}
@@ -124,3 +121,20 @@ func (w *writer) start() {
 		w.writeWg.Done()
 	}()
 }
+
+//updateMaxBeacon applies the updates which record the max beacon of a source in order. The
+//insert and replace updates are expected to match nothing when their conditions don't hold.
+func (w *writer) updateMaxBeacon(hosts *mgo.Collection, updates maxBeaconUpdate) error {
+	_, err := hosts.Upsert(updates.host.selector, updates.host.query)
+	if err != nil {
+		return err
+	}
+
+	for _, conditional := range []updateInfo{updates.insert, updates.replace} {
+		err = hosts.Update(conditional.selector, conditional.query)
+		if err != nil && err != mgo.ErrNotFound {
+			return err
+		}
+	}
+	return nil
+}
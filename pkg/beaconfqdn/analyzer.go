@@ -1,44 +1,60 @@
 package beaconfqdn
 
 import (
+	"context"
 	"math"
 	"sort"
 	"strconv"
 	"sync"
+	"time"
 
 	"github.com/activecm/rita/config"
 	"github.com/activecm/rita/database"
 	"github.com/activecm/rita/pkg/data"
+	"github.com/activecm/rita/tracing"
 	"github.com/activecm/rita/util"
+	"github.com/globalsign/mgo"
 	"github.com/globalsign/mgo/bson"
 	log "github.com/sirupsen/logrus"
 )
 
+//hostQueryBackoff is the wait before retrying a hosts table lookup which failed with a
+//transient error. The wait doubles after every further failed attempt.
+const hostQueryBackoff = 100 * time.Millisecond
+
 type (
 	analyzer struct {
-		tsMin            int64           // min timestamp for the whole dataset
-		tsMax            int64           // max timestamp for the whole dataset
-		chunk            int             //current chunk (0 if not on rolling analysis)
-		chunkStr         string          //current chunk (0 if not on rolling analysis)
-		db               *database.DB    // provides access to MongoDB
-		conf             *config.Config  // contains details needed to access MongoDB
-		log              *log.Logger     // main logger for RITA
-		analyzedCallback func(*update)   // called on each analyzed result
-		closedCallback   func()          // called when .close() is called and no more calls to analyzedCallback will be made
-		analysisChannel  chan *fqdnInput // holds unanalyzed data
-		analysisWg       sync.WaitGroup  // wait for analysis to finish
+		ctx              context.Context   // stops the analysis once cancelled, holds the span the analysis is traced under
+		tsMin            int64             // min timestamp for the whole dataset
+		tsMax            int64             // max timestamp for the whole dataset
+		tsConnDiv        float64           // the connection count which earns the max connection count score
+		chunk            int               //current chunk (0 if not on rolling analysis)
+		chunkStr         string            //current chunk (0 if not on rolling analysis)
+		db               *database.DB      // provides access to MongoDB
+		retrier          *database.Retrier // retries the hosts table lookups which fail with transient errors
+		conf             *config.Config    // contains details needed to access MongoDB
+		log              *log.Logger       // main logger for RITA
+		analyzedCallback func(*update)     // called on each analyzed result
+		closedCallback   func()            // called when .close() is called and no more calls to analyzedCallback will be made
+		analysisChannel  chan *fqdnInput   // holds unanalyzed data
+		analysisWg       sync.WaitGroup    // wait for analysis to finish
 	}
 )
 
-//newAnalyzer creates a new collector for gathering data //
-func newAnalyzer(min int64, max int64, chunk int, db *database.DB, conf *config.Config, log *log.Logger,
+//newAnalyzer creates a new collector for gathering data. The database lookups are
+//traced as children of the span held by ctx. Once ctx is cancelled, the analysis
+//thread exits without analyzing the remaining data.
+func newAnalyzer(ctx context.Context, min int64, max int64, chunk int, db *database.DB, conf *config.Config, log *log.Logger,
 	analyzedCallback func(*update), closedCallback func()) *analyzer {
 	return &analyzer{
+		ctx:              ctx,
 		tsMin:            min,
 		tsMax:            max,
+		tsConnDiv:        (float64(max) - float64(min)) / 10.0,
 		chunk:            chunk,
 		chunkStr:         strconv.Itoa(chunk),
 		db:               db,
+		retrier:          database.NewRetrier(conf.S.BeaconFQDN.HostQueryMaxAttempts, hostQueryBackoff),
 		conf:             conf,
 		log:              log,
 		analyzedCallback: analyzedCallback,
@@ -47,24 +63,47 @@ func newAnalyzer(min int64, max int64, chunk int, db *database.DB, conf *config.
 	}
 }
 
-//collect sends a chunk of data to be analyzed
+//collect sends a chunk of data to be analyzed. The data is dropped if the analysis
+//has been cancelled.
 func (a *analyzer) collect(data *fqdnInput) {
-	a.analysisChannel <- data
+	select {
+	case a.analysisChannel <- data:
+	case <-a.ctx.Done():
+	}
+}
+
+//next waits for the next chunk of data to analyze. Returns false once the
+//collector is closed or the analysis has been cancelled.
+func (a *analyzer) next() (*fqdnInput, bool) {
+	if a.ctx.Err() != nil {
+		return nil, false
+	}
+
+	select {
+	case data, ok := <-a.analysisChannel:
+		return data, ok
+	case <-a.ctx.Done():
+		return nil, false
+	}
 }
 
-//close waits for the collector to finish
+//close waits for the collector to finish. If the analysis has been cancelled, the
+//analysis thread only finishes the entry it is working on.
 func (a *analyzer) close() {
 	close(a.analysisChannel)
 	a.analysisWg.Wait()
 	a.closedCallback()
 }
 
-//start kicks off a new analysis thread
+//start kicks off a new analysis thread. The thread reads the hosts table through
+//its own copy of the database session, which is closed once the thread exits.
 func (a *analyzer) start() {
 	a.analysisWg.Add(1)
 
 	go func() {
-		for entry := range a.analysisChannel {
+		ssn := a.db.Session.Copy()
+
+		for entry, ok := a.next(); ok; entry, ok = a.next() {
 			// set up beacon writer output
 			output := &update{}
 
@@ -108,6 +147,16 @@ func (a *analyzer) start() {
 				// set to writer channel
 				a.analyzedCallback(output)
 
+			} else if len(entry.TsList) < minUniqueTimestamps {
+
+				// the dissector only passes along beacons with enough unique timestamps
+				// to score, but the delta time statistics can't be computed without them
+				a.log.WithFields(log.Fields{
+					"src":        entry.Src.SrcIP,
+					"fqdn":       entry.FQDN,
+					"timestamps": len(entry.TsList),
+				}).Debug("Skipping FQDN beacon with too few unique timestamps to score")
+
 			} else {
 				//store the diff slice length since we use it a lot
 				//for timestamps this is one less then the data slice length
@@ -115,7 +164,8 @@ func (a *analyzer) start() {
 				tsLength := len(entry.TsList) - 1
 				dsLength := len(entry.OrigBytesList)
 
-				//find the delta times between the timestamps
+				//find the delta times between the timestamps. The timestamps are
+				//sorted and unique, and the parser drops the ones which failed to parse.
 				diff := make([]int64, tsLength)
 				for i := 0; i < tsLength; i++ {
 					diff[i] = entry.TsList[i+1] - entry.TsList[i]
@@ -205,11 +255,7 @@ func (a *analyzer) start() {
 				}
 
 				// connection count scoring
-				tsConnDiv := (float64(a.tsMax) - float64(a.tsMin)) / 10.0
-				tsConnCountScore := float64(entry.ConnectionCount) / tsConnDiv
-				if tsConnCountScore > 1.0 {
-					tsConnCountScore = 1.0
-				}
+				tsConnCountScore := a.connCountScore(entry.ConnectionCount)
 
 				//score numerators
 				tsSum := tsSkewScore + tsMadmScore + tsConnCountScore
@@ -219,6 +265,7 @@ func (a *analyzer) start() {
 				tsScore := math.Ceil((tsSum/3.0)*1000) / 1000
 				dsScore := math.Ceil((dsSum/3.0)*1000) / 1000
 				score := math.Ceil(((tsSum+dsSum)/6.0)*1000) / 1000
+				bands := a.conf.S.ScoreBands
 
 				// update beacon query
 				query["$set"] = bson.M{
@@ -242,6 +289,7 @@ func (a *analyzer) start() {
 					"ds.skew":            dsSkew,
 					"ds.score":           dsScore,
 					"score":              score,
+					"score_band":         util.ScoreBand(score, bands.Medium, bands.High, bands.Critical),
 					"cid":                a.chunk,
 					"src_network_name":   entry.Src.SrcNetworkName,
 					"resolved_ips":       entry.ResolvedIPs,
@@ -255,7 +303,17 @@ func (a *analyzer) start() {
 				output.beacon.selector = selectorPair.BSONKey()
 
 				// updates max FQDN beacon score for the source entry in the hosts table
-				output.hostBeacon = a.hostBeaconQuery(score, entry.Src.Unpair(), entry.FQDN)
+				// the hosts table lookups are skipped once the analysis is cancelled
+				if a.ctx.Err() != nil {
+					continue
+				}
+				output.hostBeacon = a.hostBeaconQuery(ssn, score, entry.Src.Unpair(), entry.FQDN)
+
+				// the beacon and its hosts table updates are written together or not at all,
+				// so a result whose lookups were cut short by a cancellation is dropped
+				if a.ctx.Err() != nil {
+					continue
+				}
 
 				// set to writer channel
 				a.analyzedCallback(output)
@@ -263,24 +321,48 @@ func (a *analyzer) start() {
 
 		}
 
+		ssn.Close()
 		a.analysisWg.Done()
 	}()
 }
 
+//connCountScore scores how many connections were made relative to the span of the dataset.
+//A dataset spanning a single instant leaves no room to compare against, so any connections
+//made in it receive the max score.
+func (a *analyzer) connCountScore(connCount int64) float64 {
+	if a.tsConnDiv <= 0 {
+		return 1.0
+	}
+
+	score := float64(connCount) / a.tsConnDiv
+	if score > 1.0 {
+		score = 1.0
+	}
+	return score
+}
+
+//minUniqueTimestamps is the fewest unique timestamps a beacon needs in order to be scored
+const minUniqueTimestamps = 4
+
+//distinctRatio is the expected number of delta times per distinct delta time, which
+//is used to presize the results of countAndRemoveConsecutiveDuplicates
+const distinctRatio = 16
+
 // createCountMap returns a distinct data array, data count array, the mode,
 // and the number of times the mode occurred
 func createCountMap(sortedIn []int64) ([]int64, []int64, int64, int64) {
 	//Since the data is already sorted, we can call this without fear
-	distinct, countsMap := countAndRemoveConsecutiveDuplicates(sortedIn)
-	countsArr := make([]int64, len(distinct))
+	distinct, countsArr := countAndRemoveConsecutiveDuplicates(sortedIn)
+	//there is no mode without any data
+	if len(distinct) == 0 {
+		return nil, nil, 0, 0
+	}
 	mode := distinct[0]
-	max := countsMap[mode]
-	for i, datum := range distinct {
-		count := countsMap[datum]
-		countsArr[i] = count
+	max := countsArr[0]
+	for i, count := range countsArr {
 		if count > max {
 			max = count
-			mode = datum
+			mode = distinct[i]
 		}
 	}
 	return distinct, countsArr, mode, max
@@ -288,95 +370,83 @@ func createCountMap(sortedIn []int64) ([]int64, []int64, int64, int64) {
 
 //countAndRemoveConsecutiveDuplicates removes consecutive
 //duplicates in an array of integers and counts how many
-//instances of each number exist in the array.
+//instances of each number exist in the array. The counts
+//are aligned with the returned numbers.
 //Similar to `uniq -c`, but counts all duplicates, not just
-//consecutive duplicates.
-func countAndRemoveConsecutiveDuplicates(numberList []int64) ([]int64, map[int64]int64) {
-	//Avoid some reallocations
-	result := make([]int64, 0, len(numberList)/2)
-	counts := make(map[int64]int64)
+//consecutive duplicates. Returns nil slices if numberList is empty.
+func countAndRemoveConsecutiveDuplicates(numberList []int64) ([]int64, []int64) {
+	if len(numberList) == 0 {
+		return nil, nil
+	}
+
+	//Avoid some reallocations. Beacons tend to repeat a small
+	//number of intervals, so far fewer numbers than the input
+	//are expected to remain.
+	distinctEstimate := len(numberList)/distinctRatio + 1
+	result := make([]int64, 0, distinctEstimate)
+	counts := make([]int64, 0, distinctEstimate)
 
 	last := numberList[0]
 	result = append(result, last)
-	counts[last]++
+	counts = append(counts, 1)
 
+	//the length of each run is the total count of its number
+	//as long as the numbers are sorted
+	sorted := true
 	for idx := 1; idx < len(numberList); idx++ {
 		if last != numberList[idx] {
+			if numberList[idx] < last {
+				sorted = false
+			}
 			result = append(result, numberList[idx])
+			counts = append(counts, 0)
 		}
 		last = numberList[idx]
-		counts[last]++
+		counts[len(counts)-1]++
+	}
+
+	if !sorted {
+		totalRunCounts(result, counts)
 	}
 	return result, counts
 }
 
-func (a *analyzer) hostBeaconQuery(score float64, src data.UniqueIP, fqdn string) updateInfo {
-	ssn := a.db.Session.Copy()
-	defer ssn.Close()
-
-	var output updateInfo
-
-	// create query
-	query := bson.M{}
-
-	// check if we need to update
-	// we do this before the other queries because otherwise if a beacon
-	// starts out with a high score which reduces over time, it will keep
-	// the incorrect high max for that specific destination.
-	maxBeaconMatchExactQuery := src.BSONKey()
-	maxBeaconMatchExactQuery["dat.mbfqdn"] = fqdn
-
-	nExactMatches, err := ssn.DB(a.db.GetSelectedDB()).C(a.conf.T.Structure.HostTable).
-		Find(maxBeaconMatchExactQuery).Count()
-
-	if err != nil {
-		a.log.WithError(err).WithFields(log.Fields{
-			"src":              src.IP,
-			"src_network_name": src.NetworkName,
-			"fqdn":             fqdn,
-		}).Error(
-			"Could not check for existing max fqdn beacon in hosts collection. " +
-				"Refusing to update source's max fqdn beacon.",
-		)
-		return updateInfo{}
+//totalRunCounts replaces the length of each run with the total
+//count of its number across all of the runs
+func totalRunCounts(numbers []int64, counts []int64) {
+	//there are at most as many distinct numbers as runs
+	totals := make(map[int64]int64, len(numbers))
+	for i, number := range numbers {
+		totals[number] += counts[i]
 	}
-
-	// if we have exact matches, update to new score and return
-	if nExactMatches > 0 {
-		query["$set"] = bson.M{
-			"dat.$.max_beacon_fqdn_score": score,
-			"dat.$.mbfqdn":                fqdn,
-			"dat.$.cid":                   a.chunk,
-		}
-
-		// create selector for output
-		output.query = query
-
-		// using the same find query we created above will allow us to match and
-		// update the exact chunk we need to update
-		output.selector = maxBeaconMatchExactQuery
-
-		return output
+	for i, number := range numbers {
+		counts[i] = totals[number]
 	}
+}
 
-	// The below is only for cases where the ip is not currently listed as a max beacon
-	// for a source
-	// update max beacon score
-	newFlag := false
-	updateFlag := false
-
-	// this query will find any matching chunk that is reporting a lower
-	// max beacon score than the current one we are working with
-	maxBeaconMatchLowerQuery := src.BSONKey()
-	maxBeaconMatchLowerQuery["dat"] = bson.M{
+//hostBeaconQuery builds the updates which track the max beacon score for the source in
+//the hosts table. The given session is owned by the calling analysis thread. The hosts
+//table is only read to skip the updates when the source already holds a higher max fqdn
+//beacon for the chunk. The updates themselves don't depend on what was read, so updates
+//for the same source from concurrent analysis threads still converge on a single entry
+//per chunk holding the highest score.
+func (a *analyzer) hostBeaconQuery(ssn *mgo.Session, score float64, src data.UniqueIP, fqdn string) maxBeaconUpdate {
+	_, span := tracing.Start(a.ctx, "hostBeaconQuery")
+	defer span.End()
+
+	// the entry of the same fqdn is replaced even if the score went down, since
+	// otherwise a beacon which starts out with a high score that reduces over time would
+	// keep the incorrect high max. Any other higher scoring entry is left alone.
+	maxBeaconMatchUpperQuery := src.BSONKey()
+	maxBeaconMatchUpperQuery["dat"] = bson.M{
 		"$elemMatch": bson.M{
 			"cid":                   a.chunk,
-			"max_beacon_fqdn_score": bson.M{"$lte": score},
+			"max_beacon_fqdn_score": bson.M{"$gte": score},
+			"mbfqdn":                bson.M{"$ne": fqdn},
 		},
 	}
-	// find matching lower chunks
-	nLowerMatches, err := ssn.DB(a.db.GetSelectedDB()).C(a.conf.T.Structure.HostTable).
-		Find(maxBeaconMatchLowerQuery).Count()
+
+	nUpperMatches, err := a.countHosts(ssn, maxBeaconMatchUpperQuery)
 
 	if err != nil {
 		a.log.WithError(err).WithFields(log.Fields{
@@ -384,79 +454,82 @@ func (a *analyzer) hostBeaconQuery(score float64, src data.UniqueIP, fqdn string
 			"src_network_name": src.NetworkName,
 			"fqdn":             fqdn,
 		}).Error(
-			"Could not check for lower scoring max fqdn beacon in hosts collection. " +
+			"Could not check for higher scoring max fqdn beacon in hosts collection. " +
 				"Refusing to update source's max fqdn beacon.",
 		)
-		return updateInfo{}
+		return maxBeaconUpdate{}
 	}
 
-	// if no matching chunks are found, we will set the new flag
-	if nLowerMatches == 0 {
-
-		maxBeaconMatchUpperQuery := src.BSONKey()
-		maxBeaconMatchUpperQuery["dat"] = bson.M{
-			"$elemMatch": bson.M{
-				"cid":                   a.chunk,
-				"max_beacon_fqdn_score": bson.M{"$gte": score},
-			},
-		}
-
-		// find matching upper chunks
-		nUpperMatches, err := ssn.DB(a.db.GetSelectedDB()).C(a.conf.T.Structure.HostTable).
-			Find(maxBeaconMatchUpperQuery).Count()
-
-		if err != nil {
-			a.log.WithError(err).WithFields(log.Fields{
-				"src":              src.IP,
-				"src_network_name": src.NetworkName,
-				"fqdn":             fqdn,
-			}).Error(
-				"Could not check for higher scoring max fqdn beacon in hosts collection. " +
-					"Refusing to update source's max fqdn beacon.",
-			)
-			return updateInfo{}
-		}
-
-		// update if no upper chunks are found
-		if nUpperMatches == 0 {
-			newFlag = true
-		}
-	} else {
-		updateFlag = true
+	if nUpperMatches > 0 {
+		return maxBeaconUpdate{}
 	}
 
-	// since we didn't find any changeable lower max beacon scores, we will
-	// set the condition to push a new entry with the current score listed as the
-	// max beacon ONLY if no matching chunks reporting higher max beacon scores
-	// are found.
-
-	if newFlag {
-
-		query["$push"] = bson.M{
-			"dat": bson.M{
-				"max_beacon_fqdn_score": score,
-				"mbfqdn":                fqdn,
-				"cid":                   a.chunk,
-			}}
+	return a.maxBeaconUpdate(score, src, fqdn)
+}
 
-		// create selector for output
-		output.query = query
-		output.selector = src.BSONKey()
+//countHosts counts the hosts table entries which match the selector while tracking the
+//max fqdn beacons of a source. Lookups failing with transient errors are retried.
+func (a *analyzer) countHosts(ssn *mgo.Session, selector bson.M) (int, error) {
+	var count int
+	err := a.retrier.Do(a.ctx, ssn, func() error {
+		var err error
+		count, err = ssn.DB(a.db.GetSelectedDB()).C(a.conf.T.Structure.HostTable).Find(selector).Count()
+		return err
+	})
+	return count, err
+}
 
-	} else if updateFlag {
+//maxBeaconUpdate builds the conditional updates which record the fqdn as the max beacon
+//of the source for the current chunk
+func (a *analyzer) maxBeaconUpdate(score float64, src data.UniqueIP, fqdn string) maxBeaconUpdate {
+	var output maxBeaconUpdate
 
-		query["$set"] = bson.M{
-			"dat.$.max_beacon_fqdn_score": score,
-			"dat.$.mbfqdn":                fqdn,
-			"dat.$.cid":                   a.chunk,
-		}
+	// create the host record if it doesn't exist yet so the entry may be pushed onto it
+	output.host = updateInfo{
+		selector: src.BSONKey(),
+		query:    bson.M{"$setOnInsert": bson.M{"dat": []bson.M{}}},
+	}
 
-		// create selector for output
-		output.query = query
+	// push an entry only if the chunk doesn't have one yet. The condition is checked
+	// when the update is applied, so two updates can't both push an entry.
+	output.insert = updateInfo{
+		selector: src.BSONKey(),
+		query: bson.M{
+			"$push": bson.M{
+				"dat": bson.M{
+					"max_beacon_fqdn_score": score,
+					"mbfqdn":                fqdn,
+					"cid":                   a.chunk,
+				}}},
+	}
+	output.insert.selector["dat"] = bson.M{
+		"$not": bson.M{
+			"$elemMatch": bson.M{
+				"cid":                   a.chunk,
+				"max_beacon_fqdn_score": bson.M{"$exists": true},
+			},
+		},
+	}
 
-		// using the same find query we created above will allow us to match and
-		// update the exact chunk we need to update
-		output.selector = maxBeaconMatchLowerQuery
+	// replace the chunk's entry if it holds a lower score or the same fqdn
+	output.replace = updateInfo{
+		selector: src.BSONKey(),
+		query: bson.M{
+			"$set": bson.M{
+				"dat.$.max_beacon_fqdn_score": score,
+				"dat.$.mbfqdn":                fqdn,
+				"dat.$.cid":                   a.chunk,
+			},
+		},
+	}
+	output.replace.selector["dat"] = bson.M{
+		"$elemMatch": bson.M{
+			"cid": a.chunk,
+			"$or": []bson.M{
+				{"max_beacon_fqdn_score": bson.M{"$lt": score}},
+				{"mbfqdn": fqdn},
+			},
+		},
 	}
 
 	return output
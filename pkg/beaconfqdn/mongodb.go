@@ -1,8 +1,10 @@
 package beaconfqdn
 
 import (
+	"context"
 	"fmt"
 	"runtime"
+	"sync/atomic"
 	"time"
 
 	"github.com/activecm/rita/config"
@@ -16,19 +18,24 @@ import (
 	"github.com/globalsign/mgo/bson"
 	"github.com/vbauerster/mpb"
 	"github.com/vbauerster/mpb/decor"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 
 	log "github.com/sirupsen/logrus"
 )
 
 type repo struct {
+	ctx      context.Context
 	database *database.DB
 	config   *config.Config
 	log      *log.Logger
 }
 
-//NewMongoRepository create new repository
-func NewMongoRepository(db *database.DB, conf *config.Config, logger *log.Logger) Repository {
+//NewMongoRepository create new repository. The spans of the analysis are recorded
+//as children of the span held by ctx.
+func NewMongoRepository(ctx context.Context, db *database.DB, conf *config.Config, logger *log.Logger) Repository {
 	return &repo{
+		ctx:      ctx,
 		database: db,
 		config:   conf,
 		log:      logger,
@@ -87,15 +94,25 @@ func (r *repo) Upsert(hostMap map[string]*host.Input, minTimestamp, maxTimestamp
 		r.log,
 	)
 
+	// count the beacons written so they can be recorded by the trace
+	var beacons int64
+	writerCollect := func(data *update) {
+		if data.beacon.query != nil {
+			atomic.AddInt64(&beacons, 1)
+		}
+		writerWorker.collect(data)
+	}
+
 	// stage 4 - perform the analysis
 	analyzerWorker := newAnalyzer(
+		r.ctx,
 		minTimestamp,
 		maxTimestamp,
 		r.config.S.Rolling.CurrentChunk,
 		r.database,
 		r.config,
 		r.log,
-		writerWorker.collect,
+		writerCollect,
 		writerWorker.close,
 	)
 
@@ -190,6 +207,8 @@ func (r *repo) Upsert(hostMap map[string]*host.Input, minTimestamp, maxTimestamp
 
 	// start the closing cascade (this will also close the other channels)
 	dissectorWorker.close()
+
+	trace.SpanFromContext(r.ctx).SetAttributes(attribute.Int64("rita.beacons", atomic.LoadInt64(&beacons)))
 }
 
 // affectedHostnameIPs gathers all of the hostnames associated with the external IPs which generated
@@ -312,6 +331,7 @@ func (r *repo) affectedHostnameIPsChunked(hostMap map[string]*host.Input) ([]hos
 
 /*
 db.getCollection('hostnames').aggregate([
+
 	{"$match": { "$or": [
 		{
 			"dat.ips.ip": "104.16.107.25",
@@ -343,6 +363,7 @@ db.getCollection('hostnames').aggregate([
 			"network_uuid": "$_id.network_uuid",
 		}},
 	}}
+
 ])
 
 reverseDNSQueryWithIPs returns a MongoDB aggregation which returns the hostnames associated with the given
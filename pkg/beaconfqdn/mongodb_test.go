@@ -0,0 +1,103 @@
+// +build integration
+
+package beaconfqdn
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/activecm/rita/pkg/data"
+	"github.com/activecm/rita/resources"
+	"github.com/activecm/rita/util"
+	"github.com/globalsign/mgo/dbtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Server holds the dbtest DBServer
+var Server dbtest.DBServer
+
+// Set the test database
+var testTargetDB = "tmp_test_db"
+
+var testRes *resources.Resources
+
+// TestHostBeaconQueryConcurrent ensures concurrent analysis threads converge on a single
+// max fqdn beacon entry per chunk holding the highest score
+func TestHostBeaconQueryConcurrent(t *testing.T) {
+	testRes.DB.SelectDB(testTargetDB)
+	src := data.UniqueIP{IP: "10.0.0.11", NetworkUUID: util.UnknownPrivateNetworkUUID, NetworkName: util.UnknownPrivateNetworkName}
+	w := newWriter(testRes.Config.T.BeaconFQDN.BeaconFQDNTable, testRes.DB, testRes.Config, testRes.Log)
+
+	// many fqdn beacons from the same source are analyzed and written at once across two chunks
+	const beacons = 200
+	maxScores := make(map[int]float64)
+	var wg sync.WaitGroup
+	for i := 0; i < beacons; i++ {
+		chunk := i % 2
+		score := float64((i*37)%beacons) / beacons
+		if score > maxScores[chunk] {
+			maxScores[chunk] = score
+		}
+		fqdn := "beacon" + strconv.Itoa(i) + ".example.com"
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ssn := testRes.DB.Session.Copy()
+			defer ssn.Close()
+
+			a := newAnalyzer(context.Background(), 0, 86400, chunk, testRes.DB, testRes.Config, testRes.Log, func(*update) {}, func() {})
+			updates := a.hostBeaconQuery(ssn, score, src, fqdn)
+			if updates.insert.query != nil {
+				assert.Nil(t, w.updateMaxBeacon(ssn.DB(testTargetDB).C(testRes.Config.T.Structure.HostTable), updates))
+			}
+		}()
+	}
+	wg.Wait()
+
+	var host struct {
+		Dat []struct {
+			MaxBeaconFQDNScore *float64 `bson:"max_beacon_fqdn_score"`
+			CID                int      `bson:"cid"`
+		} `bson:"dat"`
+	}
+	ssn := testRes.DB.Session.Copy()
+	defer ssn.Close()
+	require.Nil(t, ssn.DB(testTargetDB).C(testRes.Config.T.Structure.HostTable).Find(src.BSONKey()).One(&host))
+
+	// every chunk holds exactly one entry with the highest score
+	found := make(map[int]float64)
+	for _, entry := range host.Dat {
+		if entry.MaxBeaconFQDNScore == nil {
+			continue
+		}
+		_, ok := found[entry.CID]
+		require.False(t, ok, "chunk %d holds more than one max fqdn beacon", entry.CID)
+		found[entry.CID] = *entry.MaxBeaconFQDNScore
+	}
+	require.Equal(t, maxScores, found)
+}
+
+// TestMain wraps all tests with the needed initialized mock DB and fixtures
+func TestMain(m *testing.M) {
+	// Store temporary databases files in a temporary directory
+	tempDir, _ := ioutil.TempDir("", "testing")
+	Server.SetPath(tempDir)
+
+	// Set the main session variable to the temporary MongoDB instance
+	testRes = resources.InitTestResources()
+
+	// Run the test suite
+	retCode := m.Run()
+
+	// Shut down the temporary server and removes data on disk.
+	Server.Stop()
+
+	// call with result of m.Run()
+	os.Exit(retCode)
+}
@@ -19,10 +19,19 @@ type (
 		query    bson.M
 	}
 
+	//maxBeaconUpdate holds the updates which record an fqdn beacon as the max fqdn beacon
+	//of its source. They are applied in order, and each one is conditioned on the state of
+	//the host record when it is applied rather than when the beacon was analyzed.
+	maxBeaconUpdate struct {
+		host    updateInfo // creates the host record if it doesn't exist
+		insert  updateInfo // adds an entry for the chunk if it doesn't have one
+		replace updateInfo // replaces the chunk's entry if it has a lower score or the same fqdn
+	}
+
 	//update ....
 	update struct {
 		beacon     updateInfo
-		hostBeacon updateInfo
+		hostBeacon maxBeaconUpdate
 	}
 
 	// hostnameIPs is used with reverseDNSQueryWithIPs() in order to read in records
@@ -77,6 +86,7 @@ type (
 		Ts             TSData          `bson:"ts"`
 		Ds             DSData          `bson:"ds"`
 		Score          float64         `bson:"score"`
+		ScoreBand      string          `bson:"score_band"`
 		ResolvedIPs    []data.UniqueIP `bson:"resolved_ips"`
 	}
 
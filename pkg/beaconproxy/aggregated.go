@@ -0,0 +1,140 @@
+package beaconproxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"sort"
+
+	"github.com/activecm/rita/pkg/data"
+	"github.com/activecm/rita/pkg/uconnproxy"
+	"github.com/activecm/rita/util"
+)
+
+type (
+	//AggregatedRecord is a src-fqdn pair aggregated outside of RITA. The fields match
+	//the ones written by Export. The network fields are optional.
+	AggregatedRecord struct {
+		Src              string    `json:"src"`
+		SrcNetworkName   string    `json:"src_network_name"`
+		SrcNetworkUUID   string    `json:"src_network_uuid"`
+		FQDN             string    `json:"fqdn"`
+		Proxy            string    `json:"proxy"`
+		ProxyNetworkName string    `json:"proxy_network_name"`
+		ProxyNetworkUUID string    `json:"proxy_network_uuid"`
+		Connections      int64     `json:"connection_count"`
+		TsList           []int64   `json:"tslist"`
+		DurList          []float64 `json:"durations"`
+		Strobe           bool      `json:"strobe"`
+	}
+
+	//AggregatedBatch holds the analysis entries read from aggregated records
+	AggregatedBatch struct {
+		Entries      []*uconnproxy.Input
+		MinTimestamp int64
+		MaxTimestamp int64
+		Skipped      int // records with too few unique timestamps to analyze
+	}
+)
+
+//ReadAggregated reads newline delimited JSON records into entries for AnalyzeAggregated.
+//Records which have more connections than connLimit or are marked as strobes are read
+//as strobes. Every other record must hold its timestamps, in the precision set by
+//BeaconProxy.TimestampPrecision. As with the logs, records with 3 or fewer unique
+//timestamps are skipped. Reading stops at the first invalid record.
+func ReadAggregated(r io.Reader, connLimit int64) (*AggregatedBatch, error) {
+	batch := &AggregatedBatch{
+		MinTimestamp: math.MaxInt64,
+		MaxTimestamp: math.MinInt64,
+	}
+
+	decoder := json.NewDecoder(r)
+	for recordNum := 1; ; recordNum++ {
+		var record AggregatedRecord
+		err := decoder.Decode(&record)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("record %d: %v", recordNum, err)
+		}
+
+		entry, err := record.input(connLimit)
+		if err != nil {
+			return nil, fmt.Errorf("record %d: %v", recordNum, err)
+		}
+
+		// strobes don't carry timestamps
+		if entry.TsList != nil {
+			if len(entry.TsList) <= 3 {
+				batch.Skipped++
+				continue
+			}
+			if entry.TsList[0] < batch.MinTimestamp {
+				batch.MinTimestamp = entry.TsList[0]
+			}
+			if last := entry.TsList[len(entry.TsList)-1]; last > batch.MaxTimestamp {
+				batch.MaxTimestamp = last
+			}
+		}
+
+		batch.Entries = append(batch.Entries, entry)
+	}
+
+	if batch.MinTimestamp > batch.MaxTimestamp {
+		batch.MinTimestamp, batch.MaxTimestamp = 0, 0
+	}
+	return batch, nil
+}
+
+//input validates the record and converts it into an analysis entry
+func (record AggregatedRecord) input(connLimit int64) (*uconnproxy.Input, error) {
+	srcIP := net.ParseIP(record.Src)
+	if srcIP == nil {
+		return nil, fmt.Errorf("src %q is not an IP address", record.Src)
+	}
+	if record.FQDN == "" {
+		return nil, fmt.Errorf("fqdn is required")
+	}
+	proxyIP := net.ParseIP(record.Proxy)
+	if proxyIP == nil {
+		return nil, fmt.Errorf("proxy %q is not an IP address", record.Proxy)
+	}
+	if record.Connections < 1 {
+		return nil, fmt.Errorf("connection_count must be positive")
+	}
+
+	src := data.NewUniqueIP(srcIP, record.SrcNetworkUUID, record.SrcNetworkName)
+	entry := &uconnproxy.Input{
+		Hosts: data.UniqueSrcFQDNPair{
+			UniqueSrcIP: src.AsSrc(),
+			FQDN:        record.FQDN,
+		},
+		Proxy:           data.NewUniqueIP(proxyIP, record.ProxyNetworkUUID, record.ProxyNetworkName),
+		ConnectionCount: record.Connections,
+	}
+
+	if record.Strobe || record.Connections > connLimit {
+		return entry, nil
+	}
+
+	if len(record.TsList) == 0 {
+		return nil, fmt.Errorf("tslist is required unless the record is a strobe")
+	}
+
+	// the analysis expects the unique timestamps of the pair in order
+	tsList := append([]int64(nil), record.TsList...)
+	sort.Sort(util.SortableInt64(tsList))
+	unique := tsList[:1]
+	for _, ts := range tsList[1:] {
+		if ts != unique[len(unique)-1] {
+			unique = append(unique, ts)
+		}
+	}
+
+	entry.TsList = unique
+	entry.DurList = record.DurList
+	return entry, nil
+}
@@ -0,0 +1,89 @@
+package beaconproxy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/activecm/rita/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadAggregated(t *testing.T) {
+	file, err := os.Open(filepath.Join("testdata", "aggregated.ndjson"))
+	require.Nil(t, err)
+	defer file.Close()
+
+	batch, err := ReadAggregated(file, 86400)
+	require.Nil(t, err)
+
+	// the pair with only 3 unique timestamps is skipped
+	require.Equal(t, 1, batch.Skipped)
+	require.Len(t, batch.Entries, 2)
+	require.Equal(t, int64(1234560), batch.MinTimestamp)
+	require.Equal(t, int64(1234560+23*60), batch.MaxTimestamp)
+
+	beacon := batch.Entries[0]
+	require.Equal(t, "10.0.9.1", beacon.Hosts.SrcIP)
+	require.Equal(t, util.UnknownPrivateNetworkUUID, beacon.Hosts.SrcNetworkUUID)
+	require.Equal(t, "beacon.example.com", beacon.Hosts.FQDN)
+	require.Equal(t, "10.0.0.100", beacon.Proxy.IP)
+	require.Equal(t, int64(24), beacon.ConnectionCount)
+	require.Len(t, beacon.TsList, 24)
+
+	strobe := batch.Entries[1]
+	require.Equal(t, "strobe.example.com", strobe.Hosts.FQDN)
+	require.Nil(t, strobe.TsList)
+}
+
+func TestReadAggregatedTimestamps(t *testing.T) {
+	input := `{"src": "10.0.0.1", "fqdn": "example.com", "proxy": "8.8.8.8", "connection_count": 6, "tslist": [300, 100, 200, 100, 400, 300]}`
+
+	batch, err := ReadAggregated(strings.NewReader(input), 86400)
+	require.Nil(t, err)
+	require.Len(t, batch.Entries, 1)
+
+	// the timestamps are sorted and deduplicated like the ones read from the logs
+	require.Equal(t, []int64{100, 200, 300, 400}, batch.Entries[0].TsList)
+	require.Equal(t, int64(6), batch.Entries[0].ConnectionCount)
+	require.Equal(t, util.PublicNetworkUUID, batch.Entries[0].Proxy.NetworkUUID)
+
+	// records over the connection limit are read as strobes
+	batch, err = ReadAggregated(strings.NewReader(input), 5)
+	require.Nil(t, err)
+	require.Nil(t, batch.Entries[0].TsList)
+}
+
+func TestReadAggregatedInvalid(t *testing.T) {
+	valid := `{"src": "10.0.0.1", "fqdn": "example.com", "proxy": "10.0.0.100", "connection_count": 4, "tslist": [1, 2, 3, 4]}`
+
+	testCases := []struct {
+		name   string
+		record string
+		err    string
+	}{
+		{"missing src", `{"fqdn": "example.com", "proxy": "10.0.0.100", "connection_count": 4, "tslist": [1, 2, 3, 4]}`, "src"},
+		{"invalid src", `{"src": "host", "fqdn": "example.com", "proxy": "10.0.0.100", "connection_count": 4, "tslist": [1, 2, 3, 4]}`, "src"},
+		{"missing fqdn", `{"src": "10.0.0.1", "proxy": "10.0.0.100", "connection_count": 4, "tslist": [1, 2, 3, 4]}`, "fqdn"},
+		{"missing proxy", `{"src": "10.0.0.1", "fqdn": "example.com", "connection_count": 4, "tslist": [1, 2, 3, 4]}`, "proxy"},
+		{"missing count", `{"src": "10.0.0.1", "fqdn": "example.com", "proxy": "10.0.0.100", "tslist": [1, 2, 3, 4]}`, "connection_count"},
+		{"missing tslist", `{"src": "10.0.0.1", "fqdn": "example.com", "proxy": "10.0.0.100", "connection_count": 4}`, "tslist"},
+		{"malformed", `{"src": "10.0.0.1",`, "record 2"},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ReadAggregated(strings.NewReader(valid+"\n"+test.record+"\n"), 86400)
+			require.NotNil(t, err)
+			require.Contains(t, err.Error(), "record 2")
+			require.Contains(t, err.Error(), test.err)
+		})
+	}
+
+	// strobes don't need timestamps
+	strobe := `{"src": "10.0.0.1", "fqdn": "example.com", "proxy": "10.0.0.100", "connection_count": 4, "strobe": true}`
+	batch, err := ReadAggregated(strings.NewReader(strobe), 86400)
+	require.Nil(t, err)
+	require.Len(t, batch.Entries, 1)
+}
@@ -1,46 +1,100 @@
 package beaconproxy
 
 import (
+	"context"
 	"math"
+	"runtime"
 	"sort"
-	"strconv"
 	"sync"
+	"time"
 
 	"github.com/activecm/rita/config"
 	"github.com/activecm/rita/database"
-	"github.com/activecm/rita/pkg/data"
+	"github.com/activecm/rita/metrics"
 	"github.com/activecm/rita/pkg/uconnproxy"
+	"github.com/activecm/rita/tracing"
 	"github.com/activecm/rita/util"
 
+	"github.com/globalsign/mgo"
 	"github.com/globalsign/mgo/bson"
 	log "github.com/sirupsen/logrus"
 )
 
+//lowConfidenceMaxScore is the highest score given to a proxy beacon with fewer distinct
+//delta times than BeaconProxy.MinDistinctIntervals
+const lowConfidenceMaxScore = 0.5
+
+//minUniqueTimestamps is the fewest unique timestamps a proxy beacon needs in order to be
+//scored, which leaves the scorer at least 3 delta times
+const minUniqueTimestamps = 4
+
+//hostQueryBackoff is the wait before retrying a hosts table lookup which failed with a
+//transient error. The wait doubles after every further failed attempt.
+const hostQueryBackoff = 100 * time.Millisecond
+
 type (
+	//deltaBuffer holds the delta times of the entry being scored by an analysis thread.
+	//The buffer is reused across entries so each entry doesn't allocate its own.
+	deltaBuffer struct {
+		diff []int64
+	}
+
+	//tsStats holds the statistics of the delta times which are stored for human analysis
+	tsStats struct {
+		tsRange        int64   // range of the delta times
+		intervals      []int64 // distinct delta times in ascending order
+		intervalCounts []int64 // number of times each distinct delta time was found
+		mode           int64   // most occurring delta time
+		modeCount      int64   // number of times the mode was found
+	}
+
 	analyzer struct {
-		tsMin            int64                  // min timestamp for the whole dataset
-		tsMax            int64                  // max timestamp for the whole dataset
-		chunk            int                    //current chunk (0 if not on rolling analysis)
-		chunkStr         string                 //current chunk (0 if not on rolling analysis)
-		db               *database.DB           // provides access to MongoDB
-		conf             *config.Config         // contains details needed to access MongoDB
-		log              *log.Logger            // main logger for RITA
-		analyzedCallback func(*update)          // called on each analyzed result
-		closedCallback   func()                 // called when .close() is called and no more calls to analyzedCallback will be made
-		analysisChannel  chan *uconnproxy.Input // holds unanalyzed data
-		analysisWg       sync.WaitGroup         // wait for analysis to finish
+		ctx              context.Context              // stops the analysis once cancelled, holds the span the analysis is traced under
+		tsMin            int64                        // min timestamp for the whole dataset
+		tsMax            int64                        // max timestamp for the whole dataset
+		chunk            int                          //current chunk (0 if not on rolling analysis)
+		threads          int                          // number of analysis threads spawned by start
+		scorer           ProxyScorer                  // computes the score of each proxy beacon
+		filter           func(*uconnproxy.Input) bool // if set, only the entries it matches are analyzed
+		allowlist        []string                     // FQDNs, possibly wildcards, which are never analyzed
+		db               *database.DB                 // provides access to MongoDB
+		retrier          *database.Retrier            // retries the hosts table lookups which fail with transient errors
+		conf             *config.Config               // contains details needed to access MongoDB
+		log              *log.Logger                  // main logger for RITA
+		analyzedCallback func(*update)                // called on each analyzed result
+		closedCallback   func()                       // called when .close() is called and no more calls to analyzedCallback will be made
+		analysisChannel  chan *uconnproxy.Input       // holds unanalyzed data
+		analysisWg       sync.WaitGroup               // wait for analysis to finish
 	}
 )
 
-//newAnalyzer creates a new collector for gathering data //
-func newAnalyzer(min int64, max int64, chunk int, db *database.DB, conf *config.Config, log *log.Logger,
-	analyzedCallback func(*update), closedCallback func()) *analyzer {
+//newAnalyzer creates a new collector for gathering data. The database lookups are
+//traced as children of the span held by ctx. Once ctx is cancelled, the analysis
+//threads exit without analyzing the remaining data.
+func newAnalyzer(ctx context.Context, min int64, max int64, chunk int, db *database.DB, conf *config.Config, log *log.Logger,
+	scorer ProxyScorer, analyzedCallback func(*update), closedCallback func()) *analyzer {
+
+	// use the default scoring algorithm if an alternative isn't provided
+	if scorer == nil {
+		scorer = NewDefaultProxyScorer(conf)
+	}
+
+	// default to half of the available cores if the thread count isn't configured
+	threads := conf.S.BeaconProxy.AnalysisThreads
+	if threads < 1 {
+		threads = util.Max(1, runtime.NumCPU()/2)
+	}
+
 	return &analyzer{
+		ctx:              ctx,
 		tsMin:            min,
 		tsMax:            max,
 		chunk:            chunk,
-		chunkStr:         strconv.Itoa(chunk),
+		threads:          threads,
+		scorer:           scorer,
+		allowlist:        conf.S.BeaconProxy.FQDNAllowlist,
 		db:               db,
+		retrier:          database.NewRetrier(conf.S.BeaconProxy.HostQueryMaxAttempts, hostQueryBackoff),
 		conf:             conf,
 		log:              log,
 		analyzedCallback: analyzedCallback,
@@ -49,357 +103,561 @@ func newAnalyzer(min int64, max int64, chunk int, db *database.DB, conf *config.
 	}
 }
 
-//collect sends a chunk of data to be analyzed
+//collect sends a chunk of data to be analyzed. The data is dropped if the analysis
+//has been cancelled.
 func (a *analyzer) collect(data *uconnproxy.Input) {
-	a.analysisChannel <- data
+	select {
+	case a.analysisChannel <- data:
+	case <-a.ctx.Done():
+		// the spilled timestamps are removed from disk even if they aren't analyzed
+		if data.TsSpill != nil {
+			data.TsSpill.Close()
+		}
+	}
+}
+
+//next waits for the next chunk of data to analyze. Returns false once the
+//collector is closed or the analysis has been cancelled.
+func (a *analyzer) next() (*uconnproxy.Input, bool) {
+	if a.ctx.Err() != nil {
+		return nil, false
+	}
+
+	select {
+	case data, ok := <-a.analysisChannel:
+		return data, ok
+	case <-a.ctx.Done():
+		return nil, false
+	}
 }
 
-//close waits for the collector to finish
+//close waits for the collector to finish. If the analysis has been cancelled, the
+//analysis threads only finish the entry they are working on.
 func (a *analyzer) close() {
 	close(a.analysisChannel)
 	a.analysisWg.Wait()
 	a.closedCallback()
 }
 
-//start kicks off a new analysis thread
+//start kicks off the analysis threads. Every thread drains the same analysis
+//channel using its own copy of the database session, so analyzedCallback may be
+//called concurrently and must be safe for concurrent use (the writer's collect
+//method only sends on a channel, which is).
 func (a *analyzer) start() {
-	a.analysisWg.Add(1)
-	go func() {
-
-		for entry := range a.analysisChannel {
-
-			// set up beacon writer output
-			output := &update{}
-
-			// if uconnproxy has turned into a strobe, we will not have any timestamps here,
-			// and we need to update uconnproxy table with the strobe flag. This is being done
-			// here and not in uconnproxy because uconnproxy doesn't do reads, and doesn't know
-			// the updated conn count
-			if (entry.TsList) == nil {
-
-				output.uconnproxy = updateInfo{
-					// update hosts record
-					query: bson.M{
-						"$set": bson.M{"strobeFQDN": true},
-					},
-					// create selector for output
-					selector: entry.Hosts.BSONKey(),
-				}
-
-				// set to writer channel
-				a.analyzedCallback(output)
-
-			} else {
-
-				// create selector pair object
-				selectorPair := entry.Hosts.BSONKey()
-
-				// create query
-				query := bson.M{}
-
-				//store the diff slice length since we use it a lot
-				//for timestamps this is one less then the data slice length
-				//since we are calculating the times in between readings
-				tsLength := len(entry.TsList) - 1
-
-				//find the delta times between the timestamps
-				diff := make([]int64, tsLength)
-				for i := 0; i < tsLength; i++ {
-					diff[i] = entry.TsList[i+1] - entry.TsList[i]
-				}
-
-				//perfect beacons should have symmetric delta time and size distributions
-				//Bowley's measure of skew is used to check symmetry
-				sort.Sort(util.SortableInt64(diff))
-				tsSkew := float64(0)
-
-				//tsLength -1 is used since diff is a zero based slice
-				tsLow := diff[util.Round(.25*float64(tsLength-1))]
-				tsMid := diff[util.Round(.5*float64(tsLength-1))]
-				tsHigh := diff[util.Round(.75*float64(tsLength-1))]
-				tsBowleyNum := tsLow + tsHigh - 2*tsMid
-				tsBowleyDen := tsHigh - tsLow
-
-				//tsSkew should equal zero if the denominator equals zero
-				//bowley skew is unreliable if Q2 = Q1 or Q2 = Q3
-				if tsBowleyDen != 0 && tsMid != tsLow && tsMid != tsHigh {
-					tsSkew = float64(tsBowleyNum) / float64(tsBowleyDen)
-				}
-
-				//perfect beacons should have very low dispersion around the
-				//median of their delta times
-				//Median Absolute Deviation About the Median
-				//is used to check dispersion
-				devs := make([]int64, tsLength)
-				for i := 0; i < tsLength; i++ {
-					devs[i] = util.Abs(diff[i] - tsMid)
-				}
-
-				sort.Sort(util.SortableInt64(devs))
-
-				tsMadm := devs[util.Round(.5*float64(tsLength-1))]
-
-				//Store the range for human analysis
-				tsIntervalRange := diff[tsLength-1] - diff[0]
-
-				//get a list of the intervals found in the data,
-				//the number of times the interval was found,
-				//and the most occurring interval
-				intervals, intervalCounts, tsMode, tsModeCount := createCountMap(diff)
-
-				//more skewed distributions receive a lower score
-				//less skewed distributions receive a higher score
-				tsSkewScore := 1.0 - math.Abs(tsSkew) //smush tsSkew
-
-				//lower dispersion is better, cutoff dispersion scores at 30 seconds
-				tsMadmScore := 1.0 - float64(tsMadm)/30.0
-				if tsMadmScore < 0 {
-					tsMadmScore = 0
-				}
-
-				// connection count scoring
-				tsConnDiv := (float64(a.tsMax) - float64(a.tsMin)) / 10.0
-				tsConnCountScore := float64(entry.ConnectionCount) / tsConnDiv
-				if tsConnCountScore > 1.0 {
-					tsConnCountScore = 1.0
-				}
-
-				//score numerators
-				tsSum := tsSkewScore + tsMadmScore + tsConnCountScore
-
-				//score averages
-				tsScore := math.Ceil((tsSum/3.0)*1000) / 1000
-				score := math.Ceil((tsSum/3.0)*1000) / 1000
-
-				// update beacon query
-				query["$set"] = bson.M{
-					"connection_count":   entry.ConnectionCount,
-					"proxy":              entry.Proxy,
-					"src_network_name":   entry.Hosts.SrcNetworkName,
-					"ts.range":           tsIntervalRange,
-					"ts.mode":            tsMode,
-					"ts.mode_count":      tsModeCount,
-					"ts.intervals":       intervals,
-					"ts.interval_counts": intervalCounts,
-					"ts.dispersion":      tsMadm,
-					"ts.skew":            tsSkew,
-					"ts.conns_score":     tsConnCountScore,
-					"ts.score":           tsScore,
-					"tslist":             entry.TsList,
-					"score":              score,
-					"cid":                a.chunk,
-					"strobeFQDN":         false,
-				}
-
-				// set query
-				output.beacon.query = query
-
-				// create selector for output
-				output.beacon.selector = selectorPair
-
-				// updates max beacon proxy score for the source entry in the hosts table
-				output.hostBeacon = a.hostBeaconQuery(score, entry.Hosts.UniqueSrcIP.Unpair(), entry.Hosts.FQDN)
-
-				// set to writer channel
-				a.analyzedCallback(output)
+	for i := 0; i < a.threads; i++ {
+		a.analysisWg.Add(1)
+		go a.analyze()
+	}
+}
+
+//analyze scores the entries sent to the analysis channel until it is closed or the
+//analysis is cancelled
+func (a *analyzer) analyze() {
+	ssn := a.db.Session.Copy()
+	defer ssn.Close()
+
+	// the scratch space for scoring is owned by this thread
+	buffer := &deltaBuffer{}
+
+	for entry, ok := a.next(); ok; entry, ok = a.next() {
+		a.analyzeEntry(ssn, buffer, entry)
+	}
+
+	a.analysisWg.Done()
+}
+
+//analyzeEntry scores a single entry and sends the results to the writer
+func (a *analyzer) analyzeEntry(ssn *mgo.Session, buffer *deltaBuffer, entry *uconnproxy.Input) {
+	// the spilled timestamps are removed from disk no matter how the entry is handled
+	if entry.TsSpill != nil {
+		defer entry.TsSpill.Close()
+	}
+
+	// skip the entries outside of the analysis target before doing any work
+	if a.filter != nil && !a.filter(entry) {
+		return
+	}
+
+	// legitimate destinations are kept out of the results
+	if a.allowlisted(entry.Hosts.FQDN) {
+		return
+	}
+
+	metrics.BeaconProxyAnalyzed.Inc()
+
+	// set up beacon writer output
+	output := &update{}
+
+	// if uconnproxy has turned into a strobe, we will not have any timestamps here,
+	// and we need to update uconnproxy table with the strobe flag. This is being done
+	// here and not in uconnproxy because uconnproxy doesn't do reads, and doesn't know
+	// the updated conn count
+	if entry.TsList == nil && entry.TsSpill == nil {
+
+		output.uconnproxy = strobeUpdate(entry)
+
+		// set to writer channel
+		a.analyzedCallback(output)
+
+	} else if uniqueTs := uniqueTimestamps(entry); uniqueTs < minUniqueTimestamps {
+
+		// the dissector only passes along proxy beacons with enough unique timestamps
+		// to score, but the scorer relies on it, so the entry is dropped rather than
+		// risking a panic
+		a.log.WithFields(log.Fields{
+			"src":        entry.Hosts.SrcIP,
+			"fqdn":       entry.Hosts.FQDN,
+			"timestamps": uniqueTs,
+		}).Debug("Skipping proxy beacon with too few unique timestamps to score")
+		return
+
+	} else if entry.ConnectionCount < int64(a.conf.S.BeaconProxy.DefaultConnectionThresh) {
+
+		// the skew and dispersion of a handful of connections are meaningless,
+		// so entries below the connection threshold are dropped before any of
+		// the scoring work is done
+		return
+
+	} else if a.rateStrobe(entry) {
+
+		// a burst of connections is flagged the same way as a pair over the
+		// connection limit without scoring it
+		output.uconnproxy = strobeUpdate(entry)
+
+		// set to writer channel
+		a.analyzedCallback(output)
+
+	} else {
+
+		// score the timestamps and build the beacon query
+		var query bson.M
+		var score float64
+		if entry.TsSpill != nil {
+			var err error
+			query, score, err = a.spilledBeaconQuery(entry)
+			if err != nil {
+				a.log.WithError(err).WithFields(log.Fields{
+					"src":  entry.Hosts.SrcIP,
+					"fqdn": entry.Hosts.FQDN,
+				}).Error("Could not score the proxy beacon's spilled timestamps")
+				return
 			}
+		} else {
+			query, score = a.beaconQuery(entry, buffer)
 		}
 
-		a.analysisWg.Done()
-	}()
-}
+		// set query
+		output.beacon.query = query
+		output.score = score
 
-// createCountMap returns a distinct data array, data count array, the mode,
-// and the number of times the mode occurred
-func createCountMap(sortedIn []int64) ([]int64, []int64, int64, int64) {
-	//Since the data is already sorted, we can call this without fear
-	distinct, countsMap := countAndRemoveConsecutiveDuplicates(sortedIn)
-	countsArr := make([]int64, len(distinct))
-	mode := distinct[0]
-	max := countsMap[mode]
-	for i, datum := range distinct {
-		count := countsMap[datum]
-		countsArr[i] = count
-		if count > max {
-			max = count
-			mode = datum
+		// create selector for output
+		output.beacon.selector = entry.Hosts.BSONKey()
+
+		// updates max beacon proxy score for the source entry in the hosts table.
+		// Sources aggregated into subnets are tracked in an entry for the subnet.
+		hostKey := entry.Hosts.UniqueSrcIP.Unpair().BSONKey()
+		if entry.SrcSubnet != nil {
+			hostKey = entry.SrcSubnet.BSONKey()
+		}
+		// the hosts table lookups are skipped once the analysis is cancelled
+		if a.ctx.Err() != nil {
+			return
+		}
+		output.hostBeacon = a.hostBeaconQuery(ssn, score, hostKey, entry.Hosts.FQDN)
+
+		// the beacon and its hosts table updates are written together or not at all,
+		// so a result whose lookups were cut short by a cancellation is dropped
+		if a.ctx.Err() != nil {
+			return
 		}
+
+		// set to writer channel
+		a.analyzedCallback(output)
 	}
-	return distinct, countsArr, mode, max
+
 }
 
-//countAndRemoveConsecutiveDuplicates removes consecutive
-//duplicates in an array of integers and counts how many
-//instances of each number exist in the array.
-//Similar to `uniq -c`, but counts all duplicates, not just
-//consecutive duplicates.
-func countAndRemoveConsecutiveDuplicates(numberList []int64) ([]int64, map[int64]int64) {
-	//Avoid some reallocations
-	result := make([]int64, 0, len(numberList)/2)
-	counts := make(map[int64]int64)
-
-	last := numberList[0]
-	result = append(result, last)
-	counts[last]++
-
-	for idx := 1; idx < len(numberList); idx++ {
-		if last != numberList[idx] {
-			result = append(result, numberList[idx])
-		}
-		last = numberList[idx]
-		counts[last]++
+//strobeUpdate builds the update which flags the uconnproxy entry as a strobe
+func strobeUpdate(entry *uconnproxy.Input) updateInfo {
+	return updateInfo{
+		// update uconnproxy record
+		query: bson.M{
+			"$set": bson.M{"strobeFQDN": true},
+		},
+		// create selector for output
+		selector: entry.Hosts.BSONKey(),
 	}
-	return result, counts
 }
 
-func (a *analyzer) hostBeaconQuery(score float64, src data.UniqueIP, fqdn string) updateInfo {
-	ssn := a.db.Session.Copy()
-	defer ssn.Close()
+//rateStrobe checks whether the connections of an entry were made faster than
+//BeaconProxy.StrobeRate connections per second over the span of its timestamps.
+//Connections made within a single timestamp unit are measured over that unit.
+func (a *analyzer) rateStrobe(entry *uconnproxy.Input) bool {
+	threshold := a.conf.S.BeaconProxy.StrobeRate
+	if threshold <= 0 || len(entry.TsList) == 0 {
+		return false
+	}
+
+	tsUnits := float64(util.TimestampUnitsPerSecond(a.conf.S.BeaconProxy.TimestampPrecision))
+	span := math.Max(float64(maxInt64(entry.TsList)-minInt64(entry.TsList)), 1) / tsUnits
+	return float64(entry.ConnectionCount)/span > threshold
+}
+
+//uniqueTimestamps returns the number of unique timestamps held by an entry, whether they
+//are held in memory or spilled to disk
+func uniqueTimestamps(entry *uconnproxy.Input) int64 {
+	if entry.TsSpill != nil {
+		return entry.TsSpill.Len()
+	}
+	return int64(len(entry.TsList))
+}
+
+//deltaTimes returns the delta times between the timestamps. The timestamps are
+//assumed to be sorted, unique, and valid, since the parser drops the timestamps which
+//failed to parse. The returned slice is only valid until the next call.
+func (b *deltaBuffer) deltaTimes(tsList []int64) []int64 {
+	//for timestamps this is one less then the data slice length
+	//since we are calculating the times in between readings
+	tsLength := len(tsList) - 1
+
+	if cap(b.diff) < tsLength {
+		b.diff = make([]int64, tsLength)
+	}
+	diff := b.diff[:tsLength]
+	for i := 0; i < tsLength; i++ {
+		diff[i] = tsList[i+1] - tsList[i]
+	}
+	return diff
+}
+
+//beaconQuery scores the timestamps of an entry which has not turned into a strobe.
+//The delta times are computed in the given buffer. It returns the beacon update query
+//along with the overall score.
+func (a *analyzer) beaconQuery(entry *uconnproxy.Input, buffer *deltaBuffer) (bson.M, float64) {
+	//the delta times must follow the chronological order of the timestamps
+	a.ensureSorted(entry)
+
+	//find the delta times between the timestamps
+	diff := buffer.deltaTimes(entry.TsList)
+
+	//Store the range for human analysis
+	stats := tsStats{tsRange: maxInt64(diff) - minInt64(diff)}
+
+	//get a list of the intervals found in the data,
+	//the number of times the interval was found,
+	//and the most occurring interval
+	stats.intervals, stats.intervalCounts, stats.mode, stats.modeCount = createCountMap(diff)
+
+	//score the delta times, the scorer receives them in chronological order.
+	//The scorer may reuse diff as scratch space, so it is scored last.
+	proxyScore := a.scorer.Score(diff, int(entry.ConnectionCount), a.tsMin, a.tsMax)
 
-	var output updateInfo
+	return a.beaconUpdate(entry, stats, proxyScore)
+}
+
+//ensureSorted sorts the timestamps of an entry if they are out of order. The sorter
+//already sorts the timestamps, so out of order timestamps point to a bug upstream and
+//are logged.
+func (a *analyzer) ensureSorted(entry *uconnproxy.Input) {
+	if sort.IsSorted(util.SortableInt64(entry.TsList)) {
+		return
+	}
+
+	a.log.WithFields(log.Fields{
+		"src":        entry.Hosts.SrcIP,
+		"fqdn":       entry.Hosts.FQDN,
+		"timestamps": len(entry.TsList),
+	}).Warn("Sorting out of order proxy beacon timestamps before analysis")
+	sort.Sort(util.SortableInt64(entry.TsList))
+}
+
+//beaconUpdate builds the beacon update query from the statistics and score of the
+//delta times. It returns the query along with the overall score.
+func (a *analyzer) beaconUpdate(entry *uconnproxy.Input, stats tsStats, proxyScore ProxyScore) (bson.M, float64) {
+	// a handful of distinct delta times can't tell a beacon apart from a burst of
+	// connections, so the scores of these proxy beacons are capped
+	lowConfidence := len(stats.intervals) < a.conf.S.BeaconProxy.MinDistinctIntervals
+	if lowConfidence {
+		proxyScore.TsScore = math.Min(proxyScore.TsScore, lowConfidenceMaxScore)
+		proxyScore.Score = math.Min(proxyScore.Score, lowConfidenceMaxScore)
+	}
 
 	// create query
 	query := bson.M{}
+	bands := a.conf.S.ScoreBands
+
+	// update beacon query
+	query["$set"] = bson.M{
+		"connection_count":    entry.ConnectionCount,
+		"proxy":               entry.Proxy,
+		"src_network_name":    entry.Hosts.SrcNetworkName,
+		"ts.range":            stats.tsRange,
+		"ts.mode":             stats.mode,
+		"ts.mode_count":       stats.modeCount,
+		"ts.intervals":        stats.intervals,
+		"ts.interval_counts":  stats.intervalCounts,
+		"ts.dispersion":       proxyScore.Dispersion,
+		"ts.skew":             proxyScore.Skew,
+		"ts.skew_score":       proxyScore.SkewScore,
+		"ts.dispersion_score": proxyScore.DispersionScore,
+		"ts.conns_score":      proxyScore.ConnsScore,
+		"ts.score":            proxyScore.TsScore,
+		"tslist":              storedTsList(entry.TsList, a.conf.S.BeaconProxy.TsListLimit),
+		"tslist_count":        uniqueTimestamps(entry),
+		"low_confidence":      lowConfidence,
+		"cid":                 a.chunk,
+		"strobeFQDN":          false,
+	}
 
-	// check if we need to update
-	// we do this before the other queries because otherwise if a beacon
-	// starts out with a high score which reduces over time, it will keep
-	// the incorrect high max for that specific destination.
-	maxBeaconMatchExactQuery := src.BSONKey()
-	maxBeaconMatchExactQuery["dat.mbproxy"] = fqdn
+	if proxyScore.AutocorrScore != nil {
+		query["$set"].(bson.M)["ts.autocorr_score"] = *proxyScore.AutocorrScore
+	}
+	if proxyScore.DriftScore != nil {
+		query["$set"].(bson.M)["ts.drift_slope"] = *proxyScore.DriftSlope
+		query["$set"].(bson.M)["ts.drift_score"] = *proxyScore.DriftScore
+	}
 
-	nExactMatches, err := ssn.DB(a.db.GetSelectedDB()).C(a.conf.T.Structure.HostTable).
-		Find(maxBeaconMatchExactQuery).Count()
+	score := proxyScore.Score
 
-	if err != nil {
-		a.log.WithError(err).WithFields(log.Fields{
-			"src":              src.IP,
-			"src_network_name": src.NetworkName,
-			"fqdn":             fqdn,
-		}).Error(
-			"Could not check for existing max proxy beacon in hosts collection. " +
-				"Refusing to update source's max proxy beacon.",
-		)
-		return updateInfo{}
-	}
+	//blend in the duration regularity if enabled and enough durations were recorded
+	if a.conf.S.BeaconProxy.DurationEnabled {
+		rounding := newScoreRounding(a.conf)
+		durSkew, durMadm, durScore, ok := durationRegularity(entry.DurList, rounding)
+		if ok {
+			score = rounding.round((score + durScore) / 2.0)
+			if lowConfidence {
+				score = math.Min(score, lowConfidenceMaxScore)
+			}
 
-	// if we have exact matches, update to new score and return
-	if nExactMatches > 0 {
-		query["$set"] = bson.M{
-			"dat.$.max_beacon_proxy_score": score,
-			"dat.$.mbproxy":                fqdn,
-			"dat.$.cid":                    a.chunk,
+			query["$set"].(bson.M)["dur.skew"] = durSkew
+			query["$set"].(bson.M)["dur.dispersion"] = durMadm
+			query["$set"].(bson.M)["dur.score"] = durScore
 		}
+	}
 
-		// create selector for output
-		output.query = query
+	// the band is assigned from the final score so it agrees with the stored score
+	query["$set"].(bson.M)["score"] = score
+	query["$set"].(bson.M)["score_band"] = util.ScoreBand(score, bands.Medium, bands.High, bands.Critical)
+
+	return query, score
+}
 
-		// using the same find query we created above will allow us to match and
-		// update the exact chunk we need to update
-		output.selector = maxBeaconMatchExactQuery
+//storedTsList returns the timestamps stored in a proxy beacon document. A positive limit keeps
+//the first and last limit timestamps, a negative limit keeps none, and 0 keeps all of them.
+func storedTsList(tsList []int64, limit int) []int64 {
+	if limit == 0 || len(tsList) <= 2*limit {
+		return tsList
+	}
+	if limit < 0 {
+		return []int64{}
+	}
+
+	stored := make([]int64, 0, 2*limit)
+	stored = append(stored, tsList[:limit]...)
+	return append(stored, tsList[len(tsList)-limit:]...)
+}
+
+//distinctRatio is the expected number of delta times per distinct delta time, which
+//is used to presize the results of createCountMap
+const distinctRatio = 16
 
-		return output
+//alignedCounts sorts distinct values along with the count at the same index
+type alignedCounts struct {
+	values []int64
+	counts []int64
+}
+
+func (c alignedCounts) Len() int           { return len(c.values) }
+func (c alignedCounts) Less(i, j int) bool { return c.values[i] < c.values[j] }
+func (c alignedCounts) Swap(i, j int) {
+	c.values[i], c.values[j] = c.values[j], c.values[i]
+	c.counts[i], c.counts[j] = c.counts[j], c.counts[i]
+}
+
+// createCountMap returns a distinct data array in ascending order, data count array,
+// the mode, and the number of times the mode occurred. Ties for the mode are won by the
+// smallest interval. The data doesn't need to be sorted, only the distinct values are,
+// and beacons tend to repeat a small number of intervals. The counts are gathered in a
+// single pass alongside the distinct values, so they're sorted together without looking
+// them up again.
+func createCountMap(data []int64) ([]int64, []int64, int64, int64) {
+	//there is no mode without any data
+	if len(data) == 0 {
+		return nil, nil, 0, 0
 	}
 
-	// The below is only for cases where the ip is not currently listed as a max beacon
-	// for a source
-	// update max beacon score
-	newFlag := false
-	updateFlag := false
+	distinctEstimate := len(data)/distinctRatio + 1
+	indexes := make(map[int64]int, distinctEstimate)
+	distinct := make([]int64, 0, distinctEstimate)
+	countsArr := make([]int64, 0, distinctEstimate)
+	for _, datum := range data {
+		if i, ok := indexes[datum]; ok {
+			countsArr[i]++
+			continue
+		}
+		indexes[datum] = len(distinct)
+		distinct = append(distinct, datum)
+		countsArr = append(countsArr, 1)
+	}
+	sort.Sort(alignedCounts{values: distinct, counts: countsArr})
 
-	// this query will find any matching chunk that is reporting a lower
-	// max beacon score than the current one we are working with
-	maxBeaconMatchLowerQuery := src.BSONKey()
-	maxBeaconMatchLowerQuery["dat"] = bson.M{
+	mode := distinct[0]
+	max := countsArr[0]
+	for i, count := range countsArr {
+		if count > max {
+			max = count
+			mode = distinct[i]
+		}
+	}
+	return distinct, countsArr, mode, max
+}
+
+//minInt64 returns the smallest value in a non-empty slice
+func minInt64(data []int64) int64 {
+	min := data[0]
+	for _, datum := range data[1:] {
+		if datum < min {
+			min = datum
+		}
+	}
+	return min
+}
+
+//maxInt64 returns the largest value in a non-empty slice
+func maxInt64(data []int64) int64 {
+	max := data[0]
+	for _, datum := range data[1:] {
+		if datum > max {
+			max = datum
+		}
+	}
+	return max
+}
+
+//hostBeaconQuery builds the updates which track the max proxy beacon score for the
+//source in the hosts table. The source's entry is selected by hostKey, which is
+//either a UniqueIP's or a Subnet's BSONKey. The given session is owned by the calling
+//analysis thread. The hosts table is only read to skip the updates when the source
+//already holds a higher max proxy beacon for the chunk. The updates themselves don't
+//depend on what was read, so updates for the same source from concurrent analysis
+//threads still converge on a single entry per chunk holding the highest score.
+func (a *analyzer) hostBeaconQuery(ssn *mgo.Session, score float64, hostKey bson.M, fqdn string) maxBeaconUpdate {
+	_, span := tracing.Start(a.ctx, "hostBeaconQuery")
+	defer span.End()
+
+	// the entry of the same fqdn is replaced even if the score went down, since
+	// otherwise a beacon which starts out with a high score that reduces over time would
+	// keep the incorrect high max. Any other higher scoring entry is left alone.
+	maxBeaconMatchUpperQuery := copySelector(hostKey)
+	maxBeaconMatchUpperQuery["dat"] = bson.M{
 		"$elemMatch": bson.M{
 			"cid":                    a.chunk,
-			"max_beacon_proxy_score": bson.M{"$lte": score},
+			"max_beacon_proxy_score": bson.M{"$gte": score},
+			"mbproxy":                bson.M{"$ne": fqdn},
 		},
 	}
-	// find matching lower chunks
-	nLowerMatches, err := ssn.DB(a.db.GetSelectedDB()).C(a.conf.T.Structure.HostTable).
-		Find(maxBeaconMatchLowerQuery).Count()
+
+	nUpperMatches, err := a.countHosts(ssn, maxBeaconMatchUpperQuery)
 
 	if err != nil {
 		a.log.WithError(err).WithFields(log.Fields{
-			"src":              src.IP,
-			"src_network_name": src.NetworkName,
-			"fqdn":             fqdn,
+			"src":  hostKey,
+			"fqdn": fqdn,
 		}).Error(
-			"Could not check for lower scoring max proxy beacon in hosts collection. " +
+			"Could not check for higher scoring max proxy beacon in hosts collection. " +
 				"Refusing to update source's max proxy beacon.",
 		)
-		return updateInfo{}
+		return maxBeaconUpdate{}
 	}
 
-	// if no matching chunks are found, we will set the new flag
-	if nLowerMatches == 0 {
-
-		maxBeaconMatchUpperQuery := src.BSONKey()
-		maxBeaconMatchUpperQuery["dat"] = bson.M{
-			"$elemMatch": bson.M{
-				"cid":                    a.chunk,
-				"max_beacon_proxy_score": bson.M{"$gte": score},
-			},
-		}
+	if nUpperMatches > 0 {
+		return maxBeaconUpdate{}
+	}
 
-		// find matching upper chunks
-		nUpperMatches, err := ssn.DB(a.db.GetSelectedDB()).C(a.conf.T.Structure.HostTable).
-			Find(maxBeaconMatchUpperQuery).Count()
-
-		if err != nil {
-			a.log.WithError(err).WithFields(log.Fields{
-				"src":              src.IP,
-				"src_network_name": src.NetworkName,
-				"fqdn":             fqdn,
-			}).Error(
-				"Could not check for higher scoring max proxy beacon in hosts collection. " +
-					"Refusing to update source's max proxy beacon.",
-			)
-			return updateInfo{}
-		}
+	return a.maxBeaconUpdate(score, hostKey, fqdn)
+}
 
-		// update if no upper chunks are found
-		if nUpperMatches == 0 {
-			newFlag = true
-		}
-	} else {
-		updateFlag = true
-	}
+//countHosts counts the hosts table entries which match the selector while tracking the
+//max proxy beacons of a source. Lookups failing with transient errors are retried.
+func (a *analyzer) countHosts(ssn *mgo.Session, selector bson.M) (int, error) {
+	var count int
+	err := a.retrier.Do(a.ctx, ssn, func() error {
+		start := time.Now()
+		var err error
+		count, err = ssn.DB(a.db.GetSelectedDB()).C(a.conf.T.Structure.HostTable).Find(selector).Count()
+		metrics.ObserveDBLatency(a.conf.T.Structure.HostTable, "count", start)
+		return err
+	})
+	return count, err
+}
 
-	// since we didn't find any changeable lower max beacon scores, we will
-	// set the condition to push a new entry with the current score listed as the
-	// max beacon ONLY if no matching chunks reporting higher max beacon scores
-	// are found.
+//maxBeaconUpdate builds the conditional updates which record the fqdn as the max proxy
+//beacon of the source selected by hostKey for the current chunk
+func (a *analyzer) maxBeaconUpdate(score float64, hostKey bson.M, fqdn string) maxBeaconUpdate {
+	var output maxBeaconUpdate
 
-	if newFlag {
+	// create the host record if it doesn't exist yet so the entry may be pushed onto it
+	output.host = updateInfo{
+		selector: copySelector(hostKey),
+		query:    bson.M{"$setOnInsert": bson.M{"dat": []bson.M{}}},
+	}
 
-		query["$push"] = bson.M{
-			"dat": bson.M{
-				"max_beacon_proxy_score": score,
-				"mbproxy":                fqdn,
+	// push an entry only if the chunk doesn't have one yet. The condition is checked
+	// when the update is applied, so two updates can't both push an entry.
+	output.insert = updateInfo{
+		selector: copySelector(hostKey),
+		query: bson.M{
+			"$push": bson.M{
+				"dat": bson.M{
+					"max_beacon_proxy_score": score,
+					"mbproxy":                fqdn,
+					"cid":                    a.chunk,
+				}}},
+	}
+	output.insert.selector["dat"] = bson.M{
+		"$not": bson.M{
+			"$elemMatch": bson.M{
 				"cid":                    a.chunk,
-			}}
-
-		// create selector for output
-		output.query = query
-		output.selector = src.BSONKey()
+				"max_beacon_proxy_score": bson.M{"$exists": true},
+			},
+		},
+	}
 
-	} else if updateFlag {
+	// replace the chunk's entry if it holds a lower score or the same fqdn. Analyzing
+	// the same chunk again overwrites the entry rather than adding another one.
+	output.replace = updateInfo{
+		selector: copySelector(hostKey),
+		query: bson.M{
+			"$set": bson.M{
+				"dat.$.max_beacon_proxy_score": score,
+				"dat.$.mbproxy":                fqdn,
+				"dat.$.cid":                    a.chunk,
+			},
+		},
+	}
+	output.replace.selector["dat"] = bson.M{
+		"$elemMatch": bson.M{
+			"cid": a.chunk,
+			"$or": []bson.M{
+				{"max_beacon_proxy_score": bson.M{"$lt": score}},
+				{"mbproxy": fqdn},
+			},
+		},
+	}
 
-		query["$set"] = bson.M{
-			"dat.$.max_beacon_proxy_score": score,
-			"dat.$.mbproxy":                fqdn,
-			"dat.$.cid":                    a.chunk,
-		}
+	return output
+}
 
-		// create selector for output
-		output.query = query
+//allowlisted checks whether the FQDN is covered by BeaconProxy.FQDNAllowlist
+func (a *analyzer) allowlisted(fqdn string) bool {
+	return util.ContainsDomain(a.allowlist, fqdn)
+}
 
-		// using the same find query we created above will allow us to match and
-		// update the exact chunk we need to update
-		output.selector = maxBeaconMatchLowerQuery
+//copySelector copies a selector so fields may be added to it without modifying the original
+func copySelector(selector bson.M) bson.M {
+	copied := make(bson.M, len(selector)+1)
+	for key, value := range selector {
+		copied[key] = value
 	}
-
-	return output
+	return copied
 }
@@ -0,0 +1,632 @@
+package beaconproxy
+
+import (
+	"context"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"testing"
+
+	"github.com/activecm/rita/config"
+	"github.com/activecm/rita/pkg/data"
+	"github.com/activecm/rita/pkg/spill"
+	"github.com/activecm/rita/pkg/uconnproxy"
+	"github.com/activecm/rita/util"
+	"github.com/globalsign/mgo/bson"
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/require"
+)
+
+var testSrc = data.UniqueIP{
+	IP:          "10.0.0.1",
+	NetworkUUID: util.UnknownPrivateNetworkUUID,
+	NetworkName: util.UnknownPrivateNetworkName,
+}
+
+//testBeaconInput creates a proxy beacon input from the given timestamps
+func testBeaconInput(tsList []int64) *uconnproxy.Input {
+	return &uconnproxy.Input{
+		Hosts: data.UniqueSrcFQDNPair{
+			UniqueSrcIP: testSrc.AsSrc(),
+			FQDN:        "example.com",
+		},
+		TsList:          tsList,
+		ConnectionCount: int64(len(tsList)),
+	}
+}
+
+//testAnalyzer creates an analyzer which scores with the default scorer
+func testAnalyzer(tsMin, tsMax int64, conf *config.Config) *analyzer {
+	return &analyzer{tsMin: tsMin, tsMax: tsMax, conf: conf, scorer: NewDefaultProxyScorer(conf)}
+}
+
+//stubScorer gives every proxy beacon the same score
+type stubScorer struct {
+	calls int
+}
+
+func (s *stubScorer) Score(diff []int64, connCount int, tsMin, tsMax int64) ProxyScore {
+	s.calls++
+	// overwrite the delta times to ensure the analyzer doesn't rely on them afterwards
+	for i := range diff {
+		diff[i] = -1
+	}
+	return ProxyScore{SkewScore: 0.1, DispersionScore: 0.2, ConnsScore: 0.3, TsScore: 0.42, Score: 0.42}
+}
+
+func TestBeaconQueryCustomScorer(t *testing.T) {
+	scorer := &stubScorer{}
+	conf := testConfig()
+	conf.S.ScoreBands = config.ScoreBandsStaticCfg{Medium: 0.5, High: 0.7, Critical: 0.9}
+	a := &analyzer{tsMin: 0, tsMax: 2000, conf: conf, scorer: scorer}
+
+	query, score := a.beaconQuery(testBeaconInput([]int64{0, 10, 20, 40, 60, 110}), &deltaBuffer{})
+	set := query["$set"].(bson.M)
+
+	require.Equal(t, 1, scorer.calls)
+	require.Equal(t, 0.42, score)
+	require.Equal(t, 0.42, set["score"])
+	require.Equal(t, "low", set["score_band"])
+	require.Equal(t, 0.42, set["ts.score"])
+	require.Equal(t, 0.1, set["ts.skew_score"])
+	require.Equal(t, 0.2, set["ts.dispersion_score"])
+	require.Equal(t, 0.3, set["ts.conns_score"])
+	require.NotContains(t, set, "ts.autocorr_score")
+
+	// the interval statistics are computed by the analyzer
+	require.Equal(t, int64(40), set["ts.range"])
+	require.Equal(t, []int64{10, 20, 50}, set["ts.intervals"])
+}
+
+func TestBeaconQueryScoreComponents(t *testing.T) {
+	a := testAnalyzer(0, 2000, testConfig())
+
+	// diffs of 10, 10, 20, 20, 50
+	query, score := a.beaconQuery(testBeaconInput([]int64{0, 10, 20, 40, 60, 110}), &deltaBuffer{})
+	set := query["$set"].(bson.M)
+
+	// quartiles are 10, 20, 20 so bowley skew is unreliable and set to zero
+	require.Equal(t, 0.0, set["ts.skew"])
+	require.Equal(t, 1.0, set["ts.skew_score"])
+
+	// absolute deviations about the median of 20 are 0, 0, 10, 10, 30
+	require.Equal(t, int64(10), set["ts.dispersion"])
+	require.InDelta(t, 1.0-10.0/30.0, set["ts.dispersion_score"], 0.0001)
+
+	// 6 connections over 200 second periods
+	require.InDelta(t, 0.03, set["ts.conns_score"], 0.0001)
+
+	// the existing fields are still written and combine the components
+	require.Contains(t, set, "ts.score")
+	expected := (set["ts.skew_score"].(float64) + set["ts.dispersion_score"].(float64) +
+		set["ts.conns_score"].(float64)) / 3.0
+	require.InDelta(t, expected, score, 0.001)
+	require.Equal(t, score, set["score"])
+}
+
+func TestBeaconQueryUnsortedTimestamps(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	a := testAnalyzer(0, 2000, testConfig())
+	a.log = logger
+
+	sorted := []int64{0, 10, 20, 40, 60, 110}
+	sortedQuery, sortedScore := a.beaconQuery(testBeaconInput(sorted), &deltaBuffer{})
+	require.Empty(t, hook.AllEntries())
+
+	// out of order timestamps would produce negative delta times
+	entry := testBeaconInput([]int64{40, 0, 110, 20, 10, 60})
+	query, score := a.beaconQuery(entry, &deltaBuffer{})
+	set := query["$set"].(bson.M)
+
+	require.Equal(t, sorted, entry.TsList)
+	require.Equal(t, sorted, set["tslist"])
+	require.Equal(t, []int64{10, 20, 50}, set["ts.intervals"])
+	require.Equal(t, int64(40), set["ts.range"])
+	require.Equal(t, sortedScore, score)
+	require.Equal(t, sortedQuery, query)
+
+	require.Len(t, hook.AllEntries(), 1)
+	require.Equal(t, log.WarnLevel, hook.LastEntry().Level)
+	require.Equal(t, 6, hook.LastEntry().Data["timestamps"])
+}
+
+func TestBeaconQueryMinDistinctIntervals(t *testing.T) {
+	conf := testConfig()
+	conf.S.BeaconProxy.TimestampPrecision = "ms"
+
+	// 1000 connections a millisecond apart, all within one second
+	burst := make([]int64, 1000)
+	for i := range burst {
+		burst[i] = 1517336042000 + int64(i)
+	}
+	a := testAnalyzer(burst[0], burst[len(burst)-1], conf)
+
+	// the burst looks like a perfect beacon
+	query, score := a.beaconQuery(testBeaconInput(burst), &deltaBuffer{})
+	require.Equal(t, 1.0, score)
+	require.Equal(t, false, query["$set"].(bson.M)["low_confidence"])
+
+	// but it only repeats a single delta time
+	conf.S.BeaconProxy.MinDistinctIntervals = 3
+	query, score = a.beaconQuery(testBeaconInput(burst), &deltaBuffer{})
+	set := query["$set"].(bson.M)
+	require.Equal(t, lowConfidenceMaxScore, score)
+	require.Equal(t, lowConfidenceMaxScore, set["score"])
+	require.Equal(t, lowConfidenceMaxScore, set["ts.score"])
+	require.Equal(t, true, set["low_confidence"])
+
+	// a beacon with a little jitter has enough distinct delta times
+	tsList := []int64{0, 59000, 120000, 181000, 240000, 300000, 359000, 420000}
+	a = testAnalyzer(0, 420000, conf)
+	query, score = a.beaconQuery(testBeaconInput(tsList), &deltaBuffer{})
+	require.Equal(t, false, query["$set"].(bson.M)["low_confidence"])
+	require.Greater(t, score, lowConfidenceMaxScore)
+}
+
+func TestBeaconQueryTsListLimit(t *testing.T) {
+	conf := testConfig()
+	tsList := make([]int64, 500)
+	for i := range tsList {
+		tsList[i] = int64(i*60 + i%7)
+	}
+	a := testAnalyzer(tsList[0], tsList[len(tsList)-1], conf)
+
+	documentSize := func(query bson.M) int {
+		raw, err := bson.Marshal(query["$set"])
+		require.Nil(t, err)
+		return len(raw)
+	}
+
+	// every timestamp is stored by default
+	fullQuery, fullScore := a.beaconQuery(testBeaconInput(tsList), &deltaBuffer{})
+	require.Equal(t, tsList, fullQuery["$set"].(bson.M)["tslist"])
+	require.Equal(t, int64(500), fullQuery["$set"].(bson.M)["tslist_count"])
+
+	// only the ends of the tslist are stored, but the scores come from every timestamp
+	conf.S.BeaconProxy.TsListLimit = 5
+	query, score := a.beaconQuery(testBeaconInput(tsList), &deltaBuffer{})
+	set := query["$set"].(bson.M)
+	require.Equal(t, []int64{0, 61, 122, 183, 244, 29705, 29766, 29820, 29881, 29942}, set["tslist"])
+	require.Equal(t, int64(500), set["tslist_count"])
+	require.Equal(t, fullScore, score)
+	for key, value := range fullQuery["$set"].(bson.M) {
+		if key != "tslist" {
+			require.Equal(t, value, set[key], key)
+		}
+	}
+	require.Less(t, documentSize(query), documentSize(fullQuery)/10)
+
+	// the tslist may be left out entirely
+	conf.S.BeaconProxy.TsListLimit = -1
+	query, score = a.beaconQuery(testBeaconInput(tsList), &deltaBuffer{})
+	require.Equal(t, []int64{}, query["$set"].(bson.M)["tslist"])
+	require.Equal(t, fullScore, score)
+	require.Less(t, documentSize(query), documentSize(fullQuery)/10)
+
+	// short tslists are stored in full
+	conf.S.BeaconProxy.TsListLimit = 250
+	query, _ = a.beaconQuery(testBeaconInput(tsList), &deltaBuffer{})
+	require.Equal(t, tsList, query["$set"].(bson.M)["tslist"])
+}
+
+func TestBeaconQueryUniformIntervals(t *testing.T) {
+	a := testAnalyzer(0, 600, testConfig())
+
+	// a perfectly periodic beacon gets the max skew and dispersion scores
+	var tsList []int64
+	for i := int64(0); i < 10; i++ {
+		tsList = append(tsList, i*60)
+	}
+	query, _ := a.beaconQuery(testBeaconInput(tsList), &deltaBuffer{})
+	set := query["$set"].(bson.M)
+	require.Equal(t, 0.0, set["ts.skew"])
+	require.Equal(t, 1.0, set["ts.skew_score"])
+	require.Equal(t, int64(0), set["ts.dispersion"])
+	require.Equal(t, 1.0, set["ts.dispersion_score"])
+
+	// a single late connection doesn't move the quartiles or the median deviation
+	tsList[len(tsList)-1]++
+	query, _ = a.beaconQuery(testBeaconInput(tsList), &deltaBuffer{})
+	set = query["$set"].(bson.M)
+	require.Equal(t, int64(1), set["ts.range"])
+	require.Equal(t, 1.0, set["ts.skew_score"])
+	require.Equal(t, 1.0, set["ts.dispersion_score"])
+}
+
+func TestBeaconQuerySubSecond(t *testing.T) {
+	conf := testConfig()
+	conf.S.BeaconProxy.TimestampPrecision = "ms"
+	a := testAnalyzer(0, 10, conf)
+
+	// poll every 200ms with up to 5ms of jitter
+	jitter := []int64{0, 3, -2, 5, -4, 1, 0, -5, 2, 4}
+	var tsList []int64
+	for i := int64(0); i < 50; i++ {
+		tsList = append(tsList, 1517336042000+i*200+jitter[i%10])
+	}
+
+	query, _ := a.beaconQuery(testBeaconInput(tsList), &deltaBuffer{})
+	set := query["$set"].(bson.M)
+
+	// the intervals are kept in milliseconds rather than collapsing to 0 seconds
+	for _, interval := range set["ts.intervals"].([]int64) {
+		require.InDelta(t, 200, interval, 10)
+	}
+	require.True(t, set["ts.dispersion"].(int64) <= 5)
+
+	// a few milliseconds of dispersion are insignificant next to a 30 second cutoff
+	require.True(t, set["ts.dispersion_score"].(float64) > 0.99)
+}
+
+func TestBeaconQueryDuration(t *testing.T) {
+	var tsList []int64
+	for i := int64(0); i < 10; i++ {
+		tsList = append(tsList, i*60)
+	}
+
+	// the duration score is not computed unless enabled
+	input := testBeaconInput(tsList)
+	input.DurList = []float64{5, 5, 5, 5, 5, 5, 5, 5, 5}
+	query, tsOnlyScore := testAnalyzer(0, 600, testConfig()).beaconQuery(input, &deltaBuffer{})
+	require.NotContains(t, query["$set"], "dur.score")
+
+	conf := testConfig()
+	conf.S.BeaconProxy.DurationEnabled = true
+	a := testAnalyzer(0, 600, conf)
+
+	// consistent durations are blended into the overall score
+	query, score := a.beaconQuery(input, &deltaBuffer{})
+	set := query["$set"].(bson.M)
+	require.Equal(t, 1.0, set["dur.score"])
+	require.Equal(t, score, set["score"])
+	require.InDelta(t, (tsOnlyScore+1.0)/2.0, score, 0.001)
+
+	// erratic durations lower the overall score
+	input.DurList = []float64{0.1, 35.2, 2.0, 120.5, 0.7, 14.3, 60.0, 5.5, 9.0}
+	_, erraticScore := a.beaconQuery(input, &deltaBuffer{})
+	require.True(t, erraticScore < score)
+
+	// missing durations leave the score alone
+	input.DurList = nil
+	query, missingScore := a.beaconQuery(input, &deltaBuffer{})
+	require.NotContains(t, query["$set"], "dur.score")
+	require.Equal(t, tsOnlyScore, missingScore)
+}
+
+func TestBeaconQueryDurationScoreBand(t *testing.T) {
+	conf := testConfig()
+	conf.S.ScoreBands = config.ScoreBandsStaticCfg{Medium: 0.5, High: 0.7, Critical: 0.9}
+	conf.S.BeaconProxy.DurationEnabled = true
+	a := &analyzer{tsMin: 0, tsMax: 2000, conf: conf, scorer: &stubScorer{}}
+
+	// the band follows the score after the consistent durations are blended in
+	input := testBeaconInput([]int64{0, 10, 20, 40, 60, 110})
+	input.DurList = []float64{5, 5, 5, 5, 5, 5}
+	query, score := a.beaconQuery(input, &deltaBuffer{})
+	set := query["$set"].(bson.M)
+	require.InDelta(t, 0.71, score, 0.001)
+	require.Equal(t, score, set["score"])
+	require.Equal(t, "high", set["score_band"])
+}
+
+func TestMaxBeaconUpdate(t *testing.T) {
+	a := &analyzer{chunk: 1}
+	output := a.maxBeaconUpdate(0.8, testSrc.BSONKey(), "a.com")
+
+	// the host record is created if it doesn't exist
+	require.Equal(t, testSrc.BSONKey(), output.host.selector)
+	require.Contains(t, output.host.query, "$setOnInsert")
+
+	// an entry is only pushed if the chunk doesn't track a max proxy beacon yet
+	require.Contains(t, output.insert.query, "$push")
+	require.Equal(t, bson.M{
+		"$not": bson.M{
+			"$elemMatch": bson.M{
+				"cid":                    1,
+				"max_beacon_proxy_score": bson.M{"$exists": true},
+			},
+		},
+	}, output.insert.selector["dat"])
+
+	// the chunk's entry is replaced if it holds a lower score or the same fqdn
+	require.Contains(t, output.replace.query, "$set")
+	require.Equal(t, bson.M{
+		"$elemMatch": bson.M{
+			"cid": 1,
+			"$or": []bson.M{
+				{"max_beacon_proxy_score": bson.M{"$lt": 0.8}},
+				{"mbproxy": "a.com"},
+			},
+		},
+	}, output.replace.selector["dat"])
+}
+
+func TestMaxBeaconUpdateOverlappingNetworks(t *testing.T) {
+	a := &analyzer{chunk: 1}
+
+	// the same address seen by a sensor on another network
+	otherSrc := data.NewUniqueIP(net.ParseIP(testSrc.IP), "ff0d0776-0cdc-4a10-b793-522bcd48a560", "other")
+
+	output := a.maxBeaconUpdate(0.8, testSrc.BSONKey(), "a.com")
+	otherOutput := a.maxBeaconUpdate(0.8, otherSrc.BSONKey(), "a.com")
+	require.Equal(t, testSrc.NetworkUUID, output.insert.selector["network_uuid"])
+	require.Equal(t, otherSrc.NetworkUUID, otherOutput.insert.selector["network_uuid"])
+	require.NotEqual(t, output.insert.selector, otherOutput.insert.selector)
+
+	// the proxy beacons of each network are selected separately
+	input := testBeaconInput([]int64{0, 60, 120, 180})
+	otherInput := testBeaconInput([]int64{0, 60, 120, 180})
+	otherInput.Hosts = data.NewUniqueSrcFQDNPair(otherSrc, "example.com")
+	require.NotEqual(t, input.Hosts.BSONKey(), otherInput.Hosts.BSONKey())
+}
+
+func TestMaxBeaconUpdateSubnet(t *testing.T) {
+	a := &analyzer{chunk: 1}
+	subnet := data.NewSubnet(testSrc, data.SubnetPrefixLengths{IPv4: 24, IPv6: 64})
+
+	// the max proxy beacon score of a subnet is tracked in an entry for the subnet
+	hostKey := subnet.BSONKey()
+	output := a.maxBeaconUpdate(0.8, hostKey, "a.com")
+	require.Equal(t, subnet.BSONKey(), output.host.selector)
+	require.Contains(t, output.insert.selector, "dat")
+	require.Contains(t, output.replace.selector, "dat")
+
+	// the given key is not modified by the selectors built from it
+	require.Equal(t, subnet.BSONKey(), hostKey)
+}
+
+func TestAllowlisted(t *testing.T) {
+	a := &analyzer{allowlist: []string{"ocsp.digicert.com", "*.windowsupdate.com"}}
+
+	// exact entries only match the FQDN itself
+	require.True(t, a.allowlisted("ocsp.digicert.com"))
+	require.False(t, a.allowlisted("crl.digicert.com"))
+
+	// wildcard entries match the domain and its subdomains
+	require.True(t, a.allowlisted("windowsupdate.com"))
+	require.True(t, a.allowlisted("download.windowsupdate.com"))
+	require.True(t, a.allowlisted("a.b.windowsupdate.com"))
+	require.False(t, a.allowlisted("notwindowsupdate.com"))
+
+	require.False(t, a.allowlisted("beacon.example.com"))
+
+	// nothing is allowlisted by default
+	require.False(t, (&analyzer{}).allowlisted("ocsp.digicert.com"))
+}
+
+func TestBeaconQueryReusedBuffer(t *testing.T) {
+	a := testAnalyzer(0, 100000, testConfig())
+	rng := rand.New(rand.NewSource(4))
+
+	// the buffer shrinks and grows between entries of different lengths
+	buffer := &deltaBuffer{}
+	for _, length := range []int{500, 20, 20, 1000, 3} {
+		tsList := make([]int64, length+1)
+		for i := 1; i < len(tsList); i++ {
+			tsList[i] = tsList[i-1] + 55 + rng.Int63n(10)
+		}
+
+		expected, expectedScore := a.beaconQuery(testBeaconInput(tsList), &deltaBuffer{})
+		query, score := a.beaconQuery(testBeaconInput(tsList), buffer)
+		require.Equal(t, expected, query)
+		require.Equal(t, expectedScore, score)
+	}
+}
+
+//BenchmarkBeaconQuery compares computing the delta times of each entry in a new slice
+//against reusing the buffer of the analysis thread. Run with -benchmem to compare the B/op.
+func BenchmarkBeaconQuery(b *testing.B) {
+	a := testAnalyzer(0, 86400, testConfig())
+	rng := rand.New(rand.NewSource(5))
+	tsList := make([]int64, 10000)
+	for i := 1; i < len(tsList); i++ {
+		tsList[i] = tsList[i-1] + 5 + rng.Int63n(5)
+	}
+	input := testBeaconInput(tsList)
+
+	b.Run("new", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			a.beaconQuery(input, &deltaBuffer{})
+		}
+	})
+
+	b.Run("reused", func(b *testing.B) {
+		buffer := &deltaBuffer{}
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			a.beaconQuery(input, buffer)
+		}
+	})
+}
+
+//testSpilledInput spills the timestamps of an input to disk like the dissector does
+func testSpilledInput(t *testing.T, conf *config.Config, tsList []int64) *uconnproxy.Input {
+	sorter := spill.NewSorter(conf.S.BeaconProxy.SpillDir, conf.S.BeaconProxy.SpillThreshold, true)
+	for _, ts := range tsList {
+		require.Nil(t, sorter.Add(ts))
+	}
+	tsSpill, err := sorter.Finish()
+	require.Nil(t, err)
+
+	input := testBeaconInput(nil)
+	input.TsSpill = tsSpill
+	input.ConnectionCount = int64(len(tsList))
+	return input
+}
+
+func TestAnalyzeEntryTooFewTimestamps(t *testing.T) {
+	scorer := &stubScorer{}
+	logger, hook := test.NewNullLogger()
+	logger.SetLevel(log.DebugLevel)
+
+	a := testAnalyzer(0, 1000, testConfig())
+	a.scorer = scorer
+	a.log = logger
+	analyzed := 0
+	a.analyzedCallback = func(*update) { analyzed++ }
+
+	// an empty slice isn't a strobe, which has no timestamps at all
+	for _, tsList := range [][]int64{{}, {100}, {100, 160, 220}} {
+		a.analyzeEntry(nil, &deltaBuffer{}, testBeaconInput(tsList))
+	}
+
+	// the entries are dropped without being scored
+	require.Zero(t, scorer.calls)
+	require.Zero(t, analyzed)
+	entries := hook.AllEntries()
+	require.Len(t, entries, 3)
+	for i, expected := range []int64{0, 1, 3} {
+		require.Equal(t, log.DebugLevel, entries[i].Level)
+		require.Equal(t, expected, entries[i].Data["timestamps"])
+	}
+}
+
+func TestRateStrobe(t *testing.T) {
+	conf := testConfig()
+	a := testAnalyzer(0, 86400, conf)
+
+	// 100 connections over 100 seconds
+	entry := testBeaconInput([]int64{0, 10, 20, 40, 60, 100})
+	entry.ConnectionCount = 100
+
+	// the check is disabled by default
+	require.False(t, a.rateStrobe(entry))
+
+	// one connection per second is right at the threshold
+	conf.S.BeaconProxy.StrobeRate = 1
+	require.False(t, a.rateStrobe(entry))
+	entry.ConnectionCount = 101
+	require.True(t, a.rateStrobe(entry))
+
+	// the span is measured in the configured timestamp units
+	conf.S.BeaconProxy.TimestampPrecision = "ms"
+	require.True(t, a.rateStrobe(testBeaconInput([]int64{0, 10, 20, 40, 60, 100})))
+	entry = testBeaconInput([]int64{0, 10000, 20000, 40000, 60000, 100000})
+	entry.ConnectionCount = 100
+	require.False(t, a.rateStrobe(entry))
+}
+
+func TestAnalyzeEntryRateStrobe(t *testing.T) {
+	scorer := &stubScorer{}
+	conf := testConfig()
+	conf.S.BeaconProxy.StrobeRate = 2
+	a := testAnalyzer(0, 86400, conf)
+	a.scorer = scorer
+	var outputs []*update
+	a.analyzedCallback = func(output *update) { outputs = append(outputs, output) }
+
+	// thousands of connections within a few seconds
+	entry := testBeaconInput([]int64{100, 101, 102, 103})
+	entry.ConnectionCount = 5000
+	a.analyzeEntry(nil, &deltaBuffer{}, entry)
+
+	// the pair is flagged as a strobe without being scored
+	require.Zero(t, scorer.calls)
+	require.Len(t, outputs, 1)
+	require.Nil(t, outputs[0].beacon.query)
+	require.Equal(t, strobeUpdate(entry), outputs[0].uconnproxy)
+	require.Equal(t, bson.M{"$set": bson.M{"strobeFQDN": true}}, outputs[0].uconnproxy.query)
+}
+
+func TestCreateCountMapEmpty(t *testing.T) {
+	intervals, counts, mode, modeCount := createCountMap(nil)
+	require.Nil(t, intervals)
+	require.Nil(t, counts)
+	require.Zero(t, mode)
+	require.Zero(t, modeCount)
+
+	// a single delta time is its own mode
+	intervals, counts, mode, modeCount = createCountMap([]int64{60})
+	require.Equal(t, []int64{60}, intervals)
+	require.Equal(t, []int64{1}, counts)
+	require.Equal(t, int64(60), mode)
+	require.Equal(t, int64(1), modeCount)
+}
+
+func TestSpilledBeaconQuery(t *testing.T) {
+	rng := rand.New(rand.NewSource(6))
+
+	for _, autocorr := range []bool{false, true} {
+		conf := testConfig()
+		conf.S.BeaconProxy.AutocorrelationEnabled = autocorr
+		conf.S.BeaconProxy.DriftEnabled = autocorr
+		conf.S.BeaconProxy.SpillThreshold = 50
+		conf.S.BeaconProxy.SpillDir = t.TempDir()
+		if autocorr {
+			// the spilled delta times are compared by the same quantiles
+			conf.S.BeaconProxy.SkewQuantiles = config.SkewQuantilesStaticCfg{Lower: .1, Upper: .9}
+		}
+
+		// even and odd numbers of delta times, all well over the spill threshold
+		for _, length := range []int{1000, 1001, 4097} {
+			tsList := make([]int64, length)
+			for i := 1; i < len(tsList); i++ {
+				tsList[i] = tsList[i-1] + 50 + rng.Int63n(20)
+			}
+
+			a := testAnalyzer(0, 100000, conf)
+			expected, expectedScore := a.beaconQuery(testBeaconInput(append([]int64(nil), tsList...)), &deltaBuffer{})
+
+			input := testSpilledInput(t, conf, tsList)
+			query, score, err := a.spilledBeaconQuery(input)
+			require.Nil(t, err)
+			require.Nil(t, input.TsSpill.Close())
+
+			// spilled timestamps are not stored with the results
+			require.Nil(t, query["$set"].(bson.M)["tslist"])
+			query["$set"].(bson.M)["tslist"] = expected["$set"].(bson.M)["tslist"]
+			require.Equal(t, expected, query)
+			require.Equal(t, expectedScore, score)
+		}
+
+		// only the spilled timestamps were left in the spill directory, and they were removed
+		files, err := ioutil.ReadDir(conf.S.BeaconProxy.SpillDir)
+		require.Nil(t, err)
+		require.Empty(t, files)
+	}
+}
+
+func TestSpilledBeaconQueryCustomScorer(t *testing.T) {
+	conf := testConfig()
+	conf.S.BeaconProxy.SpillThreshold = 10
+	conf.S.BeaconProxy.SpillDir = t.TempDir()
+
+	tsList := []int64{0, 10, 20, 35, 40, 50, 60, 75, 80, 90, 100, 115, 120}
+	scorer := &stubScorer{}
+	a := &analyzer{tsMin: 0, tsMax: 2000, conf: conf, scorer: scorer}
+
+	input := testSpilledInput(t, conf, tsList)
+	defer input.TsSpill.Close()
+
+	query, score, err := a.spilledBeaconQuery(input)
+	require.Nil(t, err)
+	require.Equal(t, 1, scorer.calls)
+	require.Equal(t, 0.42, score)
+	require.Equal(t, int64(10), query["$set"].(bson.M)["ts.mode"])
+	require.Equal(t, int64(10), query["$set"].(bson.M)["ts.range"])
+}
+
+func TestAnalyzerCollectCancelled(t *testing.T) {
+	conf := testConfig()
+	conf.S.BeaconProxy.SpillThreshold = 2
+	conf.S.BeaconProxy.SpillDir = t.TempDir()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	a := testAnalyzer(0, 1000, conf)
+	a.ctx = ctx
+	a.analysisChannel = make(chan *uconnproxy.Input)
+	cancel()
+
+	// nothing reads the analysis channel, yet collect doesn't block once cancelled
+	a.collect(testSpilledInput(t, conf, []int64{0, 60, 120, 180, 240}))
+
+	// the spilled timestamps of the dropped entry are removed from disk
+	files, err := ioutil.ReadDir(conf.S.BeaconProxy.SpillDir)
+	require.Nil(t, err)
+	require.Empty(t, files)
+
+	_, ok := a.next()
+	require.False(t, ok)
+}
@@ -0,0 +1,178 @@
+package beaconproxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/activecm/rita/pkg/data"
+	"github.com/activecm/rita/resources"
+)
+
+//the ways a proxy beacon may show up when two databases are compared
+const (
+	OnlyInBase  = "base"
+	OnlyInOther = "other"
+	InBoth      = "both"
+)
+
+//BeaconDiff describes how a proxy beacon differs between two databases. The scores
+//are only set for the databases holding the proxy beacon and the delta is only set
+//if both of them do.
+type BeaconDiff struct {
+	Src            string   `json:"src"`
+	SrcNetworkName string   `json:"src_network_name"`
+	SrcNetworkUUID string   `json:"src_network_uuid"`
+	FQDN           string   `json:"fqdn"`
+	Presence       string   `json:"presence"`
+	BaseScore      *float64 `json:"base_score"`
+	OtherScore     *float64 `json:"other_score"`
+	Delta          *float64 `json:"delta,omitempty"`
+}
+
+//Compare reads the proxy beacons of two databases, such as the same logs imported
+//with different configs, and reports the proxy beacons found in only one of them
+//along with the score deltas of the proxy beacons found in both. The proxy beacons
+//are matched by their source and FQDN, the same key they are stored under.
+func Compare(res *resources.Resources, baseDB string, otherDB string) ([]BeaconDiff, error) {
+	if baseDB == "" || otherDB == "" {
+		return nil, errors.New("two databases are required")
+	}
+
+	base, err := allResults(res, baseDB)
+	if err != nil {
+		return nil, err
+	}
+	other, err := allResults(res, otherDB)
+	if err != nil {
+		return nil, err
+	}
+	return compareResults(base, other), nil
+}
+
+//allResults reads every proxy beacon of a database
+func allResults(res *resources.Resources, database string) ([]Result, error) {
+	ssn := res.DB.Session.Copy()
+	defer ssn.Close()
+
+	var results []Result
+	err := ssn.DB(database).C(res.Config.T.BeaconProxy.BeaconProxyTable).Find(nil).All(&results)
+	return results, err
+}
+
+//compareResults matches up the proxy beacons of two databases. The proxy beacons found
+//in only the base database are listed first, followed by those found in only the other
+//database, then the ones in both with the largest score changes first.
+func compareResults(base []Result, other []Result) []BeaconDiff {
+	resultKey := func(result Result) string {
+		return data.NewUniqueSrcFQDNPair(
+			data.UniqueIP{IP: result.SrcIP, NetworkUUID: result.SrcNetworkUUID}, result.FQDN,
+		).MapKey()
+	}
+
+	otherResults := make(map[string]Result, len(other))
+	for _, result := range other {
+		otherResults[resultKey(result)] = result
+	}
+
+	var diffs []BeaconDiff
+	for _, result := range base {
+		key := resultKey(result)
+		baseScore := result.Score
+		diff := newBeaconDiff(result, OnlyInBase)
+		diff.BaseScore = &baseScore
+
+		if otherResult, ok := otherResults[key]; ok {
+			otherScore := otherResult.Score
+			delta := otherScore - baseScore
+			diff.Presence = InBoth
+			diff.OtherScore = &otherScore
+			diff.Delta = &delta
+			delete(otherResults, key)
+		}
+		diffs = append(diffs, diff)
+	}
+
+	// whatever wasn't matched is only in the other database
+	for _, result := range otherResults {
+		otherScore := result.Score
+		diff := newBeaconDiff(result, OnlyInOther)
+		diff.OtherScore = &otherScore
+		diffs = append(diffs, diff)
+	}
+
+	presenceOrder := map[string]int{OnlyInBase: 0, OnlyInOther: 1, InBoth: 2}
+	sort.Slice(diffs, func(i, j int) bool {
+		if diffs[i].Presence != diffs[j].Presence {
+			return presenceOrder[diffs[i].Presence] < presenceOrder[diffs[j].Presence]
+		}
+		if diffs[i].Presence == InBoth && math.Abs(*diffs[i].Delta) != math.Abs(*diffs[j].Delta) {
+			return math.Abs(*diffs[i].Delta) > math.Abs(*diffs[j].Delta)
+		}
+		if diffs[i].Src != diffs[j].Src {
+			return diffs[i].Src < diffs[j].Src
+		}
+		if diffs[i].FQDN != diffs[j].FQDN {
+			return diffs[i].FQDN < diffs[j].FQDN
+		}
+		return diffs[i].SrcNetworkUUID < diffs[j].SrcNetworkUUID
+	})
+	return diffs
+}
+
+//newBeaconDiff creates a BeaconDiff identifying the proxy beacon without any scores
+func newBeaconDiff(result Result, presence string) BeaconDiff {
+	return BeaconDiff{
+		Src:            result.SrcIP,
+		SrcNetworkName: result.SrcNetworkName,
+		SrcNetworkUUID: formatUUID(result.SrcNetworkUUID),
+		FQDN:           result.FQDN,
+		Presence:       presence,
+	}
+}
+
+//WriteComparisonJSON writes the differences as newline delimited JSON
+func WriteComparisonJSON(diffs []BeaconDiff, w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	for _, diff := range diffs {
+		if err := encoder.Encode(diff); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//WriteComparisonTable renders the differences as a table. The scores missing from
+//a database are left blank.
+func WriteComparisonTable(diffs []BeaconDiff, w io.Writer) error {
+	formatScore := func(score *float64) string {
+		if score == nil {
+			return ""
+		}
+		return strconv.FormatFloat(*score, 'f', 3, 64)
+	}
+
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(table, "\tIn\tSource\tFQDN\tBase Score\tOther Score\tDelta\t")
+	for _, diff := range diffs {
+		delta := ""
+		if diff.Delta != nil {
+			delta = strconv.FormatFloat(*diff.Delta, 'f', 3, 64)
+			if *diff.Delta > 0 {
+				delta = "+" + delta
+			}
+		}
+		fmt.Fprintf(table, "\t%s\t%s\t%s\t%s\t%s\t%s\t\n",
+			diff.Presence, diff.Src, diff.FQDN,
+			formatScore(diff.BaseScore), formatScore(diff.OtherScore), delta,
+		)
+	}
+
+	return table.Flush()
+}
@@ -0,0 +1,119 @@
+package beaconproxy
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/globalsign/mgo/bson"
+	"github.com/stretchr/testify/require"
+)
+
+//readCompareFixture reads the proxy beacon documents of a fixture database stored as
+//MongoDB extended JSON in testdata
+func readCompareFixture(t *testing.T, name string) []bson.M {
+	file, err := os.Open(filepath.Join("testdata", name))
+	require.Nil(t, err)
+	defer file.Close()
+
+	var docs []bson.M
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var doc bson.M
+		require.Nil(t, bson.UnmarshalJSON(scanner.Bytes(), &doc))
+		docs = append(docs, doc)
+	}
+	require.Nil(t, scanner.Err())
+	return docs
+}
+
+//decodeResults decodes the documents the same way they are decoded when they are
+//read from MongoDB
+func decodeResults(t *testing.T, docs []bson.M) []Result {
+	var results []Result
+	for _, doc := range docs {
+		raw, err := bson.Marshal(doc)
+		require.Nil(t, err)
+		var result Result
+		require.Nil(t, bson.Unmarshal(raw, &result))
+		results = append(results, result)
+	}
+	return results
+}
+
+//requireComparison checks the differences between the compare_base and compare_other
+//fixture databases
+func requireComparison(t *testing.T, diffs []BeaconDiff) {
+	type row struct {
+		Presence, Src, FQDN string
+		NetworkUUID         string
+	}
+	var rows []row
+	for _, diff := range diffs {
+		rows = append(rows, row{diff.Presence, diff.Src, diff.FQDN, diff.SrcNetworkUUID})
+	}
+
+	// the pair seen from a different network is a different proxy beacon
+	require.Equal(t, []row{
+		{OnlyInBase, "10.0.0.3", "c.example.com", "ffffffff-ffff-ffff-ffff-fffffffffffe"},
+		{OnlyInBase, "10.0.0.4", "d.example.com", "ffffffff-ffff-ffff-ffff-fffffffffffe"},
+		{OnlyInOther, "10.0.0.4", "d.example.com", "00000000-0000-0000-0000-000000000001"},
+		{OnlyInOther, "10.0.0.5", "e.example.com", "ffffffff-ffff-ffff-ffff-fffffffffffe"},
+		{InBoth, "10.0.0.2", "b.example.com", "ffffffff-ffff-ffff-ffff-fffffffffffe"},
+		{InBoth, "10.0.0.1", "a.example.com", "ffffffff-ffff-ffff-ffff-fffffffffffe"},
+	}, rows)
+
+	require.Equal(t, 0.7, *diffs[0].BaseScore)
+	require.Nil(t, diffs[0].OtherScore)
+	require.Nil(t, diffs[0].Delta)
+
+	require.Nil(t, diffs[3].BaseScore)
+	require.Equal(t, 0.85, *diffs[3].OtherScore)
+	require.Nil(t, diffs[3].Delta)
+
+	require.Equal(t, 0.8, *diffs[4].BaseScore)
+	require.Equal(t, 0.6, *diffs[4].OtherScore)
+	require.InDelta(t, -0.2, *diffs[4].Delta, 1e-9)
+	require.InDelta(t, 0.05, *diffs[5].Delta, 1e-9)
+}
+
+func TestCompareResults(t *testing.T) {
+	base := decodeResults(t, readCompareFixture(t, "compare_base.ndjson"))
+	other := decodeResults(t, readCompareFixture(t, "compare_other.ndjson"))
+
+	requireComparison(t, compareResults(base, other))
+
+	// a database compared with itself has no differences
+	for _, diff := range compareResults(base, base) {
+		require.Equal(t, InBoth, diff.Presence)
+		require.Zero(t, *diff.Delta)
+	}
+}
+
+func TestWriteComparison(t *testing.T) {
+	base := decodeResults(t, readCompareFixture(t, "compare_base.ndjson"))
+	other := decodeResults(t, readCompareFixture(t, "compare_other.ndjson"))
+	diffs := compareResults(base, other)
+
+	var buffer bytes.Buffer
+	require.Nil(t, WriteComparisonJSON(diffs, &buffer))
+	lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+	require.Len(t, lines, 6)
+	require.JSONEq(t, `{"src": "10.0.0.3", "src_network_name": "Unknown Private",
+		"src_network_uuid": "ffffffff-ffff-ffff-ffff-fffffffffffe", "fqdn": "c.example.com",
+		"presence": "base", "base_score": 0.7, "other_score": null}`, lines[0])
+	require.JSONEq(t, `{"src": "10.0.0.2", "src_network_name": "Unknown Private",
+		"src_network_uuid": "ffffffff-ffff-ffff-ffff-fffffffffffe", "fqdn": "b.example.com",
+		"presence": "both", "base_score": 0.8, "other_score": 0.6, "delta": -0.20000000000000007}`, lines[4])
+
+	buffer.Reset()
+	require.Nil(t, WriteComparisonTable(diffs, &buffer))
+	lines = strings.Split(strings.TrimSpace(buffer.String()), "\n")
+	require.Len(t, lines, 7)
+	require.Equal(t, []string{"In", "Source", "FQDN", "Base", "Score", "Other", "Score", "Delta"}, strings.Fields(lines[0]))
+	require.Equal(t, []string{"other", "10.0.0.5", "e.example.com", "0.850"}, strings.Fields(lines[4]))
+	require.Equal(t, []string{"both", "10.0.0.1", "a.example.com", "0.900", "0.950", "+0.050"}, strings.Fields(lines[6]))
+}
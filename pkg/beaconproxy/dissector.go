@@ -5,8 +5,11 @@ import (
 
 	"github.com/activecm/rita/config"
 	"github.com/activecm/rita/database"
+	"github.com/activecm/rita/pkg/spill"
 	"github.com/activecm/rita/pkg/uconnproxy"
+	"github.com/globalsign/mgo"
 	"github.com/globalsign/mgo/bson"
+	log "github.com/sirupsen/logrus"
 )
 
 type (
@@ -14,6 +17,7 @@ type (
 		connLimit         int64                   // limit for strobe classification
 		db                *database.DB            // provides access to MongoDB
 		conf              *config.Config          // contains details needed to access MongoDB
+		log               *log.Logger             // logger for writing out errors and warnings
 		dissectedCallback func(*uconnproxy.Input) // called on each analyzed result
 		closedCallback    func()                  // called when .close() is called and no more calls to analyzedCallback will be made
 		dissectChannel    chan *uconnproxy.Input  // holds unanalyzed data
@@ -22,11 +26,12 @@ type (
 )
 
 //newdissector creates a new collector for gathering data
-func newDissector(connLimit int64, db *database.DB, conf *config.Config, dissectedCallback func(*uconnproxy.Input), closedCallback func()) *dissector {
+func newDissector(connLimit int64, db *database.DB, conf *config.Config, log *log.Logger, dissectedCallback func(*uconnproxy.Input), closedCallback func()) *dissector {
 	return &dissector{
 		connLimit:         connLimit,
 		db:                db,
 		conf:              conf,
+		log:               log,
 		dissectedCallback: dissectedCallback,
 		closedCallback:    closedCallback,
 		dissectChannel:    make(chan *uconnproxy.Input),
@@ -75,42 +80,92 @@ func (d *dissector) start() {
 				{"$match": matchNoStrobeKey},
 				{"$limit": 1},
 				{"$project": bson.M{
-					"ts":    "$dat.ts",
-					"count": "$dat.count",
+					"ts":         "$dat.ts",
+					"dur":        "$dat.dur",
+					"orig_bytes": "$dat.orig_bytes",
+					"resp_bytes": "$dat.resp_bytes",
+					"bytes":      "$dat.bytes",
+					"count":      "$dat.count",
 				}},
 				{"$unwind": "$count"},
 				{"$group": bson.M{
-					"_id":   "$_id",
-					"ts":    bson.M{"$first": "$ts"},
-					"count": bson.M{"$sum": "$count"},
+					"_id":        "$_id",
+					"ts":         bson.M{"$first": "$ts"},
+					"dur":        bson.M{"$first": "$dur"},
+					"orig_bytes": bson.M{"$first": "$orig_bytes"},
+					"resp_bytes": bson.M{"$first": "$resp_bytes"},
+					"bytes":      bson.M{"$first": "$bytes"},
+					"count":      bson.M{"$sum": "$count"},
 				}},
-				{"$match": bson.M{"count": bson.M{"$gt": d.conf.S.Beacon.DefaultConnectionThresh}}},
+				{"$match": bson.M{"count": bson.M{"$gte": d.conf.S.BeaconProxy.DefaultConnectionThresh}}},
 				{"$unwind": "$ts"},
 				{"$unwind": "$ts"},
 				{"$group": bson.M{
-					"_id":   "$_id",
-					"ts":    bson.M{"$addToSet": "$ts"},
-					"count": bson.M{"$first": "$count"},
+					"_id":        "$_id",
+					"ts":         bson.M{"$addToSet": "$ts"},
+					"dur":        bson.M{"$first": "$dur"},
+					"orig_bytes": bson.M{"$first": "$orig_bytes"},
+					"resp_bytes": bson.M{"$first": "$resp_bytes"},
+					"bytes":      bson.M{"$first": "$bytes"},
+					"count":      bson.M{"$first": "$count"},
 				}},
 				{"$project": bson.M{
-					"_id":   "$_id",
-					"ts":    1,
-					"count": 1,
+					"_id":        "$_id",
+					"ts":         1,
+					"dur":        1,
+					"orig_bytes": 1,
+					"resp_bytes": 1,
+					"bytes":      1,
+					"count":      1,
 				}},
 			}
 
 			var res struct {
-				Count int64   `bson:"count"`
-				Ts    []int64 `bson:"ts"`
+				Count int64       `bson:"count"`
+				Ts    []int64     `bson:"ts"`
+				Dur   [][]float64 `bson:"dur"` // one list of durations per chunk
+				// the byte counts of the chunks which recorded them
+				OrigBytes []int64   `bson:"orig_bytes"`
+				RespBytes []int64   `bson:"resp_bytes"`
+				Bytes     [][]int64 `bson:"bytes"`
 			}
 
-			_ = ssn.DB(d.db.GetSelectedDB()).C(d.conf.T.Structure.UniqueConnProxyTable).Pipe(uconnProxyFindQuery).AllowDiskUse().One(&res)
+			uconnProxyColl := ssn.DB(d.db.GetSelectedDB()).C(d.conf.T.Structure.UniqueConnProxyTable)
+
+			// if timestamps may be spilled to disk, count the connections before reading
+			// the timestamps in order to decide how to read them
+			spillThreshold := int64(d.conf.S.BeaconProxy.SpillThreshold)
+			if spillThreshold > 0 {
+				uconnProxyCountQuery := []bson.M{
+					{"$match": matchNoStrobeKey},
+					{"$limit": 1},
+					{"$project": bson.M{
+						"dur":   "$dat.dur",
+						"count": "$dat.count",
+					}},
+					{"$unwind": "$count"},
+					{"$group": bson.M{
+						"_id":   "$_id",
+						"dur":   bson.M{"$first": "$dur"},
+						"count": bson.M{"$sum": "$count"},
+					}},
+					{"$match": bson.M{"count": bson.M{"$gte": d.conf.S.BeaconProxy.DefaultConnectionThresh}}},
+				}
+				_ = uconnProxyColl.Pipe(uconnProxyCountQuery).AllowDiskUse().One(&res)
+			}
+
+			// strobes only need the connection count
+			spillTs := spillThreshold > 0 && res.Count > spillThreshold && res.Count <= d.connLimit
+			if spillThreshold == 0 || (res.Count > 0 && !spillTs && res.Count <= d.connLimit) {
+				_ = uconnProxyColl.Pipe(uconnProxyFindQuery).AllowDiskUse().One(&res)
+			}
 
 			// Check for errors and parse results
 			// this is here because it will still return an empty document even if there are no results
 			if res.Count > 0 {
 				analysisInput := &uconnproxy.Input{
 					Hosts:           datum.Hosts,
+					SrcSubnet:       datum.SrcSubnet,
 					Proxy:           datum.Proxy,
 					ConnectionCount: res.Count,
 				}
@@ -123,11 +178,45 @@ func (d *dissector) start() {
 
 				} else { // otherwise, parse timestamps
 
-					analysisInput.TsList = res.Ts
+					uniqueTs := int64(len(res.Ts))
+					if spillTs {
+						tsSpill, err := d.spillTimestamps(uconnProxyColl, matchNoStrobeKey)
+						if err != nil {
+							d.log.WithError(err).WithFields(log.Fields{
+								"src":  datum.Hosts.SrcIP,
+								"fqdn": datum.Hosts.FQDN,
+							}).Error("Could not spill the proxy beacon's timestamps to disk")
+							continue
+						}
+						analysisInput.TsSpill = tsSpill
+						uniqueTs = tsSpill.Len()
+					} else {
+						analysisInput.TsList = res.Ts
+					}
+
+					for _, durList := range res.Dur {
+						analysisInput.DurList = append(analysisInput.DurList, durList...)
+					}
+
+					if len(res.OrigBytes) > 0 {
+						analysisInput.OrigBytes = new(int64)
+						analysisInput.RespBytes = new(int64)
+						for i := range res.OrigBytes {
+							*analysisInput.OrigBytes += res.OrigBytes[i]
+						}
+						for i := range res.RespBytes {
+							*analysisInput.RespBytes += res.RespBytes[i]
+						}
+					}
+					for _, bytesList := range res.Bytes {
+						analysisInput.BytesList = append(analysisInput.BytesList, bytesList...)
+					}
 
 					// send to sorter channel if we have over UNIQUE 3 timestamps (analysis needs this verification)
-					if len(analysisInput.TsList) > 3 {
+					if uniqueTs > 3 {
 						d.dissectedCallback(analysisInput)
+					} else if analysisInput.TsSpill != nil {
+						analysisInput.TsSpill.Close()
 					}
 
 				}
@@ -136,3 +225,36 @@ func (d *dissector) start() {
 		d.dissectWg.Done()
 	}()
 }
+
+//spillTimestamps streams the timestamps of the uconnproxy entry matching the selector
+//into a sorted, deduplicated list on disk. At most SpillThreshold timestamps are held
+//in memory at once.
+func (d *dissector) spillTimestamps(uconnProxyColl *mgo.Collection, selector bson.M) (*spill.List, error) {
+	tsQuery := []bson.M{
+		{"$match": selector},
+		{"$limit": 1},
+		{"$project": bson.M{"ts": "$dat.ts"}},
+		{"$unwind": "$ts"},
+		{"$unwind": "$ts"},
+		{"$project": bson.M{"_id": 0, "ts": 1}},
+	}
+
+	sorter := spill.NewSorter(d.conf.S.BeaconProxy.SpillDir, d.conf.S.BeaconProxy.SpillThreshold, true)
+	defer sorter.Close()
+
+	var res struct {
+		Ts int64 `bson:"ts"`
+	}
+	iter := uconnProxyColl.Pipe(tsQuery).AllowDiskUse().Iter()
+	for iter.Next(&res) {
+		if err := sorter.Add(res.Ts); err != nil {
+			iter.Close()
+			return nil, err
+		}
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+
+	return sorter.Finish()
+}
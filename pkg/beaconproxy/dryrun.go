@@ -0,0 +1,106 @@
+package beaconproxy
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+//scoreHistogramBins is the number of equal width bins the scores from 0 to 1 are split into
+const scoreHistogramBins = 10
+
+type (
+	//scoreHistogram counts the proxy beacon scores falling into each bin
+	scoreHistogram struct {
+		bins    [scoreHistogramBins]int
+		strobes int
+	}
+
+	//dryRunRecorder takes the place of the writer when the analysis is run without
+	//modifying the database. It tallies the computed scores instead of writing them.
+	dryRunRecorder struct {
+		histogram scoreHistogram
+		lock      sync.Mutex
+		log       *log.Logger
+	}
+)
+
+//add records a score in the bin covering it
+func (h *scoreHistogram) add(score float64) {
+	bin := int(score * scoreHistogramBins)
+	if bin < 0 {
+		bin = 0
+	} else if bin >= scoreHistogramBins {
+		bin = scoreHistogramBins - 1
+	}
+	h.bins[bin]++
+}
+
+//total returns the number of scores in the histogram
+func (h *scoreHistogram) total() int {
+	total := 0
+	for _, count := range h.bins {
+		total += count
+	}
+	return total
+}
+
+//String renders the histogram as a table with one row per bin
+func (h *scoreHistogram) String() string {
+	const barWidth = 40
+
+	max := 0
+	for _, count := range h.bins {
+		if count > max {
+			max = count
+		}
+	}
+
+	var b strings.Builder
+	for i, count := range h.bins {
+		width := 0
+		if max > 0 {
+			width = count * barWidth / max
+		}
+		fmt.Fprintf(&b, "\t%.1f - %.1f | %-*s %d\n",
+			float64(i)/scoreHistogramBins, float64(i+1)/scoreHistogramBins,
+			barWidth, strings.Repeat("#", width), count,
+		)
+	}
+	fmt.Fprintf(&b, "\tscored: %d strobes: %d\n", h.total(), h.strobes)
+	return b.String()
+}
+
+//newDryRunRecorder creates a recorder for the results of a dry run
+func newDryRunRecorder(log *log.Logger) *dryRunRecorder {
+	return &dryRunRecorder{log: log}
+}
+
+//collect records an analyzed result in place of writing it
+func (d *dryRunRecorder) collect(data *update) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if data.beacon.query != nil {
+		d.histogram.add(data.score)
+	} else if data.uconnproxy.query != nil {
+		d.histogram.strobes++
+	}
+}
+
+//close reports the distribution of the recorded scores
+func (d *dryRunRecorder) close() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.log.WithFields(log.Fields{
+		"Module":  "beaconsProxy",
+		"Scored":  d.histogram.total(),
+		"Strobes": d.histogram.strobes,
+		"Bins":    d.histogram.bins,
+	}).Info("Proxy beacon dry run complete")
+
+	fmt.Printf("\t[-] Proxy Beacon Dry Run Score Distribution:\n%s", d.histogram.String())
+}
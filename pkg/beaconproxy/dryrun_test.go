@@ -0,0 +1,34 @@
+package beaconproxy
+
+import (
+	"testing"
+
+	"github.com/globalsign/mgo/bson"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScoreHistogram(t *testing.T) {
+	var h scoreHistogram
+	for _, score := range []float64{0, 0.05, 0.1, 0.55, 0.99, 1.0} {
+		h.add(score)
+	}
+
+	require.Equal(t, [scoreHistogramBins]int{2, 1, 0, 0, 0, 1, 0, 0, 0, 2}, h.bins)
+	require.Equal(t, 6, h.total())
+	require.Contains(t, h.String(), "0.9 - 1.0 | ")
+}
+
+func TestDryRunRecorder(t *testing.T) {
+	recorder := newDryRunRecorder(log.New())
+
+	recorder.collect(&update{beacon: updateInfo{query: bson.M{}}, score: 0.85})
+	recorder.collect(&update{beacon: updateInfo{query: bson.M{}}, score: 0.15})
+	recorder.collect(&update{uconnproxy: updateInfo{query: bson.M{}}})
+	recorder.close()
+
+	require.Equal(t, 2, recorder.histogram.total())
+	require.Equal(t, 1, recorder.histogram.bins[8])
+	require.Equal(t, 1, recorder.histogram.bins[1])
+	require.Equal(t, 1, recorder.histogram.strobes)
+}
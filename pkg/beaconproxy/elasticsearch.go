@@ -0,0 +1,256 @@
+package beaconproxy
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/activecm/rita/config"
+	"github.com/activecm/rita/pkg/data"
+	"github.com/globalsign/mgo/bson"
+	log "github.com/sirupsen/logrus"
+)
+
+//esTimeout bounds each request to Elasticsearch so an unresponsive cluster can't
+//stall the analysis
+const esTimeout = 30 * time.Second
+
+type (
+	//esSink indexes the analyzed proxy beacons into Elasticsearch. It sits next to
+	//the writer and receives the same updates.
+	esSink struct {
+		client       *http.Client
+		url          string
+		index        string
+		database     string
+		timestamp    string
+		batchSize    int
+		log          *log.Logger
+		writeChannel chan *update
+		writeWg      sync.WaitGroup
+	}
+
+	//esBulkResponse holds the parts of a bulk API response used to report failures
+	esBulkResponse struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			ID     string `json:"_id"`
+			Status int    `json:"status"`
+			Error  struct {
+				Type   string `json:"type"`
+				Reason string `json:"reason"`
+			} `json:"error"`
+		} `json:"items"`
+	}
+)
+
+//newESSink creates an esSink which indexes the results of the given database. The
+//index name is templated with the date the analysis started.
+func newESSink(database string, conf *config.Config, log *log.Logger, started time.Time) *esSink {
+	batchSize := conf.S.BeaconProxy.WriteBatchSize
+	if batchSize < 1 {
+		batchSize = 1
+	}
+
+	started = started.UTC()
+	esConf := conf.S.BeaconProxy.Elasticsearch
+
+	return &esSink{
+		client:       &http.Client{Timeout: esTimeout},
+		url:          strings.TrimSuffix(esConf.URL, "/"),
+		index:        strings.Replace(esConf.Index, "{date}", started.Format("2006.01.02"), -1),
+		database:     database,
+		timestamp:    started.Format(time.RFC3339),
+		batchSize:    batchSize,
+		log:          log,
+		writeChannel: make(chan *update),
+	}
+}
+
+//ping checks that Elasticsearch is reachable
+func (s *esSink) ping() error {
+	resp, err := s.client.Get(s.url + "/")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("elasticsearch responded with %s", resp.Status)
+	}
+	return nil
+}
+
+//collect sends a group of results to the sink for indexing
+func (s *esSink) collect(data *update) {
+	s.writeChannel <- data
+}
+
+//close waits for the indexing thread to finish
+func (s *esSink) close() {
+	close(s.writeChannel)
+	s.writeWg.Wait()
+}
+
+//start kicks off the indexing thread. Updates are sent to the bulk API in batches
+//of BeaconProxy.WriteBatchSize.
+func (s *esSink) start() {
+	s.writeWg.Add(1)
+	go func() {
+		var batch bytes.Buffer
+		pending := 0
+
+		for data := range s.writeChannel {
+			if s.queue(&batch, data) {
+				pending++
+			}
+			if pending >= s.batchSize {
+				s.flush(&batch, pending)
+				pending = 0
+			}
+		}
+
+		s.flush(&batch, pending)
+		s.writeWg.Done()
+	}()
+}
+
+//queue appends the bulk action for an update to the batch. Scored proxy beacons are
+//indexed and proxy beacons which turned into strobes are deleted. Returns false if
+//the update has nothing to index.
+func (s *esSink) queue(batch *bytes.Buffer, data *update) bool {
+	var action map[string]interface{}
+	var document map[string]interface{}
+
+	if data.beacon.query != nil {
+		action = map[string]interface{}{
+			"index": map[string]string{"_index": s.index, "_id": s.documentID(data.beacon.selector)},
+		}
+		document = s.document(data.beacon.selector, data.beacon.query)
+	} else if data.uconnproxy.query != nil {
+		action = map[string]interface{}{
+			"delete": map[string]string{"_index": s.index, "_id": s.documentID(data.uconnproxy.selector)},
+		}
+	} else {
+		return false
+	}
+
+	encoder := json.NewEncoder(batch)
+	if err := encoder.Encode(action); err != nil {
+		s.log.WithError(err).Error("Could not encode Elasticsearch bulk action")
+		return false
+	}
+	if document != nil {
+		if err := encoder.Encode(document); err != nil {
+			s.log.WithError(err).Error("Could not encode Elasticsearch document")
+			return false
+		}
+	}
+	return true
+}
+
+//flush sends the queued actions to the bulk API. Failures are logged rather than
+//interrupting the analysis since MongoDB holds the results.
+func (s *esSink) flush(batch *bytes.Buffer, pending int) {
+	if pending == 0 {
+		return
+	}
+	defer batch.Reset()
+
+	fields := log.Fields{
+		"Module":  "beaconsProxy",
+		"Index":   s.index,
+		"Pending": pending,
+	}
+
+	resp, err := s.client.Post(s.url+"/_bulk", "application/x-ndjson", bytes.NewReader(batch.Bytes()))
+	if err != nil {
+		s.log.WithFields(fields).Error(err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(ioutil.Discard, resp.Body)
+		s.log.WithFields(fields).Errorf("elasticsearch bulk request failed with %s", resp.Status)
+		return
+	}
+
+	var result esBulkResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		s.log.WithFields(fields).Error(err)
+		return
+	}
+	if !result.Errors {
+		return
+	}
+
+	failed := 0
+	for _, item := range result.Items {
+		for _, status := range item {
+			// deleting a proxy beacon which was never indexed isn't a failure
+			if status.Status >= 300 && status.Status != http.StatusNotFound {
+				if failed == 0 {
+					fields["Reason"] = status.Error.Type + ": " + status.Error.Reason
+				}
+				failed++
+			}
+		}
+	}
+	if failed > 0 {
+		fields["Failed"] = failed
+		s.log.WithFields(fields).Error("elasticsearch rejected proxy beacon documents")
+	}
+}
+
+//documentID derives the id of a proxy beacon's document from its src/FQDN BSONKey and
+//the database so the document is replaced as the proxy beacon is updated
+func (s *esSink) documentID(selector bson.M) string {
+	hash := sha1.New()
+	fmt.Fprintf(hash, "%s\x00%v\x00%s\x00%s", s.database, selector["src"], esValue(selector["src_network_uuid"]), selector["fqdn"])
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+//document builds the Elasticsearch document for a proxy beacon from the fields
+//of its MongoDB selector and update
+func (s *esSink) document(selector bson.M, query bson.M) map[string]interface{} {
+	document := map[string]interface{}{
+		"@timestamp": s.timestamp,
+		"database":   s.database,
+	}
+	for key, value := range selector {
+		document[key] = esValue(value)
+	}
+	// dotted field names such as ts.score are expanded into objects by Elasticsearch
+	if set, ok := query["$set"].(bson.M); ok {
+		for key, value := range set {
+			document[key] = esValue(value)
+		}
+	}
+	return document
+}
+
+//esValue converts the MongoDB specific values of an update into their JSON form
+func esValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case bson.Binary:
+		return formatUUID(v)
+	case data.UniqueIP:
+		return map[string]string{
+			"ip":           v.IP,
+			"network_uuid": formatUUID(v.NetworkUUID),
+			"network_name": v.NetworkName,
+		}
+	default:
+		return value
+	}
+}
@@ -0,0 +1,190 @@
+package beaconproxy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/activecm/rita/config"
+	"github.com/activecm/rita/pkg/data"
+	"github.com/activecm/rita/util"
+	"github.com/globalsign/mgo/bson"
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/require"
+)
+
+//mockES records the bulk requests sent to it
+type mockES struct {
+	lock     sync.Mutex
+	requests [][]map[string]interface{}
+	response string
+}
+
+func (m *mockES) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/" {
+		w.Write([]byte(`{"tagline": "You Know, for Search"}`))
+		return
+	}
+	if r.URL.Path != "/_bulk" || r.Method != http.MethodPost {
+		http.NotFound(w, r)
+		return
+	}
+
+	body, _ := ioutil.ReadAll(r.Body)
+	var lines []map[string]interface{}
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		var line map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		lines = append(lines, line)
+	}
+
+	m.lock.Lock()
+	m.requests = append(m.requests, lines)
+	m.lock.Unlock()
+
+	response := m.response
+	if response == "" {
+		response = `{"errors": false, "items": []}`
+	}
+	w.Write([]byte(response))
+}
+
+func testESSink(t *testing.T, url string, batchSize int) (*esSink, *test.Hook) {
+	conf, err := config.LoadTestingConfig("")
+	require.Nil(t, err)
+	conf.S.BeaconProxy.Elasticsearch.URL = url + "/"
+	conf.S.BeaconProxy.WriteBatchSize = batchSize
+
+	logger, hook := test.NewNullLogger()
+	started := time.Date(2021, 6, 1, 23, 30, 0, 0, time.FixedZone("EST", -5*60*60))
+	return newESSink("test_db", conf, logger, started), hook
+}
+
+func testESHosts(srcIP string, fqdn string) data.UniqueSrcFQDNPair {
+	return data.UniqueSrcFQDNPair{
+		UniqueSrcIP: data.UniqueSrcIP{
+			SrcIP:          srcIP,
+			SrcNetworkUUID: util.UnknownPrivateNetworkUUID,
+			SrcNetworkName: util.UnknownPrivateNetworkName,
+		},
+		FQDN: fqdn,
+	}
+}
+
+func TestESSinkBulk(t *testing.T) {
+	mock := &mockES{}
+	server := httptest.NewServer(mock)
+	defer server.Close()
+
+	sink, hook := testESSink(t, server.URL, 2)
+	require.Nil(t, sink.ping())
+	require.Equal(t, "rita-beaconproxy-2021.06.02", sink.index)
+
+	hosts := testESHosts("10.0.0.1", "example.com")
+	strobeHosts := testESHosts("10.0.0.2", "example.org")
+
+	sink.start()
+	sink.collect(&update{
+		beacon: updateInfo{
+			selector: hosts.BSONKey(),
+			query: bson.M{"$set": bson.M{
+				"score":    0.9,
+				"ts.score": 0.85,
+				"proxy":    data.UniqueIP{IP: "10.0.0.100", NetworkUUID: util.UnknownPrivateNetworkUUID, NetworkName: util.UnknownPrivateNetworkName},
+			}},
+		},
+	})
+	// updates without a result to index are skipped
+	sink.collect(&update{})
+	sink.collect(&update{
+		uconnproxy: updateInfo{
+			selector: strobeHosts.BSONKey(),
+			query:    bson.M{"$set": bson.M{"strobeFQDN": true}},
+		},
+	})
+	// a second update to the same proxy beacon replaces the same document
+	sink.collect(&update{
+		beacon: updateInfo{
+			selector: hosts.BSONKey(),
+			query:    bson.M{"$set": bson.M{"score": 0.95}},
+		},
+	})
+	sink.close()
+
+	require.Empty(t, hook.AllEntries())
+
+	// the batch is flushed once it is full and when the sink is closed
+	require.Len(t, mock.requests, 2)
+	require.Len(t, mock.requests[0], 3)
+	require.Len(t, mock.requests[1], 2)
+
+	index := mock.requests[0][0]["index"].(map[string]interface{})
+	require.Equal(t, "rita-beaconproxy-2021.06.02", index["_index"])
+	docID := index["_id"].(string)
+	require.Len(t, docID, 40)
+
+	require.Equal(t, map[string]interface{}{
+		"@timestamp":       "2021-06-02T04:30:00Z",
+		"database":         "test_db",
+		"src":              "10.0.0.1",
+		"src_network_uuid": "ffffffff-ffff-ffff-ffff-fffffffffffe",
+		"fqdn":             "example.com",
+		"score":            0.9,
+		"ts.score":         0.85,
+		"proxy": map[string]interface{}{
+			"ip":           "10.0.0.100",
+			"network_uuid": "ffffffff-ffff-ffff-ffff-fffffffffffe",
+			"network_name": util.UnknownPrivateNetworkName,
+		},
+	}, mock.requests[0][1])
+
+	deleted := mock.requests[0][2]["delete"].(map[string]interface{})
+	require.NotEqual(t, docID, deleted["_id"])
+
+	reindex := mock.requests[1][0]["index"].(map[string]interface{})
+	require.Equal(t, docID, reindex["_id"])
+	require.Equal(t, 0.95, mock.requests[1][1]["score"])
+}
+
+func TestESSinkBulkErrors(t *testing.T) {
+	mock := &mockES{response: `{"errors": true, "items": [
+		{"delete": {"_id": "a", "status": 404}},
+		{"index": {"_id": "b", "status": 400, "error": {"type": "mapper_parsing_exception", "reason": "failed to parse"}}}
+	]}`}
+	server := httptest.NewServer(mock)
+	defer server.Close()
+
+	sink, hook := testESSink(t, server.URL, 10)
+	hosts := testESHosts("10.0.0.1", "example.com")
+
+	sink.start()
+	sink.collect(&update{beacon: updateInfo{selector: hosts.BSONKey(), query: bson.M{"$set": bson.M{"score": 0.9}}}})
+	sink.close()
+
+	// missing documents which were deleted are not reported
+	require.Len(t, hook.AllEntries(), 1)
+	entry := hook.LastEntry()
+	require.Equal(t, log.ErrorLevel, entry.Level)
+	require.Equal(t, 1, entry.Data["Failed"])
+	require.Equal(t, "mapper_parsing_exception: failed to parse", entry.Data["Reason"])
+}
+
+func TestESSinkUnreachable(t *testing.T) {
+	server := httptest.NewServer(&mockES{})
+	url := server.URL
+	server.Close()
+
+	sink, _ := testESSink(t, url, 10)
+	require.NotNil(t, sink.ping())
+}
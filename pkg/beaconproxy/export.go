@@ -0,0 +1,171 @@
+package beaconproxy
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+
+	"github.com/activecm/rita/resources"
+	"github.com/globalsign/mgo/bson"
+	"github.com/google/uuid"
+)
+
+type (
+	//ExportRecord is a proxy beacon as it is written to NDJSON exports
+	ExportRecord struct {
+		Src              string         `json:"src"`
+		SrcNetworkName   string         `json:"src_network_name"`
+		SrcNetworkUUID   string         `json:"src_network_uuid"`
+		FQDN             string         `json:"fqdn"`
+		Proxy            string         `json:"proxy"`
+		ProxyNetworkName string         `json:"proxy_network_name"`
+		ProxyNetworkUUID string         `json:"proxy_network_uuid"`
+		CID              int            `json:"cid"`
+		Connections      int64          `json:"connection_count"`
+		Score            float64        `json:"score"`
+		ScoreBand        string         `json:"score_band"`
+		LowConfidence    bool           `json:"low_confidence"`
+		Ts               ExportTSData   `json:"ts"`
+		Dur              *ExportDurData `json:"dur,omitempty"`
+		TsList           []int64        `json:"tslist"`
+		TsListCount      int64          `json:"tslist_count"`
+	}
+
+	//ExportTSData holds the timestamp score breakdown of an exported proxy beacon
+	ExportTSData struct {
+		Score           float64  `json:"score"`
+		Range           int64    `json:"range"`
+		Mode            int64    `json:"mode"`
+		ModeCount       int64    `json:"mode_count"`
+		Skew            float64  `json:"skew"`
+		Dispersion      int64    `json:"dispersion"`
+		SkewScore       float64  `json:"skew_score"`
+		DispersionScore float64  `json:"dispersion_score"`
+		ConnsScore      float64  `json:"conns_score"`
+		AutocorrScore   *float64 `json:"autocorr_score,omitempty"`
+		DriftSlope      *float64 `json:"drift_slope,omitempty"`
+		DriftScore      *float64 `json:"drift_score,omitempty"`
+		Intervals       []int64  `json:"intervals"`
+		IntervalCounts  []int64  `json:"interval_counts"`
+	}
+
+	//ExportDurData holds the duration score breakdown of an exported proxy beacon
+	ExportDurData struct {
+		Skew       float64 `json:"skew"`
+		Dispersion float64 `json:"dispersion"`
+		Score      float64 `json:"score"`
+	}
+)
+
+//Export writes the proxy beacons of the selected database scoring at least minScore to
+//the writer as newline delimited JSON, highest scores first. If chunk is not negative,
+//only the proxy beacons last updated in that chunk are exported. Returns the number of
+//proxy beacons written.
+func Export(res *resources.Resources, chunk int, minScore float64, w io.Writer) (int, error) {
+	encoder := json.NewEncoder(w)
+	return StreamExport(context.Background(), res, res.DB.GetSelectedDB(), chunk, minScore,
+		func(record ExportRecord) error {
+			return encoder.Encode(record)
+		},
+	)
+}
+
+//StreamExport reads the proxy beacons of the given database scoring at least minScore,
+//highest scores first, and hands each one to the callback as soon as it is read. If chunk
+//is not negative, only the proxy beacons last updated in that chunk are read. Reading stops
+//at the first error returned by the callback or once the context is done. Returns the
+//number of proxy beacons handed to the callback.
+func StreamExport(ctx context.Context, res *resources.Resources, database string, chunk int,
+	minScore float64, callback func(ExportRecord) error) (int, error) {
+
+	ssn := res.DB.Session.Copy()
+	defer ssn.Close()
+
+	query := bson.M{"score": bson.M{"$gte": minScore}}
+	if chunk >= 0 {
+		query["cid"] = chunk
+	}
+
+	iter := ssn.DB(database).C(res.Config.T.BeaconProxy.BeaconProxyTable).
+		Find(query).Sort("-score").Iter()
+
+	count := 0
+	var result Result
+	for iter.Next(&result) {
+		if err := ctx.Err(); err != nil {
+			iter.Close()
+			return count, err
+		}
+		if err := callback(newExportRecord(result)); err != nil {
+			iter.Close()
+			return count, err
+		}
+		count++
+		// clear out the slices so they aren't carried into the next result
+		result = Result{}
+	}
+	return count, iter.Close()
+}
+
+//newExportRecord converts a proxy beacon into the format written to exports
+func newExportRecord(result Result) ExportRecord {
+	record := ExportRecord{
+		Src:              result.SrcIP,
+		SrcNetworkName:   result.SrcNetworkName,
+		SrcNetworkUUID:   formatUUID(result.SrcNetworkUUID),
+		FQDN:             result.FQDN,
+		Proxy:            result.Proxy.IP,
+		ProxyNetworkName: result.Proxy.NetworkName,
+		ProxyNetworkUUID: formatUUID(result.Proxy.NetworkUUID),
+		CID:              result.CID,
+		Connections:      result.Connections,
+		Score:            result.Score,
+		ScoreBand:        result.ScoreBand,
+		LowConfidence:    result.LowConfidence,
+		Ts: ExportTSData{
+			Score:           result.Ts.Score,
+			Range:           result.Ts.Range,
+			Mode:            result.Ts.Mode,
+			ModeCount:       result.Ts.ModeCount,
+			Skew:            result.Ts.Skew,
+			Dispersion:      result.Ts.Dispersion,
+			SkewScore:       result.Ts.SkewScore,
+			DispersionScore: result.Ts.DispersionScore,
+			ConnsScore:      result.Ts.ConnsScore,
+			Intervals:       nonNilInt64s(result.Ts.Intervals),
+			IntervalCounts:  nonNilInt64s(result.Ts.IntervalCounts),
+		},
+		TsList:      nonNilInt64s(result.TsList),
+		TsListCount: result.TsListCount,
+	}
+
+	// the optional scores are left out unless they were recorded
+	record.Ts.AutocorrScore = result.Ts.AutocorrScore
+	record.Ts.DriftSlope = result.Ts.DriftSlope
+	record.Ts.DriftScore = result.Ts.DriftScore
+	if result.Dur != (DurData{}) {
+		record.Dur = &ExportDurData{
+			Skew:       result.Dur.Skew,
+			Dispersion: result.Dur.Dispersion,
+			Score:      result.Dur.Score,
+		}
+	}
+	return record
+}
+
+//formatUUID formats a network UUID in its canonical text form
+func formatUUID(binary bson.Binary) string {
+	id, err := uuid.FromBytes(binary.Data)
+	if err != nil {
+		return ""
+	}
+	return id.String()
+}
+
+//nonNilInt64s ensures empty arrays are written as [] rather than null
+func nonNilInt64s(values []int64) []int64 {
+	if values == nil {
+		return []int64{}
+	}
+	return values
+}
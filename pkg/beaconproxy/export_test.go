@@ -0,0 +1,95 @@
+package beaconproxy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/activecm/rita/pkg/data"
+	"github.com/activecm/rita/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewExportRecord(t *testing.T) {
+	// scores of 0 are poor fits rather than missing scores
+	autocorrScore, driftSlope, driftScore := 0.0, -0.25, 0.0
+	results := []Result{
+		{
+			FQDN:           "example.com",
+			SrcIP:          "10.0.0.1",
+			SrcNetworkName: util.UnknownPrivateNetworkName,
+			SrcNetworkUUID: util.UnknownPrivateNetworkUUID,
+			Connections:    24,
+			Ts: TSData{
+				Range: 0, Mode: 60, ModeCount: 23, Skew: 0, Dispersion: 0,
+				SkewScore: 1, DispersionScore: 1, ConnsScore: 0.5, AutocorrScore: &autocorrScore, Score: 0.85,
+				DriftSlope: &driftSlope, DriftScore: &driftScore,
+				Intervals: []int64{60}, IntervalCounts: []int64{23},
+			},
+			Dur:       DurData{Skew: 0.1, Dispersion: 0.2, Score: 0.8},
+			Score:     0.85,
+			ScoreBand: "high",
+			Proxy:     data.UniqueIP{IP: "8.8.8.8", NetworkUUID: util.PublicNetworkUUID, NetworkName: util.PublicNetworkName},
+			CID:       2,
+			// the stored timestamps were truncated
+			TsList:      []int64{1234560, 1234620},
+			TsListCount: 24,
+		},
+		// a proxy beacon without the optional scores
+		{
+			FQDN:          "example.org",
+			SrcIP:         "10.0.0.2",
+			Score:         0.5,
+			LowConfidence: true,
+		},
+	}
+
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	for _, result := range results {
+		require.Nil(t, encoder.Encode(newExportRecord(result)))
+	}
+
+	// each proxy beacon is written on its own line and parses back into the same record
+	var records []ExportRecord
+	scanner := bufio.NewScanner(&buffer)
+	for scanner.Scan() {
+		var record ExportRecord
+		require.Nil(t, json.Unmarshal(scanner.Bytes(), &record))
+		records = append(records, record)
+	}
+	require.Len(t, records, 2)
+
+	require.Equal(t, ExportRecord{
+		Src:              "10.0.0.1",
+		SrcNetworkName:   util.UnknownPrivateNetworkName,
+		SrcNetworkUUID:   "ffffffff-ffff-ffff-ffff-fffffffffffe",
+		FQDN:             "example.com",
+		Proxy:            "8.8.8.8",
+		ProxyNetworkName: util.PublicNetworkName,
+		ProxyNetworkUUID: formatUUID(util.PublicNetworkUUID),
+		CID:              2,
+		Connections:      24,
+		Score:            0.85,
+		ScoreBand:        "high",
+		Ts: ExportTSData{
+			Score: 0.85, Range: 0, Mode: 60, ModeCount: 23, Skew: 0, Dispersion: 0,
+			SkewScore: 1, DispersionScore: 1, ConnsScore: 0.5, AutocorrScore: &autocorrScore,
+			DriftSlope: &driftSlope, DriftScore: &driftScore,
+			Intervals: []int64{60}, IntervalCounts: []int64{23},
+		},
+		Dur:         &ExportDurData{Skew: 0.1, Dispersion: 0.2, Score: 0.8},
+		TsList:      []int64{1234560, 1234620},
+		TsListCount: 24,
+	}, records[0])
+
+	require.Nil(t, records[1].Dur)
+	require.True(t, records[1].LowConfidence)
+	require.Nil(t, records[1].Ts.AutocorrScore)
+	require.Nil(t, records[1].Ts.DriftSlope)
+	require.Nil(t, records[1].Ts.DriftScore)
+	require.Equal(t, []int64{}, records[1].TsList)
+	require.Equal(t, []int64{}, records[1].Ts.Intervals)
+	require.NotContains(t, buffer.String(), "null")
+}
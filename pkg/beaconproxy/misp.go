@@ -0,0 +1,153 @@
+package beaconproxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/activecm/rita/config"
+	"github.com/activecm/rita/resources"
+	"github.com/google/uuid"
+)
+
+//MISP threat levels, ordered from the most to the least severe
+const (
+	mispThreatHigh      = "1"
+	mispThreatMedium    = "2"
+	mispThreatLow       = "3"
+	mispThreatUndefined = "4"
+)
+
+const (
+	//mispAnalysisInitial marks an event whose analysis has only begun
+	mispAnalysisInitial = "0"
+	//mispDistributionOrganization limits an event to the organization which created it
+	mispDistributionOrganization = "0"
+	//mispCategory is the category of every attribute in a proxy beacon event
+	mispCategory = "Network activity"
+)
+
+type (
+	//MISPEvent wraps an event in the form the MISP API and feeds exchange it
+	MISPEvent struct {
+		Event MISPEventBody `json:"Event"`
+	}
+
+	//MISPEventBody is a MISP event holding the attributes of the exported proxy beacons
+	MISPEventBody struct {
+		UUID          string          `json:"uuid"`
+		Info          string          `json:"info"`
+		Date          string          `json:"date"`
+		Timestamp     string          `json:"timestamp"`
+		ThreatLevelID string          `json:"threat_level_id"`
+		Analysis      string          `json:"analysis"`
+		Distribution  string          `json:"distribution"`
+		Published     bool            `json:"published"`
+		Attribute     []MISPAttribute `json:"Attribute"`
+	}
+
+	//MISPAttribute is a domain or source address seen in proxy beacons
+	MISPAttribute struct {
+		UUID         string `json:"uuid"`
+		Type         string `json:"type"`
+		Category     string `json:"category"`
+		Value        string `json:"value"`
+		ToIDS        bool   `json:"to_ids"`
+		Comment      string `json:"comment"`
+		Timestamp    string `json:"timestamp"`
+		Distribution string `json:"distribution"`
+	}
+)
+
+//ExportMISP writes the proxy beacons of the selected database scoring above minScore to
+//the writer as a MISP event. Returns the number of proxy beacons in the event.
+func ExportMISP(res *resources.Resources, minScore float64, w io.Writer) (int, error) {
+	results, err := Results(res, minScore)
+	if err != nil {
+		return 0, err
+	}
+
+	event := newMISPEvent(results, &res.Config.S.BeaconProxy.MISP, time.Now())
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return len(results), encoder.Encode(event)
+}
+
+//newMISPEvent builds an event created at the given time with a domain and ip-src attribute
+//for each proxy beacon. MISP rejects events holding the same attribute twice, so beacons
+//sharing a source or FQDN share its attribute, whose comment lists each of them. The threat
+//level of the event is set by the highest scoring beacon.
+func newMISPEvent(results []Result, conf *config.BeaconProxyMISPStaticCfg, created time.Time) MISPEvent {
+	timestamp := strconv.FormatInt(created.Unix(), 10)
+	event := MISPEvent{
+		Event: MISPEventBody{
+			UUID:          uuid.New().String(),
+			Info:          conf.Info,
+			Date:          created.UTC().Format("2006-01-02"),
+			Timestamp:     timestamp,
+			ThreatLevelID: mispThreatUndefined,
+			Analysis:      mispAnalysisInitial,
+			Distribution:  mispDistributionOrganization,
+			Attribute:     make([]MISPAttribute, 0, len(results)*2),
+		},
+	}
+
+	// the index of each attribute by its type and value
+	seen := make(map[string]int)
+	addAttribute := func(attrType string, value string, comment string) {
+		key := attrType + "|" + value
+		if idx, ok := seen[key]; ok {
+			event.Event.Attribute[idx].Comment += "; " + comment
+			return
+		}
+		seen[key] = len(event.Event.Attribute)
+		event.Event.Attribute = append(event.Event.Attribute, MISPAttribute{
+			UUID:     uuid.New().String(),
+			Type:     attrType,
+			Category: mispCategory,
+			Value:    value,
+			// the sources are internal hosts, which shouldn't be blocked by an IDS
+			ToIDS:        attrType == "domain",
+			Comment:      comment,
+			Timestamp:    timestamp,
+			Distribution: mispDistributionOrganization,
+		})
+	}
+
+	var maxScore float64
+	for _, result := range results {
+		comment := fmt.Sprintf(
+			"proxy beacon from %s to %s: interval %ds, score %s",
+			result.SrcIP, result.FQDN, result.Ts.Mode, strconv.FormatFloat(result.Score, 'f', 3, 64),
+		)
+		addAttribute("domain", result.FQDN, comment)
+		addAttribute("ip-src", result.SrcIP, comment)
+
+		if result.Score > maxScore {
+			maxScore = result.Score
+		}
+	}
+	if len(results) > 0 {
+		event.Event.ThreatLevelID = mispThreatLevel(maxScore, &conf.ThreatLevels)
+	}
+
+	return event
+}
+
+//mispThreatLevel maps a score onto the threat level of the highest band it reaches.
+//Scores below every band are given an undefined threat level.
+func mispThreatLevel(score float64, bands *config.MISPThreatLevelsStaticCfg) string {
+	switch {
+	case score >= bands.High:
+		return mispThreatHigh
+	case score >= bands.Medium:
+		return mispThreatMedium
+	case score >= bands.Low:
+		return mispThreatLow
+	default:
+		return mispThreatUndefined
+	}
+}
@@ -0,0 +1,170 @@
+package beaconproxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/activecm/rita/config"
+	"github.com/activecm/rita/pkg/data"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+//testMISPConfig holds the default MISP export settings
+var testMISPConfig = config.BeaconProxyMISPStaticCfg{
+	MinScore: 0.8,
+	Info:     "RITA proxy beacons",
+	ThreatLevels: config.MISPThreatLevelsStaticCfg{
+		High:   0.95,
+		Medium: 0.85,
+		Low:    0.7,
+	},
+}
+
+//requireMISPEvent checks the JSON of an event against the fields and formats MISP
+//requires of the events it imports and returns the decoded event
+func requireMISPEvent(t *testing.T, eventJSON []byte) map[string]interface{} {
+	var wrapper map[string]map[string]interface{}
+	require.Nil(t, json.Unmarshal(eventJSON, &wrapper))
+	require.Len(t, wrapper, 1)
+	event, ok := wrapper["Event"]
+	require.True(t, ok, "the event must be wrapped in an Event object")
+
+	for _, field := range []string{"uuid", "info", "date", "timestamp", "threat_level_id", "analysis", "distribution"} {
+		require.IsType(t, "", event[field], field)
+	}
+	require.IsType(t, false, event["published"])
+	_, err := uuid.Parse(event["uuid"].(string))
+	require.Nil(t, err)
+	require.NotEmpty(t, event["info"])
+	require.Regexp(t, regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`), event["date"])
+	_, err = strconv.ParseInt(event["timestamp"].(string), 10, 64)
+	require.Nil(t, err)
+	require.Contains(t, []string{"1", "2", "3", "4"}, event["threat_level_id"])
+	require.Contains(t, []string{"0", "1", "2"}, event["analysis"])
+	require.Contains(t, []string{"0", "1", "2", "3", "4", "5"}, event["distribution"])
+
+	attributes, ok := event["Attribute"].([]interface{})
+	require.True(t, ok, "the attributes must be a list")
+	seen := make(map[string]bool)
+	for _, attr := range attributes {
+		attribute := attr.(map[string]interface{})
+		for _, field := range []string{"uuid", "type", "category", "value", "comment", "timestamp", "distribution"} {
+			require.IsType(t, "", attribute[field], field)
+		}
+		require.IsType(t, false, attribute["to_ids"])
+		_, err := uuid.Parse(attribute["uuid"].(string))
+		require.Nil(t, err)
+		require.Contains(t, []string{"domain", "ip-src"}, attribute["type"])
+		require.Equal(t, "Network activity", attribute["category"])
+		require.NotEmpty(t, attribute["value"])
+
+		// MISP rejects events holding the same attribute twice
+		key := attribute["type"].(string) + "|" + attribute["value"].(string)
+		require.False(t, seen[key], key)
+		seen[key] = true
+	}
+	return event
+}
+
+func TestMISPEvent(t *testing.T) {
+	results := []Result{
+		{
+			FQDN:        "example.com",
+			SrcIP:       "10.0.0.1",
+			Connections: 24,
+			Ts:          TSData{Mode: 60},
+			Score:       0.853,
+			Proxy:       data.UniqueIP{IP: "10.0.0.100"},
+		},
+		// the source is shared with the first beacon
+		{
+			FQDN:        "example.org",
+			SrcIP:       "10.0.0.1",
+			Connections: 40,
+			Ts:          TSData{Mode: 300},
+			Score:       0.91,
+			Proxy:       data.UniqueIP{IP: "10.0.0.100"},
+		},
+		{
+			FQDN:        "example.org",
+			SrcIP:       "fd00::1",
+			Connections: 30,
+			Ts:          TSData{Mode: 120},
+			Score:       0.82,
+			Proxy:       data.UniqueIP{IP: "10.0.0.100"},
+		},
+	}
+
+	created := time.Date(2021, 6, 1, 12, 30, 0, 0, time.UTC)
+	var buffer bytes.Buffer
+	require.Nil(t, json.NewEncoder(&buffer).Encode(newMISPEvent(results, &testMISPConfig, created)))
+
+	event := requireMISPEvent(t, buffer.Bytes())
+	require.Equal(t, "RITA proxy beacons", event["info"])
+	require.Equal(t, "2021-06-01", event["date"])
+	require.Equal(t, "1622550600", event["timestamp"])
+	require.Equal(t, false, event["published"])
+	// the highest score is in the medium band
+	require.Equal(t, "2", event["threat_level_id"])
+
+	type attribute struct {
+		attrType string
+		value    string
+		toIDS    bool
+		comment  string
+	}
+	var attributes []attribute
+	for _, attr := range event["Attribute"].([]interface{}) {
+		a := attr.(map[string]interface{})
+		attributes = append(attributes, attribute{
+			a["type"].(string), a["value"].(string), a["to_ids"].(bool), a["comment"].(string),
+		})
+	}
+	require.Equal(t, []attribute{
+		{"domain", "example.com", true,
+			"proxy beacon from 10.0.0.1 to example.com: interval 60s, score 0.853"},
+		{"ip-src", "10.0.0.1", false,
+			"proxy beacon from 10.0.0.1 to example.com: interval 60s, score 0.853; " +
+				"proxy beacon from 10.0.0.1 to example.org: interval 300s, score 0.910"},
+		{"domain", "example.org", true,
+			"proxy beacon from 10.0.0.1 to example.org: interval 300s, score 0.910; " +
+				"proxy beacon from fd00::1 to example.org: interval 120s, score 0.820"},
+		{"ip-src", "fd00::1", false,
+			"proxy beacon from fd00::1 to example.org: interval 120s, score 0.820"},
+	}, attributes)
+}
+
+func TestMISPEventEmpty(t *testing.T) {
+	var buffer bytes.Buffer
+	require.Nil(t, json.NewEncoder(&buffer).Encode(newMISPEvent(nil, &testMISPConfig, time.Now())))
+
+	event := requireMISPEvent(t, buffer.Bytes())
+	require.Equal(t, "4", event["threat_level_id"])
+	require.Empty(t, event["Attribute"])
+}
+
+func TestMISPThreatLevel(t *testing.T) {
+	bands := &config.MISPThreatLevelsStaticCfg{High: 0.9, Medium: 0.8, Low: 0.6}
+
+	cases := []struct {
+		score    float64
+		expected string
+	}{
+		{1, "1"},
+		{0.9, "1"},
+		{0.89, "2"},
+		{0.8, "2"},
+		{0.7, "3"},
+		{0.6, "3"},
+		{0.59, "4"},
+		{0, "4"},
+	}
+	for _, c := range cases {
+		require.Equal(t, c.expected, mispThreatLevel(c.score, bands), "score %v", c.score)
+	}
+}
@@ -1,32 +1,49 @@
 package beaconproxy
 
 import (
+	"context"
+	"fmt"
+	"os"
 	"runtime"
+	"sync/atomic"
+	"time"
 
 	"github.com/activecm/rita/config"
 	"github.com/activecm/rita/database"
 	"github.com/activecm/rita/pkg/uconnproxy"
 	"github.com/activecm/rita/util"
 
-	"github.com/globalsign/mgo"
 	"github.com/vbauerster/mpb"
 	"github.com/vbauerster/mpb/decor"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 
 	log "github.com/sirupsen/logrus"
 )
 
 type repo struct {
+	ctx      context.Context
 	database *database.DB
 	config   *config.Config
 	log      *log.Logger
+	scorer   ProxyScorer
 }
 
-//NewMongoRepository create new repository
-func NewMongoRepository(db *database.DB, conf *config.Config, logger *log.Logger) Repository {
+//NewMongoRepository create new repository. The spans of the analysis are recorded
+//as children of the span held by ctx.
+func NewMongoRepository(ctx context.Context, db *database.DB, conf *config.Config, logger *log.Logger) Repository {
+	return NewMongoRepositoryWithScorer(ctx, db, conf, logger, NewDefaultProxyScorer(conf))
+}
+
+//NewMongoRepositoryWithScorer create new repository which scores proxy beacons with the given scorer
+func NewMongoRepositoryWithScorer(ctx context.Context, db *database.DB, conf *config.Config, logger *log.Logger,
+	scorer ProxyScorer) Repository {
 	return &repo{
+		ctx:      ctx,
 		database: db,
 		config:   conf,
 		log:      logger,
+		scorer:   scorer,
 	}
 }
 
@@ -34,6 +51,14 @@ func (r *repo) CreateIndexes() error {
 	session := r.database.Session.Copy()
 	defer session.Close()
 
+	// the analysis looks up and updates the max proxy beacon entries in the hosts
+	// table, make sure those queries are indexed even if the host collection
+	// was created by an older version of RITA
+	err := r.database.EnsureIndexes(r.config.T.Structure.HostTable, database.HostProxyBeaconIndexes)
+	if err != nil {
+		return err
+	}
+
 	// set collection name
 	collectionName := r.config.T.BeaconProxy.BeaconProxyTable
 
@@ -47,66 +72,28 @@ func (r *repo) CreateIndexes() error {
 		}
 	}
 
-	// set desired indexes
-	indexes := []mgo.Index{
-		{Key: []string{"-score"}},
-		{Key: []string{"src", "fqdn", "src_network_uuid"}, Unique: true},
-		{Key: []string{"src", "src_network_uuid"}},
-		{Key: []string{"fqdn"}},
-		{Key: []string{"-connection_count"}},
-		{Key: []string{"proxy.ip", "proxy.network_uuid"}},
-	}
-
 	// create collection
-	err := r.database.CreateCollection(collectionName, indexes)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return r.database.CreateCollection(collectionName, database.BeaconProxyIndexes)
 }
 
-//Upsert loops through every new fqdn requested from a proxy ....
-func (r *repo) Upsert(uconnProxyMap map[string]*uconnproxy.Input, minTimestamp, maxTimestamp int64) {
+//Upsert loops through every new fqdn requested from a proxy .... The first write to
+//MongoDB which failed is returned once the analysis is done.
+func (r *repo) Upsert(uconnProxyMap map[string]*uconnproxy.Input, minTimestamp, maxTimestamp int64) error {
 
 	session := r.database.Session.Copy()
 	defer session.Close()
 
 	// Create the workers
 
-	// stage 5 - write out results
-	writerWorker := newWriter(
-		r.config.T.BeaconProxy.BeaconProxyTable,
-		r.database,
-		r.config,
-		r.log,
-	)
-
-	// stage 4 - perform the analysis
-	analyzerWorker := newAnalyzer(
-		minTimestamp,
-		maxTimestamp,
-		r.config.S.Rolling.CurrentChunk,
-		r.database,
-		r.config,
-		r.log,
-		writerWorker.collect,
-		writerWorker.close,
-	)
-
-	// stage 3 - sort data
-	sorterWorker := newSorter(
-		r.database,
-		r.config,
-		analyzerWorker.collect,
-		analyzerWorker.close,
-	)
+	// stages 3 through 5 - sort, analyze, and write out results
+	sorterWorker, finish := r.startAnalysis(minTimestamp, maxTimestamp)
 
 	// stage 2 - get and vet beacon details
 	dissectorWorker := newDissector(
 		int64(r.config.S.Strobe.ConnectionLimit),
 		r.database,
 		r.config,
+		r.log,
 		sorterWorker.collect,
 		sorterWorker.close,
 	)
@@ -114,9 +101,6 @@ func (r *repo) Upsert(uconnProxyMap map[string]*uconnproxy.Input, minTimestamp,
 	//kick off the threaded goroutines
 	for i := 0; i < util.Max(1, runtime.NumCPU()/2); i++ {
 		dissectorWorker.start()
-		sorterWorker.start()
-		analyzerWorker.start()
-		writerWorker.start()
 	}
 
 	// progress bar for troubleshooting
@@ -129,8 +113,17 @@ func (r *repo) Upsert(uconnProxyMap map[string]*uconnproxy.Input, minTimestamp,
 		mpb.AppendDecorators(decor.Percentage()),
 	)
 
+	// the entries outside of the analysis target are skipped before they are
+	// vetted against the database. The timestamp range still covers them.
+	filter := newTargetFilter(r.config)
+
 	// loop over map entries (each hostname)
 	for _, entry := range uconnProxyMap {
+		if filter != nil && !filter(entry) {
+			bar.IncrBy(1)
+			continue
+		}
+
 		// pass entry to dissector
 		dissectorWorker.collect(entry)
 
@@ -142,4 +135,190 @@ func (r *repo) Upsert(uconnProxyMap map[string]*uconnproxy.Input, minTimestamp,
 
 	// start the closing cascade (this will also close the other channels)
 	dissectorWorker.close()
+
+	return finish()
+}
+
+//AnalyzeAggregated scores proxy beacons which were aggregated outside of RITA. The
+//entries skip the vetting against the uconnproxy collection made by Upsert, so they
+//must already hold the unique timestamps of each src-fqdn pair. Entries without
+//timestamps are treated as strobes. The first write to MongoDB which failed is returned
+//once the analysis is done.
+func (r *repo) AnalyzeAggregated(entries []*uconnproxy.Input, minTimestamp, maxTimestamp int64) error {
+
+	// stages 3 through 5 - sort, analyze, and write out results
+	sorterWorker, finish := r.startAnalysis(minTimestamp, maxTimestamp)
+
+	for _, entry := range entries {
+		sorterWorker.collect(entry)
+	}
+
+	// start the closing cascade (this will also close the other channels)
+	sorterWorker.close()
+
+	return finish()
+}
+
+//startAnalysis creates and starts the workers which sort, score, and write out the
+//proxy beacons. Entries are passed to the returned sorter. Once the sorter is closed,
+//the returned function reports on the finished analysis and returns the first write
+//which failed.
+func (r *repo) startAnalysis(minTimestamp, maxTimestamp int64) (*sorter, func() error) {
+	// stage 5 - write out results
+	writerWorker := newWriter(
+		r.config.T.BeaconProxy.BeaconProxyTable,
+		r.database,
+		r.config,
+		r.log,
+	)
+	analyzedCallback, closedCallback := writerWorker.collect, writerWorker.close
+
+	// a dry run scores the proxy beacons, reading the hosts table as usual,
+	// but summarizes the scores instead of writing them
+	dryRun := r.config.S.BeaconProxy.DryRun
+	if dryRun {
+		recorder := newDryRunRecorder(r.log)
+		analyzedCallback, closedCallback = recorder.collect, recorder.close
+	}
+
+	// index the results into Elasticsearch alongside MongoDB if it can be reached
+	var esWorker *esSink
+	if r.config.S.BeaconProxy.Elasticsearch.Enabled && !dryRun {
+		esWorker = newESSink(r.database.GetSelectedDB(), r.config, r.log, time.Now())
+		if err := esWorker.ping(); err != nil {
+			r.log.WithError(err).WithField("URL", esWorker.url).Warn(
+				"Could not reach Elasticsearch. Proxy beacons will only be written to MongoDB.",
+			)
+			fmt.Printf("\t[!] Could not reach Elasticsearch at %s, skipping\n", esWorker.url)
+			esWorker = nil
+		} else {
+			mongoCollect, mongoClose := analyzedCallback, closedCallback
+			analyzedCallback = func(data *update) {
+				mongoCollect(data)
+				esWorker.collect(data)
+			}
+			closedCallback = func() {
+				mongoClose()
+				esWorker.close()
+			}
+		}
+	}
+
+	// notify a webhook of the high scoring proxy beacons as they are written
+	var webhookWorker *webhookNotifier
+	if r.config.S.BeaconProxy.Webhook.Enabled && !dryRun {
+		webhookWorker = newWebhookNotifier(r.database.GetSelectedDB(), r.config, r.log)
+		writerCollect, writerClose := analyzedCallback, closedCallback
+		analyzedCallback = func(data *update) {
+			writerCollect(data)
+			webhookWorker.collect(data)
+		}
+		closedCallback = func() {
+			writerClose()
+			webhookWorker.close()
+		}
+	}
+
+	// count the proxy beacons analyzed so they can be recorded by the trace
+	var beacons int64
+	countedCollect := analyzedCallback
+	analyzedCallback = func(data *update) {
+		if data.beacon.query != nil {
+			atomic.AddInt64(&beacons, 1)
+		}
+		countedCollect(data)
+	}
+
+	// stage 4 - perform the analysis
+	analyzerWorker := newAnalyzer(
+		r.ctx,
+		minTimestamp,
+		maxTimestamp,
+		r.config.S.Rolling.CurrentChunk,
+		r.database,
+		r.config,
+		r.log,
+		r.scorer,
+		analyzedCallback,
+		closedCallback,
+	)
+	analyzerWorker.filter = newTargetFilter(r.config)
+
+	// stage 3 - sort data
+	sorterWorker := newSorter(
+		r.database,
+		r.config,
+		analyzerWorker.collect,
+		analyzerWorker.close,
+	)
+
+	//kick off the threaded goroutines
+	for i := 0; i < util.Max(1, runtime.NumCPU()/2); i++ {
+		sorterWorker.start()
+		if !dryRun {
+			writerWorker.start()
+		}
+	}
+
+	// a single thread indexes into Elasticsearch since the bulk API
+	// parallelizes the work on its end
+	if esWorker != nil {
+		esWorker.start()
+	}
+
+	// a single thread sends the notifications so they arrive in order
+	if webhookWorker != nil {
+		webhookWorker.start()
+	}
+
+	// the analyzer spawns its own configurable number of threads
+	analyzerWorker.start()
+
+	finish := func() error {
+		trace.SpanFromContext(r.ctx).SetAttributes(attribute.Int64("rita.beacons", atomic.LoadInt64(&beacons)))
+
+		// the writer has flushed its writes once the closing cascade returns
+		if err := writerWorker.err(); err != nil {
+			fmt.Println("\t[!] Some proxy beacon results could not be written to MongoDB, see the log for details")
+			return err
+		}
+		if !dryRun && r.config.S.BeaconProxy.Summary.TopN > 0 {
+			r.reportTopResults()
+		}
+		return nil
+	}
+
+	return sorterWorker, finish
+}
+
+//reportTopResults prints the highest scoring proxy beacons of the analyzed chunk
+func (r *repo) reportTopResults() {
+	summaryConf := r.config.S.BeaconProxy.Summary
+	results, err := topResults(
+		r.database,
+		r.config.T.BeaconProxy.BeaconProxyTable,
+		r.config.S.Rolling.CurrentChunk,
+		summaryConf.TopN,
+		summaryConf.MinScore,
+	)
+	if err != nil {
+		r.log.WithError(err).WithField("Module", "beaconsProxy").Error("Could not read the top proxy beacons")
+		return
+	}
+
+	r.log.WithFields(log.Fields{
+		"Module":   "beaconsProxy",
+		"Reported": len(results),
+		"MinScore": summaryConf.MinScore,
+	}).Info("Proxy beacon analysis complete")
+
+	if len(results) == 0 {
+		fmt.Printf("\t[-] No proxy beacons scored at least %g\n", summaryConf.MinScore)
+		return
+	}
+
+	fmt.Printf("\t[-] Top Proxy Beacons:\n")
+	if err := writeTopResults(results, os.Stdout); err != nil {
+		r.log.WithError(err).Error("Could not print the top proxy beacons")
+	}
 }
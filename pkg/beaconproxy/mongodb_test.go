@@ -0,0 +1,920 @@
+// +build integration
+
+package beaconproxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/activecm/rita/config"
+	"github.com/activecm/rita/database"
+	"github.com/activecm/rita/pkg/data"
+	"github.com/activecm/rita/pkg/remover"
+	"github.com/activecm/rita/pkg/uconnproxy"
+	"github.com/activecm/rita/resources"
+	"github.com/activecm/rita/util"
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	"github.com/globalsign/mgo/dbtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Server holds the dbtest DBServer
+var Server dbtest.DBServer
+
+// Set the test database
+var testTargetDB = "tmp_test_db"
+
+var testRes *resources.Resources
+
+// testInput creates a proxy beacon input for the given source IP. If strobe is set,
+// the input will not carry any timestamps.
+func testInput(srcIP string, strobe bool) *uconnproxy.Input {
+	input := &uconnproxy.Input{
+		Hosts: data.UniqueSrcFQDNPair{
+			UniqueSrcIP: data.UniqueSrcIP{
+				SrcIP:          srcIP,
+				SrcNetworkUUID: util.UnknownPrivateNetworkUUID,
+				SrcNetworkName: util.UnknownPrivateNetworkName,
+			},
+			FQDN: "example.com",
+		},
+		ConnectionCount: 24,
+	}
+
+	if !strobe {
+		for i := int64(0); i < input.ConnectionCount; i++ {
+			input.TsList = append(input.TsList, 1234560+i*60)
+		}
+	}
+
+	return input
+}
+
+// TestAnalyzerThreads runs several analysis threads at once. Run with -race to
+// verify the threads do not share state.
+func TestAnalyzerThreads(t *testing.T) {
+	testRes.DB.SelectDB(testTargetDB)
+	testRes.Config.S.BeaconProxy.AnalysisThreads = 4
+
+	var lock sync.Mutex
+	results := 0
+
+	analyzerWorker := newAnalyzer(
+		context.Background(), 1234560, 1234560+86400, 0, testRes.DB, testRes.Config, testRes.Log, nil,
+		func(*update) {
+			lock.Lock()
+			results++
+			lock.Unlock()
+		},
+		func() {},
+	)
+	require.Equal(t, 4, analyzerWorker.threads)
+
+	analyzerWorker.start()
+
+	n := 100
+	for i := 0; i < n; i++ {
+		analyzerWorker.collect(testInput("10.0.0."+strconv.Itoa(i), i%2 == 0))
+	}
+	analyzerWorker.close()
+
+	require.Equal(t, n, results)
+}
+
+// TestAnalyzerConnThresh ensures entries with fewer connections than the
+// threshold are not scored
+func TestAnalyzerConnThresh(t *testing.T) {
+	testRes.DB.SelectDB(testTargetDB)
+
+	var lock sync.Mutex
+	var results []*update
+
+	analyzerWorker := newAnalyzer(
+		context.Background(), 1234560, 1234560+86400, 0, testRes.DB, testRes.Config, testRes.Log, nil,
+		func(output *update) {
+			lock.Lock()
+			results = append(results, output)
+			lock.Unlock()
+		},
+		func() {},
+	)
+	analyzerWorker.start()
+
+	thresh := int64(testRes.Config.S.BeaconProxy.DefaultConnectionThresh)
+
+	// a perfect beacon which doesn't meet the threshold
+	below := testInput("10.0.0.1", false)
+	below.TsList = below.TsList[:thresh-1]
+	below.ConnectionCount = thresh - 1
+	analyzerWorker.collect(below)
+
+	// a perfect beacon which meets the threshold
+	above := testInput("10.0.0.2", false)
+	above.TsList = above.TsList[:thresh]
+	above.ConnectionCount = thresh
+	analyzerWorker.collect(above)
+
+	analyzerWorker.close()
+
+	require.Len(t, results, 1)
+	require.Equal(t, above.Hosts.BSONKey(), results[0].beacon.selector)
+}
+
+// TestAnalyzerTarget ensures only the targeted pair is scored
+func TestAnalyzerTarget(t *testing.T) {
+	testRes.DB.SelectDB(testTargetDB)
+	testRes.Config.S.BeaconProxy.Target.Src = "10.0.1.2"
+	testRes.Config.S.BeaconProxy.Target.FQDN = "example.com"
+	defer func() { testRes.Config.S.BeaconProxy.Target = config.BeaconProxyTargetStaticCfg{} }()
+
+	var lock sync.Mutex
+	var results []*update
+
+	analyzerWorker := newAnalyzer(
+		context.Background(), 1234560, 1234560+86400, 0, testRes.DB, testRes.Config, testRes.Log, nil,
+		func(output *update) {
+			lock.Lock()
+			results = append(results, output)
+			lock.Unlock()
+		},
+		func() {},
+	)
+	analyzerWorker.filter = newTargetFilter(testRes.Config)
+	analyzerWorker.start()
+
+	for i := 1; i <= 3; i++ {
+		analyzerWorker.collect(testInput("10.0.1."+strconv.Itoa(i), false))
+	}
+	otherFQDN := testInput("10.0.1.2", false)
+	otherFQDN.Hosts.FQDN = "example.org"
+	analyzerWorker.collect(otherFQDN)
+	analyzerWorker.close()
+
+	require.Len(t, results, 1)
+	require.Equal(t, testInput("10.0.1.2", false).Hosts.BSONKey(), results[0].beacon.selector)
+}
+
+// TestUpsertTarget ensures only the targeted pair is written
+func TestUpsertTarget(t *testing.T) {
+	testRes.DB.SelectDB("tmp_target_db")
+	defer testRes.DB.SelectDB(testTargetDB)
+	ssn := testRes.DB.Session.Copy()
+	defer ssn.Close()
+	db := ssn.DB("tmp_target_db")
+	defer db.DropDatabase()
+
+	testRes.Config.S.BeaconProxy.Target.Src = "10.0.1.2"
+	defer func() { testRes.Config.S.BeaconProxy.Target = config.BeaconProxyTargetStaticCfg{} }()
+
+	var entries []*uconnproxy.Input
+	for i := 1; i <= 3; i++ {
+		entries = append(entries, testInput("10.0.1."+strconv.Itoa(i), false))
+	}
+
+	repo := NewMongoRepository(context.Background(), testRes.DB, testRes.Config, testRes.Log)
+	require.Nil(t, repo.CreateIndexes())
+	require.Nil(t, repo.AnalyzeAggregated(entries, 1234560, 1234560+86400))
+
+	var results []Result
+	err := db.C(testRes.Config.T.BeaconProxy.BeaconProxyTable).Find(nil).All(&results)
+	require.Nil(t, err)
+	require.Len(t, results, 1)
+	require.Equal(t, "10.0.1.2", results[0].SrcIP)
+}
+
+// TestAnalyzeAggregatedWriteError ensures failed bulk writes are returned rather than only logged
+func TestAnalyzeAggregatedWriteError(t *testing.T) {
+	testRes.DB.SelectDB("tmp_write_error_db")
+	defer testRes.DB.SelectDB(testTargetDB)
+	ssn := testRes.DB.Session.Copy()
+	defer ssn.Close()
+	db := ssn.DB("tmp_write_error_db")
+	defer db.DropDatabase()
+
+	// reject every proxy beacon document
+	err := db.C(testRes.Config.T.BeaconProxy.BeaconProxyTable).Create(&mgo.CollectionInfo{
+		Validator: bson.M{"src": bson.M{"$exists": false}},
+	})
+	require.Nil(t, err)
+
+	repo := NewMongoRepository(context.Background(), testRes.DB, testRes.Config, testRes.Log)
+	err = repo.AnalyzeAggregated([]*uconnproxy.Input{testInput("10.0.1.2", false)}, 1234560, 1234560+86400)
+	require.NotNil(t, err)
+}
+
+// TestCreateIndexes ensures the host lookups made during analysis are indexed
+func TestCreateIndexes(t *testing.T) {
+	testRes.DB.SelectDB(testTargetDB)
+	ssn := testRes.DB.Session.Copy()
+	defer ssn.Close()
+
+	repo := NewMongoRepository(context.Background(), testRes.DB, testRes.Config, testRes.Log)
+	require.Nil(t, repo.CreateIndexes())
+
+	hostIndexes, err := ssn.DB(testTargetDB).C(testRes.Config.T.Structure.HostTable).Indexes()
+	require.Nil(t, err)
+
+	var hostKeys [][]string
+	for _, index := range hostIndexes {
+		hostKeys = append(hostKeys, index.Key)
+	}
+	for _, index := range database.HostProxyBeaconIndexes {
+		require.Contains(t, hostKeys, index.Key)
+	}
+
+	beaconIndexes, err := ssn.DB(testTargetDB).C(testRes.Config.T.BeaconProxy.BeaconProxyTable).Indexes()
+	require.Nil(t, err)
+
+	var beaconKeys [][]string
+	for _, index := range beaconIndexes {
+		beaconKeys = append(beaconKeys, index.Key)
+	}
+	for _, index := range database.BeaconProxyIndexes {
+		require.Contains(t, beaconKeys, index.Key)
+	}
+}
+
+// TestUpsertDryRun ensures a dry run reads the proxied connections without
+// modifying any documents
+func TestUpsertDryRun(t *testing.T) {
+	testRes.DB.SelectDB(testTargetDB)
+	testRes.Config.S.BeaconProxy.DryRun = true
+	defer func() { testRes.Config.S.BeaconProxy.DryRun = false }()
+
+	ssn := testRes.DB.Session.Copy()
+	defer ssn.Close()
+	db := ssn.DB(testTargetDB)
+
+	input := testInput("10.0.1.1", false)
+	hostKey := input.Hosts.UniqueSrcIP.Unpair().BSONKey()
+
+	// seed the proxied connections to analyze and the source's host record
+	err := db.C(testRes.Config.T.Structure.UniqueConnProxyTable).Insert(bson.M{
+		"src":              input.Hosts.SrcIP,
+		"src_network_uuid": input.Hosts.SrcNetworkUUID,
+		"fqdn":             input.Hosts.FQDN,
+		"dat":              []bson.M{{"ts": input.TsList, "count": input.ConnectionCount}},
+	})
+	require.Nil(t, err)
+	_, err = db.C(testRes.Config.T.Structure.HostTable).Upsert(hostKey, bson.M{"$set": bson.M{"local": true}})
+	require.Nil(t, err)
+
+	var hostBefore bson.M
+	require.Nil(t, db.C(testRes.Config.T.Structure.HostTable).Find(hostKey).One(&hostBefore))
+	beaconsBefore, err := db.C(testRes.Config.T.BeaconProxy.BeaconProxyTable).Count()
+	require.Nil(t, err)
+
+	repo := NewMongoRepository(context.Background(), testRes.DB, testRes.Config, testRes.Log)
+	require.Nil(t, repo.Upsert(map[string]*uconnproxy.Input{"a": input}, 1234560, 1234560+86400))
+
+	var hostAfter bson.M
+	require.Nil(t, db.C(testRes.Config.T.Structure.HostTable).Find(hostKey).One(&hostAfter))
+	require.Equal(t, hostBefore, hostAfter)
+
+	beaconsAfter, err := db.C(testRes.Config.T.BeaconProxy.BeaconProxyTable).Count()
+	require.Nil(t, err)
+	require.Equal(t, beaconsBefore, beaconsAfter)
+}
+
+// TestUpsertConnThresh ensures the dissector passes on the same pairs the
+// analyzer scores, including those which exactly meet the threshold
+func TestUpsertConnThresh(t *testing.T) {
+	testRes.DB.SelectDB(testTargetDB)
+	ssn := testRes.DB.Session.Copy()
+	defer ssn.Close()
+	db := ssn.DB(testTargetDB)
+
+	thresh := int64(testRes.Config.S.BeaconProxy.DefaultConnectionThresh)
+
+	below := testInput("10.0.3.1", false)
+	below.TsList = below.TsList[:thresh-1]
+	below.ConnectionCount = thresh - 1
+
+	meets := testInput("10.0.3.2", false)
+	meets.TsList = meets.TsList[:thresh]
+	meets.ConnectionCount = thresh
+
+	inputs := map[string]*uconnproxy.Input{"below": below, "meets": meets}
+	for _, input := range inputs {
+		err := db.C(testRes.Config.T.Structure.UniqueConnProxyTable).Insert(bson.M{
+			"src":              input.Hosts.SrcIP,
+			"src_network_uuid": input.Hosts.SrcNetworkUUID,
+			"fqdn":             input.Hosts.FQDN,
+			"dat":              []bson.M{{"ts": input.TsList, "count": input.ConnectionCount}},
+		})
+		require.Nil(t, err)
+	}
+
+	repo := NewMongoRepository(context.Background(), testRes.DB, testRes.Config, testRes.Log)
+	require.Nil(t, repo.Upsert(inputs, 1234560, 1234560+86400))
+
+	beacons := db.C(testRes.Config.T.BeaconProxy.BeaconProxyTable)
+	count, err := beacons.Find(below.Hosts.BSONKey()).Count()
+	require.Nil(t, err)
+	require.Equal(t, 0, count)
+
+	count, err = beacons.Find(meets.Hosts.BSONKey()).Count()
+	require.Nil(t, err)
+	require.Equal(t, 1, count)
+}
+
+// TestUpsertOverlappingNetworks ensures the same address seen on two networks
+// produces separate proxy beacon and host documents
+func TestUpsertOverlappingNetworks(t *testing.T) {
+	testRes.DB.SelectDB(testTargetDB)
+	ssn := testRes.DB.Session.Copy()
+	defer ssn.Close()
+	db := ssn.DB(testTargetDB)
+
+	first := testInput("10.0.2.1", false)
+	second := testInput("10.0.2.1", false)
+	second.Hosts = data.NewUniqueSrcFQDNPair(
+		data.NewUniqueIP(net.ParseIP("10.0.2.1"), "ff0d0776-0cdc-4a10-b793-522bcd48a560", "second"),
+		first.Hosts.FQDN,
+	)
+
+	// seed the proxied connections to analyze and the sources' host records
+	for _, input := range []*uconnproxy.Input{first, second} {
+		err := db.C(testRes.Config.T.Structure.UniqueConnProxyTable).Insert(bson.M{
+			"src":              input.Hosts.SrcIP,
+			"src_network_uuid": input.Hosts.SrcNetworkUUID,
+			"fqdn":             input.Hosts.FQDN,
+			"dat":              []bson.M{{"ts": input.TsList, "count": input.ConnectionCount}},
+		})
+		require.Nil(t, err)
+		_, err = db.C(testRes.Config.T.Structure.HostTable).Upsert(
+			input.Hosts.UniqueSrcIP.Unpair().BSONKey(), bson.M{"$set": bson.M{"local": true}},
+		)
+		require.Nil(t, err)
+	}
+
+	repo := NewMongoRepository(context.Background(), testRes.DB, testRes.Config, testRes.Log)
+	require.Nil(t, repo.Upsert(map[string]*uconnproxy.Input{"a": first, "b": second}, 1234560, 1234560+86400))
+
+	for _, input := range []*uconnproxy.Input{first, second} {
+		count, err := db.C(testRes.Config.T.BeaconProxy.BeaconProxyTable).Find(input.Hosts.BSONKey()).Count()
+		require.Nil(t, err)
+		require.Equal(t, 1, count, "network: %s", input.Hosts.SrcNetworkName)
+
+		var host struct {
+			Dat []hostProxyBeaconDat `bson:"dat"`
+		}
+		err = db.C(testRes.Config.T.Structure.HostTable).Find(input.Hosts.UniqueSrcIP.Unpair().BSONKey()).One(&host)
+		require.Nil(t, err)
+		require.Len(t, host.Dat, 1, "network: %s", input.Hosts.SrcNetworkName)
+	}
+}
+
+// TestUpsertSubnetAggregation ensures the proxied connections of a subnet produce
+// a single proxy beacon document
+func TestUpsertSubnetAggregation(t *testing.T) {
+	testRes.DB.SelectDB(testTargetDB)
+	ssn := testRes.DB.Session.Copy()
+	defer ssn.Close()
+	db := ssn.DB(testTargetDB)
+
+	// three sources in the same /24 which check in one after another
+	subnet := data.NewSubnet(testInput("10.0.3.1", false).Hosts.UniqueSrcIP.Unpair(), data.SubnetPrefixLengths{IPv4: 24, IPv6: 64})
+	input := testInput("10.0.3.1", false)
+	input.Hosts = data.NewUniqueSrcFQDNPair(subnet.AsUniqueIP(), input.Hosts.FQDN)
+	input.SrcSubnet = &subnet
+	input.TsList = nil
+	for i := int64(0); i < input.ConnectionCount; i++ {
+		input.TsList = append(input.TsList, 1234560+i*180, 1234620+i*180, 1234680+i*180)
+	}
+	input.ConnectionCount *= 3
+
+	err := db.C(testRes.Config.T.Structure.UniqueConnProxyTable).Insert(bson.M{
+		"src":              input.Hosts.SrcIP,
+		"src_network_uuid": input.Hosts.SrcNetworkUUID,
+		"fqdn":             input.Hosts.FQDN,
+		"dat":              []bson.M{{"ts": input.TsList, "count": input.ConnectionCount}},
+	})
+	require.Nil(t, err)
+
+	repo := NewMongoRepository(context.Background(), testRes.DB, testRes.Config, testRes.Log)
+	require.Nil(t, repo.Upsert(map[string]*uconnproxy.Input{"a": input}, 1234560, 1234560+86400))
+
+	count, err := db.C(testRes.Config.T.BeaconProxy.BeaconProxyTable).Find(bson.M{"src": "10.0.3.0/24"}).Count()
+	require.Nil(t, err)
+	require.Equal(t, 1, count)
+
+	var host struct {
+		Dat []hostProxyBeaconDat `bson:"dat"`
+	}
+	require.Nil(t, db.C(testRes.Config.T.Structure.HostTable).Find(subnet.BSONKey()).One(&host))
+	require.Len(t, host.Dat, 1)
+}
+
+// TestExport ensures the exported proxy beacons parse back into the stored results
+func TestExport(t *testing.T) {
+	testRes.DB.SelectDB("tmp_export_db")
+	defer testRes.DB.SelectDB(testTargetDB)
+	ssn := testRes.DB.Session.Copy()
+	defer ssn.Close()
+	beacons := ssn.DB("tmp_export_db").C(testRes.Config.T.BeaconProxy.BeaconProxyTable)
+
+	for i, score := range []float64{0.9, 0.4, 0.7} {
+		input := testInput("10.0.4."+strconv.Itoa(i), false)
+		err := beacons.Insert(bson.M{
+			"src":              input.Hosts.SrcIP,
+			"src_network_uuid": input.Hosts.SrcNetworkUUID,
+			"src_network_name": input.Hosts.SrcNetworkName,
+			"fqdn":             input.Hosts.FQDN,
+			"connection_count": input.ConnectionCount,
+			"score":            score,
+			"cid":              i % 2,
+			"tslist":           input.TsList,
+			"ts":               bson.M{"score": score, "intervals": []int64{60}, "interval_counts": []int64{23}},
+		})
+		require.Nil(t, err)
+	}
+
+	var buffer bytes.Buffer
+	count, err := Export(testRes, -1, 0.5, &buffer)
+	require.Nil(t, err)
+	require.Equal(t, 2, count)
+
+	var records []ExportRecord
+	decoder := json.NewDecoder(&buffer)
+	for decoder.More() {
+		var record ExportRecord
+		require.Nil(t, decoder.Decode(&record))
+		records = append(records, record)
+	}
+	require.Len(t, records, 2)
+	require.Equal(t, "10.0.4.0", records[0].Src)
+	require.Equal(t, 0.9, records[0].Score)
+	require.Equal(t, []int64{60}, records[0].Ts.Intervals)
+	require.Equal(t, testInput("10.0.4.0", false).TsList, records[0].TsList)
+	require.Equal(t, "10.0.4.2", records[1].Src)
+
+	// only the given chunk is exported
+	buffer.Reset()
+	count, err = Export(testRes, 1, 0, &buffer)
+	require.Nil(t, err)
+	require.Equal(t, 1, count)
+}
+
+// TestPruneChunks removes the expired chunks of a rolling database and ensures the
+// max proxy beacons of the hosts are recomputed from the retained proxy beacons
+func TestPruneChunks(t *testing.T) {
+	testRes.DB.SelectDB("tmp_prune_db")
+	defer testRes.DB.SelectDB(testTargetDB)
+	ssn := testRes.DB.Session.Copy()
+	defer ssn.Close()
+	db := ssn.DB("tmp_prune_db")
+	defer db.DropDatabase()
+	beacons := db.C(testRes.Config.T.BeaconProxy.BeaconProxyTable)
+	hosts := db.C(testRes.Config.T.Structure.HostTable)
+
+	beaconDocs := []struct {
+		src   string
+		fqdn  string
+		cid   int
+		score float64
+	}{
+		{"10.0.5.1", "a.example.com", 0, 0.9},
+		{"10.0.5.1", "b.example.com", 2, 0.6},
+		{"10.0.5.1", "c.example.com", 3, 0.7},
+		{"10.0.5.1", "d.example.com", 3, 0.5},
+		{"10.0.5.2", "a.example.com", 1, 0.8},
+	}
+	for _, beacon := range beaconDocs {
+		err := beacons.Insert(bson.M{
+			"src":              beacon.src,
+			"src_network_uuid": util.UnknownPrivateNetworkUUID,
+			"fqdn":             beacon.fqdn,
+			"cid":              beacon.cid,
+			"score":            beacon.score,
+		})
+		require.Nil(t, err)
+	}
+
+	// the hosts track the max proxy beacons as of each chunk's analysis,
+	// alongside the data of other modules
+	err := hosts.Insert(
+		bson.M{
+			"ip": "10.0.5.1", "network_uuid": util.UnknownPrivateNetworkUUID, "cid": 3,
+			"dat": []bson.M{
+				{"max_beacon_proxy_score": 0.9, "mbproxy": "a.example.com", "cid": 0},
+				{"max_beacon_proxy_score": 0.6, "mbproxy": "b.example.com", "cid": 2},
+				{"max_beacon_proxy_score": 0.7, "mbproxy": "c.example.com", "cid": 3},
+				{"count": 5, "cid": 3},
+			},
+		},
+		bson.M{
+			"ip": "10.0.5.2", "network_uuid": util.UnknownPrivateNetworkUUID, "cid": 1,
+			"dat": []bson.M{
+				{"max_beacon_proxy_score": 0.8, "mbproxy": "a.example.com", "cid": 1},
+			},
+		},
+	)
+	require.Nil(t, err)
+
+	// keep the current chunk 3 and chunk 2 out of 4 chunks
+	expired := remover.ExpiredChunks(3, 4, 2)
+	require.Equal(t, []int{1, 0}, expired)
+	removerRepo := remover.NewMongoRemover(testRes.DB, testRes.Config, testRes.Log)
+	for _, cid := range expired {
+		require.Nil(t, removerRepo.Remove(cid))
+	}
+
+	count, err := RecomputeHostMaxScores(testRes.DB, testRes.Config)
+	require.Nil(t, err)
+	require.Equal(t, 1, count)
+
+	// only the proxy beacons of the retained chunks survive
+	var retained []Result
+	require.Nil(t, beacons.Find(nil).Sort("-score").All(&retained))
+	require.Len(t, retained, 3)
+	for _, beacon := range retained {
+		require.Contains(t, []int{2, 3}, beacon.CID)
+	}
+
+	var host struct {
+		Dat []bson.M `bson:"dat"`
+	}
+	err = hosts.Find(bson.M{"ip": "10.0.5.1"}).One(&host)
+	require.Nil(t, err)
+
+	maxBeacons := make(map[int]bson.M)
+	for _, entry := range host.Dat {
+		if _, ok := entry["mbproxy"]; ok {
+			maxBeacons[entry["cid"].(int)] = entry
+		} else {
+			// the data of other modules is left alone
+			require.Equal(t, 5, entry["count"])
+		}
+	}
+	require.Len(t, host.Dat, 3)
+	require.Len(t, maxBeacons, 2)
+	require.Equal(t, "b.example.com", maxBeacons[2]["mbproxy"])
+	require.Equal(t, 0.6, maxBeacons[2]["max_beacon_proxy_score"])
+	require.Equal(t, "c.example.com", maxBeacons[3]["mbproxy"])
+	require.Equal(t, 0.7, maxBeacons[3]["max_beacon_proxy_score"])
+
+	// the host only seen in an expired chunk is removed along with its proxy beacons
+	n, err := hosts.Find(bson.M{"ip": "10.0.5.2", "dat.mbproxy": bson.M{"$exists": true}}).Count()
+	require.Nil(t, err)
+	require.Equal(t, 0, n)
+}
+
+// TestReconcileHostMaxScores ensures the max proxy beacons of the hosts are corrected
+// after proxy beacons are deleted by hand
+func TestReconcileHostMaxScores(t *testing.T) {
+	testRes.DB.SelectDB("tmp_reconcile_db")
+	defer testRes.DB.SelectDB(testTargetDB)
+	ssn := testRes.DB.Session.Copy()
+	defer ssn.Close()
+	db := ssn.DB("tmp_reconcile_db")
+	defer db.DropDatabase()
+	beacons := db.C(testRes.Config.T.BeaconProxy.BeaconProxyTable)
+	hosts := db.C(testRes.Config.T.Structure.HostTable)
+
+	src := data.UniqueIP{IP: "10.0.6.1", NetworkUUID: util.UnknownPrivateNetworkUUID}
+	subnet := data.Subnet{CIDR: "10.0.7.0/24", NetworkUUID: util.UnknownPrivateNetworkUUID}
+	other := data.UniqueIP{IP: "10.0.6.2", NetworkUUID: util.UnknownPrivateNetworkUUID}
+
+	// the false positive proxy beacon to bad.example.com was deleted by hand
+	for _, beacon := range []bson.M{
+		{"src": src.IP, "fqdn": "a.example.com", "cid": 0, "score": 0.6},
+		{"src": src.IP, "fqdn": "b.example.com", "cid": 0, "score": 0.4},
+		{"src": src.IP, "fqdn": "c.example.com", "cid": 1, "score": 0.5},
+		{"src": subnet.CIDR, "fqdn": "a.example.com", "cid": 1, "score": 0.7},
+	} {
+		beacon["src_network_uuid"] = util.UnknownPrivateNetworkUUID
+		require.Nil(t, beacons.Insert(beacon))
+	}
+
+	srcDoc := src.BSONKey()
+	srcDoc["dat"] = []bson.M{
+		{"max_beacon_proxy_score": 0.95, "mbproxy": "bad.example.com", "cid": 0},
+		{"max_beacon_proxy_score": 0.5, "mbproxy": "c.example.com", "cid": 1},
+		{"count": 5, "cid": 1},
+	}
+	// the subnet's entry was never written
+	otherDoc := other.BSONKey()
+	otherDoc["dat"] = []bson.M{
+		{"max_beacon_proxy_score": 0.9, "mbproxy": "bad.example.com", "cid": 1},
+	}
+	require.Nil(t, hosts.Insert(srcDoc, otherDoc))
+
+	count, err := RecomputeHostMaxScores(testRes.DB, testRes.Config)
+	require.Nil(t, err)
+	require.Equal(t, 2, count)
+
+	var host struct {
+		Dat []hostProxyBeaconDat `bson:"dat"`
+	}
+	maxBeacons := func(hostKey bson.M) map[int]string {
+		host.Dat = nil
+		require.Nil(t, hosts.Find(hostKey).One(&host))
+		result := make(map[int]string)
+		for _, entry := range host.Dat {
+			if entry.MBProxy != nil {
+				result[entry.CID] = *entry.MBProxy
+			}
+		}
+		return result
+	}
+
+	require.Equal(t, map[int]string{0: "a.example.com", 1: "c.example.com"}, maxBeacons(src.BSONKey()))
+	// the data of other modules is left alone
+	require.Len(t, host.Dat, 3)
+
+	require.Equal(t, map[int]string{1: "a.example.com"}, maxBeacons(subnet.BSONKey()))
+	require.Empty(t, maxBeacons(other.BSONKey()))
+}
+
+// TestTopResults ensures the summary reports the highest scoring proxy beacons of the chunk
+func TestTopResults(t *testing.T) {
+	testRes.DB.SelectDB("tmp_top_db")
+	defer testRes.DB.SelectDB(testTargetDB)
+	ssn := testRes.DB.Session.Copy()
+	defer ssn.Close()
+	db := ssn.DB("tmp_top_db")
+	defer db.DropDatabase()
+	beacons := db.C(testRes.Config.T.BeaconProxy.BeaconProxyTable)
+
+	for _, beacon := range []bson.M{
+		{"src": "10.0.8.1", "fqdn": "a.example.com", "cid": 1, "score": 0.6},
+		{"src": "10.0.8.2", "fqdn": "a.example.com", "cid": 1, "score": 0.9},
+		{"src": "10.0.8.3", "fqdn": "a.example.com", "cid": 1, "score": 0.4},
+		{"src": "10.0.8.4", "fqdn": "b.example.com", "cid": 1, "score": 0.8},
+		{"src": "10.0.8.4", "fqdn": "a.example.com", "cid": 1, "score": 0.8},
+		{"src": "10.0.8.5", "fqdn": "a.example.com", "cid": 0, "score": 1},
+	} {
+		beacon["src_network_uuid"] = util.UnknownPrivateNetworkUUID
+		require.Nil(t, beacons.Insert(beacon))
+	}
+
+	results, err := topResults(testRes.DB, testRes.Config.T.BeaconProxy.BeaconProxyTable, 1, 3, 0.5)
+	require.Nil(t, err)
+
+	// other chunks and low scores are left out, and ties are broken by source and fqdn
+	var rows [][]interface{}
+	for _, result := range results {
+		rows = append(rows, []interface{}{result.SrcIP, result.FQDN, result.Score})
+	}
+	require.Equal(t, [][]interface{}{
+		{"10.0.8.2", "a.example.com", 0.9},
+		{"10.0.8.4", "a.example.com", 0.8},
+		{"10.0.8.4", "b.example.com", 0.8},
+	}, rows)
+}
+
+// TestCompare loads the fixture databases and ensures the proxy beacons are compared
+func TestCompare(t *testing.T) {
+	ssn := testRes.DB.Session.Copy()
+	defer ssn.Close()
+
+	for db, fixture := range map[string]string{
+		"tmp_compare_base_db":  "compare_base.ndjson",
+		"tmp_compare_other_db": "compare_other.ndjson",
+	} {
+		defer ssn.DB(db).DropDatabase()
+		beacons := ssn.DB(db).C(testRes.Config.T.BeaconProxy.BeaconProxyTable)
+		for _, doc := range readCompareFixture(t, fixture) {
+			require.Nil(t, beacons.Insert(doc))
+		}
+	}
+
+	diffs, err := Compare(testRes, "tmp_compare_base_db", "tmp_compare_other_db")
+	require.Nil(t, err)
+	requireComparison(t, diffs)
+
+	_, err = Compare(testRes, "tmp_compare_base_db", "")
+	require.NotNil(t, err)
+}
+
+// TestAnalyzeAggregated imports aggregated proxy connections and ensures the proxy
+// beacon is written
+func TestAnalyzeAggregated(t *testing.T) {
+	testRes.DB.SelectDB("tmp_aggregated_db")
+	defer testRes.DB.SelectDB(testTargetDB)
+	ssn := testRes.DB.Session.Copy()
+	defer ssn.Close()
+	db := ssn.DB("tmp_aggregated_db")
+	defer db.DropDatabase()
+
+	file, err := os.Open("testdata/aggregated.ndjson")
+	require.Nil(t, err)
+	defer file.Close()
+	batch, err := ReadAggregated(file, int64(testRes.Config.S.Strobe.ConnectionLimit))
+	require.Nil(t, err)
+
+	repo := NewMongoRepository(context.Background(), testRes.DB, testRes.Config, testRes.Log)
+	require.Nil(t, repo.CreateIndexes())
+	require.Nil(t, repo.AnalyzeAggregated(batch.Entries, batch.MinTimestamp, batch.MaxTimestamp))
+
+	var results []Result
+	err = db.C(testRes.Config.T.BeaconProxy.BeaconProxyTable).Find(nil).All(&results)
+	require.Nil(t, err)
+	require.Len(t, results, 1)
+	require.Equal(t, "10.0.9.1", results[0].SrcIP)
+	require.Equal(t, "beacon.example.com", results[0].FQDN)
+	require.Equal(t, "10.0.0.100", results[0].Proxy.IP)
+	require.Equal(t, int64(24), results[0].Connections)
+	require.Equal(t, int64(60), results[0].Ts.Mode)
+	require.True(t, results[0].Score > 0.5)
+
+	// the strobe is flagged in the uconnproxy collection
+	count, err := db.C(testRes.Config.T.Structure.UniqueConnProxyTable).
+		Find(bson.M{"src": "10.0.9.2", "fqdn": "strobe.example.com", "strobeFQDN": true}).Count()
+	require.Nil(t, err)
+	require.Equal(t, 1, count)
+}
+
+func TestAnalyzeAggregatedSameChunk(t *testing.T) {
+	testRes.DB.SelectDB("tmp_same_chunk_db")
+	defer testRes.DB.SelectDB(testTargetDB)
+	ssn := testRes.DB.Session.Copy()
+	defer ssn.Close()
+	db := ssn.DB("tmp_same_chunk_db")
+	defer db.DropDatabase()
+
+	chunk := testRes.Config.S.Rolling.CurrentChunk
+	testRes.Config.S.Rolling.CurrentChunk = 3
+	defer func() { testRes.Config.S.Rolling.CurrentChunk = chunk }()
+
+	repo := NewMongoRepository(context.Background(), testRes.DB, testRes.Config, testRes.Log)
+	require.Nil(t, repo.CreateIndexes())
+
+	// analyzing the same input under the same chunk twice leaves the same results
+	for i := 0; i < 2; i++ {
+		file, err := os.Open("testdata/aggregated.ndjson")
+		require.Nil(t, err)
+		batch, err := ReadAggregated(file, int64(testRes.Config.S.Strobe.ConnectionLimit))
+		file.Close()
+		require.Nil(t, err)
+		require.Nil(t, repo.AnalyzeAggregated(batch.Entries, batch.MinTimestamp, batch.MaxTimestamp))
+	}
+
+	var results []Result
+	err := db.C(testRes.Config.T.BeaconProxy.BeaconProxyTable).Find(nil).All(&results)
+	require.Nil(t, err)
+	require.Len(t, results, 1)
+	require.Equal(t, 3, results[0].CID)
+	require.Equal(t, int64(24), results[0].Connections)
+
+	var host struct {
+		Dat []hostProxyBeaconDat `bson:"dat"`
+	}
+	err = db.C(testRes.Config.T.Structure.HostTable).Find(bson.M{"ip": "10.0.9.1"}).One(&host)
+	require.Nil(t, err)
+	var maxBeacons []hostProxyBeaconDat
+	for _, entry := range host.Dat {
+		if entry.MBProxy != nil {
+			maxBeacons = append(maxBeacons, entry)
+		}
+	}
+	require.Len(t, maxBeacons, 1)
+	require.Equal(t, 3, maxBeacons[0].CID)
+	require.Equal(t, "beacon.example.com", *maxBeacons[0].MBProxy)
+}
+
+// TestHostBeaconQueryConcurrent ensures concurrent analysis threads converge on a single
+// max proxy beacon entry per chunk holding the highest score
+func TestHostBeaconQueryConcurrent(t *testing.T) {
+	testRes.DB.SelectDB(testTargetDB)
+	src := testInput("10.0.0.11", false).Hosts.UniqueSrcIP.Unpair()
+	w := newWriter(testRes.Config.T.BeaconProxy.BeaconProxyTable, testRes.DB, testRes.Config, testRes.Log)
+
+	// many proxy beacons from the same source are analyzed and written at once across two chunks
+	const beacons = 200
+	maxScores := make(map[int]float64)
+	var wg sync.WaitGroup
+	for i := 0; i < beacons; i++ {
+		chunk := i % 2
+		score := float64((i*37)%beacons) / beacons
+		if score > maxScores[chunk] {
+			maxScores[chunk] = score
+		}
+		fqdn := "beacon" + strconv.Itoa(i) + ".example.com"
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ssn := testRes.DB.Session.Copy()
+			defer ssn.Close()
+
+			a := newAnalyzer(context.Background(), 0, 86400, chunk, testRes.DB, testRes.Config, testRes.Log, nil, func(*update) {}, func() {})
+			updates := a.hostBeaconQuery(ssn, score, src.BSONKey(), fqdn)
+			if updates.insert.query != nil {
+				assert.Nil(t, w.updateMaxBeacon(ssn.DB(testTargetDB).C(testRes.Config.T.Structure.HostTable), updates))
+			}
+		}()
+	}
+	wg.Wait()
+
+	var host struct {
+		Dat []hostProxyBeaconDat `bson:"dat"`
+	}
+	ssn := testRes.DB.Session.Copy()
+	defer ssn.Close()
+	require.Nil(t, ssn.DB(testTargetDB).C(testRes.Config.T.Structure.HostTable).Find(src.BSONKey()).One(&host))
+
+	// every chunk holds exactly one entry with the highest score
+	found := make(map[int]float64)
+	for _, entry := range host.Dat {
+		if entry.MaxBeaconProxyScore == nil {
+			continue
+		}
+		_, ok := found[entry.CID]
+		require.False(t, ok, "chunk %d holds more than one max proxy beacon", entry.CID)
+		found[entry.CID] = *entry.MaxBeaconProxyScore
+	}
+	require.Equal(t, maxScores, found)
+}
+
+// BenchmarkHostBeaconQuery reports the number of database operations needed
+// to decide how to update a source's max proxy beacon score
+func BenchmarkHostBeaconQuery(b *testing.B) {
+	testRes.DB.SelectDB(testTargetDB)
+	ssn := testRes.DB.Session.Copy()
+	defer ssn.Close()
+
+	src := testInput("10.0.0.1", false).Hosts.UniqueSrcIP.Unpair()
+
+	// seed a host with max proxy beacons in several chunks
+	hosts := ssn.DB(testTargetDB).C(testRes.Config.T.Structure.HostTable)
+	_, err := hosts.Upsert(src.BSONKey(), bson.M{"$set": bson.M{"dat": []bson.M{
+		{"max_beacon_proxy_score": 0.5, "mbproxy": "a.com", "cid": 0},
+		{"max_beacon_proxy_score": 0.9, "mbproxy": "b.com", "cid": 1},
+	}}})
+	require.Nil(b, err)
+
+	a := newAnalyzer(context.Background(), 0, 86400, 1, testRes.DB, testRes.Config, testRes.Log, nil, func(*update) {}, func() {})
+
+	mgo.SetStats(true)
+	defer mgo.SetStats(false)
+	mgo.ResetStats()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		a.hostBeaconQuery(ssn, 0.7, src.BSONKey(), "c.com")
+	}
+	b.StopTimer()
+
+	b.ReportMetric(float64(mgo.GetStats().SentOps)/float64(b.N), "queries/op")
+}
+
+// benchmarkWriter writes b.N proxy beacon results with the given batch size
+func benchmarkWriter(b *testing.B, batchSize int) {
+	testRes.DB.SelectDB(testTargetDB)
+	testRes.Config.S.BeaconProxy.WriteBatchSize = batchSize
+
+	writerWorker := newWriter(testRes.Config.T.BeaconProxy.BeaconProxyTable, testRes.DB, testRes.Config, testRes.Log)
+	writerWorker.start()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		input := testInput("10.0."+strconv.Itoa(i/256%256)+"."+strconv.Itoa(i%256), false)
+		writerWorker.collect(&update{
+			beacon: updateInfo{
+				selector: input.Hosts.BSONKey(),
+				query:    bson.M{"$set": bson.M{"score": 0.5, "connection_count": input.ConnectionCount}},
+			},
+		})
+	}
+	writerWorker.close()
+}
+
+// BenchmarkWriterSingle writes every proxy beacon result individually
+func BenchmarkWriterSingle(b *testing.B) {
+	benchmarkWriter(b, 1)
+}
+
+// BenchmarkWriterBulk writes the proxy beacon results in batches
+func BenchmarkWriterBulk(b *testing.B) {
+	benchmarkWriter(b, 1000)
+}
+
+// TestMain wraps all tests with the needed initialized mock DB and fixtures
+func TestMain(m *testing.M) {
+	// Store temporary databases files in a temporary directory
+	tempDir, _ := ioutil.TempDir("", "testing")
+	Server.SetPath(tempDir)
+
+	// Set the main session variable to the temporary MongoDB instance
+	testRes = resources.InitTestResources()
+
+	// Run the test suite
+	retCode := m.Run()
+
+	// Shut down the temporary server and removes data on disk.
+	Server.Stop()
+
+	// call with result of m.Run()
+	os.Exit(retCode)
+}
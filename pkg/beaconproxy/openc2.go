@@ -0,0 +1,148 @@
+package beaconproxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/activecm/rita/resources"
+	log "github.com/sirupsen/logrus"
+)
+
+//OpenC2 actions proxy beacon destinations may be responded to with
+const (
+	openC2ActionDeny    = "deny"
+	openC2ActionContain = "contain"
+)
+
+//openC2ResponseNone asks the consumer not to respond to a command
+const openC2ResponseNone = "none"
+
+type (
+	//OpenC2Command is an OpenC2 command responding to the destination of proxy beacons
+	OpenC2Command struct {
+		Action string       `json:"action"`
+		Target OpenC2Target `json:"target"`
+		Args   OpenC2Args   `json:"args"`
+	}
+
+	//OpenC2Target is the destination of proxy beacons. Only one of the fields is set.
+	OpenC2Target struct {
+		DomainName string `json:"domain_name,omitempty"`
+		IPv4Net    string `json:"ipv4_net,omitempty"`
+		IPv6Net    string `json:"ipv6_net,omitempty"`
+	}
+
+	//OpenC2Args holds the arguments of a command along with the context it was issued in
+	OpenC2Args struct {
+		ResponseRequested string        `json:"response_requested"`
+		RITA              OpenC2Context `json:"x-rita"`
+	}
+
+	//OpenC2Context explains why a command was issued. OpenC2 consumers ignore the
+	//extension arguments they don't recognize.
+	OpenC2Context struct {
+		Database        string   `json:"database"`
+		Score           float64  `json:"score"`
+		Sources         []string `json:"sources"`
+		ConnectionCount int64    `json:"connection_count"`
+		IntervalMode    int64    `json:"interval_mode"`
+	}
+)
+
+//ExportOpenC2 writes an OpenC2 command for each of the limit highest scoring destinations
+//of the proxy beacons in the selected database scoring above minScore to the writer as
+//newline delimited JSON. A limit of 0 exports every destination. If dryRun is set, the
+//commands are logged rather than written. Returns the number of commands.
+func ExportOpenC2(res *resources.Resources, minScore float64, action string, limit int,
+	dryRun bool, w io.Writer) (int, error) {
+
+	if action != openC2ActionDeny && action != openC2ActionContain {
+		return 0, fmt.Errorf("OpenC2 action %q is not supported, use %s or %s",
+			action, openC2ActionDeny, openC2ActionContain)
+	}
+
+	results, err := Results(res, minScore)
+	if err != nil {
+		return 0, err
+	}
+
+	commands := newOpenC2Commands(results, action, res.DB.GetSelectedDB(), limit)
+	return len(commands), writeOpenC2Commands(commands, dryRun, res.Log, w)
+}
+
+//writeOpenC2Commands writes the commands to the writer as newline delimited JSON, or
+//logs each of them instead if dryRun is set
+func writeOpenC2Commands(commands []OpenC2Command, dryRun bool, logger *log.Logger, w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	for _, command := range commands {
+		if !dryRun {
+			if err := encoder.Encode(command); err != nil {
+				return err
+			}
+			continue
+		}
+
+		commandJSON, err := json.Marshal(command)
+		if err != nil {
+			return err
+		}
+		logger.WithFields(log.Fields{
+			"Module":  "beaconsProxy",
+			"command": string(commandJSON),
+		}).Info("Dry run, not emitting OpenC2 command")
+	}
+	return nil
+}
+
+//newOpenC2Commands builds a command for each destination of the given proxy beacons, which
+//must be sorted by score, highest first. Beacons sharing a destination share its command,
+//which carries the highest score among them. At most limit commands are built unless
+//limit is 0.
+func newOpenC2Commands(results []Result, action string, database string, limit int) []OpenC2Command {
+	var commands []OpenC2Command
+	// the index of each command by its destination
+	seen := make(map[string]int)
+	for _, result := range results {
+		if idx, ok := seen[result.FQDN]; ok {
+			commands[idx].Args.RITA.Sources = append(commands[idx].Args.RITA.Sources, result.SrcIP)
+			commands[idx].Args.RITA.ConnectionCount += result.Connections
+			continue
+		}
+		if limit > 0 && len(commands) == limit {
+			continue
+		}
+
+		seen[result.FQDN] = len(commands)
+		commands = append(commands, OpenC2Command{
+			Action: action,
+			Target: openC2Target(result.FQDN),
+			Args: OpenC2Args{
+				ResponseRequested: openC2ResponseNone,
+				RITA: OpenC2Context{
+					Database:        database,
+					Score:           result.Score,
+					Sources:         []string{result.SrcIP},
+					ConnectionCount: result.Connections,
+					IntervalMode:    result.Ts.Mode,
+				},
+			},
+		})
+	}
+	return commands
+}
+
+//openC2Target targets a destination by its address if the proxied request was made to
+//an IP address rather than a domain name
+func openC2Target(fqdn string) OpenC2Target {
+	ip := net.ParseIP(fqdn)
+	switch {
+	case ip == nil:
+		return OpenC2Target{DomainName: fqdn}
+	case ip.To4() != nil:
+		return OpenC2Target{IPv4Net: ip.String()}
+	default:
+		return OpenC2Target{IPv6Net: ip.String()}
+	}
+}
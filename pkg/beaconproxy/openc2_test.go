@@ -0,0 +1,150 @@
+package beaconproxy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/activecm/rita/pkg/data"
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/require"
+)
+
+//requireOpenC2Command checks the JSON of a command against the structure the OpenC2
+//language specification requires and returns the decoded command
+func requireOpenC2Command(t *testing.T, commandJSON []byte) map[string]interface{} {
+	var command map[string]interface{}
+	require.Nil(t, json.Unmarshal(commandJSON, &command))
+
+	for field := range command {
+		require.Contains(t, []string{"action", "target", "args", "actuator", "command_id"}, field)
+	}
+	require.Contains(t, []string{"deny", "contain"}, command["action"])
+
+	// the target is a choice, exactly one of its fields is set
+	target, ok := command["target"].(map[string]interface{})
+	require.True(t, ok, "the target must be an object")
+	require.Len(t, target, 1)
+	for targetType, value := range target {
+		require.Contains(t, []string{"domain_name", "ipv4_net", "ipv6_net"}, targetType)
+		require.IsType(t, "", value)
+		require.NotEmpty(t, value)
+	}
+
+	args, ok := command["args"].(map[string]interface{})
+	require.True(t, ok, "the args must be an object")
+	require.Contains(t, []string{"none", "ack", "status", "complete"}, args["response_requested"])
+	context, ok := args["x-rita"].(map[string]interface{})
+	require.True(t, ok, "the context must be an extension argument")
+	require.IsType(t, float64(0), context["score"])
+	return command
+}
+
+func TestOpenC2Commands(t *testing.T) {
+	results := []Result{
+		{
+			FQDN:        "example.org",
+			SrcIP:       "10.0.0.1",
+			Connections: 40,
+			Ts:          TSData{Mode: 300},
+			Score:       0.97,
+			Proxy:       data.UniqueIP{IP: "10.0.0.100"},
+		},
+		{
+			FQDN:        "203.0.113.5",
+			SrcIP:       "10.0.0.2",
+			Connections: 24,
+			Ts:          TSData{Mode: 60},
+			Score:       0.95,
+			Proxy:       data.UniqueIP{IP: "10.0.0.100"},
+		},
+		// the destination is shared with the first beacon
+		{
+			FQDN:        "example.org",
+			SrcIP:       "fd00::1",
+			Connections: 30,
+			Ts:          TSData{Mode: 120},
+			Score:       0.93,
+			Proxy:       data.UniqueIP{IP: "10.0.0.100"},
+		},
+		{
+			FQDN:        "2001:db8::5",
+			SrcIP:       "10.0.0.3",
+			Connections: 20,
+			Ts:          TSData{Mode: 30},
+			Score:       0.92,
+			Proxy:       data.UniqueIP{IP: "10.0.0.100"},
+		},
+	}
+
+	var buffer bytes.Buffer
+	logger, hook := test.NewNullLogger()
+	commands := newOpenC2Commands(results, "deny", "dataset", 0)
+	require.Nil(t, writeOpenC2Commands(commands, false, logger, &buffer))
+	require.Empty(t, hook.AllEntries())
+
+	var decoded []map[string]interface{}
+	scanner := bufio.NewScanner(&buffer)
+	for scanner.Scan() {
+		decoded = append(decoded, requireOpenC2Command(t, scanner.Bytes()))
+	}
+	require.Len(t, decoded, 3)
+
+	require.Equal(t, map[string]interface{}{
+		"action": "deny",
+		"target": map[string]interface{}{"domain_name": "example.org"},
+		"args": map[string]interface{}{
+			"response_requested": "none",
+			"x-rita": map[string]interface{}{
+				"database":         "dataset",
+				"score":            0.97,
+				"sources":          []interface{}{"10.0.0.1", "fd00::1"},
+				"connection_count": float64(70),
+				"interval_mode":    float64(300),
+			},
+		},
+	}, decoded[0])
+	require.Equal(t, map[string]interface{}{"ipv4_net": "203.0.113.5"}, decoded[1]["target"])
+	require.Equal(t, map[string]interface{}{"ipv6_net": "2001:db8::5"}, decoded[2]["target"])
+}
+
+func TestOpenC2CommandsLimit(t *testing.T) {
+	results := []Result{
+		{FQDN: "example.org", SrcIP: "10.0.0.1", Score: 0.97},
+		{FQDN: "example.com", SrcIP: "10.0.0.1", Score: 0.95},
+		// beacons to the exported destinations are still counted
+		{FQDN: "example.org", SrcIP: "10.0.0.2", Score: 0.94},
+		{FQDN: "example.net", SrcIP: "10.0.0.1", Score: 0.93},
+	}
+
+	commands := newOpenC2Commands(results, "contain", "dataset", 2)
+	require.Len(t, commands, 2)
+	require.Equal(t, "contain", commands[0].Action)
+	require.Equal(t, "example.org", commands[0].Target.DomainName)
+	require.Equal(t, []string{"10.0.0.1", "10.0.0.2"}, commands[0].Args.RITA.Sources)
+	require.Equal(t, "example.com", commands[1].Target.DomainName)
+}
+
+func TestOpenC2CommandsDryRun(t *testing.T) {
+	results := []Result{
+		{FQDN: "example.org", SrcIP: "10.0.0.1", Score: 0.97},
+		{FQDN: "example.com", SrcIP: "10.0.0.1", Score: 0.95},
+	}
+
+	var buffer bytes.Buffer
+	logger, hook := test.NewNullLogger()
+	commands := newOpenC2Commands(results, "deny", "dataset", 0)
+	require.Nil(t, writeOpenC2Commands(commands, true, logger, &buffer))
+
+	// nothing is emitted, each command is logged instead
+	require.Zero(t, buffer.Len())
+	entries := hook.AllEntries()
+	require.Len(t, entries, 2)
+	for i, entry := range entries {
+		require.Equal(t, log.InfoLevel, entry.Level)
+		command := requireOpenC2Command(t, []byte(entry.Data["command"].(string)))
+		require.Equal(t, commands[i].Target.DomainName, command["target"].(map[string]interface{})["domain_name"])
+	}
+}
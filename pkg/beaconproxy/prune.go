@@ -0,0 +1,96 @@
+package beaconproxy
+
+import (
+	"strings"
+
+	"github.com/activecm/rita/config"
+	"github.com/activecm/rita/database"
+	"github.com/activecm/rita/pkg/data"
+	"github.com/globalsign/mgo/bson"
+)
+
+//hostMaxBeacons holds the max proxy beacon of each chunk for a source as
+//recomputed from the proxy beacon collection
+type hostMaxBeacons struct {
+	ID struct {
+		Src            string      `bson:"src"`
+		SrcNetworkUUID bson.Binary `bson:"src_network_uuid"`
+	} `bson:"_id"`
+	Dat []hostProxyBeaconDat `bson:"dat"`
+}
+
+//hostKey selects the source's entry in the hosts table the same as the analysis.
+//Sources aggregated into subnets are tracked in an entry for the subnet.
+func (h hostMaxBeacons) hostKey() bson.M {
+	if strings.Contains(h.ID.Src, "/") {
+		return data.Subnet{CIDR: h.ID.Src, NetworkUUID: h.ID.SrcNetworkUUID}.BSONKey()
+	}
+	return data.UniqueIP{IP: h.ID.Src, NetworkUUID: h.ID.SrcNetworkUUID}.BSONKey()
+}
+
+//RecomputeHostMaxScores rebuilds the max proxy beacon entries of the hosts table from
+//the proxy beacons left in the selected database. It is run after chunks are removed
+//from a rolling database, since the entries tracking a host's max proxy beacon may
+//have been removed while other proxy beacons from the host remain. It also reconciles
+//the hosts table after proxy beacons are deleted by hand. As with the analysis,
+//each host keeps an entry for the highest scoring proxy beacon of each chunk.
+//Returns the number of hosts given max proxy beacon entries.
+func RecomputeHostMaxScores(db *database.DB, conf *config.Config) (int, error) {
+	ssn := db.Session.Copy()
+	defer ssn.Close()
+
+	hosts := ssn.DB(db.GetSelectedDB()).C(conf.T.Structure.HostTable)
+	beacons := ssn.DB(db.GetSelectedDB()).C(conf.T.BeaconProxy.BeaconProxyTable)
+
+	// clear out the existing max proxy beacon entries. The entries holding the data
+	// of other modules are left alone.
+	maxBeaconEntry := bson.M{"mbproxy": bson.M{"$exists": true}}
+	_, err := hosts.UpdateAll(
+		bson.M{"dat": bson.M{"$elemMatch": maxBeaconEntry}},
+		bson.M{"$pull": bson.M{"dat": maxBeaconEntry}},
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	// find the highest scoring proxy beacon of each chunk for every source
+	pipeline := []bson.M{
+		{"$match": bson.M{"score": bson.M{"$exists": true}}},
+		{"$sort": bson.M{"score": -1}},
+		{"$group": bson.M{
+			"_id": bson.M{
+				"src":              "$src",
+				"src_network_uuid": "$src_network_uuid",
+				"cid":              "$cid",
+			},
+			"max_beacon_proxy_score": bson.M{"$first": "$score"},
+			"mbproxy":                bson.M{"$first": "$fqdn"},
+		}},
+		{"$group": bson.M{
+			"_id": bson.M{
+				"src":              "$_id.src",
+				"src_network_uuid": "$_id.src_network_uuid",
+			},
+			"dat": bson.M{"$push": bson.M{
+				"max_beacon_proxy_score": "$max_beacon_proxy_score",
+				"mbproxy":                "$mbproxy",
+				"cid":                    "$_id.cid",
+			}},
+		}},
+	}
+
+	count := 0
+	var host hostMaxBeacons
+	iter := beacons.Pipe(pipeline).AllowDiskUse().Iter()
+	for iter.Next(&host) {
+		_, err := hosts.Upsert(host.hostKey(), bson.M{"$push": bson.M{"dat": bson.M{"$each": host.Dat}}})
+		if err != nil {
+			iter.Close()
+			return count, err
+		}
+		count++
+		host = hostMaxBeacons{}
+	}
+
+	return count, iter.Close()
+}
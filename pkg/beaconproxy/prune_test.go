@@ -0,0 +1,24 @@
+package beaconproxy
+
+import (
+	"net"
+	"testing"
+
+	"github.com/activecm/rita/pkg/data"
+	"github.com/activecm/rita/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHostMaxBeaconsHostKey(t *testing.T) {
+	var host hostMaxBeacons
+	host.ID.SrcNetworkUUID = util.UnknownPrivateNetworkUUID
+
+	// the keys match the ones used by hostBeaconQuery
+	host.ID.Src = "10.0.0.1"
+	src := data.NewUniqueIP(net.ParseIP("10.0.0.1"), "", "")
+	require.Equal(t, src.BSONKey(), host.hostKey())
+
+	host.ID.Src = "10.0.0.0/24"
+	subnet := data.Subnet{CIDR: "10.0.0.0/24", NetworkUUID: util.UnknownPrivateNetworkUUID}
+	require.Equal(t, subnet.BSONKey(), host.hostKey())
+}
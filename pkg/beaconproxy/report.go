@@ -0,0 +1,51 @@
+package beaconproxy
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/activecm/rita/database"
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+)
+
+//topResults finds the n highest scoring proxy beacons last updated in the given chunk
+//which score at least minScore. The query is sent to the primary so the results
+//include the writes made by the analysis that just finished.
+func topResults(db *database.DB, collection string, chunk int, n int, minScore float64) ([]Result, error) {
+	ssn := db.Session.Copy()
+	defer ssn.Close()
+	ssn.SetMode(mgo.Primary, true)
+
+	var results []Result
+
+	query := bson.M{
+		"cid":   chunk,
+		"score": bson.M{"$gte": minScore},
+	}
+
+	err := ssn.DB(db.GetSelectedDB()).C(collection).
+		Find(query).
+		Sort("-score", "src", "fqdn").
+		Limit(n).
+		All(&results)
+
+	return results, err
+}
+
+//writeTopResults renders the proxy beacons as a table
+func writeTopResults(results []Result, w io.Writer) error {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(table, "\tScore\tSource\tFQDN\tTop Intvl\tConnections\t")
+	for _, result := range results {
+		fmt.Fprintf(table, "\t%s\t%s\t%s\t%d\t%d\t\n",
+			strconv.FormatFloat(result.Score, 'f', 3, 64),
+			result.SrcIP, result.FQDN, result.Ts.Mode, result.Connections,
+		)
+	}
+
+	return table.Flush()
+}
@@ -0,0 +1,24 @@
+package beaconproxy
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteTopResults(t *testing.T) {
+	results := []Result{
+		{SrcIP: "10.0.0.1", FQDN: "example.com", Connections: 1440, Ts: TSData{Mode: 60}, Score: 0.9876},
+		{SrcIP: "10.0.0.20", FQDN: "a.long.example.org", Connections: 24, Ts: TSData{Mode: 3600}, Score: 0.5},
+	}
+
+	var buffer bytes.Buffer
+	require.Nil(t, writeTopResults(results, &buffer))
+
+	expected := "" +
+		"  Score  Source     FQDN                Top Intvl  Connections  \n" +
+		"  0.988  10.0.0.1   example.com         60         1440         \n" +
+		"  0.500  10.0.0.20  a.long.example.org  3600       24           \n"
+	require.Equal(t, expected, buffer.String())
+}
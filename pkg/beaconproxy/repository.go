@@ -11,7 +11,8 @@ type (
 	// Repository for host collection
 	Repository interface {
 		CreateIndexes() error
-		Upsert(uconnProxyMap map[string]*uconnproxy.Input, minTimestamp, maxTimestamp int64)
+		Upsert(uconnProxyMap map[string]*uconnproxy.Input, minTimestamp, maxTimestamp int64) error
+		AnalyzeAggregated(entries []*uconnproxy.Input, minTimestamp, maxTimestamp int64) error
 	}
 
 	updateInfo struct {
@@ -19,20 +20,55 @@ type (
 		query    bson.M
 	}
 
+	//maxBeaconUpdate holds the updates which record a proxy beacon as the max proxy
+	//beacon of its source. They are applied in order, and each one is conditioned on the
+	//state of the host record when it is applied rather than when the beacon was analyzed.
+	maxBeaconUpdate struct {
+		host    updateInfo // creates the host record if it doesn't exist
+		insert  updateInfo // adds an entry for the chunk if it doesn't have one
+		replace updateInfo // replaces the chunk's entry if it has a lower score or the same fqdn
+	}
+
+	//hostProxyBeaconDat holds the max proxy beacon fields of a host's dat entry.
+	//The pointer fields are nil when the entry does not track a max proxy beacon.
+	hostProxyBeaconDat struct {
+		MaxBeaconProxyScore *float64 `bson:"max_beacon_proxy_score"`
+		MBProxy             *string  `bson:"mbproxy"`
+		CID                 int      `bson:"cid"`
+	}
+
 	//update ....
 	update struct {
 		beacon     updateInfo
-		hostBeacon updateInfo
+		hostBeacon maxBeaconUpdate
 		uconnproxy updateInfo
+		score      float64 // overall score of the beacon, used to summarize dry runs
 	}
 
 	//TSData ...
 	TSData struct {
-		Range      int64   `bson:"range"`
-		Mode       int64   `bson:"mode"`
-		ModeCount  int64   `bson:"mode_count"`
+		Range           int64    `bson:"range"`
+		Mode            int64    `bson:"mode"`
+		ModeCount       int64    `bson:"mode_count"`
+		Skew            float64  `bson:"skew"`
+		Dispersion      int64    `bson:"dispersion"`
+		SkewScore       float64  `bson:"skew_score"`
+		DispersionScore float64  `bson:"dispersion_score"`
+		ConnsScore      float64  `bson:"conns_score"`
+		AutocorrScore   *float64 `bson:"autocorr_score,omitempty"` // only set if autocorrelation is enabled
+		DriftSlope      *float64 `bson:"drift_slope,omitempty"`    // only set if drift analysis is enabled
+		DriftScore      *float64 `bson:"drift_score,omitempty"`    // only set if drift analysis is enabled
+		Score           float64  `bson:"score"`
+		Intervals       []int64  `bson:"intervals"`
+		IntervalCounts  []int64  `bson:"interval_counts"`
+	}
+
+	//DurData holds the connection duration regularity of a proxy beacon.
+	//It is only set if duration analysis is enabled.
+	DurData struct {
 		Skew       float64 `bson:"skew"`
-		Dispersion int64   `bson:"dispersion"`
+		Dispersion float64 `bson:"dispersion"`
+		Score      float64 `bson:"score"`
 	}
 
 	//Result represents a beacon proxy between a source IP and
@@ -44,8 +80,14 @@ type (
 		SrcNetworkUUID bson.Binary   `bson:"src_network_uuid"`
 		Connections    int64         `bson:"connection_count"`
 		Ts             TSData        `bson:"ts"`
+		Dur            DurData       `bson:"dur"`
 		Score          float64       `bson:"score"`
+		ScoreBand      string        `bson:"score_band"`
 		Proxy          data.UniqueIP `bson:"proxy"`
+		CID            int           `bson:"cid"`
+		TsList         []int64       `bson:"tslist"`
+		TsListCount    int64         `bson:"tslist_count"`
+		LowConfidence  bool          `bson:"low_confidence"`
 	}
 
 	//StrobeResult represents a unique connection with a large amount
@@ -0,0 +1,629 @@
+// The Go code is generated with protoc-gen-go v1.28.0 and protoc-gen-go-grpc v1.2.0:
+//   protoc --go_out=. --go_opt=paths=source_relative \
+//     --go-grpc_out=. --go-grpc_opt=paths=source_relative beaconproxy.proto
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.28.0
+// 	protoc        (unknown)
+// source: beaconproxy.proto
+
+package rpc
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type StreamBeaconsRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// database is the RITA database to read
+	Database string `protobuf:"bytes,1,opt,name=database,proto3" json:"database,omitempty"`
+	// min_score is the lowest score which is returned
+	MinScore float64 `protobuf:"fixed64,2,opt,name=min_score,json=minScore,proto3" json:"min_score,omitempty"`
+	// chunk limits the results to those last updated in a chunk of a rolling database
+	Chunk *int32 `protobuf:"varint,3,opt,name=chunk,proto3,oneof" json:"chunk,omitempty"`
+}
+
+func (x *StreamBeaconsRequest) Reset() {
+	*x = StreamBeaconsRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_beaconproxy_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *StreamBeaconsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamBeaconsRequest) ProtoMessage() {}
+
+func (x *StreamBeaconsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_beaconproxy_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamBeaconsRequest.ProtoReflect.Descriptor instead.
+func (*StreamBeaconsRequest) Descriptor() ([]byte, []int) {
+	return file_beaconproxy_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *StreamBeaconsRequest) GetDatabase() string {
+	if x != nil {
+		return x.Database
+	}
+	return ""
+}
+
+func (x *StreamBeaconsRequest) GetMinScore() float64 {
+	if x != nil {
+		return x.MinScore
+	}
+	return 0
+}
+
+func (x *StreamBeaconsRequest) GetChunk() int32 {
+	if x != nil && x.Chunk != nil {
+		return *x.Chunk
+	}
+	return 0
+}
+
+// Beacon mirrors the proxy beacon records written by export-beacons-proxy
+type Beacon struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Src              string          `protobuf:"bytes,1,opt,name=src,proto3" json:"src,omitempty"`
+	SrcNetworkName   string          `protobuf:"bytes,2,opt,name=src_network_name,json=srcNetworkName,proto3" json:"src_network_name,omitempty"`
+	SrcNetworkUuid   string          `protobuf:"bytes,3,opt,name=src_network_uuid,json=srcNetworkUuid,proto3" json:"src_network_uuid,omitempty"`
+	Fqdn             string          `protobuf:"bytes,4,opt,name=fqdn,proto3" json:"fqdn,omitempty"`
+	Proxy            string          `protobuf:"bytes,5,opt,name=proxy,proto3" json:"proxy,omitempty"`
+	ProxyNetworkName string          `protobuf:"bytes,6,opt,name=proxy_network_name,json=proxyNetworkName,proto3" json:"proxy_network_name,omitempty"`
+	ProxyNetworkUuid string          `protobuf:"bytes,7,opt,name=proxy_network_uuid,json=proxyNetworkUuid,proto3" json:"proxy_network_uuid,omitempty"`
+	Cid              int32           `protobuf:"varint,8,opt,name=cid,proto3" json:"cid,omitempty"`
+	ConnectionCount  int64           `protobuf:"varint,9,opt,name=connection_count,json=connectionCount,proto3" json:"connection_count,omitempty"`
+	Score            float64         `protobuf:"fixed64,10,opt,name=score,proto3" json:"score,omitempty"`
+	Ts               *TimestampScore `protobuf:"bytes,11,opt,name=ts,proto3" json:"ts,omitempty"`
+	// dur is only set if the duration regularity was scored
+	Dur    *DurationScore `protobuf:"bytes,12,opt,name=dur,proto3" json:"dur,omitempty"`
+	Tslist []int64        `protobuf:"varint,13,rep,packed,name=tslist,proto3" json:"tslist,omitempty"`
+}
+
+func (x *Beacon) Reset() {
+	*x = Beacon{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_beaconproxy_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Beacon) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Beacon) ProtoMessage() {}
+
+func (x *Beacon) ProtoReflect() protoreflect.Message {
+	mi := &file_beaconproxy_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Beacon.ProtoReflect.Descriptor instead.
+func (*Beacon) Descriptor() ([]byte, []int) {
+	return file_beaconproxy_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Beacon) GetSrc() string {
+	if x != nil {
+		return x.Src
+	}
+	return ""
+}
+
+func (x *Beacon) GetSrcNetworkName() string {
+	if x != nil {
+		return x.SrcNetworkName
+	}
+	return ""
+}
+
+func (x *Beacon) GetSrcNetworkUuid() string {
+	if x != nil {
+		return x.SrcNetworkUuid
+	}
+	return ""
+}
+
+func (x *Beacon) GetFqdn() string {
+	if x != nil {
+		return x.Fqdn
+	}
+	return ""
+}
+
+func (x *Beacon) GetProxy() string {
+	if x != nil {
+		return x.Proxy
+	}
+	return ""
+}
+
+func (x *Beacon) GetProxyNetworkName() string {
+	if x != nil {
+		return x.ProxyNetworkName
+	}
+	return ""
+}
+
+func (x *Beacon) GetProxyNetworkUuid() string {
+	if x != nil {
+		return x.ProxyNetworkUuid
+	}
+	return ""
+}
+
+func (x *Beacon) GetCid() int32 {
+	if x != nil {
+		return x.Cid
+	}
+	return 0
+}
+
+func (x *Beacon) GetConnectionCount() int64 {
+	if x != nil {
+		return x.ConnectionCount
+	}
+	return 0
+}
+
+func (x *Beacon) GetScore() float64 {
+	if x != nil {
+		return x.Score
+	}
+	return 0
+}
+
+func (x *Beacon) GetTs() *TimestampScore {
+	if x != nil {
+		return x.Ts
+	}
+	return nil
+}
+
+func (x *Beacon) GetDur() *DurationScore {
+	if x != nil {
+		return x.Dur
+	}
+	return nil
+}
+
+func (x *Beacon) GetTslist() []int64 {
+	if x != nil {
+		return x.Tslist
+	}
+	return nil
+}
+
+type TimestampScore struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Score           float64 `protobuf:"fixed64,1,opt,name=score,proto3" json:"score,omitempty"`
+	Range           int64   `protobuf:"varint,2,opt,name=range,proto3" json:"range,omitempty"`
+	Mode            int64   `protobuf:"varint,3,opt,name=mode,proto3" json:"mode,omitempty"`
+	ModeCount       int64   `protobuf:"varint,4,opt,name=mode_count,json=modeCount,proto3" json:"mode_count,omitempty"`
+	Skew            float64 `protobuf:"fixed64,5,opt,name=skew,proto3" json:"skew,omitempty"`
+	Dispersion      int64   `protobuf:"varint,6,opt,name=dispersion,proto3" json:"dispersion,omitempty"`
+	SkewScore       float64 `protobuf:"fixed64,7,opt,name=skew_score,json=skewScore,proto3" json:"skew_score,omitempty"`
+	DispersionScore float64 `protobuf:"fixed64,8,opt,name=dispersion_score,json=dispersionScore,proto3" json:"dispersion_score,omitempty"`
+	ConnsScore      float64 `protobuf:"fixed64,9,opt,name=conns_score,json=connsScore,proto3" json:"conns_score,omitempty"`
+	// autocorr_score is only set if autocorrelation was scored
+	AutocorrScore  *float64 `protobuf:"fixed64,10,opt,name=autocorr_score,json=autocorrScore,proto3,oneof" json:"autocorr_score,omitempty"`
+	Intervals      []int64  `protobuf:"varint,11,rep,packed,name=intervals,proto3" json:"intervals,omitempty"`
+	IntervalCounts []int64  `protobuf:"varint,12,rep,packed,name=interval_counts,json=intervalCounts,proto3" json:"interval_counts,omitempty"`
+}
+
+func (x *TimestampScore) Reset() {
+	*x = TimestampScore{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_beaconproxy_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *TimestampScore) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TimestampScore) ProtoMessage() {}
+
+func (x *TimestampScore) ProtoReflect() protoreflect.Message {
+	mi := &file_beaconproxy_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TimestampScore.ProtoReflect.Descriptor instead.
+func (*TimestampScore) Descriptor() ([]byte, []int) {
+	return file_beaconproxy_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *TimestampScore) GetScore() float64 {
+	if x != nil {
+		return x.Score
+	}
+	return 0
+}
+
+func (x *TimestampScore) GetRange() int64 {
+	if x != nil {
+		return x.Range
+	}
+	return 0
+}
+
+func (x *TimestampScore) GetMode() int64 {
+	if x != nil {
+		return x.Mode
+	}
+	return 0
+}
+
+func (x *TimestampScore) GetModeCount() int64 {
+	if x != nil {
+		return x.ModeCount
+	}
+	return 0
+}
+
+func (x *TimestampScore) GetSkew() float64 {
+	if x != nil {
+		return x.Skew
+	}
+	return 0
+}
+
+func (x *TimestampScore) GetDispersion() int64 {
+	if x != nil {
+		return x.Dispersion
+	}
+	return 0
+}
+
+func (x *TimestampScore) GetSkewScore() float64 {
+	if x != nil {
+		return x.SkewScore
+	}
+	return 0
+}
+
+func (x *TimestampScore) GetDispersionScore() float64 {
+	if x != nil {
+		return x.DispersionScore
+	}
+	return 0
+}
+
+func (x *TimestampScore) GetConnsScore() float64 {
+	if x != nil {
+		return x.ConnsScore
+	}
+	return 0
+}
+
+func (x *TimestampScore) GetAutocorrScore() float64 {
+	if x != nil && x.AutocorrScore != nil {
+		return *x.AutocorrScore
+	}
+	return 0
+}
+
+func (x *TimestampScore) GetIntervals() []int64 {
+	if x != nil {
+		return x.Intervals
+	}
+	return nil
+}
+
+func (x *TimestampScore) GetIntervalCounts() []int64 {
+	if x != nil {
+		return x.IntervalCounts
+	}
+	return nil
+}
+
+type DurationScore struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Skew       float64 `protobuf:"fixed64,1,opt,name=skew,proto3" json:"skew,omitempty"`
+	Dispersion float64 `protobuf:"fixed64,2,opt,name=dispersion,proto3" json:"dispersion,omitempty"`
+	Score      float64 `protobuf:"fixed64,3,opt,name=score,proto3" json:"score,omitempty"`
+}
+
+func (x *DurationScore) Reset() {
+	*x = DurationScore{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_beaconproxy_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *DurationScore) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DurationScore) ProtoMessage() {}
+
+func (x *DurationScore) ProtoReflect() protoreflect.Message {
+	mi := &file_beaconproxy_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DurationScore.ProtoReflect.Descriptor instead.
+func (*DurationScore) Descriptor() ([]byte, []int) {
+	return file_beaconproxy_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *DurationScore) GetSkew() float64 {
+	if x != nil {
+		return x.Skew
+	}
+	return 0
+}
+
+func (x *DurationScore) GetDispersion() float64 {
+	if x != nil {
+		return x.Dispersion
+	}
+	return 0
+}
+
+func (x *DurationScore) GetScore() float64 {
+	if x != nil {
+		return x.Score
+	}
+	return 0
+}
+
+var File_beaconproxy_proto protoreflect.FileDescriptor
+
+var file_beaconproxy_proto_rawDesc = []byte{
+	0x0a, 0x11, 0x62, 0x65, 0x61, 0x63, 0x6f, 0x6e, 0x70, 0x72, 0x6f, 0x78, 0x79, 0x2e, 0x70, 0x72,
+	0x6f, 0x74, 0x6f, 0x12, 0x13, 0x72, 0x69, 0x74, 0x61, 0x2e, 0x62, 0x65, 0x61, 0x63, 0x6f, 0x6e,
+	0x70, 0x72, 0x6f, 0x78, 0x79, 0x2e, 0x76, 0x31, 0x22, 0x74, 0x0a, 0x14, 0x53, 0x74, 0x72, 0x65,
+	0x61, 0x6d, 0x42, 0x65, 0x61, 0x63, 0x6f, 0x6e, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74,
+	0x12, 0x1a, 0x0a, 0x08, 0x64, 0x61, 0x74, 0x61, 0x62, 0x61, 0x73, 0x65, 0x18, 0x01, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x08, 0x64, 0x61, 0x74, 0x61, 0x62, 0x61, 0x73, 0x65, 0x12, 0x1b, 0x0a, 0x09,
+	0x6d, 0x69, 0x6e, 0x5f, 0x73, 0x63, 0x6f, 0x72, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x01, 0x52,
+	0x08, 0x6d, 0x69, 0x6e, 0x53, 0x63, 0x6f, 0x72, 0x65, 0x12, 0x19, 0x0a, 0x05, 0x63, 0x68, 0x75,
+	0x6e, 0x6b, 0x18, 0x03, 0x20, 0x01, 0x28, 0x05, 0x48, 0x00, 0x52, 0x05, 0x63, 0x68, 0x75, 0x6e,
+	0x6b, 0x88, 0x01, 0x01, 0x42, 0x08, 0x0a, 0x06, 0x5f, 0x63, 0x68, 0x75, 0x6e, 0x6b, 0x22, 0xca,
+	0x03, 0x0a, 0x06, 0x42, 0x65, 0x61, 0x63, 0x6f, 0x6e, 0x12, 0x10, 0x0a, 0x03, 0x73, 0x72, 0x63,
+	0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x73, 0x72, 0x63, 0x12, 0x28, 0x0a, 0x10, 0x73,
+	0x72, 0x63, 0x5f, 0x6e, 0x65, 0x74, 0x77, 0x6f, 0x72, 0x6b, 0x5f, 0x6e, 0x61, 0x6d, 0x65, 0x18,
+	0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0e, 0x73, 0x72, 0x63, 0x4e, 0x65, 0x74, 0x77, 0x6f, 0x72,
+	0x6b, 0x4e, 0x61, 0x6d, 0x65, 0x12, 0x28, 0x0a, 0x10, 0x73, 0x72, 0x63, 0x5f, 0x6e, 0x65, 0x74,
+	0x77, 0x6f, 0x72, 0x6b, 0x5f, 0x75, 0x75, 0x69, 0x64, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x0e, 0x73, 0x72, 0x63, 0x4e, 0x65, 0x74, 0x77, 0x6f, 0x72, 0x6b, 0x55, 0x75, 0x69, 0x64, 0x12,
+	0x12, 0x0a, 0x04, 0x66, 0x71, 0x64, 0x6e, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x66,
+	0x71, 0x64, 0x6e, 0x12, 0x14, 0x0a, 0x05, 0x70, 0x72, 0x6f, 0x78, 0x79, 0x18, 0x05, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x05, 0x70, 0x72, 0x6f, 0x78, 0x79, 0x12, 0x2c, 0x0a, 0x12, 0x70, 0x72, 0x6f,
+	0x78, 0x79, 0x5f, 0x6e, 0x65, 0x74, 0x77, 0x6f, 0x72, 0x6b, 0x5f, 0x6e, 0x61, 0x6d, 0x65, 0x18,
+	0x06, 0x20, 0x01, 0x28, 0x09, 0x52, 0x10, 0x70, 0x72, 0x6f, 0x78, 0x79, 0x4e, 0x65, 0x74, 0x77,
+	0x6f, 0x72, 0x6b, 0x4e, 0x61, 0x6d, 0x65, 0x12, 0x2c, 0x0a, 0x12, 0x70, 0x72, 0x6f, 0x78, 0x79,
+	0x5f, 0x6e, 0x65, 0x74, 0x77, 0x6f, 0x72, 0x6b, 0x5f, 0x75, 0x75, 0x69, 0x64, 0x18, 0x07, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x10, 0x70, 0x72, 0x6f, 0x78, 0x79, 0x4e, 0x65, 0x74, 0x77, 0x6f, 0x72,
+	0x6b, 0x55, 0x75, 0x69, 0x64, 0x12, 0x10, 0x0a, 0x03, 0x63, 0x69, 0x64, 0x18, 0x08, 0x20, 0x01,
+	0x28, 0x05, 0x52, 0x03, 0x63, 0x69, 0x64, 0x12, 0x29, 0x0a, 0x10, 0x63, 0x6f, 0x6e, 0x6e, 0x65,
+	0x63, 0x74, 0x69, 0x6f, 0x6e, 0x5f, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x18, 0x09, 0x20, 0x01, 0x28,
+	0x03, 0x52, 0x0f, 0x63, 0x6f, 0x6e, 0x6e, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x43, 0x6f, 0x75,
+	0x6e, 0x74, 0x12, 0x14, 0x0a, 0x05, 0x73, 0x63, 0x6f, 0x72, 0x65, 0x18, 0x0a, 0x20, 0x01, 0x28,
+	0x01, 0x52, 0x05, 0x73, 0x63, 0x6f, 0x72, 0x65, 0x12, 0x33, 0x0a, 0x02, 0x74, 0x73, 0x18, 0x0b,
+	0x20, 0x01, 0x28, 0x0b, 0x32, 0x23, 0x2e, 0x72, 0x69, 0x74, 0x61, 0x2e, 0x62, 0x65, 0x61, 0x63,
+	0x6f, 0x6e, 0x70, 0x72, 0x6f, 0x78, 0x79, 0x2e, 0x76, 0x31, 0x2e, 0x54, 0x69, 0x6d, 0x65, 0x73,
+	0x74, 0x61, 0x6d, 0x70, 0x53, 0x63, 0x6f, 0x72, 0x65, 0x52, 0x02, 0x74, 0x73, 0x12, 0x34, 0x0a,
+	0x03, 0x64, 0x75, 0x72, 0x18, 0x0c, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x22, 0x2e, 0x72, 0x69, 0x74,
+	0x61, 0x2e, 0x62, 0x65, 0x61, 0x63, 0x6f, 0x6e, 0x70, 0x72, 0x6f, 0x78, 0x79, 0x2e, 0x76, 0x31,
+	0x2e, 0x44, 0x75, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x53, 0x63, 0x6f, 0x72, 0x65, 0x52, 0x03,
+	0x64, 0x75, 0x72, 0x12, 0x16, 0x0a, 0x06, 0x74, 0x73, 0x6c, 0x69, 0x73, 0x74, 0x18, 0x0d, 0x20,
+	0x03, 0x28, 0x03, 0x52, 0x06, 0x74, 0x73, 0x6c, 0x69, 0x73, 0x74, 0x22, 0x94, 0x03, 0x0a, 0x0e,
+	0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x53, 0x63, 0x6f, 0x72, 0x65, 0x12, 0x14,
+	0x0a, 0x05, 0x73, 0x63, 0x6f, 0x72, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x01, 0x52, 0x05, 0x73,
+	0x63, 0x6f, 0x72, 0x65, 0x12, 0x14, 0x0a, 0x05, 0x72, 0x61, 0x6e, 0x67, 0x65, 0x18, 0x02, 0x20,
+	0x01, 0x28, 0x03, 0x52, 0x05, 0x72, 0x61, 0x6e, 0x67, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x6d, 0x6f,
+	0x64, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x03, 0x52, 0x04, 0x6d, 0x6f, 0x64, 0x65, 0x12, 0x1d,
+	0x0a, 0x0a, 0x6d, 0x6f, 0x64, 0x65, 0x5f, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x18, 0x04, 0x20, 0x01,
+	0x28, 0x03, 0x52, 0x09, 0x6d, 0x6f, 0x64, 0x65, 0x43, 0x6f, 0x75, 0x6e, 0x74, 0x12, 0x12, 0x0a,
+	0x04, 0x73, 0x6b, 0x65, 0x77, 0x18, 0x05, 0x20, 0x01, 0x28, 0x01, 0x52, 0x04, 0x73, 0x6b, 0x65,
+	0x77, 0x12, 0x1e, 0x0a, 0x0a, 0x64, 0x69, 0x73, 0x70, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x18,
+	0x06, 0x20, 0x01, 0x28, 0x03, 0x52, 0x0a, 0x64, 0x69, 0x73, 0x70, 0x65, 0x72, 0x73, 0x69, 0x6f,
+	0x6e, 0x12, 0x1d, 0x0a, 0x0a, 0x73, 0x6b, 0x65, 0x77, 0x5f, 0x73, 0x63, 0x6f, 0x72, 0x65, 0x18,
+	0x07, 0x20, 0x01, 0x28, 0x01, 0x52, 0x09, 0x73, 0x6b, 0x65, 0x77, 0x53, 0x63, 0x6f, 0x72, 0x65,
+	0x12, 0x29, 0x0a, 0x10, 0x64, 0x69, 0x73, 0x70, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x5f, 0x73,
+	0x63, 0x6f, 0x72, 0x65, 0x18, 0x08, 0x20, 0x01, 0x28, 0x01, 0x52, 0x0f, 0x64, 0x69, 0x73, 0x70,
+	0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x53, 0x63, 0x6f, 0x72, 0x65, 0x12, 0x1f, 0x0a, 0x0b, 0x63,
+	0x6f, 0x6e, 0x6e, 0x73, 0x5f, 0x73, 0x63, 0x6f, 0x72, 0x65, 0x18, 0x09, 0x20, 0x01, 0x28, 0x01,
+	0x52, 0x0a, 0x63, 0x6f, 0x6e, 0x6e, 0x73, 0x53, 0x63, 0x6f, 0x72, 0x65, 0x12, 0x2a, 0x0a, 0x0e,
+	0x61, 0x75, 0x74, 0x6f, 0x63, 0x6f, 0x72, 0x72, 0x5f, 0x73, 0x63, 0x6f, 0x72, 0x65, 0x18, 0x0a,
+	0x20, 0x01, 0x28, 0x01, 0x48, 0x00, 0x52, 0x0d, 0x61, 0x75, 0x74, 0x6f, 0x63, 0x6f, 0x72, 0x72,
+	0x53, 0x63, 0x6f, 0x72, 0x65, 0x88, 0x01, 0x01, 0x12, 0x1c, 0x0a, 0x09, 0x69, 0x6e, 0x74, 0x65,
+	0x72, 0x76, 0x61, 0x6c, 0x73, 0x18, 0x0b, 0x20, 0x03, 0x28, 0x03, 0x52, 0x09, 0x69, 0x6e, 0x74,
+	0x65, 0x72, 0x76, 0x61, 0x6c, 0x73, 0x12, 0x27, 0x0a, 0x0f, 0x69, 0x6e, 0x74, 0x65, 0x72, 0x76,
+	0x61, 0x6c, 0x5f, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x73, 0x18, 0x0c, 0x20, 0x03, 0x28, 0x03, 0x52,
+	0x0e, 0x69, 0x6e, 0x74, 0x65, 0x72, 0x76, 0x61, 0x6c, 0x43, 0x6f, 0x75, 0x6e, 0x74, 0x73, 0x42,
+	0x11, 0x0a, 0x0f, 0x5f, 0x61, 0x75, 0x74, 0x6f, 0x63, 0x6f, 0x72, 0x72, 0x5f, 0x73, 0x63, 0x6f,
+	0x72, 0x65, 0x22, 0x59, 0x0a, 0x0d, 0x44, 0x75, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x53, 0x63,
+	0x6f, 0x72, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x73, 0x6b, 0x65, 0x77, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x01, 0x52, 0x04, 0x73, 0x6b, 0x65, 0x77, 0x12, 0x1e, 0x0a, 0x0a, 0x64, 0x69, 0x73, 0x70, 0x65,
+	0x72, 0x73, 0x69, 0x6f, 0x6e, 0x18, 0x02, 0x20, 0x01, 0x28, 0x01, 0x52, 0x0a, 0x64, 0x69, 0x73,
+	0x70, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x14, 0x0a, 0x05, 0x73, 0x63, 0x6f, 0x72, 0x65,
+	0x18, 0x03, 0x20, 0x01, 0x28, 0x01, 0x52, 0x05, 0x73, 0x63, 0x6f, 0x72, 0x65, 0x32, 0x6f, 0x0a,
+	0x12, 0x42, 0x65, 0x61, 0x63, 0x6f, 0x6e, 0x50, 0x72, 0x6f, 0x78, 0x79, 0x53, 0x65, 0x72, 0x76,
+	0x69, 0x63, 0x65, 0x12, 0x59, 0x0a, 0x0d, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x42, 0x65, 0x61,
+	0x63, 0x6f, 0x6e, 0x73, 0x12, 0x29, 0x2e, 0x72, 0x69, 0x74, 0x61, 0x2e, 0x62, 0x65, 0x61, 0x63,
+	0x6f, 0x6e, 0x70, 0x72, 0x6f, 0x78, 0x79, 0x2e, 0x76, 0x31, 0x2e, 0x53, 0x74, 0x72, 0x65, 0x61,
+	0x6d, 0x42, 0x65, 0x61, 0x63, 0x6f, 0x6e, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a,
+	0x1b, 0x2e, 0x72, 0x69, 0x74, 0x61, 0x2e, 0x62, 0x65, 0x61, 0x63, 0x6f, 0x6e, 0x70, 0x72, 0x6f,
+	0x78, 0x79, 0x2e, 0x76, 0x31, 0x2e, 0x42, 0x65, 0x61, 0x63, 0x6f, 0x6e, 0x30, 0x01, 0x42, 0x2e,
+	0x5a, 0x2c, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x61, 0x63, 0x74,
+	0x69, 0x76, 0x65, 0x63, 0x6d, 0x2f, 0x72, 0x69, 0x74, 0x61, 0x2f, 0x70, 0x6b, 0x67, 0x2f, 0x62,
+	0x65, 0x61, 0x63, 0x6f, 0x6e, 0x70, 0x72, 0x6f, 0x78, 0x79, 0x2f, 0x72, 0x70, 0x63, 0x62, 0x06,
+	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_beaconproxy_proto_rawDescOnce sync.Once
+	file_beaconproxy_proto_rawDescData = file_beaconproxy_proto_rawDesc
+)
+
+func file_beaconproxy_proto_rawDescGZIP() []byte {
+	file_beaconproxy_proto_rawDescOnce.Do(func() {
+		file_beaconproxy_proto_rawDescData = protoimpl.X.CompressGZIP(file_beaconproxy_proto_rawDescData)
+	})
+	return file_beaconproxy_proto_rawDescData
+}
+
+var file_beaconproxy_proto_msgTypes = make([]protoimpl.MessageInfo, 4)
+var file_beaconproxy_proto_goTypes = []interface{}{
+	(*StreamBeaconsRequest)(nil), // 0: rita.beaconproxy.v1.StreamBeaconsRequest
+	(*Beacon)(nil),               // 1: rita.beaconproxy.v1.Beacon
+	(*TimestampScore)(nil),       // 2: rita.beaconproxy.v1.TimestampScore
+	(*DurationScore)(nil),        // 3: rita.beaconproxy.v1.DurationScore
+}
+var file_beaconproxy_proto_depIdxs = []int32{
+	2, // 0: rita.beaconproxy.v1.Beacon.ts:type_name -> rita.beaconproxy.v1.TimestampScore
+	3, // 1: rita.beaconproxy.v1.Beacon.dur:type_name -> rita.beaconproxy.v1.DurationScore
+	0, // 2: rita.beaconproxy.v1.BeaconProxyService.StreamBeacons:input_type -> rita.beaconproxy.v1.StreamBeaconsRequest
+	1, // 3: rita.beaconproxy.v1.BeaconProxyService.StreamBeacons:output_type -> rita.beaconproxy.v1.Beacon
+	3, // [3:4] is the sub-list for method output_type
+	2, // [2:3] is the sub-list for method input_type
+	2, // [2:2] is the sub-list for extension type_name
+	2, // [2:2] is the sub-list for extension extendee
+	0, // [0:2] is the sub-list for field type_name
+}
+
+func init() { file_beaconproxy_proto_init() }
+func file_beaconproxy_proto_init() {
+	if File_beaconproxy_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_beaconproxy_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*StreamBeaconsRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_beaconproxy_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Beacon); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_beaconproxy_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*TimestampScore); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_beaconproxy_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*DurationScore); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	file_beaconproxy_proto_msgTypes[0].OneofWrappers = []interface{}{}
+	file_beaconproxy_proto_msgTypes[2].OneofWrappers = []interface{}{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_beaconproxy_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   4,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_beaconproxy_proto_goTypes,
+		DependencyIndexes: file_beaconproxy_proto_depIdxs,
+		MessageInfos:      file_beaconproxy_proto_msgTypes,
+	}.Build()
+	File_beaconproxy_proto = out.File
+	file_beaconproxy_proto_rawDesc = nil
+	file_beaconproxy_proto_goTypes = nil
+	file_beaconproxy_proto_depIdxs = nil
+}
@@ -0,0 +1,134 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.2.0
+// - protoc             (unknown)
+// source: beaconproxy.proto
+
+package rpc
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// BeaconProxyServiceClient is the client API for BeaconProxyService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type BeaconProxyServiceClient interface {
+	// StreamBeacons streams the proxy beacons of a database, highest scores first
+	StreamBeacons(ctx context.Context, in *StreamBeaconsRequest, opts ...grpc.CallOption) (BeaconProxyService_StreamBeaconsClient, error)
+}
+
+type beaconProxyServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewBeaconProxyServiceClient(cc grpc.ClientConnInterface) BeaconProxyServiceClient {
+	return &beaconProxyServiceClient{cc}
+}
+
+func (c *beaconProxyServiceClient) StreamBeacons(ctx context.Context, in *StreamBeaconsRequest, opts ...grpc.CallOption) (BeaconProxyService_StreamBeaconsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &BeaconProxyService_ServiceDesc.Streams[0], "/rita.beaconproxy.v1.BeaconProxyService/StreamBeacons", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &beaconProxyServiceStreamBeaconsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type BeaconProxyService_StreamBeaconsClient interface {
+	Recv() (*Beacon, error)
+	grpc.ClientStream
+}
+
+type beaconProxyServiceStreamBeaconsClient struct {
+	grpc.ClientStream
+}
+
+func (x *beaconProxyServiceStreamBeaconsClient) Recv() (*Beacon, error) {
+	m := new(Beacon)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// BeaconProxyServiceServer is the server API for BeaconProxyService service.
+// All implementations must embed UnimplementedBeaconProxyServiceServer
+// for forward compatibility
+type BeaconProxyServiceServer interface {
+	// StreamBeacons streams the proxy beacons of a database, highest scores first
+	StreamBeacons(*StreamBeaconsRequest, BeaconProxyService_StreamBeaconsServer) error
+	mustEmbedUnimplementedBeaconProxyServiceServer()
+}
+
+// UnimplementedBeaconProxyServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedBeaconProxyServiceServer struct {
+}
+
+func (UnimplementedBeaconProxyServiceServer) StreamBeacons(*StreamBeaconsRequest, BeaconProxyService_StreamBeaconsServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamBeacons not implemented")
+}
+func (UnimplementedBeaconProxyServiceServer) mustEmbedUnimplementedBeaconProxyServiceServer() {}
+
+// UnsafeBeaconProxyServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to BeaconProxyServiceServer will
+// result in compilation errors.
+type UnsafeBeaconProxyServiceServer interface {
+	mustEmbedUnimplementedBeaconProxyServiceServer()
+}
+
+func RegisterBeaconProxyServiceServer(s grpc.ServiceRegistrar, srv BeaconProxyServiceServer) {
+	s.RegisterService(&BeaconProxyService_ServiceDesc, srv)
+}
+
+func _BeaconProxyService_StreamBeacons_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamBeaconsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(BeaconProxyServiceServer).StreamBeacons(m, &beaconProxyServiceStreamBeaconsServer{stream})
+}
+
+type BeaconProxyService_StreamBeaconsServer interface {
+	Send(*Beacon) error
+	grpc.ServerStream
+}
+
+type beaconProxyServiceStreamBeaconsServer struct {
+	grpc.ServerStream
+}
+
+func (x *beaconProxyServiceStreamBeaconsServer) Send(m *Beacon) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// BeaconProxyService_ServiceDesc is the grpc.ServiceDesc for BeaconProxyService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var BeaconProxyService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "rita.beaconproxy.v1.BeaconProxyService",
+	HandlerType: (*BeaconProxyServiceServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamBeacons",
+			Handler:       _BeaconProxyService_StreamBeacons_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "beaconproxy.proto",
+}
@@ -0,0 +1,105 @@
+package rpc
+
+import (
+	"context"
+
+	"github.com/activecm/rita/pkg/beaconproxy"
+	"github.com/activecm/rita/resources"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type (
+	//streamFunc reads the proxy beacons of a database and hands each one to the callback.
+	//It has the signature of beaconproxy.StreamExport without the resources.
+	streamFunc func(ctx context.Context, database string, chunk int, minScore float64,
+		callback func(beaconproxy.ExportRecord) error) (int, error)
+
+	//Server implements BeaconProxyService on top of the proxy beacon exporter
+	Server struct {
+		UnimplementedBeaconProxyServiceServer
+		stream streamFunc
+	}
+)
+
+//NewServer creates a Server which reads proxy beacons from the MongoDB connection of
+//the resource bundle. Each stream reads through its own session.
+func NewServer(res *resources.Resources) *Server {
+	return &Server{
+		stream: func(ctx context.Context, database string, chunk int, minScore float64,
+			callback func(beaconproxy.ExportRecord) error) (int, error) {
+			return beaconproxy.StreamExport(ctx, res, database, chunk, minScore, callback)
+		},
+	}
+}
+
+//StreamBeacons sends the proxy beacons of the requested database to the client as
+//they are read. The stream ends early if the client cancels the request.
+func (s *Server) StreamBeacons(req *StreamBeaconsRequest, srv BeaconProxyService_StreamBeaconsServer) error {
+	if req.GetDatabase() == "" {
+		return status.Error(codes.InvalidArgument, "a database must be specified")
+	}
+
+	chunk := -1
+	if req.Chunk != nil {
+		chunk = int(req.GetChunk())
+	}
+
+	ctx := srv.Context()
+	_, err := s.stream(ctx, req.GetDatabase(), chunk, req.GetMinScore(),
+		func(record beaconproxy.ExportRecord) error {
+			return srv.Send(newBeacon(record))
+		},
+	)
+
+	if err == nil {
+		return nil
+	}
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return status.FromContextError(ctxErr).Err()
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+//newBeacon converts an exported proxy beacon into its protobuf message
+func newBeacon(record beaconproxy.ExportRecord) *Beacon {
+	beacon := &Beacon{
+		Src:              record.Src,
+		SrcNetworkName:   record.SrcNetworkName,
+		SrcNetworkUuid:   record.SrcNetworkUUID,
+		Fqdn:             record.FQDN,
+		Proxy:            record.Proxy,
+		ProxyNetworkName: record.ProxyNetworkName,
+		ProxyNetworkUuid: record.ProxyNetworkUUID,
+		Cid:              int32(record.CID),
+		ConnectionCount:  record.Connections,
+		Score:            record.Score,
+		Ts: &TimestampScore{
+			Score:           record.Ts.Score,
+			Range:           record.Ts.Range,
+			Mode:            record.Ts.Mode,
+			ModeCount:       record.Ts.ModeCount,
+			Skew:            record.Ts.Skew,
+			Dispersion:      record.Ts.Dispersion,
+			SkewScore:       record.Ts.SkewScore,
+			DispersionScore: record.Ts.DispersionScore,
+			ConnsScore:      record.Ts.ConnsScore,
+			AutocorrScore:   record.Ts.AutocorrScore,
+			Intervals:       record.Ts.Intervals,
+			IntervalCounts:  record.Ts.IntervalCounts,
+		},
+		Tslist: record.TsList,
+	}
+
+	if record.Dur != nil {
+		beacon.Dur = &DurationScore{
+			Skew:       record.Dur.Skew,
+			Dispersion: record.Dur.Dispersion,
+			Score:      record.Dur.Score,
+		}
+	}
+	return beacon
+}
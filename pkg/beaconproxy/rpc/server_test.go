@@ -0,0 +1,162 @@
+package rpc
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/activecm/rita/pkg/beaconproxy"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+//testClient serves the stream function over an in memory connection and returns a
+//client connected to it
+func testClient(t *testing.T, stream streamFunc) BeaconProxyServiceClient {
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer()
+	RegisterBeaconProxyServiceServer(server, &Server{stream: stream})
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+			return listener.Dial()
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.Nil(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return NewBeaconProxyServiceClient(conn)
+}
+
+func TestStreamBeacons(t *testing.T) {
+	autocorrScore := 0.9
+	records := []beaconproxy.ExportRecord{
+		{
+			Src: "10.0.0.1", SrcNetworkUUID: "ffffffff-ffff-ffff-ffff-fffffffffffe", FQDN: "example.com",
+			Proxy: "10.0.0.100", CID: 2, Connections: 24, Score: 0.9,
+			Ts: beaconproxy.ExportTSData{
+				Score: 0.85, Mode: 60, ModeCount: 23, AutocorrScore: &autocorrScore,
+				Intervals: []int64{60}, IntervalCounts: []int64{23},
+			},
+			Dur:    &beaconproxy.ExportDurData{Skew: 0.1, Dispersion: 0.2, Score: 0.8},
+			TsList: []int64{1234560, 1234620},
+		},
+		{Src: "10.0.0.2", FQDN: "example.org", Score: 0.5},
+	}
+
+	var gotDatabase string
+	var gotChunk int
+	var gotMinScore float64
+	client := testClient(t, func(ctx context.Context, database string, chunk int, minScore float64,
+		callback func(beaconproxy.ExportRecord) error) (int, error) {
+		gotDatabase, gotChunk, gotMinScore = database, chunk, minScore
+		for i, record := range records {
+			if err := callback(record); err != nil {
+				return i, err
+			}
+		}
+		return len(records), nil
+	})
+
+	chunk := int32(2)
+	stream, err := client.StreamBeacons(context.Background(),
+		&StreamBeaconsRequest{Database: "test_db", MinScore: 0.5, Chunk: &chunk})
+	require.Nil(t, err)
+
+	var beacons []*Beacon
+	for {
+		beacon, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		require.Nil(t, err)
+		beacons = append(beacons, beacon)
+	}
+
+	require.Equal(t, "test_db", gotDatabase)
+	require.Equal(t, 2, gotChunk)
+	require.Equal(t, 0.5, gotMinScore)
+
+	require.Len(t, beacons, 2)
+	require.Equal(t, "10.0.0.1", beacons[0].GetSrc())
+	require.Equal(t, "ffffffff-ffff-ffff-ffff-fffffffffffe", beacons[0].GetSrcNetworkUuid())
+	require.Equal(t, int32(2), beacons[0].GetCid())
+	require.Equal(t, int64(24), beacons[0].GetConnectionCount())
+	require.Equal(t, []int64{60}, beacons[0].GetTs().GetIntervals())
+	require.NotNil(t, beacons[0].GetTs().AutocorrScore)
+	require.Equal(t, 0.9, beacons[0].GetTs().GetAutocorrScore())
+	require.Equal(t, 0.8, beacons[0].GetDur().GetScore())
+	require.Equal(t, []int64{1234560, 1234620}, beacons[0].GetTslist())
+
+	// optional fields are left unset
+	require.Nil(t, beacons[1].GetTs().AutocorrScore)
+	require.Nil(t, beacons[1].GetDur())
+
+	// every chunk is read when no chunk is given
+	stream, err = client.StreamBeacons(context.Background(), &StreamBeaconsRequest{Database: "test_db"})
+	require.Nil(t, err)
+	for {
+		if _, err := stream.Recv(); err != nil {
+			require.Equal(t, io.EOF, err)
+			break
+		}
+	}
+	require.Equal(t, -1, gotChunk)
+}
+
+func TestStreamBeaconsMissingDatabase(t *testing.T) {
+	client := testClient(t, func(context.Context, string, int, float64,
+		func(beaconproxy.ExportRecord) error) (int, error) {
+		t.Error("no proxy beacons should be read")
+		return 0, nil
+	})
+
+	stream, err := client.StreamBeacons(context.Background(), &StreamBeaconsRequest{})
+	require.Nil(t, err)
+	_, err = stream.Recv()
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestStreamBeaconsCancel(t *testing.T) {
+	stopped := make(chan error, 1)
+	client := testClient(t, func(ctx context.Context, database string, chunk int, minScore float64,
+		callback func(beaconproxy.ExportRecord) error) (int, error) {
+		// stream proxy beacons until the client goes away, checking the context
+		// the same as StreamExport
+		count := 0
+		for {
+			if err := ctx.Err(); err != nil {
+				stopped <- err
+				return count, err
+			}
+			if err := callback(beaconproxy.ExportRecord{Src: "10.0.0.1"}); err != nil {
+				stopped <- err
+				return count, err
+			}
+			count++
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := client.StreamBeacons(ctx, &StreamBeaconsRequest{Database: "test_db"})
+	require.Nil(t, err)
+	_, err = stream.Recv()
+	require.Nil(t, err)
+	cancel()
+
+	select {
+	case err := <-stopped:
+		require.NotNil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the server kept streaming after the client canceled the request")
+	}
+}
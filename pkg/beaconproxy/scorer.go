@@ -0,0 +1,424 @@
+package beaconproxy
+
+import (
+	"math"
+	"sort"
+
+	"github.com/activecm/rita/config"
+	"github.com/activecm/rita/util"
+)
+
+type (
+	//ProxyScorer computes the score of a proxy beacon from the delta times between
+	//its connections. Alternative scoring algorithms may be provided to the
+	//repository with NewMongoRepositoryWithScorer.
+	ProxyScorer interface {
+		//Score scores the delta times (diff) between the connections of a proxy
+		//beacon. diff holds at least 3 delta times in chronological order and may be
+		//reordered or overwritten by the scorer. tsMin and tsMax bound the timestamps
+		//of the dataset.
+		Score(diff []int64, connCount int, tsMin, tsMax int64) ProxyScore
+	}
+
+	//ProxyScore holds the score of a proxy beacon along with its components
+	ProxyScore struct {
+		Skew            float64  // bowley skew of the delta times
+		Dispersion      int64    // median absolute deviation about the median of the delta times, rounded to whole timestamp units
+		SkewScore       float64  // normalized skew component
+		DispersionScore float64  // normalized dispersion component
+		ConnsScore      float64  // normalized connection count component
+		AutocorrScore   *float64 // normalized autocorrelation component, nil if not computed
+		DriftSlope      *float64 // change of the delta times per connection along their trend, nil if not computed
+		DriftScore      *float64 // normalized dispersion of the delta times around their trend, nil if not computed
+		TsScore         float64  // combined timestamp score
+		Score           float64  // overall score
+	}
+
+	//defaultProxyScorer implements RITA's proxy beacon scoring algorithm
+	defaultProxyScorer struct {
+		autocorrelation bool          // blend in the autocorrelation score
+		drift           bool          // score the delta times around their trend if it fits better
+		tsUnits         int64         // number of timestamp units per second
+		rounding        scoreRounding // rounds the timestamp score and overall score
+		skewLower       float64       // lower quantile of the delta times compared by the skew, the first quartile if 0
+		skewUpper       float64       // upper quantile of the delta times compared by the skew, the third quartile if 0
+	}
+
+	//scoreRounding rounds scores to a number of decimal places
+	scoreRounding struct {
+		halfEven  bool // round to the nearest value with halfway values going to the even neighbor
+		precision int  // number of decimal places
+	}
+)
+
+//newScoreRounding reads the score rounding settings from the config, which are validated
+//when the config is loaded. Scores are rounded up unless "round" is configured.
+func newScoreRounding(conf *config.Config) scoreRounding {
+	return scoreRounding{
+		halfEven:  conf.S.BeaconProxy.ScoreRounding == "round",
+		precision: conf.S.BeaconProxy.ScorePrecision,
+	}
+}
+
+//round rounds the score to the configured number of decimal places
+func (r scoreRounding) round(score float64) float64 {
+	scale := math.Pow10(r.precision)
+
+	if r.halfEven {
+		return math.RoundToEven(score*scale) / scale
+	}
+	return math.Ceil(score*scale) / scale
+}
+
+//NewDefaultProxyScorer creates the ProxyScorer used by RITA unless an alternative is provided
+func NewDefaultProxyScorer(conf *config.Config) ProxyScorer {
+	return &defaultProxyScorer{
+		autocorrelation: conf.S.BeaconProxy.AutocorrelationEnabled,
+		drift:           conf.S.BeaconProxy.DriftEnabled,
+		tsUnits:         util.TimestampUnitsPerSecond(conf.S.BeaconProxy.TimestampPrecision),
+		rounding:        newScoreRounding(conf),
+		skewLower:       conf.S.BeaconProxy.SkewQuantiles.Lower,
+		skewUpper:       conf.S.BeaconProxy.SkewQuantiles.Upper,
+	}
+}
+
+//skewQuantiles returns the quantiles of the delta times compared around the median by
+//the Bowley skew
+func (s *defaultProxyScorer) skewQuantiles() (lower float64, upper float64) {
+	if s.skewLower == 0 && s.skewUpper == 0 {
+		return .25, .75
+	}
+	return s.skewLower, s.skewUpper
+}
+
+//Score blends the skew, dispersion, and connection count of the delta times
+func (s *defaultProxyScorer) Score(diff []int64, connCount int, tsMin, tsMax int64) ProxyScore {
+	tsLength := len(diff)
+
+	//the autocorrelation score relies on the chronological order of the
+	//delta times, so it must be computed before diff is sorted
+	var autocorrScore *float64
+	if s.autocorrelation {
+		tsAutocorrScore := tsAutocorrelationScore(diff)
+		autocorrScore = &tsAutocorrScore
+	}
+
+	//the trend of the delta times is fit in chronological order as well
+	var drift *driftFit
+	if s.drift {
+		tsDrift := tsDriftFit(diff)
+		drift = &tsDrift
+	}
+
+	//the quantiles are selected without sorting the delta times since strobes
+	//may hold hundreds of thousands of them
+	lower, upper := s.skewQuantiles()
+	tsLow, tsMid, tsHigh := quantiles(diff, lower, upper)
+
+	//perfect beacons should have very low dispersion around the
+	//median of their delta times
+	//Median Absolute Deviation About the Median
+	//is used to check dispersion
+	//the deviations overwrite the delta times, which aren't needed anymore
+	//the median may fall halfway between two delta times, so the deviations
+	//are doubled to keep them whole and halved once their median is found
+	tsMid2 := int64(2 * tsMid)
+	devs := diff
+	for i := 0; i < tsLength; i++ {
+		devs[i] = util.Abs(2*diff[i] - tsMid2)
+	}
+
+	tsMadm := median(devs) / 2
+
+	return s.scoreQuantiles(tsLow, tsMid, tsHigh, tsMadm, autocorrScore, drift, connCount, tsMin, tsMax)
+}
+
+//scoreQuantiles blends the score from the skew quantiles and median of the delta times,
+//their median absolute deviation about the median, and the autocorrelation score and
+//drift if they were computed
+func (s *defaultProxyScorer) scoreQuantiles(tsLow, tsMid, tsHigh, tsMadm float64, autocorrScore *float64,
+	drift *driftFit, connCount int, tsMin, tsMax int64) ProxyScore {
+
+	score := ProxyScore{AutocorrScore: autocorrScore}
+
+	//perfect beacons should have symmetric delta time and size distributions
+	//Bowley's measure of skew is used to check symmetry
+	//the quantiles are interpolated rather than picked from the nearest index,
+	//so symmetric delta times with an even count no longer read as skewed
+	//towards whichever middle value the index rounded to
+	tsSkew := float64(0)
+	tsBowleyNum := tsLow + tsHigh - 2*tsMid
+	tsBowleyDen := tsHigh - tsLow
+
+	//a uniform distribution of delta times (Q1 = Q3) is perfectly symmetric and
+	//the most suspicious case, so it is explicitly left with a skew of zero which
+	//results in the max skew score
+	//otherwise, tsSkew should equal zero if the denominator equals zero
+	//bowley skew is unreliable if Q2 = Q1 or Q2 = Q3
+	if tsLow == tsHigh {
+		tsSkew = 0
+	} else if tsBowleyDen != 0 && tsMid != tsLow && tsMid != tsHigh {
+		tsSkew = tsBowleyNum / tsBowleyDen
+	}
+
+	//more skewed distributions receive a lower score
+	//less skewed distributions receive a higher score
+	tsSkewScore := 1.0 - math.Abs(tsSkew) //smush tsSkew
+
+	//lower dispersion is better, cutoff dispersion scores at 30 seconds
+	//no dispersion at all receives the max dispersion score
+	//the timestamps may be recorded with sub-second precision, so the
+	//cutoff is converted to the same units
+	tsMadmScore := s.dispersionScore(tsMadm)
+
+	// connection count scoring
+	//the score is capped, so a burst of connections would receive the max score.
+	//Such bursts may be flagged as strobes before scoring with BeaconProxy.StrobeRate.
+	//a dataset spanning a single instant leaves no room to compare against,
+	//so any connections made in it receive the max score
+	tsConnDiv := (float64(tsMax) - float64(tsMin)) / 10.0
+	tsConnCountScore := 1.0
+	if tsConnDiv > 0 {
+		tsConnCountScore = math.Min(float64(connCount)/tsConnDiv, 1.0)
+	}
+
+	//beacons which drift steadily, such as those backing off over time, are skewed
+	//and dispersed around the median, so the dispersion around their trend stands in
+	//for both when it scores better
+	regularSum := tsSkewScore + tsMadmScore
+	if drift != nil {
+		driftScore := s.dispersionScore(drift.residualMadm)
+		slope := drift.slope
+		score.DriftSlope = &slope
+		score.DriftScore = &driftScore
+		if 2*driftScore > regularSum {
+			regularSum = 2 * driftScore
+		}
+	}
+
+	//score numerators
+	tsSum := regularSum + tsConnCountScore
+	tsParts := 3.0
+
+	//blend in the autocorrelation score if enabled
+	if score.AutocorrScore != nil {
+		tsSum += *score.AutocorrScore
+		tsParts++
+	}
+
+	score.Skew = tsSkew
+	score.Dispersion = util.Round(tsMadm)
+	score.SkewScore = tsSkewScore
+	score.DispersionScore = tsMadmScore
+	score.ConnsScore = tsConnCountScore
+
+	//score averages
+	score.TsScore = s.rounding.round(tsSum / tsParts)
+	score.Score = s.rounding.round(tsSum / tsParts)
+
+	return score
+}
+
+//dispersionScore scores the median absolute deviation of the delta times. Lower
+//dispersion is better, and the scores are cut off at 30 seconds.
+func (s *defaultProxyScorer) dispersionScore(madm float64) float64 {
+	if madm <= 0 {
+		return 1.0
+	}
+	return math.Max(1.0-madm/(30.0*float64(s.tsUnits)), 0)
+}
+
+//durationRegularity scores how consistent the durations of a proxy beacon's
+//connections are using the same skew and dispersion measures as the delta times.
+//Missing (zero) durations are skipped, and ok is false if fewer than 3 durations
+//remain. The dispersion is measured relative to the median duration.
+func durationRegularity(durs []float64, rounding scoreRounding) (skew float64, madm float64, score float64, ok bool) {
+	valid := make([]float64, 0, len(durs))
+	for _, dur := range durs {
+		if dur > 0 {
+			valid = append(valid, dur)
+		}
+	}
+
+	durLength := len(valid)
+	if durLength < 3 {
+		return 0, 0, 0, false
+	}
+
+	sort.Float64s(valid)
+
+	durLow := sortedQuantile(valid, .25)
+	durMid := sortedQuantile(valid, .5)
+	durHigh := sortedQuantile(valid, .75)
+	durBowleyNum := durLow + durHigh - 2*durMid
+	durBowleyDen := durHigh - durLow
+
+	//bowley skew is unreliable if Q2 = Q1 or Q2 = Q3
+	if durBowleyDen != 0 && durMid != durLow && durMid != durHigh {
+		skew = durBowleyNum / durBowleyDen
+	}
+
+	devs := make([]float64, durLength)
+	for i := 0; i < durLength; i++ {
+		devs[i] = math.Abs(valid[i] - durMid)
+	}
+
+	sort.Float64s(devs)
+
+	madm = sortedQuantile(devs, .5)
+
+	//more skewed distributions receive a lower score
+	durSkewScore := 1.0 - math.Abs(skew)
+
+	//durations vary widely in scale, so dispersion is scored relative to the median
+	durMadmScore := 1.0 - madm/durMid
+	if durMadmScore < 0 {
+		durMadmScore = 0
+	}
+
+	score = rounding.round((durSkewScore + durMadmScore) / 2.0)
+
+	return skew, madm, score, true
+}
+
+//autocorrMaxBins caps the length of the event signal built by tsAutocorrelationScore
+//in order to bound the cost of the autocorrelation for long running connections
+const autocorrMaxBins = 2048
+
+//tsAutocorrelationScore rebuilds the connection times from the chronological
+//(unsorted) delta times, bins them into an event count signal, and returns the
+//highest autocorrelation found at a non-zero lag. Periodic connections produce
+//a strong peak at the lag of their period, even when some check-ins are
+//missing, which skew and dispersion tend to penalize. The score is in [0, 1].
+func tsAutocorrelationScore(diff []int64) float64 {
+	if len(diff) < 2 {
+		return 0
+	}
+
+	var total int64
+	for _, d := range diff {
+		total += d
+	}
+
+	//all of the connections happened at the same time
+	if total <= 0 {
+		return 0
+	}
+
+	signal, binWidth := newAutocorrSignal(total)
+
+	var ts int64
+	signal[0]++
+	for _, d := range diff {
+		ts += d
+		signal[ts/binWidth]++
+	}
+
+	return signalAutocorrelation(signal, len(diff)+1)
+}
+
+//newAutocorrSignal creates the empty event count signal for connections spanning total
+//timestamp units. The bins are widened if the signal would be too long to analyze.
+func newAutocorrSignal(total int64) ([]float64, int64) {
+	binWidth := (total + autocorrMaxBins) / autocorrMaxBins
+	return make([]float64, total/binWidth+1), binWidth
+}
+
+//signalAutocorrelation returns the highest autocorrelation of the event count signal
+//holding the given number of events at a non-zero lag
+func signalAutocorrelation(signal []float64, events int) float64 {
+	//center the signal around its mean
+	mean := float64(events) / float64(len(signal))
+	variance := 0.0
+	for i := range signal {
+		signal[i] -= mean
+		variance += signal[i] * signal[i]
+	}
+	variance /= float64(len(signal))
+
+	if variance == 0 {
+		return 0
+	}
+
+	//only consider lags which overlap at least half of the signal, the estimates
+	//for longer lags are based on too few samples to be trusted
+	best := 0.0
+	for lag := 1; lag <= len(signal)/2; lag++ {
+		sum := 0.0
+		for i := 0; i+lag < len(signal); i++ {
+			sum += signal[i] * signal[i+lag]
+		}
+
+		corr := sum / float64(len(signal)-lag) / variance
+		if corr > best {
+			best = corr
+		}
+	}
+
+	if best > 1 {
+		best = 1
+	}
+
+	return best
+}
+
+//driftFit describes the least squares line fit to the chronological delta times
+type driftFit struct {
+	slope        float64 // change of the delta times per connection
+	residualMadm float64 // median absolute deviation of the delta times from the line
+}
+
+//driftLine fits a least squares line to a series of delta times as they are added,
+//indexing them by their position in the series. The means and co-moments are updated
+//incrementally to avoid the loss of precision of summing squares over long series.
+type driftLine struct {
+	n     float64
+	meanX float64
+	meanY float64
+	coXY  float64
+	coXX  float64
+}
+
+//add appends the next delta time to the series
+func (l *driftLine) add(d int64) {
+	x := l.n
+	y := float64(d)
+	l.n++
+	dx := x - l.meanX
+	l.meanX += dx / l.n
+	l.meanY += (y - l.meanY) / l.n
+	l.coXY += dx * (y - l.meanY)
+	l.coXX += dx * (x - l.meanX)
+}
+
+//slope returns the slope of the line, which is flat if fewer than 2 delta times were added
+func (l *driftLine) slope() float64 {
+	if l.coXX == 0 {
+		return 0
+	}
+	return l.coXY / l.coXX
+}
+
+//doubledResidual returns the absolute deviation of the delta time at index i from the
+//line. As with the dispersion, the deviation is doubled and rounded to keep it whole.
+func (l *driftLine) doubledResidual(i int, d int64) int64 {
+	fit := l.meanY + l.slope()*(float64(i)-l.meanX)
+	return util.Abs(int64(math.Round(2 * (float64(d) - fit))))
+}
+
+//tsDriftFit fits a line to the chronological (unsorted) delta times. Beacons whose
+//interval grows or shrinks steadily stay close to the line even though their delta
+//times are spread far from the median.
+func tsDriftFit(diff []int64) driftFit {
+	var line driftLine
+	for _, d := range diff {
+		line.add(d)
+	}
+
+	devs := make([]int64, len(diff))
+	for i, d := range diff {
+		devs[i] = line.doubledResidual(i, d)
+	}
+
+	return driftFit{slope: line.slope(), residualMadm: median(devs) / 2}
+}
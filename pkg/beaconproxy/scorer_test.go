@@ -0,0 +1,150 @@
+package beaconproxy
+
+import (
+	"math"
+	"testing"
+
+	"github.com/activecm/rita/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTsAutocorrelationScore(t *testing.T) {
+	// build the delta times of a 60 second beacon which misses every 7th check-in
+	var diff []int64
+	for i := 1; i < 200; i++ {
+		if i%7 == 0 {
+			diff[len(diff)-1] += 60
+			continue
+		}
+		diff = append(diff, 60)
+	}
+	score := tsAutocorrelationScore(diff)
+	require.True(t, score > 0.8, "score: %f", score)
+
+	// a perfect beacon scores the max
+	require.InDelta(t, 1.0, tsAutocorrelationScore([]int64{60, 60, 60, 60, 60, 60, 60, 60}), 0.001)
+
+	// connections without a dominant period score low
+	noise := []int64{3, 97, 41, 12, 250, 8, 61, 170, 29, 5, 133, 77, 19, 301, 44, 2, 88, 156}
+	score = tsAutocorrelationScore(noise)
+	require.True(t, score < 0.5, "score: %f", score)
+
+	// degenerate inputs
+	require.Equal(t, 0.0, tsAutocorrelationScore(nil))
+	require.Equal(t, 0.0, tsAutocorrelationScore([]int64{60}))
+	require.Equal(t, 0.0, tsAutocorrelationScore([]int64{0, 0, 0}))
+}
+
+func TestScoreDrift(t *testing.T) {
+	conf := testConfig()
+	conf.S.BeaconProxy.DriftEnabled = true
+	driftScorer := NewDefaultProxyScorer(conf)
+	regularScorer := NewDefaultProxyScorer(testConfig())
+
+	// a beacon which sleeps 5 seconds longer after each check-in
+	linear := func() []int64 {
+		diff := make([]int64, 100)
+		for i := range diff {
+			diff[i] = 60 + 5*int64(i)
+		}
+		return diff
+	}
+
+	regular := regularScorer.Score(linear(), 101, 0, 1000)
+	require.Nil(t, regular.DriftSlope)
+	require.Nil(t, regular.DriftScore)
+	require.True(t, regular.Score < 0.7, "score: %f", regular.Score)
+
+	drift := driftScorer.Score(linear(), 101, 0, 1000)
+	require.InDelta(t, 5.0, *drift.DriftSlope, 1e-9)
+	require.Equal(t, 1.0, *drift.DriftScore)
+	require.Equal(t, 1.0, drift.Score)
+
+	// the drift doesn't lower the score of a steady beacon
+	steady := []int64{60, 61, 59, 60, 60, 62, 58, 60, 60, 61}
+	require.Equal(t,
+		regularScorer.Score(append([]int64(nil), steady...), 11, 0, 100).Score,
+		driftScorer.Score(append([]int64(nil), steady...), 11, 0, 100).Score,
+	)
+
+	// intervals scattered around the trend still score poorly
+	noise := []int64{3, 97, 41, 12, 250, 8, 61, 170, 29, 5, 133, 77, 19, 301, 44, 2, 88, 156}
+	noisy := driftScorer.Score(noise, 19, 0, 1000000)
+	require.True(t, *noisy.DriftScore < 0.1, "drift score: %f", *noisy.DriftScore)
+	require.True(t, noisy.Score < 0.5, "score: %f", noisy.Score)
+}
+
+//testRounding rounds scores up to 3 decimal places, as configured by default
+var testRounding = scoreRounding{precision: 3}
+
+//testConfig creates an otherwise empty config holding the default score rounding
+func testConfig() *config.Config {
+	conf := &config.Config{}
+	conf.S.BeaconProxy.ScoreRounding = "ceil"
+	conf.S.BeaconProxy.ScorePrecision = testRounding.precision
+	return conf
+}
+
+func TestDurationRegularity(t *testing.T) {
+	// consistent durations score highly
+	consistent := []float64{2.0, 2.1, 1.9, 2.0, 2.05, 1.95, 2.0, 2.0}
+	_, _, consistentScore, ok := durationRegularity(consistent, testRounding)
+	require.True(t, ok)
+	require.True(t, consistentScore > 0.9, "score: %f", consistentScore)
+
+	// erratic durations score poorly
+	erratic := []float64{0.1, 35.2, 2.0, 120.5, 0.7, 14.3, 60.0, 5.5}
+	_, _, erraticScore, ok := durationRegularity(erratic, testRounding)
+	require.True(t, ok)
+	require.True(t, erraticScore < consistentScore, "score: %f", erraticScore)
+	require.True(t, erraticScore < 0.5, "score: %f", erraticScore)
+
+	// zero durations are treated as missing rather than scored
+	withMissing := append([]float64{0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, consistent...)
+	_, _, missingScore, ok := durationRegularity(withMissing, testRounding)
+	require.True(t, ok)
+	require.Equal(t, consistentScore, missingScore)
+
+	// too few durations are not scored
+	_, _, _, ok = durationRegularity([]float64{0, 2.0, 0, 2.0}, testRounding)
+	require.False(t, ok)
+	_, _, _, ok = durationRegularity(nil, testRounding)
+	require.False(t, ok)
+}
+
+func TestScoreEqualMinMax(t *testing.T) {
+	scorer := NewDefaultProxyScorer(testConfig())
+
+	// every connection of the dataset was made at the same instant
+	score := scorer.Score([]int64{0, 0, 0, 0}, 5, 1517336042, 1517336042)
+	require.Equal(t, 1.0, score.ConnsScore)
+	require.False(t, math.IsNaN(score.Score) || math.IsInf(score.Score, 0))
+	require.Equal(t, 1.0, score.Score)
+}
+
+func TestScoreRounding(t *testing.T) {
+	conf, err := config.LoadTestingConfig("")
+	require.Nil(t, err)
+
+	// scores are rounded up to 3 decimal places by default
+	rounding := newScoreRounding(conf)
+	require.Equal(t, testRounding, rounding)
+	require.Equal(t, 0.751, rounding.round(0.7501))
+	require.Equal(t, 0.063, rounding.round(0.0625))
+
+	// halfway values are rounded to the even neighbor rather than up
+	conf.S.BeaconProxy.ScoreRounding = "round"
+	rounding = newScoreRounding(conf)
+	require.Equal(t, 0.75, rounding.round(0.7501))
+	require.Equal(t, 0.062, rounding.round(0.0625))
+	require.Equal(t, 0.188, rounding.round(0.1875))
+
+	conf.S.BeaconProxy.ScorePrecision = 5
+	require.Equal(t, 0.12346, newScoreRounding(conf).round(0.123456))
+
+	// the timestamp score and overall score are rounded alike
+	conf.S.BeaconProxy.ScorePrecision = 1
+	score := NewDefaultProxyScorer(conf).Score([]int64{58, 60, 62, 120}, 4, 0, 2000)
+	require.Equal(t, score.TsScore, score.Score)
+	require.Equal(t, math.Round(score.Score*10)/10, score.Score)
+}
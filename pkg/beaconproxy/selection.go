@@ -0,0 +1,99 @@
+package beaconproxy
+
+import "math"
+
+//quantile returns the pth quantile (0 <= p <= 1) of data. If p*(len(data)-1) falls
+//between two indexes of the sorted data, the quantile is linearly interpolated between
+//the values at those indexes, so the median of an even number of values is the mean of
+//the two middle values. data is partially reordered rather than fully sorted, which
+//takes linear rather than O(n log n) time. data must not be empty.
+func quantile(data []int64, p float64) float64 {
+	pos := p * float64(len(data)-1)
+	idx := int(math.Floor(pos))
+	lower := selectNth(data, idx)
+
+	frac := pos - float64(idx)
+	if frac == 0 {
+		return float64(lower)
+	}
+
+	//every value right of idx is at least as large as data[idx], so the smallest
+	//of them is the value at the next index of the sorted data
+	upper := minInt64(data[idx+1:])
+	return float64(lower) + frac*float64(upper-lower)
+}
+
+//quantiles returns the lower quantile, median, and upper quantile of data. data is
+//partially reordered. data must not be empty.
+func quantiles(data []int64, lower float64, upper float64) (low float64, mid float64, high float64) {
+	return quantile(data, lower), quantile(data, .5), quantile(data, upper)
+}
+
+//median returns the 50th percentile of data, which is the mean of the two middle
+//values if data holds an even number of values. data is partially reordered. data
+//must not be empty.
+func median(data []int64) float64 {
+	return quantile(data, .5)
+}
+
+//sortedQuantile is the equivalent of quantile for sorted float data
+func sortedQuantile(sorted []float64, p float64) float64 {
+	pos := p * float64(len(sorted)-1)
+	idx := int(math.Floor(pos))
+
+	frac := pos - float64(idx)
+	if frac == 0 {
+		return sorted[idx]
+	}
+	return sorted[idx] + frac*(sorted[idx+1]-sorted[idx])
+}
+
+//selectNth reorders data such that data[n] holds the value it would hold if data were
+//sorted, every value in data[:n] is less than or equal to it, and every value in data[n+1:]
+//is greater than or equal to it. Returns data[n]. The delta times of beacons often repeat
+//the same few values, so a three way partition is used to keep runs of equal values from
+//degrading the selection to quadratic time.
+func selectNth(data []int64, n int) int64 {
+	lo, hi := 0, len(data)-1
+	for lo < hi {
+		pivot := medianOfThree(data[lo], data[lo+(hi-lo)/2], data[hi])
+
+		//partition data[lo:hi+1] into values less than, equal to, and greater than the pivot
+		lt, i, gt := lo, lo, hi
+		for i <= gt {
+			if data[i] < pivot {
+				data[lt], data[i] = data[i], data[lt]
+				lt++
+				i++
+			} else if data[i] > pivot {
+				data[i], data[gt] = data[gt], data[i]
+				gt--
+			} else {
+				i++
+			}
+		}
+
+		if n < lt {
+			hi = lt - 1
+		} else if n > gt {
+			lo = gt + 1
+		} else {
+			return data[n]
+		}
+	}
+	return data[n]
+}
+
+//medianOfThree returns the middle value of a, b, and c
+func medianOfThree(a int64, b int64, c int64) int64 {
+	if a > b {
+		a, b = b, a
+	}
+	if b > c {
+		b = c
+	}
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,270 @@
+package beaconproxy
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/activecm/rita/config"
+	"github.com/activecm/rita/util"
+	"github.com/stretchr/testify/require"
+)
+
+//sortedDispersion computes the quartiles and the median absolute deviation about the
+//median by sorting the data
+func sortedDispersion(data []int64) (low float64, mid float64, high float64, madm float64) {
+	sorted := make([]float64, len(data))
+	for i := range data {
+		sorted[i] = float64(data[i])
+	}
+	sort.Float64s(sorted)
+
+	low = sortedQuantile(sorted, .25)
+	mid = sortedQuantile(sorted, .5)
+	high = sortedQuantile(sorted, .75)
+
+	devs := make([]float64, len(sorted))
+	for i := range sorted {
+		devs[i] = math.Abs(sorted[i] - mid)
+	}
+	sort.Float64s(devs)
+	madm = sortedQuantile(devs, .5)
+	return low, mid, high, madm
+}
+
+//selectedDispersion computes the same values as sortedDispersion through selection,
+//doubling the deviations the same way the scorer does
+func selectedDispersion(data []int64) (low float64, mid float64, high float64, madm float64) {
+	selected := append([]int64{}, data...)
+	low, mid, high = quantiles(selected, .25, .75)
+
+	devs := make([]int64, len(selected))
+	for i := range selected {
+		devs[i] = util.Abs(2*selected[i] - int64(2*mid))
+	}
+	madm = median(devs) / 2
+	return low, mid, high, madm
+}
+
+//testDeltaTimes generates delta times around a period with the given jitter
+func testDeltaTimes(rng *rand.Rand, length int, period int64, jitter int64) []int64 {
+	diff := make([]int64, length)
+	for i := range diff {
+		diff[i] = period
+		if jitter > 0 {
+			diff[i] += rng.Int63n(2*jitter+1) - jitter
+		}
+	}
+	return diff
+}
+
+func TestSelectionMatchesSort(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	inputs := [][]int64{
+		{60, 60, 60},
+		{1, 2, 3},
+		{3, 2, 1},
+		{5, 1, 5, 1, 5},
+		{0, 0, 1000000, 0},
+	}
+	for length := 3; length < 200; length++ {
+		inputs = append(inputs,
+			testDeltaTimes(rng, length, 60, 0),
+			testDeltaTimes(rng, length, 60, 2),
+			testDeltaTimes(rng, length, 3600, 1800),
+		)
+	}
+	inputs = append(inputs, testDeltaTimes(rng, 100000, 60, 5), testDeltaTimes(rng, 100001, 1, 1000000))
+
+	for _, input := range inputs {
+		low, mid, high, madm := sortedDispersion(input)
+		selLow, selMid, selHigh, selMadm := selectedDispersion(input)
+		require.Equal(t, []float64{low, mid, high, madm}, []float64{selLow, selMid, selHigh, selMadm}, "%v", input)
+	}
+}
+
+func TestMedian(t *testing.T) {
+	tests := []struct {
+		data   []int64
+		median float64
+		madm   float64
+	}{
+		// the deviations about 15 are 5, 5
+		{[]int64{20, 10}, 15, 5},
+		// the deviations about 60 are 0, 1, 3
+		{[]int64{63, 59, 60}, 60, 1},
+		// the deviations about 60.5 are 0.5, 0.5, 1.5, 2.5
+		{[]int64{60, 62, 58, 61}, 60.5, 1},
+		// the deviations about 60 are 0, 0, 1, 5, 30
+		{[]int64{60, 65, 30, 61, 60}, 60, 1},
+		// the deviations about 62.5 are 2.5, 2.5, 3.5, 7.5, 57.5, 87.5
+		{[]int64{60, 150, 65, 5, 70, 59}, 62.5, 5.5},
+		// the deviations about 60.5 are 0.5, 0.5, 0.5, 0.5, 0.5, 0.5
+		{[]int64{60, 61, 60, 61, 60, 61}, 60.5, 0.5},
+	}
+
+	for _, test := range tests {
+		_, mid, _, madm := selectedDispersion(test.data)
+		require.Equal(t, test.median, mid, "%v", test.data)
+		require.Equal(t, test.madm, madm, "%v", test.data)
+
+		// the median of the sorted data agrees with the median of the reordered data
+		_, sortedMid, _, sortedMadm := sortedDispersion(test.data)
+		require.Equal(t, test.median, sortedMid, "%v", test.data)
+		require.Equal(t, test.madm, sortedMadm, "%v", test.data)
+	}
+}
+
+func TestQuartiles(t *testing.T) {
+	// the quartiles of 10, 20, 30, 40 fall at the indexes 0.75, 1.5, and 2.25
+	low, mid, high := quantiles([]int64{40, 10, 30, 20}, .25, .75)
+	require.Equal(t, []float64{17.5, 25, 32.5}, []float64{low, mid, high})
+
+	// symmetric delta times aren't skewed towards either middle value
+	scorer := &defaultProxyScorer{tsUnits: 1, rounding: testRounding}
+	score := scorer.Score([]int64{59, 61, 59, 61}, 5, 0, 240)
+	require.Zero(t, score.Skew)
+	require.Equal(t, int64(1), score.Dispersion)
+}
+
+func TestSkewQuantiles(t *testing.T) {
+	// sorted: 50, 55, 58, 60, 60, 61, 62, 65, 70, 100
+	diff := []int64{60, 100, 55, 62, 50, 61, 70, 58, 65, 60}
+
+	// the quartiles fall at the indexes 2.25, 4.5, and 6.75
+	// Q1 = 58.5, Q2 = 60.5, Q3 = 64.25
+	// skew = (58.5 + 64.25 - 2*60.5) / (64.25 - 58.5) = 1.75 / 5.75
+	scorer := &defaultProxyScorer{tsUnits: 1, rounding: testRounding}
+	score := scorer.Score(append([]int64(nil), diff...), 11, 0, 1000)
+	require.InDelta(t, 1.75/5.75, score.Skew, 1e-12)
+
+	// the 10th and 90th percentiles fall at the indexes 0.9 and 8.1
+	// P10 = 54.5, P90 = 73
+	// skew = (54.5 + 73 - 2*60.5) / (73 - 54.5) = 6.5 / 18.5
+	scorer = &defaultProxyScorer{tsUnits: 1, rounding: testRounding, skewLower: .1, skewUpper: .9}
+	score = scorer.Score(append([]int64(nil), diff...), 11, 0, 1000)
+	require.InDelta(t, 6.5/18.5, score.Skew, 1e-12)
+	require.InDelta(t, 1-6.5/18.5, score.SkewScore, 1e-12)
+
+	// the quantiles are read from the config
+	conf := testConfig()
+	conf.S.BeaconProxy.SkewQuantiles = config.SkewQuantilesStaticCfg{Lower: .1, Upper: .9}
+	require.Equal(t, score, NewDefaultProxyScorer(conf).Score(append([]int64(nil), diff...), 11, 0, 1000))
+}
+
+func TestSelectNth(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	data := testDeltaTimes(rng, 1000, 500, 50)
+	sorted := append([]int64{}, data...)
+	sort.Sort(util.SortableInt64(sorted))
+
+	for _, n := range []int{0, 1, 250, 500, 998, 999} {
+		selected := append([]int64{}, data...)
+		require.Equal(t, sorted[n], selectNth(selected, n))
+
+		// the values are partitioned around the selected value
+		for i := range selected {
+			if i < n {
+				require.LessOrEqual(t, selected[i], selected[n])
+			} else if i > n {
+				require.GreaterOrEqual(t, selected[i], selected[n])
+			}
+		}
+	}
+}
+
+func TestCreateCountMapUnsorted(t *testing.T) {
+	intervals, counts, mode, modeCount := createCountMap([]int64{60, 5, 61, 60, 5, 59, 61})
+	require.Equal(t, []int64{5, 59, 60, 61}, intervals)
+	require.Equal(t, []int64{2, 1, 2, 2}, counts)
+
+	// ties are won by the smallest interval
+	require.Equal(t, int64(5), mode)
+	require.Equal(t, int64(2), modeCount)
+
+	require.Equal(t, int64(56), maxInt64([]int64{60, 5, 61})-minInt64([]int64{60, 5, 61}))
+}
+
+//mapCountMap is the reference implementation of createCountMap which counts the
+//delta times in a map and looks up the count of each sorted distinct delta time
+func mapCountMap(data []int64) ([]int64, []int64, int64, int64) {
+	countsMap := make(map[int64]int64)
+	for _, datum := range data {
+		countsMap[datum]++
+	}
+
+	distinct := make([]int64, 0, len(countsMap))
+	for datum := range countsMap {
+		distinct = append(distinct, datum)
+	}
+	sort.Sort(util.SortableInt64(distinct))
+
+	countsArr := make([]int64, len(distinct))
+	mode := distinct[0]
+	max := countsMap[mode]
+	for i, datum := range distinct {
+		countsArr[i] = countsMap[datum]
+		if countsArr[i] > max {
+			max = countsArr[i]
+			mode = datum
+		}
+	}
+	return distinct, countsArr, mode, max
+}
+
+func TestCreateCountMapMatchesMap(t *testing.T) {
+	rng := rand.New(rand.NewSource(4))
+	for _, data := range [][]int64{
+		{5, 5, 5},
+		{3, 3, 1, 3, 2, 1, 1},
+		testDeltaTimes(rng, 1000, 60, 5),
+		testDeltaTimes(rng, 1000, 3600, 600),
+	} {
+		distinct, counts, mode, modeCount := createCountMap(data)
+		expectedDistinct, expectedCounts, expectedMode, expectedModeCount := mapCountMap(data)
+		require.Equal(t, expectedDistinct, distinct)
+		require.Equal(t, expectedCounts, counts)
+		require.Equal(t, expectedMode, mode)
+		require.Equal(t, expectedModeCount, modeCount)
+	}
+}
+
+//BenchmarkCreateCountMap compares counting the delta times alongside the distinct
+//delta times against looking up the count of each distinct delta time in a map
+func BenchmarkCreateCountMap(b *testing.B) {
+	diff := testDeltaTimes(rand.New(rand.NewSource(5)), 10000, 60, 5)
+
+	b.Run("aligned", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			createCountMap(diff)
+		}
+	})
+
+	b.Run("map", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			mapCountMap(diff)
+		}
+	})
+}
+
+//BenchmarkDispersion compares sorting the delta times of a strobe sized beacon
+//against selecting the quartiles and the median absolute deviation
+func BenchmarkDispersion(b *testing.B) {
+	diff := testDeltaTimes(rand.New(rand.NewSource(3)), 500000, 60, 30)
+
+	b.Run("sort", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			sortedDispersion(diff)
+		}
+	})
+
+	b.Run("select", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			selectedDispersion(diff)
+		}
+	})
+}
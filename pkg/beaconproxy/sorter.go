@@ -51,6 +51,7 @@ func (s *sorter) start() {
 
 		for entry := range s.sortChannel {
 
+			// spilled timestamps were already sorted on disk by the dissector
 			if (entry.TsList) != nil {
 				//sort the size and timestamps to compute quantiles in the analyzer
 				sort.Sort(util.SortableInt64(entry.TsList))
@@ -0,0 +1,309 @@
+package beaconproxy
+
+import (
+	"math"
+
+	"github.com/activecm/rita/pkg/spill"
+	"github.com/activecm/rita/pkg/uconnproxy"
+	"github.com/globalsign/mgo/bson"
+)
+
+//spilledBeaconQuery scores the timestamps of an entry which were spilled to disk by the
+//dissector. The delta times are sorted on disk and streamed back to compute the same
+//statistics as beaconQuery without holding them in memory. Alternative scorers receive
+//the delta times in memory since they may require random access to them.
+func (a *analyzer) spilledBeaconQuery(entry *uconnproxy.Input) (bson.M, float64, error) {
+	diffs, err := spilledDeltaTimes(entry.TsSpill, a.conf.S.BeaconProxy.SpillDir, a.conf.S.BeaconProxy.SpillThreshold)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer diffs.Close()
+
+	//Store the range for human analysis
+	stats := tsStats{}
+	first, err := diffs.At(0)
+	if err != nil {
+		return nil, 0, err
+	}
+	last, err := diffs.At(diffs.Len() - 1)
+	if err != nil {
+		return nil, 0, err
+	}
+	stats.tsRange = last - first
+
+	stats.intervals, stats.intervalCounts, stats.mode, stats.modeCount, err = spilledCountMap(diffs)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var proxyScore ProxyScore
+	if scorer, ok := a.scorer.(*defaultProxyScorer); ok {
+		proxyScore, err = scorer.scoreSpilled(entry.TsSpill, diffs, a.conf.S.BeaconProxy.SpillDir,
+			a.conf.S.BeaconProxy.SpillThreshold, int(entry.ConnectionCount), a.tsMin, a.tsMax)
+	} else {
+		var diff []int64
+		diff, err = loadDeltaTimes(entry.TsSpill)
+		if err == nil {
+			proxyScore = a.scorer.Score(diff, int(entry.ConnectionCount), a.tsMin, a.tsMax)
+		}
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query, score := a.beaconUpdate(entry, stats, proxyScore)
+	return query, score, nil
+}
+
+//scoreSpilled scores the sorted delta times (diffs) of the spilled timestamps (tsSpill).
+//The deviations from the drift are sorted on disk in dir, runLength at a time.
+func (s *defaultProxyScorer) scoreSpilled(tsSpill *spill.List, diffs *spill.List, dir string, runLength int,
+	connCount int, tsMin, tsMax int64) (ProxyScore, error) {
+	var autocorrScore *float64
+	if s.autocorrelation {
+		tsAutocorrScore, err := spilledAutocorrelationScore(tsSpill)
+		if err != nil {
+			return ProxyScore{}, err
+		}
+		autocorrScore = &tsAutocorrScore
+	}
+
+	var drift *driftFit
+	if s.drift {
+		tsDrift, err := spilledDriftFit(tsSpill, dir, runLength)
+		if err != nil {
+			return ProxyScore{}, err
+		}
+		drift = &tsDrift
+	}
+
+	lower, upper := s.skewQuantiles()
+	tsLow, err := spilledQuantile(diffs, lower)
+	if err != nil {
+		return ProxyScore{}, err
+	}
+	tsMid, err := spilledQuantile(diffs, .5)
+	if err != nil {
+		return ProxyScore{}, err
+	}
+	tsHigh, err := spilledQuantile(diffs, upper)
+	if err != nil {
+		return ProxyScore{}, err
+	}
+
+	tsMadm, err := spilledMadm(diffs, tsMid)
+	if err != nil {
+		return ProxyScore{}, err
+	}
+
+	return s.scoreQuantiles(tsLow, tsMid, tsHigh, tsMadm, autocorrScore, drift, connCount, tsMin, tsMax), nil
+}
+
+//spilledDeltaTimes streams the delta times between the sorted timestamps into a sorted
+//list on disk, holding at most runLength of them in memory at once
+func spilledDeltaTimes(tsSpill *spill.List, dir string, runLength int) (*spill.List, error) {
+	sorter := spill.NewSorter(dir, runLength, false)
+	defer sorter.Close()
+
+	iter := tsSpill.Iter(0)
+	prev, _ := iter.Next()
+	for ts, ok := iter.Next(); ok; ts, ok = iter.Next() {
+		if err := sorter.Add(ts - prev); err != nil {
+			return nil, err
+		}
+		prev = ts
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+
+	return sorter.Finish()
+}
+
+//loadDeltaTimes reads the delta times between the spilled timestamps into memory in
+//chronological order
+func loadDeltaTimes(tsSpill *spill.List) ([]int64, error) {
+	diff := make([]int64, 0, tsSpill.Len()-1)
+
+	iter := tsSpill.Iter(0)
+	prev, _ := iter.Next()
+	for ts, ok := iter.Next(); ok; ts, ok = iter.Next() {
+		diff = append(diff, ts-prev)
+		prev = ts
+	}
+	return diff, iter.Err()
+}
+
+//spilledCountMap is the equivalent of createCountMap for the sorted delta times on disk.
+//Runs of equal values are counted as they are streamed back.
+func spilledCountMap(diffs *spill.List) ([]int64, []int64, int64, int64, error) {
+	var distinct, countsArr []int64
+	var mode, max int64
+
+	iter := diffs.Iter(0)
+	for datum, ok := iter.Next(); ok; datum, ok = iter.Next() {
+		last := len(distinct) - 1
+		if last >= 0 && distinct[last] == datum {
+			countsArr[last]++
+		} else {
+			distinct = append(distinct, datum)
+			countsArr = append(countsArr, 1)
+			last++
+		}
+
+		// ties for the mode are won by the smallest interval
+		if countsArr[last] > max {
+			max = countsArr[last]
+			mode = datum
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return nil, nil, 0, 0, err
+	}
+	return distinct, countsArr, mode, max, nil
+}
+
+//spilledQuantile is the equivalent of quantile for the sorted delta times on disk
+func spilledQuantile(diffs *spill.List, p float64) (float64, error) {
+	pos := p * float64(diffs.Len()-1)
+	idx := int64(math.Floor(pos))
+	lower, err := diffs.At(idx)
+	if err != nil {
+		return 0, err
+	}
+
+	frac := pos - float64(idx)
+	if frac == 0 {
+		return float64(lower), nil
+	}
+
+	upper, err := diffs.At(idx + 1)
+	if err != nil {
+		return 0, err
+	}
+	return float64(lower) + frac*float64(upper-lower), nil
+}
+
+//spilledMadm returns the median absolute deviation about the median (tsMid) of the
+//sorted delta times on disk. The deviations of the values left of the median grow as
+//the list is read backwards from it, and those of the values right of it grow as the
+//list is read forwards, so the two sorted streams of deviations are merged until the
+//middle deviations are reached. As in Score, the deviations are doubled to keep them
+//whole when the median falls halfway between two delta times.
+func spilledMadm(diffs *spill.List, tsMid float64) (float64, error) {
+	n := diffs.Len()
+	midIdx := (n - 1) / 2
+	tsMid2 := int64(2 * tsMid)
+
+	left := diffs.ReverseIter(midIdx)
+	right := diffs.Iter(midIdx + 1)
+	leftVal, leftOk := left.Next()
+	rightVal, rightOk := right.Next()
+
+	//the median deviation is the mean of the deviations ranked (n-1)/2 and n/2,
+	//which are the same deviation if n is odd
+	var lowDev, dev int64
+	for i := int64(0); i <= n/2; i++ {
+		if leftOk && (!rightOk || tsMid2-2*leftVal <= 2*rightVal-tsMid2) {
+			dev = tsMid2 - 2*leftVal
+			leftVal, leftOk = left.Next()
+		} else {
+			dev = 2*rightVal - tsMid2
+			rightVal, rightOk = right.Next()
+		}
+		if i == (n-1)/2 {
+			lowDev = dev
+		}
+	}
+
+	if err := left.Err(); err != nil {
+		return 0, err
+	}
+	return float64(lowDev+dev) / 4, right.Err()
+}
+
+//spilledAutocorrelationScore is the equivalent of tsAutocorrelationScore for the sorted
+//timestamps on disk
+func spilledAutocorrelationScore(tsSpill *spill.List) (float64, error) {
+	if tsSpill.Len() < 3 {
+		return 0, nil
+	}
+
+	first, err := tsSpill.At(0)
+	if err != nil {
+		return 0, err
+	}
+	last, err := tsSpill.At(tsSpill.Len() - 1)
+	if err != nil {
+		return 0, err
+	}
+
+	//all of the connections happened at the same time
+	total := last - first
+	if total <= 0 {
+		return 0, nil
+	}
+
+	signal, binWidth := newAutocorrSignal(total)
+
+	iter := tsSpill.Iter(0)
+	for ts, ok := iter.Next(); ok; ts, ok = iter.Next() {
+		signal[(ts-first)/binWidth]++
+	}
+	if err := iter.Err(); err != nil {
+		return 0, err
+	}
+
+	return signalAutocorrelation(signal, int(tsSpill.Len())), nil
+}
+
+//spilledDriftFit is the equivalent of tsDriftFit for the sorted timestamps on disk. It fits
+//the trend line while streaming the delta times, then streams the deviations from that line.
+func spilledDriftFit(tsSpill *spill.List, dir string, runLength int) (driftFit, error) {
+	var line driftLine
+	err := spilledDeltaTimesEach(tsSpill, func(i int, d int64) error {
+		line.add(d)
+		return nil
+	})
+	if err != nil {
+		return driftFit{}, err
+	}
+
+	sorter := spill.NewSorter(dir, runLength, false)
+	defer sorter.Close()
+
+	err = spilledDeltaTimesEach(tsSpill, func(i int, d int64) error {
+		return sorter.Add(line.doubledResidual(i, d))
+	})
+	if err != nil {
+		return driftFit{}, err
+	}
+
+	devs, err := sorter.Finish()
+	if err != nil {
+		return driftFit{}, err
+	}
+	defer devs.Close()
+
+	residualMadm, err := spilledQuantile(devs, .5)
+	if err != nil {
+		return driftFit{}, err
+	}
+	return driftFit{slope: line.slope(), residualMadm: residualMadm / 2}, nil
+}
+
+//spilledDeltaTimesEach calls fn with the index and value of each delta time between the
+//spilled timestamps in chronological order
+func spilledDeltaTimesEach(tsSpill *spill.List, fn func(i int, d int64) error) error {
+	iter := tsSpill.Iter(0)
+	prev, _ := iter.Next()
+	i := 0
+	for ts, ok := iter.Next(); ok; ts, ok = iter.Next() {
+		if err := fn(i, ts-prev); err != nil {
+			return err
+		}
+		prev = ts
+		i++
+	}
+	return iter.Err()
+}
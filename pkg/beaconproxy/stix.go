@@ -0,0 +1,214 @@
+package beaconproxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/activecm/rita/resources"
+	"github.com/activecm/rita/util"
+	"github.com/google/uuid"
+)
+
+const (
+	stixSpecVersion = "2.1"
+	//stixTimeFormat is the timestamp format required by STIX 2.1
+	stixTimeFormat = "2006-01-02T15:04:05.000Z"
+)
+
+//stixSCONamespace is the namespace STIX 2.1 uses to generate the deterministic
+//ids of cyber observable objects
+var stixSCONamespace = uuid.MustParse("00abedb4-aa42-57c7-8ab1-1101eb8a7b5e")
+
+//stixPatternEscaper escapes string literals embedded in STIX patterns
+var stixPatternEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+
+type (
+	//STIXBundle is a STIX 2.1 bundle of proxy beacon indicators and the observables they describe
+	STIXBundle struct {
+		Type    string        `json:"type"`
+		ID      string        `json:"id"`
+		Objects []interface{} `json:"objects"`
+	}
+
+	//STIXIndicator is a STIX 2.1 indicator for a single proxy beacon
+	STIXIndicator struct {
+		Type           string   `json:"type"`
+		SpecVersion    string   `json:"spec_version"`
+		ID             string   `json:"id"`
+		Created        string   `json:"created"`
+		Modified       string   `json:"modified"`
+		Name           string   `json:"name"`
+		Description    string   `json:"description"`
+		IndicatorTypes []string `json:"indicator_types"`
+		Pattern        string   `json:"pattern"`
+		PatternType    string   `json:"pattern_type"`
+		ValidFrom      string   `json:"valid_from"`
+		Confidence     int      `json:"confidence"`
+		Labels         []string `json:"labels"`
+	}
+
+	//STIXAddress is a STIX 2.1 ipv4-addr, ipv6-addr, or domain-name observable
+	STIXAddress struct {
+		Type        string `json:"type"`
+		SpecVersion string `json:"spec_version"`
+		ID          string `json:"id"`
+		Value       string `json:"value"`
+	}
+
+	//STIXNetworkTraffic is a STIX 2.1 network-traffic observable linking a
+	//proxy beacon's source to its destination FQDN
+	STIXNetworkTraffic struct {
+		Type        string   `json:"type"`
+		SpecVersion string   `json:"spec_version"`
+		ID          string   `json:"id"`
+		SrcRef      string   `json:"src_ref"`
+		DstRef      string   `json:"dst_ref"`
+		Protocols   []string `json:"protocols"`
+	}
+)
+
+//ExportSTIX writes the proxy beacons of the selected database scoring above minScore to
+//the writer as a STIX 2.1 bundle. Returns the number of indicators written.
+func ExportSTIX(res *resources.Resources, minScore float64, w io.Writer) (int, error) {
+	results, err := Results(res, minScore)
+	if err != nil {
+		return 0, err
+	}
+
+	bundle := newSTIXBundle(results, res.Config.S.BeaconProxy.TimestampPrecision, time.Now())
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return len(results), encoder.Encode(bundle)
+}
+
+//newSTIXBundle builds a bundle with an indicator for each proxy beacon created at the
+//given time. The source and destination observables are shared between indicators. The
+//delta times of the results are recorded at the given BeaconProxy.TimestampPrecision.
+func newSTIXBundle(results []Result, precision string, created time.Time) STIXBundle {
+	bundle := STIXBundle{
+		Type:    "bundle",
+		ID:      "bundle--" + uuid.New().String(),
+		Objects: make([]interface{}, 0, len(results)*4),
+	}
+
+	timestamp := created.UTC().Format(stixTimeFormat)
+
+	// observables have deterministic ids, so only add each one once
+	seen := make(map[string]bool)
+	addObservable := func(id string, object interface{}) {
+		if !seen[id] {
+			seen[id] = true
+			bundle.Objects = append(bundle.Objects, object)
+		}
+	}
+
+	for _, result := range results {
+		srcType := "ipv4-addr"
+		if strings.Contains(result.SrcIP, ":") {
+			srcType = "ipv6-addr"
+		}
+		src := newSTIXAddress(srcType, result.SrcIP)
+		dst := newSTIXAddress("domain-name", result.FQDN)
+		traffic := newSTIXNetworkTraffic(src.ID, dst.ID)
+
+		addObservable(src.ID, src)
+		addObservable(dst.ID, dst)
+		addObservable(traffic.ID, traffic)
+
+		pattern := fmt.Sprintf(
+			"[network-traffic:src_ref.value = '%s' AND network-traffic:dst_ref.value = '%s']",
+			stixPatternEscaper.Replace(result.SrcIP), stixPatternEscaper.Replace(result.FQDN),
+		)
+
+		bundle.Objects = append(bundle.Objects, STIXIndicator{
+			Type:        "indicator",
+			SpecVersion: stixSpecVersion,
+			ID:          "indicator--" + uuid.New().String(),
+			Created:     timestamp,
+			Modified:    timestamp,
+			Name:        fmt.Sprintf("Proxy beacon from %s to %s", result.SrcIP, result.FQDN),
+			Description: fmt.Sprintf(
+				"%s connected to %s through the proxy %s %d times, most often every %g seconds.",
+				result.SrcIP, result.FQDN, result.Proxy.IP, result.Connections, intervalSeconds(result.Ts.Mode, precision),
+			),
+			IndicatorTypes: []string{"malicious-activity"},
+			Pattern:        pattern,
+			PatternType:    "stix",
+			ValidFrom:      timestamp,
+			Confidence:     stixConfidence(result.Score),
+			Labels: []string{
+				"beacon-proxy",
+				"interval-mode:" + strconv.FormatInt(result.Ts.Mode, 10),
+				"score:" + strconv.FormatFloat(result.Score, 'f', -1, 64),
+			},
+		})
+	}
+
+	return bundle
+}
+
+//newSTIXAddress creates an address or domain name observable with its deterministic id
+func newSTIXAddress(objectType string, value string) STIXAddress {
+	return STIXAddress{
+		Type:        objectType,
+		SpecVersion: stixSpecVersion,
+		ID:          stixObservableID(objectType, map[string]interface{}{"value": value}),
+		Value:       value,
+	}
+}
+
+//newSTIXNetworkTraffic creates a network traffic observable with its deterministic id.
+//Proxied beacons are carried over HTTP.
+func newSTIXNetworkTraffic(srcRef string, dstRef string) STIXNetworkTraffic {
+	protocols := []string{"tcp", "http"}
+	return STIXNetworkTraffic{
+		Type:        "network-traffic",
+		SpecVersion: stixSpecVersion,
+		ID: stixObservableID("network-traffic", map[string]interface{}{
+			"src_ref":   srcRef,
+			"dst_ref":   dstRef,
+			"protocols": protocols,
+		}),
+		SrcRef:    srcRef,
+		DstRef:    dstRef,
+		Protocols: protocols,
+	}
+}
+
+//stixObservableID generates the UUIDv5 id STIX 2.1 specifies for observables from the
+//canonical JSON of their id contributing properties. Maps are marshaled with sorted keys.
+func stixObservableID(objectType string, contributing map[string]interface{}) string {
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	// the properties only hold strings and string slices, which always marshal
+	_ = encoder.Encode(contributing)
+
+	name := bytes.TrimSuffix(buffer.Bytes(), []byte("\n"))
+	return objectType + "--" + uuid.NewSHA1(stixSCONamespace, name).String()
+}
+
+//stixConfidence maps a score between 0 and 1 onto the 0 to 100 STIX confidence scale
+func stixConfidence(score float64) int {
+	confidence := int(math.Round(score * 100))
+	if confidence < 0 {
+		return 0
+	}
+	if confidence > 100 {
+		return 100
+	}
+	return confidence
+}
+
+//intervalSeconds converts a delta time recorded at the given BeaconProxy.TimestampPrecision
+//to seconds
+func intervalSeconds(interval int64, precision string) float64 {
+	return float64(interval) / float64(util.TimestampUnitsPerSecond(precision))
+}
@@ -0,0 +1,155 @@
+package beaconproxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/activecm/rita/pkg/data"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSTIXBundle(t *testing.T) {
+	results := []Result{
+		{
+			FQDN:        "example.com",
+			SrcIP:       "10.0.0.1",
+			Connections: 24,
+			Ts:          TSData{Mode: 60},
+			Score:       0.853,
+			Proxy:       data.UniqueIP{IP: "10.0.0.100"},
+		},
+		// the source is shared with the first beacon
+		{
+			FQDN:        "it's.example.org",
+			SrcIP:       "10.0.0.1",
+			Connections: 40,
+			Ts:          TSData{Mode: 300},
+			Score:       0.91,
+			Proxy:       data.UniqueIP{IP: "10.0.0.100"},
+		},
+		{
+			FQDN:        "example.com",
+			SrcIP:       "fd00::1",
+			Connections: 30,
+			Ts:          TSData{Mode: 120},
+			Score:       1,
+			Proxy:       data.UniqueIP{IP: "10.0.0.100"},
+		},
+	}
+
+	created := time.Date(2021, 6, 1, 12, 30, 0, 0, time.UTC)
+	var buffer bytes.Buffer
+	require.Nil(t, json.NewEncoder(&buffer).Encode(newSTIXBundle(results, "s", created)))
+
+	// the bundle must be valid JSON
+	var bundle struct {
+		Type    string                   `json:"type"`
+		ID      string                   `json:"id"`
+		Objects []map[string]interface{} `json:"objects"`
+	}
+	require.Nil(t, json.Unmarshal(buffer.Bytes(), &bundle))
+	require.Equal(t, "bundle", bundle.Type)
+	requireSTIXID(t, "bundle", bundle.ID)
+
+	objects := make(map[string]map[string]interface{})
+	var indicators []map[string]interface{}
+	counts := make(map[string]int)
+	for _, object := range bundle.Objects {
+		objectType := object["type"].(string)
+		requireSTIXID(t, objectType, object["id"].(string))
+		require.Equal(t, "2.1", object["spec_version"])
+		objects[object["id"].(string)] = object
+		counts[objectType]++
+		if objectType == "indicator" {
+			indicators = append(indicators, object)
+		}
+	}
+
+	// observables are only included once
+	require.Equal(t, map[string]int{
+		"indicator": 3, "network-traffic": 3, "ipv4-addr": 1, "ipv6-addr": 1, "domain-name": 2,
+	}, counts)
+
+	expected := []struct {
+		pattern    string
+		confidence float64
+		labels     []interface{}
+	}{
+		{
+			"[network-traffic:src_ref.value = '10.0.0.1' AND network-traffic:dst_ref.value = 'example.com']",
+			85, []interface{}{"beacon-proxy", "interval-mode:60", "score:0.853"},
+		},
+		{
+			`[network-traffic:src_ref.value = '10.0.0.1' AND network-traffic:dst_ref.value = 'it\'s.example.org']`,
+			91, []interface{}{"beacon-proxy", "interval-mode:300", "score:0.91"},
+		},
+		{
+			"[network-traffic:src_ref.value = 'fd00::1' AND network-traffic:dst_ref.value = 'example.com']",
+			100, []interface{}{"beacon-proxy", "interval-mode:120", "score:1"},
+		},
+	}
+	for i, indicator := range indicators {
+		require.Equal(t, expected[i].pattern, indicator["pattern"])
+		require.Equal(t, "stix", indicator["pattern_type"])
+		require.Equal(t, expected[i].confidence, indicator["confidence"])
+		require.Equal(t, expected[i].labels, indicator["labels"])
+		require.Equal(t, "2021-06-01T12:30:00.000Z", indicator["created"])
+		require.Equal(t, "2021-06-01T12:30:00.000Z", indicator["valid_from"])
+	}
+	require.Equal(t,
+		"10.0.0.1 connected to example.com through the proxy 10.0.0.100 24 times, most often every 60 seconds.",
+		indicators[0]["description"],
+	)
+
+	// the traffic observables reference observables in the bundle
+	for _, object := range objects {
+		if object["type"] != "network-traffic" {
+			continue
+		}
+		require.Contains(t, objects, object["src_ref"])
+		require.Equal(t, "domain-name", objects[object["dst_ref"].(string)]["type"])
+	}
+}
+
+func TestSTIXBundleTimestampPrecision(t *testing.T) {
+	results := []Result{{
+		FQDN:        "example.com",
+		SrcIP:       "10.0.0.1",
+		Connections: 24,
+		Ts:          TSData{Mode: 1500},
+		Score:       0.853,
+		Proxy:       data.UniqueIP{IP: "10.0.0.100"},
+	}}
+
+	// the delta times recorded in milliseconds are described in seconds
+	bundle := newSTIXBundle(results, "ms", time.Now())
+	indicator := bundle.Objects[len(bundle.Objects)-1].(STIXIndicator)
+	require.Equal(t,
+		"10.0.0.1 connected to example.com through the proxy 10.0.0.100 24 times, most often every 1.5 seconds.",
+		indicator.Description,
+	)
+}
+
+func TestSTIXObservableID(t *testing.T) {
+	// UUIDv5 of {"value":"198.51.100.3"} in the STIX observable namespace
+	require.Equal(t,
+		"ipv4-addr--c8263bc5-b6fd-5cb5-abe0-bf4b166a6053",
+		newSTIXAddress("ipv4-addr", "198.51.100.3").ID,
+	)
+}
+
+func TestSTIXConfidence(t *testing.T) {
+	require.Equal(t, 0, stixConfidence(-0.1))
+	require.Equal(t, 50, stixConfidence(0.504))
+	require.Equal(t, 100, stixConfidence(1.2))
+}
+
+func requireSTIXID(t *testing.T, objectType string, id string) {
+	prefix := objectType + "--"
+	require.True(t, len(id) > len(prefix) && id[:len(prefix)] == prefix, id)
+	_, err := uuid.Parse(id[len(prefix):])
+	require.Nil(t, err, id)
+}
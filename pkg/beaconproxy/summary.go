@@ -0,0 +1,141 @@
+package beaconproxy
+
+import (
+	"encoding/csv"
+	"io"
+	"sort"
+	"strconv"
+
+	"github.com/activecm/rita/resources"
+	"github.com/globalsign/mgo/bson"
+)
+
+type (
+	//HostSummary is the top proxy beacon of a source host as tracked in the hosts table
+	HostSummary struct {
+		Src            string
+		SrcNetworkName string
+		SrcNetworkUUID string
+		FQDN           string
+		Score          float64
+		CID            int
+	}
+
+	//hostSummaryDoc holds the fields of a hosts table entry used to build a HostSummary.
+	//Sources aggregated into subnets are tracked under the subnet rather than the ip.
+	hostSummaryDoc struct {
+		IP          string               `bson:"ip"`
+		Subnet      string               `bson:"subnet"`
+		NetworkUUID bson.Binary          `bson:"network_uuid"`
+		NetworkName string               `bson:"network_name"`
+		Dat         []hostProxyBeaconDat `bson:"dat"`
+	}
+)
+
+//hostSummaryColumns is the header of host summary CSV exports. Rows are written
+//in the same order.
+var hostSummaryColumns = []string{
+	"src", "src_network_name", "src_network_uuid", "fqdn", "score", "cid",
+}
+
+//HostSummaries finds the top proxy beacon of each source host in the selected database
+//scoring at least minScore. The summaries are sorted by score, highest first.
+func HostSummaries(res *resources.Resources, minScore float64) ([]HostSummary, error) {
+	ssn := res.DB.Session.Copy()
+	defer ssn.Close()
+
+	var hosts []hostSummaryDoc
+
+	query := bson.M{"dat.max_beacon_proxy_score": bson.M{"$gte": minScore}}
+
+	err := ssn.DB(res.DB.GetSelectedDB()).C(res.Config.T.Structure.HostTable).
+		Find(query).
+		Select(bson.M{
+			"ip": 1, "subnet": 1, "network_uuid": 1, "network_name": 1,
+			"dat.max_beacon_proxy_score": 1, "dat.mbproxy": 1, "dat.cid": 1,
+		}).
+		All(&hosts)
+	if err != nil {
+		return nil, err
+	}
+
+	return summarizeHosts(hosts, minScore), nil
+}
+
+//summarizeHosts selects the highest scoring max proxy beacon entry of each host. Hosts
+//without a max proxy beacon scoring at least minScore are left out. The summaries are
+//sorted by score, highest first, with ties broken by source and network so the
+//ordering is stable across runs.
+func summarizeHosts(hosts []hostSummaryDoc, minScore float64) []HostSummary {
+	summaries := make([]HostSummary, 0, len(hosts))
+
+	for _, host := range hosts {
+		// a host has a dat entry per chunk in rolling databases, so pick the max
+		var top *hostProxyBeaconDat
+		for i := range host.Dat {
+			entry := &host.Dat[i]
+			if entry.MaxBeaconProxyScore == nil || entry.MBProxy == nil {
+				continue
+			}
+			if top == nil || *entry.MaxBeaconProxyScore > *top.MaxBeaconProxyScore {
+				top = entry
+			}
+		}
+
+		if top == nil || *top.MaxBeaconProxyScore < minScore {
+			continue
+		}
+
+		src := host.IP
+		if src == "" {
+			src = host.Subnet
+		}
+
+		summaries = append(summaries, HostSummary{
+			Src:            src,
+			SrcNetworkName: host.NetworkName,
+			SrcNetworkUUID: formatUUID(host.NetworkUUID),
+			FQDN:           *top.MBProxy,
+			Score:          *top.MaxBeaconProxyScore,
+			CID:            top.CID,
+		})
+	}
+
+	sort.Slice(summaries, func(i, j int) bool {
+		if summaries[i].Score != summaries[j].Score {
+			return summaries[i].Score > summaries[j].Score
+		}
+		if summaries[i].Src != summaries[j].Src {
+			return summaries[i].Src < summaries[j].Src
+		}
+		return summaries[i].SrcNetworkUUID < summaries[j].SrcNetworkUUID
+	})
+
+	return summaries
+}
+
+//WriteHostSummariesCSV writes the host summaries to the writer as CSV with a header row
+func WriteHostSummariesCSV(summaries []HostSummary, w io.Writer) error {
+	writer := csv.NewWriter(w)
+
+	if err := writer.Write(hostSummaryColumns); err != nil {
+		return err
+	}
+
+	for _, summary := range summaries {
+		row := []string{
+			summary.Src,
+			summary.SrcNetworkName,
+			summary.SrcNetworkUUID,
+			summary.FQDN,
+			strconv.FormatFloat(summary.Score, 'f', -1, 64),
+			strconv.Itoa(summary.CID),
+		}
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,79 @@
+package beaconproxy
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/activecm/rita/util"
+	"github.com/globalsign/mgo/bson"
+	"github.com/stretchr/testify/require"
+)
+
+func hostSummaryDat(score float64, fqdn string, cid int) hostProxyBeaconDat {
+	return hostProxyBeaconDat{MaxBeaconProxyScore: &score, MBProxy: &fqdn, CID: cid}
+}
+
+func TestHostSummariesCSV(t *testing.T) {
+	otherNetworkUUID := bson.Binary{
+		Kind: bson.BinaryUUID,
+		Data: []byte{0x16, 0x2d, 0x4d, 0x42, 0x9e, 0x4f, 0x4e, 0x8c, 0x8b, 0x6a, 0x0b, 0x2d, 0x01, 0x3c, 0x6a, 0x31},
+	}
+
+	hosts := []hostSummaryDoc{
+		// the max of the chunk entries is selected
+		{
+			IP:          "10.0.0.1",
+			NetworkUUID: util.UnknownPrivateNetworkUUID,
+			NetworkName: util.UnknownPrivateNetworkName,
+			Dat: []hostProxyBeaconDat{
+				hostSummaryDat(0.6, "old.example.com", 0),
+				hostSummaryDat(0.9, "example.com", 1),
+				hostSummaryDat(0.7, "other.example.com", 2),
+			},
+		},
+		// below the minimum score
+		{
+			IP:          "10.0.0.2",
+			NetworkUUID: util.UnknownPrivateNetworkUUID,
+			NetworkName: util.UnknownPrivateNetworkName,
+			Dat:         []hostProxyBeaconDat{hostSummaryDat(0.3, "low.example.com", 0)},
+		},
+		// ties are ordered by source, then network
+		{
+			IP:          "10.0.0.3",
+			NetworkUUID: otherNetworkUUID,
+			NetworkName: "branch, office",
+			Dat:         []hostProxyBeaconDat{hostSummaryDat(0.8, "tie.example.com", 0)},
+		},
+		{
+			IP:          "10.0.0.3",
+			NetworkUUID: util.UnknownPrivateNetworkUUID,
+			NetworkName: util.UnknownPrivateNetworkName,
+			Dat:         []hostProxyBeaconDat{hostSummaryDat(0.8, "tie.example.com", 0)},
+		},
+		// sources aggregated into subnets
+		{
+			Subnet:      "10.0.1.0/24",
+			NetworkUUID: util.UnknownPrivateNetworkUUID,
+			NetworkName: util.UnknownPrivateNetworkName,
+			Dat:         []hostProxyBeaconDat{hostSummaryDat(0.55, "subnet.example.com", 3)},
+		},
+		// dat entries without a max proxy beacon are ignored
+		{
+			IP:          "10.0.0.4",
+			NetworkUUID: util.UnknownPrivateNetworkUUID,
+			NetworkName: util.UnknownPrivateNetworkName,
+			Dat:         []hostProxyBeaconDat{{CID: 0}},
+		},
+	}
+
+	var buffer bytes.Buffer
+	err := WriteHostSummariesCSV(summarizeHosts(hosts, 0.5), &buffer)
+	require.Nil(t, err)
+
+	golden, err := ioutil.ReadFile(filepath.Join("testdata", "host_summaries.csv"))
+	require.Nil(t, err)
+	require.Equal(t, string(golden), buffer.String())
+}
@@ -0,0 +1,37 @@
+package beaconproxy
+
+import (
+	"net"
+
+	"github.com/activecm/rita/config"
+	"github.com/activecm/rita/pkg/uconnproxy"
+)
+
+//newTargetFilter creates a predicate matching the entries from the source and to the
+//FQDN set in BeaconProxy.Target. Returns nil if no target is set. When sources are
+//aggregated into subnets, the subnet holding the target source is matched.
+func newTargetFilter(conf *config.Config) func(*uconnproxy.Input) bool {
+	target := conf.S.BeaconProxy.Target
+	if target.Src == "" && target.FQDN == "" {
+		return nil
+	}
+
+	targetIP := net.ParseIP(target.Src)
+
+	return func(entry *uconnproxy.Input) bool {
+		if target.FQDN != "" && entry.Hosts.FQDN != target.FQDN {
+			return false
+		}
+		if target.Src == "" {
+			return true
+		}
+		if entry.SrcSubnet != nil {
+			_, subnet, err := net.ParseCIDR(entry.SrcSubnet.CIDR)
+			return err == nil && targetIP != nil && subnet.Contains(targetIP)
+		}
+		if targetIP == nil {
+			return entry.Hosts.SrcIP == target.Src
+		}
+		return targetIP.Equal(net.ParseIP(entry.Hosts.SrcIP))
+	}
+}
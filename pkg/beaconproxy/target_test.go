@@ -0,0 +1,51 @@
+package beaconproxy
+
+import (
+	"testing"
+
+	"github.com/activecm/rita/config"
+	"github.com/activecm/rita/pkg/data"
+	"github.com/activecm/rita/pkg/uconnproxy"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTargetFilter(t *testing.T) {
+	conf, err := config.LoadTestingConfig("")
+	require.Nil(t, err)
+
+	entry := func(src string, fqdn string) *uconnproxy.Input {
+		return &uconnproxy.Input{Hosts: data.UniqueSrcFQDNPair{
+			UniqueSrcIP: data.UniqueSrcIP{SrcIP: src},
+			FQDN:        fqdn,
+		}}
+	}
+
+	// everything is analyzed without a target
+	require.Nil(t, newTargetFilter(conf))
+
+	conf.S.BeaconProxy.Target.Src = "fd00::1"
+	conf.S.BeaconProxy.Target.FQDN = "example.com"
+	filter := newTargetFilter(conf)
+	require.True(t, filter(entry("fd00:0:0:0:0:0:0:1", "example.com")))
+	require.False(t, filter(entry("fd00::2", "example.com")))
+	require.False(t, filter(entry("fd00::1", "example.org")))
+
+	// the target may be limited to either side of the pair
+	conf.S.BeaconProxy.Target.Src = ""
+	filter = newTargetFilter(conf)
+	require.True(t, filter(entry("10.0.0.1", "example.com")))
+	require.False(t, filter(entry("10.0.0.1", "example.org")))
+
+	conf.S.BeaconProxy.Target.Src = "10.0.0.1"
+	conf.S.BeaconProxy.Target.FQDN = ""
+	filter = newTargetFilter(conf)
+	require.True(t, filter(entry("10.0.0.1", "example.org")))
+	require.False(t, filter(entry("10.0.0.2", "example.org")))
+
+	// the subnet holding the source is matched when sources are aggregated
+	aggregated := entry("10.0.0.0/24", "example.org")
+	aggregated.SrcSubnet = &data.Subnet{CIDR: "10.0.0.0/24"}
+	require.True(t, filter(aggregated))
+	aggregated.SrcSubnet = &data.Subnet{CIDR: "10.0.1.0/24"}
+	require.False(t, filter(aggregated))
+}
@@ -0,0 +1,282 @@
+package beaconproxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/activecm/rita/config"
+	"github.com/globalsign/mgo/bson"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	//webhookTimeout bounds each request to the webhook so an unresponsive endpoint
+	//can't hold up the notifications which follow it
+	webhookTimeout = 10 * time.Second
+	//webhookQueueSize is the number of notifications which may wait to be sent.
+	//Notifications are dropped rather than stalling the analysis once it fills up.
+	webhookQueueSize = 100
+)
+
+type (
+	//webhookNotifier posts a notification to a Slack or Teams compatible webhook for each
+	//proxy beacon scoring above the threshold. It sits next to the writer and receives
+	//the same updates. Notifications for the same src/FQDN pair are debounced.
+	webhookNotifier struct {
+		client    *http.Client
+		url       string
+		database  string
+		minScore  float64
+		precision string // BeaconProxy.TimestampPrecision the delta times are recorded at
+		debouncer *webhookDebouncer
+		log       *log.Logger
+		queue     chan webhookPayload
+		wg        sync.WaitGroup
+	}
+
+	//webhookPayload is the JSON body posted to the webhook. Slack and Teams display the
+	//text, the other fields are included for other consumers.
+	webhookPayload struct {
+		Text            string  `json:"text"`
+		Database        string  `json:"database"`
+		Src             string  `json:"src"`
+		FQDN            string  `json:"fqdn"`
+		Score           float64 `json:"score"`
+		IntervalMode    int64   `json:"interval_mode"`
+		ConnectionCount int64   `json:"connection_count"`
+	}
+
+	//webhookDebouncer remembers when each src/FQDN pair was last notified. It is shared
+	//by the analyses run in the same process, such as the flushes of a streaming import,
+	//and optionally saved to a file so it lasts between imports.
+	webhookDebouncer struct {
+		lock      sync.Mutex
+		window    time.Duration
+		stateFile string
+		notified  map[string]time.Time
+		now       func() time.Time
+	}
+)
+
+var (
+	//webhookDebouncers holds the debouncer of each state file, the in memory state
+	//is shared under an empty path
+	webhookDebouncers     = make(map[string]*webhookDebouncer)
+	webhookDebouncersLock sync.Mutex
+)
+
+//newWebhookNotifier creates a webhookNotifier for the results of the given database
+func newWebhookNotifier(database string, conf *config.Config, log *log.Logger) *webhookNotifier {
+	hookConf := conf.S.BeaconProxy.Webhook
+	return &webhookNotifier{
+		client:    &http.Client{Timeout: webhookTimeout},
+		url:       hookConf.URL,
+		database:  database,
+		minScore:  hookConf.MinScore,
+		precision: conf.S.BeaconProxy.TimestampPrecision,
+		debouncer: sharedWebhookDebouncer(hookConf.StateFile, time.Duration(hookConf.DebounceWindow)*time.Second, log),
+		log:       log,
+		queue:     make(chan webhookPayload, webhookQueueSize),
+	}
+}
+
+//collect queues a notification for an update if it holds a proxy beacon scoring above
+//the threshold which hasn't been notified within the debounce window. Never blocks.
+func (n *webhookNotifier) collect(data *update) {
+	payload, ok := n.payload(data)
+	if !ok || !n.debouncer.allow(payload.Src+"\x00"+payload.FQDN) {
+		return
+	}
+
+	select {
+	case n.queue <- payload:
+	default:
+		n.log.WithFields(log.Fields{
+			"Module": "beaconsProxy",
+			"src":    payload.Src,
+			"fqdn":   payload.FQDN,
+		}).Warn("Dropping proxy beacon notification since the webhook is falling behind")
+	}
+}
+
+//close waits for the queued notifications to be sent and saves the debounce state
+func (n *webhookNotifier) close() {
+	close(n.queue)
+	n.wg.Wait()
+	if err := n.debouncer.save(); err != nil {
+		n.log.WithError(err).WithField("Module", "beaconsProxy").Error("Could not save the webhook debounce state")
+	}
+}
+
+//start kicks off the thread which posts the notifications
+func (n *webhookNotifier) start() {
+	n.wg.Add(1)
+	go func() {
+		for payload := range n.queue {
+			if err := n.post(payload); err != nil {
+				n.log.WithError(err).WithFields(log.Fields{
+					"Module": "beaconsProxy",
+					"src":    payload.Src,
+					"fqdn":   payload.FQDN,
+				}).Error("Could not send proxy beacon notification")
+			}
+		}
+		n.wg.Done()
+	}()
+}
+
+//payload builds the notification for an update. Returns false if the update doesn't
+//hold a proxy beacon scoring above the threshold.
+func (n *webhookNotifier) payload(data *update) (webhookPayload, bool) {
+	if data.beacon.query == nil {
+		return webhookPayload{}, false
+	}
+	set, ok := data.beacon.query["$set"].(bson.M)
+	if !ok {
+		return webhookPayload{}, false
+	}
+	score, _ := set["score"].(float64)
+	if score <= n.minScore {
+		return webhookPayload{}, false
+	}
+
+	payload := webhookPayload{
+		Database: n.database,
+		Score:    score,
+	}
+	payload.Src, _ = data.beacon.selector["src"].(string)
+	payload.FQDN, _ = data.beacon.selector["fqdn"].(string)
+	payload.IntervalMode, _ = set["ts.mode"].(int64)
+	payload.ConnectionCount, _ = set["connection_count"].(int64)
+	payload.Text = fmt.Sprintf(
+		"RITA found a proxy beacon from %s to %s in %s with a score of %.3f: %d connections, most often every %g seconds",
+		payload.Src, payload.FQDN, payload.Database, payload.Score, payload.ConnectionCount,
+		intervalSeconds(payload.IntervalMode, n.precision),
+	)
+	return payload, true
+}
+
+//post sends a notification to the webhook
+func (n *webhookNotifier) post(payload webhookPayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	resp, err := n.client.Post(n.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with %s", resp.Status)
+	}
+	return nil
+}
+
+//sharedWebhookDebouncer returns the debouncer for a state file, loading the state
+//the first time the file is used
+func sharedWebhookDebouncer(stateFile string, window time.Duration, logger *log.Logger) *webhookDebouncer {
+	webhookDebouncersLock.Lock()
+	defer webhookDebouncersLock.Unlock()
+
+	if debouncer, ok := webhookDebouncers[stateFile]; ok {
+		debouncer.setWindow(window)
+		return debouncer
+	}
+
+	debouncer := newWebhookDebouncer(stateFile, window)
+	if err := debouncer.load(); err != nil {
+		logger.WithError(err).WithField("StateFile", stateFile).Warn("Could not load the webhook debounce state")
+	}
+	webhookDebouncers[stateFile] = debouncer
+	return debouncer
+}
+
+//newWebhookDebouncer creates a debouncer which allows a notification for each key once
+//per window. The state is only kept in memory if stateFile is empty.
+func newWebhookDebouncer(stateFile string, window time.Duration) *webhookDebouncer {
+	return &webhookDebouncer{
+		window:    window,
+		stateFile: stateFile,
+		notified:  make(map[string]time.Time),
+		now:       time.Now,
+	}
+}
+
+//setWindow changes the debounce window
+func (d *webhookDebouncer) setWindow(window time.Duration) {
+	d.lock.Lock()
+	d.window = window
+	d.lock.Unlock()
+}
+
+//allow reports whether a notification for the key may be sent and records it if so
+func (d *webhookDebouncer) allow(key string) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	now := d.now()
+	if last, ok := d.notified[key]; ok && now.Sub(last) < d.window {
+		return false
+	}
+	d.notified[key] = now
+	return true
+}
+
+//load reads the times the keys were last notified from the state file. A missing
+//state file is not an error.
+func (d *webhookDebouncer) load() error {
+	if d.stateFile == "" {
+		return nil
+	}
+
+	contents, err := ioutil.ReadFile(d.stateFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return json.Unmarshal(contents, &d.notified)
+}
+
+//save writes the times the keys were last notified to the state file, dropping the
+//keys whose debounce window has passed
+func (d *webhookDebouncer) save() error {
+	if d.stateFile == "" {
+		return nil
+	}
+
+	d.lock.Lock()
+	now := d.now()
+	for key, last := range d.notified {
+		if now.Sub(last) >= d.window {
+			delete(d.notified, key)
+		}
+	}
+	contents, err := json.Marshal(d.notified)
+	d.lock.Unlock()
+	if err != nil {
+		return err
+	}
+
+	// replace the state file in one step so an interrupted write can't corrupt it
+	tmpFile := d.stateFile + ".tmp"
+	if err := ioutil.WriteFile(tmpFile, contents, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, d.stateFile)
+}
@@ -0,0 +1,200 @@
+package beaconproxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/activecm/rita/config"
+	"github.com/globalsign/mgo/bson"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/require"
+)
+
+//mockWebhook records the notifications posted to it
+type mockWebhook struct {
+	lock     sync.Mutex
+	payloads []map[string]interface{}
+	status   int
+}
+
+func (m *mockWebhook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+		http.Error(w, "expected a JSON POST", http.StatusBadRequest)
+		return
+	}
+
+	var payload map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	m.lock.Lock()
+	m.payloads = append(m.payloads, payload)
+	m.lock.Unlock()
+
+	if m.status != 0 {
+		w.WriteHeader(m.status)
+		return
+	}
+	w.Write([]byte("ok"))
+}
+
+func testWebhookNotifier(t *testing.T, url string) (*webhookNotifier, *test.Hook) {
+	conf, err := config.LoadTestingConfig("")
+	require.Nil(t, err)
+	conf.S.BeaconProxy.Webhook.URL = url
+	conf.S.BeaconProxy.Webhook.MinScore = 0.9
+
+	logger, hook := test.NewNullLogger()
+	notifier := newWebhookNotifier("test_db", conf, logger)
+	// each test gets its own debounce state
+	notifier.debouncer = newWebhookDebouncer("", time.Hour)
+	return notifier, hook
+}
+
+//testWebhookUpdate creates the update written for a proxy beacon
+func testWebhookUpdate(src string, fqdn string, score float64) *update {
+	hosts := testESHosts(src, fqdn)
+	return &update{
+		beacon: updateInfo{
+			selector: hosts.BSONKey(),
+			query: bson.M{"$set": bson.M{
+				"score":            score,
+				"ts.mode":          int64(60),
+				"connection_count": int64(1440),
+			}},
+		},
+		score: score,
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	mock := &mockWebhook{}
+	server := httptest.NewServer(mock)
+	defer server.Close()
+
+	notifier, hook := testWebhookNotifier(t, server.URL)
+	notifier.start()
+	notifier.collect(testWebhookUpdate("10.0.0.1", "example.com", 0.95))
+	// proxy beacons at or below the threshold are not notified
+	notifier.collect(testWebhookUpdate("10.0.0.2", "example.com", 0.9))
+	// strobes are not notified
+	notifier.collect(&update{
+		uconnproxy: updateInfo{
+			selector: testESHosts("10.0.0.3", "example.com").BSONKey(),
+			query:    bson.M{"$set": bson.M{"strobeFQDN": true}},
+		},
+	})
+	// a second update to the same proxy beacon is debounced
+	notifier.collect(testWebhookUpdate("10.0.0.1", "example.com", 0.97))
+	notifier.collect(testWebhookUpdate("10.0.0.1", "example.org", 0.92))
+	notifier.close()
+
+	require.Empty(t, hook.AllEntries())
+	require.Equal(t, []map[string]interface{}{
+		{
+			"text":             "RITA found a proxy beacon from 10.0.0.1 to example.com in test_db with a score of 0.950: 1440 connections, most often every 60 seconds",
+			"database":         "test_db",
+			"src":              "10.0.0.1",
+			"fqdn":             "example.com",
+			"score":            0.95,
+			"interval_mode":    float64(60),
+			"connection_count": float64(1440),
+		},
+		{
+			"text":             "RITA found a proxy beacon from 10.0.0.1 to example.org in test_db with a score of 0.920: 1440 connections, most often every 60 seconds",
+			"database":         "test_db",
+			"src":              "10.0.0.1",
+			"fqdn":             "example.org",
+			"score":            0.92,
+			"interval_mode":    float64(60),
+			"connection_count": float64(1440),
+		},
+	}, mock.payloads)
+}
+
+func TestWebhookPayloadTimestampPrecision(t *testing.T) {
+	notifier, _ := testWebhookNotifier(t, "http://127.0.0.1:0")
+	notifier.precision = "ms"
+
+	// the delta times recorded in milliseconds are described in seconds
+	data := testWebhookUpdate("10.0.0.1", "example.com", 0.95)
+	data.beacon.query["$set"].(bson.M)["ts.mode"] = int64(1500)
+	payload, ok := notifier.payload(data)
+	require.True(t, ok)
+	require.Equal(t, int64(1500), payload.IntervalMode)
+	require.Equal(t,
+		"RITA found a proxy beacon from 10.0.0.1 to example.com in test_db with a score of 0.950: 1440 connections, most often every 1.5 seconds",
+		payload.Text,
+	)
+}
+
+func TestWebhookNotifierFailures(t *testing.T) {
+	mock := &mockWebhook{status: http.StatusInternalServerError}
+	server := httptest.NewServer(mock)
+
+	notifier, hook := testWebhookNotifier(t, server.URL)
+	notifier.start()
+	notifier.collect(testWebhookUpdate("10.0.0.1", "example.com", 0.95))
+	require.Eventually(t, func() bool {
+		return len(hook.AllEntries()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// an unreachable webhook is logged like an error response
+	server.Close()
+	notifier.collect(testWebhookUpdate("10.0.0.1", "example.org", 0.95))
+	notifier.close()
+
+	require.Len(t, mock.payloads, 1)
+	require.Len(t, hook.AllEntries(), 2)
+	for _, entry := range hook.AllEntries() {
+		require.Equal(t, "Could not send proxy beacon notification", entry.Message)
+	}
+}
+
+func TestWebhookNotifierQueueFull(t *testing.T) {
+	notifier, hook := testWebhookNotifier(t, "http://127.0.0.1:0")
+
+	// the notifications are queued without a thread sending them
+	for i := 0; i < webhookQueueSize+1; i++ {
+		notifier.collect(testWebhookUpdate("10.0.0.1", fmt.Sprintf("example%d.com", i), 0.95))
+	}
+	require.Len(t, notifier.queue, webhookQueueSize)
+	require.Len(t, hook.AllEntries(), 1)
+}
+
+func TestWebhookDebouncerStateFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "webhook")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	stateFile := filepath.Join(dir, "webhook.json")
+
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	debouncer := newWebhookDebouncer(stateFile, time.Hour)
+	debouncer.now = func() time.Time { return now }
+	require.Nil(t, debouncer.load())
+	require.True(t, debouncer.allow("a"))
+	now = now.Add(45 * time.Minute)
+	require.True(t, debouncer.allow("b"))
+	require.False(t, debouncer.allow("a"))
+
+	// the notification for a has expired once the state is saved
+	now = now.Add(30 * time.Minute)
+	require.Nil(t, debouncer.save())
+
+	restored := newWebhookDebouncer(stateFile, time.Hour)
+	restored.now = func() time.Time { return now }
+	require.Nil(t, restored.load())
+	require.Len(t, restored.notified, 1)
+	require.False(t, restored.allow("b"))
+	require.True(t, restored.allow("a"))
+}
@@ -2,27 +2,51 @@ package beaconproxy
 
 import (
 	"sync"
+	"time"
 
 	"github.com/activecm/rita/config"
 	"github.com/activecm/rita/database"
+	"github.com/activecm/rita/metrics"
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
 	log "github.com/sirupsen/logrus"
 )
 
 type (
 	writer struct {
 		targetCollection string
+		batchSize        int            // number of operations queued per collection before flushing
 		db               *database.DB   // provides access to MongoDB
 		conf             *config.Config // contains details needed to access MongoDB
 		log              *log.Logger    // main logger for RITA
 		writeChannel     chan *update   // holds analyzed data
 		writeWg          sync.WaitGroup // wait for writing to finish
+		errLock          sync.Mutex     // guards writeErr
+		writeErr         error          // the first write which failed
+	}
+
+	//bulkBatch queues up writes to a collection and sends them to MongoDB in bulk
+	bulkBatch struct {
+		collection *mgo.Collection
+		ordered    bool // apply the operations in the order they were queued
+		batchSize  int
+		bulk       *mgo.Bulk
+		pending    int
+		log        *log.Logger
+		onError    func(error) // called with the error of each failed flush
 	}
 )
 
 //newWriter creates a new writer object to write output data to beaconproxy collections
 func newWriter(targetCollection string, db *database.DB, conf *config.Config, log *log.Logger) *writer {
+	batchSize := conf.S.BeaconProxy.WriteBatchSize
+	if batchSize < 1 {
+		batchSize = 1
+	}
+
 	return &writer{
 		targetCollection: targetCollection,
+		batchSize:        batchSize,
 		db:               db,
 		conf:             conf,
 		log:              log,
@@ -41,69 +65,166 @@ func (w *writer) close() {
 	w.writeWg.Wait()
 }
 
-//start kicks off a new write thread
+//recordError keeps the first write error so it can be returned once writing is done
+func (w *writer) recordError(err error) {
+	w.errLock.Lock()
+	defer w.errLock.Unlock()
+	if w.writeErr == nil {
+		w.writeErr = err
+	}
+}
+
+//err returns the first write which failed. It must only be called after close.
+func (w *writer) err() error {
+	w.errLock.Lock()
+	defer w.errLock.Unlock()
+	return w.writeErr
+}
+
+//start kicks off a new write thread. Each thread batches its writes per collection
+//and flushes the batches once they are full and when the write channel is closed.
 func (w *writer) start() {
 	w.writeWg.Add(1)
 	go func() {
 		ssn := w.db.Session.Copy()
 		defer ssn.Close()
 
+		db := ssn.DB(w.db.GetSelectedDB())
+
+		// the proxy beacon and uconnproxy documents are independent of each other,
+		// so they are written in bulk. The updates to a host's max proxy beacon
+		// entries are conditioned on the host's state when they are applied, and
+		// the analyzer reads that state to skip them, so they are applied right
+		// away rather than queued.
+		beacons := newBulkBatch(db.C(w.targetCollection), false, w.batchSize, w.log, w.recordError)
+		hosts := db.C(w.conf.T.Structure.HostTable)
+		uconnsProxy := newBulkBatch(db.C(w.conf.T.Structure.UniqueConnProxyTable), false, w.batchSize, w.log, w.recordError)
+
 		for data := range w.writeChannel {
 
 			if data.beacon.query != nil {
 				// update beacons proxy table
-				info, err := ssn.DB(w.db.GetSelectedDB()).C(w.targetCollection).Upsert(data.beacon.selector, data.beacon.query)
-
-				if err != nil ||
-					((info.Updated == 0) && (info.UpsertedId == nil)) {
-					w.log.WithFields(log.Fields{
-						"Module": "beaconsProxy",
-						"Info":   info,
-						"Data":   data,
-					}).Error(err)
-				}
+				beacons.upsert(data.beacon.selector, data.beacon.query)
 
 				// update hosts table with max beacon proxy updates
-				if data.hostBeacon.query != nil {
-					// update hosts table
-					info, err = ssn.DB(w.db.GetSelectedDB()).C(w.conf.T.Structure.HostTable).Upsert(data.hostBeacon.selector, data.hostBeacon.query)
+				if data.hostBeacon.insert.query != nil {
+					err := w.updateMaxBeacon(hosts, data.hostBeacon)
 
-					if err != nil ||
-						((info.Updated == 0) && (info.UpsertedId == nil) && (info.Matched == 0)) {
+					if err != nil {
 						w.log.WithFields(log.Fields{
 							"Module": "beaconsProxy",
-							"Info":   info,
-							"Data":   data,
+							"Data":   data.hostBeacon,
 						}).Error(err)
+						w.recordError(err)
 					}
 				}
 			}
 
 			if data.uconnproxy.query != nil {
 				// update uconnsproxy table
-				info, err := ssn.DB(w.db.GetSelectedDB()).C(w.conf.T.Structure.UniqueConnProxyTable).Upsert(data.uconnproxy.selector, data.uconnproxy.query)
-
-				if err != nil ||
-					((info.Updated == 0) && (info.UpsertedId == nil)) {
-					w.log.WithFields(log.Fields{
-						"Module": "beaconsProxy",
-						"Info":   info,
-						"Data":   data,
-					}).Error(err)
-				}
+				uconnsProxy.upsert(data.uconnproxy.selector, data.uconnproxy.query)
 
 				//delete the record (no longer a beacon - its a strobe)
-				info, err = ssn.DB(w.db.GetSelectedDB()).C(w.targetCollection).RemoveAll(data.uconnproxy.selector)
-				if err != nil ||
-					((info.Updated == 0) && (info.Removed == 0) && (info.Matched == 0) && (info.UpsertedId == nil)) {
-					w.log.WithFields(log.Fields{
-						"Module": "beaconsProxy",
-						"Info":   info,
-						"Data":   data,
-					}).Error(err)
-				}
+				beacons.removeAll(data.uconnproxy.selector)
 			}
 		}
+
+		beacons.flush()
+		uconnsProxy.flush()
+
 		w.writeWg.Done()
 	}()
 }
+
+//updateMaxBeacon applies the updates which record the max proxy beacon of a source in
+//order. The insert and replace updates are expected to match nothing when their conditions
+//don't hold.
+func (w *writer) updateMaxBeacon(hosts *mgo.Collection, updates maxBeaconUpdate) error {
+	start := time.Now()
+	_, err := hosts.Upsert(updates.host.selector, updates.host.query)
+	metrics.ObserveDBLatency(hosts.Name, "upsert", start)
+	if err != nil {
+		return err
+	}
+
+	for _, conditional := range []updateInfo{updates.insert, updates.replace} {
+		start = time.Now()
+		err = hosts.Update(conditional.selector, conditional.query)
+		metrics.ObserveDBLatency(hosts.Name, "update", start)
+		if err != nil && err != mgo.ErrNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+//newBulkBatch creates a bulkBatch which flushes every batchSize operations. The error of
+//each failed flush is passed to onError.
+func newBulkBatch(collection *mgo.Collection, ordered bool, batchSize int, log *log.Logger,
+	onError func(error)) *bulkBatch {
+	b := &bulkBatch{
+		collection: collection,
+		ordered:    ordered,
+		batchSize:  batchSize,
+		log:        log,
+		onError:    onError,
+	}
+	b.reset()
+	return b
+}
+
+//reset starts a new bulk operation
+func (b *bulkBatch) reset() {
+	b.bulk = b.collection.Bulk()
+	if !b.ordered {
+		b.bulk.Unordered()
+	}
+	b.pending = 0
+}
+
+//upsert queues an upsert and flushes the batch if it is full
+func (b *bulkBatch) upsert(selector bson.M, query bson.M) {
+	b.bulk.Upsert(selector, query)
+	b.queued()
+}
+
+//removeAll queues a removal and flushes the batch if it is full
+func (b *bulkBatch) removeAll(selector bson.M) {
+	b.bulk.RemoveAll(selector)
+	b.queued()
+}
+
+//queued tracks a newly queued operation
+func (b *bulkBatch) queued() {
+	b.pending++
+	if b.pending >= b.batchSize {
+		b.flush()
+	}
+}
+
+//flush sends the queued operations to MongoDB. If an ordered batch fails, the
+//operations queued after the failed operation are not applied.
+func (b *bulkBatch) flush() {
+	if b.pending == 0 {
+		return
+	}
+
+	start := time.Now()
+	_, err := b.bulk.Run()
+	metrics.ObserveDBLatency(b.collection.Name, "bulk", start)
+
+	if err != nil {
+		fields := log.Fields{
+			"Module":     "beaconsProxy",
+			"Collection": b.collection.Name,
+			"Pending":    b.pending,
+		}
+		if bulkErr, ok := err.(*mgo.BulkError); ok {
+			fields["Failed"] = len(bulkErr.Cases())
+		}
+		b.log.WithFields(fields).Error(err)
+		b.onError(err)
+	}
+
+	b.reset()
+}
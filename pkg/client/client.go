@@ -0,0 +1,95 @@
+package client
+
+import (
+	"errors"
+
+	"github.com/activecm/rita/config"
+	"github.com/activecm/rita/database"
+	"github.com/activecm/rita/pkg/data"
+	"github.com/globalsign/mgo/bson"
+)
+
+type (
+	//Client queries the results of the databases RITA has analyzed. The results are
+	//decoded into typed structs so that other Go programs don't have to depend on the
+	//layout of RITA's documents.
+	Client struct {
+		db     *database.DB
+		tables config.TableCfg
+	}
+
+	//ProxyBeacon is a source which connected to an FQDN through a proxy at regular intervals
+	ProxyBeacon struct {
+		Src            string          `bson:"src"`
+		SrcNetworkName string          `bson:"src_network_name"`
+		SrcNetworkUUID bson.Binary     `bson:"src_network_uuid"`
+		FQDN           string          `bson:"fqdn"`
+		Proxy          data.UniqueIP   `bson:"proxy"`
+		CID            int             `bson:"cid"`
+		Connections    int64           `bson:"connection_count"`
+		Score          float64         `bson:"score"`
+		ScoreBand      string          `bson:"score_band"`
+		LowConfidence  bool            `bson:"low_confidence"`
+		Ts             ProxyBeaconTs   `bson:"ts"`
+		Dur            *ProxyBeaconDur `bson:"dur,omitempty"`
+		TsList         []int64         `bson:"tslist"`
+		TsListCount    int64           `bson:"tslist_count"` // may exceed the length of TsList if it was truncated
+	}
+
+	//ProxyBeaconTs holds the components of a proxy beacon's timestamp score
+	ProxyBeaconTs struct {
+		Score           float64  `bson:"score"`
+		Range           int64    `bson:"range"`
+		Mode            int64    `bson:"mode"`
+		ModeCount       int64    `bson:"mode_count"`
+		Skew            float64  `bson:"skew"`
+		Dispersion      int64    `bson:"dispersion"`
+		SkewScore       float64  `bson:"skew_score"`
+		DispersionScore float64  `bson:"dispersion_score"`
+		ConnsScore      float64  `bson:"conns_score"`
+		AutocorrScore   *float64 `bson:"autocorr_score,omitempty"` // only set if autocorrelation is enabled
+		DriftSlope      *float64 `bson:"drift_slope,omitempty"`    // only set if drift analysis is enabled
+		DriftScore      *float64 `bson:"drift_score,omitempty"`    // only set if drift analysis is enabled
+		Intervals       []int64  `bson:"intervals"`
+		IntervalCounts  []int64  `bson:"interval_counts"`
+	}
+
+	//ProxyBeaconDur holds the components of a proxy beacon's duration score. It is only
+	//set if duration analysis was enabled and enough durations were recorded.
+	ProxyBeaconDur struct {
+		Skew       float64 `bson:"skew"`
+		Dispersion float64 `bson:"dispersion"`
+		Score      float64 `bson:"score"`
+	}
+)
+
+//NewClient creates a Client reading the tables named in the config through the given
+//database connection, which may be created with database.NewDB
+func NewClient(db *database.DB, conf *config.Config) *Client {
+	return &Client{
+		db:     db,
+		tables: conf.T,
+	}
+}
+
+//TopProxyBeacons returns up to limit of the highest scoring proxy beacons in a database
+//scoring at least minScore, highest scores first. A limit of 0 returns every one of them.
+func (c *Client) TopProxyBeacons(db string, minScore float64, limit int) ([]ProxyBeacon, error) {
+	if db == "" {
+		return nil, errors.New("a database is required")
+	}
+	if limit < 0 {
+		return nil, errors.New("the limit may not be negative")
+	}
+
+	ssn := c.db.Session.Copy()
+	defer ssn.Close()
+
+	beacons := []ProxyBeacon{}
+	err := ssn.DB(db).C(c.tables.BeaconProxy.BeaconProxyTable).
+		Find(bson.M{"score": bson.M{"$gte": minScore}}).
+		Sort("-score").
+		Limit(limit).
+		All(&beacons)
+	return beacons, err
+}
@@ -0,0 +1,106 @@
+package client
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/activecm/rita/pkg/data"
+	"github.com/activecm/rita/util"
+	"github.com/globalsign/mgo/bson"
+	"github.com/stretchr/testify/require"
+)
+
+//readFixtures decodes the proxy beacon documents stored as MongoDB extended JSON in
+//testdata the same way the documents are decoded when they are read from MongoDB
+func readFixtures(t *testing.T) []ProxyBeacon {
+	file, err := os.Open(filepath.Join("testdata", "proxy_beacons.ndjson"))
+	require.Nil(t, err)
+	defer file.Close()
+
+	var beacons []ProxyBeacon
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var doc bson.M
+		require.Nil(t, bson.UnmarshalJSON(scanner.Bytes(), &doc))
+		raw, err := bson.Marshal(doc)
+		require.Nil(t, err)
+
+		var beacon ProxyBeacon
+		require.Nil(t, bson.Unmarshal(raw, &beacon))
+		beacons = append(beacons, beacon)
+	}
+	require.Nil(t, scanner.Err())
+	return beacons
+}
+
+func TestDecodeProxyBeacons(t *testing.T) {
+	beacons := readFixtures(t)
+	require.Len(t, beacons, 2)
+
+	autocorr, driftSlope, driftScore := 0.9, -0.25, 0.7
+	require.Equal(t, ProxyBeacon{
+		Src:            "10.0.0.1",
+		SrcNetworkName: util.UnknownPrivateNetworkName,
+		SrcNetworkUUID: util.UnknownPrivateNetworkUUID,
+		FQDN:           "example.com",
+		Proxy: data.UniqueIP{
+			IP:          "10.0.0.100",
+			NetworkUUID: util.UnknownPrivateNetworkUUID,
+			NetworkName: util.UnknownPrivateNetworkName,
+		},
+		CID:         2,
+		Connections: 24,
+		Score:       0.827,
+		ScoreBand:   "high",
+		Ts: ProxyBeaconTs{
+			Score:           0.853,
+			Range:           1380,
+			Mode:            60,
+			ModeCount:       23,
+			Skew:            0,
+			Dispersion:      0,
+			SkewScore:       1,
+			DispersionScore: 1,
+			ConnsScore:      0.5,
+			AutocorrScore:   &autocorr,
+			DriftSlope:      &driftSlope,
+			DriftScore:      &driftScore,
+			Intervals:       []int64{60},
+			IntervalCounts:  []int64{23},
+		},
+		Dur: &ProxyBeaconDur{Skew: 0.1, Dispersion: 0.2, Score: 0.8},
+		// the stored timestamps were truncated
+		TsList:      []int64{1622548800, 1622548860},
+		TsListCount: 24,
+	}, beacons[0])
+}
+
+func TestDecodeProxyBeaconsOptionalScores(t *testing.T) {
+	beacons := readFixtures(t)
+	require.Len(t, beacons, 2)
+
+	// neither autocorrelation, drift nor duration analysis was enabled
+	beacon := beacons[1]
+	require.Equal(t, "example.org", beacon.FQDN)
+	require.Nil(t, beacon.Ts.AutocorrScore)
+	require.Nil(t, beacon.Ts.DriftSlope)
+	require.Nil(t, beacon.Ts.DriftScore)
+	require.Nil(t, beacon.Dur)
+	require.Equal(t, int64(300), beacon.Ts.Mode)
+	require.Equal(t, 0.91, beacon.Score)
+	require.Equal(t, "critical", beacon.ScoreBand)
+	require.True(t, beacon.LowConfidence)
+}
+
+func TestTopProxyBeaconsArguments(t *testing.T) {
+	// the arguments are checked before the database is queried
+	c := &Client{}
+
+	_, err := c.TopProxyBeacons("", 0.5, 10)
+	require.NotNil(t, err)
+
+	_, err = c.TopProxyBeacons("dataset", 0.5, -1)
+	require.NotNil(t, err)
+}
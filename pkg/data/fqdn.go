@@ -18,7 +18,7 @@ type UniqueSrcFQDNPair struct {
 func NewUniqueSrcFQDNPair(source UniqueIP, fqdn string) UniqueSrcFQDNPair {
 	return UniqueSrcFQDNPair{
 		UniqueSrcIP: UniqueSrcIP{
-			SrcIP:          source.IP,
+			SrcIP:          canonicalIP(source.IP),
 			SrcNetworkUUID: source.NetworkUUID,
 			SrcNetworkName: source.NetworkName,
 		},
@@ -28,12 +28,13 @@ func NewUniqueSrcFQDNPair(source UniqueIP, fqdn string) UniqueSrcFQDNPair {
 
 //MapKey generates a string which may be used to index a Unique SrcIP / FQDN pair. Concatenates IPs and UUIDs.
 func (p UniqueSrcFQDNPair) MapKey() string {
+	srcIP := canonicalIP(p.SrcIP)
 	var builder strings.Builder
 
 	srcUUIDLen := 1 + len(p.SrcNetworkUUID.Data)
 
-	builder.Grow(len(p.SrcIP) + srcUUIDLen + len(p.FQDN))
-	builder.WriteString(p.SrcIP)
+	builder.Grow(len(srcIP) + srcUUIDLen + len(p.FQDN))
+	builder.WriteString(srcIP)
 	builder.WriteByte(p.SrcNetworkUUID.Kind)
 	builder.Write(p.SrcNetworkUUID.Data)
 
@@ -46,7 +47,7 @@ func (p UniqueSrcFQDNPair) MapKey() string {
 // src-fqdn pair. Includes IP and Network UUID.
 func (p UniqueSrcFQDNPair) BSONKey() bson.M {
 	key := bson.M{
-		"src":              p.SrcIP,
+		"src":              canonicalIP(p.SrcIP),
 		"src_network_uuid": p.SrcNetworkUUID,
 		"fqdn":             p.FQDN,
 	}
@@ -0,0 +1,120 @@
+package data
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+)
+
+//InternalSubnets classifies IP addresses as internal or external to the monitored
+//network. The configured CIDR ranges are parsed once so the classification may be
+//performed for every connection. The IPv4 ranges are additionally compiled into
+//integer masks which are matched without converting the address for every range.
+type InternalSubnets struct {
+	subnets []*net.IPNet
+	ipv4    []ipv4Subnet
+	ipv6    []*net.IPNet
+}
+
+//ipv4Subnet is an IPv4 range compiled into its network address and mask
+type ipv4Subnet struct {
+	network uint32
+	mask    uint32
+}
+
+//NewInternalSubnetsFromNets compiles already parsed CIDR ranges
+func NewInternalSubnetsFromNets(subnets []*net.IPNet) InternalSubnets {
+	internal := InternalSubnets{subnets: subnets}
+	for _, block := range subnets {
+		// like net.IPNet.Contains, ranges with an IPv4 (or IPv4-mapped) network
+		// address only match IPv4 addresses
+		network := block.IP.To4()
+		mask := block.Mask
+		if network != nil && len(mask) == net.IPv6len {
+			mask = mask[12:]
+		}
+		if network == nil || len(mask) != net.IPv4len {
+			internal.ipv6 = append(internal.ipv6, block)
+			continue
+		}
+
+		ipv4Mask := binary.BigEndian.Uint32(mask)
+		internal.ipv4 = append(internal.ipv4, ipv4Subnet{
+			network: binary.BigEndian.Uint32(network) & ipv4Mask,
+			mask:    ipv4Mask,
+		})
+	}
+	return internal
+}
+
+//NewInternalSubnets parses the configured internal CIDR ranges. Entries without a
+//prefix length are treated as a single host.
+func NewInternalSubnets(cidrs []string) (InternalSubnets, error) {
+	subnets := make([]*net.IPNet, 0, len(cidrs))
+
+	for _, entry := range cidrs {
+		entry = strings.TrimSpace(entry)
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return InternalSubnets{}, fmt.Errorf("invalid internal subnet: %s", entry)
+			}
+			if ip.To4() != nil {
+				entry += "/32"
+			} else {
+				entry += "/128"
+			}
+		}
+
+		_, block, err := net.ParseCIDR(entry)
+		if err != nil {
+			return InternalSubnets{}, fmt.Errorf("invalid internal subnet: %s", entry)
+		}
+		subnets = append(subnets, block)
+	}
+	return NewInternalSubnetsFromNets(subnets), nil
+}
+
+//Subnets returns the parsed CIDR ranges
+func (s InternalSubnets) Subnets() []*net.IPNet {
+	return s.subnets
+}
+
+//Contains returns whether the IP address falls within one of the CIDR ranges.
+//IPv4-mapped IPv6 addresses are matched against the IPv4 ranges. Unlike IsInternal,
+//loopback and unspecified addresses receive no special treatment.
+func (s InternalSubnets) Contains(ip net.IP) bool {
+	if ipv4 := ip.To4(); ipv4 != nil {
+		addr := binary.BigEndian.Uint32(ipv4)
+		for _, block := range s.ipv4 {
+			if addr&block.mask == block.network {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, block := range s.ipv6 {
+		if block.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+//IsInternal returns whether the IP address falls within one of the internal subnets.
+//IPv4-mapped IPv6 addresses are matched against the IPv4 subnets. Loopback addresses
+//never leave the host, so they are always internal. Missing and unspecified addresses
+//(0.0.0.0 and ::) don't identify a host, so they are never internal.
+func (s InternalSubnets) IsInternal(ip net.IP) bool {
+	if ip == nil || ip.IsUnspecified() {
+		return false
+	}
+
+	if ip.IsLoopback() {
+		return true
+	}
+
+	return s.Contains(ip)
+}
@@ -0,0 +1,141 @@
+package data
+
+import (
+	"math/rand"
+	"net"
+	"testing"
+
+	"github.com/activecm/rita/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewInternalSubnets(t *testing.T) {
+	_, err := NewInternalSubnets([]string{"10.0.0.0/8", "192.168.1.1", "fd00::/8", "2001:db8::1"})
+	assert.Nil(t, err, "ranges and single hosts are parsed")
+
+	_, err = NewInternalSubnets([]string{"10.0.0.0/33"})
+	assert.NotNil(t, err, "invalid prefix lengths are rejected")
+
+	_, err = NewInternalSubnets([]string{"not-an-ip"})
+	assert.NotNil(t, err, "invalid addresses are rejected")
+}
+
+func TestIsInternal(t *testing.T) {
+	internal, err := NewInternalSubnets([]string{"10.0.0.0/8", "192.168.1.1", "fd00::/8", "2001:db8::1"})
+	assert.Nil(t, err)
+
+	testCases := []struct {
+		ip       string
+		internal bool
+		msg      string
+	}{
+		{"10.1.2.3", true, "ipv4 address in an internal range"},
+		{"11.1.2.3", false, "ipv4 address outside of the internal ranges"},
+		{"192.168.1.1", true, "ipv4 single host entry"},
+		{"192.168.1.2", false, "ipv4 address next to a single host entry"},
+		{"::ffff:10.1.2.3", true, "ipv4-mapped ipv6 address in an internal ipv4 range"},
+		{"fd12:3456::1", true, "ipv6 address in an internal range"},
+		{"2001:db8::1", true, "ipv6 single host entry"},
+		{"2001:db8::2", false, "ipv6 address next to a single host entry"},
+		{"2607:f8b0::1", false, "ipv6 address outside of the internal ranges"},
+		{"127.0.0.1", true, "ipv4 loopback"},
+		{"::1", true, "ipv6 loopback"},
+		{"0.0.0.0", false, "ipv4 unspecified address"},
+		{"::", false, "ipv6 unspecified address"},
+	}
+
+	for _, testCase := range testCases {
+		assert.Equal(t, testCase.internal, internal.IsInternal(net.ParseIP(testCase.ip)), testCase.msg)
+	}
+
+	assert.False(t, internal.IsInternal(nil), "missing address")
+
+	// all zeros covers every ipv4 address, but the unspecified address still isn't a host
+	everything, err := NewInternalSubnets([]string{"0.0.0.0/0"})
+	assert.Nil(t, err)
+	assert.True(t, everything.IsInternal(net.ParseIP("8.8.8.8")), "all zeros range")
+	assert.False(t, everything.IsInternal(net.ParseIP("0.0.0.0")), "unspecified address in the all zeros range")
+	assert.False(t, everything.IsInternal(net.ParseIP("2001:db8::2")), "ipv6 address outside of the all zeros ipv4 range")
+
+	// no internal subnets only leaves loopback addresses internal
+	var none InternalSubnets
+	assert.False(t, none.IsInternal(net.ParseIP("10.1.2.3")), "no internal subnets")
+}
+
+//testIPs generates a mix of IPv4, IPv4-mapped IPv6, and IPv6 addresses
+func testIPs(count int) []net.IP {
+	rng := rand.New(rand.NewSource(1))
+	ips := make([]net.IP, count)
+	for i := range ips {
+		switch i % 4 {
+		case 0:
+			ips[i] = net.IPv4(10, byte(rng.Intn(256)), byte(rng.Intn(256)), byte(rng.Intn(256)))
+		case 1:
+			ips[i] = net.IPv4(byte(rng.Intn(256)), byte(rng.Intn(256)), byte(rng.Intn(256)), byte(rng.Intn(256))).To4()
+		case 2:
+			ips[i] = net.IP{0xfd, byte(rng.Intn(2)), 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, byte(rng.Intn(256))}
+		default:
+			ips[i] = make(net.IP, net.IPv6len)
+			rng.Read(ips[i])
+		}
+	}
+	return ips
+}
+
+func TestContainsMatchesIPNet(t *testing.T) {
+	cidrs := []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.1.1/32", "0.0.0.0/1", "fd00::/8", "::ffff:0:0/96", "2001:db8::/32"}
+	subnets := util.ParseSubnets(cidrs)
+	internal := NewInternalSubnetsFromNets(subnets)
+	assert.Equal(t, subnets, internal.Subnets())
+
+	for _, ip := range testIPs(10000) {
+		assert.Equal(t, util.ContainsIP(subnets, ip), internal.Contains(ip), ip.String())
+	}
+
+	// unlike IsInternal, loopback and unspecified addresses are plain addresses
+	everything, err := NewInternalSubnets([]string{"0.0.0.0/0"})
+	assert.Nil(t, err)
+	assert.True(t, everything.Contains(net.ParseIP("127.0.0.1")))
+	assert.True(t, everything.Contains(net.ParseIP("0.0.0.0")))
+	assert.False(t, everything.Contains(nil))
+
+	private, err := NewInternalSubnets([]string{"10.0.0.0/8"})
+	assert.Nil(t, err)
+	assert.False(t, private.Contains(net.ParseIP("127.0.0.1")))
+}
+
+//BenchmarkInternalSubnets contrasts parsing the internal CIDR ranges for every lookup
+//against looking up addresses in the ranges compiled once
+func BenchmarkInternalSubnets(b *testing.B) {
+	cidrs := []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "fd00::/8"}
+	ips := testIPs(100000)
+
+	b.Run("parse", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			ip := ips[i%len(ips)]
+			for _, cidr := range cidrs {
+				_, block, _ := net.ParseCIDR(cidr)
+				if block.Contains(ip) {
+					break
+				}
+			}
+		}
+	})
+
+	b.Run("parsed", func(b *testing.B) {
+		subnets := util.ParseSubnets(cidrs)
+		for i := 0; i < b.N; i++ {
+			util.ContainsIP(subnets, ips[i%len(ips)])
+		}
+	})
+
+	b.Run("compiled", func(b *testing.B) {
+		internal, err := NewInternalSubnets(cidrs)
+		if err != nil {
+			b.Fatal(err)
+		}
+		for i := 0; i < b.N; i++ {
+			internal.Contains(ips[i%len(ips)])
+		}
+	})
+}
@@ -57,18 +57,34 @@ func NewUniqueIP(ip net.IP, agentUUID, agentName string) UniqueIP {
 	return u
 }
 
+//canonicalIP returns the canonical text form of an IP address so the different
+//forms of an IPv6 address, such as 2001:db8::1 and 2001:0DB8:0:0:0:0:0:1, produce
+//the same keys. IPv4 addresses and strings which are not IP addresses are returned as is.
+func canonicalIP(ip string) string {
+	// only IPv6 addresses have alternate forms, so skip parsing everything else
+	if strings.IndexByte(ip, ':') == -1 {
+		return ip
+	}
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ip
+	}
+	return parsed.String()
+}
+
 //Equal checks if two UniqueIPs have the same IP and network UUID
 func (u UniqueIP) Equal(ip UniqueIP) bool {
-	return (u.IP == ip.IP &&
+	return (canonicalIP(u.IP) == canonicalIP(ip.IP) &&
 		u.NetworkUUID.Kind == ip.NetworkUUID.Kind &&
 		bytes.Equal(u.NetworkUUID.Data, ip.NetworkUUID.Data))
 }
 
 //MapKey generates a string which may be used to index a given UniqueIP. Concatenates IP and Network UUID.
 func (u UniqueIP) MapKey() string {
+	ip := canonicalIP(u.IP)
 	var builder strings.Builder
-	builder.Grow(len(u.IP) + 1 + len(u.NetworkUUID.Data))
-	builder.WriteString(u.IP)
+	builder.Grow(len(ip) + 1 + len(u.NetworkUUID.Data))
+	builder.WriteString(ip)
 	builder.WriteByte(u.NetworkUUID.Kind)
 	builder.Write(u.NetworkUUID.Data)
 
@@ -78,7 +94,7 @@ func (u UniqueIP) MapKey() string {
 //BSONKey generates a BSON map which may be used to index a given UniqueIP. Includes IP and Network UUID.
 func (u UniqueIP) BSONKey() bson.M {
 	key := bson.M{
-		"ip":           u.IP,
+		"ip":           canonicalIP(u.IP),
 		"network_uuid": u.NetworkUUID,
 	}
 	return key
@@ -89,7 +105,7 @@ func (u UniqueIP) BSONKey() bson.M {
 //Ex: selector["dat"] = bson.M{"$elemMatch": someIP.PrefixedBSONKey("bl")}
 func (u UniqueIP) PrefixedBSONKey(prefix string) bson.M {
 	query := bson.M{}
-	query[prefix+".ip"] = u.IP
+	query[prefix+".ip"] = canonicalIP(u.IP)
 	query[prefix+".network_uuid"] = u.NetworkUUID
 	return query
 }
@@ -104,7 +120,7 @@ type UniqueSrcIP struct {
 //AsSrc returns the UniqueIP in the UniqueSrcIP format
 func (u UniqueIP) AsSrc() UniqueSrcIP {
 	return UniqueSrcIP{
-		SrcIP:          u.IP,
+		SrcIP:          canonicalIP(u.IP),
 		SrcNetworkUUID: u.NetworkUUID,
 		SrcNetworkName: u.NetworkName,
 	}
@@ -113,7 +129,7 @@ func (u UniqueIP) AsSrc() UniqueSrcIP {
 //Unpair returns a copy of the SrcUniqueIP in UniqueIP format
 func (u UniqueSrcIP) Unpair() UniqueIP {
 	return UniqueIP{
-		IP:          u.SrcIP,
+		IP:          canonicalIP(u.SrcIP),
 		NetworkUUID: u.SrcNetworkUUID,
 		NetworkName: u.SrcNetworkName,
 	}
@@ -123,7 +139,7 @@ func (u UniqueSrcIP) Unpair() UniqueIP {
 //Includes IP and Network UUID.
 func (u UniqueSrcIP) BSONKey() bson.M {
 	key := bson.M{
-		"src":              u.SrcIP,
+		"src":              canonicalIP(u.SrcIP),
 		"src_network_uuid": u.SrcNetworkUUID,
 	}
 	return key
@@ -139,7 +155,7 @@ type UniqueDstIP struct {
 //AsDst returns the UniqueIP in the UniqueDstIP format
 func (u UniqueIP) AsDst() UniqueDstIP {
 	return UniqueDstIP{
-		DstIP:          u.IP,
+		DstIP:          canonicalIP(u.IP),
 		DstNetworkUUID: u.NetworkUUID,
 		DstNetworkName: u.NetworkName,
 	}
@@ -148,7 +164,7 @@ func (u UniqueIP) AsDst() UniqueDstIP {
 //Unpair returns a copy of the DstUniqueIP in UniqueIP format
 func (u UniqueDstIP) Unpair() UniqueIP {
 	return UniqueIP{
-		IP:          u.DstIP,
+		IP:          canonicalIP(u.DstIP),
 		NetworkUUID: u.DstNetworkUUID,
 		NetworkName: u.DstNetworkName,
 	}
@@ -158,7 +174,7 @@ func (u UniqueDstIP) Unpair() UniqueIP {
 //Includes IP and Network UUID.
 func (u UniqueDstIP) BSONKey() bson.M {
 	key := bson.M{
-		"dst":              u.DstIP,
+		"dst":              canonicalIP(u.DstIP),
 		"dst_network_uuid": u.DstNetworkUUID,
 	}
 	return key
@@ -174,12 +190,12 @@ type UniqueIPPair struct {
 func NewUniqueIPPair(source UniqueIP, destination UniqueIP) UniqueIPPair {
 	return UniqueIPPair{
 		UniqueSrcIP: UniqueSrcIP{
-			SrcIP:          source.IP,
+			SrcIP:          canonicalIP(source.IP),
 			SrcNetworkUUID: source.NetworkUUID,
 			SrcNetworkName: source.NetworkName,
 		},
 		UniqueDstIP: UniqueDstIP{
-			DstIP:          destination.IP,
+			DstIP:          canonicalIP(destination.IP),
 			DstNetworkUUID: destination.NetworkUUID,
 			DstNetworkName: destination.NetworkName,
 		},
@@ -188,14 +204,16 @@ func NewUniqueIPPair(source UniqueIP, destination UniqueIP) UniqueIPPair {
 
 //MapKey generates a string which may be used to index an ordered pair of UniqueIPs. Concatenates IPs and UUIDs.
 func (p UniqueIPPair) MapKey() string {
+	srcIP := canonicalIP(p.SrcIP)
+	dstIP := canonicalIP(p.DstIP)
 	var builder strings.Builder
 
 	srcUUIDLen := 1 + len(p.SrcNetworkUUID.Data)
 	dstUUIDLen := 1 + len(p.DstNetworkUUID.Data)
 
-	builder.Grow(len(p.SrcIP) + srcUUIDLen + len(p.DstIP) + dstUUIDLen)
-	builder.WriteString(p.SrcIP)
-	builder.WriteString(p.DstIP)
+	builder.Grow(len(srcIP) + srcUUIDLen + len(dstIP) + dstUUIDLen)
+	builder.WriteString(srcIP)
+	builder.WriteString(dstIP)
 	builder.WriteByte(p.SrcNetworkUUID.Kind)
 	builder.Write(p.SrcNetworkUUID.Data)
 	builder.WriteByte(p.DstNetworkUUID.Kind)
@@ -208,9 +226,9 @@ func (p UniqueIPPair) MapKey() string {
 //Includes IP and Network UUID.
 func (p UniqueIPPair) BSONKey() bson.M {
 	key := bson.M{
-		"src":              p.SrcIP,
+		"src":              canonicalIP(p.SrcIP),
 		"src_network_uuid": p.SrcNetworkUUID,
-		"dst":              p.DstIP,
+		"dst":              canonicalIP(p.DstIP),
 		"dst_network_uuid": p.DstNetworkUUID,
 	}
 	return key
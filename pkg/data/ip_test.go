@@ -51,3 +51,68 @@ func TestNewUniqueIP(t *testing.T) {
 	assert.Equal(t, util.PublicNetworkUUID.Data, ip.NetworkUUID.Data, "uuid binary set to flag value for public ip with valid network data")
 	assert.Equal(t, util.PublicNetworkName, ip.NetworkName, "net name set to flag value for public ip with valid network data")
 }
+
+func TestUniqueIPv6Keys(t *testing.T) {
+	compressed := NewUniqueIP(net.ParseIP("2001:db8::1"), "", "")
+	expanded := UniqueIP{
+		IP:          "2001:0DB8:0000:0000:0000:0000:0000:0001",
+		NetworkUUID: compressed.NetworkUUID,
+		NetworkName: compressed.NetworkName,
+	}
+
+	assert.Equal(t, compressed.BSONKey(), expanded.BSONKey(), "bson keys match for both forms")
+	assert.Equal(t, compressed.MapKey(), expanded.MapKey(), "map keys match for both forms")
+	assert.Equal(t, compressed.PrefixedBSONKey("dat"), expanded.PrefixedBSONKey("dat"), "prefixed bson keys match for both forms")
+	assert.True(t, compressed.Equal(expanded), "both forms are equal")
+
+	// both forms aggregate together
+	set := make(UniqueIPSet)
+	set.Insert(compressed)
+	set.Insert(expanded)
+	assert.Len(t, set, 1, "both forms are stored once in a set")
+
+	// the canonical form survives pairing and unpairing
+	dst := NewUniqueIP(net.ParseIP("2001:db8::2"), "", "")
+	pair := NewUniqueIPPair(expanded, dst)
+	assert.Equal(t, NewUniqueIPPair(compressed, dst).MapKey(), pair.MapKey(), "pair map keys match for both forms")
+	assert.Equal(t, NewUniqueIPPair(compressed, dst).BSONKey(), pair.BSONKey(), "pair bson keys match for both forms")
+	assert.Equal(t, compressed, pair.UniqueSrcIP.Unpair(), "source round trips")
+	assert.Equal(t, dst, pair.UniqueDstIP.Unpair(), "destination round trips")
+	assert.Equal(t, compressed, expanded.AsSrc().Unpair(), "source conversion round trips")
+	assert.Equal(t, compressed, expanded.AsDst().Unpair(), "destination conversion round trips")
+
+	fqdnPair := NewUniqueSrcFQDNPair(expanded, "example.com")
+	assert.Equal(t, NewUniqueSrcFQDNPair(compressed, "example.com").BSONKey(), fqdnPair.BSONKey(), "fqdn pair bson keys match for both forms")
+	assert.Equal(t, NewUniqueSrcFQDNPair(compressed, "example.com").MapKey(), fqdnPair.MapKey(), "fqdn pair map keys match for both forms")
+	assert.Equal(t, compressed, fqdnPair.Unpair(), "fqdn pair source round trips")
+
+	// IPv4 addresses are left as is
+	assert.Equal(t, "10.0.0.1", canonicalIP("10.0.0.1"))
+	assert.Equal(t, "10.0.0.1", canonicalIP("::ffff:10.0.0.1"))
+	assert.Equal(t, "not-an-ip:", canonicalIP("not-an-ip:"))
+}
+
+func TestUniqueIPOverlappingNetworks(t *testing.T) {
+	// two sensors monitoring different networks which both use 10.0.0.0/8
+	first := NewUniqueIP(net.ParseIP("10.0.0.1"), "ff0d0776-0cdc-4a10-b793-522bcd48a560", "first")
+	second := NewUniqueIP(net.ParseIP("10.0.0.1"), "3a3c1ae2-9c8d-4d7e-8b2f-0d6c1f7e4a21", "second")
+
+	assert.False(t, first.Equal(second), "the same ip on different networks is not equal")
+	assert.NotEqual(t, first.MapKey(), second.MapKey(), "map keys differ between networks")
+	assert.NotEqual(t, first.BSONKey(), second.BSONKey(), "bson keys differ between networks")
+	assert.Equal(t, first.NetworkUUID, first.BSONKey()["network_uuid"], "bson key includes the network uuid")
+
+	dst := NewUniqueIP(net.ParseIP("8.8.8.8"), "", "")
+	assert.NotEqual(t, NewUniqueIPPair(first, dst).MapKey(), NewUniqueIPPair(second, dst).MapKey(), "pair map keys differ between networks")
+	assert.NotEqual(t, NewUniqueIPPair(first, dst).BSONKey(), NewUniqueIPPair(second, dst).BSONKey(), "pair bson keys differ between networks")
+
+	firstFQDN := NewUniqueSrcFQDNPair(first, "example.com")
+	secondFQDN := NewUniqueSrcFQDNPair(second, "example.com")
+	assert.NotEqual(t, firstFQDN.MapKey(), secondFQDN.MapKey(), "fqdn pair map keys differ between networks")
+	assert.NotEqual(t, firstFQDN.BSONKey(), secondFQDN.BSONKey(), "fqdn pair bson keys differ between networks")
+
+	set := make(UniqueIPSet)
+	set.Insert(first)
+	set.Insert(second)
+	assert.Len(t, set, 2, "both networks are stored in a set")
+}
@@ -0,0 +1,98 @@
+package data
+
+import (
+	"bytes"
+	"net"
+	"strings"
+
+	"github.com/globalsign/mgo/bson"
+)
+
+//SubnetPrefixLengths sets the width of the subnets IPv4 and IPv6 addresses are aggregated into
+type SubnetPrefixLengths struct {
+	IPv4 int
+	IPv6 int
+}
+
+//Subnet binds a CIDR range to a Network UUID and Network Name. Subnets parallel UniqueIPs
+//and allow the hosts in a range to be analyzed as a group. The Network Name should not be
+//considered when determining equality.
+type Subnet struct {
+	CIDR        string      `bson:"subnet"`
+	NetworkUUID bson.Binary `bson:"network_uuid"`
+	NetworkName string      `bson:"network_name"`
+}
+
+//NewSubnet returns the Subnet containing the given UniqueIP. The subnet is on the same
+//network as the UniqueIP.
+func NewSubnet(ip UniqueIP, prefixLengths SubnetPrefixLengths) Subnet {
+	subnet := Subnet{
+		CIDR:        ip.IP,
+		NetworkUUID: ip.NetworkUUID,
+		NetworkName: ip.NetworkName,
+	}
+
+	parsed := net.ParseIP(ip.IP)
+	if parsed == nil {
+		return subnet
+	}
+
+	var mask net.IPMask
+	if ipv4 := parsed.To4(); ipv4 != nil {
+		parsed = ipv4
+		mask = net.CIDRMask(prefixLengths.IPv4, 8*net.IPv4len)
+	} else {
+		mask = net.CIDRMask(prefixLengths.IPv6, 8*net.IPv6len)
+	}
+
+	// an invalid prefix length leaves the address as its own subnet
+	if mask == nil {
+		mask = net.CIDRMask(8*len(parsed), 8*len(parsed))
+	}
+
+	block := net.IPNet{IP: parsed.Mask(mask), Mask: mask}
+	subnet.CIDR = block.String()
+	return subnet
+}
+
+//String returns the subnet in CIDR notation
+func (s Subnet) String() string {
+	return s.CIDR
+}
+
+//Equal checks if two Subnets have the same range and network UUID
+func (s Subnet) Equal(subnet Subnet) bool {
+	return (s.CIDR == subnet.CIDR &&
+		s.NetworkUUID.Kind == subnet.NetworkUUID.Kind &&
+		bytes.Equal(s.NetworkUUID.Data, subnet.NetworkUUID.Data))
+}
+
+//MapKey generates a string which may be used to index a given Subnet. Concatenates CIDR and Network UUID.
+func (s Subnet) MapKey() string {
+	var builder strings.Builder
+	builder.Grow(len(s.CIDR) + 1 + len(s.NetworkUUID.Data))
+	builder.WriteString(s.CIDR)
+	builder.WriteByte(s.NetworkUUID.Kind)
+	builder.Write(s.NetworkUUID.Data)
+
+	return builder.String()
+}
+
+//BSONKey generates a BSON map which may be used to index a given Subnet. Includes CIDR and Network UUID.
+func (s Subnet) BSONKey() bson.M {
+	key := bson.M{
+		"subnet":       s.CIDR,
+		"network_uuid": s.NetworkUUID,
+	}
+	return key
+}
+
+//AsUniqueIP returns the Subnet in the UniqueIP format so the subnet may stand in for
+//a host in a UniqueIP pair. The IP is set to the subnet in CIDR notation.
+func (s Subnet) AsUniqueIP() UniqueIP {
+	return UniqueIP{
+		IP:          s.CIDR,
+		NetworkUUID: s.NetworkUUID,
+		NetworkName: s.NetworkName,
+	}
+}
@@ -0,0 +1,62 @@
+package data
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewSubnet(t *testing.T) {
+	prefixLengths := SubnetPrefixLengths{IPv4: 24, IPv6: 64}
+
+	testCases := []struct {
+		ip   string
+		cidr string
+		msg  string
+	}{
+		{"10.0.0.1", "10.0.0.0/24", "ipv4 address"},
+		{"10.0.0.255", "10.0.0.0/24", "ipv4 address at the end of the range"},
+		{"::ffff:10.0.0.1", "10.0.0.0/24", "ipv4-mapped ipv6 address"},
+		{"2001:db8:0:1:2:3:4:5", "2001:db8:0:1::/64", "ipv6 address"},
+	}
+
+	for _, testCase := range testCases {
+		ip := NewUniqueIP(net.ParseIP(testCase.ip), "", "")
+		subnet := NewSubnet(ip, prefixLengths)
+		assert.Equal(t, testCase.cidr, subnet.String(), testCase.msg)
+		assert.Equal(t, ip.NetworkUUID, subnet.NetworkUUID, testCase.msg)
+		assert.Equal(t, ip.NetworkName, subnet.NetworkName, testCase.msg)
+	}
+
+	// the prefix lengths are set separately for ipv4 and ipv6
+	wide := SubnetPrefixLengths{IPv4: 16, IPv6: 48}
+	assert.Equal(t, "10.0.0.0/16", NewSubnet(NewUniqueIP(net.ParseIP("10.0.5.1"), "", ""), wide).String())
+	assert.Equal(t, "2001:db8::/48", NewSubnet(NewUniqueIP(net.ParseIP("2001:db8:0:1::1"), "", ""), wide).String())
+
+	// invalid prefix lengths leave the address as its own subnet
+	invalid := SubnetPrefixLengths{IPv4: 33, IPv6: 129}
+	assert.Equal(t, "10.0.0.1/32", NewSubnet(NewUniqueIP(net.ParseIP("10.0.0.1"), "", ""), invalid).String())
+	assert.Equal(t, "2001:db8::1/128", NewSubnet(NewUniqueIP(net.ParseIP("2001:db8::1"), "", ""), invalid).String())
+}
+
+func TestSubnetKeys(t *testing.T) {
+	prefixLengths := SubnetPrefixLengths{IPv4: 24, IPv6: 64}
+	first := NewSubnet(NewUniqueIP(net.ParseIP("10.0.0.1"), "", ""), prefixLengths)
+	second := NewSubnet(NewUniqueIP(net.ParseIP("10.0.0.2"), "", ""), prefixLengths)
+	other := NewSubnet(NewUniqueIP(net.ParseIP("10.0.1.1"), "", ""), prefixLengths)
+	otherNetwork := NewSubnet(NewUniqueIP(net.ParseIP("10.0.0.1"), "ff0d0776-0cdc-4a10-b793-522bcd48a560", "other"), prefixLengths)
+
+	assert.True(t, first.Equal(second), "addresses in the same range share a subnet")
+	assert.Equal(t, first.BSONKey(), second.BSONKey(), "bson keys match in the same range")
+	assert.Equal(t, first.MapKey(), second.MapKey(), "map keys match in the same range")
+
+	assert.False(t, first.Equal(other), "addresses in different ranges don't share a subnet")
+	assert.NotEqual(t, first.BSONKey(), other.BSONKey(), "bson keys differ between ranges")
+
+	assert.False(t, first.Equal(otherNetwork), "the same range on different networks is not equal")
+	assert.NotEqual(t, first.BSONKey(), otherNetwork.BSONKey(), "bson keys differ between networks")
+	assert.NotEqual(t, first.MapKey(), otherNetwork.MapKey(), "map keys differ between networks")
+
+	assert.Equal(t, "10.0.0.0/24", first.AsUniqueIP().IP, "the subnet stands in for a host")
+}
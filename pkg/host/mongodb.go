@@ -7,7 +7,6 @@ import (
 	"github.com/activecm/rita/database"
 	"github.com/activecm/rita/util"
 
-	"github.com/globalsign/mgo"
 	"github.com/vbauerster/mpb"
 	"github.com/vbauerster/mpb/decor"
 
@@ -30,31 +29,8 @@ func NewMongoRepository(db *database.DB, conf *config.Config, logger *log.Logger
 }
 
 func (r *repo) CreateIndexes() error {
-	session := r.database.Session.Copy()
-	defer session.Close()
-
-	coll := session.DB(r.database.GetSelectedDB()).C(r.config.T.Structure.HostTable)
-
-	// create hosts collection
-	// Desired indexes
-	indexes := []mgo.Index{
-		{Key: []string{"ip", "network_uuid"}, Unique: true},
-		{Key: []string{"local"}},
-		{Key: []string{"ipv4_binary"}},
-		{Key: []string{"dat.mdip.ip", "dat.mdip.network_uuid"}},
-		{Key: []string{"dat.mbdst.ip", "dat.mbdst.network_uuid"}},
-		{Key: []string{"dat.max_dns.query"}},
-		{Key: []string{"dat.mbfqdn"}},
-		{Key: []string{"dat.mbproxy"}},
-	}
-
-	for _, index := range indexes {
-		err := coll.EnsureIndex(index)
-		if err != nil {
-			return err
-		}
-	}
-	return nil
+	// create hosts collection with the desired indexes
+	return r.database.EnsureIndexes(r.config.T.Structure.HostTable, database.HostIndexes)
 }
 
 //Upsert loops through every domain ....
@@ -0,0 +1,18 @@
+package remover
+
+//ExpiredChunks returns the chunks of a rolling database which fall outside of a
+//retention window holding the keep most recent chunks. Chunk ids are reused once
+//a rolling database wraps around, so the age of a chunk is the number of chunks
+//imported since it, counting back from the current chunk. The expired chunks are
+//ordered from newest to oldest.
+func ExpiredChunks(currentChunk int, totalChunks int, keep int) []int {
+	if keep < 1 {
+		keep = 1
+	}
+
+	var expired []int
+	for age := keep; age < totalChunks; age++ {
+		expired = append(expired, (currentChunk-age%totalChunks+totalChunks)%totalChunks)
+	}
+	return expired
+}
@@ -0,0 +1,29 @@
+package remover
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpiredChunks(t *testing.T) {
+	testCases := []struct {
+		name     string
+		current  int
+		total    int
+		keep     int
+		expected []int
+	}{
+		{"before wrapping", 5, 8, 3, []int{2, 1, 0, 7, 6}},
+		{"after wrapping", 1, 8, 3, []int{6, 5, 4, 3, 2}},
+		{"keep everything", 5, 8, 8, nil},
+		{"keep more than exists", 5, 8, 10, nil},
+		{"keep at least the current chunk", 2, 4, 0, []int{1, 0, 3}},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			require.Equal(t, test.expected, ExpiredChunks(test.current, test.total, test.keep))
+		})
+	}
+}
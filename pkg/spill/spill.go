@@ -0,0 +1,311 @@
+package spill
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/activecm/rita/util"
+)
+
+//valueSize is the number of bytes each value occupies on disk
+const valueSize = 8
+
+//blockValues is the number of values read from disk at once by an Iterator
+const blockValues = 4096
+
+type (
+	//Sorter sorts a stream of int64 values with bounded memory. Values are buffered
+	//until runLength values have been added, at which point the buffer is sorted and
+	//written to a temporary file. Finish merges the sorted runs into a List.
+	Sorter struct {
+		dir       string     // directory holding the temporary files, os.TempDir if empty
+		runLength int        // number of values held in memory
+		unique    bool       // drop duplicate values
+		buffer    []int64    // values which have not been written to a run yet
+		runs      []*os.File // sorted runs written so far
+	}
+
+	//List is a sorted list of int64 values stored in a temporary file. The values are
+	//read back with Iterators, which hold a single block of values in memory.
+	List struct {
+		file   *os.File
+		length int64
+	}
+
+	//Iterator reads the values of a List one at a time, either in ascending or in
+	//descending order
+	Iterator struct {
+		list  *List
+		next  int64   // index of the next value
+		step  int64   // 1 for ascending order, -1 for descending order
+		block []int64 // values read from disk
+		start int64   // index of the first value in block
+		err   error
+	}
+
+	//runReader reads the values of a sorted run during the merge
+	runReader struct {
+		reader *bufio.Reader
+		value  int64
+	}
+
+	//runHeap orders the runs by their current value
+	runHeap []*runReader
+)
+
+//NewSorter creates a Sorter which holds up to runLength values in memory. Temporary
+//files are created in dir, or the default temporary directory if dir is empty.
+//Duplicate values are dropped if unique is set.
+func NewSorter(dir string, runLength int, unique bool) *Sorter {
+	return &Sorter{
+		dir:       dir,
+		runLength: util.Max(1, runLength),
+		unique:    unique,
+	}
+}
+
+//Add adds a value to the sorter. A sorted run is written to disk once the buffer fills up.
+func (s *Sorter) Add(value int64) error {
+	s.buffer = append(s.buffer, value)
+	if len(s.buffer) >= s.runLength {
+		return s.writeRun()
+	}
+	return nil
+}
+
+//writeRun sorts the buffered values and writes them to a temporary file
+func (s *Sorter) writeRun() error {
+	sort.Sort(util.SortableInt64(s.buffer))
+
+	file, err := ioutil.TempFile(s.dir, "rita-spill-run-")
+	if err != nil {
+		return err
+	}
+	s.runs = append(s.runs, file)
+
+	writer := bufio.NewWriter(file)
+	for i, value := range s.buffer {
+		if s.unique && i > 0 && value == s.buffer[i-1] {
+			continue
+		}
+		if err := writeValue(writer, value); err != nil {
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	s.buffer = s.buffer[:0]
+	return nil
+}
+
+//Finish merges the sorted runs into a List. The Sorter may not be used afterwards.
+//The caller must close the List to remove its file.
+func (s *Sorter) Finish() (*List, error) {
+	defer s.Close()
+
+	if len(s.buffer) > 0 || len(s.runs) == 0 {
+		if err := s.writeRun(); err != nil {
+			return nil, err
+		}
+	}
+
+	file, err := ioutil.TempFile(s.dir, "rita-spill-")
+	if err != nil {
+		return nil, err
+	}
+	list := &List{file: file}
+
+	if err := s.merge(list); err != nil {
+		list.Close()
+		return nil, err
+	}
+	return list, nil
+}
+
+//merge merges the sorted runs into the list's file
+func (s *Sorter) merge(list *List) error {
+	runs := make(runHeap, 0, len(s.runs))
+	for _, run := range s.runs {
+		if _, err := run.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		reader := &runReader{reader: bufio.NewReader(run)}
+		ok, err := reader.advance()
+		if err != nil {
+			return err
+		}
+		if ok {
+			runs = append(runs, reader)
+		}
+	}
+	heap.Init(&runs)
+
+	writer := bufio.NewWriter(list.file)
+	var last int64
+	for len(runs) > 0 {
+		run := runs[0]
+		if !s.unique || list.length == 0 || run.value != last {
+			if err := writeValue(writer, run.value); err != nil {
+				return err
+			}
+			last = run.value
+			list.length++
+		}
+
+		ok, err := run.advance()
+		if err != nil {
+			return err
+		}
+		if ok {
+			heap.Fix(&runs, 0)
+		} else {
+			heap.Pop(&runs)
+		}
+	}
+	return writer.Flush()
+}
+
+//Close removes the temporary files of the sorted runs
+func (s *Sorter) Close() error {
+	var firstErr error
+	for _, run := range s.runs {
+		if err := removeFile(run); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	s.runs = nil
+	s.buffer = nil
+	return firstErr
+}
+
+//Len returns the number of values in the list
+func (l *List) Len() int64 {
+	return l.length
+}
+
+//At returns the value at index i
+func (l *List) At(i int64) (int64, error) {
+	var value [valueSize]byte
+	if _, err := l.file.ReadAt(value[:], i*valueSize); err != nil {
+		return 0, err
+	}
+	return int64(binary.LittleEndian.Uint64(value[:])), nil
+}
+
+//Iter returns an Iterator which reads the values in ascending order starting at index start
+func (l *List) Iter(start int64) *Iterator {
+	return &Iterator{list: l, next: start, step: 1}
+}
+
+//ReverseIter returns an Iterator which reads the values in descending order starting at index start
+func (l *List) ReverseIter(start int64) *Iterator {
+	return &Iterator{list: l, next: start, step: -1}
+}
+
+//Close closes and removes the list's temporary file
+func (l *List) Close() error {
+	return removeFile(l.file)
+}
+
+//Next returns the next value. The second return value is false once the iterator
+//runs past either end of the list or an error occurs.
+func (it *Iterator) Next() (int64, bool) {
+	if it.err != nil || it.next < 0 || it.next >= it.list.length {
+		return 0, false
+	}
+
+	if it.next < it.start || it.next >= it.start+int64(len(it.block)) {
+		if err := it.readBlock(); err != nil {
+			it.err = err
+			return 0, false
+		}
+	}
+
+	value := it.block[it.next-it.start]
+	it.next += it.step
+	return value, true
+}
+
+//Err returns the error which stopped the iterator, if any
+func (it *Iterator) Err() error {
+	return it.err
+}
+
+//readBlock reads the block of values holding the next value. Descending iterators read
+//the block which ends at the next value.
+func (it *Iterator) readBlock() error {
+	start := it.next
+	if it.step < 0 {
+		start = it.next - blockValues + 1
+		if start < 0 {
+			start = 0
+		}
+	}
+	count := blockValues
+	if remaining := it.list.length - start; remaining < int64(count) {
+		count = int(remaining)
+	}
+
+	raw := make([]byte, count*valueSize)
+	if _, err := it.list.file.ReadAt(raw, start*valueSize); err != nil {
+		return err
+	}
+
+	if cap(it.block) < count {
+		it.block = make([]int64, count)
+	}
+	it.block = it.block[:count]
+	for i := range it.block {
+		it.block[i] = int64(binary.LittleEndian.Uint64(raw[i*valueSize:]))
+	}
+	it.start = start
+	return nil
+}
+
+//advance reads the next value of the run. Returns false at the end of the run.
+func (r *runReader) advance() (bool, error) {
+	var value [valueSize]byte
+	if _, err := io.ReadFull(r.reader, value[:]); err != nil {
+		if err == io.EOF {
+			return false, nil
+		}
+		return false, err
+	}
+	r.value = int64(binary.LittleEndian.Uint64(value[:]))
+	return true, nil
+}
+
+func (h runHeap) Len() int            { return len(h) }
+func (h runHeap) Less(i, j int) bool  { return h[i].value < h[j].value }
+func (h runHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *runHeap) Push(x interface{}) { *h = append(*h, x.(*runReader)) }
+func (h *runHeap) Pop() interface{} {
+	old := *h
+	last := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return last
+}
+
+//writeValue writes a value in the on disk format
+func writeValue(writer *bufio.Writer, value int64) error {
+	var raw [valueSize]byte
+	binary.LittleEndian.PutUint64(raw[:], uint64(value))
+	_, err := writer.Write(raw[:])
+	return err
+}
+
+//removeFile closes and removes a temporary file
+func removeFile(file *os.File) error {
+	closeErr := file.Close()
+	if err := os.Remove(file.Name()); err != nil {
+		return err
+	}
+	return closeErr
+}
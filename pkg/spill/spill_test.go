@@ -0,0 +1,107 @@
+package spill
+
+import (
+	"io/ioutil"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/activecm/rita/util"
+	"github.com/stretchr/testify/require"
+)
+
+//sortValues adds the values to a sorter holding runLength values in memory and returns the result
+func sortValues(t *testing.T, dir string, values []int64, runLength int, unique bool) *List {
+	sorter := NewSorter(dir, runLength, unique)
+	for _, value := range values {
+		require.Nil(t, sorter.Add(value))
+	}
+	list, err := sorter.Finish()
+	require.Nil(t, err)
+	return list
+}
+
+//readAll reads the values of an iterator into a slice
+func readAll(t *testing.T, iter *Iterator) []int64 {
+	var values []int64
+	for value, ok := iter.Next(); ok; value, ok = iter.Next() {
+		values = append(values, value)
+	}
+	require.Nil(t, iter.Err())
+	return values
+}
+
+func TestSorter(t *testing.T) {
+	dir := t.TempDir()
+	rng := rand.New(rand.NewSource(1))
+
+	values := make([]int64, 10000)
+	for i := range values {
+		values[i] = rng.Int63n(2000) - 1000
+	}
+
+	expected := append([]int64(nil), values...)
+	sort.Sort(util.SortableInt64(expected))
+
+	var expectedUnique []int64
+	for i, value := range expected {
+		if i == 0 || value != expected[i-1] {
+			expectedUnique = append(expectedUnique, value)
+		}
+	}
+
+	// a single run, an uneven number of runs, and many runs
+	for _, runLength := range []int{len(values), 3000, 7} {
+		list := sortValues(t, dir, values, runLength, false)
+		require.Equal(t, int64(len(expected)), list.Len())
+		require.Equal(t, expected, readAll(t, list.Iter(0)))
+		require.Nil(t, list.Close())
+
+		list = sortValues(t, dir, values, runLength, true)
+		require.Equal(t, int64(len(expectedUnique)), list.Len())
+		require.Equal(t, expectedUnique, readAll(t, list.Iter(0)))
+		require.Nil(t, list.Close())
+	}
+
+	// the runs and lists are removed once they are closed
+	files, err := ioutil.ReadDir(dir)
+	require.Nil(t, err)
+	require.Empty(t, files)
+}
+
+func TestSorterEmpty(t *testing.T) {
+	list := sortValues(t, t.TempDir(), nil, 10, true)
+	defer list.Close()
+
+	require.Equal(t, int64(0), list.Len())
+	require.Empty(t, readAll(t, list.Iter(0)))
+	require.Empty(t, readAll(t, list.ReverseIter(-1)))
+}
+
+func TestListIterators(t *testing.T) {
+	// span several blocks so the iterators have to read from disk more than once
+	values := make([]int64, 3*blockValues+17)
+	for i := range values {
+		values[i] = int64(i * 3)
+	}
+	list := sortValues(t, t.TempDir(), values, blockValues, false)
+	defer list.Close()
+
+	for _, start := range []int64{0, 1, blockValues - 1, blockValues, int64(len(values) - 1)} {
+		require.Equal(t, values[start:], readAll(t, list.Iter(start)))
+
+		var reversed []int64
+		for i := start; i >= 0; i-- {
+			reversed = append(reversed, values[i])
+		}
+		require.Equal(t, reversed, readAll(t, list.ReverseIter(start)))
+
+		value, err := list.At(start)
+		require.Nil(t, err)
+		require.Equal(t, values[start], value)
+	}
+
+	// iterators starting past either end of the list are empty
+	require.Empty(t, readAll(t, list.Iter(int64(len(values)))))
+	require.Empty(t, readAll(t, list.ReverseIter(-1)))
+}
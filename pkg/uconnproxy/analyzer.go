@@ -88,13 +88,26 @@ func (a *analyzer) start() {
 					"src_network_name": datum.Hosts.SrcNetworkName,
 					"proxy":            datum.Proxy,
 				}
-				query["$push"] = bson.M{
-					"dat": bson.M{
-						"count": datum.ConnectionCount,
-						"ts":    datum.TsList,
-						"cid":   a.chunk,
-					},
+				dat := bson.M{
+					"count": datum.ConnectionCount,
+					"ts":    datum.TsList,
+					"cid":   a.chunk,
 				}
+
+				// durations are only recorded if proxy beacon duration analysis is enabled
+				if len(datum.DurList) > 0 {
+					dat["dur"] = datum.DurList
+				}
+
+				// byte counts are only recorded if proxy beacon byte counts are enabled
+				// and the connections carrying the requests were logged
+				if datum.OrigBytes != nil {
+					dat["orig_bytes"] = *datum.OrigBytes
+					dat["resp_bytes"] = *datum.RespBytes
+					dat["bytes"] = datum.BytesList
+				}
+
+				query["$push"] = bson.M{"dat": dat}
 			}
 
 			// assign formatted query to output
@@ -2,6 +2,7 @@ package uconnproxy
 
 import (
 	"github.com/activecm/rita/pkg/data"
+	"github.com/activecm/rita/pkg/spill"
 	"github.com/globalsign/mgo/bson"
 )
 
@@ -28,10 +29,28 @@ type update struct {
 // was attempting to communicate.
 // Contains a list of unique time stamps for the
 // connections out from the Src to the FQDN via the
-// proxy server and a count of the connections.
+// proxy server and a count of the connections. The time stamps
+// are recorded with the precision set by BeaconProxy.TimestampPrecision.
+// The durations of the connections are only recorded if
+// BeaconProxy.DurationEnabled is set.
+// The total bytes sent by the Src and by the FQDN over the connections,
+// and the bytes sent both ways over each connection in BytesList, are only
+// recorded if BeaconProxy.BytesEnabled is set. The totals are nil if none
+// of the connections were found in the conn logs.
+// If BeaconProxy.SubnetAggregation is enabled, SrcSubnet holds the
+// subnet the connections were aggregated into and the source of Hosts
+// is the subnet in CIDR notation.
+// If there are too many timestamps to hold in memory, TsSpill holds
+// the sorted, unique timestamps instead of TsList. The analyzer closes it.
 type Input struct {
 	Hosts           data.UniqueSrcFQDNPair
+	SrcSubnet       *data.Subnet
 	TsList          []int64
+	TsSpill         *spill.List
+	DurList         []float64
+	OrigBytes       *int64
+	RespBytes       *int64
+	BytesList       []int64
 	Proxy           data.UniqueIP
 	ConnectionCount int64
 }
@@ -0,0 +1,89 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/activecm/rita/config"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	sdkresource "go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+//tracerName identifies the spans created by RITA
+const tracerName = "github.com/activecm/rita"
+
+//shutdownTimeout bounds how long exporting the remaining spans may hold up exiting
+const shutdownTimeout = 10 * time.Second
+
+//Init exports the spans created by RITA to the configured OTLP endpoint if tracing is
+//enabled. Otherwise, the spans are no-ops which record nothing. The returned function
+//exports the spans which have yet to be sent and must be called before exiting.
+func Init(conf *config.TracingStaticCfg, version string, logger *log.Logger) func() {
+	if !conf.Enabled {
+		return func() {}
+	}
+
+	// failing to export spans shouldn't interrupt the import, so the errors are only logged
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		logger.WithError(err).WithField("Endpoint", conf.Endpoint).Error("Could not export trace spans")
+	}))
+
+	exporter, err := newOTLPExporter(conf.Endpoint)
+	if err != nil {
+		logger.WithError(err).WithField("Endpoint", conf.Endpoint).Error("Could not set up exporting trace spans")
+		return func() {}
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(sdkresource.NewSchemaless(
+			attribute.String("service.name", "rita"),
+			attribute.String("service.version", version),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := provider.Shutdown(ctx); err != nil {
+			logger.WithError(err).WithField("Endpoint", conf.Endpoint).Error("Could not export trace spans")
+		}
+	}
+}
+
+//newOTLPExporter creates an exporter which posts the spans to the given OTLP/HTTP URL,
+//such as http://localhost:4318/v1/traces. TLS is used unless the scheme is http.
+func newOTLPExporter(endpoint string) (*otlptrace.Exporter, error) {
+	endpointURL, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if endpointURL.Scheme != "http" && endpointURL.Scheme != "https" {
+		return nil, fmt.Errorf("the OTLP endpoint %q must be an http or https URL", endpoint)
+	}
+
+	opts := []otlptracehttp.Option{
+		otlptracehttp.WithEndpoint(endpointURL.Host),
+		otlptracehttp.WithURLPath(endpointURL.Path),
+		otlptracehttp.WithTimeout(shutdownTimeout),
+	}
+	if endpointURL.Scheme == "http" {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	return otlptracehttp.New(context.Background(), opts...)
+}
+
+//Start starts a span as a child of the span held by ctx, if any. The returned context
+//holds the new span. The span must be ended by the caller.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
@@ -0,0 +1,43 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestOTLPExporter(t *testing.T) {
+	var paths []string
+	var contentTypes []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		contentTypes = append(contentTypes, r.Header.Get("Content-Type"))
+	}))
+	defer server.Close()
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	_, span := provider.Tracer(tracerName).Start(context.Background(), "import")
+	span.End()
+
+	// the spans are posted to the path of the configured URL
+	exporter, err := newOTLPExporter(server.URL + "/v1/traces")
+	require.Nil(t, err)
+	require.Nil(t, exporter.ExportSpans(context.Background(), recorder.Ended()))
+	require.Nil(t, exporter.Shutdown(context.Background()))
+	require.Equal(t, []string{"/v1/traces"}, paths)
+	require.Equal(t, []string{"application/x-protobuf"}, contentTypes)
+}
+
+func TestOTLPExporterEndpoint(t *testing.T) {
+	_, err := newOTLPExporter("localhost:4318/v1/traces")
+	require.NotNil(t, err)
+
+	_, err = newOTLPExporter("https://collector.example.com:4318/v1/traces")
+	require.Nil(t, err)
+}
@@ -100,6 +100,44 @@ func StringInSlice(value string, list []string) bool {
 	return false
 }
 
+//TimestampUnitsPerSecond returns the number of timestamp units in a second for the
+//given precision ("s", "ms", "us", or "ns"). Unknown precisions are treated as seconds.
+func TimestampUnitsPerSecond(precision string) int64 {
+	switch precision {
+	case "ms":
+		return 1000
+	case "us":
+		return 1000000
+	case "ns":
+		return 1000000000
+	default:
+		return 1
+	}
+}
+
+//the labels of the bands beacon scores are classified into
+const (
+	ScoreBandLow      = "low"
+	ScoreBandMedium   = "medium"
+	ScoreBandHigh     = "high"
+	ScoreBandCritical = "critical"
+)
+
+//ScoreBand returns the label of the band a beacon score falls in given the lowest
+//scores labeled medium, high, and critical
+func ScoreBand(score float64, medium float64, high float64, critical float64) string {
+	switch {
+	case score >= critical:
+		return ScoreBandCritical
+	case score >= high:
+		return ScoreBandHigh
+	case score >= medium:
+		return ScoreBandMedium
+	default:
+		return ScoreBandLow
+	}
+}
+
 //Int64InSlice returns true if the int64 is an element of the array
 func Int64InSlice(value int64, list []int64) bool {
 	for _, entry := range list {
@@ -108,3 +108,25 @@ func TestStringInSlice(t *testing.T) {
 	}
 
 }
+
+func TestScoreBand(t *testing.T) {
+	testCases := []struct {
+		score    float64
+		expected string
+	}{
+		{0, ScoreBandLow},
+		{0.499, ScoreBandLow},
+		{0.5, ScoreBandMedium},
+		{0.65, ScoreBandMedium},
+		{0.7, ScoreBandHigh},
+		{0.899, ScoreBandHigh},
+		{0.9, ScoreBandCritical},
+		{1, ScoreBandCritical},
+	}
+	for _, testCase := range testCases {
+		assert.Equal(t, testCase.expected, ScoreBand(testCase.score, 0.5, 0.7, 0.9), "score %v", testCase.score)
+	}
+
+	// the bands follow the thresholds they are given
+	assert.Equal(t, ScoreBandHigh, ScoreBand(0.65, 0.3, 0.6, 0.95))
+}